@@ -0,0 +1,282 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/middlendian/llima-box/pkg/helper"
+)
+
+// minUID is the lowest UID of a regular account
+const minUID = 1000
+
+// lookupEnvUser returns the account of the environment user name, or nil if
+// it doesn't exist. System accounts and the calling user are refused.
+func lookupEnvUser(name string) (*user.User, error) {
+	if err := helper.CheckName(name); err != nil {
+		return nil, err
+	}
+	u, err := user.Lookup(name)
+	var unknown user.UnknownUserError
+	if errors.As(err, &unknown) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil || uid < minUID {
+		return nil, fmt.Errorf("%s is a system account", name)
+	}
+	if name == os.Getenv("SUDO_USER") {
+		return nil, fmt.Errorf("%s is the calling user", name)
+	}
+	return u, nil
+}
+
+// lockEnv takes the VM-side lock of the environment name, the one the CLI's
+// scripts take with flock. It's released when the helper exits.
+func lockEnv(name string) error {
+	if err := os.MkdirAll(helper.LocksDir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(helper.LocksDir, name+".lock"), os.O_CREATE|os.O_RDWR, 0644) // #nosec G304 -- name is checked
+	if err != nil {
+		return err
+	}
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+// createEnv creates the user account and, if asked, the namespace keeper of
+// an environment, keeping those that exist
+func createEnv(req *helper.CreateEnvRequest) (*helper.CreateEnvResponse, error) {
+	if err := helper.CheckName(req.Name); err != nil {
+		return nil, err
+	}
+	// An account created by a concurrent setup in the meantime is kept
+	if err := lockEnv(req.Name); err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %w", req.Name, err)
+	}
+	u, err := lookupEnvUser(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if u == nil {
+		if err := createUser(req.Name, req.Shell); err != nil {
+			return nil, err
+		}
+	}
+	resp := &helper.CreateEnvResponse{}
+	if req.Namespace {
+		if resp.NamespacePID, err = startKeeper(req.Name); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// createUser adds the user name with a login shell and a home directory on
+// the data disk, if it's mounted. After VM recreation the home may already
+// exist there; useradd keeps it and it's handed to the new user.
+func createUser(name, shell string) error {
+	if !loginShell(shell) {
+		return fmt.Errorf("%s isn't a login shell listed in /etc/shells", shell)
+	}
+	base := "/home"
+	if info, err := os.Stat(helper.HomeBase); err == nil && info.IsDir() {
+		base = helper.HomeBase
+	}
+	if err := command("groupadd", "-f", helper.EnvGroup); err != nil {
+		return err
+	}
+	if err := command("useradd", "-m", "-b", base, "-s", shell, "-G", helper.EnvGroup, name); err != nil {
+		return err
+	}
+	return command("chown", "-R", name+":"+name, filepath.Join(base, name))
+}
+
+// loginShell reports whether shell is listed in /etc/shells
+func loginShell(shell string) bool {
+	f, err := os.Open("/etc/shells")
+	if err != nil {
+		return false
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == shell {
+			return true
+		}
+	}
+	return false
+}
+
+// pidFile returns the file holding the PID of an environment's keeper
+func pidFile(name string) string {
+	return filepath.Join(helper.EnvsDir, name, "namespace.pid")
+}
+
+// readKeeper returns the PID in an environment's PID file, or 0
+func readKeeper(name string) int {
+	data, err := os.ReadFile(pidFile(name)) // #nosec G304 -- name is checked
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0
+	}
+	return pid
+}
+
+// startKeeper starts the process holding an environment's mount and PID
+// namespaces, unless one is alive, and returns its PID. It runs in a
+// session of its own, so it outlives the SSH session that started it.
+// unshare blocks SIGTERM while it waits, so the keeper is stopped with
+// SIGKILL, which --kill-child passes on to the namespace's init.
+func startKeeper(name string) (int, error) {
+	if pid := readKeeper(name); pid != 0 && syscall.Kill(pid, 0) == nil {
+		return pid, nil
+	}
+	if err := os.MkdirAll(filepath.Join(helper.EnvsDir, name), 0755); err != nil {
+		return 0, err
+	}
+
+	cmd := exec.Command("unshare", "--mount", "--pid", "--fork", "--kill-child", "--propagation", "private", "bash", "-c", "sleep infinity")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start namespace keeper: %w", err)
+	}
+	pid := cmd.Process.Pid
+	_ = cmd.Process.Release()
+	if err := os.WriteFile(pidFile(name), []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil { // #nosec G306 -- read by the VM user
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+		return 0, err
+	}
+	return pid, nil
+}
+
+// deleteEnv deletes an environment. Killing its processes is best effort; a
+// failure is returned as a warning.
+func deleteEnv(req *helper.DeleteEnvRequest) (*helper.DeleteEnvResponse, error) {
+	u, err := lookupEnvUser(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if req.Workspace != "" {
+		if err := helper.CheckWorkspace(req.Workspace); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &helper.DeleteEnvResponse{}
+	if u != nil {
+		// pkill exits with 1 when nothing matched
+		err := command("pkill", "-u", req.Name)
+		var exitErr *exec.ExitError
+		if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("failed to kill namespace processes: %v", err))
+		}
+	}
+	// The keeper runs as root, so pkill -u leaves it behind
+	if pid := readKeeper(req.Name); pid != 0 {
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+	}
+	if err := os.Remove(pidFile(req.Name)); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to stop namespace keeper: %w", err)
+	}
+	// The cgroup only exists while the VM is up and goes away once its
+	// processes have exited
+	_ = os.Remove(filepath.Join(helper.CgroupRoot, req.Name))
+
+	if u != nil {
+		if err := command("userdel", "-r", req.Name); err != nil {
+			return nil, err
+		}
+	}
+	for _, dir := range []string{req.Workspace, filepath.Join(helper.OverlayRoot, req.Name), filepath.Join(helper.EnvsDir, req.Name)} {
+		if dir == "" {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, fmt.Errorf("failed to remove %s: %w", dir, err)
+		}
+	}
+	return resp, nil
+}
+
+// deleteUser deletes an environment's user account and home directory only,
+// like the shell helper did
+func deleteUser(name string) error {
+	u, err := lookupEnvUser(name)
+	if err != nil || u == nil {
+		return err
+	}
+	return command("userdel", "-r", name)
+}
+
+// enterEnv replaces the helper with the session req asks for
+func enterEnv(req *helper.EnterEnvRequest, session string) error {
+	if err := req.Check(); err != nil {
+		return err
+	}
+	u, err := lookupEnvUser(req.Name)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return fmt.Errorf("user %s doesn't exist", req.Name)
+	}
+	pid := readKeeper(req.Name)
+	if pid == 0 {
+		return fmt.Errorf("%s has no namespace", req.Name)
+	}
+
+	var fileVars []string
+	if req.VarsFile != "" {
+		data, err := os.ReadFile(req.VarsFile)
+		if err != nil {
+			return fmt.Errorf("failed to read session variables: %w", err)
+		}
+		_ = os.Remove(req.VarsFile)
+		if fileVars, err = helper.ParseVarsFile(data); err != nil {
+			return err
+		}
+	}
+
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+	s, err := helper.EnterSession(req, pid, helper.Account{UID: uid, GID: gid, Home: u.HomeDir}, os.Environ(), fileVars, session)
+	if err != nil {
+		return err
+	}
+	path, err := exec.LookPath(s.Args[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, s.Args, s.Env) // #nosec G204 -- the request is checked
+}
+
+// command runs a program. Its output is only reported with a failure, so
+// standard output is left for the reply.
+func command(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if out := strings.TrimSpace(string(output)); out != "" {
+			return fmt.Errorf("%s failed: %w (output: %s)", name, err, out)
+		}
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return nil
+}
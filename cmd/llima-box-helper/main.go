@@ -0,0 +1,132 @@
+//go:build linux
+
+// Package main provides llima-box-helper, the program llima-box installs in
+// the VM at /usr/local/sbin/llima-box-helper to create, delete, and enter
+// environments. It runs as root through sudo, only acts on environment
+// accounts (never system accounts or the calling user), and logs every call
+// to syslog (journalctl -t llima-box-helper). See pkg/helper for the
+// protocol.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/syslog"
+	"os"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/helper"
+)
+
+// errUsage marks errors in the command line rather than the operation
+var errUsage = errors.New("usage: llima-box-helper version | create-env JSON | delete-env JSON | enter-env [--session ID] JSON | create-user NAME SHELL | delete-user NAME")
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "llima-box-helper: %v\n", err)
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// run performs the operation named by args[0]
+func run(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	op, args := args[0], args[1:]
+	if op == helper.OpVersion {
+		return reply(helper.Version{Protocol: helper.Protocol})
+	}
+
+	logCall(op, args)
+	switch op {
+	case helper.OpCreateEnv:
+		var req helper.CreateEnvRequest
+		if err := decode(args, &req); err != nil {
+			return err
+		}
+		resp, err := createEnv(&req)
+		if err != nil {
+			return err
+		}
+		return reply(resp)
+
+	case helper.OpDeleteEnv:
+		var req helper.DeleteEnvRequest
+		if err := decode(args, &req); err != nil {
+			return err
+		}
+		resp, err := deleteEnv(&req)
+		if err != nil {
+			return err
+		}
+		return reply(resp)
+
+	case helper.OpEnterEnv:
+		session := ""
+		if len(args) > 0 && args[0] == "--session" {
+			if len(args) < 2 {
+				return errUsage
+			}
+			session, args = args[1], args[2:]
+		}
+		var req helper.EnterEnvRequest
+		if err := decode(args, &req); err != nil {
+			return err
+		}
+		return enterEnv(&req, session)
+
+	case helper.OpCreateUser:
+		if len(args) != 2 {
+			return errUsage
+		}
+		_, err := createEnv(&helper.CreateEnvRequest{Name: args[0], Shell: args[1]})
+		return err
+
+	case helper.OpDeleteUser:
+		if len(args) != 1 {
+			return errUsage
+		}
+		return deleteUser(args[0])
+
+	default:
+		return fmt.Errorf("unknown operation %q: %w", op, errUsage)
+	}
+}
+
+// decode reads the JSON request that is the only argument left in args
+func decode(args []string, req any) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	dec := json.NewDecoder(strings.NewReader(args[0]))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	return nil
+}
+
+// reply writes resp to standard output
+func reply(resp any) error {
+	return json.NewEncoder(os.Stdout).Encode(resp)
+}
+
+// logCall records the operation and the user calling it. Requests carry no
+// secrets: session variables are passed in files.
+func logCall(op string, args []string) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, "llima-box-helper")
+	if err != nil {
+		return
+	}
+	defer func() { _ = w.Close() }()
+	caller := os.Getenv("SUDO_USER")
+	if caller == "" {
+		caller = "root"
+	}
+	_ = w.Info(strings.TrimSpace(caller + ": " + op + " " + strings.Join(args, " ")))
+}
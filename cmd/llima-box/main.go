@@ -3,10 +3,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/middlendian/llima-box/internal/cli"
+	"github.com/middlendian/llima-box/pkg/cli"
 	"github.com/spf13/cobra"
 )
 
@@ -22,19 +26,111 @@ Commands:
   list        List all environments
   delete      Delete an environment
   delete-all  Delete all environments
+  share       Share a directory with another environment
+  maintenance Manage scheduled maintenance tasks inside the VM
+  clip        Copy standard input to the host clipboard
+  dashboard   Show live VM and environment activity
+  export      Export an environment as a Dockerfile, devcontainer, or archive
+  import      Restore an environment from an archive
+  watch       Re-run a command in the environment when project files change
+  cp          Copy files between the host and an environment
+  health      Check the VM and environments for monitoring
+  run         Run a command template from the project configuration
+  fix-terminal Restore the terminal after a session ended abnormally
+  forward     Forward ports between an environment and the host
+  backup      Back up a project directory before handing it to an agent
+  restore     Restore a project directory from a backup
+  exec        Run a command in an existing environment, for scripts
+  status      Show the VM's state, resource usage, and environments
+  stop        Stop an environment without deleting it
+  resume      Restart an environment stopped with stop
+  hosts       Show or install the hostnames of environments
+  daemon      Manage the host agent that stops the VM before the host sleeps
+  doctor      Diagnose problems with Lima, the VM, and SSH
+  gc          Delete orphaned environments
+  quarantine  Freeze an environment for investigation
+  history     Show the commands run in an environment
+  diff        List the files an overlay environment changed
+  discard     Throw away the changes of an overlay environment
+  apply       Make the environments match a manifest
+
+Use --output json for results and messages in JSON, for tools.
+Use --instance to work with a separate VM, such as one per client.
+Use --trust-new-hostkey once after recreating the VM outside llima-box.
 
 Use "llima-box <command> --help" for more information about a command.`,
 }
 
 func init() {
-	rootCmd.AddCommand(cli.NewShellCommand())
-	rootCmd.AddCommand(cli.NewListCommand())
-	rootCmd.AddCommand(cli.NewDeleteCommand())
-	rootCmd.AddCommand(cli.NewDeleteAllCommand())
+	// The commands run with llima-box's own logger, configuration, and VM
+	var deps cli.Deps
+
+	cli.AddOutputFlag(rootCmd)
+	cli.AddInstanceFlag(rootCmd)
+	cli.AddTrustHostKeyFlag(rootCmd)
+
+	rootCmd.AddCommand(cli.NewShellCommand(deps))
+	rootCmd.AddCommand(cli.NewListCommand(deps))
+	rootCmd.AddCommand(cli.NewDeleteCommand(deps))
+	rootCmd.AddCommand(cli.NewDeleteAllCommand(deps))
+	rootCmd.AddCommand(cli.NewShareCommand(deps))
+	rootCmd.AddCommand(cli.NewMaintenanceCommand(deps))
+	rootCmd.AddCommand(cli.NewClipCommand(deps))
+	rootCmd.AddCommand(cli.NewDashboardCommand(deps))
+	rootCmd.AddCommand(cli.NewExportCommand(deps))
+	rootCmd.AddCommand(cli.NewImportCommand(deps))
+	rootCmd.AddCommand(cli.NewWatchCommand(deps))
+	rootCmd.AddCommand(cli.NewCpCommand(deps))
+	rootCmd.AddCommand(cli.NewHealthCommand(deps))
+	rootCmd.AddCommand(cli.NewRunCommand(deps))
+	rootCmd.AddCommand(cli.NewFixTerminalCommand(deps))
+	rootCmd.AddCommand(cli.NewForwardCommand(deps))
+	rootCmd.AddCommand(cli.NewBackupCommand(deps))
+	rootCmd.AddCommand(cli.NewRestoreCommand(deps))
+	rootCmd.AddCommand(cli.NewExecCommand(deps))
+	rootCmd.AddCommand(cli.NewStatusCommand(deps))
+	rootCmd.AddCommand(cli.NewStopCommand(deps))
+	rootCmd.AddCommand(cli.NewResumeCommand(deps))
+	rootCmd.AddCommand(cli.NewHostsCommand(deps))
+	rootCmd.AddCommand(cli.NewDaemonCommand(deps))
+	rootCmd.AddCommand(cli.NewVMCommand(deps))
+	rootCmd.AddCommand(cli.NewDoctorCommand(deps))
+	rootCmd.AddCommand(cli.NewGCCommand(deps))
+	rootCmd.AddCommand(cli.NewQuarantineCommand(deps))
+	rootCmd.AddCommand(cli.NewHistoryCommand(deps))
+	rootCmd.AddCommand(cli.NewAuditCommand(deps))
+	rootCmd.AddCommand(cli.NewTimelineCommand(deps))
+	rootCmd.AddCommand(cli.NewDiffCommand(deps))
+	rootCmd.AddCommand(cli.NewDiscardCommand(deps))
+	rootCmd.AddCommand(cli.NewApplyCommand(deps))
+	rootCmd.AddCommand(cli.NewInventoryCommand(deps))
+	rootCmd.AddCommand(cli.NewCheckpointCommand(deps))
+	rootCmd.AddCommand(cli.NewRestoreProcessesCommand(deps))
 }
 
+// exitInterrupted is the exit status after Ctrl-C, as for shells
+const exitInterrupted = 130
+
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	// Ctrl-C, SIGTERM, and a closed terminal cancel the command's context so
+	// it can hang up sessions, restore the terminal, and clean up. Restoring
+	// the default handlers afterwards lets a second Ctrl-C exit immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		os.Exit(exitInterrupted)
+	}
+	var exitErr *cli.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
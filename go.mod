@@ -3,13 +3,16 @@ module github.com/middlendian/llima-box
 go 1.24.7
 
 require (
+	github.com/pkg/sftp v1.13.9
 	github.com/spf13/cobra v1.10.2
+	github.com/spf13/pflag v1.0.9
 	golang.org/x/crypto v0.40.0
+	golang.org/x/sys v0.34.0
 	golang.org/x/term v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.9 // indirect
-	golang.org/x/sys v0.34.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 )
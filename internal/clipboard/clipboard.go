@@ -0,0 +1,52 @@
+// Package clipboard writes to the host system clipboard.
+package clipboard
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// command returns the clipboard command for the current platform
+func command() ([]string, error) {
+	var candidates [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = [][]string{{"pbcopy"}}
+	case "windows":
+		candidates = [][]string{{"clip.exe"}}
+	default:
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			candidates = append(candidates, []string{"wl-copy"})
+		}
+		candidates = append(candidates,
+			[]string{"xclip", "-selection", "clipboard"},
+			[]string{"xsel", "--clipboard", "--input"},
+		)
+	}
+
+	for _, c := range candidates {
+		if _, err := exec.LookPath(c[0]); err == nil {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("no clipboard command found (tried %v)", candidates)
+}
+
+// Write copies data to the host clipboard
+func Write(data []byte) error {
+	args, err := command()
+	if err != nil {
+		return err
+	}
+
+	// #nosec G204 -- clipboard commands are fixed per platform
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w (output: %s)", args[0], err, output)
+	}
+	return nil
+}
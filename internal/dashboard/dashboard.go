@@ -0,0 +1,185 @@
+// Package dashboard renders the live activity view of the llima-box dashboard
+// command.
+package dashboard
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/maintenance"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+const (
+	// maxJobs is the number of running jobs shown
+	maxJobs = 10
+
+	// maxEvents is the number of recent events shown
+	maxEvents = 8
+)
+
+// Snapshot is the state shown by one dashboard refresh
+type Snapshot struct {
+	// Taken is when the snapshot was collected
+	Taken time.Time
+
+	// VM is the VM instance, or nil if it hasn't been created
+	VM *vm.Instance
+
+	// Environments lists the environments in the VM
+	Environments []*env.Environment
+
+	// Usage holds resource usage keyed by environment name
+	Usage map[string]*env.ResourceUsage
+
+	// Events holds recent maintenance log lines
+	Events []maintenance.Event
+
+	// Errors holds problems encountered while collecting the snapshot
+	Errors []string
+}
+
+// job is a process shown in the running jobs section
+type job struct {
+	environment string
+	process     env.Process
+}
+
+// Render writes the snapshot as a screen of at most width columns
+func Render(w io.Writer, s *Snapshot, width int) {
+	if width <= 0 {
+		width = 80
+	}
+
+	_, _ = fmt.Fprintf(w, "llima-box dashboard  %s\n\n", s.Taken.Format("15:04:05"))
+
+	renderVM(w, s.VM)
+	if s.VM != nil && s.VM.Status == "Running" {
+		renderEnvironments(w, s)
+		renderJobs(w, s, width)
+		renderEvents(w, s.Events, width)
+	}
+
+	for _, e := range s.Errors {
+		_, _ = fmt.Fprintf(w, "\nerror: %s\n", truncate(sanitize.Line(e), width-7))
+	}
+}
+
+func renderVM(w io.Writer, inst *vm.Instance) {
+	if inst == nil {
+		_, _ = fmt.Fprintln(w, "VM: not created (use 'llima-box shell' to create it)")
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "VM: %s  %s  %d CPUs  %s memory  %s disk\n",
+		inst.Name, inst.Status, inst.CPUs, FormatBytes(inst.Memory), FormatBytes(inst.Disk))
+}
+
+func renderEnvironments(w io.Writer, s *Snapshot) {
+	_, _ = fmt.Fprintf(w, "\nENVIRONMENTS (%d)\n", len(s.Environments))
+	if len(s.Environments) == 0 {
+		_, _ = fmt.Fprintln(w, "  none")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "  NAME\tSTATUS\tCPU%\tMEMORY\tPROCS\tPROJECT PATH")
+	for _, e := range s.Environments {
+		var cpu float64
+		var mem int64
+		var procs int
+		if u := s.Usage[e.Name]; u != nil {
+			cpu, mem, procs = u.CPUPercent, u.MemoryKB*1024, len(u.Processes)
+		}
+		projectPath := e.ProjectPath
+		if projectPath == "" {
+			projectPath = "(unknown)"
+		}
+		_, _ = fmt.Fprintf(tw, "  %s\t%s\t%.1f\t%s\t%d\t%s\n", sanitize.Line(e.Name), e.Status, cpu, FormatBytes(mem), procs, sanitize.Line(projectPath))
+	}
+	_ = tw.Flush()
+}
+
+func renderJobs(w io.Writer, s *Snapshot, width int) {
+	var jobs []job
+	for name, u := range s.Usage {
+		for _, p := range u.Processes {
+			jobs = append(jobs, job{environment: name, process: p})
+		}
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		if jobs[i].process.CPUPercent != jobs[j].process.CPUPercent {
+			return jobs[i].process.CPUPercent > jobs[j].process.CPUPercent
+		}
+		return jobs[i].process.PID < jobs[j].process.PID
+	})
+
+	_, _ = fmt.Fprintf(w, "\nRUNNING JOBS (%d)\n", len(jobs))
+	if len(jobs) == 0 {
+		_, _ = fmt.Fprintln(w, "  none")
+		return
+	}
+	if len(jobs) > maxJobs {
+		jobs = jobs[:maxJobs]
+	}
+
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "  ENVIRONMENT\tPID\tCPU%\tMEMORY\tCOMMAND")
+	for _, j := range jobs {
+		_, _ = fmt.Fprintf(tw, "  %s\t%d\t%.1f\t%s\t%s\n",
+			sanitize.Line(j.environment), j.process.PID, j.process.CPUPercent, FormatBytes(j.process.MemoryKB*1024), sanitize.Line(j.process.Command))
+	}
+	_ = tw.Flush()
+
+	// Commands can be long; keep each row on one line
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n") {
+		_, _ = fmt.Fprintln(w, truncate(line, width))
+	}
+}
+
+func renderEvents(w io.Writer, events []maintenance.Event, width int) {
+	_, _ = fmt.Fprintln(w, "\nRECENT EVENTS")
+	if len(events) == 0 {
+		_, _ = fmt.Fprintln(w, "  none")
+		return
+	}
+	if len(events) > maxEvents {
+		events = events[len(events)-maxEvents:]
+	}
+	for _, e := range events {
+		_, _ = fmt.Fprintln(w, truncate(fmt.Sprintf("  [%s] %s", sanitize.Line(e.Task), sanitize.Line(e.Message)), width))
+	}
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if n <= 0 || len(r) <= n {
+		return s
+	}
+	if n <= 3 {
+		return string(r[:n])
+	}
+	return string(r[:n-3]) + "..."
+}
+
+// FormatBytes formats a byte count using binary units
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,129 @@
+package dashboard
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/maintenance"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+func TestRender(t *testing.T) {
+	s := &Snapshot{
+		Taken: time.Date(2025, 1, 1, 12, 30, 0, 0, time.UTC),
+		VM:    &vm.Instance{Name: "llima-box", Status: "Running", CPUs: 4, Memory: 4 << 30, Disk: 100 << 30},
+		Environments: []*env.Environment{
+			{Name: "app-a1b2", Status: env.StatusRunning, ProjectPath: "/Users/me/app"},
+			{Name: "old-c3d4", Status: env.StatusNeedsRepair},
+		},
+		Usage: map[string]*env.ResourceUsage{
+			"app-a1b2": {
+				CPUPercent: 98.5,
+				MemoryKB:   12288,
+				Processes: []env.Process{
+					{PID: 1002, CPUPercent: 97, MemoryKB: 10240, Command: "go test ./... " + strings.Repeat("x", 100)},
+					{PID: 1001, CPUPercent: 1.5, MemoryKB: 2048, Command: "-bash"},
+				},
+			},
+		},
+		Events: []maintenance.Event{{Task: "apt-clean", Message: "done"}},
+	}
+
+	var buf bytes.Buffer
+	Render(&buf, s, 80)
+	out := buf.String()
+
+	for _, want := range []string{
+		"llima-box dashboard  12:30:00",
+		"VM: llima-box  Running  4 CPUs  4.0GiB memory  100.0GiB disk",
+		"ENVIRONMENTS (2)",
+		"/Users/me/app",
+		"needs-repair",
+		"(unknown)",
+		"RUNNING JOBS (2)",
+		"[apt-clean] done",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Render() output missing %q:\n%s", want, out)
+		}
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		if len([]rune(line)) > 80 {
+			t.Errorf("line exceeds width: %q", line)
+		}
+	}
+
+	if strings.Index(out, "1002") > strings.Index(out, "1001") {
+		t.Error("expected busiest job first")
+	}
+}
+
+func TestRender_EscapesRemoteText(t *testing.T) {
+	s := &Snapshot{
+		VM: &vm.Instance{Name: "llima-box", Status: "Running"},
+		Environments: []*env.Environment{
+			{Name: "app-a1b2", Status: env.StatusRunning, ProjectPath: "/Users/me/\x1b[2J\x1b[Happ"},
+		},
+		Usage: map[string]*env.ResourceUsage{
+			"app-a1b2": {Processes: []env.Process{{PID: 1001, Command: "sleep 1\rfake"}}},
+		},
+		Events: []maintenance.Event{{Task: "apt-clean", Message: "\x1b]0;owned\a"}},
+	}
+
+	var buf bytes.Buffer
+	Render(&buf, s, 80)
+	out := buf.String()
+
+	if strings.ContainsAny(out, "\x1b\r\a") {
+		t.Errorf("Render() output contains control characters:\n%q", out)
+	}
+	if !strings.Contains(out, `/Users/me/\x1b[2J\x1b[Happ`) {
+		t.Errorf("Render() output missing the escaped project path:\n%s", out)
+	}
+}
+
+func TestRender_VMNotRunning(t *testing.T) {
+	tests := []struct {
+		name string
+		vm   *vm.Instance
+		want string
+	}{
+		{name: "not created", vm: nil, want: "VM: not created"},
+		{name: "stopped", vm: &vm.Instance{Name: "llima-box", Status: "Stopped"}, want: "VM: llima-box  Stopped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			Render(&buf, &Snapshot{VM: tt.vm}, 80)
+			out := buf.String()
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("Render() output missing %q:\n%s", tt.want, out)
+			}
+			if strings.Contains(out, "ENVIRONMENTS") {
+				t.Error("Render() shows environments for a VM that isn't running")
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{n: 512, want: "512B"},
+		{n: 2048, want: "2.0KiB"},
+		{n: 3 << 30, want: "3.0GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatBytes(tt.n); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package hostcmd
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// shellCommand returns the command running command through sh
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command) // #nosec G204 -- the command comes from the user's own configuration
+}
+
+// killGroupOnCancel runs cmd in its own process group, so giving up on the
+// command also stops whatever it started, such as a hook waiting for a
+// decision
+func killGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
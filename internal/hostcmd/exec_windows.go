@@ -0,0 +1,18 @@
+//go:build windows
+
+package hostcmd
+
+import (
+	"context"
+	"os/exec"
+)
+
+// shellCommand returns the command running command through cmd.exe
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd.exe", "/C", command) // #nosec G204 -- the command comes from the user's own configuration
+}
+
+// killGroupOnCancel leaves cmd as it is: Windows has no process groups to
+// signal, so giving up on the command kills only the command itself, and
+// WaitDelay stops waiting for anything it started
+func killGroupOnCancel(*exec.Cmd) {}
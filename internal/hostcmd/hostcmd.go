@@ -0,0 +1,20 @@
+// Package hostcmd runs commands from the user's configuration on the host,
+// such as the approval and lifecycle hooks.
+package hostcmd
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// Command returns the command running command through sh (cmd.exe on
+// Windows). Cancelling ctx kills the command along with whatever it started,
+// where the platform allows, and Wait gives up on output still held open by
+// leftover processes a second later.
+func Command(ctx context.Context, command string) *exec.Cmd {
+	cmd := shellCommand(ctx, command)
+	killGroupOnCancel(cmd)
+	cmd.WaitDelay = time.Second
+	return cmd
+}
@@ -0,0 +1,55 @@
+// Package linewriter turns streamed command output into one message per
+// line, for progress callbacks that report messages rather than bytes, such
+// as a logger following --output json.
+package linewriter
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Writer calls a function with each line written to it, without its line
+// ending. Empty lines are dropped. It's safe for concurrent use, so one
+// Writer can take both a command's stdout and stderr.
+type Writer struct {
+	line func(string)
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// New returns a Writer calling line for each line
+func New(line func(string)) *Writer {
+	return &Writer{line: line}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush reports output left without a final newline
+func (w *Writer) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *Writer) emit(line []byte) {
+	if line := string(bytes.TrimRight(line, "\r")); line != "" {
+		w.line(line)
+	}
+}
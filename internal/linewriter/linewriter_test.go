@@ -0,0 +1,22 @@
+package linewriter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var got []string
+	w := New(func(line string) { got = append(got, line) })
+	for _, chunk := range []string{"Downloading ", "image\r\n\nBooting", " the VM"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Flush()
+
+	want := []string{"Downloading image", "Booting the VM"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,69 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// JSONLogger writes each message as a JSON object on its own line, for
+// tools driving llima-box with --output json:
+//
+//	{"time":"2025-01-02T15:04:05Z","level":"info","message":"Creating environment app-a1b2"}
+//
+// Control characters in messages are escaped by the JSON encoding.
+type JSONLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// jsonEvent is one line written by JSONLogger
+type jsonEvent struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// NewJSON creates a JSONLogger writing to w.
+func NewJSON(w io.Writer) *JSONLogger {
+	return &JSONLogger{enc: json.NewEncoder(w)}
+}
+
+// Info writes an informational message.
+func (l *JSONLogger) Info(format string, args ...interface{}) {
+	l.write("info", format, args...)
+}
+
+// Success writes a success message.
+func (l *JSONLogger) Success(format string, args ...interface{}) {
+	l.write("success", format, args...)
+}
+
+// Warning writes a warning.
+func (l *JSONLogger) Warning(format string, args ...interface{}) {
+	l.write("warning", format, args...)
+}
+
+// Error writes an error message.
+func (l *JSONLogger) Error(format string, args ...interface{}) {
+	l.write("error", format, args...)
+}
+
+// Debug writes a debug message.
+func (l *JSONLogger) Debug(format string, args ...interface{}) {
+	l.write("debug", format, args...)
+}
+
+// Plain writes a message without a level of its own, such as a prompt.
+func (l *JSONLogger) Plain(format string, args ...interface{}) {
+	l.write("plain", format, args...)
+}
+
+// write encodes one message
+func (l *JSONLogger) write(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_ = l.enc.Encode(jsonEvent{Time: time.Now().UTC(), Level: level, Message: fmt.Sprintf(format, args...)})
+}
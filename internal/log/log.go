@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+
+	"github.com/middlendian/llima-box/internal/sanitize"
 )
 
 // ANSI color codes
@@ -22,54 +24,63 @@ const (
 type Logger struct {
 	output io.Writer
 	colors bool
+	theme  Theme
 }
 
 // New creates a new Logger that writes to stderr.
 func New() *Logger {
+	return NewWithTheme(DefaultTheme)
+}
+
+// NewWithTheme creates a new Logger that writes to stderr with theme.
+func NewWithTheme(theme Theme) *Logger {
 	return &Logger{
 		output: os.Stderr,
-		colors: isTerminal(os.Stderr),
+		colors: theme.Colors && isTerminal(os.Stderr),
+		theme:  theme,
 	}
 }
 
 // Info prints an informational message to stderr.
 func (l *Logger) Info(format string, args ...interface{}) {
-	l.print(colorCyan, "INFO", format, args...)
+	l.print(colorCyan, l.theme.Info, format, args...)
 }
 
 // Success prints a success message to stderr.
 func (l *Logger) Success(format string, args ...interface{}) {
-	l.print(colorGreen, "SUCCESS", format, args...)
+	l.print(colorGreen, l.theme.Success, format, args...)
 }
 
 // Warning prints a warning message to stderr.
 func (l *Logger) Warning(format string, args ...interface{}) {
-	l.print(colorYellow, "WARNING", format, args...)
+	l.print(colorYellow, l.theme.Warning, format, args...)
 }
 
 // Error prints an error message to stderr.
 func (l *Logger) Error(format string, args ...interface{}) {
-	l.print(colorRed, "ERROR", format, args...)
+	l.print(colorRed, l.theme.Error, format, args...)
 }
 
 // Debug prints a debug message to stderr (gray color).
 func (l *Logger) Debug(format string, args ...interface{}) {
-	l.print(colorGray, "DEBUG", format, args...)
+	l.print(colorGray, l.theme.Debug, format, args...)
 }
 
 // Plain prints a plain message to stderr without a prefix or color.
 func (l *Logger) Plain(format string, args ...interface{}) {
-	msg := fmt.Sprintf(format, args...)
+	msg := sanitize.Text(fmt.Sprintf(format, args...))
 	_, _ = fmt.Fprintln(l.output, msg)
 }
 
-// print formats and prints a colored log message.
-func (l *Logger) print(color, level, format string, args ...interface{}) {
-	msg := fmt.Sprintf(format, args...)
+// print formats and prints a colored log message. Messages often include
+// names and paths read from the VM, so control characters in them are
+// escaped.
+func (l *Logger) print(color, marker, format string, args ...interface{}) {
+	msg := sanitize.Text(fmt.Sprintf(format, args...))
 	if l.colors {
-		_, _ = fmt.Fprintf(l.output, "%s%s%s: %s\n", color, level, colorReset, msg)
+		_, _ = fmt.Fprintf(l.output, "%s%s%s%s%s\n", color, marker, colorReset, l.theme.Separator, msg)
 	} else {
-		_, _ = fmt.Fprintf(l.output, "%s: %s\n", level, msg)
+		_, _ = fmt.Fprintf(l.output, "%s%s%s\n", marker, l.theme.Separator, msg)
 	}
 }
 
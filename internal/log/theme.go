@@ -0,0 +1,89 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Theme is how a Logger marks the level of each message
+type Theme struct {
+	// Colors colors the markers, on terminals only
+	Colors bool
+
+	// The markers written before messages of each level
+	Info, Success, Warning, Error, Debug string
+
+	// Separator is written between a marker and the message
+	Separator string
+}
+
+// Built-in themes, by the name they're selected with in the host
+// configuration
+var (
+	// DefaultTheme marks messages with colored level names, such as
+	// "INFO: "
+	DefaultTheme = Theme{
+		Colors:  true,
+		Info:    "INFO",
+		Success: "SUCCESS",
+		Warning: "WARNING",
+		Error:   "ERROR",
+		Debug:   "DEBUG",
+
+		Separator: ": ",
+	}
+
+	// EmojiTheme marks messages with severity icons
+	EmojiTheme = Theme{
+		Colors:  true,
+		Info:    "ℹ️ ",
+		Success: "✅",
+		Warning: "⚠️ ",
+		Error:   "❌",
+		Debug:   "🔍",
+
+		Separator: " ",
+	}
+
+	// PlainTheme is ASCII without colors: level words a screen reader reads
+	// naturally, and nothing a terminal or braille display has to interpret
+	PlainTheme = Theme{
+		Info:    "Info",
+		Success: "Success",
+		Warning: "Warning",
+		Error:   "Error",
+		Debug:   "Debug",
+
+		Separator: ": ",
+	}
+)
+
+// themes are the built-in themes by name
+var themes = map[string]Theme{
+	"default": DefaultTheme,
+	"emoji":   EmojiTheme,
+	"plain":   PlainTheme,
+}
+
+// ThemeNames returns the names of the built-in themes, sorted
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseTheme returns the built-in theme called name; "" is the default
+func ParseTheme(name string) (Theme, error) {
+	if name == "" {
+		return DefaultTheme, nil
+	}
+	theme, ok := themes[name]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme %q (use %s)", name, strings.Join(ThemeNames(), ", "))
+	}
+	return theme, nil
+}
@@ -0,0 +1,96 @@
+// Package notify sends host notifications when environment commands finish.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// webhookTimeout bounds how long a webhook delivery may take
+const webhookTimeout = 10 * time.Second
+
+// Event describes a finished command
+type Event struct {
+	Environment string        `json:"environment"`
+	Command     string        `json:"command"`
+	ExitCode    int           `json:"exitCode"`
+	Duration    time.Duration `json:"-"`
+	Seconds     float64       `json:"durationSeconds"`
+}
+
+// Title returns the notification title
+func (e Event) Title() string {
+	if e.ExitCode == 0 {
+		return "llima-box: command finished"
+	}
+	return "llima-box: command failed"
+}
+
+// Message returns the notification body
+func (e Event) Message() string {
+	return fmt.Sprintf("%s in %s exited with code %d after %s",
+		e.Command, e.Environment, e.ExitCode, e.Duration.Round(time.Second))
+}
+
+// Desktop shows a desktop notification for the event
+func Desktop(e Event) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s",
+			appleScriptString(e.Message()), appleScriptString(e.Title()))
+		cmd = exec.Command("osascript", "-e", script)
+	case "linux":
+		cmd = exec.Command("notify-send", e.Title(), e.Message())
+	default:
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to show notification: %w (output: %s)", err, output)
+	}
+	return nil
+}
+
+// Webhook posts the event as JSON to url
+func Webhook(ctx context.Context, url string, e Event) error {
+	e.Seconds = e.Duration.Seconds()
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver webhook: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// appleScriptString quotes s as an AppleScript string literal
+func appleScriptString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
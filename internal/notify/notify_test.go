@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected content type %s", r.Header.Get("Content-Type"))
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	e := Event{Environment: "my-project-a1b2", Command: "make test", ExitCode: 2, Duration: 90 * time.Second}
+	if err := Webhook(context.Background(), server.URL, e); err != nil {
+		t.Fatalf("Webhook failed: %v", err)
+	}
+
+	if got["environment"] != "my-project-a1b2" || got["command"] != "make test" {
+		t.Errorf("unexpected payload: %v", got)
+	}
+	if got["exitCode"] != float64(2) || got["durationSeconds"] != float64(90) {
+		t.Errorf("unexpected payload: %v", got)
+	}
+}
+
+func TestWebhook_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := Webhook(context.Background(), server.URL, Event{}); err == nil {
+		t.Error("expected error for 500 response")
+	}
+}
+
+func TestAppleScriptString(t *testing.T) {
+	if got := appleScriptString(`say "hi" \o/`); got != `"say \"hi\" \\o/"` {
+		t.Errorf("unexpected quoting: %s", got)
+	}
+}
+
+func TestEventMessage(t *testing.T) {
+	e := Event{Environment: "app-a1b2", Command: "make", ExitCode: 1, Duration: 61500 * time.Millisecond}
+	if got := e.Message(); got != "make in app-a1b2 exited with code 1 after 1m2s" {
+		t.Errorf("unexpected message: %s", got)
+	}
+	if e.Title() != "llima-box: command failed" {
+		t.Errorf("unexpected title: %s", e.Title())
+	}
+}
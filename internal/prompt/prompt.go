@@ -0,0 +1,75 @@
+// Package prompt asks the user to confirm destructive operations.
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNoAnswer is returned when the input ends before a question is
+// answered, as it does when nothing is piped to a script's standard input
+var ErrNoAnswer = errors.New("no answer to the confirmation prompt")
+
+// Prompter asks questions, writing them with a print function such as a
+// logger's and reading the answers a line at a time
+type Prompter struct {
+	in    *bufio.Reader
+	print func(format string, args ...interface{})
+}
+
+// New returns a prompter reading answers from in and writing questions
+// with print
+func New(in io.Reader, print func(format string, args ...interface{})) *Prompter {
+	return &Prompter{in: bufio.NewReader(in), print: print}
+}
+
+// Confirm asks a yes or no question. An empty answer is def; anything
+// other than y or yes is no.
+func (p *Prompter) Confirm(question string, def bool) (bool, error) {
+	choices := "(y/N)"
+	if def {
+		choices = "(Y/n)"
+	}
+	p.print("%s %s: ", question, choices)
+
+	answer, err := p.readAnswer()
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "":
+		return def, nil
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// ConfirmTyped asks the user to confirm by typing want, such as the name of
+// what's about to be deleted. Only want, exactly, confirms.
+func (p *Prompter) ConfirmTyped(question, want string) (bool, error) {
+	p.print("%s Type %q to confirm: ", question, want)
+
+	answer, err := p.readAnswer()
+	if err != nil {
+		return false, err
+	}
+	return answer == want, nil
+}
+
+// readAnswer reads a line of input without surrounding space. A last line
+// without a newline still counts as an answer.
+func (p *Prompter) readAnswer() (string, error) {
+	line, err := p.in.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		if errors.Is(err, io.EOF) {
+			return "", ErrNoAnswer
+		}
+		return "", fmt.Errorf("failed to read confirmation: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,89 @@
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		def   bool
+		want  bool
+	}{
+		{name: "yes", input: "y\n", want: true},
+		{name: "yes in full", input: " YES \n", want: true},
+		{name: "no", input: "n\n", def: true, want: false},
+		{name: "other answer", input: "sure\n", want: false},
+		{name: "empty answer, default no", input: "\n", want: false},
+		{name: "empty answer, default yes", input: "\n", def: true, want: true},
+		{name: "no newline", input: "y", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			p := New(strings.NewReader(tt.input), func(format string, args ...interface{}) {
+				fmt.Fprintf(&out, format, args...)
+			})
+			got, err := p.Confirm("Continue?", tt.def)
+			if err != nil {
+				t.Fatalf("Confirm() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Confirm() = %v, want %v", got, tt.want)
+			}
+			wantPrompt := "Continue? (y/N): "
+			if tt.def {
+				wantPrompt = "Continue? (Y/n): "
+			}
+			if out.String() != wantPrompt {
+				t.Errorf("prompt = %q, want %q", out.String(), wantPrompt)
+			}
+		})
+	}
+}
+
+func TestConfirm_NoAnswer(t *testing.T) {
+	p := New(strings.NewReader(""), func(string, ...interface{}) {})
+	if _, err := p.Confirm("Continue?", true); !errors.Is(err, ErrNoAnswer) {
+		t.Errorf("Confirm() error = %v, want ErrNoAnswer", err)
+	}
+}
+
+func TestConfirmTyped(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{name: "exact", input: "llima-box\n", want: true},
+		{name: "surrounding space", input: "  llima-box \n", want: true},
+		{name: "yes isn't enough", input: "y\n", want: false},
+		{name: "different case", input: "LLIMA-BOX\n", want: false},
+		{name: "empty", input: "\n", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(strings.NewReader(tt.input), func(string, ...interface{}) {})
+			got, err := p.ConfirmTyped("Delete VM llima-box?", "llima-box")
+			if err != nil {
+				t.Fatalf("ConfirmTyped() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ConfirmTyped() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrompter_SharesInput(t *testing.T) {
+	p := New(strings.NewReader("y\nn\n"), func(string, ...interface{}) {})
+	first, _ := p.Confirm("First?", false)
+	second, _ := p.Confirm("Second?", false)
+	if !first || second {
+		t.Errorf("answers = %v, %v, want true, false", first, second)
+	}
+}
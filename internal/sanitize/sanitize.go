@@ -0,0 +1,84 @@
+// Package sanitize makes strings from untrusted sources safe to print to a
+// terminal.
+//
+// Environment names, project paths, and process commands are partly read
+// from the VM, where anything running as root can change them, and project
+// directories can be given any name on the host. Printed as they are,
+// control characters and ANSI escape sequences in them could move the
+// cursor, rewrite earlier output, or change the terminal's title, so a
+// malicious directory name could spoof what llima-box reports. The
+// functions here escape such characters in Go's backslash notation instead,
+// so they show up without taking effect.
+package sanitize
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Line escapes s for display on a single line, such as a table cell:
+// control characters (including newlines and tabs), bidirectional text
+// controls, and invalid UTF-8 are escaped.
+func Line(s string) string {
+	return escape(s, false)
+}
+
+// Text escapes s like Line but keeps newlines and tabs, for messages that
+// may span lines
+func Text(s string) string {
+	return escape(s, true)
+}
+
+// escape returns s with unsafe characters escaped. Strings without any are
+// returned unchanged.
+func escape(s string, multiline bool) string {
+	if isSafe(s, multiline) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		case safe(r, multiline):
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x100:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		default:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// isSafe reports whether s can be printed as it is
+func isSafe(s string, multiline bool) bool {
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if (r == utf8.RuneError && size <= 1) || !safe(r, multiline) {
+			return false
+		}
+		i += size
+	}
+	return true
+}
+
+// safe reports whether r can be printed as it is. Bidirectional controls
+// are escaped because they can reorder the text shown around them.
+func safe(r rune, multiline bool) bool {
+	if multiline && (r == '\n' || r == '\t') {
+		return true
+	}
+	return !unicode.IsControl(r) && !unicode.Is(unicode.Bidi_Control, r)
+}
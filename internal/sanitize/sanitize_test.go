@@ -0,0 +1,51 @@
+package sanitize
+
+import "testing"
+
+func TestLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "plain", input: "/Users/me/app", want: "/Users/me/app"},
+		{name: "unicode", input: "/Users/me/café 日本", want: "/Users/me/café 日本"},
+		{name: "color escape", input: "app\x1b[31mred", want: `app\x1b[31mred`},
+		{name: "title escape", input: "\x1b]0;owned\a", want: `\x1b]0;owned\x07`},
+		{name: "cursor movement", input: "app\x1b[2K\rfake", want: `app\x1b[2K\rfake`},
+		{name: "newline and tab", input: "a\nb\tc", want: `a\nb\tc`},
+		{name: "C1 control", input: "a\u009b31m", want: `a\x9b31m`},
+		{name: "delete", input: "a\x7f", want: `a\x7f`},
+		{name: "bidi override", input: "evil\u202egnp.exe", want: `evil\u202egnp.exe`},
+		{name: "invalid UTF-8", input: "a\xffb", want: `a\xffb`},
+		{name: "empty", input: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Line(tt.input); got != tt.want {
+				t.Errorf("Line(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "keeps newlines and tabs", input: "line 1\n\tline 2", want: "line 1\n\tline 2"},
+		{name: "escapes carriage return", input: "done\rfake", want: `done\rfake`},
+		{name: "escapes ANSI", input: "path \x1b[1Aup", want: `path \x1b[1Aup`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Text(tt.input); got != tt.want {
+				t.Errorf("Text(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+// Package shellquote quotes strings for the POSIX shells that run
+// llima-box's commands inside the VM.
+package shellquote
+
+import "strings"
+
+// Quote quotes s as a single shell word. Nothing in it is interpreted by
+// the shell.
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,24 @@
+package shellquote
+
+import "testing"
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "plain", want: "'plain'"},
+		{in: "", want: "''"},
+		{in: "a b", want: "'a b'"},
+		{in: "it's", want: `'it'\''s'`},
+		{in: "$(reboot); `id`", want: "'$(reboot); `id`'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := Quote(tt.in); got != tt.want {
+				t.Errorf("Quote(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Package agent implements the llima-box host agent, a background service
+// that stops the VM cleanly before the host sleeps or shuts down.
+//
+// A VM that is powered off with the host loses its running namespaces
+// without warning, and writes that were in flight, such as environment
+// metadata, may not reach its disk. The agent waits for environment
+// operations in progress to finish, flushes the VM's filesystems, and stops
+// it with limactl, so the next boot starts from a consistent state.
+//
+// The agent runs as a launchd agent on macOS and as a systemd user service
+// on Linux; Install writes and loads the service definition.
+package agent
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultTimeout bounds how long preparing for sleep or shutdown may take
+// when no timeout is set
+const DefaultTimeout = 60 * time.Second
+
+// Event is a change in the host's power state
+type Event int
+
+const (
+	// Sleep means the host is about to sleep
+	Sleep Event = iota
+
+	// Wake means the host resumed from sleep
+	Wake
+
+	// Shutdown means the host is about to shut down or the user is logging
+	// out
+	Shutdown
+)
+
+// String returns the event's name
+func (e Event) String() string {
+	switch e {
+	case Sleep:
+		return "sleep"
+	case Wake:
+		return "wake"
+	case Shutdown:
+		return "shutdown"
+	default:
+		return "unknown"
+	}
+}
+
+// Source reports host power events. Sources that can delay sleep and
+// shutdown, like logind's inhibitor locks, hold the host until Done is
+// called for the event.
+type Source interface {
+	// Events returns the channel events are delivered on. It's closed when
+	// the source stops.
+	Events() <-chan Event
+
+	// Done tells the source the agent is ready for e
+	Done(e Event)
+
+	// Close stops the source and releases what it holds
+	Close() error
+}
+
+// Agent prepares the VM for host sleep and shutdown
+type Agent struct {
+	// Prepare readies the VM for e, typically by stopping it
+	Prepare func(ctx context.Context, e Event) error
+
+	// Timeout bounds each Prepare call (default: DefaultTimeout)
+	Timeout time.Duration
+
+	// Logf reports what the agent does
+	Logf func(format string, args ...interface{})
+}
+
+// Run handles events from src until ctx ends. The service manager ends the
+// agent when the user logs out or the host shuts down, so the end of ctx is
+// handled as a shutdown. src may be nil where power events can't be
+// observed; the agent then only handles its own end.
+func (a *Agent) Run(ctx context.Context, src Source) error {
+	var events <-chan Event
+	if src != nil {
+		defer func() { _ = src.Close() }()
+		events = src.Events()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.prepare(context.WithoutCancel(ctx), Shutdown)
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if e == Wake {
+				a.logf("Host resumed")
+			} else {
+				a.prepare(ctx, e)
+			}
+			src.Done(e)
+		}
+	}
+}
+
+// prepare runs Prepare for e within the agent's timeout. Failures are
+// reported: the host goes down either way.
+func (a *Agent) prepare(ctx context.Context, e Event) {
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	a.logf("Preparing for host %s", e)
+	if err := a.Prepare(ctx, e); err != nil {
+		a.logf("Failed to prepare for host %s: %v", e, err)
+		return
+	}
+	a.logf("Ready for host %s", e)
+}
+
+func (a *Agent) logf(format string, args ...interface{}) {
+	if a.Logf != nil {
+		a.Logf(format, args...)
+	}
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSource delivers events from a channel and records Done calls
+type fakeSource struct {
+	events chan Event
+
+	mu   sync.Mutex
+	done []Event
+}
+
+func (f *fakeSource) Events() <-chan Event { return f.events }
+
+func (f *fakeSource) Done(e Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.done = append(f.done, e)
+}
+
+func (f *fakeSource) Close() error { return nil }
+
+func TestAgentRun(t *testing.T) {
+	src := &fakeSource{events: make(chan Event)}
+	var prepared []Event
+	a := &Agent{Prepare: func(ctx context.Context, e Event) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected Prepare to have a deadline")
+		}
+		if ctx.Err() != nil {
+			t.Errorf("expected a live context for %s, got %v", e, ctx.Err())
+		}
+		prepared = append(prepared, e)
+		if e == Sleep {
+			return errors.New("limactl failed")
+		}
+		return nil
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan error)
+	go func() { finished <- a.Run(ctx, src) }()
+
+	src.events <- Sleep
+	src.events <- Wake
+	// A closed source leaves the agent waiting for its own end
+	close(src.events)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if err := <-finished; err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	// A failed preparation doesn't hold the host, and the end of the agent is
+	// handled as a shutdown
+	if want := []Event{Sleep, Shutdown}; !reflect.DeepEqual(prepared, want) {
+		t.Errorf("prepared for %v, want %v", prepared, want)
+	}
+	if want := []Event{Sleep, Wake}; !reflect.DeepEqual(src.done, want) {
+		t.Errorf("Done called for %v, want %v", src.done, want)
+	}
+}
+
+func TestAgentRun_NoSource(t *testing.T) {
+	var prepared []Event
+	a := &Agent{Prepare: func(_ context.Context, e Event) error {
+		prepared = append(prepared, e)
+		return nil
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.Run(ctx, nil); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !reflect.DeepEqual(prepared, []Event{Shutdown}) {
+		t.Errorf("prepared for %v, want a shutdown", prepared)
+	}
+}
+
+func TestAgentPrepare_Timeout(t *testing.T) {
+	var err error
+	a := &Agent{
+		Timeout: 20 * time.Millisecond,
+		Prepare: func(ctx context.Context, _ Event) error {
+			<-ctx.Done()
+			err = ctx.Err()
+			return err
+		},
+	}
+	a.prepare(context.Background(), Sleep)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Prepare to time out, got %v", err)
+	}
+}
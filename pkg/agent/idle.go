@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultIdleInterval is how often IdleMonitor checks the VM when no
+// interval is set
+const DefaultIdleInterval = time.Minute
+
+// Activity is what an IdleMonitor check found
+type Activity int
+
+const (
+	// Stopped means the VM isn't running
+	Stopped Activity = iota
+
+	// Idle means the VM is running without active environments
+	Idle
+
+	// Active means at least one environment has processes running
+	Active
+)
+
+// IdleMonitor stops the VM once it has run without active environments
+// for a while, so a forgotten VM doesn't hold the host's memory
+type IdleMonitor struct {
+	// Timeout is how long the VM must stay idle before it's stopped
+	Timeout time.Duration
+
+	// Interval is how often the VM is checked (default:
+	// DefaultIdleInterval)
+	Interval time.Duration
+
+	// Check reports the VM's activity
+	Check func(ctx context.Context) (Activity, error)
+
+	// Stop stops the idle VM
+	Stop func(ctx context.Context) error
+
+	// Logf reports what the monitor does
+	Logf func(format string, args ...interface{})
+
+	// now returns the current time; tests replace it
+	now func() time.Time
+}
+
+// Run checks the VM every interval until ctx ends, stopping it once Check
+// has found it idle for Timeout. A failed check leaves the idle time
+// running: it's usually the VM being stopped or restarted, which the next
+// check sees.
+func (m *IdleMonitor) Run(ctx context.Context) {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = DefaultIdleInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var idleSince time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			idleSince = m.check(ctx, idleSince)
+		}
+	}
+}
+
+// check runs one check given when the VM became idle, or the zero time if
+// it wasn't, and returns the new idle start
+func (m *IdleMonitor) check(ctx context.Context, idleSince time.Time) time.Time {
+	activity, err := m.Check(ctx)
+	if err != nil {
+		m.logf("Failed to check VM activity: %v", err)
+		return idleSince
+	}
+	if activity != Idle {
+		return time.Time{}
+	}
+
+	now := m.clock()
+	if idleSince.IsZero() {
+		return now
+	}
+	if now.Sub(idleSince) < m.Timeout {
+		return idleSince
+	}
+
+	m.logf("Stopping the VM after %s without active environments", m.Timeout)
+	if err := m.Stop(ctx); err != nil {
+		m.logf("Failed to stop idle VM: %v", err)
+		return idleSince
+	}
+	return time.Time{}
+}
+
+func (m *IdleMonitor) clock() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
+}
+
+func (m *IdleMonitor) logf(format string, args ...interface{}) {
+	if m.Logf != nil {
+		m.Logf(format, args...)
+	}
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIdleMonitorCheck(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	// Each step is a check a minute after the previous one
+	tests := []struct {
+		name      string
+		checks    []Activity
+		failAt    int
+		wantStops int
+	}{
+		{name: "idle past the timeout", checks: []Activity{Idle, Idle, Idle, Idle}, failAt: -1, wantStops: 1},
+		{name: "activity resets the idle time", checks: []Activity{Idle, Idle, Active, Idle, Idle}, failAt: -1},
+		{name: "stopped VM", checks: []Activity{Stopped, Stopped, Stopped, Stopped}, failAt: -1},
+		{name: "failed checks keep the idle time", checks: []Activity{Idle, Idle, Idle, Idle}, failAt: 2, wantStops: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			step := 0
+			stops := 0
+			m := &IdleMonitor{
+				Timeout: 2 * time.Minute,
+				Check: func(context.Context) (Activity, error) {
+					if step == tt.failAt {
+						return Idle, errors.New("connection refused")
+					}
+					return tt.checks[step], nil
+				},
+				Stop: func(context.Context) error {
+					stops++
+					return nil
+				},
+				now: func() time.Time { return now },
+			}
+
+			var idleSince time.Time
+			for step = range tt.checks {
+				idleSince = m.check(context.Background(), idleSince)
+				now = now.Add(time.Minute)
+			}
+			if stops != tt.wantStops {
+				t.Errorf("stopped the VM %d times, want %d", stops, tt.wantStops)
+			}
+		})
+	}
+}
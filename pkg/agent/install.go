@@ -0,0 +1,210 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// ErrUnsupported is returned when the agent can't be installed on the host's
+// platform
+var ErrUnsupported = errors.New("the host agent is only supported on macOS and Linux")
+
+// launchdLabelPrefix prefixes the launchd labels of agents
+const launchdLabelPrefix = "io.github.middlendian.llima-box.agent"
+
+// Service describes the agent's service for one VM instance
+type Service struct {
+	// Executable is the absolute path of llima-box
+	Executable string
+
+	// Instance is the VM instance the agent stops (default: the default
+	// instance)
+	Instance string
+
+	// Path is the PATH the agent runs with, so it finds limactl where the
+	// installing shell did
+	Path string
+}
+
+// Name returns the systemd unit name of the service, without its suffix
+func (s Service) Name() string {
+	if s.Instance == "" || s.Instance == vm.DefaultInstanceName {
+		return "llima-box-agent"
+	}
+	return "llima-box-agent-" + s.Instance
+}
+
+// Label returns the launchd label of the service
+func (s Service) Label() string {
+	if s.Instance == "" || s.Instance == vm.DefaultInstanceName {
+		return launchdLabelPrefix
+	}
+	return launchdLabelPrefix + "." + s.Instance
+}
+
+// args returns the command line the service runs
+func (s Service) args() []string {
+	args := []string{s.Executable, "daemon", "run"}
+	if s.Instance != "" && s.Instance != vm.DefaultInstanceName {
+		args = append(args, "--instance", s.Instance)
+	}
+	return args
+}
+
+// systemdUnit returns the systemd user unit running the agent. Stopping the
+// service is how the agent learns of a logout, so it's given time to stop
+// the VM.
+func (s Service) systemdUnit() string {
+	quoted := make([]string, 0, len(s.args()))
+	for _, arg := range s.args() {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=llima-box host agent: stops the VM before the host sleeps or shuts down\n\n")
+	b.WriteString("[Service]\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(quoted, " "))
+	if s.Path != "" {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote("PATH="+s.Path))
+	}
+	b.WriteString("Restart=on-failure\n")
+	// llima-box exits with 130 when it's stopped by a signal
+	b.WriteString("SuccessExitStatus=130\n")
+	fmt.Fprintf(&b, "TimeoutStopSec=%d\n\n", int(DefaultTimeout.Seconds())+30)
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=default.target\n")
+	return b.String()
+}
+
+// systemdQuote quotes s as a single word of a systemd unit setting
+func systemdQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(s)
+	return `"` + s + `"`
+}
+
+// launchdPlist returns the launchd agent definition running the agent, with
+// its errors logged to logPath. launchd sends the agent SIGTERM on logout and shutdown and waits
+// ExitTimeOut seconds for it to stop the VM.
+func (s Service) launchdPlist(logPath string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString(`<plist version="1.0">` + "\n<dict>\n")
+	fmt.Fprintf(&b, "\t<key>Label</key>\n\t<string>%s</string>\n", xmlEscape(s.Label()))
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range s.args() {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", xmlEscape(arg))
+	}
+	b.WriteString("\t</array>\n")
+	if s.Path != "" {
+		fmt.Fprintf(&b, "\t<key>EnvironmentVariables</key>\n\t<dict>\n\t\t<key>PATH</key>\n\t\t<string>%s</string>\n\t</dict>\n", xmlEscape(s.Path))
+	}
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	fmt.Fprintf(&b, "\t<key>ExitTimeOut</key>\n\t<integer>%d</integer>\n", int(DefaultTimeout.Seconds())+30)
+	fmt.Fprintf(&b, "\t<key>StandardErrorPath</key>\n\t<string>%s</string>\n", xmlEscape(logPath))
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+// xmlEscape escapes s for XML character data
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// definition returns where the service definition goes on goos, its
+// contents, and the commands loading and unloading it
+func (s Service) definition(goos string) (path, content string, load, unload [][]string, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", nil, nil, fmt.Errorf("failed to find home directory: %w", err)
+	}
+
+	switch goos {
+	case "darwin":
+		path = filepath.Join(home, "Library", "LaunchAgents", s.Label()+".plist")
+		load = [][]string{{"launchctl", "load", "-w", path}}
+		unload = [][]string{{"launchctl", "unload", "-w", path}}
+		logPath := filepath.Join(home, "Library", "Logs", s.Name()+".log")
+		return path, s.launchdPlist(logPath), load, unload, nil
+	case "linux":
+		dir := os.Getenv("XDG_CONFIG_HOME")
+		if dir == "" {
+			dir = filepath.Join(home, ".config")
+		}
+		unit := s.Name() + ".service"
+		path = filepath.Join(dir, "systemd", "user", unit)
+		load = [][]string{
+			{"systemctl", "--user", "daemon-reload"},
+			{"systemctl", "--user", "enable", "--now", unit},
+		}
+		unload = [][]string{{"systemctl", "--user", "disable", "--now", unit}}
+		return path, s.systemdUnit(), load, unload, nil
+	default:
+		return "", "", nil, nil, ErrUnsupported
+	}
+}
+
+// Install writes the service definition and loads it, starting the agent
+// now and at every login. It returns the definition's path.
+func Install(ctx context.Context, s Service) (string, error) {
+	path, content, load, _, err := s.definition(runtime.GOOS)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create service directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil { // #nosec G306 -- service managers read definitions as the user
+		return "", fmt.Errorf("failed to write service definition: %w", err)
+	}
+	if err := runAll(ctx, load); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Uninstall stops the agent and removes its service definition. It returns
+// the definition's path, or os.ErrNotExist if the agent isn't installed.
+func Uninstall(ctx context.Context, s Service) (string, error) {
+	path, _, _, unload, err := s.definition(runtime.GOOS)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	if err := runAll(ctx, unload); err != nil {
+		return "", err
+	}
+	if err := os.Remove(path); err != nil {
+		return "", fmt.Errorf("failed to remove service definition: %w", err)
+	}
+	return path, nil
+}
+
+// runAll runs each command in turn, stopping at the first failure
+func runAll(ctx context.Context, cmds [][]string) error {
+	for _, args := range cmds {
+		output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput() // #nosec G204 -- service manager commands with fixed arguments
+		if err != nil {
+			return fmt.Errorf("failed to run %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
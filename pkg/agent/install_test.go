@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServiceDefinition(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	tests := []struct {
+		name     string
+		goos     string
+		service  Service
+		wantPath string
+		want     []string
+		wantLoad string
+	}{
+		{
+			name:     "systemd",
+			goos:     "linux",
+			service:  Service{Executable: "/opt/llima box/llima-box", Path: "/usr/bin:/home/u/100%/bin"},
+			wantPath: filepath.Join(home, ".config", "systemd", "user", "llima-box-agent.service"),
+			want: []string{
+				`ExecStart="/opt/llima box/llima-box" "daemon" "run"` + "\n",
+				`Environment="PATH=/usr/bin:/home/u/100%%/bin"` + "\n",
+				"WantedBy=default.target\n",
+			},
+			wantLoad: "systemctl --user enable --now llima-box-agent.service",
+		},
+		{
+			name:     "systemd for an instance",
+			goos:     "linux",
+			service:  Service{Executable: "/usr/bin/llima-box", Instance: "arm"},
+			wantPath: filepath.Join(home, ".config", "systemd", "user", "llima-box-agent-arm.service"),
+			want:     []string{`ExecStart="/usr/bin/llima-box" "daemon" "run" "--instance" "arm"` + "\n"},
+			wantLoad: "systemctl --user enable --now llima-box-agent-arm.service",
+		},
+		{
+			name:     "launchd",
+			goos:     "darwin",
+			service:  Service{Executable: "/opt/homebrew/bin/llima-box", Instance: "llima-box", Path: "/opt/homebrew/bin:/usr/bin"},
+			wantPath: filepath.Join(home, "Library", "LaunchAgents", "io.github.middlendian.llima-box.agent.plist"),
+			want: []string{
+				"<string>io.github.middlendian.llima-box.agent</string>",
+				"<string>/opt/homebrew/bin/llima-box</string>\n\t\t<string>daemon</string>\n\t\t<string>run</string>\n\t</array>",
+				"<key>PATH</key>\n\t\t<string>/opt/homebrew/bin:/usr/bin</string>",
+				filepath.Join(home, "Library", "Logs", "llima-box-agent.log"),
+			},
+			wantLoad: "launchctl load -w " + filepath.Join(home, "Library", "LaunchAgents", "io.github.middlendian.llima-box.agent.plist"),
+		},
+		{
+			name:     "launchd escapes",
+			goos:     "darwin",
+			service:  Service{Executable: "/Users/a&b/llima-box", Instance: "work"},
+			wantPath: filepath.Join(home, "Library", "LaunchAgents", "io.github.middlendian.llima-box.agent.work.plist"),
+			want:     []string{"<string>/Users/a&amp;b/llima-box</string>", "<string>--instance</string>\n\t\t<string>work</string>"},
+			wantLoad: "launchctl load -w",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, content, load, _, err := tt.service.definition(tt.goos)
+			if err != nil {
+				t.Fatalf("definition failed: %v", err)
+			}
+			if path != tt.wantPath {
+				t.Errorf("path = %s, want %s", path, tt.wantPath)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(content, want) {
+					t.Errorf("expected definition to contain %q, got:\n%s", want, content)
+				}
+			}
+			if got := strings.Join(load[len(load)-1], " "); !strings.HasPrefix(got, tt.wantLoad) {
+				t.Errorf("load command = %q, want %q", got, tt.wantLoad)
+			}
+		})
+	}
+}
+
+func TestServiceDefinition_Unsupported(t *testing.T) {
+	if _, _, _, _, err := (Service{}).definition("windows"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// DetectsSleep reports whether the agent stops the VM before the host
+// sleeps. logind reports sleep, so on Linux it does.
+const DetectsSleep = true
+
+// NewSource returns the Source for this platform. On Linux it follows
+// systemd-logind, which reports sleep and shutdown ahead of time.
+func NewSource() (Source, error) {
+	l, err := newLogind()
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// logindMatches are the dbus-monitor match rules for logind's sleep and
+// shutdown signals
+var logindMatches = []string{
+	"type='signal',interface='org.freedesktop.login1.Manager',member='PrepareForSleep'",
+	"type='signal',interface='org.freedesktop.login1.Manager',member='PrepareForShutdown'",
+}
+
+// inhibitArgs are the systemd-inhibit arguments of the delay lock the agent
+// holds. logind waits for delay locks to be released before sleeping or
+// shutting down, for at most its InhibitDelayMaxSec.
+var inhibitArgs = []string{
+	"--what=sleep:shutdown",
+	"--mode=delay",
+	"--who=llima-box",
+	"--why=Stopping the llima-box VM",
+	"sleep", "infinity",
+}
+
+// logind is a Source for systemd-logind's PrepareForSleep and
+// PrepareForShutdown signals. It follows them with dbus-monitor and delays
+// sleep and shutdown with a systemd-inhibit lock, so it needs no D-Bus
+// bindings.
+type logind struct {
+	monitor *exec.Cmd
+	events  chan Event
+
+	mu        sync.Mutex
+	inhibitor *exec.Cmd
+}
+
+// newLogind starts following logind's signals and takes the delay lock
+func newLogind() (*logind, error) {
+	for _, tool := range []string{"dbus-monitor", "systemd-inhibit"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return nil, fmt.Errorf("%s not found: host sleep and shutdown can't be detected", tool)
+		}
+	}
+
+	monitor := exec.Command("dbus-monitor", append([]string{"--system"}, logindMatches...)...) // #nosec G204 -- fixed arguments
+	stdout, err := monitor.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start dbus-monitor: %w", err)
+	}
+	if err := monitor.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start dbus-monitor: %w", err)
+	}
+
+	l := &logind{monitor: monitor, events: make(chan Event)}
+	if err := l.inhibit(); err != nil {
+		_ = monitor.Process.Kill()
+		_ = monitor.Wait()
+		return nil, err
+	}
+
+	go func() {
+		parseLogindSignals(stdout, l.events)
+		_ = monitor.Wait()
+		close(l.events)
+	}()
+	return l, nil
+}
+
+// Events returns logind's sleep, wake, and shutdown events
+func (l *logind) Events() <-chan Event {
+	return l.events
+}
+
+// Done releases the delay lock once the agent is ready for sleep or
+// shutdown, and takes it again after waking
+func (l *logind) Done(e Event) {
+	if e == Wake {
+		_ = l.inhibit()
+		return
+	}
+	l.release()
+}
+
+// Close stops following logind's signals and releases the delay lock
+func (l *logind) Close() error {
+	l.release()
+	if l.monitor.Process != nil {
+		_ = l.monitor.Process.Kill()
+	}
+	return nil
+}
+
+// inhibit takes the delay lock if it isn't held
+func (l *logind) inhibit() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inhibitor != nil {
+		return nil
+	}
+
+	cmd := exec.Command("systemd-inhibit", inhibitArgs...) // #nosec G204 -- fixed arguments
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to take sleep inhibitor lock: %w", err)
+	}
+	l.inhibitor = cmd
+	return nil
+}
+
+// release releases the delay lock if it's held
+func (l *logind) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inhibitor == nil {
+		return
+	}
+	_ = l.inhibitor.Process.Kill()
+	_ = l.inhibitor.Wait()
+	l.inhibitor = nil
+}
+
+// parseLogindSignals reads dbus-monitor output and sends an event for each
+// PrepareForSleep and PrepareForShutdown signal, until r ends. A signal's
+// argument follows its header line:
+//
+//	signal time=... member=PrepareForSleep
+//	   boolean true
+//
+// PrepareForSleep(false) means the host woke up; PrepareForShutdown(false)
+// means a shutdown was cancelled, which is handled like waking up.
+func parseLogindSignals(r io.Reader, events chan<- Event) {
+	scanner := bufio.NewScanner(r)
+	member := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "signal ") {
+			member = ""
+			for _, field := range strings.Fields(line) {
+				if name, ok := strings.CutPrefix(field, "member="); ok {
+					member = name
+				}
+			}
+			continue
+		}
+
+		active, ok := map[string]bool{"boolean true": true, "boolean false": false}[line]
+		if !ok || member == "" {
+			continue
+		}
+		switch {
+		case !active:
+			events <- Wake
+		case member == "PrepareForSleep":
+			events <- Sleep
+		case member == "PrepareForShutdown":
+			events <- Shutdown
+		}
+		member = ""
+	}
+}
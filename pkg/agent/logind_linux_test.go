@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLogindSignals(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []Event
+	}{
+		{
+			name: "sleep and wake",
+			output: `signal time=1760000000.1 sender=org.freedesktop.DBus -> destination=:1.42 serial=2 path=/org/freedesktop/DBus; interface=org.freedesktop.DBus; member=NameAcquired
+   string ":1.42"
+signal time=1760000100.5 sender=:1.3 -> destination=(null destination) serial=812 path=/org/freedesktop/login1; interface=org.freedesktop.login1.Manager; member=PrepareForSleep
+   boolean true
+signal time=1760003600.2 sender=:1.3 -> destination=(null destination) serial=815 path=/org/freedesktop/login1; interface=org.freedesktop.login1.Manager; member=PrepareForSleep
+   boolean false
+`,
+			want: []Event{Sleep, Wake},
+		},
+		{
+			name: "shutdown",
+			output: `signal time=1760000100.5 sender=:1.3 -> destination=(null destination) serial=900 path=/org/freedesktop/login1; interface=org.freedesktop.login1.Manager; member=PrepareForShutdown
+   boolean true
+`,
+			want: []Event{Shutdown},
+		},
+		{
+			name: "cancelled shutdown",
+			output: `signal time=1760000100.5 sender=:1.3 -> destination=(null destination) serial=900 path=/org/freedesktop/login1; interface=org.freedesktop.login1.Manager; member=PrepareForShutdown
+   boolean false
+`,
+			want: []Event{Wake},
+		},
+		{
+			name: "boolean without a signal",
+			output: `method call time=1760000100.5 sender=:1.9 -> destination=org.freedesktop.login1 serial=3 path=/org/freedesktop/login1; interface=org.freedesktop.DBus.Properties; member=Get
+   boolean true
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := make(chan Event, 10)
+			parseLogindSignals(strings.NewReader(tt.output), events)
+			close(events)
+
+			var got []Event
+			for e := range events {
+				got = append(got, e)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got events %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
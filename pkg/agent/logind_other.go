@@ -0,0 +1,14 @@
+//go:build !linux
+
+package agent
+
+// DetectsSleep reports whether the agent stops the VM before the host
+// sleeps. Outside Linux it only handles logout and shutdown.
+const DetectsSleep = false
+
+// NewSource returns the Source for this platform. Outside Linux, host sleep
+// isn't observed and it returns nil: the agent only stops the VM when the
+// service manager ends it, as launchd does on logout and shutdown.
+func NewSource() (Source, error) {
+	return nil, nil
+}
@@ -0,0 +1,119 @@
+// Package approval asks for approval before llima-box carries out a
+// destructive operation.
+//
+// Teams that let agents drive llima-box can't rely on the interactive
+// confirmation prompt: an agent simply passes --force. An Approver is
+// consulted after the prompt, whether or not it was skipped, and blocks until
+// the operation is approved or denied. The Command approver hands the
+// decision to an external program, for example one that asks a person in a
+// chat channel and waits for the answer.
+package approval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/hostcmd"
+)
+
+// ErrDenied is returned when an operation isn't approved
+var ErrDenied = errors.New("operation was not approved")
+
+// DefaultTimeout is how long a Command approver waits for a decision when
+// no timeout is set
+const DefaultTimeout = 10 * time.Minute
+
+// Request describes the operation awaiting approval
+type Request struct {
+	// Operation is the llima-box command, e.g. "delete", "delete-all", or
+	// "restore"
+	Operation string `json:"operation"`
+
+	// Environments lists what the operation affects
+	Environments []Target `json:"environments"`
+
+	// Forced is set when the interactive confirmation was skipped with
+	// --force, which usually means no person is at the terminal
+	Forced bool `json:"forced"`
+
+	// Args is the full llima-box command line
+	Args []string `json:"args"`
+}
+
+// Target is an environment affected by an operation
+type Target struct {
+	Name        string `json:"name"`
+	ProjectPath string `json:"projectPath,omitempty"`
+}
+
+// Approver decides whether an operation may go ahead. Approve blocks until a
+// decision is made and returns nil to approve; denials wrap ErrDenied.
+type Approver interface {
+	Approve(ctx context.Context, req Request) error
+}
+
+// Command approves operations by running an external program through sh
+// (cmd.exe on Windows).
+// The program gets the request as JSON on standard input, and the operation
+// and comma-separated environment names in $LLIMA_BOX_OPERATION and
+// $LLIMA_BOX_ENVIRONMENTS. Exiting with status 0 approves; any other status,
+// or not exiting within the timeout, denies. The program's output goes to
+// standard error, so it can tell the user what it's waiting for.
+type Command struct {
+	// Command is the shell command to run
+	Command string
+
+	// Timeout bounds the wait for a decision (default: DefaultTimeout)
+	Timeout time.Duration
+}
+
+// Approve runs the program and waits for its decision
+func (c *Command) Approve(ctx context.Context, req Request) error {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode approval request: %w", err)
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	names := make([]string, len(req.Environments))
+	for i, t := range req.Environments {
+		names[i] = t.Name
+	}
+
+	cmd := hostcmd.Command(ctx, c.Command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"LLIMA_BOX_OPERATION="+req.Operation,
+		"LLIMA_BOX_ENVIRONMENTS="+strings.Join(names, ","),
+	)
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w: no decision within %s", ErrDenied, timeout)
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case errors.As(err, &exitErr):
+		return fmt.Errorf("%w: approval hook exited with status %d", ErrDenied, exitErr.ExitCode())
+	default:
+		return fmt.Errorf("failed to run approval hook: %w", err)
+	}
+}
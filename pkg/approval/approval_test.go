@@ -0,0 +1,58 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandApprove(t *testing.T) {
+	req := Request{
+		Operation:    "delete",
+		Environments: []Target{{Name: "app-a1b2", ProjectPath: "/Users/alice/app"}},
+		Forced:       true,
+	}
+
+	tests := []struct {
+		name       string
+		command    string
+		timeout    time.Duration
+		wantDenied bool
+		wantErr    string
+	}{
+		{name: "approved", command: "exit 0"},
+		{name: "denied", command: "exit 3", wantDenied: true, wantErr: "status 3"},
+		{name: "timed out", command: "sleep 5", timeout: 50 * time.Millisecond, wantDenied: true, wantErr: "no decision within"},
+		{name: "request on stdin", command: `grep -q '"operation":"delete".*"forced":true'`},
+		{name: "environment variables", command: `[ "$LLIMA_BOX_OPERATION" = delete ] && [ "$LLIMA_BOX_ENVIRONMENTS" = app-a1b2 ]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			approver := &Command{Command: tt.command, Timeout: tt.timeout}
+			err := approver.Approve(context.Background(), req)
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected approval, got %v", err)
+				}
+				return
+			}
+			if errors.Is(err, ErrDenied) != tt.wantDenied || err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected denial containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCommandApprove_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := (&Command{Command: "sleep 5"}).Approve(ctx, Request{Operation: "delete-all"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
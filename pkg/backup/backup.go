@@ -0,0 +1,321 @@
+// Package backup snapshots project directories on the host before they're
+// handed to an agent, and restores them afterwards.
+//
+// A snapshot is a copy-on-write clone of the directory where the filesystem
+// supports one (APFS on macOS, btrfs or XFS on Linux), which is quick and
+// takes no space until files change, and a gzipped tarball elsewhere.
+// Snapshots are kept in a Store, grouped by environment name, outside the
+// project directory.
+//
+// Restoring makes the project directory match the snapshot again: changed
+// files are rewritten and files created since are removed. It works in
+// place, so an environment's bind mount of the directory keeps working.
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kind is how a snapshot is stored
+type Kind string
+
+const (
+	// KindClone is a copy-on-write clone of the project directory
+	KindClone Kind = "clone"
+
+	// KindTarball is a gzipped tar archive of the project directory
+	KindTarball Kind = "tarball"
+)
+
+// Method selects how Create stores a snapshot
+type Method int
+
+const (
+	// MethodAuto clones the directory where the filesystem supports it and
+	// falls back to a tarball
+	MethodAuto Method = iota
+
+	// MethodClone only clones, failing where cloning isn't supported
+	MethodClone
+
+	// MethodTarball always writes a tarball
+	MethodTarball
+)
+
+// ErrNotFound is returned when there's no snapshot to restore
+var ErrNotFound = errors.New("no such backup")
+
+// idFormat names snapshots so they sort by creation time
+const idFormat = "20060102-150405.000000"
+
+// Snapshot describes a stored backup of a project directory
+type Snapshot struct {
+	// ID identifies the snapshot among the environment's backups
+	ID string `json:"id"`
+
+	// ProjectPath is the directory that was backed up
+	ProjectPath string `json:"projectPath"`
+
+	Kind      Kind      `json:"kind"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Reason says why the snapshot was taken, such as "manual" or "auto"
+	Reason string `json:"reason,omitempty"`
+
+	// Files and Bytes count the regular files backed up and their size
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Store keeps snapshots in a directory on the host
+type Store struct {
+	dir string
+}
+
+// NewStore returns a store keeping snapshots under dir
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// envDir returns the directory holding the named environment's snapshots
+func (s *Store) envDir(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+func (s *Store) metadataPath(name, id string) string {
+	return filepath.Join(s.envDir(name), id+".json")
+}
+
+// dataPath returns where a snapshot's files are: a directory for clones and
+// an archive for tarballs
+func (s *Store) dataPath(name string, snap *Snapshot) string {
+	if snap.Kind == KindClone {
+		return filepath.Join(s.envDir(name), snap.ID)
+	}
+	return filepath.Join(s.envDir(name), snap.ID+".tar.gz")
+}
+
+// Create snapshots projectPath as a backup for the named environment
+func (s *Store) Create(ctx context.Context, name, projectPath string, method Method, reason string) (*Snapshot, error) {
+	info, err := os.Stat(projectPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", projectPath)
+	}
+	if within(s.dir, projectPath) {
+		return nil, fmt.Errorf("backups are stored in %s, inside the project directory", s.dir)
+	}
+	if err := os.MkdirAll(s.envDir(name), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	now := time.Now().UTC()
+	snap := &Snapshot{
+		ID:          now.Format(idFormat),
+		ProjectPath: projectPath,
+		CreatedAt:   now,
+		Reason:      reason,
+	}
+
+	cloned := false
+	if method != MethodTarball {
+		snap.Kind = KindClone
+		err := clone(ctx, projectPath, s.dataPath(name, snap))
+		switch {
+		case err == nil:
+			cloned = true
+		case method == MethodClone:
+			return nil, err
+		default:
+			_ = os.RemoveAll(s.dataPath(name, snap))
+		}
+	}
+
+	if cloned {
+		snap.Files, snap.Bytes, err = countFiles(s.dataPath(name, snap))
+	} else {
+		snap.Kind = KindTarball
+		snap.Files, snap.Bytes, err = writeTarball(ctx, projectPath, s.dataPath(name, snap))
+	}
+	if err != nil {
+		_ = os.RemoveAll(s.dataPath(name, snap))
+		return nil, err
+	}
+
+	if err := s.writeMetadata(name, snap); err != nil {
+		_ = os.RemoveAll(s.dataPath(name, snap))
+		return nil, err
+	}
+	return snap, nil
+}
+
+func (s *Store) writeMetadata(name string, snap *Snapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode backup metadata: %w", err)
+	}
+	if err := os.WriteFile(s.metadataPath(name, snap.ID), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write backup metadata: %w", err)
+	}
+	return nil
+}
+
+// List returns the named environment's snapshots, newest first
+func (s *Store) List(name string) ([]*Snapshot, error) {
+	matches, err := filepath.Glob(filepath.Join(s.envDir(name), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var snaps []*Snapshot
+	for _, path := range matches {
+		data, err := os.ReadFile(path) // #nosec G304 -- path is inside the backup store
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup metadata: %w", err)
+		}
+		var snap Snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping unreadable backup metadata %s: %v\n", path, err)
+			continue
+		}
+		snaps = append(snaps, &snap)
+	}
+
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].ID > snaps[j].ID })
+	return snaps, nil
+}
+
+// Get returns the named environment's snapshot with the given ID, or the
+// newest one if id is empty
+func (s *Store) Get(name, id string) (*Snapshot, error) {
+	snaps, err := s.List(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snaps {
+		if id == "" || snap.ID == id {
+			return snap, nil
+		}
+	}
+	if id == "" {
+		return nil, ErrNotFound
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// Delete removes a snapshot
+func (s *Store) Delete(name string, snap *Snapshot) error {
+	if err := os.RemoveAll(s.dataPath(name, snap)); err != nil {
+		return fmt.Errorf("failed to delete backup %s: %w", snap.ID, err)
+	}
+	if err := os.Remove(s.metadataPath(name, snap.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete backup %s: %w", snap.ID, err)
+	}
+	return nil
+}
+
+// Prune deletes the named environment's oldest snapshots taken for reason,
+// keeping the newest keep of them
+func (s *Store) Prune(name, reason string, keep int) error {
+	snaps, err := s.List(name)
+	if err != nil {
+		return err
+	}
+	for _, snap := range snaps {
+		if snap.Reason != reason {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		if err := s.Delete(name, snap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore makes snap.ProjectPath match the snapshot again
+func (s *Store) Restore(ctx context.Context, name string, snap *Snapshot) error {
+	src := s.dataPath(name, snap)
+	if snap.Kind == KindTarball {
+		tmp, err := os.MkdirTemp(s.envDir(name), ".restore-")
+		if err != nil {
+			return fmt.Errorf("failed to create restore directory: %w", err)
+		}
+		defer func() { _ = os.RemoveAll(tmp) }()
+
+		if err := extractTarball(ctx, src, tmp); err != nil {
+			return err
+		}
+		src = tmp
+	}
+
+	if err := os.MkdirAll(snap.ProjectPath, 0755); err != nil {
+		return fmt.Errorf("failed to create project directory: %w", err)
+	}
+	return syncTree(ctx, src, snap.ProjectPath)
+}
+
+// clone makes a copy-on-write copy of src at dst with cp
+func clone(ctx context.Context, src, dst string) error {
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		args = []string{"-c", "-R", "-p", src, dst}
+	case "linux":
+		args = []string{"-a", "--reflink=always", src, dst}
+	default:
+		return fmt.Errorf("cloning isn't supported on %s", runtime.GOOS)
+	}
+
+	output, err := exec.CommandContext(ctx, "cp", args...).CombinedOutput() // #nosec G204 -- arguments are paths, passed without a shell
+	if err != nil {
+		return fmt.Errorf("failed to clone %s: %w (output: %s)", src, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// countFiles returns the number and total size of the regular files under
+// dir
+func countFiles(dir string) (int, int64, error) {
+	var files int
+	var bytes int64
+	err := filepath.WalkDir(dir, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files++
+			bytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read backup: %w", err)
+	}
+	return files, bytes, nil
+}
+
+// within reports whether p is dir or inside it
+func within(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,162 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeProject creates a small project directory
+func writeProject(t *testing.T, dir string) {
+	t.Helper()
+	files := map[string]string{
+		"main.go":          "package main\n",
+		"docs/README.md":   "# App\n",
+		"scripts/build.sh": "#!/bin/sh\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(dir, "scripts/build.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("docs/README.md", filepath.Join(dir, "README.md")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	tests := []struct {
+		name   string
+		method Method
+	}{
+		{name: "tarball", method: MethodTarball},
+		{name: "auto", method: MethodAuto},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := t.TempDir()
+			writeProject(t, project)
+			store := NewStore(t.TempDir())
+
+			snap, err := store.Create(t.Context(), "app-a1b2", project, tt.method, "manual")
+			if err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			if snap.Files != 3 || snap.Bytes != int64(len("package main\n")+len("# App\n")+len("#!/bin/sh\n")) {
+				t.Errorf("unexpected counts: %d files, %d bytes", snap.Files, snap.Bytes)
+			}
+			if tt.method == MethodTarball && snap.Kind != KindTarball {
+				t.Errorf("expected a tarball, got %s", snap.Kind)
+			}
+
+			// An agent edits, deletes, adds, and replaces files
+			mustWrite(t, filepath.Join(project, "main.go"), "package broken\n")
+			if err := os.RemoveAll(filepath.Join(project, "docs")); err != nil {
+				t.Fatal(err)
+			}
+			mustWrite(t, filepath.Join(project, "new/junk.txt"), "junk")
+			if err := os.Remove(filepath.Join(project, "scripts/build.sh")); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Mkdir(filepath.Join(project, "scripts/build.sh"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := store.Restore(t.Context(), "app-a1b2", snap); err != nil {
+				t.Fatalf("Restore failed: %v", err)
+			}
+
+			for name, want := range map[string]string{
+				"main.go":          "package main\n",
+				"docs/README.md":   "# App\n",
+				"scripts/build.sh": "#!/bin/sh\n",
+				"README.md":        "# App\n",
+			} {
+				data, err := os.ReadFile(filepath.Join(project, name))
+				if err != nil || string(data) != want {
+					t.Errorf("%s: got %q, %v; want %q", name, data, err, want)
+				}
+			}
+			if info, err := os.Stat(filepath.Join(project, "scripts/build.sh")); err != nil || info.Mode().Perm() != 0755 {
+				t.Errorf("expected build.sh to be executable again, got %v, %v", info, err)
+			}
+			if target, err := os.Readlink(filepath.Join(project, "README.md")); err != nil || target != "docs/README.md" {
+				t.Errorf("expected the symlink to be kept, got %q, %v", target, err)
+			}
+			if _, err := os.Stat(filepath.Join(project, "new")); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected files created after the backup to be removed, got %v", err)
+			}
+		})
+	}
+}
+
+func mustWrite(t *testing.T, p, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListGetPrune(t *testing.T) {
+	project := t.TempDir()
+	writeProject(t, project)
+	store := NewStore(t.TempDir())
+
+	var ids []string
+	for _, reason := range []string{"manual", "auto", "auto", "auto"} {
+		snap, err := store.Create(t.Context(), "app-a1b2", project, MethodTarball, reason)
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		ids = append(ids, snap.ID)
+	}
+
+	latest, err := store.Get("app-a1b2", "")
+	if err != nil || latest.ID != ids[3] {
+		t.Fatalf("expected the newest backup %s, got %v, %v", ids[3], latest, err)
+	}
+	if _, err := store.Get("app-a1b2", "19990101-000000.000000"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.Get("other-c3d4", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an environment without backups, got %v", err)
+	}
+
+	if err := store.Prune("app-a1b2", "auto", 1); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	snaps, err := store.List("app-a1b2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range snaps {
+		got = append(got, s.ID)
+	}
+	if len(got) != 2 || got[0] != ids[3] || got[1] != ids[0] {
+		t.Errorf("expected the newest auto backup and the manual one, got %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(store.dir, "app-a1b2", ids[1]+".tar.gz")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected pruned archives to be deleted, got %v", err)
+	}
+}
+
+func TestCreate_StoreInsideProject(t *testing.T) {
+	project := t.TempDir()
+	store := NewStore(filepath.Join(project, ".backups"))
+	if _, err := store.Create(t.Context(), "app-a1b2", project, MethodTarball, "manual"); err == nil {
+		t.Error("expected an error when the store is inside the project")
+	}
+}
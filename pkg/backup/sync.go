@@ -0,0 +1,132 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// syncTree makes dst match src: entries missing from src are removed, and
+// every file, directory, and symlink in src is written to dst. dst itself is
+// kept, so mounts of it stay valid.
+func syncTree(ctx context.Context, src, dst string) error {
+	if err := removeExtra(ctx, src, dst); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(src, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", rel, err)
+			}
+			if err := os.Chmod(target, info.Mode().Perm()|0700); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", rel, err)
+			}
+		case info.Mode()&os.ModeSymlink != 0:
+			if err := restoreSymlink(p, target); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", rel, err)
+			}
+		case info.Mode().IsRegular():
+			if err := restoreFile(p, target, info); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", rel, err)
+			}
+		}
+		return nil
+	})
+}
+
+// removeExtra removes everything under dst that isn't in src, or is a
+// different kind of entry there
+func removeExtra(ctx context.Context, src, dst string) error {
+	return filepath.WalkDir(dst, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p == dst {
+			return nil
+		}
+		rel, err := filepath.Rel(dst, p)
+		if err != nil {
+			return err
+		}
+
+		want, err := os.Lstat(filepath.Join(src, rel))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err == nil && want.Mode().Type() == d.Type() {
+			return nil
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", rel, err)
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// restoreFile replaces target with a copy of the file at p
+func restoreFile(p, target string, info os.FileInfo) error {
+	in, err := os.Open(p) // #nosec G304 -- p is inside the snapshot
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm()) // #nosec G304 -- target is inside the project being restored
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(target, info.ModTime(), info.ModTime())
+}
+
+// restoreSymlink replaces target with a copy of the symlink at p
+func restoreSymlink(p, target string) error {
+	link, err := os.Readlink(p)
+	if err != nil {
+		return err
+	}
+	if current, err := os.Readlink(target); err == nil && current == link {
+		return nil
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(link, target)
+}
@@ -0,0 +1,176 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeTarball archives the contents of dir into a gzipped tarball at path.
+// Names in the archive are relative to dir. Sockets, devices, and other
+// special files are skipped.
+func writeTarball(ctx context.Context, dir, path string) (files int, bytes int64, err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600) // #nosec G304 -- path is inside the backup store
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to write backup: %w", closeErr)
+		}
+	}()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	err = filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() && info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(p) // #nosec G304 -- p is inside the project being backed up
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(tw, src)
+		_ = src.Close()
+		if err != nil {
+			return err
+		}
+		files++
+		bytes += n
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to back up %s: %w", dir, err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return 0, 0, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return 0, 0, fmt.Errorf("failed to write backup: %w", err)
+	}
+	return files, bytes, nil
+}
+
+// extractTarball unpacks a tarball written by writeTarball into dir. Entries
+// that would land outside dir, directly or through a symlink, are refused.
+func extractTarball(ctx context.Context, path, dir string) error {
+	f, err := os.Open(path) // #nosec G304 -- path is inside the backup store
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+
+		name := filepath.FromSlash(strings.TrimSuffix(hdr.Name, "/"))
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("backup contains an unsafe path: %s", hdr.Name)
+		}
+		target := filepath.Join(dir, name)
+		if parent := filepath.Dir(target); parent != dir {
+			if info, err := os.Lstat(parent); err != nil || !info.IsDir() {
+				return fmt.Errorf("backup contains an unsafe path: %s", hdr.Name)
+			}
+		}
+		mode := os.FileMode(hdr.Mode).Perm() // #nosec G115 -- permission bits fit in a FileMode
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", hdr.Name, err)
+			}
+			// The final mode is set by syncTree; keep the directory
+			// writable until its contents are extracted
+			if err := os.Chmod(target, mode|0700); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", hdr.Name, err)
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", hdr.Name, err)
+			}
+		case tar.TypeReg:
+			if err := extractFile(tr, target, mode); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", hdr.Name, err)
+			}
+			if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", hdr.Name, err)
+			}
+		}
+	}
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode) // #nosec G304 -- target was checked to be inside the restore directory
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil { // #nosec G110 -- the archive was written by this package
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
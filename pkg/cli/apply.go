@@ -0,0 +1,466 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/middlendian/llima-box/internal/dashboard"
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/env/templates"
+	"github.com/middlendian/llima-box/pkg/hooks"
+	"github.com/spf13/cobra"
+)
+
+// NewApplyCommand creates the apply command.
+func NewApplyCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var (
+		file   string
+		force  bool
+		dryRun bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "apply -f FILE",
+		Short: "Make the environments match a manifest",
+		Long: `Make the VM's environments match the ones a manifest file declares:
+
+  create     declared environments that don't exist yet
+  update     declared environments whose project configuration (packages,
+             toolchains, variables) or resource limits changed, and start
+             stopped ones
+  prune      environments the manifest doesn't declare
+
+The plan is shown first. Pruning deletes environments, so it prompts for
+confirmation unless --force is given, and needs the approval hook's consent
+if the host configuration sets one (operation "apply"). A failing preDelete
+hook keeps an environment. Quarantined environments are left alone.
+
+A manifest lists environments by host project path or VM workspace name:
+
+  environments:
+    - path: ~/src/api
+      template: python-ml   # for new environments
+      overlay: true         # for new environments
+      cpus: 2               # limits, as for 'shell --cpus', --memory,
+      memory: 4G            # and --swap; unset means no limit
+    - workspace: scratch
+
+Packages, toolchains, and labels come from each project's own
+.llima-box/config.yaml. A template or overlay only applies to new
+environments; a changed one is reported, and the environment must be deleted
+to pick it up.
+
+Examples:
+  # Show what would change
+  llima-box apply -f envs.yaml --dry-run
+
+  # Make it so, without confirmation
+  llima-box apply -f envs.yaml --force`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runApply(cmd, file, force, dryRun)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Manifest declaring the environments (required)")
+	cmd.Flags().BoolVar(&force, "force", false, "Prune without confirmation")
+	addYesFlag(cmd, &force)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the plan without changing anything")
+	cmd.Flags().BoolVar(&a.allowSynced, "allow-synced", false, "Allow environments for projects in cloud-synced folders, such as Dropbox or iCloud Drive")
+	_ = cmd.MarkFlagRequired("file")
+
+	return a.bind(cmd)
+}
+
+// applyAction is what apply does to an environment
+type applyAction string
+
+const (
+	applyCreate    applyAction = "create"
+	applyUpdate    applyAction = "update"
+	applyPrune     applyAction = "prune"
+	applyUnchanged applyAction = "unchanged"
+	applySkip      applyAction = "skip"
+)
+
+// applyStep is one environment of apply's plan and what came of it
+type applyStep struct {
+	Environment string      `json:"environment"`
+	ProjectPath string      `json:"projectPath,omitempty"`
+	Action      applyAction `json:"action"`
+
+	// Changes describe what an update changes, or why a step is skipped
+	Changes []string `json:"changes,omitempty"`
+
+	Error string `json:"error,omitempty"`
+
+	declared *declaredEnv
+	env      *env.Environment
+}
+
+// applyOutput is what apply prints with --output json
+type applyOutput struct {
+	Environments []applyStep `json:"environments"`
+	DryRun       bool        `json:"dryRun,omitempty"`
+}
+
+// declaredEnv is a manifest entry resolved to its environment
+type declaredEnv struct {
+	config.DeclaredEnvironment
+	env      *env.Environment
+	template *templates.Template
+	limits   env.Limits
+}
+
+// errJSONApplyNeedsForce is returned for apply with --output json when it
+// would prune, since there's no one to confirm
+var errJSONApplyNeedsForce = errors.New("--output json needs --force to prune environments, since there's no one to confirm")
+
+func (a *app) runApply(cmd *cobra.Command, file string, force, dryRun bool) error {
+	manifest, err := config.LoadManifest(file)
+	if err != nil {
+		return err
+	}
+	host, err := a.loadHost()
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	vmManager := a.newVMManager(host)
+	running, err := vmRunning(ctx, vmManager)
+	if err != nil {
+		return err
+	}
+	if !running {
+		if dryRun {
+			a.log.Info("The VM isn't running; every declared environment would be created")
+		} else if vmManager, err = a.ensureVM(ctx, host); err != nil {
+			return err
+		}
+	}
+
+	envManager := env.NewManagerWithOptions(vmManager, a.applyOptions(host, false))
+	defer func() { _ = envManager.Close() }()
+
+	declared, err := resolveManifest(ctx, envManager, manifest)
+	if err != nil {
+		return err
+	}
+	var actual []*env.Environment
+	if running || !dryRun {
+		if actual, err = envManager.List(ctx); err != nil {
+			return err
+		}
+	}
+
+	steps := planApply(declared, actual)
+	for i := range steps {
+		if err := a.checkDrift(ctx, envManager, &steps[i]); err != nil {
+			return err
+		}
+	}
+
+	out := applyOutput{Environments: steps, DryRun: dryRun}
+	if !a.json {
+		printApplyPlan(cmd, steps)
+	}
+	if dryRun {
+		if a.json {
+			return writeJSON(cmd, out)
+		}
+		return nil
+	}
+
+	var pruned []*env.Environment
+	for _, s := range steps {
+		if s.Action == applyPrune {
+			pruned = append(pruned, s.env)
+		}
+	}
+	if len(pruned) > 0 {
+		if !force && a.json {
+			return errJSONApplyNeedsForce
+		}
+		if !force {
+			a.log.Warning("Prune %d environment(s) the manifest doesn't declare?", len(pruned))
+			ok, err := a.confirm("This will terminate their processes and remove their data. Continue?", false)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				a.log.Info("Cancelled")
+				return nil
+			}
+		}
+		if err := a.requireApproval(ctx, host, "apply", pruned, force); err != nil {
+			return err
+		}
+	}
+
+	// Environments declared with an overlay are created by a manager that
+	// gives new environments one
+	overlayManager := envManager
+	failCount := 0
+	for i := range steps {
+		s := &steps[i]
+		if s.Action == applyUnchanged || s.Action == applySkip {
+			continue
+		}
+		m := envManager
+		if s.declared != nil && s.declared.Overlay {
+			if overlayManager == envManager {
+				overlayManager = env.NewManagerWithOptions(vmManager, a.applyOptions(host, true))
+				defer func() { _ = overlayManager.Close() }()
+			}
+			m = overlayManager
+		}
+
+		a.log.Info("%s %s", applyVerb(s.Action), s.Environment)
+		if err := a.applyStep(ctx, host, m, s); err != nil {
+			a.log.Error("Failed to %s %s: %v", s.Action, s.Environment, err)
+			s.Error = err.Error()
+			failCount++
+		}
+	}
+
+	if a.json {
+		if err := writeJSON(cmd, out); err != nil {
+			return err
+		}
+	}
+	if failCount > 0 {
+		return fmt.Errorf("failed to apply %d environment(s)", failCount)
+	}
+	a.log.Success("Environments match %s", file)
+	return nil
+}
+
+// applyOptions returns the environment manager options apply creates
+// environments with: the ones shell uses, with provisioning changes applied
+// without asking, since the manifest asks for them
+func (a *app) applyOptions(host *config.Host, overlay bool) env.Options {
+	opts := a.createOptions(host)
+	opts.Overlay = overlay
+	opts.ConfirmProvisioningChange = func(context.Context, *env.Environment, *env.ProvisioningChange) bool { return true }
+	return opts
+}
+
+// resolveManifest resolves the manifest's entries to their environments and
+// checks their templates and limits. Two entries for the same environment
+// are an error.
+func resolveManifest(ctx context.Context, envManager *env.Manager, manifest *config.Manifest) ([]*declaredEnv, error) {
+	seen := make(map[string]int)
+	declared := make([]*declaredEnv, 0, len(manifest.Environments))
+	for i, entry := range manifest.Environments {
+		d := &declaredEnv{DeclaredEnvironment: entry}
+		var err error
+		if entry.Workspace != "" {
+			d.env, err = env.VMWorkspace(entry.Workspace)
+		} else {
+			d.env, err = envManager.Find(ctx, entry.ProjectPath())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("environments[%d]: %w", i, err)
+		}
+		if j, ok := seen[d.env.Name]; ok {
+			return nil, fmt.Errorf("environments[%d] and environments[%d] are the same environment, %s", j, i, d.env.Name)
+		}
+		seen[d.env.Name] = i
+
+		if entry.Template != "" {
+			if d.template, err = templates.Load(entry.Template); err != nil {
+				return nil, fmt.Errorf("environments[%d]: %w", i, err)
+			}
+		}
+		d.limits.CPUs = entry.CPUs
+		if entry.Memory != "" {
+			if d.limits.Memory, err = env.ParseMemorySize(entry.Memory); err != nil {
+				return nil, fmt.Errorf("environments[%d]: %w", i, err)
+			}
+		}
+		if entry.Swap != "" {
+			if d.limits.Swap, err = parseSwapSize(entry.Swap); err != nil {
+				return nil, fmt.Errorf("environments[%d]: %w", i, err)
+			}
+		}
+		declared = append(declared, d)
+	}
+	return declared, nil
+}
+
+// planApply matches the declared environments with the actual ones: those
+// missing are created, those left over are pruned, and the others are
+// checked for drift. Quarantined environments are skipped either way.
+func planApply(declared []*declaredEnv, actual []*env.Environment) []applyStep {
+	existing := make(map[string]*env.Environment, len(actual))
+	for _, e := range actual {
+		existing[e.Name] = e
+	}
+
+	var steps []applyStep
+	wanted := make(map[string]bool, len(declared))
+	for _, d := range declared {
+		wanted[d.env.Name] = true
+		s := applyStep{Environment: d.env.Name, ProjectPath: d.env.ProjectPath, Action: applyCreate, declared: d, env: d.env}
+		if e, ok := existing[d.env.Name]; ok {
+			s.Action, s.env = applyUnchanged, e
+		}
+		steps = append(steps, s)
+	}
+	for _, e := range actual {
+		if !wanted[e.Name] {
+			steps = append(steps, applyStep{Environment: e.Name, ProjectPath: e.ProjectPath, Action: applyPrune, env: e})
+		}
+	}
+
+	for i := range steps {
+		if steps[i].env.Status == env.StatusQuarantined {
+			steps[i].Action = applySkip
+			steps[i].Changes = []string{"quarantined"}
+		}
+	}
+	return steps
+}
+
+// checkDrift finds what an existing declared environment needs to match
+// its declaration, making it an update if anything. Templates and overlays
+// can't change after creation, so a difference is only warned about.
+func (a *app) checkDrift(ctx context.Context, envManager *env.Manager, s *applyStep) error {
+	if s.Action != applyUnchanged {
+		return nil
+	}
+	d, e := s.declared, s.env
+
+	if d.Overlay != (e.Driver == config.WorkspaceOverlay) {
+		a.log.Warning("%s: overlay: %t is only applied to new environments (delete it to recreate it)", e.Name, d.Overlay)
+	}
+	current := ""
+	if e.Template != nil {
+		current = e.Template.Name
+	}
+	if d.Template != current {
+		a.log.Warning("%s: template %q is only applied to new environments (it has %q)", e.Name, d.Template, current)
+	}
+
+	if e.Status != env.StatusRunning {
+		s.Changes = append(s.Changes, fmt.Sprintf("start (%s)", e.Status))
+	}
+	change, err := envManager.ProvisioningDrift(ctx, e)
+	if err != nil {
+		return fmt.Errorf("failed to check %s for changes: %w", e.Name, err)
+	}
+	if change != nil {
+		s.Changes = append(s.Changes, change.Summary()...)
+	}
+	limits, err := envManager.Limits(ctx, e.Name)
+	if err != nil {
+		return err
+	}
+	if limits != d.limits {
+		s.Changes = append(s.Changes, "resource limits: "+formatLimitChange(limits, d.limits))
+	}
+
+	if len(s.Changes) > 0 {
+		s.Action = applyUpdate
+	}
+	return nil
+}
+
+// applyStep carries out one create, update, or prune
+func (a *app) applyStep(ctx context.Context, host *config.Host, envManager *env.Manager, s *applyStep) error {
+	if s.Action == applyPrune {
+		if err := a.runHook(ctx, host, hooks.PreDelete, s.env, hooks.Context{}); err != nil {
+			return err
+		}
+		return envManager.Delete(ctx, s.Environment)
+	}
+
+	d := s.declared
+	var err error
+	if d.Workspace != "" {
+		_, err = envManager.CreateInVM(ctx, d.Workspace)
+	} else {
+		_, err = envManager.CreateFromTemplate(ctx, d.env.ProjectPath, d.template)
+	}
+	if err != nil {
+		return err
+	}
+
+	limits, err := envManager.Limits(ctx, s.Environment)
+	if err != nil {
+		return err
+	}
+	if limits == d.limits {
+		return nil
+	}
+	return envManager.SetLimits(ctx, s.Environment, d.limits)
+}
+
+// applyVerb returns the progress message for an action
+func applyVerb(action applyAction) string {
+	switch action {
+	case applyCreate:
+		return "Creating"
+	case applyUpdate:
+		return "Updating"
+	default:
+		return "Pruning"
+	}
+}
+
+// formatLimitChange describes how resource limits change, such as
+// "memory none → 4.0GiB"
+func formatLimitChange(from, to env.Limits) string {
+	var parts []string
+	if from.CPUs != to.CPUs {
+		parts = append(parts, fmt.Sprintf("cpus %s → %s", formatCPULimit(from.CPUs), formatCPULimit(to.CPUs)))
+	}
+	if from.Memory != to.Memory {
+		parts = append(parts, fmt.Sprintf("memory %s → %s", formatSizeLimit(from.Memory), formatSizeLimit(to.Memory)))
+	}
+	if from.Swap != to.Swap {
+		parts = append(parts, fmt.Sprintf("swap %s → %s", formatSizeLimit(from.Swap), formatSizeLimit(to.Swap)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatCPULimit(cpus float64) string {
+	if cpus == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%g", cpus)
+}
+
+func formatSizeLimit(size int64) string {
+	switch {
+	case size == 0:
+		return "none"
+	case size == env.NoSwap:
+		return "0"
+	default:
+		return dashboard.FormatBytes(size)
+	}
+}
+
+// printApplyPlan prints each environment with what apply does to it
+func printApplyPlan(cmd *cobra.Command, steps []applyStep) {
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ACTION\tENVIRONMENT\tPROJECT PATH\tCHANGES")
+	for _, s := range steps {
+		projectPath := s.ProjectPath
+		if projectPath == "" {
+			projectPath = "(unknown)"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Action, sanitize.Line(s.Environment), sanitize.Line(projectPath), sanitize.Line(strings.Join(s.Changes, "; ")))
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/env"
+)
+
+func TestPlanApply(t *testing.T) {
+	declare := func(name string) *declaredEnv {
+		return &declaredEnv{env: &env.Environment{Name: name, ProjectPath: "/src/" + name}}
+	}
+	declared := []*declaredEnv{declare("api-a1b2"), declare("web-c3d4"), declare("held-e5f6")}
+	actual := []*env.Environment{
+		{Name: "web-c3d4", Status: env.StatusRunning},
+		{Name: "old-0a0b", Status: env.StatusPaused},
+		{Name: "held-e5f6", Status: env.StatusQuarantined},
+		{Name: "gone-1c1d", Status: env.StatusQuarantined},
+	}
+
+	got := planApply(declared, actual)
+	want := map[string]applyAction{
+		"api-a1b2":  applyCreate,
+		"web-c3d4":  applyUnchanged,
+		"held-e5f6": applySkip,
+		"old-0a0b":  applyPrune,
+		"gone-1c1d": applySkip,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d steps, want %d: %+v", len(got), len(want), got)
+	}
+	for _, s := range got {
+		if s.Action != want[s.Environment] {
+			t.Errorf("%s: action = %s, want %s", s.Environment, s.Action, want[s.Environment])
+		}
+	}
+	if got[1].env != actual[0] {
+		t.Error("expected a declared environment that exists to be checked as it is")
+	}
+}
+
+func TestFormatLimitChange(t *testing.T) {
+	got := formatLimitChange(env.Limits{CPUs: 1}, env.Limits{CPUs: 2, Memory: 4 << 30, Swap: env.NoSwap})
+	want := "cpus 1 → 2, memory none → 4.0GiB, swap none → 0"
+	if got != want {
+		t.Errorf("formatLimitChange() = %q, want %q", got, want)
+	}
+}
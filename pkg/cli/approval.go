@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/middlendian/llima-box/pkg/approval"
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/env"
+)
+
+// requireApproval runs the approval hook from the host configuration, if
+// one is set, before a destructive operation on environments. forced is
+// whether the confirmation prompt was skipped with --force.
+func (a *app) requireApproval(ctx context.Context, host *config.Host, operation string, environments []*env.Environment, forced bool) error {
+	if host.Approval.Command == "" {
+		return nil
+	}
+
+	req := approval.Request{
+		Operation: operation,
+		Forced:    forced,
+		Args:      os.Args,
+	}
+	for _, e := range environments {
+		req.Environments = append(req.Environments, approval.Target{Name: e.Name, ProjectPath: e.ProjectPath})
+	}
+
+	a.log.Info("Waiting for approval...")
+	approver := &approval.Command{Command: host.Approval.Command, Timeout: host.Approval.Timeout}
+	if err := approver.Approve(ctx, req); err != nil {
+		if errors.Is(err, approval.ErrDenied) {
+			return err
+		}
+		return fmt.Errorf("failed to get approval: %w", err)
+	}
+
+	a.log.Success("Approved")
+	return nil
+}
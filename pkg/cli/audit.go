@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// NewAuditCommand creates the audit command.
+func NewAuditCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var vmWorkspace string
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "audit [path]",
+		Short: "Show the audit log of an environment",
+		Long: `Show every shell and command started in the environment for the specified
+project path, by 'llima-box shell', 'exec', 'run', or tools embedding them:
+when it started, how long it ran, its exit status, and the command.
+
+The audit log is kept in the VM, outside the environment, where nothing run
+in the environment can change it, and is removed with the environment.
+Commands typed in interactive shells are in the shell history instead (see
+'llima-box history'). A session without an exit status is still running or
+was cut short, e.g. by a VM crash.
+
+Examples:
+  # Review what ran in the current directory's environment
+  llima-box audit
+
+  # Show the last 20 sessions of another project's environment
+  llima-box audit ~/src/api --limit 20
+
+  # Export the audit log for a tool
+  llima-box audit --output json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runAudit(cmd, args, vmWorkspace, limit)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&vmWorkspace, "vm-workspace", "", "Show the audit log of the named VM workspace's environment")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 0, "Show only the last N sessions")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runAudit(cmd *cobra.Command, args []string, vmWorkspace string, limit int) error {
+	if vmWorkspace != "" && len(args) > 0 {
+		return fmt.Errorf("a path can't be combined with --vm-workspace")
+	}
+	if limit < 0 {
+		return fmt.Errorf("--limit must not be negative")
+	}
+
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	var environment *env.Environment
+	if vmWorkspace != "" {
+		environment, err = env.VMWorkspace(vmWorkspace)
+	} else {
+		var projectPath string
+		projectPath, err = parseDeletePath(args)
+		if err != nil {
+			return err
+		}
+		environment, err = envManager.Find(ctx, projectPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	entries, err := envManager.Audit(cmd.Context(), environment.Name)
+	if err != nil {
+		return err
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	if a.json {
+		return writeJSON(cmd, entries)
+	}
+	if len(entries) == 0 {
+		a.log.Info("No sessions recorded for %s", environment.Name)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "STARTED\tDURATION\tEXIT\tKIND\tCOMMAND")
+	for _, e := range entries {
+		duration, exit := "-", "-"
+		if e.EndedAt != nil {
+			duration = e.EndedAt.Sub(e.StartedAt).String()
+		}
+		if e.ExitStatus != nil {
+			exit = fmt.Sprint(*e.ExitStatus)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			e.StartedAt.Local().Format(time.DateTime), duration, exit, sanitize.Line(e.Kind),
+			sanitize.Line(strings.Join(e.Command, " ")))
+	}
+	return w.Flush()
+}
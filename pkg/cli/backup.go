@@ -0,0 +1,249 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/dashboard"
+	"github.com/middlendian/llima-box/pkg/backup"
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// autoBackupKeep is how many backups taken by --auto-backup are kept per
+// environment
+const autoBackupKeep = 10
+
+// NewBackupCommand creates the backup command.
+func NewBackupCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var (
+		list    bool
+		tarball bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "backup [path]",
+		Short: "Back up a project directory before handing it to an agent",
+		Long: `Snapshot a project directory on the host so it can be restored with
+'llima-box restore' if an agent damages it.
+
+Snapshots are copy-on-write clones where the filesystem supports them (APFS
+on macOS, btrfs or XFS on Linux) and gzipped tarballs elsewhere. They're
+kept in the llima-box state directory (~/.local/state/llima-box/backups).
+Use 'shell --auto-backup' to take one before every session.
+
+Examples:
+  # Back up the current directory
+  llima-box backup
+
+  # List the backups of a project
+  llima-box backup --list ~/src/app`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runBackup(cmd.Context(), args, list, tarball)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVar(&list, "list", false, "List the project's backups instead of taking one")
+	cmd.Flags().BoolVar(&tarball, "tarball", false, "Write a tarball even where the directory could be cloned")
+
+	return a.bind(cmd)
+}
+
+// NewRestoreCommand creates the restore command.
+func NewRestoreCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var (
+		id    string
+		force bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "restore [path]",
+		Short: "Restore a project directory from a backup",
+		Long: `Restore a project directory from a backup taken with 'llima-box backup' or
+'shell --auto-backup'. Files changed since are rewritten and files created
+since are deleted. The current state is backed up first, so a restore can
+be undone by restoring that backup.
+
+The newest backup is used unless --id is given. Restoring requires
+confirmation. Use --force (or --yes) to skip.
+
+Examples:
+  # Undo everything since the last backup
+  llima-box restore
+
+  # Restore a specific backup (see 'llima-box backup --list')
+  llima-box restore --id 20261016-093012.482113`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runRestore(cmd.Context(), args, id, force)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&id, "id", "", "Backup to restore (default: the newest)")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Restore without confirmation")
+	addYesFlag(cmd, &force)
+
+	return a.bind(cmd)
+}
+
+// newBackupStore returns the store in the llima-box state directory
+func newBackupStore() (*backup.Store, error) {
+	dir, err := config.StateDir()
+	if err != nil {
+		return nil, err
+	}
+	return backup.NewStore(filepath.Join(dir, "backups")), nil
+}
+
+// resolveProject returns the environment for the project at the path in
+// args (default: the current directory). The VM doesn't need to be running.
+func (a *app) resolveProject(ctx context.Context, args []string) (*config.Host, *env.Environment, error) {
+	projectPath, err := parseDeletePath(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return nil, nil, err
+	}
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	environment, err := envManager.Find(ctx, projectPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return host, environment, nil
+}
+
+func (a *app) runBackup(ctx context.Context, args []string, list, tarball bool) error {
+	_, environment, err := a.resolveProject(ctx, args)
+	if err != nil {
+		return err
+	}
+	store, err := newBackupStore()
+	if err != nil {
+		return err
+	}
+
+	if list {
+		return a.listBackups(store, environment)
+	}
+
+	method := backup.MethodAuto
+	if tarball {
+		method = backup.MethodTarball
+	}
+	_, err = a.backupProject(ctx, store, environment, method, "manual")
+	return err
+}
+
+// backupProject snapshots environment's project directory
+func (a *app) backupProject(ctx context.Context, store *backup.Store, environment *env.Environment, method backup.Method, reason string) (*backup.Snapshot, error) {
+	a.log.Info("Backing up %s...", environment.ProjectPath)
+	snap, err := store.Create(ctx, environment.Name, environment.ProjectPath, method, reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up project: %w", err)
+	}
+	a.log.Success("Backed up %d files (%s) as %s (%s)", snap.Files, dashboard.FormatBytes(snap.Bytes), snap.ID, snap.Kind)
+	return snap, nil
+}
+
+// autoBackup takes the backup requested by shell --auto-backup and prunes
+// old ones
+func (a *app) autoBackup(ctx context.Context, environment *env.Environment) error {
+	store, err := newBackupStore()
+	if err != nil {
+		return err
+	}
+	if _, err := a.backupProject(ctx, store, environment, backup.MethodAuto, "auto"); err != nil {
+		return err
+	}
+	if err := store.Prune(environment.Name, "auto", autoBackupKeep); err != nil {
+		a.log.Warning("Failed to remove old backups: %v", err)
+	}
+	return nil
+}
+
+func (a *app) listBackups(store *backup.Store, environment *env.Environment) error {
+	snaps, err := store.List(environment.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+	if len(snaps) == 0 {
+		a.log.Info("No backups of %s", environment.ProjectPath)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tCREATED\tKIND\tFILES\tSIZE\tREASON")
+	_, _ = fmt.Fprintln(w, "--\t-------\t----\t-----\t----\t------")
+	for _, s := range snaps {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			s.ID, s.CreatedAt.Local().Format(time.DateTime), s.Kind, s.Files, dashboard.FormatBytes(s.Bytes), s.Reason)
+	}
+	return w.Flush()
+}
+
+func (a *app) runRestore(ctx context.Context, args []string, id string, force bool) error {
+	host, environment, err := a.resolveProject(ctx, args)
+	if err != nil {
+		return err
+	}
+	store, err := newBackupStore()
+	if err != nil {
+		return err
+	}
+
+	snap, err := store.Get(environment.Name, id)
+	if errors.Is(err, backup.ErrNotFound) && id == "" {
+		return fmt.Errorf("no backups of %s. Use 'llima-box backup' to take one", environment.ProjectPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Confirm restore
+	if !force {
+		a.log.Warning("Restore '%s' to backup %s from %s?", snap.ProjectPath, snap.ID, snap.CreatedAt.Local().Format(time.DateTime))
+		ok, err := a.confirm("Files changed since will be overwritten and files created since deleted. Continue?", false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			a.log.Info("Cancelled")
+			return nil
+		}
+	}
+
+	if err := a.requireApproval(ctx, host, "restore", []*env.Environment{environment}, force); err != nil {
+		return err
+	}
+
+	current, err := a.backupProject(ctx, store, environment, backup.MethodAuto, "pre-restore")
+	if err != nil {
+		return err
+	}
+
+	a.log.Info("Restoring %s from %s...", snap.ProjectPath, snap.ID)
+	if err := store.Restore(ctx, environment.Name, snap); err != nil {
+		return fmt.Errorf("failed to restore project: %w (the state before restoring is backup %s)", err, current.ID)
+	}
+
+	a.log.Success("Restored %s. To undo, run: llima-box restore --id %s", snap.ProjectPath, current.ID)
+	return nil
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/env"
+)
+
+// printBanner shows the guardrails of the environment an interactive shell
+// is about to enter, so the person or agent using it knows what its sandbox
+// allows. The banner is left out if they can't be read.
+func (a *app) printBanner(ctx context.Context, envManager *env.Manager, environment *env.Environment, budget config.SessionBudget) {
+	g, err := envManager.Guardrails(ctx, environment)
+	if err != nil {
+		a.log.Debug("No banner: %v", err)
+		return
+	}
+	for _, line := range formatBanner(g, budget) {
+		a.log.Plain("%s", line)
+	}
+}
+
+// formatBanner returns the lines of the banner describing g and the session
+// budget
+func formatBanner(g *env.Guardrails, budget config.SessionBudget) []string {
+	lines := []string{"llima-box environment " + g.Name}
+
+	switch g.Access {
+	case env.ProjectVMOnly:
+		lines = append(lines, fmt.Sprintf("  Project:     %s, VM workspace: no host files", g.Path))
+	case env.ProjectOverlay:
+		lines = append(lines, fmt.Sprintf("  Project:     %s, overlay: changes stay in the VM (llima-box diff)", g.Path))
+	default:
+		lines = append(lines, fmt.Sprintf("  Project:     %s, read-write: changes go to the host", g.Path))
+	}
+	if len(g.References) > 0 {
+		lines = append(lines, fmt.Sprintf("  References:  %s, read-only", strings.Join(g.References, ", ")))
+	}
+	lines = append(lines, "  Network:     shared VM network: outbound open, inbound blocked")
+
+	limits := "none"
+	if !g.Limits.IsZero() {
+		limits = fmt.Sprintf("cpus %s, memory %s, swap %s",
+			formatCPULimit(g.Limits.CPUs), formatSizeLimit(g.Limits.Memory), formatSizeLimit(g.Limits.Swap))
+	}
+	lines = append(lines, "  Limits:      "+limits)
+
+	if !budget.IsZero() {
+		var parts []string
+		if budget.MaxSession > 0 {
+			parts = append(parts, formatBudget(budget.MaxSession)+" per session")
+		}
+		if budget.MaxDaily > 0 {
+			parts = append(parts, formatBudget(budget.MaxDaily)+" per day")
+		}
+		lines = append(lines, "  Time:        "+strings.Join(parts, ", "))
+	}
+	return lines
+}
+
+// formatBudget formats a session budget without trailing zero units, such
+// as "2h" or "1h30m"
+func formatBudget(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
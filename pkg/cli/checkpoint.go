@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// NewCheckpointCommand creates the checkpoint command.
+func NewCheckpointCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var vmWorkspace string
+
+	cmd := &cobra.Command{
+		Use:   "checkpoint [path]",
+		Short: "Save an environment's running processes (experimental)",
+		Long: `Checkpoint the processes of the isolated environment for the specified
+project path with CRIU, so they can be restored later, even after the VM
+restarts, with 'llima-box restore-processes'.
+
+The processes are saved and then stopped. The environment is listed as
+checkpointed and isn't restarted after a VM restart. Resuming it with
+'llima-box resume' or 'llima-box shell' starts it afresh instead, keeping the
+checkpoint until the next one.
+
+This is experimental and needs CRIU installed in the VM. Only processes left
+running in the environment after their sessions ended, such as a
+long-running agent started with nohup, can be saved: exit open sessions
+first.
+
+Examples:
+  # Checkpoint the environment for the current directory
+  llima-box checkpoint
+
+  # Bring its processes back, e.g. after a VM restart
+  llima-box restore-processes
+
+  # Checkpoint a VM workspace's environment
+  llima-box checkpoint --vm-workspace scratch`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runCheckpoint(cmd, args, vmWorkspace, false)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&vmWorkspace, "vm-workspace", "", "Checkpoint the environment of the named VM workspace")
+
+	return a.bind(cmd)
+}
+
+// NewRestoreProcessesCommand creates the restore-processes command.
+func NewRestoreProcessesCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var vmWorkspace string
+
+	cmd := &cobra.Command{
+		Use:   "restore-processes [path]",
+		Short: "Restore processes saved with checkpoint (experimental)",
+		Long: `Restore the processes saved with 'llima-box checkpoint' for the isolated
+environment of the specified project path, in a new namespace. They continue
+where they were checkpointed, and the checkpoint is removed.
+
+The environment must not be running: if it was started again since the
+checkpoint, stop it with 'llima-box stop' first, which ends the processes
+started since.
+
+Examples:
+  # Restore the processes of the environment for the current directory
+  llima-box restore-processes
+
+  # Restore a VM workspace's environment
+  llima-box restore-processes --vm-workspace scratch`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runCheckpoint(cmd, args, vmWorkspace, true)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&vmWorkspace, "vm-workspace", "", "Restore the environment of the named VM workspace")
+
+	return a.bind(cmd)
+}
+
+// runCheckpoint checkpoints, or with restore set restores, the processes of
+// the environment for the path in args or the VM workspace
+func (a *app) runCheckpoint(cmd *cobra.Command, args []string, vmWorkspace string, restore bool) error {
+	if vmWorkspace != "" && len(args) > 0 {
+		return fmt.Errorf("a path can't be combined with --vm-workspace")
+	}
+
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	var environment *env.Environment
+	if vmWorkspace != "" {
+		environment, err = env.VMWorkspace(vmWorkspace)
+	} else {
+		var projectPath string
+		projectPath, err = parseDeletePath(args)
+		if err != nil {
+			return err
+		}
+		environment, err = envManager.Find(ctx, projectPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	out := stopOutput{Environment: environment.Name}
+	if restore {
+		a.log.Info("Restoring processes of environment %s...", environment.Name)
+		if err := envManager.RestoreProcesses(ctx, environment.Name); err != nil {
+			return fmt.Errorf("failed to restore processes: %w", err)
+		}
+		a.log.Success("Processes restored; they continue where they were checkpointed")
+		out.Status = string(env.StatusRunning)
+	} else {
+		a.log.Info("Checkpointing processes of environment %s...", environment.Name)
+		if err := envManager.CheckpointProcesses(ctx, environment.Name); err != nil {
+			return fmt.Errorf("failed to checkpoint processes: %w", err)
+		}
+		a.log.Success("Processes checkpointed and stopped; restore them with 'llima-box restore-processes'")
+		out.Status = string(env.StatusCheckpointed)
+	}
+
+	if a.json {
+		return writeJSON(cmd, out)
+	}
+	return nil
+}
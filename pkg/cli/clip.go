@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/middlendian/llima-box/internal/clipboard"
+	"github.com/spf13/cobra"
+)
+
+// NewClipCommand creates the clip command.
+func NewClipCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	cmd := &cobra.Command{
+		Use:   "clip",
+		Short: "Copy standard input to the host clipboard",
+		Long: `Copy standard input to the host clipboard.
+
+Useful for copying command output out of an environment without relying on
+terminal support:
+
+  llima-box shell -- cat build.log | llima-box clip
+
+Inside an environment shell started with --clipboard, use the in-VM helper
+instead; it sends the data to the host over the terminal (OSC 52):
+
+  git diff | llima-box-clip`,
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return a.runClip()
+		},
+		SilenceUsage: true,
+	}
+
+	return a.bind(cmd)
+}
+
+func (a *app) runClip() error {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	if err := clipboard.Write(data); err != nil {
+		return fmt.Errorf("failed to copy to clipboard: %w", err)
+	}
+
+	a.log.Success("Copied %d bytes to the clipboard", len(data))
+	return nil
+}
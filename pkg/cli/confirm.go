@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/middlendian/llima-box/internal/prompt"
+	"github.com/spf13/cobra"
+)
+
+// confirm asks a yes or no question on standard input, with def as the
+// answer to an empty line
+func (a *app) confirm(question string, def bool) (bool, error) {
+	ok, err := a.prompt().Confirm(question, def)
+	return ok, promptError(err)
+}
+
+// confirmTyped asks the user to type want to confirm the most destructive
+// operations, where answering y out of habit would cost too much
+func (a *app) confirmTyped(question, want string) (bool, error) {
+	ok, err := a.prompt().ConfirmTyped(question, want)
+	return ok, promptError(err)
+}
+
+// prompt returns the command's prompter. There's one per command, so
+// answers piped for several questions are read in turn.
+func (a *app) prompt() *prompt.Prompter {
+	if a.prompter == nil {
+		a.prompter = prompt.New(os.Stdin, a.log.Plain)
+	}
+	return a.prompter
+}
+
+// promptError explains how to skip a prompt nothing answered, such as one
+// in a script
+func promptError(err error) error {
+	if errors.Is(err, prompt.ErrNoAnswer) {
+		return fmt.Errorf("%w (use --yes to skip confirmation)", err)
+	}
+	return err
+}
+
+// addYesFlag adds --yes (-y), which skips confirmation prompts like the
+// command's --force
+func addYesFlag(cmd *cobra.Command, force *bool) {
+	cmd.Flags().BoolVarP(force, "yes", "y", false, "Answer yes to confirmation prompts (same as --force)")
+}
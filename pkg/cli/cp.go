@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/middlendian/llima-box/internal/dashboard"
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// NewCpCommand creates the cp command.
+func NewCpCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var (
+		path  string
+		quiet bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "cp <src> <dst>",
+		Short: "Copy files between the host and an environment",
+		Long: `Copy a file or directory between the host and an environment over SFTP,
+without sharing it through the project directory.
+
+Environment paths start with a colon: :<path> is in the environment for the
+current directory (or --path), relative to its project directory.
+<workspace>:<path> is in a workspace created with
+'llima-box shell --vm-workspace', relative to the workspace directory.
+Exactly one of the source and destination must be an environment path.
+
+Directories are copied recursively; symlinks inside them are copied as
+links. Files are read and written as the environment's user. Progress is
+shown when standard error is a terminal.
+
+Examples:
+  # Copy fixtures into the environment's /tmp
+  llima-box cp ./fixtures :/tmp/
+
+  # Fetch a log written outside the project directory
+  llima-box cp :/tmp/test.log .
+
+  # Copy build output out of a workspace
+  llima-box cp scratch:dist ./dist
+
+  # Seed a workspace with a source archive
+  llima-box cp ./src.tar.gz scratch:`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runCp(cmd.Context(), args[0], args[1], path, quiet)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&path, "path", "", "Project path of the environment for :<path> arguments (default: current directory)")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Don't show progress")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runCp(ctx context.Context, src, dst, path string, quiet bool) error {
+	srcWorkspace, srcPath, srcInEnv := parseWorkspacePath(src)
+	dstWorkspace, dstPath, dstInEnv := parseWorkspacePath(dst)
+	if srcInEnv == dstInEnv {
+		return fmt.Errorf("exactly one of source and destination must be an environment path (:<path> or <workspace>:<path>)")
+	}
+
+	workspace := srcWorkspace
+	if dstInEnv {
+		workspace = dstWorkspace
+	}
+
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	var environment *env.Environment
+	if workspace != "" {
+		environment, err = env.VMWorkspace(workspace)
+	} else {
+		var pathArgs []string
+		if path != "" {
+			pathArgs = []string{path}
+		}
+		projectPath, pathErr := parseDeletePath(pathArgs)
+		if pathErr != nil {
+			return pathErr
+		}
+		environment, err = envManager.Find(ctx, projectPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	exists, err := envManager.Exists(ctx, environment.Name)
+	if err != nil {
+		return fmt.Errorf("failed to check environment existence: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("environment %s does not exist. Use 'llima-box shell' to create it", environment.Name)
+	}
+
+	opts := env.CopyOptions{Recursive: true}
+	showProgress := !quiet && term.IsTerminal(int(os.Stderr.Fd()))
+	if showProgress {
+		opts.Progress = newProgressPrinter()
+	}
+
+	if srcInEnv {
+		err = envManager.CopyFrom(ctx, environment, srcPath, dst, opts)
+	} else {
+		err = envManager.CopyTo(ctx, environment, src, dstPath, opts)
+	}
+	if showProgress {
+		// End the progress line
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return err
+	}
+
+	a.log.Success("Copied %s to %s", src, dst)
+	return nil
+}
+
+// newProgressPrinter returns a progress callback showing a transfer on one
+// terminal line, redrawn when the file or percentage changes
+func newProgressPrinter() func(ssh.TransferProgress) {
+	lastPercent, lastPath := -1, ""
+	return func(p ssh.TransferProgress) {
+		percent := 100
+		if p.Total > 0 {
+			percent = int(p.Bytes * 100 / p.Total)
+		}
+		if percent == lastPercent && p.Path == lastPath {
+			return
+		}
+		lastPercent, lastPath = percent, p.Path
+		fmt.Fprintf(os.Stderr, "\r\033[K%3d%% %s / %s  %s",
+			percent, dashboard.FormatBytes(p.Bytes), dashboard.FormatBytes(p.Total), sanitize.Line(p.Path))
+	}
+}
+
+// parseWorkspacePath splits a <workspace>:<path> or :<path> argument.
+// Arguments without a colon are host paths, as are Windows paths starting
+// with a drive letter, such as C:\src.
+func parseWorkspacePath(arg string) (string, string, bool) {
+	if filepath.VolumeName(arg) != "" {
+		return "", "", false
+	}
+	workspace, path, found := strings.Cut(arg, ":")
+	if !found {
+		return "", "", false
+	}
+	return workspace, path, true
+}
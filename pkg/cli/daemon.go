@@ -0,0 +1,235 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/middlendian/llima-box/pkg/agent"
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/vm"
+	"github.com/spf13/cobra"
+)
+
+// NewDaemonCommand creates the daemon command group.
+func NewDaemonCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Manage the host agent that stops the VM before the host shuts down or sleeps",
+		Long: `Manage the llima-box host agent.
+
+The agent is an optional background service that stops the VM cleanly before
+the host sleeps or shuts down. It waits for environment creations and
+deletions in progress to finish, flushes the VM's filesystems, and stops the
+VM with limactl, so a hard poweroff doesn't leave half-written metadata and
+stale namespaces behind. The VM starts again the next time it's used.
+
+'llima-box daemon install' installs the agent as a systemd user service on
+Linux or a launchd agent on macOS, for the VM instance in use, and starts it
+now and at every login.
+
+On Linux, the agent follows systemd-logind and delays sleep and shutdown
+until the VM is stopped, for at most logind's InhibitDelayMaxSec (5 seconds
+by default; raise it in /etc/systemd/logind.conf to give the VM time to
+stop). On macOS, the agent stops the VM on logout and shutdown; sleep isn't
+detected, and the VM is suspended with the host as before.
+
+With vm.idleTimeout set in the host configuration (e.g. 30m), the agent also
+stops the VM once no environment has had processes running for that long.
+
+Examples:
+  # Install and start the agent
+  llima-box daemon install
+
+  # Remove it
+  llima-box daemon uninstall`,
+	}
+
+	cmd.AddCommand(a.bind(&cobra.Command{
+		Use:   "install",
+		Short: "Install and start the host agent",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runDaemonInstall(cmd.Context(), false)
+		},
+		SilenceUsage: true,
+	}))
+
+	cmd.AddCommand(a.bind(&cobra.Command{
+		Use:   "uninstall",
+		Short: "Stop and remove the host agent",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runDaemonInstall(cmd.Context(), true)
+		},
+		SilenceUsage: true,
+	}))
+
+	cmd.AddCommand(a.bind(&cobra.Command{
+		Use:   "run",
+		Short: "Run the host agent in the foreground, as its service does",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runDaemonRun(cmd.Context())
+		},
+		SilenceUsage: true,
+	}))
+
+	return cmd
+}
+
+// agentService returns the agent service for the VM instance in use
+func (a *app) agentService() (agent.Service, error) {
+	host, err := a.loadHost()
+	if err != nil {
+		return agent.Service{}, err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return agent.Service{}, fmt.Errorf("failed to find the llima-box executable: %w", err)
+	}
+	// Resolved so the service keeps working through package manager
+	// symlinks being replaced
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	return agent.Service{Executable: exe, Instance: host.VM.Instance, Path: os.Getenv("PATH")}, nil
+}
+
+func (a *app) runDaemonInstall(ctx context.Context, uninstall bool) error {
+	service, err := a.agentService()
+	if err != nil {
+		return err
+	}
+
+	if uninstall {
+		path, err := agent.Uninstall(ctx, service)
+		if errors.Is(err, os.ErrNotExist) {
+			a.log.Info("The host agent isn't installed")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to uninstall host agent: %w", err)
+		}
+		a.log.Success("Removed host agent %s", path)
+		return nil
+	}
+
+	path, err := agent.Install(ctx, service)
+	if err != nil {
+		return fmt.Errorf("failed to install host agent: %w", err)
+	}
+	a.log.Success("Installed host agent %s", path)
+	if !agent.DetectsSleep {
+		a.log.Warning("On this platform the agent only stops the VM on logout and shutdown; host sleep isn't detected, so the VM is suspended with the host")
+	}
+	return nil
+}
+
+func (a *app) runDaemonRun(ctx context.Context) error {
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+
+	src, err := agent.NewSource()
+	switch {
+	case err != nil:
+		a.log.Warning("%v; the VM is only stopped when the agent is", err)
+	case src == nil:
+		a.log.Info("Host sleep isn't detected on this platform; the VM is stopped on logout and shutdown")
+	}
+
+	instance := host.VM.Instance
+	if instance == "" {
+		instance = vm.DefaultInstanceName
+	}
+	a.log.Info("Host agent running for VM %s", instance)
+
+	// Host events and the idle monitor don't stop the VM at the same time
+	var stopping sync.Mutex
+	stop := func(ctx context.Context) error {
+		stopping.Lock()
+		defer stopping.Unlock()
+		return a.stopForHost(ctx, host, vmManager)
+	}
+
+	if host.VM.IdleTimeout > 0 {
+		a.log.Info("Stopping the VM after %s without active environments", host.VM.IdleTimeout)
+		monitor := &agent.IdleMonitor{
+			Timeout: host.VM.IdleTimeout,
+			Check: func(ctx context.Context) (agent.Activity, error) {
+				return a.vmActivity(ctx, host, vmManager)
+			},
+			Stop: stop,
+			Logf: a.log.Info,
+		}
+		go monitor.Run(ctx)
+	}
+
+	ag := &agent.Agent{
+		Prepare: func(ctx context.Context, _ agent.Event) error {
+			return stop(ctx)
+		},
+		Logf: a.log.Info,
+	}
+	return ag.Run(ctx, src)
+}
+
+// vmActivity reports whether the VM is running and, if it is, whether any
+// environment has processes running. It never starts the VM.
+func (a *app) vmActivity(ctx context.Context, host *config.Host, vmManager *vm.Manager) (agent.Activity, error) {
+	running, err := vmManager.IsRunning(ctx)
+	if err != nil {
+		return agent.Stopped, err
+	}
+	if !running {
+		return agent.Stopped, nil
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	usage, err := envManager.Usage(ctx)
+	if err != nil {
+		return agent.Stopped, err
+	}
+	if len(usage) > 0 {
+		return agent.Active, nil
+	}
+	return agent.Idle, nil
+}
+
+// stopForHost checkpoints the environments and stops the VM, if it's
+// running. A failed checkpoint doesn't keep the VM running: stopping it
+// cleanly is still better than the host cutting its power.
+func (a *app) stopForHost(ctx context.Context, host *config.Host, vmManager *vm.Manager) error {
+	running, err := vmManager.IsRunning(ctx)
+	if err != nil {
+		return err
+	}
+	if !running {
+		a.log.Info("The VM isn't running")
+		return nil
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	release, err := envManager.Checkpoint(ctx)
+	if err != nil {
+		a.log.Warning("Failed to checkpoint environments: %v", err)
+	} else {
+		defer release()
+	}
+
+	a.log.Info("Stopping the VM")
+	return vmManager.Stop(ctx)
+}
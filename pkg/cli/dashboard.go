@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/dashboard"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/maintenance"
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/middlendian/llima-box/pkg/vm"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// dashboardEventLines is how many lines are read from each maintenance log
+const dashboardEventLines = 5
+
+// dashboardOptions holds the dashboard command flags.
+type dashboardOptions struct {
+	interval time.Duration
+	once     bool
+}
+
+// NewDashboardCommand creates the dashboard command.
+func NewDashboardCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var opts dashboardOptions
+
+	cmd := &cobra.Command{
+		Use:   "dashboard",
+		Short: "Show live VM and environment activity",
+		Long: `Show a live view of the VM state, environments, their resource usage,
+running jobs, and recent maintenance events.
+
+The view refreshes periodically. Press q to quit or r to refresh now.
+When output isn't a terminal, or with --once, a single snapshot is printed.
+
+Examples:
+  # Watch activity across all environments
+  llima-box dashboard
+
+  # Print one snapshot
+  llima-box dashboard --once`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runDashboard(cmd.Context(), opts)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().DurationVar(&opts.interval, "interval", 2*time.Second, "Refresh interval")
+	cmd.Flags().BoolVar(&opts.once, "once", false, "Print a single snapshot and exit")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runDashboard(ctx context.Context, opts dashboardOptions) error {
+	if opts.interval < 500*time.Millisecond {
+		return fmt.Errorf("refresh interval must be at least 500ms")
+	}
+
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	collector := &dashboardCollector{envOptions: a.envOptions(host), vmManager: vmManager}
+	defer collector.close()
+
+	outFd := int(os.Stdout.Fd())
+	inFd := int(os.Stdin.Fd())
+	if opts.once || !term.IsTerminal(outFd) || !term.IsTerminal(inFd) {
+		dashboard.Render(os.Stdout, collector.collect(ctx), terminalWidth(outFd))
+		return nil
+	}
+
+	state, err := term.MakeRaw(inFd)
+	if err != nil {
+		return fmt.Errorf("failed to make terminal raw: %w", err)
+	}
+	defer func() { _ = term.Restore(inFd, state) }()
+
+	// Use the alternate screen so the dashboard doesn't clobber scrollback
+	_, _ = fmt.Fprint(os.Stdout, "\033[?1049h\033[?25l")
+	defer func() { _, _ = fmt.Fprint(os.Stdout, "\033[?25h\033[?1049l") }()
+
+	keys := make(chan byte)
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := os.Stdin.Read(buf); err != nil {
+				close(keys)
+				return
+			}
+			keys <- buf[0]
+		}
+	}()
+
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+
+	for {
+		drawDashboard(collector.collect(ctx), outFd, opts.interval)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case key, ok := <-keys:
+			// q, Ctrl-C, Ctrl-D and Esc quit; any other key refreshes
+			if !ok || key == 'q' || key == 3 || key == 4 || key == 27 {
+				return nil
+			}
+		}
+	}
+}
+
+// drawDashboard redraws the whole screen with the snapshot
+func drawDashboard(snapshot *dashboard.Snapshot, fd int, interval time.Duration) {
+	var buf bytes.Buffer
+	buf.WriteString("\033[H\033[2J")
+	dashboard.Render(&buf, snapshot, terminalWidth(fd))
+	fmt.Fprintf(&buf, "\nrefreshing every %s - q to quit, r to refresh\n", interval)
+
+	// The terminal is in raw mode, so newlines don't return the cursor
+	_, _ = os.Stdout.WriteString(strings.ReplaceAll(buf.String(), "\n", "\r\n"))
+}
+
+// terminalWidth returns the terminal width, or 0 if unknown
+func terminalWidth(fd int) int {
+	width, _, err := term.GetSize(fd)
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// dashboardCollector gathers dashboard snapshots, keeping VM connections open
+// between refreshes
+type dashboardCollector struct {
+	envOptions env.Options
+	vmManager  *vm.Manager
+	envManager *env.Manager
+	client     *ssh.Client
+}
+
+// collect gathers a snapshot. Problems are recorded in the snapshot rather
+// than returned so the dashboard keeps running while the VM changes state.
+func (c *dashboardCollector) collect(ctx context.Context) *dashboard.Snapshot {
+	s := &dashboard.Snapshot{Taken: time.Now()}
+
+	exists, err := c.vmManager.Exists(ctx)
+	if err != nil {
+		s.Errors = append(s.Errors, err.Error())
+		return s
+	}
+	if !exists {
+		return s
+	}
+
+	s.VM, err = c.vmManager.GetInstance(ctx)
+	if err != nil {
+		s.Errors = append(s.Errors, err.Error())
+		return s
+	}
+	if s.VM.Status != "Running" {
+		// Reconnect once the VM is back
+		c.close()
+		return s
+	}
+
+	if c.envManager == nil {
+		c.envManager = env.NewManagerWithOptions(c.vmManager, c.envOptions)
+	}
+	if s.Environments, err = c.envManager.List(ctx); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	if s.Usage, err = c.envManager.Usage(ctx); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+
+	if c.client == nil {
+		if c.client, err = connectVM(ctx, c.vmManager); err != nil {
+			s.Errors = append(s.Errors, err.Error())
+			return s
+		}
+	}
+	if s.Events, err = maintenance.RecentEvents(ctx, c.client, dashboardEventLines); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+
+	return s
+}
+
+// close closes the VM connections
+func (c *dashboardCollector) close() {
+	if c.envManager != nil {
+		_ = c.envManager.Close()
+		c.envManager = nil
+	}
+	if c.client != nil {
+		_ = c.client.Close()
+		c.client = nil
+	}
+}
@@ -0,0 +1,199 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/hooks"
+	"github.com/spf13/cobra"
+)
+
+// NewDeleteCommand creates the delete command.
+func NewDeleteCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var (
+		force       bool
+		vmWorkspace string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "delete [path]",
+		Short: "Delete an environment",
+		Long: `Delete an isolated environment for the specified project path.
+
+This removes the environment's user account, home directory, and namespace.
+Any processes running in the environment will be terminated.
+
+By default, prompts for confirmation before deletion. Use --force (or --yes)
+to skip. If the host configuration sets an approval hook, it must also
+approve the deletion, with or without --force. A failing preDelete hook also
+stops it.
+
+Examples:
+  # Delete environment for current directory
+  llima-box delete
+
+  # Delete environment for specific path
+  llima-box delete /path/to/project
+
+  # Delete without confirmation
+  llima-box delete --force
+
+  # Delete a VM workspace and its files
+  llima-box delete --vm-workspace scratch`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runDelete(cmd, args, force, vmWorkspace)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Delete without confirmation")
+	addYesFlag(cmd, &force)
+	cmd.Flags().StringVar(&vmWorkspace, "vm-workspace", "", "Delete the environment of the named VM workspace, including its files")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runDelete(cmd *cobra.Command, args []string, force bool, vmWorkspace string) error {
+	if vmWorkspace != "" && len(args) > 0 {
+		return fmt.Errorf("a path can't be combined with --vm-workspace")
+	}
+
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+
+	// Check if VM exists
+	exists, err := vmManager.Exists(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check VM existence: %w", err)
+	}
+
+	if !exists {
+		return fmt.Errorf("VM does not exist (no environments to delete)")
+	}
+
+	// Check if VM is running
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	var environment *env.Environment
+	if vmWorkspace != "" {
+		environment, err = env.VMWorkspace(vmWorkspace)
+	} else {
+		// Parse path
+		var projectPath string
+		projectPath, err = parseDeletePath(args)
+		if err != nil {
+			return err
+		}
+		environment, err = envManager.Find(ctx, projectPath)
+	}
+	if err != nil {
+		return err
+	}
+	projectPath, envName := environment.ProjectPath, environment.Name
+
+	// Check if environment exists
+	envExists, err := envManager.Exists(ctx, envName)
+	if err != nil {
+		return fmt.Errorf("failed to check environment existence: %w", err)
+	}
+
+	if !envExists {
+		return fmt.Errorf("environment %s does not exist", envName)
+	}
+
+	// Confirm deletion
+	if !force && a.json {
+		return errJSONNeedsForce
+	}
+	if !force {
+		a.log.Warning("Delete environment '%s' for project '%s'?", envName, projectPath)
+		ok, err := a.confirm("This will terminate all processes and remove all data. Continue?", false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			a.log.Info("Cancelled")
+			return nil
+		}
+	}
+
+	if err := a.requireApproval(ctx, host, "delete", []*env.Environment{environment}, force); err != nil {
+		return err
+	}
+	if err := a.runHook(ctx, host, hooks.PreDelete, environment, hooks.Context{}); err != nil {
+		return err
+	}
+
+	// Delete environment
+	a.log.Info("Deleting environment %s...", envName)
+	if err := envManager.Delete(ctx, envName); err != nil {
+		return fmt.Errorf("failed to delete environment: %w", err)
+	}
+
+	a.log.Success("Environment deleted successfully")
+
+	if a.json {
+		return writeJSON(cmd, deleteOutput{Deleted: []string{envName}})
+	}
+	return nil
+}
+
+// errJSONNeedsForce is returned for deletions that would prompt for
+// confirmation with --output json, where no one is there to answer
+var errJSONNeedsForce = errors.New("--output json needs --force, since there's no one to confirm the deletion")
+
+// deleteOutput is what delete and delete-all print with --output json
+type deleteOutput struct {
+	// Deleted lists the environments deleted, or with DryRun, those that
+	// would have been
+	Deleted []string `json:"deleted"`
+
+	// Failed lists the environments that couldn't be deleted
+	Failed []deleteFailure `json:"failed,omitempty"`
+
+	// DryRun is set when nothing was deleted
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// deleteFailure is an environment in deleteOutput that couldn't be deleted
+type deleteFailure struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// parseDeletePath parses the delete command path argument.
+func parseDeletePath(args []string) (string, error) {
+	var projectPath string
+
+	if len(args) == 0 {
+		// Use current directory
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to get current directory: %w", err)
+		}
+		projectPath = cwd
+	} else {
+		projectPath = args[0]
+	}
+
+	// Make path absolute
+	absPath, err := filepath.Abs(projectPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+
+	return absPath, nil
+}
@@ -0,0 +1,232 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/middlendian/llima-box/internal/dashboard"
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/hooks"
+	"github.com/spf13/cobra"
+)
+
+// NewDeleteAllCommand creates the delete-all command.
+func NewDeleteAllCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var force, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "delete-all",
+		Short: "Delete all environments",
+		Long: `Delete all isolated environments in the VM.
+
+This removes all environment user accounts, home directories, and namespaces.
+Any processes running in the environments will be terminated.
+
+Before asking for confirmation, shows what would be removed: each
+environment's processes and the disk space its home directory, state, and
+workspace take up. Use --dry-run to only show this.
+
+By default, asks you to type the VM's name to confirm the deletion. Use
+--force (or --yes) to skip. If the host configuration sets an approval hook, it must also approve the
+deletion, with or without --force. Environments whose preDelete hook fails
+are kept.
+
+WARNING: This cannot be undone!
+
+Examples:
+  # See what would be deleted
+  llima-box delete-all --dry-run
+
+  # Delete all environments (confirmed by typing the VM's name)
+  llima-box delete-all
+
+  # Delete all environments without confirmation
+  llima-box delete-all --force`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runDeleteAll(cmd, args, force, dryRun)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Delete without confirmation")
+	addYesFlag(cmd, &force)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be deleted without deleting anything")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runDeleteAll(cmd *cobra.Command, _ []string, force, dryRun bool) error {
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+
+	// Check if VM exists
+	exists, err := vmManager.Exists(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check VM existence: %w", err)
+	}
+
+	if !exists {
+		a.log.Info("No VM exists. Nothing to delete.")
+		if a.json {
+			return writeJSON(cmd, deleteOutput{Deleted: []string{}, DryRun: dryRun})
+		}
+		return nil
+	}
+
+	// Check if VM is running
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	// List environments
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	environments, err := envManager.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	if len(environments) == 0 {
+		a.log.Info("No environments to delete.")
+		if a.json {
+			return writeJSON(cmd, deleteOutput{Deleted: []string{}, DryRun: dryRun})
+		}
+		return nil
+	}
+
+	// Show what would be removed. The plan is a table, so it's left out of
+	// JSON output, which lists the environments instead.
+	if !a.json {
+		a.printDeletionPlan(ctx, envManager, environments)
+	}
+
+	if dryRun {
+		a.log.Info("Dry run: nothing was deleted")
+		if a.json {
+			out := deleteOutput{DryRun: true}
+			for _, e := range environments {
+				out.Deleted = append(out.Deleted, e.Name)
+			}
+			return writeJSON(cmd, out)
+		}
+		return nil
+	}
+
+	// Confirm deletion
+	if !force && a.json {
+		return errJSONNeedsForce
+	}
+	if !force {
+		a.log.Warning("Delete ALL %d environment(s) in VM %s?", len(environments), vmManager.GetInstanceName())
+		ok, err := a.confirmTyped("This will terminate all processes and remove all data.", vmManager.GetInstanceName())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			a.log.Info("Cancelled")
+			return nil
+		}
+	}
+
+	if err := a.requireApproval(ctx, host, "delete-all", environments, force); err != nil {
+		return err
+	}
+
+	// Delete all environments
+	a.log.Info("Deleting environments...")
+	successCount := 0
+	failCount := 0
+	out := deleteOutput{Deleted: []string{}}
+
+	for _, e := range environments {
+		a.log.Plain("  Deleting %s... ", e.Name)
+		err := a.runHook(ctx, host, hooks.PreDelete, e, hooks.Context{})
+		if err == nil {
+			err = envManager.Delete(ctx, e.Name)
+		}
+		if err != nil {
+			a.log.Error("FAILED: %v", err)
+			failCount++
+			out.Failed = append(out.Failed, deleteFailure{Name: e.Name, Error: err.Error()})
+		} else {
+			a.log.Success("OK")
+			successCount++
+			out.Deleted = append(out.Deleted, e.Name)
+		}
+	}
+
+	a.log.Plain("\nDeleted %d of %d environment(s)", successCount, len(environments))
+	if a.json {
+		if err := writeJSON(cmd, out); err != nil {
+			return err
+		}
+	}
+	if failCount > 0 {
+		a.log.Warning("%d failed", failCount)
+		return fmt.Errorf("failed to delete %d environment(s)", failCount)
+	}
+
+	return nil
+}
+
+// printDeletionPlan prints each environment with the processes that deleting
+// it would kill and the disk space it would free, followed by totals.
+// Usage that can't be measured is reported as unknown rather than stopping
+// the deletion.
+func (a *app) printDeletionPlan(ctx context.Context, envManager *env.Manager, environments []*env.Environment) {
+	usage, err := envManager.Usage(ctx)
+	if err != nil {
+		a.log.Warning("Failed to get process usage: %v", err)
+	}
+	disk, err := envManager.DiskUsage(ctx, environments)
+	if err != nil {
+		a.log.Warning("Failed to get disk usage: %v", err)
+	}
+
+	a.log.Info("Found %d environment(s):", len(environments))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ENVIRONMENT\tSTATUS\tPROCESSES\tDISK\tPROJECT PATH")
+
+	var totalProcs int
+	var totalKB int64
+	for _, e := range environments {
+		projectPath := e.ProjectPath
+		if projectPath == "" {
+			projectPath = "(unknown)"
+		}
+
+		procs := "unknown"
+		if usage != nil {
+			n := 0
+			if u := usage[e.Name]; u != nil {
+				n = len(u.Processes)
+			}
+			procs = strconv.Itoa(n)
+			totalProcs += n
+		}
+
+		size := "unknown"
+		if kb, ok := disk[e.Name]; ok {
+			size = dashboard.FormatBytes(kb * 1024)
+			totalKB += kb
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", sanitize.Line(e.Name), e.Status, procs, size, sanitize.Line(projectPath))
+	}
+	_ = w.Flush()
+
+	a.log.Plain("\nDeleting removes %d user account(s) and their data, kills %d process(es), and frees about %s",
+		len(environments), totalProcs, dashboard.FormatBytes(totalKB*1024))
+	a.log.Plain("")
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"github.com/middlendian/llima-box/internal/log"
+	"github.com/middlendian/llima-box/internal/prompt"
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// Logger receives the progress messages, warnings, and prompts commands
+// write for the user. Output meant for scripts, such as tables and JSON,
+// goes to standard output instead.
+type Logger interface {
+	Info(format string, args ...interface{})
+	Success(format string, args ...interface{})
+	Warning(format string, args ...interface{})
+	Error(format string, args ...interface{})
+	Debug(format string, args ...interface{})
+
+	// Plain writes a message without a prefix, such as a confirmation
+	// prompt
+	Plain(format string, args ...interface{})
+}
+
+// Provider returns the manager of the VM that environments run in, for a
+// host configuration
+type Provider func(host *config.Host) *vm.Manager
+
+// Deps are the dependencies of the commands. Zero fields use llima-box's
+// own: a colored logger on standard error, the host configuration file, and
+// DefaultProvider.
+type Deps struct {
+	// Logger receives messages for the user. Messages often include names
+	// and paths read from the VM; the default logger escapes control
+	// characters in them, and replacements should too.
+	Logger Logger
+
+	// Config loads the host configuration
+	Config func() (*config.Host, error)
+
+	// Provider returns the VM manager for the host configuration
+	Provider Provider
+}
+
+// app holds the dependencies shared by a command's implementation
+type app struct {
+	log      Logger
+	config   func() (*config.Host, error)
+	provider Provider
+
+	// defaultLog is set when log is llima-box's own logger, which --output
+	// json replaces
+	defaultLog bool
+
+	// json is set by --output json
+	json bool
+
+	// instance is the VM instance from --instance, if given
+	instance string
+
+	// noWait is set by --no-wait: environment setup fails with env.ErrBusy
+	// instead of waiting for another llima-box process
+	noWait bool
+
+	// allowSynced is set by --allow-synced: new environments may have
+	// their project in a cloud-synced folder
+	allowSynced bool
+
+	// prompter asks for confirmations; see prompt
+	prompter *prompt.Prompter
+}
+
+// newApp fills in the defaults for deps
+func newApp(deps Deps) *app {
+	a := &app{log: deps.Logger, config: deps.Config, provider: deps.Provider}
+	if a.log == nil {
+		a.log, a.defaultLog = log.New(), true
+	}
+	if a.config == nil {
+		a.config = config.LoadHost
+	}
+	if a.provider == nil {
+		a.provider = DefaultProvider
+	}
+	return a
+}
+
+// loadHost loads the host configuration, with the VM instance from
+// --instance if it was given
+func (a *app) loadHost() (*config.Host, error) {
+	host, err := a.config()
+	if err != nil || a.instance == "" {
+		return host, err
+	}
+	// Copied so a configuration shared through Deps isn't changed
+	h := *host
+	h.VM.Instance = a.instance
+	return &h, nil
+}
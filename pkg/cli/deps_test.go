@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/vm"
+	"github.com/spf13/cobra"
+)
+
+func TestNewApp_Defaults(t *testing.T) {
+	a := newApp(Deps{})
+	if a.log == nil || a.config == nil || a.provider == nil {
+		t.Fatalf("expected defaults for every dependency, got %+v", a)
+	}
+}
+
+func TestCommands_UseInjectedDeps(t *testing.T) {
+	errConfig := errors.New("no config here")
+	var provided bool
+	deps := Deps{
+		Config: func() (*config.Host, error) { return nil, errConfig },
+		Provider: func(host *config.Host) *vm.Manager {
+			provided = true
+			return DefaultProvider(host)
+		},
+	}
+
+	root := &cobra.Command{Use: "tool", SilenceErrors: true}
+	box := &cobra.Command{Use: "box"}
+	box.AddCommand(NewListCommand(deps), NewBackupCommand(deps))
+	root.AddCommand(box)
+
+	for _, args := range [][]string{{"box", "list"}, {"box", "backup", "--list"}} {
+		root.SetArgs(args)
+		if err := root.ExecuteContext(t.Context()); !errors.Is(err, errConfig) {
+			t.Errorf("%v: expected the injected config error, got: %v", args, err)
+		}
+	}
+	if provided {
+		t.Error("expected no VM to be provided without a configuration")
+	}
+}
+
+func TestEnvOptions_LogProgress(t *testing.T) {
+	logger := &recordingLogger{}
+	a := newApp(Deps{Logger: logger})
+
+	opts := a.envOptions(&config.Host{})
+	opts.Progress(env.Event{Level: env.EventWarning, Environment: "app-a1b2", Message: "failed to update hostnames"})
+	if !logger.contains("failed to update hostnames") {
+		t.Errorf("expected environment manager events in the app's log, got %v", logger.messages)
+	}
+}
@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// NewDiffCommand creates the diff command.
+func NewDiffCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var patch bool
+
+	cmd := &cobra.Command{
+		Use:   "diff [path]",
+		Short: "List the files an overlay environment changed",
+		Long: `List the files the environment for the specified project path changed
+compared to the host project. Only environments created with
+'llima-box shell --overlay' keep their changes apart from the host project.
+
+Each file is listed with A (added), M (modified), or D (deleted), followed
+by a summary. Use --patch for a unified diff of the changes instead, which
+'git apply' can apply to the host project. On a terminal, the output is
+colored. Use 'llima-box discard' to throw the changes away.
+
+Examples:
+  # List what the current directory's environment changed
+  llima-box diff
+
+  # Review the changes line by line
+  llima-box diff --patch | less -R
+
+  # Keep the agent's changes in the host project
+  llima-box diff --patch | git apply
+
+  # List the changes of another project's environment as JSON
+  llima-box diff ~/src/api --output json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runDiff(cmd, args, patch)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVarP(&patch, "patch", "p", false, "Show the changes as a unified diff")
+
+	return a.bind(cmd)
+}
+
+// errJSONPatch is returned for diff --patch with --output json; the patch is
+// meant for people and for 'git apply'
+var errJSONPatch = errors.New("--patch can't be used with --output json")
+
+func (a *app) runDiff(cmd *cobra.Command, args []string, patch bool) error {
+	if patch && a.json {
+		return errJSONPatch
+	}
+
+	projectPath, err := parseDeletePath(args)
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	environment, err := envManager.Find(ctx, projectPath)
+	if err != nil {
+		return err
+	}
+	changes, err := envManager.Changes(ctx, environment)
+	if err != nil {
+		return err
+	}
+
+	if a.json {
+		if changes == nil {
+			changes = []env.Change{}
+		}
+		return writeJSON(cmd, changes)
+	}
+	if len(changes) == 0 {
+		a.log.Info("No changes in %s", environment.Name)
+		return nil
+	}
+
+	w := cmd.OutOrStdout()
+	color := isTerminalWriter(w)
+	if patch {
+		diff, err := envManager.Patch(ctx, environment, changes)
+		if err != nil {
+			return err
+		}
+		writePatch(w, diff, color)
+		return nil
+	}
+	for _, c := range changes {
+		_, _ = fmt.Fprintf(w, "%s %s\n", colorize(changeColor(c.Kind), changeLetter(c.Kind), color), sanitize.Line(c.Path))
+	}
+	_, _ = fmt.Fprintln(w, changeSummary(changes, color))
+	return nil
+}
+
+// ANSI colors of diff's output on terminals
+const (
+	diffReset  = "\033[0m"
+	diffBold   = "\033[1m"
+	diffRed    = "\033[31m"
+	diffGreen  = "\033[32m"
+	diffYellow = "\033[33m"
+	diffCyan   = "\033[36m"
+)
+
+// isTerminalWriter reports whether w is a terminal
+func isTerminalWriter(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// colorize wraps s in color if enabled
+func colorize(color, s string, enabled bool) string {
+	if !enabled {
+		return s
+	}
+	return color + s + diffReset
+}
+
+// changeColor returns the color a change is listed in
+func changeColor(kind env.ChangeKind) string {
+	switch kind {
+	case env.ChangeAdded:
+		return diffGreen
+	case env.ChangeDeleted:
+		return diffRed
+	default:
+		return diffYellow
+	}
+}
+
+// changeSummary returns the line counting changes by kind, such as
+// "3 files changed: 1 added, 1 modified, 1 deleted"
+func changeSummary(changes []env.Change, color bool) string {
+	counts := make(map[env.ChangeKind]int)
+	for _, c := range changes {
+		counts[c.Kind]++
+	}
+	var parts []string
+	for _, kind := range []env.ChangeKind{env.ChangeAdded, env.ChangeModified, env.ChangeDeleted} {
+		if counts[kind] > 0 {
+			parts = append(parts, colorize(changeColor(kind), fmt.Sprintf("%d %s", counts[kind], kind), color))
+		}
+	}
+	files := "files"
+	if len(changes) == 1 {
+		files = "file"
+	}
+	return fmt.Sprintf("%d %s changed: %s", len(changes), files, strings.Join(parts, ", "))
+}
+
+// writePatch writes a unified diff to w. On a terminal, its lines are
+// colored, and escaped since they come from the environment's files;
+// otherwise it's written as it is, so it can be applied.
+func writePatch(w io.Writer, patch string, color bool) {
+	if !color {
+		_, _ = io.WriteString(w, patch)
+		return
+	}
+	for _, line := range strings.SplitAfter(patch, "\n") {
+		if line == "" {
+			continue
+		}
+		text := sanitize.Text(strings.TrimSuffix(line, "\n"))
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			text = colorize(diffBold, text, true)
+		case strings.HasPrefix(line, "+"):
+			text = colorize(diffGreen, text, true)
+		case strings.HasPrefix(line, "-"):
+			text = colorize(diffRed, text, true)
+		case strings.HasPrefix(line, "@@"):
+			text = colorize(diffCyan, text, true)
+		}
+		_, _ = fmt.Fprintln(w, text)
+	}
+}
+
+// changeLetter returns the one-letter code diff lists a change with
+func changeLetter(kind env.ChangeKind) string {
+	return strings.ToUpper(string(kind)[:1])
+}
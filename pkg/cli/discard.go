@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// NewDiscardCommand creates the discard command.
+func NewDiscardCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "discard [path]",
+		Short: "Throw away the changes of an overlay environment",
+		Long: `Throw away every change the environment for the specified project path
+made to its overlay, so it sees the host project as it is again. Only
+environments created with 'llima-box shell --overlay' have an overlay; the
+host project isn't touched. Processes running in the environment are ended.
+
+By default, prompts for confirmation first. Use --force (or --yes) to skip.
+If the host configuration sets an approval hook, it must also approve, with
+or without --force.
+
+Examples:
+  # Review the changes, then throw them away
+  llima-box diff
+  llima-box discard
+
+  # Throw away the changes without confirmation
+  llima-box discard --force`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runDiscard(cmd, args, force)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Discard without confirmation")
+	addYesFlag(cmd, &force)
+
+	return a.bind(cmd)
+}
+
+// errJSONDiscardNeedsForce is returned for discard with --output json, where
+// no one is there to confirm it
+var errJSONDiscardNeedsForce = errors.New("--output json needs --force, since there's no one to confirm discarding the changes")
+
+func (a *app) runDiscard(cmd *cobra.Command, args []string, force bool) error {
+	projectPath, err := parseDeletePath(args)
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	environment, err := envManager.Find(ctx, projectPath)
+	if err != nil {
+		return err
+	}
+
+	// Also checks that the environment has an overlay before asking
+	changes, err := envManager.Changes(ctx, environment)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		a.log.Info("No changes in %s", environment.Name)
+		return nil
+	}
+
+	if !force && a.json {
+		return errJSONDiscardNeedsForce
+	}
+	if !force {
+		a.log.Warning("Discard %d changed file(s) in environment '%s'?", len(changes), environment.Name)
+		ok, err := a.confirm("This will terminate all processes in the environment. Continue?", false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			a.log.Info("Cancelled")
+			return nil
+		}
+	}
+
+	if err := a.requireApproval(ctx, host, "discard", []*env.Environment{environment}, force); err != nil {
+		return err
+	}
+
+	if err := envManager.Discard(ctx, environment); err != nil {
+		return fmt.Errorf("failed to discard changes: %w", err)
+	}
+	a.log.Success("Discarded %d changed file(s)", len(changes))
+	return nil
+}
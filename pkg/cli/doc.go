@@ -0,0 +1,32 @@
+// Package cli implements the llima-box commands as cobra commands that other
+// tools can mount in their own command trees.
+//
+// Each NewXxxCommand constructor takes Deps, whose zero value gives the
+// commands the llima-box binary runs. Tools embedding the commands can
+// replace the logger, where the host configuration comes from, and which VM
+// environments run in:
+//
+//	deps := cli.Deps{
+//		Config: func() (*config.Host, error) {
+//			return config.LoadHostFile("/etc/mytool/llima-box.yaml")
+//		},
+//	}
+//	box := &cobra.Command{Use: "box", Short: "Agent sandboxes"}
+//	box.AddCommand(cli.NewShellCommand(deps), cli.NewListCommand(deps))
+//	root.AddCommand(box)
+//
+// Commands take their context from cobra, so the root command should be run
+// with ExecuteContext and a context that's cancelled on interrupt. Sessions
+// restore the terminal and clean up when it's cancelled. Errors are
+// returned, not printed, and usage isn't shown for them.
+//
+// AddOutputFlag adds llima-box's --output flag to a root command, so its
+// subcommands can write JSON for tools; without it they write text.
+// AddInstanceFlag adds --instance, which picks the VM instead of vm.instance
+// in the host configuration, and AddTrustHostKeyFlag adds
+// --trust-new-hostkey, which accepts a VM's changed SSH host key.
+//
+// The constructors, Deps, Logger, Provider, DefaultProvider, AddOutputFlag,
+// AddInstanceFlag, and AddTrustHostKeyFlag are a committed API: they keep working across minor
+// releases. Flags and output follow the llima-box command line.
+package cli
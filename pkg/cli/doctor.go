@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/health"
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/middlendian/llima-box/pkg/vm"
+	"github.com/spf13/cobra"
+)
+
+// kvmCommand checks for KVM inside the VM, which nested virtualization
+// provides
+const kvmCommand = "[ -e /dev/kvm ]"
+
+// NewDoctorCommand creates the doctor command.
+func NewDoctorCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose problems with Lima, the VM, and SSH",
+		Long: `Check the host and the VM for common problems and suggest how to fix them.
+
+doctor checks that limactl is in PATH and recent enough, that Lima's SSH key
+exists, and whether an SSH agent is available for forwarding. If the VM is
+running, it runs the health checks (SSH, disk space, environment namespaces,
+including stale namespace PIDs) and checks for nested virtualization.
+
+Checks never change anything. The command exits nonzero when a check
+failed; degraded checks are worth a look but don't stop llima-box from
+working.
+
+Examples:
+  # Diagnose problems
+  llima-box doctor
+
+  # Structured results with the suggested fixes
+  llima-box doctor --output json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runDoctor(cmd)
+		},
+		SilenceUsage: true,
+	}
+
+	return a.bind(cmd)
+}
+
+// doctorCheck is a check with the fix doctor suggests for it
+type doctorCheck struct {
+	health.Check
+	Fix string `json:"fix,omitempty"`
+}
+
+// doctorOutput is what doctor prints with --output json
+type doctorOutput struct {
+	Status    health.Status `json:"status"`
+	CheckedAt time.Time     `json:"checkedAt"`
+	Checks    []doctorCheck `json:"checks"`
+}
+
+func (a *app) runDoctor(cmd *cobra.Command) error {
+	ctx, cancel := context.WithTimeout(cmd.Context(), healthTimeout)
+	defer cancel()
+
+	_, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	report := diagnose(ctx, vmManager)
+
+	instance := vmManager.GetInstanceName()
+	out := doctorOutput{Status: report.Status, CheckedAt: report.CheckedAt, Checks: []doctorCheck{}}
+	for _, c := range report.Checks {
+		out.Checks = append(out.Checks, doctorCheck{Check: c, Fix: doctorFix(c, instance)})
+	}
+
+	if a.json {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	} else {
+		printDoctor(cmd, out)
+	}
+
+	if report.Failed() {
+		return fmt.Errorf("doctor found problems")
+	}
+	return nil
+}
+
+// printDoctor prints the checks, then the fixes for those that aren't ok
+func printDoctor(cmd *cobra.Command, out doctorOutput) {
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "CHECK\tSTATUS\tMESSAGE")
+	for _, c := range out.Checks {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", c.Name, c.Status, sanitize.Line(c.Message))
+	}
+	_ = w.Flush()
+
+	first := true
+	for _, c := range out.Checks {
+		if c.Fix == "" {
+			continue
+		}
+		if first {
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), "\nSuggested fixes:")
+			first = false
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "  %s: %s\n", c.Name, c.Fix)
+	}
+	if first {
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), "\nNo problems found")
+	}
+}
+
+// diagnose runs the host checks, then the VM checks if limactl works
+func diagnose(ctx context.Context, vmManager *vm.Manager) *health.Report {
+	report := health.NewReport(time.Now())
+
+	path, err := vmManager.LimactlPath()
+	if err != nil {
+		report.Add("limactl", health.StatusFailed, "%v", err)
+		return report
+	}
+	report.Add("limactl", health.StatusOK, "%s", path)
+
+	version, err := vmManager.LimaVersion(ctx)
+	if err == nil {
+		var cmp int
+		if cmp, err = vm.CompareVersions(version, vm.MinLimaVersion); err == nil && cmp < 0 {
+			report.Add("lima-version", health.StatusFailed, "Lima %s is older than %s", version, vm.MinLimaVersion)
+		} else if err == nil {
+			report.Add("lima-version", health.StatusOK, "Lima %s", version)
+		}
+	}
+	if err != nil {
+		report.Add("lima-version", health.StatusDegraded, "%v", err)
+	}
+
+	checkSSHKeys(report, vmManager)
+
+	addVMChecks(ctx, report, vmManager, func(client *ssh.Client) {
+		if _, err := client.ExecContext(ctx, kvmCommand); err != nil {
+			report.Add("nested-virtualization", health.StatusDegraded, "not available: /dev/kvm is missing in the VM")
+		} else {
+			report.Add("nested-virtualization", health.StatusOK, "available")
+		}
+	})
+	return report
+}
+
+// checkSSHKeys checks for Lima's SSH key, which llima-box logs in with, and
+// for an SSH agent sessions can forward
+func checkSSHKeys(report *health.Report, vmManager *vm.Manager) {
+	limaHome, err := vmManager.GetLimaHome()
+	if err != nil {
+		report.Add("ssh-key", health.StatusFailed, "%v", err)
+	} else if _, err := os.Stat(ssh.UserKeyPath(limaHome)); errors.Is(err, os.ErrNotExist) {
+		report.Add("ssh-key", health.StatusDegraded, "Lima's SSH key %s doesn't exist yet", ssh.UserKeyPath(limaHome))
+	} else if err != nil {
+		report.Add("ssh-key", health.StatusFailed, "failed to read Lima's SSH key: %v", err)
+	} else {
+		report.Add("ssh-key", health.StatusOK, "%s", ssh.UserKeyPath(limaHome))
+	}
+
+	n, err := ssh.AgentKeyCount()
+	switch {
+	case err != nil:
+		report.Add("ssh-agent", health.StatusDegraded, "%v", err)
+	case n == 0:
+		report.Add("ssh-agent", health.StatusDegraded, "the SSH agent holds no keys")
+	default:
+		report.Add("ssh-agent", health.StatusOK, "%d keys available for forwarding", n)
+	}
+}
+
+// doctorFix returns how to fix a check that isn't ok, or "" if it's ok or
+// there's nothing to suggest
+func doctorFix(c health.Check, instance string) string {
+	if c.Status == health.StatusOK {
+		return ""
+	}
+
+	switch {
+	case c.Name == "limactl":
+		return "install Lima (brew install lima; see https://lima-vm.io/docs/installation/) and make sure limactl is in PATH"
+	case c.Name == "lima-version":
+		return fmt.Sprintf("upgrade Lima to %s or later (brew upgrade lima)", vm.MinLimaVersion)
+	case c.Name == "ssh-key":
+		return "Lima creates its key when it first starts a VM; run 'llima-box shell' or 'limactl start'"
+	case c.Name == "ssh-agent":
+		return "start an SSH agent and load your keys with ssh-add, so git over SSH works inside environments; ignore this if you don't need it"
+	case c.Name == "vm" && strings.Contains(c.Message, "does not exist"):
+		return "run 'llima-box shell' in a project to create the VM"
+	case c.Name == "vm":
+		return fmt.Sprintf("start the VM with 'limactl start %s', or run 'llima-box shell'", instance)
+	case c.Name == "ssh" && strings.Contains(c.Message, "host key"):
+		return fmt.Sprintf("if you recreated the VM yourself, run any command once with --%s", TrustHostKeyFlag)
+	case c.Name == "ssh":
+		return fmt.Sprintf("restart the VM: limactl stop %[1]s && limactl start %[1]s", instance)
+	case strings.HasPrefix(c.Name, "disk"):
+		return fmt.Sprintf("delete unused environments with 'llima-box delete', run 'llima-box maintenance run apt-clean', or grow the disk with 'limactl disk resize' or 'limactl edit %s --disk'", instance)
+	case c.Name == "environments":
+		return "check the VM with 'limactl shell " + instance + "'"
+	case strings.HasPrefix(c.Name, "environment:"):
+		return "run 'llima-box resume' or 'llima-box shell' in its project to restart its namespace; 'llima-box list' shows the project"
+	case c.Name == "nested-virtualization":
+		return fmt.Sprintf("only needed to run VMs or KVM inside environments; it needs an Apple M3 or later with macOS 15 (or nested KVM on Linux) and 'limactl edit %s --set .nestedVirtualization=true'", instance)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,941 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/env/templates"
+	"github.com/middlendian/llima-box/pkg/frames"
+	"github.com/middlendian/llima-box/pkg/health"
+	"github.com/middlendian/llima-box/pkg/hooks"
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/middlendian/llima-box/testing/limafake"
+	"github.com/spf13/cobra"
+)
+
+func TestMain(m *testing.M) {
+	limafake.Main()
+	os.Exit(m.Run())
+}
+
+// recordingLogger keeps the messages commands log
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) record(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Info(format string, args ...interface{})    { l.record(format, args...) }
+func (l *recordingLogger) Success(format string, args ...interface{}) { l.record(format, args...) }
+func (l *recordingLogger) Warning(format string, args ...interface{}) { l.record(format, args...) }
+func (l *recordingLogger) Error(format string, args ...interface{})   { l.record(format, args...) }
+func (l *recordingLogger) Debug(format string, args ...interface{})   { l.record(format, args...) }
+func (l *recordingLogger) Plain(format string, args ...interface{})   { l.record(format, args...) }
+
+func (l *recordingLogger) contains(substr string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, m := range l.messages {
+		if strings.Contains(m, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestE2E_List(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(h *limafake.Harness)
+		expect string
+	}{
+		{
+			name:   "no VM",
+			setup:  func(*limafake.Harness) {},
+			expect: "No VM created yet",
+		},
+		{
+			name:   "VM stopped",
+			setup:  func(h *limafake.Harness) { h.CreateInstance("llima-box", false) },
+			expect: "VM is not running",
+		},
+		{
+			name:   "no environments",
+			setup:  func(h *limafake.Harness) { h.CreateInstance("llima-box", true) },
+			expect: "No environments found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := limafake.New(t)
+			tt.setup(h)
+			logger := &recordingLogger{}
+
+			cmd := NewListCommand(Deps{Logger: logger})
+			cmd.SetArgs(nil)
+			if err := cmd.ExecuteContext(t.Context()); err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			if !logger.contains(tt.expect) {
+				t.Errorf("expected %q, got %v", tt.expect, logger.messages)
+			}
+		})
+	}
+}
+
+func TestE2E_Exec(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		wantCode int
+	}{
+		{name: "success", status: 0, wantCode: 0},
+		{name: "failure passed through", status: 3, wantCode: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := limafake.New(t)
+			h.CreateInstance("llima-box", true)
+			project := filepath.Join(os.Getenv("HOME"), "project")
+			if err := os.MkdirAll(project, 0700); err != nil {
+				t.Fatal(err)
+			}
+
+			var pty bool
+			h.Server.Handle(`make test`, func(c *limafake.Command) int {
+				pty = c.PTY
+				_, _ = io.WriteString(c.Stderr, "warning\n")
+				return tt.status
+			})
+
+			var stdout, stderr bytes.Buffer
+			cmd := NewExecCommand(Deps{Logger: &recordingLogger{}})
+			cmd.SilenceErrors = true
+			cmd.SetOut(&stdout)
+			cmd.SetErr(&stderr)
+			cmd.SetArgs([]string{project, "--", "make", "test"})
+			err := cmd.ExecuteContext(t.Context())
+
+			var exitErr *ExitError
+			switch {
+			case tt.wantCode == 0 && err != nil:
+				t.Fatalf("expected success, got %v", err)
+			case tt.wantCode != 0 && (!errors.As(err, &exitErr) || exitErr.Code != tt.wantCode):
+				t.Fatalf("expected exit status %d, got %v", tt.wantCode, err)
+			}
+			if pty {
+				t.Error("expected no PTY to be requested")
+			}
+			if stderr.String() != "warning\n" || stdout.Len() != 0 {
+				t.Errorf("expected the command's stderr on the command's error writer, got stdout %q, stderr %q", stdout.String(), stderr.String())
+			}
+		})
+	}
+}
+
+func TestE2E_History_Exec(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+	project := filepath.Join(os.Getenv("HOME"), "project")
+	if err := os.MkdirAll(project, 0700); err != nil {
+		t.Fatal(err)
+	}
+	h.Server.Handle(`make test`, func(c *limafake.Command) int {
+		_, _ = io.WriteString(c.Stdout, "ok\n")
+		_, _ = io.WriteString(c.Stderr, "FAIL: TestParse\n")
+		return 1
+	})
+
+	cmd := NewExecCommand(Deps{Logger: &recordingLogger{}})
+	cmd.SilenceErrors = true
+	cmd.SetArgs([]string{project, "--", "make", "test"})
+	var exitErr *ExitError
+	if err := cmd.ExecuteContext(t.Context()); !errors.As(err, &exitErr) {
+		t.Fatalf("expected the command's exit status, got %v", err)
+	}
+
+	root := &cobra.Command{Use: "llima-box"}
+	AddOutputFlag(root)
+	root.AddCommand(NewHistoryCommand(Deps{Logger: &recordingLogger{}}))
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetArgs([]string{"history", project, "--exec", "--output", "json"})
+	if err := root.ExecuteContext(t.Context()); err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+
+	var records []env.ExecRecord
+	if err := json.Unmarshal(out.Bytes(), &records); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", out.String(), err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected one recorded command, got %+v", records)
+	}
+	r := records[0]
+	if strings.Join(r.Command, " ") != "make test" || r.ExitStatus != 1 || !strings.Contains(r.Output, "ok\n") || !strings.Contains(r.Output, "FAIL: TestParse\n") {
+		t.Errorf("unexpected record %+v", r)
+	}
+}
+
+func TestE2E_Exec_MissingEnvironment(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+	h.Server.Respond(`^id `, "", 1)
+
+	cmd := NewExecCommand(Deps{Logger: &recordingLogger{}})
+	cmd.SilenceErrors = true
+	cmd.SetArgs([]string{os.Getenv("HOME"), "--", "true"})
+	err := cmd.ExecuteContext(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("expected a missing environment error, got %v", err)
+	}
+}
+
+func TestE2E_List_JSON(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+	h.Server.Respond(`^for d in /envs/`, "app-a1b2\trunning\t{\"projectPath\":\"/work/app\",\"step\":\"setup-done\",\"version\":2}\n", 0)
+
+	root := &cobra.Command{Use: "llima-box"}
+	AddOutputFlag(root)
+	root.AddCommand(NewListCommand(Deps{Logger: &recordingLogger{}}))
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetArgs([]string{"list", "--output", "json"})
+	if err := root.ExecuteContext(t.Context()); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+
+	var got listOutput
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", out.String(), err)
+	}
+	want := listOutput{Instance: "llima-box", VM: "running", Environments: []listEnvironment{{Name: "app-a1b2", Status: "running", ProjectPath: "/work/app"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestE2E_VMStart_JSON(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", false)
+	h.Script(limafake.Rule{Args: []string{"start"}, Stderr: "INFO[0000] Booting the VM\n"})
+
+	// Everything llima-box writes to stderr, including limactl's output,
+	// must be a JSON line
+	stderr, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stderr
+	os.Stderr = stderr
+	t.Cleanup(func() { os.Stderr = saved })
+
+	root := &cobra.Command{Use: "llima-box"}
+	AddOutputFlag(root)
+	root.AddCommand(NewVMCommand(Deps{}))
+	root.SetArgs([]string{"vm", "start", "--output", "json"})
+	if err := root.ExecuteContext(t.Context()); err != nil {
+		t.Fatalf("vm start failed: %v", err)
+	}
+
+	data, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	levels := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var event struct {
+			Level   string `json:"level"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("expected JSON lines on stderr, got %q", line)
+		}
+		levels[event.Message] = event.Level
+	}
+	for message, level := range map[string]string{
+		"Starting Lima VM instance 'llima-box'...": "info",
+		"INFO[0000] Booting the VM":                "debug",
+		"VM started":                               "success",
+	} {
+		if levels[message] != level {
+			t.Errorf("expected %q at level %s, got %v", message, level, levels)
+		}
+	}
+}
+
+func TestE2E_List_Instance(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("client-a", true)
+	h.Server.Respond(`^for d in /envs/`, "app-a1b2\trunning\t{\"projectPath\":\"/work/app\",\"step\":\"setup-done\",\"version\":2}\n", 0)
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    listOutput
+		wantErr string
+	}{
+		{
+			name: "default instance",
+			want: listOutput{Instance: "llima-box", VM: "not-created", Environments: []listEnvironment{}},
+		},
+		{
+			name: "other instance",
+			args: []string{"--instance", "client-a"},
+			want: listOutput{Instance: "client-a", VM: "running", Environments: []listEnvironment{{Name: "app-a1b2", Status: "running", ProjectPath: "/work/app"}}},
+		},
+		{
+			name:    "invalid name",
+			args:    []string{"--instance", "../x"},
+			wantErr: "invalid instance name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := &cobra.Command{Use: "llima-box"}
+			AddOutputFlag(root)
+			AddInstanceFlag(root)
+			root.AddCommand(NewListCommand(Deps{Logger: &recordingLogger{}}))
+			var out bytes.Buffer
+			root.SetOut(&out)
+			root.SetArgs(append([]string{"list", "--output", "json"}, tt.args...))
+			err := root.ExecuteContext(t.Context())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+
+			var got listOutput
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("expected JSON output, got %q: %v", out.String(), err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestE2E_HostKeyChanged(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+
+	// A key recorded for an earlier VM of the same name
+	path, err := ssh.KnownHostsPath()
+	if err != nil {
+		t.Fatalf("KnownHostsPath failed: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	old := "llima-box ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJdD7y3aLq454yWBdwLWbieU1ebz9/cu7/QEXn9OIeZJ\n"
+	if err := os.WriteFile(path, []byte(old), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(args ...string) error {
+		root := &cobra.Command{Use: "llima-box"}
+		AddTrustHostKeyFlag(root)
+		root.AddCommand(NewListCommand(Deps{Logger: &recordingLogger{}}))
+		root.SetOut(io.Discard)
+		root.SetArgs(append([]string{"list"}, args...))
+		return root.ExecuteContext(t.Context())
+	}
+
+	if err := list(); !errors.Is(err, ssh.ErrHostKeyChanged) {
+		t.Fatalf("expected ErrHostKeyChanged, got %v", err)
+	}
+	if err := list("--trust-new-hostkey"); err != nil {
+		t.Fatalf("expected the new key to be trusted, got %v", err)
+	}
+	if err := list(); err != nil {
+		t.Fatalf("expected the new key to be recorded, got %v", err)
+	}
+}
+
+func TestE2E_Status_JSON(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+	h.Server.Respond(`^cat /proc/loadavg$`, "0.50 0.25 0.10 1/100 4242\n", 0)
+	h.Server.Respond(`^cat /proc/meminfo$`, "MemTotal: 4000 kB\nMemFree: 1000 kB\nMemAvailable: 3000 kB\n", 0)
+	h.Server.Respond(`^df -Pk /`, "Filesystem 1024-blocks Used Available Capacity Mounted on\n/dev/vda1 40000 10000 30000 25% /\n", 0)
+	h.Server.Respond(`^for d in /envs/`, "app-a1b2\trunning\t{\"projectPath\":\"/work/app\",\"step\":\"setup-done\",\"version\":2}\n"+
+		"old-c3d4\tstopped\t{\"projectPath\":\"/work/old\",\"step\":\"setup-done\",\"version\":2}\n", 0)
+
+	root := &cobra.Command{Use: "llima-box"}
+	AddOutputFlag(root)
+	root.AddCommand(NewStatusCommand(Deps{Logger: &recordingLogger{}}))
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetArgs([]string{"status", "--output", "json"})
+	if err := root.ExecuteContext(t.Context()); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+
+	var got statusOutput
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", out.String(), err)
+	}
+	want := statusOutput{
+		VM:     statusVM{Name: "llima-box", Status: "running", CPUs: 4, MemoryBytes: 4 << 30, DiskBytes: 100 << 30},
+		SSH:    &statusSSH{Reachable: true},
+		Load:   &health.Load{One: 0.5, Five: 0.25, Fifteen: 0.1},
+		Memory: &statusMemory{TotalBytes: 4000 * 1024, AvailableBytes: 3000 * 1024},
+		Disks:  []statusDisk{{MountPoint: "/", SizeBytes: 40000 * 1024, AvailableBytes: 30000 * 1024}},
+		Environments: &statusEnvironments{
+			Total:    2,
+			ByStatus: map[string]int{"running": 1, "stopped": 1},
+			Environments: []listEnvironment{
+				{Name: "app-a1b2", Status: "running", ProjectPath: "/work/app"},
+				{Name: "old-c3d4", Status: "stopped", ProjectPath: "/work/old"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestE2E_Status_Stopped(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", false)
+
+	root := &cobra.Command{Use: "llima-box"}
+	AddOutputFlag(root)
+	root.AddCommand(NewStatusCommand(Deps{Logger: &recordingLogger{}}))
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetArgs([]string{"status"})
+	if err := root.ExecuteContext(t.Context()); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "vm") || !strings.Contains(out.String(), "stopped") {
+		t.Errorf("expected the VM to be shown stopped, got %q", out.String())
+	}
+	if strings.Contains(out.String(), "ssh") {
+		t.Errorf("expected no SSH row for a stopped VM, got %q", out.String())
+	}
+}
+
+func TestE2E_UnknownOutputFormat(t *testing.T) {
+	limafake.New(t)
+
+	root := &cobra.Command{Use: "llima-box", SilenceErrors: true}
+	AddOutputFlag(root)
+	root.AddCommand(NewListCommand(Deps{Logger: &recordingLogger{}}))
+	root.SetArgs([]string{"list", "--output", "yaml"})
+	err := root.ExecuteContext(t.Context())
+	if err == nil || !strings.Contains(err.Error(), `unknown output format "yaml"`) {
+		t.Fatalf("expected an unknown format error, got %v", err)
+	}
+}
+
+func TestE2E_Shell_ExitStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		signal     string
+		wantCode   int
+		wantSignal string
+	}{
+		{name: "success", status: 0, wantCode: 0},
+		{name: "failure passed through", status: 3, wantCode: 3},
+		{name: "killed by signal", signal: "KILL", wantCode: 137, wantSignal: "KILL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := limafake.New(t)
+			h.CreateInstance("llima-box", true)
+			project := filepath.Join(os.Getenv("HOME"), "project")
+			if err := os.MkdirAll(project, 0700); err != nil {
+				t.Fatal(err)
+			}
+			h.Server.Handle(`make test`, func(c *limafake.Command) int {
+				c.Signal = tt.signal
+				return tt.status
+			})
+
+			logger := &recordingLogger{}
+			cmd := NewShellCommand(Deps{Logger: logger})
+			cmd.SilenceErrors = true
+			cmd.SetArgs([]string{project, "--", "make", "test"})
+			err := cmd.ExecuteContext(t.Context())
+
+			var exitErr *ExitError
+			switch {
+			case tt.wantCode == 0 && err != nil:
+				t.Fatalf("expected success, got %v", err)
+			case tt.wantCode != 0 && (!errors.As(err, &exitErr) || exitErr.Code != tt.wantCode):
+				t.Fatalf("expected exit status %d, got %v", tt.wantCode, err)
+			}
+			if exitErr != nil && exitErr.Signal != tt.wantSignal {
+				t.Errorf("expected signal %q, got %q", tt.wantSignal, exitErr.Signal)
+			}
+			if tt.wantSignal != "" && !logger.contains("killed by signal "+tt.wantSignal) {
+				t.Errorf("expected the signal to be reported, got %v", logger.messages)
+			}
+		})
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent writes
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+func TestE2E_Shell_FramesCancel(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+	project := filepath.Join(os.Getenv("HOME"), "project")
+	if err := os.MkdirAll(project, 0700); err != nil {
+		t.Fatal(err)
+	}
+	running := make(chan struct{})
+	var once sync.Once
+	h.Server.Handle(`make test`, func(c *limafake.Command) int {
+		// Keep writing until the session is gone
+		for {
+			if _, err := io.WriteString(c.Stdout, "ok\n"); err != nil {
+				return 0
+			}
+			once.Do(func() { close(running) })
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	// The post-exec hook runs for framed runs too
+	hookLog := filepath.Join(t.TempDir(), "hooks.log")
+	configDir, err := config.ConfigDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostConfig := fmt.Sprintf("hooks:\n  postExec: 'echo \"$LLIMA_BOX_HOOK\" >> %s'\n", hookLog)
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, config.HostConfigFile), []byte(hostConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go func() {
+		<-running
+		cancel()
+	}()
+	var stdout lockedBuffer
+	cmd := NewShellCommand(Deps{Logger: &recordingLogger{}})
+	cmd.SilenceErrors = true
+	cmd.SetOut(&stdout)
+	cmd.SetArgs([]string{project, "--frames", "--", "make", "test"})
+	if err := cmd.ExecuteContext(ctx); err != nil {
+		t.Fatalf("expected the framed run to succeed, got %v", err)
+	}
+	// Output arriving late would land after the exit event
+	time.Sleep(100 * time.Millisecond)
+
+	r := frames.NewReader(bytes.NewReader(stdout.Bytes()))
+	var types []string
+	for {
+		e, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read frames: %v", err)
+		}
+		types = append(types, e.Type)
+	}
+	if len(types) < 2 || types[0] != frames.TypeStart || types[len(types)-1] != frames.TypeExit {
+		t.Fatalf("expected a start event first and the exit event last, got %v", types)
+	}
+	if n := strings.Count(strings.Join(types, " "), frames.TypeExit); n != 1 {
+		t.Errorf("expected one exit event, got %d", n)
+	}
+
+	data, err := os.ReadFile(hookLog)
+	if err != nil || string(data) != "post-exec\n" {
+		t.Errorf("expected the post-exec hook to run, got %q, %v", data, err)
+	}
+}
+
+func TestE2E_Hooks(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+	project := filepath.Join(os.Getenv("HOME"), "project")
+	if err := os.MkdirAll(project, 0700); err != nil {
+		t.Fatal(err)
+	}
+	h.Server.Respond(`make test`, "", 2)
+
+	// Each hook records its event, and pre-delete refuses
+	hookLog := filepath.Join(t.TempDir(), "hooks.log")
+	record := fmt.Sprintf(`echo "$LLIMA_BOX_HOOK $LLIMA_BOX_INSTANCE $LLIMA_BOX_EXIT_STATUS" >> %s`, hookLog)
+	configDir, err := config.ConfigDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostConfig := fmt.Sprintf("hooks:\n  preCreate: '%[1]s'\n  postCreate: '%[1]s'\n  postExec: '%[1]s'\n  preDelete: '%[1]s; exit 1'\n", record)
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, config.HostConfigFile), []byte(hostConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	shell := NewShellCommand(Deps{Logger: &recordingLogger{}})
+	shell.SilenceErrors = true
+	shell.SetArgs([]string{project, "--", "make", "test"})
+	var exitErr *ExitError
+	if err := shell.ExecuteContext(t.Context()); !errors.As(err, &exitErr) {
+		t.Fatalf("expected the command's exit status, got %v", err)
+	}
+
+	del := NewDeleteCommand(Deps{Logger: &recordingLogger{}})
+	del.SetArgs([]string{project, "--force"})
+	if err := del.ExecuteContext(t.Context()); !errors.Is(err, hooks.ErrHookFailed) {
+		t.Fatalf("expected the pre-delete hook to stop the deletion, got %v", err)
+	}
+	for _, c := range h.Server.Commands() {
+		if strings.Contains(c, "userdel") {
+			t.Errorf("expected no deletion, got %q", c)
+		}
+	}
+
+	data, err := os.ReadFile(hookLog)
+	if err != nil {
+		t.Fatalf("expected hooks to run: %v", err)
+	}
+	want := "pre-create llima-box \npost-create llima-box \npost-exec llima-box 2\npre-delete llima-box \n"
+	if string(data) != want {
+		t.Errorf("expected hooks to run in order:\n%s\ngot:\n%s", want, data)
+	}
+}
+
+func TestE2E_Shell_Template(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+	project := filepath.Join(os.Getenv("HOME"), "project")
+	if err := os.MkdirAll(project, 0700); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := templates.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := "packages: [cargo]\nenv:\n  CARGO_TERM_COLOR: always\nsetup: cargo install ripgrep\n"
+	if err := os.WriteFile(filepath.Join(dir, "rust.yaml"), []byte(tmpl), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := NewShellCommand(Deps{Logger: &recordingLogger{}})
+	cmd.SetArgs([]string{project, "--template", "rust", "--", "true"})
+	if err := cmd.ExecuteContext(t.Context()); err != nil {
+		t.Fatalf("shell failed: %v", err)
+	}
+
+	for _, want := range []string{"apt-get install -y -o DPkg::Lock::Timeout=120 'cargo'", `"template":{"name":"rust"`, "CARGO_TERM_COLOR=always", "cargo install ripgrep"} {
+		found := false
+		for _, c := range h.Server.Commands() {
+			found = found || strings.Contains(c, want)
+		}
+		if !found {
+			t.Errorf("expected a command containing %q, got %v", want, h.Server.Commands())
+		}
+	}
+
+	unknown := NewShellCommand(Deps{Logger: &recordingLogger{}})
+	unknown.SetArgs([]string{project, "--template", "cobol"})
+	if err := unknown.ExecuteContext(t.Context()); !errors.Is(err, templates.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown template, got %v", err)
+	}
+}
+
+func TestE2E_DaemonRun_StopsVM(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+	h.Server.Respond(`for d in /envs/`, "app-a1b2\trunning\t\n", 0)
+
+	// The service manager ending the agent is handled as a shutdown
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	log := &recordingLogger{}
+	daemon := NewDaemonCommand(Deps{Logger: log})
+	daemon.SetArgs([]string{"run"})
+	if err := daemon.ExecuteContext(ctx); err != nil {
+		t.Fatalf("daemon run failed: %v", err)
+	}
+
+	if status := h.Status("llima-box"); status != "Stopped" {
+		t.Errorf("expected the VM to be stopped, got %s", status)
+	}
+	synced := false
+	for _, c := range h.Server.Commands() {
+		synced = synced || c == "sudo sync"
+	}
+	if !synced {
+		t.Errorf("expected the VM's filesystems to be flushed before it stopped, got %v", h.Server.Commands())
+	}
+	if !log.contains("Ready for host shutdown") {
+		t.Errorf("expected the agent to report the shutdown, got %v", log.messages)
+	}
+}
+
+func TestE2E_Exec_All(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+	h.Server.Respond(`for d in /envs/`, "api-a1b2\trunning\t{\"projectPath\":\"/work/api\",\"isolated\":true}\n"+
+		"web-c3d4\trunning\t{\"projectPath\":\"/work/web\",\"isolated\":true}\n"+
+		"old-e5f6\tpaused\t{\"projectPath\":\"/work/old\",\"isolated\":true}\n", 0)
+	h.Server.Handle(`clear-cache`, func(c *limafake.Command) int {
+		if strings.Contains(c.Line, "web-c3d4") {
+			_, _ = io.WriteString(c.Stderr, "cache is busy\n")
+			return 2
+		}
+		_, _ = io.WriteString(c.Stdout, "cleared\n")
+		return 0
+	})
+
+	var out bytes.Buffer
+	cmd := NewExecCommand(Deps{Logger: &recordingLogger{}})
+	cmd.SilenceErrors = true
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--all", "--", "clear-cache"})
+	err := cmd.ExecuteContext(t.Context())
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 1 {
+		t.Fatalf("expected exit status 1 for the failed environment, got %v", err)
+	}
+	for _, row := range []string{`api-a1b2\s+ok\s+\S+\s+cleared`, `old-e5f6\s+skipped\s+-\s+paused`, `web-c3d4\s+exit 2\s+\S+\s+cache is busy`} {
+		if !regexp.MustCompile(`(?m)^` + row + `$`).MatchString(out.String()) {
+			t.Errorf("expected a row matching %q, got:\n%s", row, out.String())
+		}
+	}
+}
+
+func TestE2E_Exec_AllArguments(t *testing.T) {
+	limafake.New(t)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "path", args: []string{"--all", "/work/api", "--", "true"}, wantErr: "doesn't take a path"},
+		{name: "label without all", args: []string{"--label", "team=web", "--", "true"}, wantErr: "--label needs --all"},
+		{name: "invalid label", args: []string{"--all", "--label", "team", "--", "true"}, wantErr: "expected key=value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := NewExecCommand(Deps{Logger: &recordingLogger{}})
+			cmd.SilenceErrors = true
+			cmd.SetArgs(tt.args)
+			if err := cmd.ExecuteContext(t.Context()); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestE2E_Doctor(t *testing.T) {
+	tests := []struct {
+		name    string
+		running bool
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "running VM",
+			running: true,
+			want: []string{
+				`(?m)^limactl\s+ok\s+`,
+				`(?m)^lima-version\s+ok\s+Lima ` + regexp.QuoteMeta(limafake.Version) + `$`,
+				`(?m)^ssh-key\s+ok\s+`,
+				`(?m)^ssh\s+ok\s+reachable$`,
+				`(?m)^nested-virtualization\s+ok\s+available$`,
+				`(?m)^  ssh-agent: start an SSH agent`,
+			},
+		},
+		{
+			name:    "stopped VM",
+			want:    []string{`(?m)^vm\s+failed\s+VM is Stopped$`, `(?m)^  vm: start the VM with 'limactl start llima-box'`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := limafake.New(t)
+			h.CreateInstance("llima-box", tt.running)
+			t.Setenv("SSH_AUTH_SOCK", "")
+
+			var out bytes.Buffer
+			cmd := NewDoctorCommand(Deps{Logger: &recordingLogger{}})
+			cmd.SilenceErrors = true
+			cmd.SetOut(&out)
+			err := cmd.ExecuteContext(t.Context())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("doctor error = %v, want error %v", err, tt.wantErr)
+			}
+			for _, want := range tt.want {
+				if !regexp.MustCompile(want).MatchString(out.String()) {
+					t.Errorf("expected output matching %q, got:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestE2E_GC(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+	project := t.TempDir()
+	h.Server.Respond(`for d in /envs/`, fmt.Sprintf("app-a1b2\trunning\t{\"projectPath\":%q}\n", project)+
+		fmt.Sprintf("gone-c3d4\trunning\t{\"projectPath\":%q}\n", filepath.Join(project, "deleted")), 0)
+	h.Server.Respond(`^getent passwd`, "app-a1b2:/mnt/lima-llima-box-data/home/app-a1b2\ngone-c3d4:/mnt/lima-llima-box-data/home/gone-c3d4\n", 0)
+
+	var out bytes.Buffer
+	root := &cobra.Command{Use: "llima-box"}
+	AddOutputFlag(root)
+	root.AddCommand(NewGCCommand(Deps{Logger: &recordingLogger{}}))
+	root.SetOut(&out)
+	root.SetArgs([]string{"gc", "--force", "--output", "json"})
+	if err := root.ExecuteContext(t.Context()); err != nil {
+		t.Fatalf("gc failed: %v", err)
+	}
+
+	var got deleteOutput
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", out.String(), err)
+	}
+	if !reflect.DeepEqual(got.Deleted, []string{"gone-c3d4"}) || len(got.Failed) != 0 {
+		t.Errorf("expected only gone-c3d4 to be deleted, got %+v", got)
+	}
+	for _, c := range h.Server.Commands() {
+		if strings.Contains(c, "userdel") && strings.Contains(c, "app-a1b2") {
+			t.Errorf("expected app-a1b2 to be kept, ran %q", c)
+		}
+	}
+}
+
+func TestE2E_Quarantine(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+	project := filepath.Join(os.Getenv("HOME"), "project")
+	if err := os.MkdirAll(project, 0700); err != nil {
+		t.Fatal(err)
+	}
+	h.Server.Respond(`^sudo cat /envs/[^/]+/metadata.json `, fmt.Sprintf(`{"projectPath":%q,"step":"setup-done","version":2}`, project), 0)
+
+	var out bytes.Buffer
+	root := &cobra.Command{Use: "llima-box"}
+	AddOutputFlag(root)
+	root.AddCommand(NewQuarantineCommand(Deps{Logger: &recordingLogger{}}))
+	root.SetOut(&out)
+	root.SetArgs([]string{"quarantine", project, "--reason", "pushed to main", "--output", "json"})
+	if err := root.ExecuteContext(t.Context()); err != nil {
+		t.Fatalf("quarantine failed: %v", err)
+	}
+
+	var got stopOutput
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", out.String(), err)
+	}
+	if got.Status != "quarantined" {
+		t.Errorf("expected the environment to be quarantined, got %+v", got)
+	}
+
+	var froze, cutOff, recorded bool
+	for _, c := range h.Server.Commands() {
+		froze = froze || strings.Contains(c, "pkill -STOP -u "+got.Environment)
+		cutOff = cutOff || strings.Contains(c, "meta skuid "+got.Environment+" counter drop")
+		recorded = recorded || strings.Contains(c, `"quarantine":{"reason":"pushed to main"`)
+	}
+	if !froze || !cutOff || !recorded {
+		t.Errorf("expected processes frozen (%v), network cut off (%v), and the reason recorded (%v), ran %v", froze, cutOff, recorded, h.Server.Commands())
+	}
+}
+
+func TestE2E_ExportArchive(t *testing.T) {
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+	project := filepath.Join(os.Getenv("HOME"), "project")
+	if err := os.MkdirAll(project, 0700); err != nil {
+		t.Fatal(err)
+	}
+	h.Server.Respond(`^sudo cat /envs/[^/]+/metadata.json `, fmt.Sprintf(`{"projectPath":%q,"step":"setup-done","version":2}`, project), 0)
+
+	// The fake VM serves the host filesystem over SFTP, so the archive
+	// "made in the VM" is a host file
+	vmArchive := filepath.Join(t.TempDir(), "llima-box-archive.gz")
+	if err := os.WriteFile(vmArchive, []byte("archive"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	h.Server.Respond(`^h=\$\(getent passwd .* sudo tar -cf`, filepath.ToSlash(vmArchive)+"\n", 0)
+
+	output := filepath.Join(t.TempDir(), "app-env.tar.gz")
+	cmd := NewExportCommand(Deps{Logger: &recordingLogger{}})
+	cmd.SetArgs([]string{project, "--format", "tar", "-o", output})
+	if err := cmd.ExecuteContext(t.Context()); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	got, err := os.ReadFile(output)
+	if err != nil || string(got) != "archive" {
+		t.Fatalf("expected the archive to be written to %s, got %q (err %v)", output, got, err)
+	}
+
+	cmd = NewExportCommand(Deps{Logger: &recordingLogger{}})
+	cmd.SetArgs([]string{project, "--format", "tar", "-o", output})
+	if err := cmd.ExecuteContext(t.Context()); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected an existing file to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/spf13/cobra"
+)
+
+// ExitError is returned by commands whose remote command exited with a
+// non-zero status. The command's own output explains the failure, so the
+// caller should exit with Code without printing anything.
+type ExitError struct {
+	Code int
+
+	// Signal is the signal that killed the remote command, such as "KILL",
+	// if it was killed. Code is then 128 plus the signal's number, as for
+	// shells.
+	Signal string
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != "" {
+		return fmt.Sprintf("killed by signal %s", e.Signal)
+	}
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// commandExit returns the *ExitError for a remote command that reported an
+// unsuccessful exit, so the CLI exits the same way, or nil if err isn't one.
+// A killed command is reported the way a shell reports it, except for
+// interrupts and closed pipes, which explain themselves.
+func (a *app) commandExit(cmd *cobra.Command, err error) error {
+	status := ssh.ExitStatus(err)
+	if status <= 0 {
+		return nil
+	}
+	exitErr := &ExitError{Code: status}
+	var sshErr *ssh.ExitError
+	if errors.As(err, &sshErr) {
+		exitErr.Signal = sshErr.Signal
+	}
+	if exitErr.Signal != "" && exitErr.Signal != "INT" && exitErr.Signal != "PIPE" {
+		a.log.Warning("Command killed by signal %s", exitErr.Signal)
+	}
+	cmd.SilenceErrors = true
+	return exitErr
+}
+
+// NewExecCommand creates the exec command.
+func NewExecCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var (
+		opts execOptions
+		all  allOptions
+	)
+
+	cmd := &cobra.Command{
+		Use:   "exec [path] -- command [args...]",
+		Short: "Run a command in an existing environment, for scripts",
+		Long: `Run a command in the existing environment for a project without a
+terminal, for scripts and CI harnesses around agents.
+
+No PTY is allocated: the command's stdout and stderr arrive on llima-box's
+stdout and stderr, separately, and standard input is passed through. llima-box
+exits with the command's exit status. Progress messages and errors from
+llima-box itself go to stderr; if the command couldn't be run, the status is 1.
+
+Unlike 'llima-box shell', exec doesn't create the environment; run 'llima-box
+shell' in the project first.
+
+Examples:
+  # Run the tests and act on the result
+  llima-box exec -- make test || echo "tests failed"
+
+  # Capture a command's output from another project's environment
+  llima-box exec ~/src/api -- git diff > changes.patch
+
+  # Run a program directly, without a shell, passing arguments as given
+  llima-box exec --direct -- grep -rn "$PATTERN" src
+
+  # Back up the project first and show a notification when a long run ends
+  llima-box exec --auto-backup --notify -- ./run-agent.sh
+
+  # Clear a cache in every environment whose project is labeled team: payments
+  llima-box exec --all --label team=payments -- rm -rf ~/.cache/pip
+
+With --all, the command runs in every running environment, several at a
+time, or in those whose project configuration has all the --label labels.
+Output is collected and shown as one row per environment; --output json
+gives each environment's full output. llima-box exits with status 1 if the
+command failed in any environment. Environments that aren't running are
+listed and skipped.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if all.enabled {
+				if opts.autoBackup || opts.notify || opts.notifyWebhook != "" {
+					return fmt.Errorf("--auto-backup, --notify, and --notify-webhook can't be combined with --all")
+				}
+				return a.runExecAll(cmd, args, opts.direct, all)
+			}
+			if len(all.labels) > 0 {
+				return fmt.Errorf("--label needs --all")
+			}
+			return a.runExec(cmd, args, opts)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVar(&opts.direct, "direct", false, "Run the command directly instead of through a shell; arguments are passed as given")
+	cmd.Flags().BoolVar(&opts.autoBackup, "auto-backup", false, "Back up the project directory before running the command (see 'llima-box restore')")
+	addNotifyFlags(cmd, &opts.notifyOptions)
+	cmd.Flags().BoolVar(&all.enabled, "all", false, "Run the command in every running environment")
+	cmd.Flags().StringArrayVar(&all.labels, "label", nil, "With --all, only environments whose project has this label (key=value; repeatable)")
+	cmd.Flags().IntVar(&all.concurrency, "concurrency", env.DefaultFanOutConcurrency, "With --all, how many environments run the command at once")
+
+	return a.bind(cmd)
+}
+
+// execOptions holds the exec command flags used without --all.
+type execOptions struct {
+	notifyOptions
+	direct     bool
+	autoBackup bool
+}
+
+func (a *app) runExec(cmd *cobra.Command, args []string, opts execOptions) error {
+	if cmd.ArgsLenAtDash() == -1 {
+		return fmt.Errorf("no command specified; put it after '--'")
+	}
+	projectPath, command, err := parseShellArgs(cmd, args)
+	if err != nil {
+		return fmt.Errorf("failed to parse arguments: %w", err)
+	}
+	if len(command) == 0 {
+		return fmt.Errorf("no command specified after '--'")
+	}
+
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	environment, err := envManager.Find(ctx, projectPath)
+	if err != nil {
+		return err
+	}
+	exists, err := envManager.Exists(ctx, environment.Name)
+	if err != nil {
+		return fmt.Errorf("failed to check environment existence: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("environment %s does not exist. Use 'llima-box shell' to create it", environment.Name)
+	}
+
+	if opts.autoBackup {
+		if !environment.Mount().HostProject() {
+			return fmt.Errorf("--auto-backup can't be used with VM workspaces: there's no host directory to back up")
+		}
+		if err := a.autoBackup(ctx, environment); err != nil {
+			return err
+		}
+	}
+
+	sessionVars, err := a.sessionEnv(environment)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	err = envManager.EnterNamespace(ctx, environment, command, env.EnterOptions{
+		Session: ssh.SessionOptions{Stdout: cmd.OutOrStdout(), Stderr: cmd.ErrOrStderr()},
+		Budget:  host.SessionBudget(environment.ProjectPath),
+		Env:     sessionVars,
+		Exec:    opts.direct,
+	})
+	a.notifyCompletion(context.WithoutCancel(ctx), opts.notifyOptions, environment, command, started, err)
+	a.runPostExecHook(context.WithoutCancel(ctx), host, environment, command, started, err)
+	if errors.Is(err, env.ErrSessionTimeLimit) || errors.Is(err, env.ErrDailyBudgetUsed) {
+		return err
+	}
+	if exitErr := a.commandExit(cmd, err); exitErr != nil {
+		// The command reported its own failure
+		return exitErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run command: %w", err)
+	}
+	return nil
+}
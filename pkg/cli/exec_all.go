@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// allOptions are the exec flags for running a command in every environment
+type allOptions struct {
+	enabled     bool
+	labels      []string
+	concurrency int
+}
+
+// execAllOutput is what exec --all prints with --output json
+type execAllOutput struct {
+	Environments []execAllResult `json:"environments"`
+}
+
+// execAllResult is one environment's result in execAllOutput
+type execAllResult struct {
+	Name        string  `json:"name"`
+	ProjectPath string  `json:"projectPath,omitempty"`
+	ExitStatus  int     `json:"exitStatus"`
+	Duration    float64 `json:"durationSeconds"`
+	Output      string  `json:"output"`
+	Error       string  `json:"error,omitempty"`
+	Skipped     bool    `json:"skipped,omitempty"`
+}
+
+// parseLabels parses --label key=value flags
+func parseLabels(flags []string) (map[string]string, error) {
+	labels := make(map[string]string, len(flags))
+	for _, flag := range flags {
+		key, value, ok := strings.Cut(flag, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", flag)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+func (a *app) runExecAll(cmd *cobra.Command, args []string, direct bool, all allOptions) error {
+	dash := cmd.ArgsLenAtDash()
+	if dash == -1 {
+		return fmt.Errorf("no command specified; put it after '--'")
+	}
+	if dash > 0 {
+		return fmt.Errorf("--all runs in every environment and doesn't take a path")
+	}
+	command := args
+	if len(command) == 0 {
+		return fmt.Errorf("no command specified after '--'")
+	}
+	labels, err := parseLabels(all.labels)
+	if err != nil {
+		return err
+	}
+
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	results, err := envManager.ExecAll(ctx, command, env.ExecAllOptions{
+		Labels:      labels,
+		Concurrency: all.concurrency,
+		Enter:       env.EnterOptions{Exec: direct},
+		Configure: func(environment *env.Environment, opts *env.EnterOptions) error {
+			vars, err := a.sessionEnv(environment)
+			if err != nil {
+				return err
+			}
+			opts.Env = vars
+			opts.Budget = host.SessionBudget(environment.ProjectPath)
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if errors.Is(r.Err, env.ErrNotRunning) {
+			continue
+		}
+		if r.Err != nil {
+			failed++
+		}
+		// Hooks see how long the command ran in each environment
+		a.runPostExecHook(context.WithoutCancel(ctx), host, r.Environment, command, time.Now().Add(-r.Duration), r.Err)
+	}
+
+	if a.json {
+		out := execAllOutput{Environments: []execAllResult{}}
+		for _, r := range results {
+			res := execAllResult{
+				Name:        r.Environment.Name,
+				ProjectPath: r.Environment.ProjectPath,
+				ExitStatus:  r.ExitStatus,
+				Duration:    r.Duration.Seconds(),
+				Output:      r.Output,
+				Skipped:     errors.Is(r.Err, env.ErrNotRunning),
+			}
+			if r.Err != nil {
+				res.Error = r.Err.Error()
+			}
+			out.Environments = append(out.Environments, res)
+		}
+		if err := writeJSON(cmd, out); err != nil {
+			return err
+		}
+	} else {
+		printExecAllResults(cmd, results)
+	}
+
+	if failed > 0 {
+		a.log.Error("The command failed in %d of %d environments", failed, len(results))
+		cmd.SilenceErrors = true
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+// printExecAllResults prints one row per environment with the command's
+// result and the last line of its output
+func printExecAllResults(cmd *cobra.Command, results []env.ExecResult) {
+	if len(results) == 0 {
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), "No matching environments")
+		return
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ENVIRONMENT\tRESULT\tDURATION\tOUTPUT")
+	_, _ = fmt.Fprintln(w, "-----------\t------\t--------\t------")
+	for _, r := range results {
+		result := "ok"
+		duration := r.Duration.Round(100 * time.Millisecond).String()
+		detail := lastLine(r.Output)
+		switch {
+		case errors.Is(r.Err, env.ErrNotRunning):
+			result, duration = "skipped", "-"
+			detail = string(r.Environment.Status)
+		case r.ExitStatus > 0:
+			result = fmt.Sprintf("exit %d", r.ExitStatus)
+		case r.Err != nil:
+			result = "error"
+			detail = r.Err.Error()
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", sanitize.Line(r.Environment.Name), result, duration, sanitize.Line(detail))
+	}
+	_ = w.Flush()
+}
+
+// lastLine returns the last non-empty line of output
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	return lines[len(lines)-1]
+}
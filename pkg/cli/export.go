@@ -0,0 +1,236 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/export"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// exportOptions holds the export command flags.
+type exportOptions struct {
+	format      string
+	output      string
+	force       bool
+	vmWorkspace string
+}
+
+// exportFormatTar is the export format archiving the environment itself
+const exportFormatTar = "tar"
+
+// NewExportCommand creates the export command.
+func NewExportCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var opts exportOptions
+
+	cmd := &cobra.Command{
+		Use:   "export [path]",
+		Short: "Export an environment as a Dockerfile, devcontainer, or archive",
+		Long: `Export the environment for a project as a Dockerfile, devcontainer, or archive.
+
+The generated Dockerfile uses the VM's base image and packages and runs the
+toolchain install scripts from the project's .llima-box/config.yaml, so a
+setup prototyped in llima-box can be used for CI images.
+
+With --format dockerfile the Dockerfile is printed to standard output unless
+--output is given. With --format devcontainer, a Dockerfile and
+devcontainer.json are written to the --output directory (default:
+<path>/.devcontainer).
+
+With --format tar, the environment itself is archived as a .tar.gz: its
+metadata and its user's home directory, with shell history, caches, and
+tool settings, and for a VM workspace, the workspace. Project files on the
+host aren't included. The archive is written to --output, or to standard
+output if it isn't a terminal. 'llima-box import' restores it, on this
+machine or another, to move an environment or keep a backup.
+
+Examples:
+  # Print a Dockerfile for the current project
+  llima-box export --format dockerfile > Dockerfile
+
+  # Create .devcontainer/ for a project
+  llima-box export /path/to/project --format devcontainer
+
+  # Archive the current project's environment to move it to another machine
+  llima-box export --format tar -o app-env.tar.gz`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.format == exportFormatTar {
+				return a.runExportArchive(cmd, args, opts)
+			}
+			if opts.vmWorkspace != "" {
+				return fmt.Errorf("--vm-workspace needs --format tar")
+			}
+			return a.runExport(args, opts)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&opts.format, "format", export.FormatDockerfile, "Output format: dockerfile, devcontainer, or tar")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "", "Output file (dockerfile, tar) or directory (devcontainer)")
+	cmd.Flags().BoolVarP(&opts.force, "force", "f", false, "Overwrite existing files")
+	cmd.Flags().StringVar(&opts.vmWorkspace, "vm-workspace", "", "With --format tar, archive the environment of the named VM workspace")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runExport(args []string, opts exportOptions) error {
+	projectPath, err := parseDeletePath(args)
+	if err != nil {
+		return err
+	}
+
+	project, err := config.LoadProject(projectPath)
+	if err != nil {
+		return err
+	}
+
+	dockerfile, err := export.Dockerfile(projectPath, project)
+	if err != nil {
+		return fmt.Errorf("failed to generate Dockerfile: %w", err)
+	}
+
+	switch opts.format {
+	case export.FormatDockerfile:
+		if opts.output == "" {
+			_, err := fmt.Fprint(os.Stdout, dockerfile)
+			return err
+		}
+		if err := writeExportFile(opts.output, []byte(dockerfile), opts.force); err != nil {
+			return err
+		}
+		a.log.Success("Wrote %s", opts.output)
+
+	case export.FormatDevcontainer:
+		dir := opts.output
+		if dir == "" {
+			dir = filepath.Join(projectPath, ".devcontainer")
+		}
+		devcontainer, err := export.Devcontainer(projectPath)
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil { // #nosec G301 -- project directory, normally committed
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+		dockerfilePath := filepath.Join(dir, export.DockerfileName)
+		devcontainerPath := filepath.Join(dir, export.DevcontainerFile)
+		if !opts.force {
+			for _, path := range []string{dockerfilePath, devcontainerPath} {
+				if _, err := os.Stat(path); err == nil {
+					return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+				}
+			}
+		}
+		if err := writeExportFile(dockerfilePath, []byte(dockerfile), true); err != nil {
+			return err
+		}
+		if err := writeExportFile(devcontainerPath, devcontainer, true); err != nil {
+			return err
+		}
+		a.log.Success("Wrote devcontainer to %s", dir)
+
+	default:
+		return fmt.Errorf("unknown format %q (expected %s, %s, or %s)", opts.format, export.FormatDockerfile, export.FormatDevcontainer, exportFormatTar)
+	}
+
+	return nil
+}
+
+// runExportArchive writes the archive of an environment to opts.output or
+// standard output
+func (a *app) runExportArchive(cmd *cobra.Command, args []string, opts exportOptions) error {
+	if opts.vmWorkspace != "" && len(args) > 0 {
+		return fmt.Errorf("a path can't be combined with --vm-workspace")
+	}
+	if opts.output == "" && term.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("refusing to write an archive to a terminal; use --output or redirect standard output")
+	}
+
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	var environment *env.Environment
+	if opts.vmWorkspace != "" {
+		environment, err = env.VMWorkspace(opts.vmWorkspace)
+	} else {
+		var projectPath string
+		projectPath, err = parseDeletePath(args)
+		if err != nil {
+			return err
+		}
+		environment, err = envManager.Find(ctx, projectPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	w := cmd.OutOrStdout()
+	var file *os.File
+	if opts.output != "" {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if !opts.force {
+			flags |= os.O_EXCL
+		}
+		f, err := os.OpenFile(opts.output, flags, 0600) // #nosec G304 -- the user's chosen output file
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s already exists (use --force to overwrite)", opts.output)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", opts.output, err)
+		}
+		file, w = f, f
+	}
+
+	a.log.Info("Archiving environment %s...", environment.Name)
+	err = envManager.Export(cmd.Context(), environment.Name, w)
+	if file == nil {
+		if err != nil {
+			return fmt.Errorf("failed to export environment: %w", err)
+		}
+		return nil
+	}
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write %s: %w", opts.output, closeErr)
+	}
+	if err != nil {
+		_ = os.Remove(opts.output)
+		return fmt.Errorf("failed to export environment: %w", err)
+	}
+	a.log.Success("Wrote %s", opts.output)
+	return nil
+}
+
+// writeExportFile writes data to path, refusing to replace an existing file
+// unless force is set
+func writeExportFile(path string, data []byte, force bool) error {
+	if !force {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to check %s: %w", path, err)
+		}
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil { // #nosec G306 -- build files are meant to be committed
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/spf13/cobra"
+)
+
+// NewFixTerminalCommand creates the fix-terminal command. It only resets
+// the local terminal and takes Deps for uniformity.
+func NewFixTerminalCommand(_ Deps) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fix-terminal",
+		Short: "Restore the terminal after a session ended abnormally",
+		Long: `Restore sane terminal settings and turn off modes a full-screen program
+may have left on: the alternate screen, a hidden cursor, mouse reporting, and
+bracketed paste.
+
+llima-box restores the terminal itself when a session ends, even after a
+lost connection or SIGTERM. Use this when the process was killed outright
+(for example with SIGKILL) and the terminal no longer echoes input or
+handles line breaks. Typing blind works:
+
+  llima-box fix-terminal`,
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return ssh.ResetTerminal()
+		},
+		SilenceUsage: true,
+	}
+
+	return cmd
+}
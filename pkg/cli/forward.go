@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/spf13/cobra"
+)
+
+// portForward is one PORT or LISTEN:TARGET argument of the forward command
+type portForward struct {
+	listen int
+	target int
+}
+
+// NewForwardCommand creates the forward command.
+func NewForwardCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var (
+		path    string
+		reverse bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "forward PORT[:TARGET]...",
+		Short: "Forward ports between an environment and the host",
+		Long: `Forward TCP ports from an environment to the host over SSH, so a server
+running inside the environment can be reached at localhost on the host.
+
+Each argument is a port number, forwarded to the same port, or LISTEN:TARGET
+to listen on one port and connect to another. Ports listen on the host's
+loopback interface only. Forwarding runs until Ctrl-C.
+
+With --reverse, ports listen inside the VM and connect to the host instead,
+so programs in the environment can reach a service running on the host.
+
+Environments share the VM's network, so a port is the same in every
+environment.
+
+Examples:
+  # Reach a dev server on port 3000 at http://localhost:3000
+  llima-box forward 3000
+
+  # Reach the environment's port 8080 at localhost:18080
+  llima-box forward 18080:8080
+
+  # Forward for another project's environment
+  llima-box forward 5173 --path ~/src/web
+
+  # Let the environment reach a database on the host's port 5432
+  llima-box forward --reverse 5432`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runForward(cmd.Context(), args, path, reverse)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&path, "path", "", "Project path of the environment (default: current directory)")
+	cmd.Flags().BoolVar(&reverse, "reverse", false, "Listen inside the VM and connect to the host")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runForward(ctx context.Context, args []string, path string, reverse bool) error {
+	forwards := make([]portForward, len(args))
+	for i, arg := range args {
+		f, err := parsePortForward(arg)
+		if err != nil {
+			return err
+		}
+		forwards[i] = f
+	}
+
+	var pathArgs []string
+	if path != "" {
+		pathArgs = []string{path}
+	}
+	projectPath, err := parseDeletePath(pathArgs)
+	if err != nil {
+		return err
+	}
+
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	environment, err := envManager.Find(ctx, projectPath)
+	if err != nil {
+		return err
+	}
+	client, err := connectVM(ctx, vmManager)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	exists, err := envManager.Exists(ctx, environment.Name)
+	if err != nil {
+		return fmt.Errorf("failed to check environment existence: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("environment %s does not exist. Use 'llima-box shell' to create it", environment.Name)
+	}
+
+	var open []*ssh.Forward
+	defer func() {
+		for _, f := range open {
+			_ = f.Close()
+		}
+	}()
+	for _, pf := range forwards {
+		hostAddr := fmt.Sprintf("127.0.0.1:%d", pf.listen)
+		vmAddr := fmt.Sprintf("localhost:%d", pf.target)
+
+		var f *ssh.Forward
+		if reverse {
+			hostAddr = fmt.Sprintf("localhost:%d", pf.target)
+			vmAddr = fmt.Sprintf("127.0.0.1:%d", pf.listen)
+			f, err = client.ForwardRemotePort(ctx, vmAddr, hostAddr)
+		} else {
+			f, err = client.ForwardLocalPort(ctx, hostAddr, vmAddr)
+		}
+		if err != nil {
+			return err
+		}
+		open = append(open, f)
+
+		if reverse {
+			a.log.Success("Forwarding %s in %s to %s on the host", vmAddr, environment.Name, hostAddr)
+		} else {
+			a.log.Success("Forwarding %s to %s in %s", hostAddr, vmAddr, environment.Name)
+		}
+	}
+	a.log.Info("Press Ctrl-C to stop")
+
+	// A forward only stops early if it fails, for example when the
+	// connection to the VM is lost
+	errs := make(chan error, len(open))
+	for _, f := range open {
+		go func() { errs <- f.Wait() }()
+	}
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errs:
+		if err != nil {
+			return fmt.Errorf("port forwarding stopped: %w", err)
+		}
+		return nil
+	}
+}
+
+// parsePortForward parses PORT or LISTEN:TARGET
+func parsePortForward(arg string) (portForward, error) {
+	listen, target, found := strings.Cut(arg, ":")
+	if !found {
+		target = listen
+	}
+
+	l, err := parsePort(listen)
+	if err != nil {
+		return portForward{}, fmt.Errorf("invalid port forward %q: %w", arg, err)
+	}
+	t, err := parsePort(target)
+	if err != nil {
+		return portForward{}, fmt.Errorf("invalid port forward %q: %w", arg, err)
+	}
+	return portForward{listen: l, target: t}, nil
+}
+
+// parsePort parses a TCP port number
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("%q is not a port number (1-65535)", s)
+	}
+	return port, nil
+}
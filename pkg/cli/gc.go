@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/hooks"
+	"github.com/spf13/cobra"
+)
+
+// NewGCCommand creates the gc command.
+func NewGCCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var force, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Delete orphaned environments",
+		Long: `Delete environments that are no longer of use.
+
+An environment is an orphan when:
+  - its project directory on the host no longer exists
+  - its namespace keeper process died and couldn't be restarted
+  - its user account was left behind without environment state, e.g. by a
+    deletion that was cut short
+
+Orphans are deleted like with the delete command: their user accounts,
+processes, PID files, and /envs directories are removed.
+
+By default, prompts for confirmation before deletion. Use --force (or --yes)
+to skip. If the host configuration sets an approval hook, it must also
+approve the deletion, with or without --force. Environments whose preDelete
+hook fails are kept.
+
+Examples:
+  # See what would be deleted
+  llima-box gc --dry-run
+
+  # Delete orphaned environments (with confirmation)
+  llima-box gc
+
+  # Delete orphaned environments without confirmation
+  llima-box gc --force`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runGC(cmd, force, dryRun)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Delete without confirmation")
+	addYesFlag(cmd, &force)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be deleted without deleting anything")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runGC(cmd *cobra.Command, force, dryRun bool) error {
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	orphans, err := envManager.Orphans(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find orphaned environments: %w", err)
+	}
+
+	if len(orphans) == 0 {
+		a.log.Info("No orphaned environments.")
+		if a.json {
+			return writeJSON(cmd, deleteOutput{Deleted: []string{}, DryRun: dryRun})
+		}
+		return nil
+	}
+
+	if !a.json {
+		a.log.Info("Found %d orphaned environment(s):", len(orphans))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ENVIRONMENT\tREASON\tPROJECT PATH")
+		for _, o := range orphans {
+			projectPath := o.Environment.ProjectPath
+			if projectPath == "" {
+				projectPath = "(unknown)"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", sanitize.Line(o.Environment.Name), o.Reason, sanitize.Line(projectPath))
+		}
+		_ = w.Flush()
+		a.log.Plain("")
+	}
+
+	environments := make([]*env.Environment, 0, len(orphans))
+	for _, o := range orphans {
+		environments = append(environments, o.Environment)
+	}
+
+	if dryRun {
+		a.log.Info("Dry run: nothing was deleted")
+		if a.json {
+			out := deleteOutput{DryRun: true}
+			for _, e := range environments {
+				out.Deleted = append(out.Deleted, e.Name)
+			}
+			return writeJSON(cmd, out)
+		}
+		return nil
+	}
+
+	if !force && a.json {
+		return errJSONNeedsForce
+	}
+	if !force {
+		ok, err := a.confirm(fmt.Sprintf("Delete %d orphaned environment(s) and their data?", len(orphans)), false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			a.log.Info("Cancelled")
+			return nil
+		}
+	}
+
+	if err := a.requireApproval(ctx, host, "gc", environments, force); err != nil {
+		return err
+	}
+
+	out := deleteOutput{Deleted: []string{}}
+	for _, e := range environments {
+		a.log.Plain("  Deleting %s... ", e.Name)
+		err := a.runHook(ctx, host, hooks.PreDelete, e, hooks.Context{})
+		if err == nil {
+			err = envManager.Delete(ctx, e.Name)
+		}
+		if err != nil {
+			a.log.Error("FAILED: %v", err)
+			out.Failed = append(out.Failed, deleteFailure{Name: e.Name, Error: err.Error()})
+		} else {
+			a.log.Success("OK")
+			out.Deleted = append(out.Deleted, e.Name)
+		}
+	}
+
+	a.log.Plain("\nDeleted %d of %d orphaned environment(s)", len(out.Deleted), len(environments))
+	if a.json {
+		if err := writeJSON(cmd, out); err != nil {
+			return err
+		}
+	}
+	if len(out.Failed) > 0 {
+		return fmt.Errorf("failed to delete %d environment(s)", len(out.Failed))
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/health"
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/middlendian/llima-box/pkg/vm"
+	"github.com/spf13/cobra"
+)
+
+// healthTimeout bounds the checks that run inside the VM
+const healthTimeout = 30 * time.Second
+
+// probeRetry gives up on SSH quickly, since an unreachable VM is what the
+// health and status commands are there to report
+var probeRetry = ssh.RetryConfig{MaxAttempts: 2, InitialDelay: time.Second, MaxDelay: time.Second, Multiplier: 1}
+
+// dfCommand reports the space on the root filesystem and, if it's mounted,
+// the data disk
+var dfCommand = fmt.Sprintf("df -Pk / $(mountpoint -q %[1]s && echo %[1]s)", vm.DataDiskMountPoint)
+
+// NewHealthCommand creates the health command.
+func NewHealthCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "health",
+		Short: "Check the VM and environments for monitoring",
+		Long: `Check the VM, its SSH connection, the namespace of every environment, and
+free disk space, and print the results.
+
+Each check is ok, degraded, or failed. The command exits nonzero only when a
+check failed: the VM isn't running, SSH is unreachable, or a disk is nearly
+full. Environments whose namespace needs restarting are reported as
+degraded, since llima-box restarts them on the next shell.
+
+Checks never change anything, so the command is safe to run from cron or a
+monitoring agent.
+
+Examples:
+  # Human-readable summary
+  llima-box health
+
+  # Structured results for scripts
+  llima-box health --json | jq '.checks[] | select(.status != "ok")'`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runHealth(cmd.Context(), jsonOutput || a.json)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the results as JSON (same as --output json)")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runHealth(ctx context.Context, jsonOutput bool) error {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	_, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	report := checkHealth(ctx, vmManager)
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "CHECK\tSTATUS\tMESSAGE")
+		for _, c := range report.Checks {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", c.Name, c.Status, sanitize.Line(c.Message))
+		}
+		_ = w.Flush()
+	}
+
+	if report.Failed() {
+		return fmt.Errorf("health check failed")
+	}
+	return nil
+}
+
+// checkHealth runs the checks in order, skipping those that depend on a
+// check that failed
+func checkHealth(ctx context.Context, vmManager *vm.Manager) *health.Report {
+	report := health.NewReport(time.Now())
+	addVMChecks(ctx, report, vmManager, nil)
+	return report
+}
+
+// addVMChecks adds the VM, SSH, disk, and environment checks to report.
+// inVM, when set, runs further checks over the connection once SSH is
+// reachable.
+func addVMChecks(ctx context.Context, report *health.Report, vmManager *vm.Manager, inVM func(*ssh.Client)) {
+	exists, err := vmManager.Exists(ctx)
+	if err == nil && !exists {
+		report.Add("vm", health.StatusFailed, "VM does not exist")
+		return
+	}
+	var inst *vm.Instance
+	if err == nil {
+		inst, err = vmManager.GetInstance(ctx)
+	}
+	switch {
+	case err != nil:
+		report.Add("vm", health.StatusFailed, "failed to get VM status: %v", err)
+		return
+	case inst.Status != "Running":
+		report.Add("vm", health.StatusFailed, "VM is %s", inst.Status)
+		return
+	}
+	report.Add("vm", health.StatusOK, "running")
+
+	client, err := ssh.NewClientForVM(ctx, vmManager)
+	if err == nil {
+		err = client.ConnectWithRetry(probeRetry)
+	}
+	if err != nil {
+		report.Add("ssh", health.StatusFailed, "%v", err)
+		return
+	}
+	defer func() { _ = client.Close() }()
+	report.Add("ssh", health.StatusOK, "reachable")
+
+	output, err := client.ExecContext(ctx, dfCommand)
+	if err != nil {
+		report.Add("disk", health.StatusFailed, "failed to check disk space: %v", err)
+	} else if filesystems, err := health.ParseDF(output); err != nil {
+		report.Add("disk", health.StatusFailed, "%v", err)
+	} else {
+		for _, f := range filesystems {
+			report.AddDisk(f)
+		}
+	}
+
+	if environments, err := env.Scan(ctx, client); err != nil {
+		report.Add("environments", health.StatusDegraded, "%v", err)
+	} else {
+		for _, e := range environments {
+			report.AddEnvironment(e)
+		}
+	}
+
+	if inVM != nil {
+		inVM(client)
+	}
+}
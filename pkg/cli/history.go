@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// historyOptions holds the history command's flags
+type historyOptions struct {
+	exec        bool
+	full        bool
+	limit       int
+	vmWorkspace string
+}
+
+// NewHistoryCommand creates the history command.
+func NewHistoryCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var opts historyOptions
+
+	cmd := &cobra.Command{
+		Use:   "history [path]",
+		Short: "Show the commands run in an environment",
+		Long: `Show the commands run in the environment for the specified project path.
+
+Without --exec, prints the shell history of the environment's interactive
+sessions, as the shell saved it inside the environment.
+
+With --exec, lists the commands run without a terminal, by 'llima-box exec',
+'exec --all', or 'shell --frames', so automated agent runs can be
+reconstructed: when each started, how long it ran, its exit status, the
+directory it ran in, and the command. The last 16 KiB of each command's
+output is kept; --full prints it. This history is kept on the host, apart
+from the shell history, so commands run in the environment can't rewrite it,
+and it stays available after the environment is deleted. The newest 500
+to 1000 commands are kept.
+
+Examples:
+  # Show the shell history of the current directory's environment
+  llima-box history
+
+  # Show the last 20 commands agents ran with exec, with their output
+  llima-box history --exec --limit 20 --full
+
+  # Export the exec history of another project's environment for a tool
+  llima-box history ~/src/api --exec --output json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runHistory(cmd, args, opts)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVar(&opts.exec, "exec", false, "Show the commands run without a terminal instead of the shell history")
+	cmd.Flags().BoolVar(&opts.full, "full", false, "With --exec, print each command's recorded output")
+	cmd.Flags().IntVarP(&opts.limit, "limit", "n", 0, "With --exec, show only the last N commands")
+	cmd.Flags().StringVar(&opts.vmWorkspace, "vm-workspace", "", "Show the history of the named VM workspace's environment")
+
+	return a.bind(cmd)
+}
+
+// shellHistoryOutput is the history command's JSON output without --exec
+type shellHistoryOutput struct {
+	Environment string `json:"environment"`
+	History     string `json:"history"`
+}
+
+func (a *app) runHistory(cmd *cobra.Command, args []string, opts historyOptions) error {
+	if opts.vmWorkspace != "" && len(args) > 0 {
+		return fmt.Errorf("a path can't be combined with --vm-workspace")
+	}
+	if !opts.exec && (opts.full || opts.limit != 0) {
+		return fmt.Errorf("--full and --limit need --exec")
+	}
+	if opts.limit < 0 {
+		return fmt.Errorf("--limit must not be negative")
+	}
+
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	var environment *env.Environment
+	if opts.vmWorkspace != "" {
+		environment, err = env.VMWorkspace(opts.vmWorkspace)
+	} else {
+		var projectPath string
+		projectPath, err = parseDeletePath(args)
+		if err != nil {
+			return err
+		}
+		environment, err = envManager.Find(ctx, projectPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !opts.exec {
+		if err := requireRunning(ctx, vmManager); err != nil {
+			return err
+		}
+		history, err := envManager.ShellHistory(cmd.Context(), environment.Name)
+		if err != nil {
+			return err
+		}
+		if a.json {
+			return writeJSON(cmd, shellHistoryOutput{Environment: environment.Name, History: history})
+		}
+		_, err = fmt.Fprint(cmd.OutOrStdout(), sanitize.Text(history))
+		return err
+	}
+
+	records, err := envManager.ExecHistory(environment.Name, opts.limit)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return writeJSON(cmd, records)
+	}
+	if len(records) == 0 {
+		a.log.Info("No commands recorded for %s", environment.Name)
+		return nil
+	}
+	if opts.full {
+		return printExecRecords(cmd, records)
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "STARTED\tDURATION\tEXIT\tDIR\tCOMMAND")
+	for _, r := range records {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			r.StartedAt.Local().Format(time.DateTime), r.Duration().Round(time.Millisecond), exitColumn(r),
+			sanitize.Line(r.Dir), sanitize.Line(strings.Join(r.Command, " ")))
+	}
+	return w.Flush()
+}
+
+// printExecRecords prints each record with its output
+func printExecRecords(cmd *cobra.Command, records []env.ExecRecord) error {
+	out := cmd.OutOrStdout()
+	for i, r := range records {
+		if i > 0 {
+			_, _ = fmt.Fprintln(out)
+		}
+		_, _ = fmt.Fprintf(out, "$ %s\n", sanitize.Line(strings.Join(r.Command, " ")))
+		_, _ = fmt.Fprintf(out, "# %s in %s, %s, exit %s\n",
+			r.StartedAt.Local().Format(time.DateTime), sanitize.Line(r.Dir), r.Duration().Round(time.Millisecond), exitColumn(r))
+		if r.Truncated {
+			_, _ = fmt.Fprintf(out, "# (output cut to its last %d bytes)\n", env.MaxHistoryOutput)
+		}
+		output := sanitize.Text(r.Output)
+		if output != "" && !strings.HasSuffix(output, "\n") {
+			output += "\n"
+		}
+		if _, err := fmt.Fprint(out, output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exitColumn describes how a recorded command ended
+func exitColumn(r env.ExecRecord) string {
+	if r.Error != "" {
+		return "error: " + sanitize.Line(r.Error)
+	}
+	if r.ExitStatus < 0 {
+		return "-"
+	}
+	return fmt.Sprint(r.ExitStatus)
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/hooks"
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// runHook runs the host configuration's hook for event, if one is set, for
+// environment. Failures of hooks that can stop the operation are returned;
+// the others are logged as warnings.
+func (a *app) runHook(ctx context.Context, host *config.Host, event hooks.Event, environment *env.Environment, c hooks.Context) error {
+	command := hookCommand(host.Hooks, event)
+	if command == "" {
+		return nil
+	}
+
+	c.Environment = environment.Name
+	c.ProjectPath = environment.ProjectPath
+	c.Instance = host.VM.Instance
+	if c.Instance == "" {
+		c.Instance = vm.DefaultInstanceName
+	}
+
+	hook := &hooks.Hook{Event: event, Command: command, Timeout: host.Hooks.Timeout}
+	a.log.Debug("Running %s hook", event)
+	err := hook.Run(ctx, c)
+	if err != nil && !event.Blocking() {
+		a.log.Warning("%v", err)
+		return nil
+	}
+	return err
+}
+
+// runPostExecHook runs the post-exec hook for command, which ran in
+// environment from started until it ended with err
+func (a *app) runPostExecHook(ctx context.Context, host *config.Host, environment *env.Environment, command []string, started time.Time, err error) {
+	_ = a.runHook(ctx, host, hooks.PostExec, environment, hooks.Context{
+		Command:    command,
+		ExitStatus: ssh.ExitStatus(err),
+		Duration:   time.Since(started),
+	})
+}
+
+// hookCommand returns the command configured for event
+func hookCommand(h config.Hooks, event hooks.Event) string {
+	switch event {
+	case hooks.PreCreate:
+		return h.PreCreate
+	case hooks.PostCreate:
+		return h.PostCreate
+	case hooks.PreDelete:
+		return h.PreDelete
+	case hooks.PostExec:
+		return h.PostExec
+	default:
+		return ""
+	}
+}
+
+// hookOptions sets the environment manager options that run the create
+// hooks
+func (a *app) hookOptions(host *config.Host, opts *env.Options) {
+	if host.Hooks.PreCreate != "" {
+		opts.BeforeCreate = func(ctx context.Context, environment *env.Environment) error {
+			return a.runHook(ctx, host, hooks.PreCreate, environment, hooks.Context{})
+		}
+	}
+	if host.Hooks.PostCreate != "" {
+		opts.AfterCreate = func(ctx context.Context, environment *env.Environment) {
+			_ = a.runHook(ctx, host, hooks.PostCreate, environment, hooks.Context{})
+		}
+	}
+}
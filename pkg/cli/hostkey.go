@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/spf13/cobra"
+)
+
+// TrustHostKeyFlag is the persistent flag that accepts a VM's new host key.
+// llima-box records a VM's host key the first time it connects and refuses
+// to connect if it changes, which also happens when the VM is recreated
+// outside llima-box.
+const TrustHostKeyFlag = "trust-new-hostkey"
+
+// AddTrustHostKeyFlag adds --trust-new-hostkey to root for all of its
+// subcommands
+func AddTrustHostKeyFlag(root *cobra.Command) {
+	root.PersistentFlags().Bool(TrustHostKeyFlag, false, "Trust and record the VM's host key even if it differs from the recorded one")
+}
+
+// trustNewHostKey reads --trust-new-hostkey for cmd and, if it's set,
+// forgets the VM's recorded host key so the next connection records the one
+// it presents
+func (a *app) trustNewHostKey(cmd *cobra.Command) error {
+	flag := cmd.Flag(TrustHostKeyFlag)
+	if flag == nil || flag.Value.String() != "true" {
+		return nil
+	}
+	host, err := a.loadHost()
+	if err != nil {
+		return err
+	}
+	instance := a.provider(host).GetInstanceName()
+	if err := ssh.ForgetHostKey(instance); err != nil {
+		return fmt.Errorf("failed to forget host key: %w", err)
+	}
+	a.log.Warning("Trusting the host key VM %s presents on the next connection", instance)
+	return nil
+}
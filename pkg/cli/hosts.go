@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// NewHostsCommand creates the hosts command.
+func NewHostsCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var apply bool
+
+	cmd := &cobra.Command{
+		Use:   "hosts",
+		Short: "Show or install the hostnames of environments",
+		Long: `Show the hostname of every environment, in hosts file format.
+
+Each environment is registered in the VM's /etc/hosts as
+<environment>.` + env.HostsDomain + `, so services in one environment can reach another's
+by a stable name, for example in multi-agent integration tests. Environments
+share the VM's network, so the names resolve to 127.0.0.1 and services are
+told apart by port. Names are registered when environments are created and
+removed when they're deleted; this command also registers existing ones.
+
+With --apply, the names are also added to the host's hosts file, pointing at
+127.0.0.1 too, for ports forwarded with 'llima-box forward'. Only the block
+llima-box manages is changed; writing it uses sudo.
+
+Examples:
+  # Show the names
+  llima-box hosts
+
+  # Resolve them on the host too
+  llima-box hosts --apply`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runHosts(cmd, apply)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVar(&apply, "apply", false, "Add the names to the host's hosts file as well")
+
+	return a.bind(cmd)
+}
+
+// hostsOutput is what hosts prints with --output json
+type hostsOutput struct {
+	Entries []string `json:"entries"`
+
+	// Applied is set when the host's hosts file was changed
+	Applied bool `json:"applied"`
+}
+
+func (a *app) runHosts(cmd *cobra.Command, apply bool) error {
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	if err := envManager.SyncHostnames(ctx); err != nil {
+		return fmt.Errorf("failed to register hostnames in the VM: %w", err)
+	}
+	environments, err := envManager.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list environments: %w", err)
+	}
+	names := make([]string, len(environments))
+	for i, e := range environments {
+		names[i] = e.Name
+	}
+
+	out := hostsOutput{Entries: env.HostsEntries("127.0.0.1", names)}
+	if apply {
+		out.Applied, err = applyHostsFile(vmManager.GetInstanceName(), out.Entries)
+		if err != nil {
+			return err
+		}
+		if out.Applied {
+			a.log.Success("Updated %s", hostsFilePath())
+		} else {
+			a.log.Info("%s is up to date", hostsFilePath())
+		}
+	}
+
+	if a.json {
+		return writeJSON(cmd, out)
+	}
+	for _, line := range out.Entries {
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), line)
+	}
+	return nil
+}
+
+// hostsFilePath returns the host's hosts file
+func hostsFilePath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("SystemRoot"), "System32", "drivers", "etc", "hosts")
+	}
+	return "/etc/hosts"
+}
+
+// applyHostsFile replaces the block for instanceName in the host's hosts file
+// with entries, and reports whether the file changed. On Windows the file is
+// written directly, which needs an elevated prompt; elsewhere through sudo.
+func applyHostsFile(instanceName string, entries []string) (bool, error) {
+	path := hostsFilePath()
+	current, err := os.ReadFile(path) // #nosec G304 -- the system hosts file
+	if err != nil {
+		return false, fmt.Errorf("failed to read hosts file: %w", err)
+	}
+	updated := env.ReplaceHostsBlock(string(current), instanceName, entries)
+	if updated == string(current) {
+		return false, nil
+	}
+
+	if runtime.GOOS == "windows" {
+		if err := os.WriteFile(path, []byte(updated), 0644); err != nil { // #nosec G306 -- hosts files are world-readable
+			return false, fmt.Errorf("failed to write hosts file (run from an elevated prompt): %w", err)
+		}
+		return true, nil
+	}
+
+	tee := exec.Command("sudo", "tee", path)
+	tee.Stdin = bytes.NewReader([]byte(updated))
+	tee.Stderr = os.Stderr
+	if err := tee.Run(); err != nil {
+		return false, fmt.Errorf("failed to write hosts file: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// importOutput is the import command's JSON output
+type importOutput struct {
+	Environment string `json:"environment"`
+	ProjectPath string `json:"projectPath"`
+}
+
+// NewImportCommand creates the import command.
+func NewImportCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	cmd := &cobra.Command{
+		Use:   "import <archive> [path]",
+		Short: "Restore an environment from an archive",
+		Long: `Restore an environment from an archive made with 'llima-box export --format tar'.
+
+The environment for the specified project path (default: the current
+directory) is created, from the template the archived environment was
+created from, and gets the archived home directory. The archive can come
+from another machine, so the path doesn't need to match the one it was
+exported from. An archived VM workspace is restored to the workspace of the
+same name, and the path is ignored. Use - to read the archive from standard
+input.
+
+The environment must not exist yet; delete it first to replace it with the
+archived one. The VM is created and started if needed.
+
+Examples:
+  # Restore an environment for the current project
+  llima-box import app-env.tar.gz
+
+  # Move an environment between machines
+  ssh old-laptop llima-box export ~/src/app --format tar | llima-box import - ~/src/app`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runImport(cmd, args)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVar(&a.allowSynced, "allow-synced", false, "Allow environments for projects in cloud-synced folders, such as Dropbox or iCloud Drive")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runImport(cmd *cobra.Command, args []string) error {
+	projectPath, err := parseDeletePath(args[1:])
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = cmd.InOrStdin()
+	if args[0] != "-" {
+		f, err := os.Open(args[0]) // #nosec G304 -- the user's chosen archive
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+
+	host, err := a.loadHost()
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+	vmManager, err := a.ensureVM(ctx, host)
+	if err != nil {
+		return err
+	}
+	envManager := env.NewManagerWithOptions(vmManager, a.createOptions(host))
+	defer func() { _ = envManager.Close() }()
+
+	a.log.Info("Restoring environment from %s", args[0])
+	environment, err := envManager.Import(ctx, projectPath, r)
+	if errors.Is(err, env.ErrEnvironmentExists) {
+		return fmt.Errorf("%w (use 'llima-box delete' first to replace it)", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to import environment: %w", err)
+	}
+	a.log.Success("Environment %s restored for %s", environment.Name, environment.ProjectPath)
+
+	if a.json {
+		return writeJSON(cmd, importOutput{Environment: environment.Name, ProjectPath: environment.ProjectPath})
+	}
+	return nil
+}
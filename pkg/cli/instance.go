@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// InstanceFlag is the persistent flag choosing the VM instance commands use,
+// overriding vm.instance in the host configuration
+const InstanceFlag = "instance"
+
+// AddInstanceFlag adds --instance to root for all of its subcommands. Each
+// instance is a separate VM with its own environments, for example one per
+// client or per architecture. Commands embedded without the flag use the
+// instance from the host configuration.
+func AddInstanceFlag(root *cobra.Command) {
+	root.PersistentFlags().String(InstanceFlag, "", "VM instance to use (default: vm.instance from the host configuration, or llima-box)")
+}
+
+// setInstance reads --instance for cmd
+func (a *app) setInstance(cmd *cobra.Command) error {
+	flag := cmd.Flag(InstanceFlag)
+	if flag == nil || flag.Value.String() == "" {
+		return nil
+	}
+	if err := config.ValidateInstanceName(flag.Value.String()); err != nil {
+		return err
+	}
+	a.instance = flag.Value.String()
+	return nil
+}
@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"fmt"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// inventoryOptions holds the inventory command's flags
+type inventoryOptions struct {
+	all         bool
+	pkg         string
+	requested   bool
+	refresh     bool
+	vmWorkspace string
+}
+
+// NewInventoryCommand creates the inventory command.
+func NewInventoryCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var opts inventoryOptions
+
+	cmd := &cobra.Command{
+		Use:   "inventory [path]",
+		Short: "List the packages and toolchains of environments",
+		Long: `List the packages and toolchains the isolated environment for the specified
+project path was provisioned with, with their versions.
+
+Debian packages are installed VM-wide, so every environment sees all of them;
+those the environment's Dockerfile or template asked for are marked as
+requested. Versions are recorded when an environment is provisioned or its
+provisioning configuration is applied; --refresh reads them again, e.g.
+after upgrading packages in the VM.
+
+With --all, every environment in the VM is listed, so --package can find the
+environments with a given package, like a vulnerable openssl, without
+entering each one. --output json gives the full inventory for tools.
+
+Examples:
+  # List what the current directory's environment was provisioned with
+  llima-box inventory
+
+  # Find the environments with OpenSSL libraries and their versions
+  llima-box inventory --all --package 'libssl*'
+
+  # Export every environment's inventory for a security scanner
+  llima-box inventory --all --refresh --output json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runInventory(cmd, args, opts)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVar(&opts.all, "all", false, "List every environment in the VM")
+	cmd.Flags().StringVar(&opts.pkg, "package", "", "Only list packages whose name matches this pattern (e.g. openssl or 'libssl*')")
+	cmd.Flags().BoolVar(&opts.requested, "requested", false, "Only list the packages environments asked for")
+	cmd.Flags().BoolVar(&opts.refresh, "refresh", false, "Read the installed package versions again instead of using the recorded ones")
+	cmd.Flags().StringVar(&opts.vmWorkspace, "vm-workspace", "", "List the named VM workspace's environment")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runInventory(cmd *cobra.Command, args []string, opts inventoryOptions) error {
+	if opts.vmWorkspace != "" && len(args) > 0 {
+		return fmt.Errorf("a path can't be combined with --vm-workspace")
+	}
+	if opts.all && (opts.vmWorkspace != "" || len(args) > 0) {
+		return fmt.Errorf("--all can't be combined with a path or --vm-workspace")
+	}
+	if _, err := path.Match(opts.pkg, ""); err != nil {
+		return fmt.Errorf("--package: invalid pattern %q", opts.pkg)
+	}
+
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	var names []string
+	switch {
+	case opts.all:
+		environments, err := envManager.List(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list environments: %w", err)
+		}
+		for _, e := range environments {
+			names = append(names, e.Name)
+		}
+	case opts.vmWorkspace != "":
+		environment, err := env.VMWorkspace(opts.vmWorkspace)
+		if err != nil {
+			return err
+		}
+		names = []string{environment.Name}
+	default:
+		projectPath, err := parseDeletePath(args)
+		if err != nil {
+			return err
+		}
+		environment, err := envManager.Find(ctx, projectPath)
+		if err != nil {
+			return err
+		}
+		names = []string{environment.Name}
+	}
+
+	inventories := []*env.Inventory{}
+	for _, name := range names {
+		inv, err := envManager.Inventory(ctx, name, opts.refresh)
+		if err != nil {
+			// One environment without metadata doesn't hide the others
+			if opts.all {
+				a.log.Warning("Skipping %s: %v", name, err)
+				continue
+			}
+			return err
+		}
+		filterInventory(inv, opts.pkg, opts.requested)
+		inventories = append(inventories, inv)
+	}
+
+	if a.json {
+		if !opts.all {
+			return writeJSON(cmd, inventories[0])
+		}
+		return writeJSON(cmd, inventories)
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ENVIRONMENT\tKIND\tNAME\tVERSION\tREQUESTED")
+	rows := 0
+	for _, inv := range inventories {
+		for _, tc := range inv.Toolchains {
+			_, _ = fmt.Fprintf(w, "%s\ttoolchain\t%s\t%s\tyes\n", inv.Environment, sanitize.Line(tc.Name), tc.Layer)
+			rows++
+		}
+		for _, p := range inv.Packages {
+			requested := "no"
+			if p.Requested {
+				requested = "yes"
+			}
+			_, _ = fmt.Fprintf(w, "%s\tdeb\t%s\t%s\t%s\n", inv.Environment, sanitize.Line(p.Name), sanitize.Line(p.Version), requested)
+			rows++
+		}
+	}
+	if rows == 0 {
+		a.log.Info("No matching packages found")
+		return nil
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, inv := range inventories {
+		a.log.Debug("Packages of %s recorded at %s", inv.Environment, inv.CollectedAt.Local().Format(time.DateTime))
+	}
+	return nil
+}
+
+// filterInventory keeps the packages whose name matches pattern, if it's
+// set, and with requested those the environment asked for. Toolchains are
+// kept only without a filter.
+func filterInventory(inv *env.Inventory, pattern string, requested bool) {
+	if pattern == "" && !requested {
+		return
+	}
+	packages := []env.InventoryPackage{}
+	for _, p := range inv.Packages {
+		if requested && !p.Requested {
+			continue
+		}
+		if pattern != "" {
+			if ok, _ := path.Match(pattern, p.Name); !ok {
+				continue
+			}
+		}
+		packages = append(packages, p)
+	}
+	inv.Packages = packages
+	if pattern != "" {
+		inv.Toolchains = nil
+	}
+}
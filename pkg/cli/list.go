@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// NewListCommand creates the list command.
+func NewListCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all environments",
+		Long: `List all isolated environments running in the VM.
+
+Shows the environment name, its status, when a session last ran in it, and
+associated project path (if available). Sessions mark their environment as in
+use every minute, so ACTIVITY reads "active now" while one runs and "idle 3h"
+or "idle 6d" once they've ended, which helps find forgotten environments. Environments whose namespace couldn't be restarted after a VM
+restart are shown as needs-repair; run 'llima-box shell' in the project to
+rebuild them. Environments stopped with 'llima-box stop' are shown as paused.
+Environments are created automatically when you run 'llima-box shell'.
+
+Each VM instance has its own environments; --instance lists another one's.
+
+Examples:
+  llima-box list
+
+  # Environments in the VM instance client-a
+  llima-box list --instance client-a`,
+		RunE:         a.runList,
+		SilenceUsage: true,
+	}
+
+	return a.bind(cmd)
+}
+
+// listOutput is what list prints with --output json
+type listOutput struct {
+	// Instance is the VM instance listed
+	Instance string `json:"instance"`
+
+	// VM is "running", "stopped", or "not-created"
+	VM           string            `json:"vm"`
+	Environments []listEnvironment `json:"environments"`
+}
+
+// listEnvironment is one environment in listOutput
+type listEnvironment struct {
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	ProjectPath string `json:"projectPath,omitempty"`
+
+	// LastActive is when a session last ran in the environment; Active is
+	// set while one runs
+	LastActive *time.Time `json:"lastActive,omitempty"`
+	Active     bool       `json:"active"`
+}
+
+// newListEnvironment describes e for list and status
+func newListEnvironment(e *env.Environment, now time.Time) listEnvironment {
+	out := listEnvironment{Name: e.Name, Status: string(e.Status), ProjectPath: e.ProjectPath, Active: e.Active(now)}
+	if !e.LastActive.IsZero() {
+		lastActive := e.LastActive.UTC()
+		out.LastActive = &lastActive
+	}
+	return out
+}
+
+// formatActivity describes when a session last ran in e: "active now",
+// "idle 3h", or "-" if none has
+func formatActivity(e *env.Environment, now time.Time) string {
+	switch {
+	case e.LastActive.IsZero():
+		return "-"
+	case e.Active(now):
+		return "active now"
+	}
+	idle := now.Sub(e.LastActive)
+	switch {
+	case idle < time.Hour:
+		return fmt.Sprintf("idle %dm", int(idle/time.Minute))
+	case idle < 48*time.Hour:
+		return fmt.Sprintf("idle %dh", int(idle/time.Hour))
+	default:
+		return fmt.Sprintf("idle %dd", int(idle/(24*time.Hour)))
+	}
+}
+
+func (a *app) runList(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+
+	// Check if VM exists
+	exists, err := vmManager.Exists(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check VM existence: %w", err)
+	}
+
+	if !exists {
+		if a.json {
+			return writeJSON(cmd, listOutput{Instance: vmManager.GetInstanceName(), VM: "not-created", Environments: []listEnvironment{}})
+		}
+		a.log.Info("No VM created yet. Use 'llima-box shell' to create one.")
+		return nil
+	}
+
+	// Check if VM is running
+	running, err := vmManager.IsRunning(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check VM status: %w", err)
+	}
+
+	if !running {
+		if a.json {
+			return writeJSON(cmd, listOutput{Instance: vmManager.GetInstanceName(), VM: "stopped", Environments: []listEnvironment{}})
+		}
+		a.log.Info("%s.", errVMNotRunning)
+		return nil
+	}
+
+	// List environments
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	environments, err := envManager.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	now := time.Now()
+	if a.json {
+		out := listOutput{Instance: vmManager.GetInstanceName(), VM: "running", Environments: []listEnvironment{}}
+		for _, e := range environments {
+			out.Environments = append(out.Environments, newListEnvironment(e, now))
+		}
+		return writeJSON(cmd, out)
+	}
+
+	if len(environments) == 0 {
+		a.log.Info("No environments found. Use 'llima-box shell' to create one.")
+		return nil
+	}
+
+	// Print table to stdout (so it can be captured/redirected)
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ENVIRONMENT\tSTATUS\tACTIVITY\tPROJECT PATH")
+	_, _ = fmt.Fprintln(w, "-----------\t------\t--------\t------------")
+
+	for _, e := range environments {
+		projectPath := e.ProjectPath
+		if projectPath == "" {
+			projectPath = "(unknown)"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", sanitize.Line(e.Name), e.Status, formatActivity(e, now), sanitize.Line(projectPath))
+	}
+
+	_ = w.Flush()
+
+	// Summary to stderr
+	a.log.Plain("\nTotal: %d environment(s) in VM %s", len(environments), vmManager.GetInstanceName())
+
+	return nil
+}
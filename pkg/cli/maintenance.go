@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/middlendian/llima-box/internal/linewriter"
+	"github.com/middlendian/llima-box/pkg/maintenance"
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/middlendian/llima-box/pkg/vm"
+	"github.com/spf13/cobra"
+)
+
+// NewMaintenanceCommand creates the maintenance command group.
+func NewMaintenanceCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	cmd := &cobra.Command{
+		Use:   "maintenance",
+		Short: "Manage scheduled maintenance tasks inside the VM",
+		Long: `Manage scheduled maintenance tasks inside the VM.
+
+Maintenance tasks (package upgrades, cache pruning, log cleanup) run on a cron
+schedule inside the VM so a long-lived VM doesn't rot. Tasks are configured in
+the "maintenance" section of ~/.config/llima-box/config.yaml; the defaults are
+used when the section is absent.
+
+The schedule is installed automatically when the VM is created. Run
+'llima-box maintenance sync' after changing the configuration.
+
+Examples:
+  # Show configured tasks
+  llima-box maintenance list
+
+  # Install the schedule after editing the config
+  llima-box maintenance sync
+
+  # Run a task now
+  llima-box maintenance run apt-upgrade`,
+	}
+
+	cmd.AddCommand(a.bind(&cobra.Command{
+		Use:   "list",
+		Short: "List maintenance tasks",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return a.runMaintenanceList()
+		},
+		SilenceUsage: true,
+	}))
+
+	cmd.AddCommand(a.bind(&cobra.Command{
+		Use:   "sync",
+		Short: "Install the maintenance schedule in the VM",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runMaintenanceSync(cmd.Context())
+		},
+		SilenceUsage: true,
+	}))
+
+	cmd.AddCommand(a.bind(&cobra.Command{
+		Use:   "run <task>",
+		Short: "Run a maintenance task now",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runMaintenanceRun(cmd.Context(), args[0])
+		},
+		SilenceUsage: true,
+	}))
+
+	return cmd
+}
+
+func (a *app) runMaintenanceList() error {
+	host, err := a.loadHost()
+	if err != nil {
+		return err
+	}
+
+	if len(host.Maintenance) == 0 {
+		a.log.Info("No maintenance tasks configured.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TASK\tSCHEDULE\tCOMMAND")
+	_, _ = fmt.Fprintln(w, "----\t--------\t-------")
+	for _, task := range host.Maintenance {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", task.Name, task.Schedule, task.Command)
+	}
+	_ = w.Flush()
+
+	return nil
+}
+
+func (a *app) runMaintenanceSync(ctx context.Context) error {
+	_, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	if err := a.syncMaintenance(ctx, vmManager); err != nil {
+		return err
+	}
+	a.log.Success("Maintenance schedule installed")
+	return nil
+}
+
+func (a *app) runMaintenanceRun(ctx context.Context, name string) error {
+	_, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	scheduler, client, err := a.newScheduler(ctx, vmManager)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	a.log.Info("Running maintenance task %s...", name)
+	// The task's output is logged like the CLI's own messages, so it
+	// follows --output json
+	output := linewriter.New(func(line string) { a.log.Plain("%s", line) })
+	err = scheduler.Run(ctx, name, output)
+	output.Flush()
+	if err != nil {
+		return err
+	}
+	a.log.Success("Maintenance task %s completed", name)
+	return nil
+}
+
+// syncMaintenance installs the configured maintenance schedule in the VM.
+func (a *app) syncMaintenance(ctx context.Context, vmManager *vm.Manager) error {
+	scheduler, client, err := a.newScheduler(ctx, vmManager)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	return scheduler.Sync(ctx)
+}
+
+// newScheduler loads the maintenance configuration and connects to the VM.
+func (a *app) newScheduler(ctx context.Context, vmManager *vm.Manager) (*maintenance.Scheduler, *ssh.Client, error) {
+	host, err := a.loadHost()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := connectVM(ctx, vmManager)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return maintenance.NewScheduler(client, host.Maintenance), client, nil
+}
+
+// connectVM opens an SSH connection to the running VM.
+func connectVM(ctx context.Context, vmManager *vm.Manager) (*ssh.Client, error) {
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return nil, err
+	}
+
+	client, err := ssh.NewClientForVM(ctx, vmManager)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH client: %w", err)
+	}
+
+	if err := client.ConnectWithRetry(ssh.DefaultRetryConfig()); err != nil {
+		return nil, fmt.Errorf("failed to connect SSH: %w", err)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// DefaultProvider is the Provider llima-box uses: it returns the manager for
+// the Lima VM the host configuration describes
+func DefaultProvider(host *config.Host) *vm.Manager {
+	settings := vm.Settings{
+		CPUs:      host.VM.CPUs,
+		Memory:    host.VM.Memory,
+		Disk:      host.VM.Disk,
+		MountType: host.VM.MountType,
+	}
+	for _, m := range host.VM.Mounts {
+		settings.Mounts = append(settings.Mounts, vm.Mount{
+			Location:   m.Location,
+			MountPoint: m.MountPoint,
+			Writable:   m.Writable,
+		})
+	}
+	m := vm.NewManagerWithSettings(host.VM.Instance, settings)
+	m.SetTimeouts(vm.Timeouts{Query: host.VM.Timeouts.Query, Lifecycle: host.VM.Timeouts.Lifecycle})
+	return m
+}
+
+// newEnvManager returns an environment manager for vmManager using the host
+// configuration's shell, retry, path, and reference settings
+func (a *app) newEnvManager(host *config.Host, vmManager *vm.Manager) *env.Manager {
+	return env.NewManagerWithOptions(vmManager, a.envOptions(host))
+}
+
+// envOptions returns the environment manager options the host configuration
+// sets. The manager's progress is logged with the app's logger.
+func (a *app) envOptions(host *config.Host) env.Options {
+	opts := env.Options{Shell: host.Shell, DeniedPaths: host.Paths.Deny, MaxSetups: host.Setup.MaxConcurrent, Progress: a.progress, HelperDir: helperDir()}
+	for _, r := range host.References {
+		opts.References = append(opts.References, env.Reference{Name: r.MountName(), Path: r.Path})
+	}
+	if host.Retry != (config.RetrySettings{}) {
+		opts.Retry = env.DefaultConnectRetry()
+		if host.Retry.MaxAttempts != 0 {
+			opts.Retry.MaxAttempts = host.Retry.MaxAttempts
+		}
+		if host.Retry.InitialDelay != 0 {
+			opts.Retry.InitialDelay = host.Retry.InitialDelay
+		}
+		if host.Retry.MaxDelay != 0 {
+			opts.Retry.MaxDelay = host.Retry.MaxDelay
+		}
+	}
+	return opts
+}
+
+// helperDir returns the directory holding the VM helper binaries shipped
+// with llima-box: the executable's own, or ../libexec/llima-box for installs
+// keeping programs out of bin. It's empty if neither has them.
+func helperDir() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	bin := filepath.Dir(exe)
+	for _, dir := range []string{bin, filepath.Join(bin, "..", "libexec", "llima-box")} {
+		for _, arch := range []string{"amd64", "arm64"} {
+			if _, err := os.Stat(filepath.Join(dir, env.HelperBinary(arch))); err == nil {
+				return dir
+			}
+		}
+	}
+	return ""
+}
+
+// progress logs an environment manager's event, so it follows --output json
+// like the CLI's own messages
+func (a *app) progress(e env.Event) {
+	switch e.Level {
+	case env.EventWarning:
+		a.log.Warning("%s", e.Message)
+	default:
+		a.log.Debug("%s", e.Message)
+	}
+}
+
+// vmProgress logs a VM manager's event, so limactl's output follows
+// --output json like the CLI's own messages
+func (a *app) vmProgress(e vm.Event) {
+	switch e.Level {
+	case vm.EventWarning:
+		a.log.Warning("%s", e.Message)
+	case vm.EventInfo:
+		a.log.Info("%s", e.Message)
+	default:
+		a.log.Debug("%s", e.Message)
+	}
+}
+
+// newVMManager returns the manager for the VM the host configuration
+// describes, reporting its progress with the app's logger
+func (a *app) newVMManager(host *config.Host) *vm.Manager {
+	m := a.provider(host)
+	m.SetProgress(a.vmProgress)
+	return m
+}
+
+// loadVMManager loads the host configuration and returns it with the
+// manager for the VM it describes
+func (a *app) loadVMManager() (*config.Host, *vm.Manager, error) {
+	host, err := a.loadHost()
+	if err != nil {
+		return nil, nil, err
+	}
+	return host, a.newVMManager(host), nil
+}
+
+// errVMNotRunning is returned by commands that need the VM while it's stopped
+var errVMNotRunning = errors.New("VM is not running. Use 'llima-box vm start' to start it")
+
+// requireRunning returns errVMNotRunning unless vmManager's VM is running
+func requireRunning(ctx context.Context, vmManager *vm.Manager) error {
+	running, err := vmManager.IsRunning(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check VM status: %w", err)
+	}
+	if !running {
+		return errVMNotRunning
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/middlendian/llima-box/internal/log"
+	"github.com/spf13/cobra"
+)
+
+// OutputFlag is the persistent flag selecting how commands write their
+// results and messages: "text" for people, or "json" for tools
+const OutputFlag = "output"
+
+// AddOutputFlag adds --output to root for all of its subcommands. With
+// --output json, commands write their results to standard output as one JSON
+// document, and their messages to standard error as JSON lines (see
+// log.JSONLogger). Commands embedded without the flag write text.
+func AddOutputFlag(root *cobra.Command) {
+	root.PersistentFlags().StringP(OutputFlag, "o", "text", "Output format: text or json")
+}
+
+// bind makes cmd apply --output, --instance, and --trust-new-hostkey to a
+// before it runs and send a telemetry report, if enabled, once it has run,
+// and returns cmd
+func (a *app) bind(cmd *cobra.Command) *cobra.Command {
+	cmd.PreRunE = func(cmd *cobra.Command, _ []string) error {
+		if err := a.setInstance(cmd); err != nil {
+			return err
+		}
+		if err := a.setOutput(cmd); err != nil {
+			return err
+		}
+		a.setTheme()
+		return a.trustNewHostKey(cmd)
+	}
+	if run := cmd.RunE; run != nil {
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			err := run(cmd, args)
+			a.reportUsage(cmd, err)
+			return err
+		}
+	}
+	return cmd
+}
+
+// setTheme gives llima-box's own text logger the theme the host
+// configuration selects. A configuration that can't be loaded is reported by
+// the command when it loads it.
+func (a *app) setTheme() {
+	if !a.defaultLog || a.json {
+		return
+	}
+	host, err := a.loadHost()
+	if err != nil || host.Output.Theme == "" {
+		return
+	}
+	if theme, err := log.ParseTheme(host.Output.Theme); err == nil {
+		a.log = log.NewWithTheme(theme)
+	}
+}
+
+// setOutput reads --output for cmd. For json, llima-box's own logger is
+// replaced with one writing JSON lines; a logger from Deps is kept. Commands
+// with their own --output flag, like export's output file, write text.
+func (a *app) setOutput(cmd *cobra.Command) error {
+	flag := cmd.Flag(OutputFlag)
+	if flag == nil || cmd.LocalNonPersistentFlags().Lookup(OutputFlag) != nil {
+		return nil
+	}
+	switch flag.Value.String() {
+	case "text":
+		a.json = false
+	case "json":
+		a.json = true
+		if a.defaultLog {
+			a.log = log.NewJSON(cmd.ErrOrStderr())
+		}
+	default:
+		return fmt.Errorf("unknown output format %q (use text or json)", flag.Value.String())
+	}
+	return nil
+}
+
+// writeJSON writes v to cmd's standard output as an indented JSON document
+func writeJSON(cmd *cobra.Command, v any) error {
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
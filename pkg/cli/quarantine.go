@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// NewQuarantineCommand creates the quarantine command.
+func NewQuarantineCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var vmWorkspace, reason string
+	var release bool
+
+	cmd := &cobra.Command{
+		Use:   "quarantine [path]",
+		Short: "Freeze an environment for investigation",
+		Long: `Quarantine the isolated environment for the specified project path.
+
+Use this when an agent does something alarming. The environment's processes
+are frozen where they are, its network access is revoked, including
+connections that are already open, and its project directory becomes
+read-only inside it. Its files, processes, and memory are kept as they are
+for investigation.
+
+A quarantined environment is listed as quarantined. No session starts in it,
+and it isn't stopped, resumed, restarted after a VM restart, or deleted by
+gc, until it's released with --release or deleted with 'llima-box delete'.
+
+Examples:
+  # Quarantine the environment for the current directory
+  llima-box quarantine --reason "pushed to main"
+
+  # Release it once it's been looked at
+  llima-box quarantine --release
+
+  # Quarantine a VM workspace's environment
+  llima-box quarantine --vm-workspace scratch`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runQuarantine(cmd, args, vmWorkspace, reason, release)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&vmWorkspace, "vm-workspace", "", "Quarantine the environment of the named VM workspace")
+	cmd.Flags().StringVar(&reason, "reason", "", "Why the environment is quarantined, recorded in its metadata")
+	cmd.Flags().BoolVar(&release, "release", false, "Release the environment from quarantine")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runQuarantine(cmd *cobra.Command, args []string, vmWorkspace, reason string, release bool) error {
+	if vmWorkspace != "" && len(args) > 0 {
+		return fmt.Errorf("a path can't be combined with --vm-workspace")
+	}
+	if release && reason != "" {
+		return fmt.Errorf("--reason can't be combined with --release")
+	}
+
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	var environment *env.Environment
+	if vmWorkspace != "" {
+		environment, err = env.VMWorkspace(vmWorkspace)
+	} else {
+		var projectPath string
+		projectPath, err = parseDeletePath(args)
+		if err != nil {
+			return err
+		}
+		environment, err = envManager.Find(ctx, projectPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	out := stopOutput{Environment: environment.Name}
+	if release {
+		a.log.Info("Releasing environment %s from quarantine...", environment.Name)
+		if err := envManager.Release(ctx, environment); err != nil {
+			return fmt.Errorf("failed to release environment: %w", err)
+		}
+		a.log.Success("Environment released; its processes continue")
+		out.Status = string(env.StatusStopped)
+		if running, _ := envManager.Exists(ctx, environment.Name); running {
+			out.Status = string(env.StatusRunning)
+		}
+	} else {
+		a.log.Info("Quarantining environment %s...", environment.Name)
+		if err := envManager.Quarantine(ctx, environment, reason); err != nil {
+			return fmt.Errorf("failed to quarantine environment: %w", err)
+		}
+		a.log.Success("Environment quarantined: processes frozen, network revoked, project read-only")
+		out.Status = string(env.StatusQuarantined)
+	}
+
+	if a.json {
+		return writeJSON(cmd, out)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// NewRunCommand creates the run command.
+func NewRunCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var path string
+
+	cmd := &cobra.Command{
+		Use:   "run [name] [-- args...]",
+		Short: "Run a command template from the project configuration",
+		Long: `Run a named command from the commands section of the project's
+.llima-box/config.yaml inside its environment.
+
+Templates can use {args} for the arguments after '--' (each quoted as one
+word), {project} for the project directory inside the VM, and {env} for the
+environment name. Arguments are appended to templates without {args}.
+
+Without a name, the configured commands are listed. llima-box exits with the
+command's exit status.
+
+Examples:
+  # .llima-box/config.yaml:
+  #   commands:
+  #     test: pytest {args}
+  #     serve: python -m http.server 8000
+
+  # Run the tests matching "foo"
+  llima-box run test -- -k foo
+
+  # List the project's commands
+  llima-box run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runRun(cmd, args, path)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&path, "path", "", "Project directory (default: current directory)")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runRun(cmd *cobra.Command, args []string, path string) error {
+	var pathArgs []string
+	if path != "" {
+		pathArgs = []string{path}
+	}
+	projectPath, err := parseDeletePath(pathArgs)
+	if err != nil {
+		return err
+	}
+
+	project, err := config.LoadProject(projectPath)
+	if err != nil {
+		return err
+	}
+
+	if cmd.ArgsLenAtDash() == 0 {
+		return fmt.Errorf("no command name specified before '--'")
+	}
+	if len(args) == 0 {
+		a.printProjectCommands(project)
+		return nil
+	}
+
+	name, extra := args[0], args[1:]
+	template, ok := project.Commands[name]
+	if !ok {
+		return fmt.Errorf("no command %q in %s", name, config.ProjectConfigPath(projectPath))
+	}
+
+	host, err := a.loadHost()
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	envManager, environment, err := a.prepareEnvironment(ctx, host, projectPath, "", false, false, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = envManager.Close() }()
+
+	sessionVars, err := a.sessionEnv(environment)
+	if err != nil {
+		return err
+	}
+
+	command := env.ExpandCommand(template, environment, extra)
+	a.log.Info("Running %s: %s", name, command)
+
+	started := time.Now()
+	err = envManager.EnterNamespace(ctx, environment, []string{command}, env.EnterOptions{
+		Budget: host.SessionBudget(environment.ProjectPath),
+		Env:    sessionVars,
+	})
+	a.runPostExecHook(context.WithoutCancel(ctx), host, environment, []string{command}, started, err)
+	if errors.Is(err, env.ErrSessionTimeLimit) || errors.Is(err, env.ErrDailyBudgetUsed) {
+		return err
+	}
+	if exitErr := a.commandExit(cmd, err); exitErr != nil {
+		return exitErr
+	}
+	if err != nil {
+		return fmt.Errorf("command %s failed: %w", name, err)
+	}
+	return nil
+}
+
+// printProjectCommands lists the project's command templates
+func (a *app) printProjectCommands(project *config.Project) {
+	if len(project.Commands) == 0 {
+		a.log.Plain("No commands configured. Add a commands section to %s/%s.", config.ProjectDir, config.ProjectConfigFile)
+		return
+	}
+
+	names := make([]string, 0, len(project.Commands))
+	for name := range project.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tCOMMAND")
+	for _, name := range names {
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", name, project.Commands[name])
+	}
+	_ = w.Flush()
+}
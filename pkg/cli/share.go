@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// NewShareCommand creates the share command.
+func NewShareCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var (
+		with     string
+		from     string
+		writable bool
+		revoke   bool
+		force    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "share <dir> --with <path>",
+		Short: "Share a directory with another environment",
+		Long: `Share a directory from one environment with another environment.
+
+The directory is bind-mounted into the other environment at
+/shared/<source-env>/<dir-name>. Only the receiving environment's user is
+granted access. Shares are read-only unless --writable is given.
+
+The source environment is the one for the current directory unless --from is
+given. Relative directories are resolved against its project directory.
+
+Sharing requires confirmation. Use --force (or --yes) to skip.
+
+Examples:
+  # Hand the planner's artifacts to the executor (read-only)
+  cd ~/planner && llima-box share artifacts --with ~/executor
+
+  # Share a writable directory
+  llima-box share handoff --with ~/executor --writable
+
+  # Stop sharing
+  llima-box share artifacts --with ~/executor --revoke`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runShare(cmd.Context(), args[0], from, with, writable, revoke, force)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&with, "with", "", "Project path of the environment to share with (required)")
+	cmd.Flags().StringVar(&from, "from", "", "Project path of the source environment (default: current directory)")
+	cmd.Flags().BoolVar(&writable, "writable", false, "Allow the receiving environment to write")
+	cmd.Flags().BoolVar(&revoke, "revoke", false, "Remove a previously created share")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Share without confirmation")
+	addYesFlag(cmd, &force)
+	_ = cmd.MarkFlagRequired("with")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runShare(ctx context.Context, dir, from, with string, writable, revoke, force bool) error {
+	// The source environment defaults to the current directory
+	var fromArgs []string
+	if from != "" {
+		fromArgs = []string{from}
+	}
+	srcPath, err := parseDeletePath(fromArgs)
+	if err != nil {
+		return err
+	}
+
+	// Check if VM is running
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	src, err := envManager.Find(ctx, srcPath)
+	if err != nil {
+		return err
+	}
+	peer, err := envManager.Find(ctx, with)
+	if err != nil {
+		return err
+	}
+
+	if revoke {
+		if err := envManager.Unshare(ctx, src, peer, dir); err != nil {
+			return fmt.Errorf("failed to revoke share: %w", err)
+		}
+		a.log.Success("Stopped sharing %s with %s", dir, peer.Name)
+		return nil
+	}
+
+	// Confirm sharing
+	if !force {
+		mode := "read-only"
+		if writable {
+			mode = "read-write"
+		}
+		a.log.Warning("Share '%s' from environment '%s' with environment '%s' (%s)?", dir, src.Name, peer.Name, mode)
+		ok, err := a.confirm(fmt.Sprintf("Anything running in '%s' will be able to access it. Continue?", peer.Name), false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			a.log.Info("Cancelled")
+			return nil
+		}
+	}
+
+	mountPoint, err := envManager.Share(ctx, src, peer, dir, writable)
+	if err != nil {
+		return fmt.Errorf("failed to share directory: %w", err)
+	}
+
+	a.log.Success("Shared %s with %s at %s", dir, peer.Name, mountPoint)
+
+	return nil
+}
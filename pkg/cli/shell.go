@@ -0,0 +1,702 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/clipboard"
+	"github.com/middlendian/llima-box/internal/dashboard"
+	"github.com/middlendian/llima-box/internal/notify"
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/dotenv"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/env/templates"
+	"github.com/middlendian/llima-box/pkg/frames"
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/middlendian/llima-box/pkg/vm"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// shellOptions holds the shell command flags.
+type shellOptions struct {
+	notifyOptions
+	clipboard   bool
+	idleTimeout time.Duration
+	agentKeys   []string
+	guard       bool
+	vmWorkspace string
+	frames      bool
+	direct      bool
+	autoBackup  bool
+	cpus        float64
+	memory      string
+	swap        string
+	strict      bool
+	template    string
+	overlay     bool
+	publishHost []string
+	noBanner    bool
+}
+
+// notifyOptions holds the --notify and --notify-webhook flags, shared by
+// shell and exec.
+type notifyOptions struct {
+	notify        bool
+	notifyWebhook string
+}
+
+// addNotifyFlags registers the completion notification flags on cmd.
+func addNotifyFlags(cmd *cobra.Command, opts *notifyOptions) {
+	cmd.Flags().BoolVar(&opts.notify, "notify", false, "Show a desktop notification when the command finishes")
+	cmd.Flags().StringVar(&opts.notifyWebhook, "notify-webhook", "", "POST a JSON notification to this URL when the command finishes")
+}
+
+// NewShellCommand creates the shell command.
+func NewShellCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var opts shellOptions
+
+	cmd := &cobra.Command{
+		Use:   "shell [path] [-- command]",
+		Short: "Enter an isolated environment shell",
+		Long: `Enter an isolated environment shell for the specified project path.
+
+The shell command creates a new isolated environment (if it doesn't exist) and
+starts an interactive shell within that environment. Each environment has its
+own filesystem view and user account.
+
+llima-box exits with the exit status of the shell or command, so
+"llima-box shell -- make test" fails when the tests do. A command killed by a
+signal exits with 128 plus the signal's number, as in shells.
+
+Examples:
+  # Enter shell for current directory
+  llima-box shell
+
+  # Enter shell for specific path
+  llima-box shell /path/to/project
+
+  # Run specific command in environment
+  llima-box shell /path/to/project -- git status
+
+  # Run command with arguments
+  llima-box shell -- python script.py --arg value
+
+  # Let programs in the environment copy to the host clipboard
+  llima-box shell --clipboard
+
+  # Get a desktop notification when a long build finishes
+  llima-box shell --notify -- make all
+
+  # Close the session after 30 minutes without input
+  llima-box shell --idle-timeout 30m
+
+  # Confirm destructive commands at this terminal before they run
+  llima-box shell --guard
+
+  # Forward only the deploy key from the host SSH agent
+  llima-box shell --agent-key deploy@example.com
+
+  # Work in a workspace that lives only inside the VM, with no access to
+  # host files (copy files in and out with 'llima-box cp')
+  llima-box shell --vm-workspace scratch
+
+  # Run a command for an agent framework: stdout, stderr, and the exit
+  # status arrive as length-prefixed JSON events on standard output
+  llima-box shell --frames -- pytest -q
+
+  # Run a program directly, without a shell, so arguments taken from model
+  # output reach it exactly as given
+  llima-box shell --direct -- grep -rn "$PATTERN" src
+
+  # Back up the project first, so 'llima-box restore' can undo the session
+  llima-box shell --auto-backup -- claude
+
+  # Cap the environment at 2 CPUs and 4 GiB of memory. The limits are shared
+  # by all of its sessions and stay until changed (0 removes a limit)
+  llima-box shell --cpus 2 --memory 4G
+
+  # Let it swap at most 1 GiB beyond that before the OOM killer steps in,
+  # instead of pushing the whole VM into swap (0 keeps it out of swap)
+  llima-box shell --memory 4G --swap 1G
+
+  # Don't create the environment if the VM can't fit the CPUs and memory
+  # the project declares under resources in .llima-box/config.yaml next to
+  # the other environments' declarations (without --strict, it's a warning)
+  llima-box shell --strict
+
+  # Create the environment from a template: apt packages, variables, mounts,
+  # and a setup script. python-ml and node are built in; more can be added
+  # as ~/.config/llima-box/templates/<name>.yaml
+  llima-box shell --template python-ml
+
+  # Keep a new environment's changes to the project in the VM, on top of a
+  # read-only view of the host files; review them with 'llima-box diff' and
+  # throw them away with 'llima-box discard'
+  llima-box shell --overlay -- claude
+
+  # Reach a local LLM server on the host's port 11434 at localhost:11434
+  # inside the environment for as long as the session runs
+  llima-box shell --publish-host 11434 -- claude
+
+  # Projects in Dropbox, iCloud Drive, OneDrive, or Google Drive folders
+  # are refused, since the sync client would upload the environment's
+  # changes; allow one anyway (or use --overlay)
+  llima-box shell --allow-synced
+
+  # Leave out the summary of the environment's guardrails (project access,
+  # network, and resource limits) printed before an interactive shell
+  llima-box shell --no-banner
+
+  # Setup and deletion of an environment wait for each other across
+  # llima-box processes; fail at once if the environment is busy instead
+  llima-box shell --no-wait`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runShell(cmd, args, opts)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVar(&opts.clipboard, "clipboard", false, "Copy OSC 52 clipboard requests from the environment to the host clipboard")
+	addNotifyFlags(cmd, &opts.notifyOptions)
+	cmd.Flags().DurationVar(&opts.idleTimeout, "idle-timeout", 0, "Close the session after this long without input (e.g. 30m)")
+	cmd.Flags().BoolVar(&opts.guard, "guard", false, "Ask for confirmation before commands matching the configured guard patterns run")
+	cmd.Flags().StringArrayVar(&opts.agentKeys, "agent-key", nil, "Only forward this SSH agent key, by SHA256 fingerprint or comment (repeatable)")
+	cmd.Flags().StringVar(&opts.vmWorkspace, "vm-workspace", "", "Use the named workspace inside the VM instead of a host directory; host files are hidden")
+	cmd.Flags().BoolVar(&opts.frames, "frames", false, "Write the command's output and exit status as length-prefixed JSON events (no PTY)")
+	cmd.Flags().BoolVar(&opts.direct, "direct", false, "Run the command directly instead of through a shell; arguments are passed as given")
+	cmd.Flags().BoolVar(&opts.autoBackup, "auto-backup", false, "Back up the project directory before the session (see 'llima-box restore')")
+	cmd.Flags().Float64Var(&opts.cpus, "cpus", 0, "Limit the environment to this many CPUs (e.g. 1.5; 0 removes the limit)")
+	cmd.Flags().StringVar(&opts.memory, "memory", "", "Limit the environment's memory (e.g. 4G or 512M; 0 removes the limit)")
+	cmd.Flags().StringVar(&opts.swap, "swap", "", "Limit the environment's swap use (e.g. 1G; 0 keeps it out of swap, max removes the limit)")
+	cmd.Flags().BoolVar(&opts.strict, "strict", false, "Refuse to create the environment if the VM can't fit the resources the project declares")
+	cmd.Flags().StringVar(&opts.template, "template", "", "Create the environment from this template (ignored if it already exists)")
+	cmd.Flags().BoolVar(&opts.overlay, "overlay", false, "Keep the new environment's changes to the project in the VM, apart from the host files (see 'llima-box diff')")
+	cmd.Flags().StringArrayVar(&opts.publishHost, "publish-host", nil, "Make a port on the host reachable at localhost inside the environment during the session, as PORT or ENV_PORT:HOST_PORT (repeatable)")
+	cmd.Flags().BoolVar(&opts.noBanner, "no-banner", false, "Don't print the environment's guardrails before an interactive shell")
+	cmd.Flags().BoolVar(&a.allowSynced, "allow-synced", false, "Allow environments for projects in cloud-synced folders, such as Dropbox or iCloud Drive")
+	cmd.Flags().BoolVar(&a.noWait, "no-wait", false, "Fail instead of waiting while another llima-box process sets up or deletes the environment, or for a free setup slot")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runShell(cmd *cobra.Command, args []string, opts shellOptions) error {
+	if opts.vmWorkspace != "" && cmd.ArgsLenAtDash() != 0 && len(args) > 0 {
+		return fmt.Errorf("a path can't be combined with --vm-workspace")
+	}
+
+	// Parse arguments
+	projectPath, command, err := parseShellArgs(cmd, args)
+	if err != nil {
+		return fmt.Errorf("failed to parse arguments: %w", err)
+	}
+	if opts.frames && len(command) == 0 {
+		return fmt.Errorf("--frames requires a command after '--'")
+	}
+	if opts.direct && len(command) == 0 {
+		return fmt.Errorf("--direct requires a command after '--'")
+	}
+	if opts.direct && opts.guard {
+		return fmt.Errorf("--guard can't be combined with --direct: only shells are guarded")
+	}
+	if opts.overlay && opts.vmWorkspace != "" {
+		return fmt.Errorf("--overlay can't be combined with --vm-workspace: VM workspaces have no host files to overlay")
+	}
+	if opts.autoBackup && opts.vmWorkspace != "" {
+		return fmt.Errorf("--auto-backup can't be combined with --vm-workspace: there's no host directory to back up")
+	}
+
+	limits, err := parseLimitFlags(cmd, opts)
+	if err != nil {
+		return err
+	}
+	published := make([]portForward, len(opts.publishHost))
+	for i, arg := range opts.publishHost {
+		if published[i], err = parsePortForward(arg); err != nil {
+			return err
+		}
+	}
+
+	var tmpl *templates.Template
+	if opts.template != "" {
+		if opts.vmWorkspace != "" {
+			return fmt.Errorf("--template can't be combined with --vm-workspace")
+		}
+		if tmpl, err = templates.Load(opts.template); err != nil {
+			return err
+		}
+	}
+
+	host, err := a.loadHost()
+	if err != nil {
+		return err
+	}
+
+	var guardPatterns []string
+	if opts.guard {
+		if len(host.Guard.Patterns) == 0 {
+			return fmt.Errorf("--guard requires at least one guard pattern in the host configuration")
+		}
+		guardPatterns = host.Guard.Patterns
+	}
+
+	ctx := cmd.Context()
+	envManager, environment, err := a.prepareEnvironment(ctx, host, projectPath, opts.vmWorkspace, opts.strict, opts.overlay, tmpl)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = envManager.Close() }()
+
+	if opts.autoBackup {
+		if err := a.autoBackup(ctx, environment); err != nil {
+			return err
+		}
+	}
+
+	if limits != nil {
+		if err := a.setLimits(ctx, envManager, environment, limits); err != nil {
+			return err
+		}
+	}
+
+	sessionVars, err := a.sessionEnv(environment)
+	if err != nil {
+		return err
+	}
+
+	// Enter namespace and execute command
+	enterOpts := env.EnterOptions{
+		Session: ssh.SessionOptions{
+			IdleTimeout: opts.idleTimeout,
+			AgentKeys:   opts.agentKeys,
+		},
+		GuardPatterns: guardPatterns,
+		Budget:        host.SessionBudget(environment.ProjectPath),
+		Env:           sessionVars,
+		Exec:          opts.direct,
+	}
+	if opts.clipboard {
+		enterOpts.Session.Clipboard = clipboard.Write
+	}
+
+	closePublished := a.publishHostPorts(ctx, envManager, published)
+	defer closePublished()
+
+	if len(command) == 0 && !opts.noBanner && !a.json {
+		a.printBanner(ctx, envManager, environment, enterOpts.Budget)
+	}
+
+	started := time.Now()
+	var framesErr error
+	if opts.frames {
+		err, framesErr = enterFramed(ctx, cmd.OutOrStdout(), envManager, environment, command, enterOpts)
+	} else {
+		err = envManager.EnterNamespace(ctx, environment, command, enterOpts)
+	}
+	a.notifyCompletion(context.WithoutCancel(ctx), opts.notifyOptions, environment, command, started, err)
+	a.runPostExecHook(context.WithoutCancel(ctx), host, environment, command, started, err)
+	if opts.frames {
+		// The exit event carries the command's status, so once it's
+		// written the run counts as successful
+		return framesErr
+	}
+
+	if errors.Is(err, ssh.ErrIdleTimeout) {
+		a.log.Warning("Session closed after %s without input", opts.idleTimeout)
+		return nil
+	}
+	if errors.Is(err, env.ErrSessionTimeLimit) {
+		a.log.Warning("Session ended: %v", env.ErrSessionTimeLimit)
+		return nil
+	}
+	if errors.Is(err, env.ErrDailyBudgetUsed) {
+		return env.ErrDailyBudgetUsed
+	}
+	if exitErr := a.commandExit(cmd, err); exitErr != nil {
+		// The command or shell reported its own failure; exit with its status
+		return exitErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to enter namespace: %w", err)
+	}
+
+	return nil
+}
+
+// publishHostPorts publishes host ports for the session and returns a
+// function closing them. A port that can't be published, usually because
+// another session already publishes it, is a warning: the session can still
+// reach whatever listens there.
+func (a *app) publishHostPorts(ctx context.Context, envManager *env.Manager, ports []portForward) func() {
+	var open []*ssh.Forward
+	for _, p := range ports {
+		f, err := envManager.PublishHostPort(ctx, p.listen, p.target)
+		if err != nil {
+			a.log.Warning("Port %d isn't published (is another session publishing it?): %v", p.listen, err)
+			continue
+		}
+		open = append(open, f)
+		a.log.Info("Host port %d is reachable at localhost:%d in the environment", p.target, p.listen)
+	}
+	return func() {
+		for _, f := range open {
+			_ = f.Close()
+		}
+	}
+}
+
+// limitFlags holds the resource limits changed with --cpus, --memory, and
+// --swap. Nil fields are left as they are.
+type limitFlags struct {
+	cpus   *float64
+	memory *int64
+	swap   *int64
+}
+
+// parseLimitFlags returns the limits changed on the command line, or nil if
+// neither flag was given
+func parseLimitFlags(cmd *cobra.Command, opts shellOptions) (*limitFlags, error) {
+	var flags limitFlags
+	if cmd.Flags().Changed("cpus") {
+		if opts.cpus < 0 {
+			return nil, fmt.Errorf("--cpus must not be negative")
+		}
+		flags.cpus = &opts.cpus
+	}
+	if cmd.Flags().Changed("memory") {
+		memory, err := env.ParseMemorySize(opts.memory)
+		if err != nil {
+			return nil, fmt.Errorf("--memory: %w", err)
+		}
+		flags.memory = &memory
+	}
+	if cmd.Flags().Changed("swap") {
+		swap, err := parseSwapSize(opts.swap)
+		if err != nil {
+			return nil, fmt.Errorf("--swap: %w", err)
+		}
+		flags.swap = &swap
+	}
+	if flags.cpus == nil && flags.memory == nil && flags.swap == nil {
+		return nil, nil
+	}
+	return &flags, nil
+}
+
+// parseSwapSize parses --swap: a size, 0 for no swap (env.NoSwap), or max
+// for no limit
+func parseSwapSize(s string) (int64, error) {
+	if strings.EqualFold(strings.TrimSpace(s), "max") {
+		return 0, nil
+	}
+	size, err := env.ParseMemorySize(s)
+	if err != nil {
+		return 0, err
+	}
+	if size == 0 {
+		return env.NoSwap, nil
+	}
+	return size, nil
+}
+
+// setLimits applies the limits changed on the command line to environment,
+// keeping the others
+func (a *app) setLimits(ctx context.Context, envManager *env.Manager, environment *env.Environment, flags *limitFlags) error {
+	limits, err := envManager.Limits(ctx, environment.Name)
+	if err != nil {
+		return err
+	}
+	if flags.cpus != nil {
+		limits.CPUs = *flags.cpus
+	}
+	if flags.memory != nil {
+		limits.Memory = *flags.memory
+	}
+	if flags.swap != nil {
+		limits.Swap = *flags.swap
+	}
+
+	if err := envManager.SetLimits(ctx, environment.Name, limits); err != nil {
+		return err
+	}
+
+	if limits.IsZero() {
+		a.log.Info("Removed resource limits")
+		return nil
+	}
+	cpus, memory := "unlimited", "unlimited"
+	if limits.CPUs > 0 {
+		cpus = strconv.FormatFloat(limits.CPUs, 'f', -1, 64)
+	}
+	if limits.Memory > 0 {
+		memory = dashboard.FormatBytes(limits.Memory)
+	}
+	swap := "unlimited"
+	switch {
+	case limits.Swap == env.NoSwap:
+		swap = "no"
+	case limits.Swap > 0:
+		swap = dashboard.FormatBytes(limits.Swap)
+	}
+	a.log.Info("Resource limits: %s CPUs, %s memory, %s swap", cpus, memory, swap)
+	return nil
+}
+
+// sessionEnv returns the variables the project's .env file passes to
+// sessions in environment. VM workspaces have no host project to read it
+// from.
+func (a *app) sessionEnv(environment *env.Environment) ([]dotenv.Var, error) {
+	if !environment.Mount().HostProject() {
+		return nil, nil
+	}
+	project, err := config.LoadProject(environment.ProjectPath)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := project.SessionEnv(environment.ProjectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(vars) > 0 {
+		names := make([]string, len(vars))
+		for i, v := range vars {
+			names[i] = v.Key
+		}
+		a.log.Info("Passing from .env: %s", strings.Join(names, ", "))
+	}
+	return vars, nil
+}
+
+// enterFramed runs command with its output framed as events on out. It
+// returns the command's error, which the exit event reports, and the error
+// writing the events.
+func enterFramed(ctx context.Context, out io.Writer, envManager *env.Manager, environment *env.Environment, command []string, opts env.EnterOptions) (runErr, err error) {
+	w := frames.NewWriter(out)
+	opts.Session.Stdout = w.Stream(frames.TypeStdout)
+	opts.Session.Stderr = w.Stream(frames.TypeStderr)
+
+	if err := w.Write(frames.Event{Type: frames.TypeStart, Environment: environment.Name, Command: command}); err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	runErr = envManager.EnterNamespace(ctx, environment, command, opts)
+	return runErr, w.Write(frames.Exit(ssh.ExitStatus(runErr), runErr, time.Since(started)))
+}
+
+// ensureVM creates and starts the VM described by the host configuration
+// if needed and returns its manager
+func (a *app) ensureVM(ctx context.Context, host *config.Host) (*vm.Manager, error) {
+	a.log.Info("Ensuring VM is running...")
+	vmManager := a.newVMManager(host)
+
+	exists, err := vmManager.Exists(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check VM existence: %w", err)
+	}
+
+	if !exists {
+		a.log.Info("Creating VM (this may take a few minutes)...")
+		if err := vmManager.Create(ctx); err != nil {
+			return nil, fmt.Errorf("failed to create VM: %w", err)
+		}
+		// A new VM has new host keys
+		if err := ssh.ForgetHostKey(vmManager.GetInstanceName()); err != nil {
+			a.log.Warning("%v", err)
+		}
+		a.log.Success("VM created successfully")
+	}
+
+	if err := vmManager.EnsureRunning(ctx); err != nil {
+		return nil, fmt.Errorf("failed to start VM: %w", err)
+	}
+	a.log.Success("VM is running")
+
+	if !exists {
+		// Maintenance keeps the VM healthy but isn't needed to enter the shell
+		if err := a.syncMaintenance(ctx, vmManager); err != nil {
+			a.log.Warning("Failed to install maintenance schedule: %v", err)
+		}
+	}
+	return vmManager, nil
+}
+
+// createOptions returns the environment manager options for commands that
+// create environments: the host configuration's, with its create hooks,
+// provisioning change prompts, --no-wait, and --allow-synced
+func (a *app) createOptions(host *config.Host) env.Options {
+	opts := a.envOptions(host)
+	a.hookOptions(host, &opts)
+	opts.ConfirmProvisioningChange = a.confirmProvisioningChange
+	if a.noWait {
+		opts.LockWait = -1
+	}
+	opts.AllowSynced = a.allowSynced
+	return opts
+}
+
+// prepareEnvironment creates and starts the VM described by the host
+// configuration if needed and returns the
+// environment for projectPath, or for the named VM workspace if vmWorkspace is
+// set, creating it if it doesn't exist. With strict, a new environment whose
+// declared resources the VM can't fit is refused instead of created with a
+// warning. A new environment is set up from tmpl, if set, and with overlay,
+// gets a copy-on-write overlay of the project. The caller must close the
+// returned manager.
+func (a *app) prepareEnvironment(ctx context.Context, host *config.Host, projectPath, vmWorkspace string, strict, overlay bool, tmpl *templates.Template) (*env.Manager, *env.Environment, error) {
+	vmManager, err := a.ensureVM(ctx, host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Create or get environment
+	opts := a.createOptions(host)
+	opts.StrictResources = strict
+	opts.Overlay = overlay
+	envManager := env.NewManagerWithOptions(vmManager, opts)
+
+	var environment *env.Environment
+	if vmWorkspace != "" {
+		a.log.Info("Setting up VM workspace %s", vmWorkspace)
+		environment, err = envManager.CreateInVM(ctx, vmWorkspace)
+	} else {
+		a.log.Info("Setting up environment for %s", projectPath)
+		environment, err = envManager.CreateFromTemplate(ctx, projectPath, tmpl)
+	}
+	if err != nil {
+		_ = envManager.Close()
+		if ctx.Err() != nil {
+			a.log.Warning("Environment setup interrupted; it resumes where it stopped on the next run")
+		}
+		return nil, nil, fmt.Errorf("failed to create environment: %w", err)
+	}
+
+	a.log.Success("Environment ready: %s", environment.Name)
+	return envManager, environment, nil
+}
+
+// confirmProvisioningChange shows how the project's provisioning
+// configuration changed since its environment was set up and asks whether to
+// apply the change. Without a terminal to ask on, the change isn't applied.
+func (a *app) confirmProvisioningChange(_ context.Context, environment *env.Environment, change *env.ProvisioningChange) bool {
+	if a.json || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false
+	}
+
+	a.log.Warning("The project's configuration changed since %s was set up:", environment.Name)
+	for _, line := range change.Summary() {
+		a.log.Plain("  - %s", line)
+	}
+	ok, err := a.confirm("Apply these changes to the environment?", true)
+	return err == nil && ok
+}
+
+// notifyCompletion sends the notifications requested by --notify and
+// --notify-webhook. Delivery failures are reported as warnings only.
+func (a *app) notifyCompletion(ctx context.Context, opts notifyOptions, environment *env.Environment, command []string, started time.Time, err error) {
+	if !opts.notify && opts.notifyWebhook == "" {
+		return
+	}
+
+	commandStr := strings.Join(command, " ")
+	if commandStr == "" {
+		commandStr = "shell"
+	}
+
+	event := notify.Event{
+		Environment: environment.Name,
+		Command:     commandStr,
+		ExitCode:    ssh.ExitStatus(err),
+		Duration:    time.Since(started),
+	}
+
+	if opts.notify {
+		if err := notify.Desktop(event); err != nil {
+			a.log.Warning("%v", err)
+		}
+	}
+
+	if opts.notifyWebhook != "" {
+		if err := notify.Webhook(ctx, opts.notifyWebhook, event); err != nil {
+			a.log.Warning("%v", err)
+		}
+	}
+}
+
+// parseShellArgs parses the shell command arguments.
+// Returns: (projectPath, command, error)
+func parseShellArgs(cmd *cobra.Command, args []string) (string, []string, error) {
+	var projectPath string
+	var command []string
+
+	// Get the position of "--" separator (Cobra strips it from args)
+	dashIndex := cmd.ArgsLenAtDash()
+
+	// Parse based on "--" position
+	// Note: Cobra strips "--" from args, but ArgsLenAtDash() tells us where it was
+	if dashIndex == -1 {
+		// No "--" separator
+		if len(args) == 0 {
+			// No args: use current directory, default shell
+			cwd, err := os.Getwd()
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to get current directory: %w", err)
+			}
+			projectPath = cwd
+			command = []string{}
+		} else {
+			// One arg: treat as path, use default shell
+			projectPath = args[0]
+			command = []string{}
+		}
+	} else {
+		// Has "--" separator
+		if dashIndex == 0 {
+			// "-- command": use current directory, all args are command
+			cwd, err := os.Getwd()
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to get current directory: %w", err)
+			}
+			projectPath = cwd
+			command = args // All args after -- are the command
+		} else {
+			// "path -- command": args before dashIndex are path, after are command
+			projectPath = args[0]
+			command = args[dashIndex:]
+			if len(command) == 0 {
+				return "", nil, fmt.Errorf("no command specified after '--'")
+			}
+		}
+	}
+
+	// Make path absolute
+	absPath, err := filepath.Abs(projectPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+
+	// Validate path exists
+	info, err := os.Stat(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, fmt.Errorf("path does not exist: %s", absPath)
+		}
+		return "", nil, fmt.Errorf("failed to stat path: %w", err)
+	}
+
+	if !info.IsDir() {
+		return "", nil, fmt.Errorf("path is not a directory: %s", absPath)
+	}
+
+	return absPath, command, nil
+}
@@ -0,0 +1,284 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/dashboard"
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/health"
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/spf13/cobra"
+)
+
+// NewStatusCommand creates the status command.
+func NewStatusCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the VM's state, resource usage, and environments",
+		Long: `Show the state of the VM in one table: whether it's running and reachable
+over SSH, its CPU load, memory and disk usage, and how many environments it
+has and whether their namespaces are alive.
+
+Unlike health, status doesn't judge the results and exits nonzero only if it
+couldn't run. Like health, it never changes anything: it doesn't start the VM
+or restart namespaces.
+
+Examples:
+  # Summary table
+  llima-box status
+
+  # Memory in use, for scripts
+  llima-box status --output json | jq '.memory'`,
+		Args:         cobra.NoArgs,
+		RunE:         a.runStatus,
+		SilenceUsage: true,
+	}
+
+	return a.bind(cmd)
+}
+
+// statusOutput is what status prints with --output json. Sections that need
+// SSH are left out when the VM isn't reachable.
+type statusOutput struct {
+	VM           statusVM            `json:"vm"`
+	SSH          *statusSSH          `json:"ssh,omitempty"`
+	Load         *health.Load        `json:"load,omitempty"`
+	Memory       *statusMemory       `json:"memory,omitempty"`
+	Disks        []statusDisk        `json:"disks,omitempty"`
+	Environments *statusEnvironments `json:"environments,omitempty"`
+}
+
+// statusVM is the VM as Lima describes it
+type statusVM struct {
+	Name string `json:"name"`
+
+	// Status is "running", "stopped", or "not-created", or another state
+	// Lima reports, in lower case
+	Status string `json:"status"`
+
+	// CPUs, MemoryBytes, and DiskBytes are what the VM was given
+	CPUs        int   `json:"cpus,omitempty"`
+	MemoryBytes int64 `json:"memoryBytes,omitempty"`
+	DiskBytes   int64 `json:"diskBytes,omitempty"`
+}
+
+// statusSSH is whether status could connect to the VM
+type statusSSH struct {
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// statusMemory is the VM's memory as its kernel sees it
+type statusMemory struct {
+	TotalBytes     int64 `json:"totalBytes"`
+	AvailableBytes int64 `json:"availableBytes"`
+}
+
+// statusDisk is one filesystem in the VM
+type statusDisk struct {
+	MountPoint     string `json:"mountPoint"`
+	SizeBytes      int64  `json:"sizeBytes"`
+	AvailableBytes int64  `json:"availableBytes"`
+}
+
+// statusEnvironments counts the environments by status; running ones have
+// a live namespace, and active ones a session running
+type statusEnvironments struct {
+	Total        int               `json:"total"`
+	ByStatus     map[string]int    `json:"byStatus"`
+	Active       int               `json:"active"`
+	Environments []listEnvironment `json:"environments"`
+}
+
+// statusOrder is the order environment counts are shown in
+var statusOrder = []env.Status{env.StatusRunning, env.StatusProvisioning, env.StatusStopped, env.StatusPaused, env.StatusCheckpointed, env.StatusNeedsRepair, env.StatusQuarantined}
+
+func (a *app) runStatus(cmd *cobra.Command, _ []string) error {
+	ctx, cancel := context.WithTimeout(cmd.Context(), healthTimeout)
+	defer cancel()
+
+	out, err := a.collectStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	if a.json {
+		return writeJSON(cmd, out)
+	}
+	printStatus(cmd, out)
+	return nil
+}
+
+// collectStatus gathers what status shows, stopping at the first part that
+// the rest depend on. Usage that can't be read is left out with a warning.
+func (a *app) collectStatus(ctx context.Context) (*statusOutput, error) {
+	_, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return nil, err
+	}
+	out := &statusOutput{VM: statusVM{Name: vmManager.GetInstanceName(), Status: "not-created"}}
+
+	exists, err := vmManager.Exists(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check VM existence: %w", err)
+	}
+	if !exists {
+		return out, nil
+	}
+	inst, err := vmManager.GetInstance(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM status: %w", err)
+	}
+	out.VM.Status = strings.ToLower(inst.Status)
+	out.VM.CPUs, out.VM.MemoryBytes, out.VM.DiskBytes = inst.CPUs, inst.Memory, inst.Disk
+	if inst.Status != "Running" {
+		return out, nil
+	}
+
+	client, err := ssh.NewClientForVM(ctx, vmManager)
+	if err == nil {
+		err = client.ConnectWithRetry(probeRetry)
+	}
+	if err != nil {
+		out.SSH = &statusSSH{Error: err.Error()}
+		return out, nil
+	}
+	defer func() { _ = client.Close() }()
+	out.SSH = &statusSSH{Reachable: true}
+
+	a.collectUsage(ctx, client, out)
+
+	environments, err := env.Scan(ctx, client)
+	if err != nil {
+		a.log.Warning("Failed to list environments: %v", err)
+		return out, nil
+	}
+	out.Environments = &statusEnvironments{
+		Total:        len(environments),
+		ByStatus:     map[string]int{},
+		Environments: []listEnvironment{},
+	}
+	now := time.Now()
+	for _, e := range environments {
+		out.Environments.ByStatus[string(e.Status)]++
+		item := newListEnvironment(e, now)
+		if item.Active {
+			out.Environments.Active++
+		}
+		out.Environments.Environments = append(out.Environments.Environments, item)
+	}
+	return out, nil
+}
+
+// collectUsage reads the load average, memory, and disk space in one round
+// trip
+func (a *app) collectUsage(ctx context.Context, client *ssh.Client, out *statusOutput) {
+	results, err := client.ExecBatch(ctx, []string{"cat /proc/loadavg", "cat /proc/meminfo", dfCommand})
+	if err != nil {
+		a.log.Warning("Failed to read resource usage: %v", err)
+	}
+
+	// The batch stops at the first failure, so later results may be missing
+	result := func(i int) (string, bool) {
+		if i >= len(results) || results[i].Err() != nil {
+			return "", false
+		}
+		return results[i].Output, true
+	}
+
+	if output, ok := result(0); ok {
+		if load, err := health.ParseLoadAvg(output); err != nil {
+			a.log.Warning("%v", err)
+		} else {
+			out.Load = &load
+		}
+	}
+	if output, ok := result(1); ok {
+		if mem, err := health.ParseMemInfo(output); err != nil {
+			a.log.Warning("%v", err)
+		} else {
+			out.Memory = &statusMemory{TotalBytes: mem.TotalKB * 1024, AvailableBytes: mem.AvailKB * 1024}
+		}
+	}
+	if output, ok := result(2); ok {
+		if filesystems, err := health.ParseDF(output); err != nil {
+			a.log.Warning("%v", err)
+		} else {
+			for _, f := range filesystems {
+				out.Disks = append(out.Disks, statusDisk{MountPoint: f.MountPoint, SizeBytes: f.SizeKB * 1024, AvailableBytes: f.AvailKB * 1024})
+			}
+		}
+	}
+}
+
+// printStatus prints out as a table, one row per component
+func printStatus(cmd *cobra.Command, out *statusOutput) {
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "COMPONENT\tSTATUS\tDETAILS")
+
+	vmDetails := sanitize.Line(out.VM.Name)
+	if out.VM.CPUs > 0 {
+		vmDetails += fmt.Sprintf(": %d CPUs, %s memory, %s disk",
+			out.VM.CPUs, dashboard.FormatBytes(out.VM.MemoryBytes), dashboard.FormatBytes(out.VM.DiskBytes))
+	}
+	_, _ = fmt.Fprintf(w, "vm\t%s\t%s\n", sanitize.Line(out.VM.Status), vmDetails)
+
+	if out.SSH != nil {
+		if out.SSH.Reachable {
+			_, _ = fmt.Fprintln(w, "ssh\treachable\t")
+		} else {
+			_, _ = fmt.Fprintf(w, "ssh\tunreachable\t%s\n", sanitize.Line(out.SSH.Error))
+		}
+	}
+
+	if out.Load != nil {
+		details := fmt.Sprintf("load %.2f, %.2f, %.2f", out.Load.One, out.Load.Five, out.Load.Fifteen)
+		busy := "-"
+		if out.VM.CPUs > 0 {
+			busy = fmt.Sprintf("%.0f%%", out.Load.One*100/float64(out.VM.CPUs))
+		}
+		_, _ = fmt.Fprintf(w, "cpu\t%s\t%s\n", busy, details)
+	}
+
+	if out.Memory != nil {
+		used := out.Memory.TotalBytes - out.Memory.AvailableBytes
+		_, _ = fmt.Fprintf(w, "memory\t%s\t%s of %s used\n", percent(used, out.Memory.TotalBytes),
+			dashboard.FormatBytes(used), dashboard.FormatBytes(out.Memory.TotalBytes))
+	}
+
+	for _, d := range out.Disks {
+		used := d.SizeBytes - d.AvailableBytes
+		_, _ = fmt.Fprintf(w, "disk:%s\t%s\t%s of %s used\n", sanitize.Line(d.MountPoint), percent(used, d.SizeBytes),
+			dashboard.FormatBytes(used), dashboard.FormatBytes(d.SizeBytes))
+	}
+
+	if out.Environments != nil {
+		var counts []string
+		for _, s := range statusOrder {
+			if n := out.Environments.ByStatus[string(s)]; n > 0 {
+				counts = append(counts, fmt.Sprintf("%d %s", n, s))
+			}
+		}
+		if out.Environments.Active > 0 {
+			counts = append(counts, fmt.Sprintf("%d active now", out.Environments.Active))
+		}
+		_, _ = fmt.Fprintf(w, "environments\t%d\t%s\n", out.Environments.Total, strings.Join(counts, ", "))
+	}
+
+	_ = w.Flush()
+}
+
+// percent formats part as a percentage of total
+func percent(part, total int64) string {
+	if total <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", float64(part)*100/float64(total))
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// NewStopCommand creates the stop command.
+func NewStopCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var vmWorkspace string
+
+	cmd := &cobra.Command{
+		Use:   "stop [path]",
+		Short: "Stop an environment without deleting it",
+		Long: `Stop the isolated environment for the specified project path.
+
+This terminates the environment's processes and namespace, freeing the
+memory and CPU they use, but keeps its user account, home directory, and
+settings. The environment is listed as paused and stays stopped across VM
+restarts until it's resumed with 'llima-box resume' or entered with
+'llima-box shell'.
+
+Examples:
+  # Stop the environment for the current directory
+  llima-box stop
+
+  # Stop a VM workspace's environment
+  llima-box stop --vm-workspace scratch`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runStop(cmd, args, vmWorkspace, false)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&vmWorkspace, "vm-workspace", "", "Stop the environment of the named VM workspace")
+
+	return a.bind(cmd)
+}
+
+// NewResumeCommand creates the resume command.
+func NewResumeCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var vmWorkspace string
+
+	cmd := &cobra.Command{
+		Use:   "resume [path]",
+		Short: "Restart an environment stopped with stop",
+		Long: `Resume the isolated environment for the specified project path.
+
+This recreates the environment's namespace and mounts the project and
+toolchains in it again. Processes that were running when it was stopped
+aren't restored. Resuming a running environment does nothing.
+
+Examples:
+  # Resume the environment for the current directory
+  llima-box resume
+
+  # Resume a VM workspace's environment
+  llima-box resume --vm-workspace scratch`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runStop(cmd, args, vmWorkspace, true)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&vmWorkspace, "vm-workspace", "", "Resume the environment of the named VM workspace")
+
+	return a.bind(cmd)
+}
+
+// stopOutput is what stop and resume print with --output json
+type stopOutput struct {
+	Environment string `json:"environment"`
+	Status      string `json:"status"`
+}
+
+// runStop stops, or with resume set resumes, the environment for the path
+// in args or the VM workspace
+func (a *app) runStop(cmd *cobra.Command, args []string, vmWorkspace string, resume bool) error {
+	if vmWorkspace != "" && len(args) > 0 {
+		return fmt.Errorf("a path can't be combined with --vm-workspace")
+	}
+
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	var environment *env.Environment
+	if vmWorkspace != "" {
+		environment, err = env.VMWorkspace(vmWorkspace)
+	} else {
+		var projectPath string
+		projectPath, err = parseDeletePath(args)
+		if err != nil {
+			return err
+		}
+		environment, err = envManager.Find(ctx, projectPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	out := stopOutput{Environment: environment.Name}
+	if resume {
+		a.log.Info("Resuming environment %s...", environment.Name)
+		if err := envManager.Resume(ctx, environment.Name); err != nil {
+			return fmt.Errorf("failed to resume environment: %w", err)
+		}
+		a.log.Success("Environment resumed")
+		out.Status = string(env.StatusRunning)
+	} else {
+		a.log.Info("Stopping environment %s...", environment.Name)
+		if err := envManager.Stop(ctx, environment.Name); err != nil {
+			return fmt.Errorf("failed to stop environment: %w", err)
+		}
+		a.log.Success("Environment stopped; its files are kept")
+		out.Status = string(env.StatusPaused)
+	}
+
+	if a.json {
+		return writeJSON(cmd, out)
+	}
+	return nil
+}
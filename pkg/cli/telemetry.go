@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/telemetry"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// exitCategory is the telemetry category of a command that exited with its
+// own nonzero status, such as exec's
+const exitCategory = "command-exit"
+
+// reportUsage sends a telemetry report for cmd if the host configuration
+// enables it. Failing to send is only logged as debug output: telemetry
+// never changes how a command ends.
+func (a *app) reportUsage(cmd *cobra.Command, err error) {
+	host, loadErr := a.loadHost()
+	if loadErr != nil || !host.Telemetry.Enabled {
+		return
+	}
+
+	var flags []string
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		flags = append(flags, f.Name)
+	})
+	name := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+	report := telemetry.NewReport(name, flags, err)
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		report.Error = exitCategory
+	}
+
+	// Reports are sent after Ctrl-C too, to count interruptions
+	if sendErr := telemetry.Send(context.WithoutCancel(cmd.Context()), host.Telemetry.Endpoint, report); sendErr != nil {
+		a.log.Debug("Telemetry: %v", sendErr)
+	}
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/telemetry"
+	"github.com/spf13/cobra"
+)
+
+func TestReportUsage(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   bool
+		err       error
+		wantSent  bool
+		wantError string
+	}{
+		{name: "disabled", enabled: false, err: nil},
+		{name: "success", enabled: true, wantSent: true},
+		{name: "failure", enabled: true, err: errors.New("environment /Users/alice/secret-project is broken"), wantSent: true, wantError: telemetry.CategoryOther},
+		{name: "command exit status", enabled: true, err: &ExitError{Code: 2}, wantSent: true, wantError: exitCategory},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []string
+			server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				bodies = append(bodies, string(body))
+			}))
+			defer server.Close()
+
+			deps := Deps{
+				Logger: &recordingLogger{},
+				Config: func() (*config.Host, error) {
+					return &config.Host{Telemetry: config.Telemetry{Enabled: tt.enabled, Endpoint: server.URL}}, nil
+				},
+			}
+			a := newApp(deps)
+			var force bool
+			cmd := a.bind(&cobra.Command{
+				Use:           "delete [path]",
+				SilenceErrors: true,
+				RunE:          func(*cobra.Command, []string) error { return tt.err },
+			})
+			cmd.Flags().BoolVar(&force, "force", false, "")
+			root := &cobra.Command{Use: "llima-box"}
+			root.AddCommand(cmd)
+			root.SetArgs([]string{"delete", "--force", "/Users/alice/secret-project"})
+			if err := root.ExecuteContext(t.Context()); err != tt.err {
+				t.Fatalf("expected the command's own error %v, got %v", tt.err, err)
+			}
+
+			if !tt.wantSent {
+				if len(bodies) != 0 {
+					t.Errorf("expected no report, got %v", bodies)
+				}
+				return
+			}
+			if len(bodies) != 1 {
+				t.Fatalf("expected one report, got %d", len(bodies))
+			}
+			if strings.Contains(bodies[0], "alice") {
+				t.Errorf("report leaks a path: %s", bodies[0])
+			}
+			var got telemetry.Report
+			if err := json.Unmarshal([]byte(bodies[0]), &got); err != nil {
+				t.Fatalf("failed to decode report: %v", err)
+			}
+			if got.Command != "delete" || !reflect.DeepEqual(got.Flags, []string{"force"}) || got.Error != tt.wantError {
+				t.Errorf("unexpected report: %+v", got)
+			}
+		})
+	}
+}
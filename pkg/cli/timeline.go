@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// NewTimelineCommand creates the timeline command.
+func NewTimelineCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var vmWorkspace string
+	var since time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "timeline [path]",
+		Short: "Show what happened in an environment, in order",
+		Long: `Reconstruct what happened in the environment for the specified project
+path, such as what an agent did, by merging its records in time order:
+
+  audit  shells and commands starting and ending (see 'llima-box audit')
+  exec   commands run without a terminal that aren't in the audit log,
+         with errors from the exec history (see 'llima-box history --exec')
+  files  project files modified since the first recorded session
+
+Commands in both the audit log and the exec history are listed once. Only
+the last change to each file is known, from its modification time, and the
+files of VM workspaces aren't listed. Version control directories and
+node_modules are skipped.
+
+Examples:
+  # Show what happened in the current directory's environment
+  llima-box timeline
+
+  # Show the last two hours of another project's environment
+  llima-box timeline ~/src/api --since 2h
+
+  # Export the timeline for a tool
+  llima-box timeline --output json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runTimeline(cmd, args, vmWorkspace, since)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&vmWorkspace, "vm-workspace", "", "Show the timeline of the named VM workspace's environment")
+	cmd.Flags().DurationVar(&since, "since", 0, "Show only what happened in this much time before now (e.g. 30m, 2h)")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runTimeline(cmd *cobra.Command, args []string, vmWorkspace string, since time.Duration) error {
+	if vmWorkspace != "" && len(args) > 0 {
+		return fmt.Errorf("a path can't be combined with --vm-workspace")
+	}
+	if since < 0 {
+		return fmt.Errorf("--since must not be negative")
+	}
+
+	ctx := cmd.Context()
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	if err := requireRunning(ctx, vmManager); err != nil {
+		return err
+	}
+
+	envManager := a.newEnvManager(host, vmManager)
+	defer func() { _ = envManager.Close() }()
+
+	var environment *env.Environment
+	if vmWorkspace != "" {
+		environment, err = env.VMWorkspace(vmWorkspace)
+	} else {
+		var projectPath string
+		projectPath, err = parseDeletePath(args)
+		if err != nil {
+			return err
+		}
+		environment, err = envManager.Find(ctx, projectPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	events, err := envManager.Timeline(cmd.Context(), environment)
+	if err != nil {
+		return err
+	}
+	if since > 0 {
+		cutoff := time.Now().Add(-since)
+		for len(events) > 0 && events[0].Time.Before(cutoff) {
+			events = events[1:]
+		}
+	}
+	if a.json {
+		return writeJSON(cmd, events)
+	}
+	if len(events) == 0 {
+		a.log.Info("Nothing recorded for %s", environment.Name)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TIME\tSOURCE\tEVENT\tDETAIL")
+	for _, e := range events {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Time.Local().Format(time.DateTime), e.Source, e.Event, sanitize.Line(timelineDetail(e)))
+	}
+	return w.Flush()
+}
+
+// timelineDetail describes a timeline event in one line: the file or
+// command, with the exit status of finished commands
+func timelineDetail(e env.TimelineEvent) string {
+	if e.Source == env.TimelineFiles {
+		return e.Path
+	}
+	detail := strings.Join(e.Command, " ")
+	if detail == "" {
+		detail = e.Kind
+	}
+	if e.ExitStatus != nil {
+		detail = fmt.Sprintf("%s (exit %d)", detail, *e.ExitStatus)
+	}
+	if e.Error != "" {
+		detail += ": " + e.Error
+	}
+	return detail
+}
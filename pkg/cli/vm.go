@@ -0,0 +1,333 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/middlendian/llima-box/internal/dashboard"
+	"github.com/middlendian/llima-box/pkg/vm"
+	"github.com/spf13/cobra"
+)
+
+// NewVMCommand creates the vm command group.
+func NewVMCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	cmd := &cobra.Command{
+		Use:   "vm",
+		Short: "Manage the VM environments run in",
+		Long: `Manage the Lima VM that llima-box runs environments in.
+
+The VM is created and started when it's first needed, by 'llima-box shell'
+or another command entering an environment; these commands manage it
+directly.
+
+Examples:
+  # Show the VM's resources and status
+  llima-box vm info
+
+  # Stop the VM, e.g. to free the host's memory
+  llima-box vm stop
+
+  # Recreate the VM to apply changed vm settings
+  llima-box vm delete && llima-box vm start`,
+	}
+
+	cmd.AddCommand(a.bind(&cobra.Command{
+		Use:   "start",
+		Short: "Start the VM, creating it if needed",
+		Long: `Start the VM, creating it first from the built-in Lima configuration and
+the vm settings of the host configuration if it doesn't exist yet.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runVMStart(cmd.Context())
+		},
+		SilenceUsage: true,
+	}))
+
+	cmd.AddCommand(a.bind(&cobra.Command{
+		Use:   "stop",
+		Short: "Stop the VM",
+		Long: `Stop the VM cleanly: wait for environment creations and deletions in
+progress to finish, flush the VM's filesystems, and stop it. Processes
+running in environments are ended; the environments' namespaces are set up
+again when they're next used.
+
+To stop the VM automatically once it's idle, set vm.idleTimeout in the host
+configuration and install the host agent (see 'llima-box daemon').`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runVMStop(cmd.Context())
+		},
+		SilenceUsage: true,
+	}))
+
+	cmd.AddCommand(a.bind(&cobra.Command{
+		Use:   "restart",
+		Short: "Stop the VM cleanly and start it again",
+		Long: `Stop the VM cleanly, as 'llima-box vm stop' does, and start it again.
+Processes running in environments are ended.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runVMRestart(cmd.Context())
+		},
+		SilenceUsage: true,
+	}))
+
+	var force bool
+	deleteCmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete the VM",
+		Long: `Delete the VM, stopping it cleanly first if it's running.
+
+Environment homes live on a separate data disk, which is kept: they're
+attached again when the VM is next created, e.g. by 'llima-box vm start'.
+Deleting and recreating the VM is how changed vm settings take effect.
+
+By default, prompts for confirmation before deletion. Use --force (or --yes)
+to skip. The approval hook, if the host configuration sets one, runs before
+the deletion as the vm-delete operation.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runVMDelete(cmd.Context(), force)
+		},
+		SilenceUsage: true,
+	}
+	deleteCmd.Flags().BoolVarP(&force, "force", "f", false, "Delete without confirmation")
+	addYesFlag(deleteCmd, &force)
+	cmd.AddCommand(a.bind(deleteCmd))
+
+	cmd.AddCommand(a.bind(&cobra.Command{
+		Use:   "info",
+		Short: "Show the VM's resources and status",
+		Long: `Show the VM's status, CPUs, memory, disk, SSH port, and the installed
+Lima version.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runVMInfo(cmd)
+		},
+		SilenceUsage: true,
+	}))
+
+	cmd.AddCommand(a.bind(&cobra.Command{
+		Use:   "config",
+		Short: "Print the VM's Lima configuration",
+		Long: `Print the VM's Lima configuration. If the VM doesn't exist yet, prints
+the configuration it would be created with.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.runVMConfig(cmd)
+		},
+		SilenceUsage: true,
+	}))
+
+	return cmd
+}
+
+func (a *app) runVMStart(ctx context.Context) error {
+	_, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	running, err := vmRunning(ctx, vmManager)
+	if err != nil {
+		return err
+	}
+	if running {
+		a.log.Info("The VM is already running")
+		return nil
+	}
+
+	if err := vmManager.EnsureRunning(ctx); err != nil {
+		return fmt.Errorf("failed to start VM: %w", err)
+	}
+	a.log.Success("VM started")
+	return nil
+}
+
+func (a *app) runVMStop(ctx context.Context) error {
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	running, err := vmRunning(ctx, vmManager)
+	if err != nil {
+		return err
+	}
+	if !running {
+		a.log.Info("The VM isn't running")
+		return nil
+	}
+
+	if err := a.stopForHost(ctx, host, vmManager); err != nil {
+		return err
+	}
+	a.log.Success("VM stopped")
+	return nil
+}
+
+func (a *app) runVMRestart(ctx context.Context) error {
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	running, err := vmRunning(ctx, vmManager)
+	if err != nil {
+		return err
+	}
+	if running {
+		if err := a.stopForHost(ctx, host, vmManager); err != nil {
+			return err
+		}
+	}
+
+	if err := vmManager.EnsureRunning(ctx); err != nil {
+		return fmt.Errorf("failed to start VM: %w", err)
+	}
+	a.log.Success("VM restarted")
+	return nil
+}
+
+func (a *app) runVMDelete(ctx context.Context, force bool) error {
+	host, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	exists, err := vmManager.Exists(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check VM existence: %w", err)
+	}
+	if !exists {
+		a.log.Info("The VM doesn't exist")
+		return nil
+	}
+
+	if !force && a.json {
+		return errJSONNeedsForce
+	}
+	if !force {
+		a.log.Warning("Delete VM %s?", vmManager.GetInstanceName())
+		ok, err := a.confirm("Running processes are terminated; environment homes are kept on the data disk. Continue?", false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			a.log.Info("Cancelled")
+			return nil
+		}
+	}
+
+	if err := a.requireApproval(ctx, host, "vm-delete", nil, force); err != nil {
+		return err
+	}
+
+	if err := a.stopForHost(ctx, host, vmManager); err != nil {
+		return err
+	}
+	a.log.Info("Deleting the VM")
+	if err := vmManager.Delete(ctx, false); err != nil {
+		return err
+	}
+	a.log.Success("VM deleted")
+	return nil
+}
+
+// vmInfoOutput is what vm info prints with --output json
+type vmInfoOutput struct {
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	Arch         string `json:"arch,omitempty"`
+	CPUs         int    `json:"cpus,omitempty"`
+	Memory       int64  `json:"memoryBytes,omitempty"`
+	Disk         int64  `json:"diskBytes,omitempty"`
+	SSHLocalPort int    `json:"sshLocalPort,omitempty"`
+	Dir          string `json:"dir,omitempty"`
+	LimaVersion  string `json:"limaVersion,omitempty"`
+}
+
+func (a *app) runVMInfo(cmd *cobra.Command) error {
+	ctx := cmd.Context()
+	_, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	exists, err := vmManager.Exists(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check VM existence: %w", err)
+	}
+
+	out := vmInfoOutput{Name: vmManager.GetInstanceName(), Status: "NotCreated"}
+	if exists {
+		inst, err := vmManager.GetInstance(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to inspect VM: %w", err)
+		}
+		out.Status = inst.Status
+		out.Arch = inst.Arch
+		out.CPUs = inst.CPUs
+		out.Memory = inst.Memory
+		out.Disk = inst.Disk
+		out.SSHLocalPort = inst.SSHLocalPort
+		out.Dir = inst.Dir
+	}
+	if version, err := vmManager.LimaVersion(cmd.Context()); err != nil {
+		a.log.Warning("%v", err)
+	} else {
+		out.LimaVersion = version
+	}
+
+	if a.json {
+		return writeJSON(cmd, out)
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "Name:\t%s\n", out.Name)
+	_, _ = fmt.Fprintf(w, "Status:\t%s\n", out.Status)
+	if exists {
+		_, _ = fmt.Fprintf(w, "Arch:\t%s\n", out.Arch)
+		_, _ = fmt.Fprintf(w, "CPUs:\t%d\n", out.CPUs)
+		_, _ = fmt.Fprintf(w, "Memory:\t%s\n", dashboard.FormatBytes(out.Memory))
+		_, _ = fmt.Fprintf(w, "Disk:\t%s\n", dashboard.FormatBytes(out.Disk))
+		sshPort := "-"
+		if out.SSHLocalPort > 0 {
+			sshPort = fmt.Sprintf("%d", out.SSHLocalPort)
+		}
+		_, _ = fmt.Fprintf(w, "SSH port:\t%s\n", sshPort)
+		_, _ = fmt.Fprintf(w, "Directory:\t%s\n", out.Dir)
+	}
+	if out.LimaVersion != "" {
+		_, _ = fmt.Fprintf(w, "Lima version:\t%s\n", out.LimaVersion)
+	}
+	return w.Flush()
+}
+
+func (a *app) runVMConfig(cmd *cobra.Command) error {
+	ctx := cmd.Context()
+	_, vmManager, err := a.loadVMManager()
+	if err != nil {
+		return err
+	}
+	config, err := vmManager.Config(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get VM configuration: %w", err)
+	}
+	_, err = fmt.Fprint(cmd.OutOrStdout(), config)
+	return err
+}
+
+// vmRunning reports whether the VM exists and is running
+func vmRunning(ctx context.Context, vmManager *vm.Manager) (bool, error) {
+	exists, err := vmManager.Exists(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check VM existence: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+	running, err := vmManager.IsRunning(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check VM status: %w", err)
+	}
+	return running, nil
+}
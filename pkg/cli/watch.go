@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/middlendian/llima-box/pkg/watch"
+	"github.com/spf13/cobra"
+)
+
+// watchOptions holds the watch command flags.
+type watchOptions struct {
+	interval time.Duration
+	ignore   []string
+}
+
+// NewWatchCommand creates the watch command.
+func NewWatchCommand(deps Deps) *cobra.Command {
+	a := newApp(deps)
+
+	var opts watchOptions
+
+	cmd := &cobra.Command{
+		Use:   "watch [path] -- command",
+		Short: "Re-run a command in the environment when project files change",
+		Long: `Watch a project directory on the host and re-run a command inside its
+environment whenever files change.
+
+The command runs once at startup and again after each change. Changes made
+while the command runs (including files it writes itself) don't trigger
+another run. Version control directories and node_modules are always
+ignored; use --ignore for build output.
+
+Examples:
+  # Run the tests whenever a file in the current project changes
+  llima-box watch -- go test ./...
+
+  # Rebuild a specific project, ignoring its output directory
+  llima-box watch /path/to/project --ignore dist -- npm run build`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runWatch(cmd, args, opts)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().DurationVar(&opts.interval, "interval", watch.DefaultInterval, "How often to check for changes")
+	cmd.Flags().StringArrayVar(&opts.ignore, "ignore", nil, "Ignore paths matching this glob, by name or relative path (repeatable)")
+
+	return a.bind(cmd)
+}
+
+func (a *app) runWatch(cmd *cobra.Command, args []string, opts watchOptions) error {
+	projectPath, command, err := parseShellArgs(cmd, args)
+	if err != nil {
+		return fmt.Errorf("failed to parse arguments: %w", err)
+	}
+	if len(command) == 0 {
+		return fmt.Errorf("no command specified (usage: llima-box watch [path] -- command)")
+	}
+
+	host, err := a.loadHost()
+	if err != nil {
+		return err
+	}
+
+	watcher, err := watch.New(projectPath, opts.interval, append(watch.DefaultIgnore, opts.ignore...))
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+
+	envManager, environment, err := a.prepareEnvironment(ctx, host, projectPath, "", false, false, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = envManager.Close() }()
+
+	sessionVars, err := a.sessionEnv(environment)
+	if err != nil {
+		return err
+	}
+
+	enterOpts := env.EnterOptions{Budget: host.SessionBudget(environment.ProjectPath), Env: sessionVars}
+	commandStr := strings.Join(command, " ")
+	for {
+		if err := a.runWatchedCommand(ctx, envManager, environment, command, enterOpts); err != nil {
+			return err
+		}
+
+		// Output written by the command shouldn't trigger the next run
+		if err := watcher.Reset(); err != nil {
+			return err
+		}
+		a.log.Info("Watching %s for changes (Ctrl-C to stop)", projectPath)
+
+		changed, err := watcher.Next(ctx)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		a.log.Info("%s changed; running %s", describeChanges(changed), commandStr)
+	}
+}
+
+// runWatchedCommand runs one iteration of the watched command and reports
+// how it ended. Failures don't stop the watch; only a used-up daily session
+// budget does, since every later run would be refused too.
+func (a *app) runWatchedCommand(ctx context.Context, envManager *env.Manager, environment *env.Environment, command []string, opts env.EnterOptions) error {
+	started := time.Now()
+	err := envManager.EnterNamespace(ctx, environment, command, opts)
+	elapsed := time.Since(started).Round(time.Millisecond)
+
+	switch status := ssh.ExitStatus(err); {
+	case errors.Is(err, env.ErrDailyBudgetUsed):
+		return env.ErrDailyBudgetUsed
+	case errors.Is(err, env.ErrSessionTimeLimit):
+		a.log.Warning("Command stopped after %s: %v", elapsed, env.ErrSessionTimeLimit)
+	case err == nil:
+		a.log.Success("Command finished in %s", elapsed)
+	case status >= 0:
+		a.log.Warning("Command exited with status %d after %s", status, elapsed)
+	default:
+		a.log.Error("Command failed: %v", err)
+	}
+	return nil
+}
+
+// describeChanges summarizes changed paths for the log
+func describeChanges(changed []string) string {
+	if len(changed) == 1 {
+		return changed[0]
+	}
+	return fmt.Sprintf("%s and %d more", changed[0], len(changed)-1)
+}
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// yamlLinePattern finds the line number in yaml.v3's error messages
+	yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+	// unknownFieldPattern matches yaml.v3's message for a key the target
+	// type doesn't have
+	unknownFieldPattern = regexp.MustCompile(`^field (\S+) not found in type (\S+)$`)
+
+	// fieldPathPattern matches the field path validation errors start with,
+	// such as "vm" or "sessions.projects[~/src]"
+	fieldPathPattern = regexp.MustCompile(`^[A-Za-z]+(\[[^\]]*\])*(\.[A-Za-z0-9._:-]+(\[[^\]]*\])*)*$`)
+
+	// wordPattern matches a word that may be a key
+	wordPattern = regexp.MustCompile(`^[A-Za-z]+$`)
+)
+
+// decodeFile decodes the YAML configuration in data, read from path, into
+// out. Unlike yaml.Unmarshal it rejects keys out doesn't have, so a typo
+// such as "memroy: 8GiB" is an error rather than silently ignored. All
+// problems found are reported, each as "path:line: message".
+func decodeFile(path string, data []byte, out any) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err := dec.Decode(out)
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return fmt.Errorf("failed to parse %s", formatYAMLError(path, err.Error(), nil))
+	}
+	keys := knownKeys(reflect.TypeOf(out))
+	msgs := make([]string, len(typeErr.Errors))
+	for i, msg := range typeErr.Errors {
+		msgs[i] = formatYAMLError(path, msg, keys)
+	}
+	return fmt.Errorf("failed to parse %s", strings.Join(msgs, "\n  "))
+}
+
+// DecodeFile decodes a YAML file read from path into out the way the host
+// and project configuration are read, for other llima-box files such as
+// environment templates: unknown keys are errors, and messages give the
+// line they're about. validate, if set, checks the decoded value; its
+// errors should start with the field path of the setting they're about.
+func DecodeFile(path string, data []byte, out any, validate func() error) error {
+	if err := decodeFile(path, data, out); err != nil {
+		return err
+	}
+	if validate == nil {
+		return nil
+	}
+	if err := validate(); err != nil {
+		return fmt.Errorf("invalid %s: %w", errorLocation(path, data, err), err)
+	}
+	return nil
+}
+
+// formatYAMLError rewrites one of yaml.v3's error messages as
+// "path:line: message", explaining unknown keys with the keys known for
+// each type
+func formatYAMLError(path, msg string, keys map[string][]string) string {
+	location := path
+	if m := yamlLinePattern.FindStringSubmatch(msg); m != nil {
+		location, msg = path+":"+m[1], m[2]
+	}
+	msg = strings.TrimPrefix(msg, "yaml: ")
+
+	if m := unknownFieldPattern.FindStringSubmatch(msg); m != nil {
+		msg = fmt.Sprintf("unknown key %q", m[1])
+		if suggestion := closestKey(m[1], keys[m[2]]); suggestion != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		}
+	}
+	return location + ": " + msg
+}
+
+// knownKeys returns the YAML keys of every struct type reachable from t,
+// by type name as yaml.v3 reports it (such as "config.VMSettings")
+func knownKeys(t reflect.Type) map[string][]string {
+	keys := make(map[string][]string)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		if _, seen := keys[t.String()]; seen {
+			return
+		}
+		keys[t.String()] = structKeys(t, walk)
+	}
+	walk(t)
+	return keys
+}
+
+// structKeys returns the YAML keys of struct type t, including those of
+// inlined structs, calling walk for the type of every field
+func structKeys(t reflect.Type, walk func(reflect.Type)) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			names = append(names, structKeys(f.Type, walk)...)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		names = append(names, name)
+		walk(f.Type)
+	}
+	return names
+}
+
+// closestKey returns the key in known closest to key, if one is close enough
+// to be a likely typo
+func closestKey(key string, known []string) string {
+	best, bestDistance := "", 3
+	for _, k := range known {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(k)); d < bestDistance {
+			best, bestDistance = k, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Damerau-Levenshtein distance between a and b,
+// counting a swap of adjacent characters as one edit
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// errorLocation returns path, with the line of the setting a validation
+// error is about when it can be found in data, for errors starting with the
+// setting's field path (such as "vm: cpus must not be negative")
+func errorLocation(path string, data []byte, err error) string {
+	var fields []string
+	parts := strings.Split(err.Error(), ": ")
+	for _, part := range parts {
+		if !fieldPathPattern.MatchString(part) {
+			break
+		}
+		fields = append(fields, part)
+	}
+	if len(fields) == 0 {
+		return path
+	}
+	// The message usually starts with the key it's about, as in "cpus must
+	// not be negative"; it's used if the document has it
+	if len(parts) > len(fields) {
+		word, _, _ := strings.Cut(parts[len(fields)], " ")
+		if wordPattern.MatchString(word) {
+			fields = append(fields, word)
+		}
+	}
+
+	var root yaml.Node
+	if yaml.Unmarshal(data, &root) != nil || len(root.Content) == 0 {
+		return path
+	}
+	if line := findLine(root.Content[0], strings.Join(fields, ".")); line > 0 {
+		return path + ":" + strconv.Itoa(line)
+	}
+	return path
+}
+
+// findLine returns the line of the deepest node along a field path such as
+// "vm.mounts[0]" or "sessions.projects[~/src]", or 0 if not even the first
+// field is in the document
+func findLine(node *yaml.Node, fieldPath string) int {
+	line := 0
+	for _, step := range splitFieldPath(fieldPath) {
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == step {
+					line, next = node.Content[i].Line, node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(step); err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return line
+}
+
+// splitFieldPath splits "vm.mounts[0]" into "vm", "mounts", and "0". Keys in
+// brackets are kept whole, so map keys may contain dots.
+func splitFieldPath(fieldPath string) []string {
+	var steps []string
+	for fieldPath != "" {
+		switch fieldPath[0] {
+		case '.':
+			fieldPath = fieldPath[1:]
+		case '[':
+			key, rest, _ := strings.Cut(fieldPath[1:], "]")
+			steps = append(steps, key)
+			fieldPath = rest
+		default:
+			end := strings.IndexAny(fieldPath, ".[")
+			if end < 0 {
+				end = len(fieldPath)
+			}
+			steps = append(steps, fieldPath[:end])
+			fieldPath = fieldPath[end:]
+		}
+	}
+	return steps
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeFile_ReportsEveryError(t *testing.T) {
+	data := []byte("vm:\n  cpu: 4\n  memory: [8GiB]\nshel: /bin/zsh\n")
+
+	var host Host
+	err := decodeFile("config.yaml", data, &host)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		`config.yaml:2: unknown key "cpu" (did you mean "cpus"?)`,
+		"config.yaml:3: cannot unmarshal !!seq into string",
+		`config.yaml:4: unknown key "shel" (did you mean "shell"?)`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestDecodeFile_SyntaxError(t *testing.T) {
+	var host Host
+	err := decodeFile("config.yaml", []byte("vm:\n  cpus: 4\n mounts: x\n"), &host)
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to parse config.yaml:2: did not find expected key") {
+		t.Fatalf("expected a syntax error at line 2, got: %v", err)
+	}
+}
+
+func TestDecodeFile_Validate(t *testing.T) {
+	var settings struct {
+		Name string `yaml:"name"`
+	}
+	validate := func() error {
+		if settings.Name == "" {
+			return errors.New("name: must not be empty")
+		}
+		return nil
+	}
+
+	if err := DecodeFile("x.yaml", []byte("name: ok\n"), &settings, validate); err != nil {
+		t.Fatalf("expected valid settings, got %v", err)
+	}
+	err := DecodeFile("x.yaml", []byte("# comment\nname: \"\"\n"), &settings, validate)
+	if err == nil || err.Error() != "invalid x.yaml:2: name: must not be empty" {
+		t.Errorf("expected the validation error at line 2, got %v", err)
+	}
+}
+
+func TestErrorLocation(t *testing.T) {
+	data := []byte(`vm:
+  cpus: 2
+  mounts:
+    - location: ~/src
+    - location: src
+sessions:
+  projects:
+    ~/work.d:
+      maxDaily: 1500ms
+`)
+
+	tests := []struct {
+		err  string
+		want string
+	}{
+		{err: "vm: cpus must not be negative", want: "config.yaml:2"},
+		{err: "vm: mounts[1]: location \"src\" must be absolute", want: "config.yaml:5"},
+		{err: "sessions.projects[~/work.d]: maxDaily must be a whole number of seconds", want: "config.yaml:9"},
+		{err: "vm: unknown mountType \"nfs\"", want: "config.yaml:1"},
+		{err: "shell: \"zsh\" must be an absolute path", want: "config.yaml"},
+		{err: "maintenance[0]: invalid name", want: "config.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err, func(t *testing.T) {
+			if got := errorLocation("config.yaml", data, errors.New(tt.err)); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Package config loads llima-box configuration files.
+//
+// # Project Configuration
+//
+// A project can describe how its environment is provisioned in
+// .llima-box/config.yaml at the project root:
+//
+//	toolchains:
+//	  - name: node-22
+//	    install: |
+//	      curl -fsSL https://nodejs.org/dist/v22.11.0/node-v22.11.0-linux-arm64.tar.xz |
+//	        tar -xJ -C "$LAYER" --strip-components=1
+//
+// Each toolchain is built once inside the VM by running its install script
+// with $LAYER pointing at an empty directory. The result is cached as a shared
+// read-only layer and mounted at /opt/toolchains/<name> in every environment
+// that declares the same toolchain, so later environments skip the build.
+//
+// Apt packages can also be imported from a Dockerfile the project already
+// maintains. Packages installed with apt-get install in the selected stage
+// (and the stages it builds on) are installed into the VM; other RUN steps are
+// reported and skipped:
+//
+//	dockerfile:
+//	  path: Dockerfile
+//	  stage: dev
+//
+// Named command templates are run inside the environment with llima-box run;
+// see env.ExpandCommand for the variables they can use:
+//
+//	commands:
+//	  test: pytest {args}
+//
+// Variables from the project's .env file are passed to sessions when they
+// match the allow list; see Project.SessionEnv:
+//
+//	dotenv:
+//	  allow: [DATABASE_URL, "APP_*"]
+//
+// A setup script in .llima-box/setup.sh runs once in each new environment,
+// as its user; see env.SetupCommand.
+//
+// The CPU and memory a project expects to need are hints checked against
+// the VM's remaining capacity when its environment is created:
+//
+//	resources:
+//	  cpus: 2
+//	  memory: 4G
+//
+// A missing project configuration file is not an error; it simply yields an
+// empty configuration.
+//
+// # Host Configuration
+//
+// Per-user settings live in ~/.config/llima-box/config.yaml (or under
+// $XDG_CONFIG_HOME). Maintenance tasks run inside the VM on a cron schedule:
+//
+//	maintenance:
+//	  - name: prune-pip-cache
+//	    schedule: "0 3 * * 0"
+//	    command: rm -rf /root/.cache/pip
+//
+// Leaving maintenance unset keeps the default tasks (package upgrades, apt
+// cache cleanup, /tmp pruning, journal vacuuming); an empty list disables
+// them.
+//
+// Anonymous usage reports are sent only when telemetry is enabled, to the
+// configured endpoint; see the telemetry package for what they contain:
+//
+//	telemetry:
+//	  enabled: true
+//	  endpoint: https://telemetry.example.com/llima-box
+//
+// # Validation
+//
+// Both files are checked strictly: unknown keys, values of the wrong type,
+// and invalid settings are errors giving the file and line, so a typo such as
+// "memroy: 8GiB" isn't silently ignored.
+package config
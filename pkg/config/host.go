@@ -0,0 +1,650 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// HostConfigFile is the host configuration file name inside the config directory
+const HostConfigFile = "config.yaml"
+
+// taskNamePattern restricts maintenance task names to safe file name components
+var taskNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// instanceNamePattern matches Lima instance names
+var instanceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// sizePattern matches sizes in Lima's notation, such as "8GiB" or "512M"
+var sizePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)? ?([KMGTP]i?)?B?$`)
+
+// mountTypes are the mount drivers Lima supports
+var mountTypes = map[string]bool{"reverse-sshfs": true, "9p": true, "virtiofs": true}
+
+// outputThemes are the themes of the CLI's messages (see internal/log)
+var outputThemes = map[string]bool{"default": true, "emoji": true, "plain": true}
+
+// cronKeywords are the schedule shorthands understood by cron
+var cronKeywords = map[string]bool{
+	"@reboot": true, "@yearly": true, "@annually": true, "@monthly": true,
+	"@weekly": true, "@daily": true, "@midnight": true, "@hourly": true,
+}
+
+// Host is the per-user llima-box configuration
+type Host struct {
+	// Maintenance lists scheduled tasks run inside the VM. Leaving it unset
+	// uses DefaultMaintenanceTasks; an empty list disables maintenance.
+	Maintenance []MaintenanceTask `yaml:"maintenance"`
+
+	// Guard configures the confirmation prompt used by `shell --guard`
+	Guard Guard `yaml:"guard"`
+
+	// Sessions limits how long environments can be used
+	Sessions SessionLimits `yaml:"sessions"`
+
+	// Approval configures the hook consulted before destructive operations
+	Approval ApprovalHook `yaml:"approval"`
+
+	// VM overrides the built-in VM configuration. Changes apply when the VM
+	// is next created.
+	VM VMSettings `yaml:"vm"`
+
+	// Shell is the login shell for new environment users (default:
+	// /bin/bash). Existing environments keep theirs.
+	Shell string `yaml:"shell"`
+
+	// Retry configures connecting to the VM over SSH
+	Retry RetrySettings `yaml:"retry"`
+
+	// Setup limits environment setups running at once
+	Setup SetupSettings `yaml:"setup"`
+
+	// Paths restricts which directories can be project directories
+	Paths PathRules `yaml:"paths"`
+
+	// References are host directories mounted read-only into every
+	// environment under /mnt/ref
+	References []Reference `yaml:"references"`
+
+	// Telemetry sends anonymous usage reports. It's off unless enabled.
+	Telemetry Telemetry `yaml:"telemetry"`
+
+	// Hooks runs host commands when environments are created and deleted
+	// and when commands in them finish
+	Hooks Hooks `yaml:"hooks"`
+
+	// Output configures how the CLI shows its messages
+	Output OutputSettings `yaml:"output"`
+}
+
+// OutputSettings configure the CLI's messages on standard error. Output for
+// scripts and --output json aren't affected.
+type OutputSettings struct {
+	// Theme marks each message's level: "default" with colored level names,
+	// "emoji" with severity icons, or "plain" with ASCII words and no colors,
+	// for screen readers and terminals without color
+	Theme string `yaml:"theme"`
+}
+
+// Hooks are shell commands run on the host at points in environments'
+// lifecycles, with the environment described in LLIMA_BOX_* variables (see
+// the hooks package). Empty commands are skipped.
+type Hooks struct {
+	// PreCreate runs before a new environment is set up; failing stops the
+	// creation
+	PreCreate string `yaml:"preCreate"`
+
+	// PostCreate runs once a new environment is set up
+	PostCreate string `yaml:"postCreate"`
+
+	// PreDelete runs before an environment is deleted; failing stops the
+	// deletion
+	PreDelete string `yaml:"preDelete"`
+
+	// PostExec runs when a shell or command in an environment finishes
+	PostExec string `yaml:"postExec"`
+
+	// Timeout bounds how long each hook may run (default: 5m)
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Telemetry configures opt-in usage reports: which commands and flags are
+// used and what kind of error they end with. Paths, arguments, and error
+// messages are never sent; see the telemetry package.
+type Telemetry struct {
+	// Enabled turns reporting on
+	Enabled bool `yaml:"enabled"`
+
+	// Endpoint is the http or https URL each report is POSTed to as JSON.
+	// It's required when reporting is enabled.
+	Endpoint string `yaml:"endpoint"`
+}
+
+// Reference is a host directory environments can read but not write, such
+// as a shared datasets folder or a sibling repository
+type Reference struct {
+	// Name is the directory name under /mnt/ref (default: the base name of
+	// Path)
+	Name string `yaml:"name"`
+
+	// Path is the host directory ("~/" is expanded). Like a project
+	// directory, it must be under a VM mount and not a denied path.
+	Path string `yaml:"path"`
+}
+
+// MountName returns the directory name the reference appears under
+func (r Reference) MountName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return filepath.Base(filepath.Clean(r.Path))
+}
+
+// PathRules lists directories that are never mounted into an environment.
+// The filesystem root and directories containing the whole home directory
+// are always refused.
+type PathRules struct {
+	// Deny lists directories that can't be a project directory, be inside
+	// one, or contain one ("~/" is expanded). Leaving it unset uses
+	// DefaultDeniedPaths; an empty list allows every directory below home.
+	Deny []string `yaml:"deny"`
+}
+
+// VMSettings override the built-in Lima configuration. Unset fields keep
+// the built-in values.
+type VMSettings struct {
+	// Instance is the Lima instance name (default: llima-box)
+	Instance string `yaml:"instance"`
+
+	// CPUs is the number of virtual CPUs
+	CPUs int `yaml:"cpus"`
+
+	// Memory and Disk are sizes such as "8GiB"
+	Memory string `yaml:"memory"`
+	Disk   string `yaml:"disk"`
+
+	// MountType is Lima's mount driver: reverse-sshfs, 9p, or virtiofs
+	MountType string `yaml:"mountType"`
+
+	// Mounts replaces the host directories mounted into the VM (default:
+	// the home directory, writable). Environments can only be created for
+	// directories under a mount.
+	Mounts []Mount `yaml:"mounts"`
+
+	// IdleTimeout stops the VM once no environment has had processes
+	// running for this long. It takes effect while the host agent runs
+	// (see `llima-box daemon`); zero keeps the VM running.
+	IdleTimeout time.Duration `yaml:"idleTimeout"`
+
+	// Timeouts bound limactl commands, so a hung limactl fails the command
+	// instead of blocking llima-box
+	Timeouts VMTimeouts `yaml:"timeouts"`
+}
+
+// VMTimeouts bound limactl commands; zero keeps the default
+type VMTimeouts struct {
+	// Query bounds commands reading the VM's state, such as limactl list
+	// (default: 1m)
+	Query time.Duration `yaml:"query"`
+
+	// Lifecycle bounds creating, starting, stopping, and deleting the VM
+	// (default: 30m)
+	Lifecycle time.Duration `yaml:"lifecycle"`
+}
+
+// Mount is a host directory mounted into the VM
+type Mount struct {
+	// Location is the host directory; "~" is the home directory
+	Location string `yaml:"location"`
+
+	// MountPoint is where the directory appears in the VM (default: the
+	// same path as on the host)
+	MountPoint string `yaml:"mountPoint"`
+
+	// Writable lets environments write to the directory
+	Writable bool `yaml:"writable"`
+}
+
+// RetrySettings configure retries with exponential backoff. Zero values
+// keep the defaults.
+type RetrySettings struct {
+	// MaxAttempts is the number of attempts before giving up
+	MaxAttempts int `yaml:"maxAttempts"`
+
+	// InitialDelay is the wait before the first retry, doubling after each
+	InitialDelay time.Duration `yaml:"initialDelay"`
+
+	// MaxDelay caps the wait between retries
+	MaxDelay time.Duration `yaml:"maxDelay"`
+}
+
+// SetupSettings limit how many environments llima-box processes set up at
+// once, so a burst of agents asking for environments waits in line instead
+// of provisioning them all in parallel
+type SetupSettings struct {
+	// MaxConcurrent is how many setups run at once (default: 2)
+	MaxConcurrent int `yaml:"maxConcurrent"`
+}
+
+// ApprovalHook runs a command that approves or denies destructive
+// operations such as delete and delete-all, even when --force skips the
+// confirmation prompt
+type ApprovalHook struct {
+	// Command is run through sh with the request as JSON on standard input;
+	// exiting with status 0 approves. Empty disables the hook.
+	Command string `yaml:"command"`
+
+	// Timeout bounds the wait for a decision (default: 10m). No decision
+	// within it denies the operation.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// SessionBudget limits the time spent in an environment. Zero values mean
+// no limit.
+type SessionBudget struct {
+	// MaxSession is the longest a single session may run
+	MaxSession time.Duration `yaml:"maxSession"`
+
+	// MaxDaily is the total session time allowed per day (UTC)
+	MaxDaily time.Duration `yaml:"maxDaily"`
+}
+
+// IsZero reports whether the budget sets no limits
+func (b SessionBudget) IsZero() bool {
+	return b.MaxSession == 0 && b.MaxDaily == 0
+}
+
+// SessionLimits holds the session budget for all environments and
+// overrides for individual projects
+type SessionLimits struct {
+	// The default budget, for every environment
+	SessionBudget `yaml:",inline"`
+
+	// Projects overrides the default for projects, keyed by project path
+	// ("~/" is expanded). Unset fields keep the default.
+	Projects map[string]SessionBudget `yaml:"projects"`
+}
+
+// Guard lists command patterns that need host approval before they run in
+// a guarded environment
+type Guard struct {
+	// Patterns are POSIX extended regular expressions matched against each
+	// command line. Leaving it unset uses DefaultGuardPatterns.
+	Patterns []string `yaml:"patterns"`
+}
+
+// MaintenanceTask is a cron-scheduled command run as root inside the VM
+type MaintenanceTask struct {
+	// Name identifies the task (used for locks and log files)
+	Name string `yaml:"name"`
+
+	// Schedule is a five-field cron expression or a keyword such as @daily
+	Schedule string `yaml:"schedule"`
+
+	// Command is the shell command to run
+	Command string `yaml:"command"`
+}
+
+// DefaultMaintenanceTasks returns the tasks that keep a long-lived VM healthy
+func DefaultMaintenanceTasks() []MaintenanceTask {
+	return []MaintenanceTask{
+		{
+			Name:     "apt-upgrade",
+			Schedule: "@weekly",
+			Command:  "apt-get update && DEBIAN_FRONTEND=noninteractive apt-get -y upgrade",
+		},
+		{
+			Name:     "apt-clean",
+			Schedule: "@weekly",
+			Command:  "apt-get clean",
+		},
+		{
+			Name:     "tmp-prune",
+			Schedule: "@daily",
+			Command:  "find /tmp /var/tmp -xdev -type f -atime +7 -delete",
+		},
+		{
+			Name:     "journal-vacuum",
+			Schedule: "@weekly",
+			Command:  "journalctl --vacuum-time=30d",
+		},
+		{
+			// Environments' audit logs grow with every session; a log
+			// past 10 MiB replaces the previous rotated one
+			Name:     "audit-rotate",
+			Schedule: "@daily",
+			Command:  "find /envs -mindepth 2 -maxdepth 2 -name audit.log -type f -size +10M -exec mv -f {} {}.1 \\;",
+		},
+	}
+}
+
+// DefaultGuardPatterns returns the patterns for commonly destructive commands:
+// recursive rm, forced git push, and piping a download into a shell
+func DefaultGuardPatterns() []string {
+	return []string{
+		`(^|[;&|[:space:]])rm[[:space:]]+(-[[:alnum:]]*[[:space:]]+)*-[[:alnum:]]*[rR]`,
+		`git[[:space:]]+push([[:space:]].*)?[[:space:]](--force|-f)([[:space:]=]|$)`,
+		`(curl|wget)[^|]*\|[[:space:]]*(sudo[[:space:]]+)?(ba|z|da)?sh([[:space:]]|$)`,
+	}
+}
+
+// DefaultDeniedPaths returns directories holding credentials that agents
+// shouldn't see: SSH and GPG keys, cloud and cluster credentials, and the
+// stores of password managers and the macOS keychain
+func DefaultDeniedPaths() []string {
+	return []string{
+		"~/.ssh",
+		"~/.gnupg",
+		"~/.aws",
+		"~/.azure",
+		"~/.config/gcloud",
+		"~/.kube",
+		"~/.docker",
+		"~/.config/gh",
+		"~/.config/op",
+		"~/.password-store",
+		"~/Library/Keychains",
+		"~/Library/Group Containers",
+	}
+}
+
+// ConfigDir returns the llima-box configuration directory,
+// honoring XDG_CONFIG_HOME (default: ~/.config/llima-box)
+func ConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "llima-box"), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "llima-box"), nil
+}
+
+// StateDir returns the directory for llima-box runtime state on the host,
+// honoring XDG_STATE_HOME (default: ~/.local/state/llima-box)
+func StateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "llima-box"), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".local", "state", "llima-box"), nil
+}
+
+// HostConfigPath returns the path of the host configuration file
+func HostConfigPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, HostConfigFile), nil
+}
+
+// LoadHost loads the host configuration.
+// Returns the defaults if the configuration file doesn't exist.
+func LoadHost() (*Host, error) {
+	path, err := HostConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return LoadHostFile(path)
+}
+
+// LoadHostFile loads the host configuration from path. A missing file gives
+// the defaults, as for LoadHost.
+func LoadHostFile(path string) (*Host, error) {
+	host := &Host{}
+
+	data, err := os.ReadFile(path) // #nosec G304 -- path is the user's own config file
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err == nil {
+		if err := decodeFile(path, data, host); err != nil {
+			return nil, err
+		}
+	}
+
+	if host.Maintenance == nil {
+		host.Maintenance = DefaultMaintenanceTasks()
+	}
+	if host.Guard.Patterns == nil {
+		host.Guard.Patterns = DefaultGuardPatterns()
+	}
+	if host.Paths.Deny == nil {
+		host.Paths.Deny = DefaultDeniedPaths()
+	}
+
+	if err := host.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", errorLocation(path, data, err), err)
+	}
+
+	return host, nil
+}
+
+// Validate checks the host configuration for errors
+func (h *Host) Validate() error {
+	seen := make(map[string]bool)
+	for i, task := range h.Maintenance {
+		if !taskNamePattern.MatchString(task.Name) {
+			return fmt.Errorf("maintenance[%d]: invalid name %q", i, task.Name)
+		}
+		if seen[task.Name] {
+			return fmt.Errorf("maintenance[%d]: duplicate name %q", i, task.Name)
+		}
+		seen[task.Name] = true
+
+		if err := validateSchedule(task.Schedule); err != nil {
+			return fmt.Errorf("maintenance[%d]: %w", i, err)
+		}
+		if strings.TrimSpace(task.Command) == "" {
+			return fmt.Errorf("maintenance[%d]: command is required", i)
+		}
+		if strings.ContainsAny(task.Command, "\n\r") {
+			return fmt.Errorf("maintenance[%d]: command must be a single line", i)
+		}
+	}
+
+	for i, pattern := range h.Guard.Patterns {
+		if strings.ContainsAny(pattern, "\n\r") {
+			return fmt.Errorf("guard.patterns[%d]: pattern must be a single line", i)
+		}
+		if _, err := regexp.CompilePOSIX(pattern); err != nil {
+			return fmt.Errorf("guard.patterns[%d]: %w", i, err)
+		}
+	}
+
+	if err := validateBudget(h.Sessions.SessionBudget); err != nil {
+		return fmt.Errorf("sessions: %w", err)
+	}
+	for path, budget := range h.Sessions.Projects {
+		if err := validateBudget(budget); err != nil {
+			return fmt.Errorf("sessions.projects[%s]: %w", path, err)
+		}
+	}
+
+	if h.Approval.Timeout < 0 {
+		return fmt.Errorf("approval: timeout must not be negative")
+	}
+	if h.Approval.Timeout != 0 && strings.TrimSpace(h.Approval.Command) == "" {
+		return fmt.Errorf("approval: timeout is set but command is empty")
+	}
+
+	if h.Hooks.Timeout < 0 {
+		return fmt.Errorf("hooks: timeout must not be negative")
+	}
+
+	if err := h.VM.validate(); err != nil {
+		return fmt.Errorf("vm: %w", err)
+	}
+	if h.Shell != "" && (!filepath.IsAbs(h.Shell) || strings.ContainsAny(h.Shell, " \t\n\r")) {
+		return fmt.Errorf("shell: %q must be an absolute path", h.Shell)
+	}
+	if h.Retry.MaxAttempts < 0 {
+		return fmt.Errorf("retry: maxAttempts must not be negative")
+	}
+	if h.Retry.InitialDelay < 0 || h.Retry.MaxDelay < 0 {
+		return fmt.Errorf("retry: delays must not be negative")
+	}
+	if h.Setup.MaxConcurrent < 0 {
+		return fmt.Errorf("setup: maxConcurrent must not be negative")
+	}
+	for i, p := range h.Paths.Deny {
+		if !strings.HasPrefix(p, "~/") && !filepath.IsAbs(p) {
+			return fmt.Errorf("paths.deny[%d]: %q must be absolute or start with ~/", i, p)
+		}
+	}
+
+	refs := make(map[string]bool)
+	for i, r := range h.References {
+		if !strings.HasPrefix(r.Path, "~/") && !filepath.IsAbs(r.Path) {
+			return fmt.Errorf("references[%d]: path %q must be absolute or start with ~/", i, r.Path)
+		}
+		name := r.MountName()
+		if !instanceNamePattern.MatchString(name) {
+			return fmt.Errorf("references[%d]: invalid name %q", i, name)
+		}
+		if refs[name] {
+			return fmt.Errorf("references[%d]: duplicate name %q", i, name)
+		}
+		refs[name] = true
+	}
+
+	if h.Telemetry.Enabled && h.Telemetry.Endpoint == "" {
+		return fmt.Errorf("telemetry: endpoint is required when enabled")
+	}
+	if h.Telemetry.Endpoint != "" {
+		u, err := url.Parse(h.Telemetry.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("telemetry: endpoint %q must be an http or https URL", h.Telemetry.Endpoint)
+		}
+	}
+
+	if h.Output.Theme != "" && !outputThemes[h.Output.Theme] {
+		return fmt.Errorf("output: theme %q is unknown (use default, emoji, or plain)", h.Output.Theme)
+	}
+	return nil
+}
+
+// ValidateInstanceName checks that name can be used as a Lima instance name
+func ValidateInstanceName(name string) error {
+	if !instanceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid instance name %q", name)
+	}
+	return nil
+}
+
+// validate checks the VM settings
+func (v *VMSettings) validate() error {
+	if v.Instance != "" {
+		if err := ValidateInstanceName(v.Instance); err != nil {
+			return err
+		}
+	}
+	if v.CPUs < 0 {
+		return fmt.Errorf("cpus must not be negative")
+	}
+	if v.IdleTimeout < 0 {
+		return fmt.Errorf("idleTimeout must not be negative")
+	}
+	if v.Timeouts.Query < 0 || v.Timeouts.Lifecycle < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	for name, size := range map[string]string{"memory": v.Memory, "disk": v.Disk} {
+		if size != "" && !sizePattern.MatchString(size) {
+			return fmt.Errorf("%s: invalid size %q (use a size such as 8GiB)", name, size)
+		}
+	}
+	if v.MountType != "" && !mountTypes[v.MountType] {
+		return fmt.Errorf("unknown mountType %q (use reverse-sshfs, 9p, or virtiofs)", v.MountType)
+	}
+	for i, m := range v.Mounts {
+		if m.Location == "" {
+			return fmt.Errorf("mounts[%d]: location is required", i)
+		}
+		if m.Location != "~" && !strings.HasPrefix(m.Location, "~/") && !filepath.IsAbs(m.Location) {
+			return fmt.Errorf("mounts[%d]: location %q must be absolute or start with ~/", i, m.Location)
+		}
+		if m.MountPoint != "" && !filepath.IsAbs(m.MountPoint) {
+			return fmt.Errorf("mounts[%d]: mountPoint %q must be absolute", i, m.MountPoint)
+		}
+	}
+	return nil
+}
+
+// SessionBudget returns the session budget for the project at projectPath
+func (h *Host) SessionBudget(projectPath string) SessionBudget {
+	budget := h.Sessions.SessionBudget
+	for key, override := range h.Sessions.Projects {
+		if expandUserHome(key) != filepath.Clean(projectPath) {
+			continue
+		}
+		if override.MaxSession != 0 {
+			budget.MaxSession = override.MaxSession
+		}
+		if override.MaxDaily != 0 {
+			budget.MaxDaily = override.MaxDaily
+		}
+	}
+	return budget
+}
+
+// ExpandHome replaces a leading "~" in p with home, the way Lima and shells
+// expand it. p is returned as it is if it doesn't start with "~" or "~/", or
+// if home is empty.
+func ExpandHome(p, home string) string {
+	switch {
+	case home == "":
+		return p
+	case p == "~":
+		return home
+	case strings.HasPrefix(p, "~/"):
+		return filepath.Join(home, p[2:])
+	}
+	return p
+}
+
+// expandUserHome expands a leading "~" in p to the user's home directory
+// and cleans the result
+func expandUserHome(p string) string {
+	home, _ := os.UserHomeDir()
+	return filepath.Clean(ExpandHome(p, home))
+}
+
+// validateBudget checks that a session budget's limits are whole seconds
+// and not negative
+func validateBudget(b SessionBudget) error {
+	for name, d := range map[string]time.Duration{"maxSession": b.MaxSession, "maxDaily": b.MaxDaily} {
+		if d < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+		if d%time.Second != 0 {
+			return fmt.Errorf("%s must be a whole number of seconds", name)
+		}
+	}
+	return nil
+}
+
+// validateSchedule checks that a schedule is a cron keyword or has five fields
+func validateSchedule(schedule string) error {
+	if strings.HasPrefix(schedule, "@") {
+		if !cronKeywords[schedule] {
+			return fmt.Errorf("unknown schedule keyword %q", schedule)
+		}
+		return nil
+	}
+	if len(strings.Fields(schedule)) != 5 {
+		return fmt.Errorf("schedule %q must have five fields (minute hour day month weekday)", schedule)
+	}
+	return nil
+}
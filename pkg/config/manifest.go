@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Manifest declares the environments that should exist, for `llima-box
+// apply`. Environments it doesn't list are removed when it's applied.
+type Manifest struct {
+	// Environments are the declared environments
+	Environments []DeclaredEnvironment `yaml:"environments"`
+}
+
+// DeclaredEnvironment is one environment of a Manifest. Its packages,
+// toolchains, and labels come from the project's own configuration file, as
+// for any environment.
+type DeclaredEnvironment struct {
+	// Path is the host project directory ("~/" is expanded)
+	Path string `yaml:"path"`
+
+	// Workspace names a VM workspace instead of a host project
+	Workspace string `yaml:"workspace"`
+
+	// Template is the template a new environment is created from
+	Template string `yaml:"template"`
+
+	// Overlay gives a new environment a copy-on-write overlay of its
+	// project
+	Overlay bool `yaml:"overlay"`
+
+	// CPUs, Memory, and Swap are the environment's resource limits, as
+	// for `shell --cpus`, `--memory`, and `--swap`. Unset means no limit.
+	CPUs   float64 `yaml:"cpus"`
+	Memory string  `yaml:"memory"`
+	Swap   string  `yaml:"swap"`
+}
+
+// ProjectPath returns the environment's project directory with "~/"
+// expanded, or "" for a VM workspace
+func (d DeclaredEnvironment) ProjectPath() string {
+	if d.Path == "" {
+		return ""
+	}
+	return expandUserHome(d.Path)
+}
+
+// LoadManifest loads a manifest from path
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- the manifest the user asked for
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := decodeFile(path, data, &manifest); err != nil {
+		return nil, err
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", errorLocation(path, data, err), err)
+	}
+	return &manifest, nil
+}
+
+// Validate checks the manifest for errors
+func (m *Manifest) Validate() error {
+	for i, d := range m.Environments {
+		switch {
+		case d.Path == "" && d.Workspace == "":
+			return fmt.Errorf("environments[%d]: path or workspace is required", i)
+		case d.Path != "" && d.Workspace != "":
+			return fmt.Errorf("environments[%d]: path and workspace can't both be set", i)
+		case d.Workspace != "" && d.Template != "":
+			return fmt.Errorf("environments[%d]: VM workspaces can't have a template", i)
+		case d.Workspace != "" && d.Overlay:
+			return fmt.Errorf("environments[%d]: VM workspaces can't have an overlay", i)
+		case d.CPUs < 0:
+			return fmt.Errorf("environments[%d]: cpus must not be negative", i)
+		}
+		if d.Memory != "" && !memorySizePattern.MatchString(strings.TrimSpace(d.Memory)) {
+			return fmt.Errorf("environments[%d]: memory size %q is invalid (use a size such as 4G or 512M)", i, d.Memory)
+		}
+		if d.Swap != "" && !strings.EqualFold(strings.TrimSpace(d.Swap), "max") && !memorySizePattern.MatchString(strings.TrimSpace(d.Swap)) {
+			return fmt.Errorf("environments[%d]: swap size %q is invalid (use a size such as 1G, 0, or max)", i, d.Swap)
+		}
+	}
+	return nil
+}
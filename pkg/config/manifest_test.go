@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantLen int
+		wantErr string
+	}{
+		{
+			name: "projects and workspaces",
+			content: `environments:
+  - path: ~/src/api
+    template: python-ml
+    overlay: true
+    cpus: 2
+    memory: 4G
+  - workspace: scratch
+    swap: max
+`,
+			wantLen: 2,
+		},
+		{
+			name:    "empty file",
+			content: "",
+		},
+		{
+			name:    "unknown key",
+			content: "environments:\n  - path: ~/src/api\n    overlayy: true\n",
+			wantErr: "overlayy",
+		},
+		{
+			name:    "neither path nor workspace",
+			content: "environments:\n  - template: node\n",
+			wantErr: "path or workspace is required",
+		},
+		{
+			name:    "both path and workspace",
+			content: "environments:\n  - path: ~/src/api\n    workspace: scratch\n",
+			wantErr: "can't both be set",
+		},
+		{
+			name:    "workspace overlay",
+			content: "environments:\n  - workspace: scratch\n    overlay: true\n",
+			wantErr: "can't have an overlay",
+		},
+		{
+			name:    "invalid memory",
+			content: "environments:\n  - path: ~/src/api\n    memory: lots\n",
+			wantErr: ":3: environments[0]: memory size",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "envs.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			manifest, err := LoadManifest(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadManifest() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadManifest() failed: %v", err)
+			}
+			if len(manifest.Environments) != tt.wantLen {
+				t.Errorf("got %d environments, want %d", len(manifest.Environments), tt.wantLen)
+			}
+		})
+	}
+}
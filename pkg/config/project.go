@@ -0,0 +1,252 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/dotenv"
+)
+
+const (
+	// ProjectDir is the per-project llima-box directory
+	ProjectDir = ".llima-box"
+
+	// ProjectConfigFile is the project configuration file name inside ProjectDir
+	ProjectConfigFile = "config.yaml"
+
+	// ProjectSetupFile is the setup script run in each new environment, inside
+	// ProjectDir
+	ProjectSetupFile = "setup.sh"
+)
+
+// Workspace modes a project can choose for its new environments
+const (
+	// WorkspaceBind mounts the host project read-write (the default)
+	WorkspaceBind = "bind"
+
+	// WorkspaceOverlay gives the environment a copy-on-write overlay of the
+	// host project
+	WorkspaceOverlay = "overlay"
+)
+
+// toolchainNamePattern restricts toolchain names to safe path components
+var toolchainNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// commandNamePattern restricts command template names to what's easy to
+// type on the command line
+var commandNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._:-]*$`)
+
+// memorySizePattern matches the memory sizes env.ParseMemorySize accepts,
+// such as "4G" or "512MiB"
+var memorySizePattern = regexp.MustCompile(`^(?i)[0-9]+(\.[0-9]+)? ?[KMGT]?(i?B)?$`)
+
+// Project is the per-project configuration
+type Project struct {
+	// Toolchains are shared read-only layers mounted into the environment
+	Toolchains []Toolchain `yaml:"toolchains"`
+
+	// Dockerfile imports apt packages from a Dockerfile in the project
+	Dockerfile *DockerfileSource `yaml:"dockerfile"`
+
+	// Commands are named command templates run inside the environment with
+	// `llima-box run <name>`
+	Commands map[string]string `yaml:"commands"`
+
+	// Labels are free-form key/value pairs published to programs inside the
+	// environment in its sandbox metadata
+	Labels map[string]string `yaml:"labels"`
+
+	// Dotenv passes variables from a .env file to sessions
+	Dotenv *DotenvSource `yaml:"dotenv"`
+
+	// Resources are the CPU and memory the project expects to need
+	Resources *Resources `yaml:"resources"`
+
+	// Workspace is how new environments see the project: WorkspaceBind or
+	// WorkspaceOverlay. Empty means bind, unless --overlay is given.
+	Workspace string `yaml:"workspace"`
+}
+
+// Resources are a project's expected CPU and memory needs. They're hints:
+// nothing is reserved or limited, but creating an environment warns when the
+// VM can't fit them next to the needs other environments declared.
+type Resources struct {
+	// CPUs is the number of cores the project expects to keep busy (e.g. 2)
+	CPUs float64 `yaml:"cpus"`
+
+	// Memory is the memory the project expects to use (e.g. 4G or 512M)
+	Memory string `yaml:"memory"`
+}
+
+// DotenvSource selects the .env file and the variables from it that are
+// passed to sessions. Only allowed variables leave the host, and only for
+// the length of a session; nothing is written into the VM.
+type DotenvSource struct {
+	// Path is the .env file relative to the project root (default: .env)
+	Path string `yaml:"path"`
+
+	// Allow lists the variable names to pass, as names or globs like APP_*
+	Allow []string `yaml:"allow"`
+}
+
+// DockerfileSource selects the Dockerfile (and build stage) to import
+// provisioning from
+type DockerfileSource struct {
+	// Path is the Dockerfile path relative to the project root
+	Path string `yaml:"path"`
+
+	// Stage is the build stage to import; empty selects the last stage
+	Stage string `yaml:"stage"`
+}
+
+// Toolchain describes a cached provisioning layer
+type Toolchain struct {
+	// Name is the toolchain name, used as the mount directory name
+	Name string `yaml:"name"`
+
+	// Install is a bash script that installs the toolchain into $LAYER
+	Install string `yaml:"install"`
+}
+
+// ProjectConfigPath returns the path of the project configuration file
+func ProjectConfigPath(projectPath string) string {
+	return filepath.Join(projectPath, ProjectDir, ProjectConfigFile)
+}
+
+// DockerfilePath returns the absolute path of the project's Dockerfile, or
+// "" if none is configured
+func (p *Project) DockerfilePath(projectPath string) string {
+	if p.Dockerfile == nil {
+		return ""
+	}
+	return filepath.Join(projectPath, p.Dockerfile.Path)
+}
+
+// SessionEnv returns the allowed variables from the project's .env file, or
+// nil if none is configured. A configured file that doesn't exist yields no
+// variables.
+func (p *Project) SessionEnv(projectPath string) ([]dotenv.Var, error) {
+	if p.Dotenv == nil {
+		return nil, nil
+	}
+
+	name := p.Dotenv.Path
+	if name == "" {
+		name = ".env"
+	}
+	path := filepath.Join(projectPath, name)
+	data, err := os.ReadFile(path) // #nosec G304 -- path is inside the user's project directory
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	vars, err := dotenv.Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return dotenv.Filter(vars, p.Dotenv.Allow), nil
+}
+
+// LoadProject loads the project configuration for the given project path.
+// Returns an empty configuration if the project has no configuration file.
+func LoadProject(projectPath string) (*Project, error) {
+	path := ProjectConfigPath(projectPath)
+
+	data, err := os.ReadFile(path) // #nosec G304 -- path is derived from the user's project directory
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Project{}, nil
+		}
+		return nil, fmt.Errorf("failed to read project config: %w", err)
+	}
+
+	var project Project
+	if err := decodeFile(path, data, &project); err != nil {
+		return nil, err
+	}
+
+	if err := project.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid project config %s: %w", errorLocation(path, data, err), err)
+	}
+
+	return &project, nil
+}
+
+// Validate checks the project configuration for errors
+func (p *Project) Validate() error {
+	seen := make(map[string]bool)
+	for i, tc := range p.Toolchains {
+		if !toolchainNamePattern.MatchString(tc.Name) {
+			return fmt.Errorf("toolchains[%d]: invalid name %q", i, tc.Name)
+		}
+		if seen[tc.Name] {
+			return fmt.Errorf("toolchains[%d]: duplicate name %q", i, tc.Name)
+		}
+		seen[tc.Name] = true
+
+		if tc.Install == "" {
+			return fmt.Errorf("toolchains[%d]: install script is required", i)
+		}
+	}
+
+	for name, template := range p.Commands {
+		if !commandNamePattern.MatchString(name) {
+			return fmt.Errorf("commands: invalid name %q", name)
+		}
+		if strings.TrimSpace(template) == "" {
+			return fmt.Errorf("commands.%s: command is required", name)
+		}
+	}
+
+	for key := range p.Labels {
+		if key == "" {
+			return fmt.Errorf("labels: empty key")
+		}
+	}
+
+	if p.Dotenv != nil {
+		if len(p.Dotenv.Allow) == 0 {
+			return fmt.Errorf("dotenv: allow must list the variables to pass")
+		}
+		for _, pattern := range p.Dotenv.Allow {
+			if !dotenv.ValidPattern(pattern) {
+				return fmt.Errorf("dotenv: invalid allow pattern %q", pattern)
+			}
+		}
+		if p.Dotenv.Path != "" && !filepath.IsLocal(p.Dotenv.Path) {
+			return fmt.Errorf("dotenv: path %q must be relative to the project root", p.Dotenv.Path)
+		}
+	}
+
+	if p.Dockerfile != nil {
+		if p.Dockerfile.Path == "" {
+			return fmt.Errorf("dockerfile: path is required")
+		}
+		if !filepath.IsLocal(p.Dockerfile.Path) {
+			return fmt.Errorf("dockerfile: path %q must be relative to the project root", p.Dockerfile.Path)
+		}
+	}
+
+	if p.Resources != nil {
+		if p.Resources.CPUs < 0 {
+			return fmt.Errorf("resources: cpus must not be negative")
+		}
+		if p.Resources.Memory != "" && !memorySizePattern.MatchString(strings.TrimSpace(p.Resources.Memory)) {
+			return fmt.Errorf("resources: invalid memory size %q (use a size such as 4G or 512M)", p.Resources.Memory)
+		}
+	}
+
+	switch p.Workspace {
+	case "", WorkspaceBind, WorkspaceOverlay:
+	default:
+		return fmt.Errorf("workspace: unknown mode %q (use %s or %s)", p.Workspace, WorkspaceBind, WorkspaceOverlay)
+	}
+	return nil
+}
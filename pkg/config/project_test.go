@@ -0,0 +1,281 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeProjectConfig writes a project config file into a temporary project
+func writeProjectConfig(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ProjectDir), 0755); err != nil {
+		t.Fatalf("failed to create project dir: %v", err)
+	}
+	if err := os.WriteFile(ProjectConfigPath(dir), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write project config: %v", err)
+	}
+	return dir
+}
+
+func TestLoadProject_Missing(t *testing.T) {
+	project, err := LoadProject(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+	if len(project.Toolchains) != 0 {
+		t.Errorf("expected no toolchains, got %d", len(project.Toolchains))
+	}
+}
+
+func TestLoadProject(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantNames []string
+		wantErr   string
+	}{
+		{
+			name: "toolchains",
+			content: `toolchains:
+  - name: node-22
+    install: echo node
+  - name: python3.12
+    install: echo python
+`,
+			wantNames: []string{"node-22", "python3.12"},
+		},
+		{
+			name:    "empty file",
+			content: "",
+		},
+		{
+			name:    "invalid yaml",
+			content: "toolchains: [",
+			wantErr: "failed to parse",
+		},
+		{
+			name: "invalid name",
+			content: `toolchains:
+  - name: ../etc
+    install: echo
+`,
+			wantErr: "invalid name",
+		},
+		{
+			name: "duplicate name",
+			content: `toolchains:
+  - name: node
+    install: echo a
+  - name: node
+    install: echo b
+`,
+			wantErr: "duplicate name",
+		},
+		{
+			name: "missing install",
+			content: `toolchains:
+  - name: node
+`,
+			wantErr: "install script is required",
+		},
+		{
+			name: "dockerfile",
+			content: `dockerfile:
+  path: docker/Dockerfile
+  stage: dev
+`,
+		},
+		{
+			name: "dockerfile missing path",
+			content: `dockerfile:
+  stage: dev
+`,
+			wantErr: "path is required",
+		},
+		{
+			name: "dockerfile outside project",
+			content: `dockerfile:
+  path: ../Dockerfile
+`,
+			wantErr: "must be relative to the project root",
+		},
+		{
+			name: "dockerfile absolute path",
+			content: `dockerfile:
+  path: /etc/Dockerfile
+`,
+			wantErr: "must be relative to the project root",
+		},
+		{
+			name: "commands",
+			content: `commands:
+  test: pytest {args}
+  lint:fix: ruff check --fix .
+`,
+		},
+		{
+			name: "command with invalid name",
+			content: `commands:
+  "Run Tests": pytest
+`,
+			wantErr: "invalid name",
+		},
+		{
+			name: "empty command",
+			content: `commands:
+  test: ""
+`,
+			wantErr: "command is required",
+		},
+		{
+			name: "labels",
+			content: `labels:
+  team: platform
+  trust: untrusted
+`,
+		},
+		{
+			name: "label with empty key",
+			content: `labels:
+  "": x
+`,
+			wantErr: "empty key",
+		},
+		{
+			name: "dotenv",
+			content: `dotenv:
+  path: config/dev.env
+  allow: [DATABASE_URL, "APP_*"]
+`,
+		},
+		{
+			name: "dotenv without allow list",
+			content: `dotenv:
+  path: .env
+`,
+			wantErr: "allow must list",
+		},
+		{
+			name: "dotenv invalid pattern",
+			content: `dotenv:
+  allow: ["APP_["]
+`,
+			wantErr: "invalid allow pattern",
+		},
+		{
+			name: "dotenv outside project",
+			content: `dotenv:
+  path: ../.env
+  allow: [A]
+`,
+			wantErr: "must be relative to the project root",
+		},
+		{
+			name: "resources",
+			content: `resources:
+  cpus: 1.5
+  memory: 4GiB
+`,
+		},
+		{
+			name: "resources with negative cpus",
+			content: `resources:
+  cpus: -1
+`,
+			wantErr: "cpus must not be negative",
+		},
+		{
+			name: "resources with invalid memory",
+			content: `resources:
+  memory: lots
+`,
+			wantErr: "invalid memory size",
+		},
+		{
+			name:    "overlay workspace",
+			content: "workspace: overlay\n",
+		},
+		{
+			name:    "unknown workspace mode",
+			content: "workspace: rsync\n",
+			wantErr: `unknown mode "rsync"`,
+		},
+		{
+			name: "misspelled key",
+			content: `toolchains:
+  - name: node
+    instal: echo node
+`,
+			wantErr: `config.yaml:3: unknown key "instal" (did you mean "install"?)`,
+		},
+		{
+			name:    "unknown section",
+			content: "labels: {}\ntoolchain: []\n",
+			wantErr: `config.yaml:2: unknown key "toolchain" (did you mean "toolchains"?)`,
+		},
+		{
+			name: "invalid value reported at its line",
+			content: `labels:
+  team: platform
+dotenv:
+  path: .env
+  allow: ["APP_["]
+`,
+			wantErr: "config.yaml:3: dotenv: invalid allow pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeProjectConfig(t, tt.content)
+
+			project, err := LoadProject(dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadProject failed: %v", err)
+			}
+
+			if len(project.Toolchains) != len(tt.wantNames) {
+				t.Fatalf("expected %d toolchains, got %d", len(tt.wantNames), len(project.Toolchains))
+			}
+			for i, name := range tt.wantNames {
+				if project.Toolchains[i].Name != name {
+					t.Errorf("toolchains[%d]: expected name %q, got %q", i, name, project.Toolchains[i].Name)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionEnv(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("APP_NAME=demo\nSECRET=hunter2\nDATABASE_URL=postgres://db\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	project := &Project{Dotenv: &DotenvSource{Allow: []string{"APP_*", "DATABASE_URL"}}}
+	vars, err := project.SessionEnv(dir)
+	if err != nil {
+		t.Fatalf("SessionEnv failed: %v", err)
+	}
+	if len(vars) != 2 || vars[0].Key != "APP_NAME" || vars[1].Key != "DATABASE_URL" {
+		t.Errorf("unexpected variables: %v", vars)
+	}
+
+	if vars, err := (&Project{}).SessionEnv(dir); err != nil || vars != nil {
+		t.Errorf("expected no variables without a dotenv section, got %v, %v", vars, err)
+	}
+
+	missing := &Project{Dotenv: &DotenvSource{Path: "missing.env", Allow: []string{"*"}}}
+	if vars, err := missing.SessionEnv(dir); err != nil || vars != nil {
+		t.Errorf("expected no variables for a missing file, got %v, %v", vars, err)
+	}
+}
@@ -0,0 +1,370 @@
+// Package dockerfile extracts environment provisioning from a Dockerfile.
+//
+// Only the parts that map onto a llima-box environment are understood: apt
+// packages installed by RUN instructions (apt-get install / apt install) in
+// the selected build stage and the stages it builds on. Other RUN steps are
+// reported as skipped so callers can tell the user what wasn't imported.
+package dockerfile
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// packagePattern matches Debian package names, optionally pinned to a
+// version (pkg=1.2)
+var packagePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+(=[A-Za-z0-9.+:~-]+)?$`)
+
+// ValidPackage reports whether pkg is a Debian package name, optionally
+// pinned to a version. apt-get installs local files for arguments that look
+// like paths or end in .deb, so those are rejected.
+func ValidPackage(pkg string) bool {
+	name, _, _ := strings.Cut(pkg, "=")
+	return packagePattern.MatchString(pkg) && !strings.HasSuffix(name, ".deb")
+}
+
+// Instruction is a single Dockerfile instruction
+type Instruction struct {
+	// Command is the upper-cased instruction keyword (FROM, RUN, ...)
+	Command string
+
+	// Args is the instruction's arguments with line continuations joined.
+	// For heredocs, Args is the heredoc body.
+	Args string
+
+	// Line is the line number the instruction starts on
+	Line int
+}
+
+// Stage is a build stage started by a FROM instruction
+type Stage struct {
+	// Name is the stage name from `FROM image AS name`, if any
+	Name string
+
+	// Base is the image or stage the stage builds on
+	Base string
+
+	// Instructions are the stage's instructions after FROM
+	Instructions []Instruction
+}
+
+// Provisioning is what a Dockerfile stage contributes to an environment
+type Provisioning struct {
+	// Packages are the apt packages to install, in order of appearance
+	Packages []string
+
+	// Skipped lists RUN steps (or parts of them) that weren't imported
+	Skipped []string
+}
+
+// Load reads the Dockerfile at path and extracts the provisioning of the
+// named stage (the last stage if empty)
+func Load(path, stage string) (*Provisioning, error) {
+	f, err := os.Open(path) // #nosec G304 -- path comes from the project configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Dockerfile: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	stages, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return Extract(stages, stage)
+}
+
+// Parse splits a Dockerfile into build stages
+func Parse(r io.Reader) ([]Stage, error) {
+	instructions, err := parseInstructions(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stages []Stage
+	for _, inst := range instructions {
+		if inst.Command == "FROM" {
+			stage, err := parseFrom(inst)
+			if err != nil {
+				return nil, err
+			}
+			stages = append(stages, stage)
+			continue
+		}
+		if len(stages) == 0 {
+			// ARG may precede FROM; nothing else may
+			if inst.Command == "ARG" {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %s before FROM", inst.Line, inst.Command)
+		}
+		stages[len(stages)-1].Instructions = append(stages[len(stages)-1].Instructions, inst)
+	}
+
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("no FROM instruction found")
+	}
+	return stages, nil
+}
+
+// Extract returns the provisioning of the named stage, including the stages
+// it builds on. An empty name selects the last stage.
+func Extract(stages []Stage, name string) (*Provisioning, error) {
+	index := len(stages) - 1
+	if name != "" {
+		index = findStage(stages, name, len(stages))
+		if index < 0 {
+			return nil, fmt.Errorf("stage %q not found", name)
+		}
+	}
+
+	// Walk back through FROM <stage> references to the first stage
+	chain := []int{index}
+	for {
+		parent := findStage(stages, stages[chain[0]].Base, chain[0])
+		if parent < 0 {
+			break
+		}
+		chain = append([]int{parent}, chain...)
+	}
+
+	p := &Provisioning{}
+	seen := make(map[string]bool)
+	for _, i := range chain {
+		for _, inst := range stages[i].Instructions {
+			if inst.Command != "RUN" {
+				continue
+			}
+			packages, skipped := runPackages(inst.Args)
+			for _, pkg := range packages {
+				if !seen[pkg] {
+					seen[pkg] = true
+					p.Packages = append(p.Packages, pkg)
+				}
+			}
+			p.Skipped = append(p.Skipped, skipped...)
+		}
+	}
+	return p, nil
+}
+
+// findStage returns the index of the stage named name (or numbered, as in
+// `FROM 0`) among the first limit stages, or -1
+func findStage(stages []Stage, name string, limit int) int {
+	for i := 0; i < limit; i++ {
+		if stages[i].Name != "" && strings.EqualFold(stages[i].Name, name) {
+			return i
+		}
+		if fmt.Sprint(i) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseFrom parses `FROM [--platform=...] image [AS name]`
+func parseFrom(inst Instruction) (Stage, error) {
+	var fields []string
+	for _, f := range strings.Fields(inst.Args) {
+		if !strings.HasPrefix(f, "--") {
+			fields = append(fields, f)
+		}
+	}
+
+	switch {
+	case len(fields) == 1:
+		return Stage{Base: fields[0]}, nil
+	case len(fields) == 3 && strings.EqualFold(fields[1], "AS"):
+		return Stage{Base: fields[0], Name: fields[2]}, nil
+	default:
+		return Stage{}, fmt.Errorf("line %d: invalid FROM instruction %q", inst.Line, inst.Args)
+	}
+}
+
+// parseInstructions reads instructions, joining continuation lines and
+// collecting heredoc bodies
+func parseInstructions(r io.Reader) ([]Instruction, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var instructions []Instruction
+	lineNo := 0
+	next := func() (string, bool) {
+		if !scanner.Scan() {
+			return "", false
+		}
+		lineNo++
+		return strings.TrimRight(scanner.Text(), "\r"), true
+	}
+
+	for {
+		line, ok := next()
+		if !ok {
+			break
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		start := lineNo
+		for strings.HasSuffix(strings.TrimRight(line, " \t"), `\`) {
+			line = strings.TrimSuffix(strings.TrimRight(line, " \t"), `\`)
+			more, ok := next()
+			if !ok {
+				break
+			}
+			// Comment lines inside a continuation are dropped
+			if strings.HasPrefix(strings.TrimSpace(more), "#") {
+				more = `\`
+			}
+			line += " " + more
+		}
+
+		command, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		inst := Instruction{Command: strings.ToUpper(command), Args: strings.TrimSpace(args), Line: start}
+
+		if delim, ok := heredocDelimiter(inst.Args); ok {
+			var body []string
+			for {
+				more, ok := next()
+				if !ok {
+					return nil, fmt.Errorf("line %d: unterminated heredoc %s", start, delim)
+				}
+				if strings.TrimSpace(more) == delim {
+					break
+				}
+				body = append(body, more)
+			}
+			inst.Args = strings.Join(body, "\n")
+		} else if inst.Command == "RUN" && strings.HasPrefix(inst.Args, "[") {
+			var argv []string
+			if err := json.Unmarshal([]byte(inst.Args), &argv); err == nil {
+				inst.Args = strings.Join(argv, " ")
+			}
+		}
+
+		instructions = append(instructions, inst)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read Dockerfile: %w", err)
+	}
+	return instructions, nil
+}
+
+// heredocDelimiter returns the delimiter of a `<<EOF` or `<<'EOF'` heredoc
+// at the end of args. Heredocs with commands on the same line (`RUN bash
+// <<EOF`) have their body imported as the script, like `RUN <<EOF`.
+func heredocDelimiter(args string) (string, bool) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return "", false
+	}
+	last := fields[len(fields)-1]
+	if !strings.HasPrefix(last, "<<") {
+		return "", false
+	}
+	delim := strings.Trim(strings.TrimLeft(strings.TrimPrefix(last, "<<"), "-"), `'"`)
+	return delim, delim != ""
+}
+
+// runPackages extracts apt packages from a RUN script. Commands that don't
+// install packages are returned as skipped, except for shell options and
+// housekeeping that llima-box takes care of itself (apt-get update/clean,
+// removing apt lists).
+func runPackages(script string) (packages, skipped []string) {
+	for _, cmd := range splitCommands(script) {
+		fields := strings.Fields(cmd)
+
+		// Drop leading VAR=value assignments and sudo
+		for len(fields) > 0 && (strings.Contains(fields[0], "=") || fields[0] == "sudo") {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 || fields[0] == "set" {
+			continue
+		}
+
+		if fields[0] == "apt-get" || fields[0] == "apt" {
+			install, rejected, ok := aptInstallPackages(fields[1:])
+			if ok {
+				packages = append(packages, install...)
+				for _, arg := range rejected {
+					skipped = append(skipped, fields[0]+" install "+arg)
+				}
+				continue
+			}
+			if isAptHousekeeping(fields[1:]) {
+				continue
+			}
+		}
+		if fields[0] == "rm" && strings.Contains(cmd, "/var/lib/apt/lists") {
+			continue
+		}
+
+		skipped = append(skipped, strings.Join(fields, " "))
+	}
+	return packages, skipped
+}
+
+// aptInstallPackages returns the packages of an `apt-get install` argument
+// list. Packages given through variables can't be resolved and are dropped.
+// Other arguments that aren't package names (local .deb files, paths, URLs)
+// are returned as rejected.
+func aptInstallPackages(args []string) (packages, rejected []string, ok bool) {
+	install := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-o" || arg == "-t" || arg == "-c":
+			i++ // option with a separate value
+		case strings.HasPrefix(arg, "-"):
+		case !install:
+			if arg != "install" {
+				return nil, nil, false
+			}
+			install = true
+		case strings.Contains(arg, "$"):
+		case !ValidPackage(arg):
+			rejected = append(rejected, arg)
+		default:
+			packages = append(packages, arg)
+		}
+	}
+	return packages, rejected, install
+}
+
+// isAptHousekeeping reports whether apt arguments only refresh or clean the
+// package cache
+func isAptHousekeeping(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		switch arg {
+		case "update", "clean", "autoclean", "autoremove":
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// splitCommands splits a shell script into simple commands at &&, ||, ;,
+// pipes, and newlines. Quoting isn't interpreted; this is only used to find
+// apt invocations.
+func splitCommands(script string) []string {
+	replacer := strings.NewReplacer("&&", "\n", "||", "\n", ";", "\n", "|", "\n")
+	var commands []string
+	for _, cmd := range strings.Split(replacer.Replace(script), "\n") {
+		cmd = strings.TrimSpace(strings.Trim(strings.TrimSpace(cmd), "()"))
+		if cmd != "" && !strings.HasPrefix(cmd, "#") {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
@@ -0,0 +1,182 @@
+package dockerfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const multiStage = `# syntax=docker/dockerfile:1
+ARG BASE=ubuntu:24.04
+FROM ${BASE} AS base
+ENV DEBIAN_FRONTEND=noninteractive
+RUN apt-get update \
+    # tools for building
+    && apt-get install -y --no-install-recommends \
+        build-essential \
+        pkg-config=1.8.1-2 \
+    && rm -rf /var/lib/apt/lists/*
+
+FROM base AS dev
+RUN <<EOF
+set -eux
+apt-get -o Dpkg::Options::=--force-confnew install -y ripgrep $EXTRA
+curl -fsSL https://example.com/install.sh | sh
+EOF
+RUN ["apt-get", "install", "-y", "jq"]
+
+FROM --platform=linux/amd64 ubuntu:24.04 AS release
+RUN DEBIAN_FRONTEND=noninteractive sudo apt install -y ca-certificates
+COPY --from=dev /usr/bin/rg /usr/bin/rg
+`
+
+func TestExtract(t *testing.T) {
+	stages, err := Parse(strings.NewReader(multiStage))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(stages) != 3 {
+		t.Fatalf("Parse() returned %d stages, want 3", len(stages))
+	}
+
+	tests := []struct {
+		name         string
+		stage        string
+		wantPackages []string
+		wantSkipped  []string
+		wantErr      bool
+	}{
+		{
+			name:         "last stage by default",
+			wantPackages: []string{"ca-certificates"},
+		},
+		{
+			name:         "stage with parents",
+			stage:        "dev",
+			wantPackages: []string{"build-essential", "pkg-config=1.8.1-2", "ripgrep", "jq"},
+			wantSkipped:  []string{"curl -fsSL https://example.com/install.sh", "sh"},
+		},
+		{
+			name:         "first stage",
+			stage:        "base",
+			wantPackages: []string{"build-essential", "pkg-config=1.8.1-2"},
+		},
+		{
+			name:    "unknown stage",
+			stage:   "missing",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Extract(stages, tt.stage)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Extract() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(p.Packages, tt.wantPackages) {
+				t.Errorf("Packages = %v, want %v", p.Packages, tt.wantPackages)
+			}
+			if !reflect.DeepEqual(p.Skipped, tt.wantSkipped) {
+				t.Errorf("Skipped = %q, want %q", p.Skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestRunPackages_NonPackageArguments(t *testing.T) {
+	tests := []struct {
+		name         string
+		script       string
+		wantPackages []string
+		wantSkipped  []string
+	}{
+		{
+			name:         "relative deb file",
+			script:       "apt-get install -y ./x.deb jq",
+			wantPackages: []string{"jq"},
+			wantSkipped:  []string{"apt-get install ./x.deb"},
+		},
+		{
+			name:        "absolute path",
+			script:      "apt-get install -y /Users/me/proj/evil.deb",
+			wantSkipped: []string{"apt-get install /Users/me/proj/evil.deb"},
+		},
+		{
+			name:        "deb file name",
+			script:      "apt install -y evil.deb",
+			wantSkipped: []string{"apt install evil.deb"},
+		},
+		{
+			name:        "url",
+			script:      "apt-get install -y https://example.com/tool.deb",
+			wantSkipped: []string{"apt-get install https://example.com/tool.deb"},
+		},
+		{
+			name:         "version pin",
+			script:       "apt-get install -y pkg-config=1.8.1-2 g++",
+			wantPackages: []string{"pkg-config=1.8.1-2", "g++"},
+		},
+		{
+			name:        "shell metacharacters",
+			script:      "apt-get install -y jq`reboot`",
+			wantSkipped: []string{"apt-get install jq`reboot`"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packages, skipped := runPackages(tt.script)
+			if !reflect.DeepEqual(packages, tt.wantPackages) {
+				t.Errorf("packages = %q, want %q", packages, tt.wantPackages)
+			}
+			if !reflect.DeepEqual(skipped, tt.wantSkipped) {
+				t.Errorf("skipped = %q, want %q", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "no FROM", content: "RUN true\n"},
+		{name: "empty", content: "# nothing\n"},
+		{name: "unterminated heredoc", content: "FROM ubuntu\nRUN <<EOF\napt-get install -y git\n"},
+		{name: "invalid FROM", content: "FROM ubuntu AS\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.content)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := os.WriteFile(path, []byte(multiStage), 0644); err != nil {
+		t.Fatalf("failed to write Dockerfile: %v", err)
+	}
+
+	p, err := Load(path, "base")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(p.Packages) != 2 {
+		t.Errorf("Packages = %v, want 2 packages", p.Packages)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing"), ""); err == nil {
+		t.Error("expected error for missing Dockerfile")
+	}
+}
@@ -0,0 +1,224 @@
+// Package dotenv parses .env files.
+//
+// The format is the common subset understood by direnv's dotenv, Docker
+// Compose, and the dotenv libraries:
+//
+//	# comment
+//	PLAIN=value            # trailing comments need a space before the #
+//	export EXPORTED=value
+//	SINGLE='literal $HOME, no escapes'
+//	DOUBLE="escapes \n \t \" \\ work, and values may span lines"
+//
+// Variable references such as $HOME are not expanded.
+package dotenv
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// keyPattern matches valid variable names
+var keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Var is one variable assignment
+type Var struct {
+	Key   string
+	Value string
+}
+
+// Parse parses the contents of a .env file. Variables are returned in file
+// order; a variable assigned twice appears twice, and the last value wins
+// when they're applied in order.
+func Parse(data string) ([]Var, error) {
+	p := &parser{data: strings.ReplaceAll(data, "\r\n", "\n"), line: 1}
+	var vars []Var
+	for {
+		p.skipBlankAndComments()
+		if p.done() {
+			return vars, nil
+		}
+		v, err := p.assignment()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", p.line, err)
+		}
+		vars = append(vars, v)
+	}
+}
+
+// Filter returns the variables whose names match one of the allow patterns,
+// in order. Patterns are names or globs such as "APP_*".
+func Filter(vars []Var, allow []string) []Var {
+	var kept []Var
+	for _, v := range vars {
+		for _, pattern := range allow {
+			if ok, _ := path.Match(pattern, v.Key); ok {
+				kept = append(kept, v)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// ValidPattern reports whether pattern is a valid allow pattern
+func ValidPattern(pattern string) bool {
+	_, err := path.Match(pattern, "")
+	return pattern != "" && err == nil
+}
+
+// parser walks a .env file
+type parser struct {
+	data string
+	pos  int
+	line int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.data)
+}
+
+func (p *parser) peek() byte {
+	return p.data[p.pos]
+}
+
+func (p *parser) next() byte {
+	c := p.data[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skipSpaces skips spaces and tabs on the current line
+func (p *parser) skipSpaces() {
+	for !p.done() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipLine skips to the start of the next line
+func (p *parser) skipLine() {
+	for !p.done() && p.next() != '\n' {
+	}
+}
+
+func (p *parser) skipBlankAndComments() {
+	for !p.done() {
+		p.skipSpaces()
+		if p.done() {
+			return
+		}
+		switch p.peek() {
+		case '\n':
+			p.next()
+		case '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+// assignment parses KEY=VALUE through the end of its line
+func (p *parser) assignment() (Var, error) {
+	start := p.pos
+	for !p.done() && p.peek() != '=' && p.peek() != '\n' {
+		p.pos++
+	}
+	if p.done() || p.peek() != '=' {
+		return Var{}, fmt.Errorf("expected KEY=VALUE")
+	}
+
+	key := strings.TrimSpace(p.data[start:p.pos])
+	key = strings.TrimSpace(strings.TrimPrefix(key, "export "))
+	if !keyPattern.MatchString(key) {
+		return Var{}, fmt.Errorf("invalid variable name %q", key)
+	}
+	p.next() // '='
+	p.skipSpaces()
+
+	var value string
+	var err error
+	switch {
+	case p.done():
+	case p.peek() == '\'':
+		value, err = p.singleQuoted()
+	case p.peek() == '"':
+		value, err = p.doubleQuoted()
+	default:
+		value = p.unquoted()
+	}
+	if err != nil {
+		return Var{}, err
+	}
+
+	// Only a comment may follow the value
+	p.skipSpaces()
+	if !p.done() && p.peek() != '\n' && p.peek() != '#' {
+		return Var{}, fmt.Errorf("unexpected characters after the value of %s", key)
+	}
+	p.skipLine()
+	return Var{Key: key, Value: value}, nil
+}
+
+func (p *parser) singleQuoted() (string, error) {
+	p.next()
+	start := p.pos
+	for !p.done() && p.peek() != '\'' {
+		p.next()
+	}
+	if p.done() {
+		return "", fmt.Errorf("unterminated single-quoted value")
+	}
+	value := p.data[start:p.pos]
+	p.next()
+	return value, nil
+}
+
+func (p *parser) doubleQuoted() (string, error) {
+	p.next()
+	var b strings.Builder
+	for !p.done() {
+		c := p.next()
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.done() {
+				break
+			}
+			switch e := p.next(); e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\', '$':
+				b.WriteByte(e)
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated double-quoted value")
+}
+
+// unquoted reads a value up to the end of the line or a comment, which must
+// be preceded by whitespace
+func (p *parser) unquoted() string {
+	start := p.pos
+	for !p.done() && p.peek() != '\n' {
+		if p.peek() == '#' && p.pos > start && (p.data[p.pos-1] == ' ' || p.data[p.pos-1] == '\t') {
+			break
+		}
+		p.pos++
+	}
+	return strings.TrimSpace(p.data[start:p.pos])
+}
@@ -0,0 +1,104 @@
+package dotenv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Var
+		wantErr string
+	}{
+		{
+			name: "plain values and comments",
+			input: `# database
+DB_HOST=localhost
+DB_PORT = 5432   # default port
+EMPTY=
+URL=http://example.com/#anchor
+`,
+			want: []Var{{"DB_HOST", "localhost"}, {"DB_PORT", "5432"}, {"EMPTY", ""}, {"URL", "http://example.com/#anchor"}},
+		},
+		{
+			name:  "export prefix",
+			input: "export TOKEN=abc\n",
+			want:  []Var{{"TOKEN", "abc"}},
+		},
+		{
+			name:  "single quotes are literal",
+			input: `MSG='it costs $5 \n # not a comment'`,
+			want:  []Var{{"MSG", `it costs $5 \n # not a comment`}},
+		},
+		{
+			name:  "double quotes with escapes",
+			input: `MSG="line1\nline2 \"quoted\" \\ \$HOME"`,
+			want:  []Var{{"MSG", "line1\nline2 \"quoted\" \\ $HOME"}},
+		},
+		{
+			name:  "multi-line double-quoted value",
+			input: "KEY=\"-----BEGIN-----\nabc\n-----END-----\"\nNEXT=1\r\n",
+			want:  []Var{{"KEY", "-----BEGIN-----\nabc\n-----END-----"}, {"NEXT", "1"}},
+		},
+		{
+			name:  "duplicates kept in order",
+			input: "A=1\nA=2\n",
+			want:  []Var{{"A", "1"}, {"A", "2"}},
+		},
+		{
+			name:    "missing equals",
+			input:   "A=1\nJUSTAWORD\n",
+			wantErr: "line 2: expected KEY=VALUE",
+		},
+		{
+			name:    "invalid name",
+			input:   "1A=x",
+			wantErr: "invalid variable name",
+		},
+		{
+			name:    "unterminated quote",
+			input:   `A="abc`,
+			wantErr: "unterminated double-quoted value",
+		},
+		{
+			name:    "text after quoted value",
+			input:   `A='x' y`,
+			wantErr: "unexpected characters",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	vars := []Var{{"APP_NAME", "x"}, {"AWS_SECRET_ACCESS_KEY", "s"}, {"DATABASE_URL", "u"}, {"APP_PORT", "1"}}
+
+	got := Filter(vars, []string{"APP_*", "DATABASE_URL"})
+	want := []Var{{"APP_NAME", "x"}, {"DATABASE_URL", "u"}, {"APP_PORT", "1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if got := Filter(vars, nil); len(got) != 0 {
+		t.Errorf("expected nothing without patterns, got %v", got)
+	}
+}
@@ -0,0 +1,259 @@
+package env
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/ssh"
+)
+
+// Members of an environment archive
+const (
+	// archiveMetadata is the environment's metadata record
+	archiveMetadata = "metadata.json"
+
+	// archiveHome holds the contents of the user's home directory
+	archiveHome = "home"
+
+	// archiveWorkspace holds the workspace of an isolated environment,
+	// whose project files live in the VM
+	archiveWorkspace = "workspace"
+)
+
+// ErrEnvironmentExists is returned by Import when the environment it would
+// restore already exists
+var ErrEnvironmentExists = errors.New("environment already exists")
+
+// archiveTempPattern is the mktemp template for archives in the VM. /var/tmp
+// is on the VM disk, where a large home directory fits better than in /tmp.
+const archiveTempPattern = "/var/tmp/llima-box-archive.XXXXXX"
+
+// exportArchiveCommand returns the command writing envName's archive to a
+// temporary file in the VM, readable by the SSH user, and printing its path.
+// Each part is appended by its own tar, so each gets its own name prefix;
+// symlink targets keep their names. Files that change or vanish while they're
+// read (tar's status 1), and sockets, don't fail the export. A failed export
+// leaves no file behind.
+func exportArchiveCommand(envName, workspace string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `h=$(getent passwd %[1]s | cut -d: -f6) && [ -n "$h" ] && f=$(mktemp %[2]s) && `, envName, archiveTempPattern)
+	fmt.Fprintf(&b, `sudo tar -cf "$f" -C %s %s && `, envDir(envName), archiveMetadata)
+	appendDir := func(dir, member string) {
+		fmt.Fprintf(&b,
+			`{ sudo tar -rf "$f" --ignore-failed-read --warning=no-file-ignored -C %s --transform 's,^\.,%s,S' .; [ $? -le 1 ]; } && `,
+			dir, member,
+		)
+	}
+	appendDir(`"$h"`, archiveHome)
+	if workspace != "" {
+		appendDir(shellWord(workspace), archiveWorkspace)
+	}
+	b.WriteString(`gzip -f "$f" && echo "$f.gz" || { s=$?; rm -f "$f"; exit $s; }`)
+	return b.String()
+}
+
+// importArchiveCommand returns the command unpacking the archive at
+// archivePath into envName's home directory, and workspace if set, and
+// removing the archive either way. tar runs as the environment's user, so the files are
+// theirs and nothing in the archive can write where they couldn't.
+func importArchiveCommand(envName, workspace, archivePath string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `h=$(getent passwd %s | cut -d: -f6) && [ -n "$h" ] && chmod 0644 %s && `, envName, shellWord(archivePath))
+	unpack := func(dir, member string) {
+		fmt.Fprintf(&b,
+			`sudo -u %[1]s tar -xzf %[2]s -C %[3]s --strip-components=1 %[4]s && `,
+			envName, shellWord(archivePath), dir, member,
+		)
+	}
+	unpack(`"$h"`, archiveHome)
+	if workspace != "" {
+		unpack(shellWord(workspace), archiveWorkspace)
+	}
+	fmt.Fprintf(&b, "true; s=$?; rm -f %s; exit $s", shellWord(archivePath))
+	return b.String()
+}
+
+// Export writes a gzipped tar archive of the named environment to w: its
+// metadata, its user's home directory, and, for an isolated environment, its
+// workspace. The project directory of other environments is on the host and
+// isn't included. The archive can be restored with Import, on this host or
+// another.
+//
+// The environment keeps running; files it changes during the export may be
+// archived in either state.
+func (m *Manager) Export(ctx context.Context, envName string, w io.Writer) error {
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+
+	unlock, err := m.locks.lock(ctx, envName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	md, err := m.readMetadata(ctx, envName)
+	if err != nil {
+		return fmt.Errorf("environment %s does not exist or has no metadata: %w", envName, err)
+	}
+	workspace := md.environment(envName).workspaceDir()
+
+	output, err := m.sshClient.ExecContext(ctx, exportArchiveCommand(envName, workspace))
+	if err != nil {
+		return fmt.Errorf("failed to archive environment: %w: %s", err, strings.TrimSpace(output))
+	}
+	vmPath := strings.TrimSpace(output)
+	if i := strings.LastIndexByte(vmPath, '\n'); i >= 0 {
+		vmPath = vmPath[i+1:]
+	}
+	defer func() {
+		_, _ = m.sshClient.ExecContext(context.WithoutCancel(ctx), "rm -f "+shellWord(vmPath))
+	}()
+
+	tmp, err := os.CreateTemp("", "llima-box-export-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if err := m.sshClient.Download(ctx, vmPath, tmp.Name(), ssh.TransferOptions{}); err != nil {
+		return fmt.Errorf("failed to download archive: %w", err)
+	}
+	if _, err := io.Copy(w, tmp); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// Import restores an environment from an archive written by Export. The
+// environment is created anew for projectPath, from the template it was
+// created from, and then gets the archived home directory. An isolated
+// environment is restored to the VM workspace of the same name and
+// projectPath is ignored. An environment that already exists is left alone
+// and ErrEnvironmentExists is returned; delete it first to replace it.
+func (m *Manager) Import(ctx context.Context, projectPath string, r io.Reader) (*Environment, error) {
+	tmp, err := os.CreateTemp("", "llima-box-import-*.tar.gz")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := io.Copy(tmp, r); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	md, err := readArchive(tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	// VM workspaces are recreated in the VM; other environments are
+	// recreated for projectPath
+	inVM := md.Mount == vmOnlyMount
+	var env *Environment
+	if inVM {
+		env, err = VMWorkspace(path.Base(md.ProjectPath))
+	} else {
+		env, err = m.Resolve(projectPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	env.Template = md.Template
+
+	if err := m.ensureSSH(ctx); err != nil {
+		return nil, err
+	}
+	if !inVM {
+		if err := m.adoptRecordedName(ctx, env); err != nil {
+			return nil, err
+		}
+	}
+	checkCmd := fmt.Sprintf("id %[1]s || [ -d %[2]s ]", env.Name, envDir(env.Name))
+	if _, err := m.sshClient.ExecContext(ctx, checkCmd); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrEnvironmentExists, env.Name)
+	}
+
+	if inVM {
+		env, err = m.create(ctx, env)
+	} else {
+		env, err = m.CreateFromTemplate(ctx, projectPath, md.Template)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := m.locks.lock(ctx, env.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	vmPath := fmt.Sprintf("/var/tmp/llima-box-import-%s.tar.gz", env.Name)
+	if err := m.sshClient.Upload(ctx, tmp.Name(), vmPath, ssh.TransferOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to upload archive: %w", err)
+	}
+	if output, err := m.sshClient.ExecContext(ctx, importArchiveCommand(env.Name, env.workspaceDir(), vmPath)); err != nil {
+		return nil, fmt.Errorf("failed to restore home directory: %w: %s", err, strings.TrimSpace(output))
+	}
+	return env, nil
+}
+
+// readArchive checks that r is an environment archive and returns the
+// metadata it holds. Members outside the archive's parts, such as absolute
+// paths or ones climbing out with "..", are refused.
+func readArchive(r io.Reader) (*metadata, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not an environment archive: %w", err)
+	}
+	defer func() { _ = gz.Close() }()
+
+	var md *metadata
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not an environment archive: %w", err)
+		}
+
+		name := strings.TrimSuffix(hdr.Name, "/")
+		top, _, _ := strings.Cut(name, "/")
+		switch {
+		case path.IsAbs(hdr.Name) || name != path.Clean(name) || strings.HasPrefix(name, "../"):
+			return nil, fmt.Errorf("archive member %q is outside the environment", hdr.Name)
+		case name == archiveMetadata:
+			data, err := io.ReadAll(io.LimitReader(tr, 1<<20))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read archive metadata: %w", err)
+			}
+			if md, err = parseMetadata(string(data)); err != nil {
+				return nil, err
+			}
+		case top == archiveHome || top == archiveWorkspace:
+		default:
+			return nil, fmt.Errorf("unexpected archive member %q", hdr.Name)
+		}
+	}
+	if md == nil {
+		return nil, fmt.Errorf("not an environment archive: no %s", archiveMetadata)
+	}
+	return md, nil
+}
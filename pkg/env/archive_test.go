@@ -0,0 +1,163 @@
+package env
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// archiveMember is a file in a test archive
+type archiveMember struct {
+	name, body string
+}
+
+// buildArchive returns a gzipped tar archive of members
+func buildArchive(t *testing.T, members ...archiveMember) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, m := range members {
+		hdr := &tar.Header{Name: m.name, Mode: 0644, Size: int64(len(m.body)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(m.name, "/") {
+			hdr = &tar.Header{Name: m.name, Mode: 0755, Typeflag: tar.TypeDir}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(m.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGolden_Archive(t *testing.T) {
+	workspace := VMWorkspaceRoot + "/scratch"
+	got := fmt.Sprintf("# export\n%s\n\n# export workspace\n%s\n\n# import\n%s\n\n# import workspace\n%s\n",
+		exportArchiveCommand("app-a1b2", ""),
+		exportArchiveCommand("scratch-c3d4", workspace),
+		importArchiveCommand("app-a1b2", "", "/var/tmp/llima-box-import-app-a1b2.tar.gz"),
+		importArchiveCommand("scratch-c3d4", workspace, "/var/tmp/llima-box-import-scratch-c3d4.tar.gz"),
+	)
+	checkGolden(t, "archive", got)
+}
+
+func TestReadArchive(t *testing.T) {
+	md := archiveMember{archiveMetadata, `{"projectPath":"/Users/alice/app","version":2}`}
+
+	tests := []struct {
+		name    string
+		members []archiveMember
+		wantErr string
+	}{
+		{name: "valid", members: []archiveMember{md, {"home/", ""}, {"home/.bashrc", "alias ll='ls -l'"}}},
+		{name: "no metadata", members: []archiveMember{{"home/.bashrc", ""}}, wantErr: "no metadata.json"},
+		{name: "absolute member", members: []archiveMember{md, {"/etc/passwd", ""}}, wantErr: "outside the environment"},
+		{name: "parent member", members: []archiveMember{md, {"../.ssh/authorized_keys", ""}}, wantErr: "outside the environment"},
+		{name: "unexpected member", members: []archiveMember{md, {"etc/passwd", ""}}, wantErr: "unexpected archive member"},
+		{name: "invalid metadata", members: []archiveMember{{archiveMetadata, "{}"}}, wantErr: "no project path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readArchive(bytes.NewReader(buildArchive(t, tt.members...)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readArchive failed: %v", err)
+			}
+			if got.ProjectPath != "/Users/alice/app" {
+				t.Errorf("expected the archived metadata, got %+v", got)
+			}
+		})
+	}
+
+	if _, err := readArchive(strings.NewReader("not gzip")); err == nil || !strings.Contains(err.Error(), "not an environment archive") {
+		t.Errorf("expected a non-archive to be refused, got %v", err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	archive := buildArchive(t, archiveMember{archiveMetadata, `{"projectPath":"/Users/alice/app"}`}, archiveMember{"home/", ""})
+	vmPath := "/var/tmp/llima-box-archive.Xy12ab.gz"
+
+	mock := newMockExecutor()
+	mock.setResponse(readMetadataCommand("app-a1b2"), `{"projectPath":"/Users/alice/app"}`)
+	mock.setResponse(exportArchiveCommand("app-a1b2", ""), vmPath+"\n")
+	mock.setResponse("rm -f "+vmPath, "")
+	mock.files[vmPath] = archive
+
+	var out bytes.Buffer
+	if err := newManagerWithExecutor(mock).Export(t.Context(), "app-a1b2", &out); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), archive) {
+		t.Error("expected the archive made in the VM to be written")
+	}
+	if mock.callCount("rm -f "+vmPath) != 1 {
+		t.Error("expected the archive to be removed from the VM")
+	}
+}
+
+func TestImport(t *testing.T) {
+	projectPath := t.TempDir()
+	archive := buildArchive(t,
+		archiveMember{archiveMetadata, `{"projectPath":"/Users/alice/app","template":{"name":"node","packages":["nodejs"]}}`},
+		archiveMember{"home/", ""},
+		archiveMember{"home/.bashrc", "alias ll='ls -l'"},
+	)
+
+	t.Run("new environment", func(t *testing.T) {
+		mock := newMockExecutor()
+		mock.allowUnexpected = true
+		m := newManagerWithExecutor(mock)
+		env, err := m.Resolve(projectPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.setError(fmt.Sprintf("id %[1]s || [ -d %[2]s ]", env.Name, envDir(env.Name)), fmt.Errorf("exit status 1"))
+
+		got, err := m.Import(t.Context(), projectPath, bytes.NewReader(archive))
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if got.Name != env.Name || got.Template == nil || got.Template.Name != "node" {
+			t.Errorf("expected %s created from the archived template, got %+v", env.Name, got)
+		}
+
+		vmPath := fmt.Sprintf("/var/tmp/llima-box-import-%s.tar.gz", env.Name)
+		if !bytes.Equal(mock.files[vmPath], archive) {
+			t.Error("expected the archive to be uploaded to the VM")
+		}
+		if mock.callCount(importArchiveCommand(env.Name, "", vmPath)) != 1 {
+			t.Error("expected the home directory to be restored")
+		}
+	})
+
+	t.Run("existing environment", func(t *testing.T) {
+		mock := newMockExecutor()
+		mock.allowUnexpected = true
+		_, err := newManagerWithExecutor(mock).Import(t.Context(), projectPath, bytes.NewReader(archive))
+		if !errors.Is(err, ErrEnvironmentExists) {
+			t.Fatalf("expected ErrEnvironmentExists, got %v", err)
+		}
+		if len(mock.transfers) != 0 {
+			t.Error("expected nothing to be uploaded")
+		}
+	})
+}
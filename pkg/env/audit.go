@@ -0,0 +1,143 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+)
+
+// Kinds of audited sessions
+const (
+	// AuditShell is an interactive login shell
+	AuditShell = "shell"
+
+	// AuditCommand is a command line run by the user's shell
+	AuditCommand = "command"
+
+	// AuditExec is a program run directly, without a shell
+	AuditExec = "exec"
+)
+
+// auditLogPath returns the audit log of an environment. It's kept in the
+// VM, outside the environment, and only root can write to it, so nothing
+// run in the environment can rewrite what it ran.
+func auditLogPath(envName string) string {
+	return envDir(envName) + "/audit.log"
+}
+
+// auditRecord is a line of the audit log. Each session adds a start record
+// when it starts and an end record with its exit status when it ends; a
+// session cut short, e.g. by a VM crash, has no end record.
+type auditRecord struct {
+	Session    string    `json:"session"`
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	Kind       string    `json:"kind,omitempty"`
+	Command    []string  `json:"command,omitempty"`
+	Dir        string    `json:"dir,omitempty"`
+	ExitStatus *int      `json:"exitStatus,omitempty"`
+}
+
+// AuditEntry is a session started in an environment, as recorded in its
+// audit log
+type AuditEntry struct {
+	// Session identifies the session in the audit log
+	Session string `json:"session"`
+
+	// Kind is AuditShell, AuditCommand, or AuditExec
+	Kind string `json:"kind"`
+
+	// Command is the command as it was given; it's empty for shells
+	Command []string `json:"command,omitempty"`
+
+	// Dir is the VM directory the session started in
+	Dir string `json:"dir"`
+
+	// StartedAt is when the session started
+	StartedAt time.Time `json:"startedAt"`
+
+	// EndedAt is when the session ended, or nil if it's still running or
+	// was cut short
+	EndedAt *time.Time `json:"endedAt,omitempty"`
+
+	// ExitStatus is the session's exit status, or nil if it didn't end
+	ExitStatus *int `json:"exitStatus,omitempty"`
+}
+
+// auditScript wraps command in a script recording it in envName's audit
+// log, keeping its exit status. Like budgetScript, the script runs in the
+// VM, outside the environment.
+func auditScript(envName, kind string, cmd []string, dir, command string) (string, error) {
+	// The session, time, and event are filled in by the script; the rest of
+	// the start record is known now
+	start, err := json.Marshal(struct {
+		Kind    string   `json:"kind"`
+		Command []string `json:"command,omitempty"`
+		Dir     string   `json:"dir"`
+	}{kind, cmd, dir})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	fields := strings.TrimPrefix(string(start), "{")
+	log := shellWord(auditLogPath(envName))
+	return strings.Join([]string{
+		`audit_id=$(date +%s)-$$`,
+		fmt.Sprintf(`printf '{"session":"%%s","time":"%%s","event":"start",%%s\n' "$audit_id" "$(date -u +%%FT%%TZ)" %s | sudo tee -a %s >/dev/null`,
+			shellquote.Quote(fields), log),
+		command,
+		`audit_rc=$?`,
+		fmt.Sprintf(`printf '{"session":"%%s","time":"%%s","event":"end","exitStatus":%%d}\n' "$audit_id" "$(date -u +%%FT%%TZ)" "$audit_rc" | sudo tee -a %s >/dev/null`, log),
+		`(exit $audit_rc)`,
+	}, "\n"), nil
+}
+
+// parseAuditLog returns the sessions in an audit log, oldest first. Lines
+// that can't be decoded are skipped.
+func parseAuditLog(data string) []AuditEntry {
+	var entries []AuditEntry
+	index := make(map[string]int)
+	for _, line := range strings.Split(data, "\n") {
+		var r auditRecord
+		if json.Unmarshal([]byte(line), &r) != nil || r.Session == "" {
+			continue
+		}
+		switch r.Event {
+		case "start":
+			index[r.Session] = len(entries)
+			entries = append(entries, AuditEntry{
+				Session:   r.Session,
+				Kind:      r.Kind,
+				Command:   r.Command,
+				Dir:       r.Dir,
+				StartedAt: r.Time,
+			})
+		case "end":
+			if i, ok := index[r.Session]; ok {
+				ended := r.Time
+				entries[i].EndedAt = &ended
+				entries[i].ExitStatus = r.ExitStatus
+			}
+		}
+	}
+	return entries
+}
+
+// Audit returns the sessions started in the named environment, oldest
+// first: every shell and command EnterNamespace ran, with when it started
+// and ended and its exit status. The audit log is kept in the VM until the
+// environment is deleted; the audit-rotate maintenance task moves a large
+// log aside to audit.log.1, which is read first.
+func (m *Manager) Audit(ctx context.Context, envName string) ([]AuditEntry, error) {
+	if err := m.ensureSSH(ctx); err != nil {
+		return nil, err
+	}
+	output, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("[ -d %s ] && { sudo cat %[2]s.1 %[2]s 2>/dev/null || true; }", envDir(envName), auditLogPath(envName)))
+	if err != nil {
+		return nil, fmt.Errorf("environment %s does not exist", envName)
+	}
+	return parseAuditLog(output), nil
+}
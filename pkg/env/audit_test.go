@@ -0,0 +1,100 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuditScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+
+	cmd := []string{"grep", "-rn", `it's "$(reboot)"`, "src"}
+	script, err := auditScript("app-a1b2", AuditExec, cmd, "/Users/alice/my app", "sh -c 'echo ran; exit 3'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run the script as the VM would, logging to a temporary file
+	log := filepath.Join(t.TempDir(), "audit.log")
+	script = "sudo() { \"$@\"; }\n" + strings.ReplaceAll(script, auditLogPath("app-a1b2"), log)
+	out, err := exec.Command("sh", "-c", script).Output()
+	if status := exitStatusOf(err); status != 3 {
+		t.Fatalf("expected the command's exit status 3, got %v", err)
+	}
+	if string(out) != "ran\n" {
+		t.Errorf("expected the command's output, got %q", out)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := parseAuditLog(string(data))
+	if len(entries) != 1 {
+		t.Fatalf("expected one session, got %d in:\n%s", len(entries), data)
+	}
+	e := entries[0]
+	if e.Kind != AuditExec || !reflect.DeepEqual(e.Command, cmd) || e.Dir != "/Users/alice/my app" {
+		t.Errorf("expected the command to be recorded as given, got %+v", e)
+	}
+	if e.StartedAt.IsZero() || e.EndedAt == nil || e.ExitStatus == nil || *e.ExitStatus != 3 {
+		t.Errorf("expected start and end times and exit status 3, got %+v", e)
+	}
+}
+
+// exitStatusOf returns the exit status of a finished command, or -1
+func exitStatusOf(err error) int {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+func TestParseAuditLog(t *testing.T) {
+	log := strings.Join([]string{
+		`{"session":"1-10","time":"2026-01-02T03:04:05Z","event":"start","kind":"shell","dir":"/p"}`,
+		`{"session":"2-20","time":"2026-01-02T03:05:00Z","event":"start","kind":"command","command":["make"],"dir":"/p"}`,
+		`{"session":"2-20","time":"2026-01-02T03:06:00Z","event":"end","exitStatus":0}`,
+		`{"session":"3-30","time":"2026-01-02T03:07`,
+		`{"session":"9-90","time":"2026-01-02T03:08:00Z","event":"end","exitStatus":1}`,
+	}, "\n")
+
+	entries := parseAuditLog(log)
+	if len(entries) != 2 {
+		t.Fatalf("expected the two sessions that started, got %+v", entries)
+	}
+	if entries[0].Kind != AuditShell || entries[0].EndedAt != nil || entries[0].ExitStatus != nil {
+		t.Errorf("expected an unfinished shell first, got %+v", entries[0])
+	}
+	if entries[1].ExitStatus == nil || *entries[1].ExitStatus != 0 || entries[1].EndedAt.Sub(entries[1].StartedAt).Minutes() != 1 {
+		t.Errorf("expected make to have ended after a minute with status 0, got %+v", entries[1])
+	}
+}
+
+func TestAudit(t *testing.T) {
+	listCmd := "[ -d /envs/app-a1b2 ] && { sudo cat /envs/app-a1b2/audit.log.1 /envs/app-a1b2/audit.log 2>/dev/null || true; }"
+
+	mock := newMockExecutor()
+	mock.setResponse(listCmd, `{"session":"1-10","time":"2026-01-02T03:04:05Z","event":"start","kind":"exec","command":["ls"],"dir":"/p"}`+"\n")
+	entries, err := newManagerWithExecutor(mock).Audit(context.Background(), "app-a1b2")
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Command[0] != "ls" {
+		t.Errorf("expected the recorded session, got %+v", entries)
+	}
+
+	mock = newMockExecutor()
+	mock.setError(listCmd, fmt.Errorf("exit status 1"))
+	if _, err := newManagerWithExecutor(mock).Audit(context.Background(), "app-a1b2"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected a missing environment to be reported, got %v", err)
+	}
+}
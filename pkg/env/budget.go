@@ -0,0 +1,132 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/ssh"
+)
+
+// ErrSessionTimeLimit is returned when a session is ended because it reached
+// its time limit: the per-session maximum or what was left of the day's
+// budget
+var ErrSessionTimeLimit = errors.New("session time limit reached")
+
+// ErrDailyBudgetUsed is returned when no session is started because the
+// environment's daily session budget is used up
+var ErrDailyBudgetUsed = errors.New("daily session budget is used up")
+
+const (
+	// sessionKillGrace is how long a session gets to exit after its time is
+	// up before it's killed
+	sessionKillGrace = 10 * time.Second
+
+	// exitSessionTimeout is the status timeout(1) exits with when the
+	// limit is reached
+	exitSessionTimeout = 124
+
+	// exitBudgetUsed is the status the budget script exits with instead of
+	// starting a session (EX_TEMPFAIL)
+	exitBudgetUsed = 75
+
+	// sessionRecordDays is how long daily session records are kept
+	sessionRecordDays = 7
+)
+
+// sessionsDir returns the VM directory holding an environment's session
+// records: one directory per UTC day, one file per session holding its
+// duration in seconds
+func sessionsDir(envName string) string {
+	return envDir(envName) + "/sessions"
+}
+
+// sessionCgroupScript returns the lines moving the budget script, and so
+// the session it starts, into a cgroup of its own inside the named
+// environment's, and starting a watchdog that kills the cgroup once the
+// session's time and grace period are up. The session's command times out
+// first; the watchdog ends what it leaves behind, such as processes that
+// called setsid or daemonized, which timeout(1) doesn't reach. The watchdog
+// runs as root in the VM's root cgroup and removes the session cgroup once
+// it's empty.
+func sessionCgroupScript(envName string) string {
+	watchdog := `echo $$ > /sys/fs/cgroup/cgroup.procs; end=$(($(date +%s) + $2)); ` +
+		`while sleep 5 && [ -d "$1" ] && ! rmdir "$1" 2>/dev/null; do ` +
+		`[ "$(date +%s)" -lt "$end" ] || { echo 1 > "$1/cgroup.kill" || xargs -r kill -9 < "$1/cgroup.procs"; } 2>/dev/null; done`
+	return strings.Join([]string{
+		fmt.Sprintf(`cg=%s/session-$$`, shellWord(cgroupDir(envName))),
+		fmt.Sprintf(`{ sudo mkdir -p "$cg" && echo $$ | sudo tee "$cg/cgroup.procs" >/dev/null; } 2>/dev/null || { echo 'llima-box: failed to enforce the session time limit (the VM needs cgroup v2)' >&2; exit %d; }`, exitLimitsFailed),
+		fmt.Sprintf(`sudo setsid sh -c %s sh "$cg" $((limit + %d)) >/dev/null 2>&1 </dev/null &`, shellquote.Quote(watchdog), int(sessionKillGrace/time.Second)),
+	}, "\n")
+}
+
+// budgetScript wraps command, which must time out after "$limit" seconds,
+// in a script enforcing budget. The script runs in the VM, outside the
+// environment, so nothing in the environment can tamper with it or the
+// records it keeps. The session runs in a cgroup of its own that's killed
+// when its time is up (see sessionCgroupScript).
+//
+// A session's record first holds the whole time it was allowed and is
+// replaced with the time it took when it ends. A session cut short by a
+// lost connection or a VM crash is charged its full allowance, so the daily
+// budget can't be exceeded by dropping connections.
+func budgetScript(envName string, budget config.SessionBudget, command string) string {
+	dir := sessionsDir(envName)
+	lines := []string{
+		fmt.Sprintf("sudo find %s -mindepth 1 -maxdepth 1 -mtime +%d -exec rm -rf {} + 2>/dev/null", shellWord(dir), sessionRecordDays),
+		fmt.Sprintf(`d=%s/$(date -u +%%F)`, shellWord(dir)),
+		`sudo mkdir -p "$d" || exit 1`,
+	}
+
+	// Without a per-session maximum, a day's budget is the most a session
+	// can take
+	if budget.MaxSession > 0 {
+		lines = append(lines, "limit="+seconds(budget.MaxSession))
+	} else {
+		lines = append(lines, "limit="+seconds(budget.MaxDaily))
+	}
+
+	if budget.MaxDaily > 0 {
+		lines = append(lines,
+			`used=$(sudo cat "$d"/* 2>/dev/null | awk '{s+=$1} END {print s+0}')`,
+			fmt.Sprintf(`left=$((%s - used))`, seconds(budget.MaxDaily)),
+			`[ "$left" -lt "$limit" ] && limit=$left`,
+			fmt.Sprintf(`if [ "$limit" -le 0 ]; then echo %s >&2; exit %d; fi`,
+				shellquote.Quote(fmt.Sprintf("llima-box: the daily session budget of %s is used up", budget.MaxDaily)), exitBudgetUsed),
+		)
+	}
+
+	lines = append(lines,
+		`f="$d/$(date +%s)-$$"`,
+		`echo "$limit" | sudo tee "$f" >/dev/null`,
+		sessionCgroupScript(envName),
+		`s=$(date +%s)`,
+		command,
+		`rc=$?`,
+		`echo $(($(date +%s) - s)) | sudo tee "$f" >/dev/null`,
+		`[ "$rc" -eq `+strconv.Itoa(exitSessionTimeout)+` ] && echo "llima-box: session time limit of ${limit}s reached" >&2`,
+		`exit $rc`,
+	)
+	return strings.Join(lines, "\n")
+}
+
+// seconds formats a duration as whole seconds for the budget script
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+// budgetError translates the exit status of a budgeted session
+func budgetError(err error) error {
+	switch ssh.ExitStatus(err) {
+	case exitSessionTimeout:
+		return fmt.Errorf("%w: %w", ErrSessionTimeLimit, err)
+	case exitBudgetUsed:
+		return fmt.Errorf("%w: %w", ErrDailyBudgetUsed, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,79 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+func TestBudgetScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		budget  config.SessionBudget
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "session limit only",
+			budget:  config.SessionBudget{MaxSession: 30 * time.Minute},
+			want:    []string{"limit=1800"},
+			notWant: []string{"used=", "exit 75"},
+		},
+		{
+			name:   "daily limit only",
+			budget: config.SessionBudget{MaxDaily: 4 * time.Hour},
+			want:   []string{"limit=14400", "left=$((14400 - used))", "exit 75", "budget of 4h0m0s is used up"},
+		},
+		{
+			name:   "both limits",
+			budget: config.SessionBudget{MaxSession: time.Hour, MaxDaily: 2 * time.Hour},
+			want:   []string{"limit=3600", "left=$((7200 - used))", `[ "$left" -lt "$limit" ] && limit=$left`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := budgetScript("app-a1b2", tt.budget, "COMMAND")
+			for _, want := range append(tt.want, "d=/envs/app-a1b2/sessions/$(date -u +%F)", "cg=/sys/fs/cgroup/llima-box/app-a1b2/session-$$", `sh "$cg" $((limit + 10))`, "\nCOMMAND\nrc=$?\n", "exit $rc") {
+				if !strings.Contains(got, want) {
+					t.Errorf("script missing %q:\n%s", want, got)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("script unexpectedly contains %q:\n%s", notWant, got)
+				}
+			}
+		})
+	}
+}
+
+func TestEnterNamespace_Budget(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	m := newManagerWithExecutor(mock)
+	env := &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/app"}
+
+	opts := EnterOptions{Budget: config.SessionBudget{MaxSession: time.Minute}}
+	if err := m.EnterNamespace(t.Context(), env, []string{"make"}, opts); err != nil {
+		t.Fatalf("EnterNamespace failed: %v", err)
+	}
+
+	if len(mock.calls) != 1 {
+		t.Fatalf("expected one command, got %v", mock.calls)
+	}
+	cmd := mock.calls[0]
+	if !strings.Contains(cmd, "limit=60") || !strings.Contains(cmd, "sudo timeout --foreground --kill-after=10 ${limit}s nsenter --target=") {
+		t.Errorf("expected a budgeted command, got:\n%s", cmd)
+	}
+}
+
+func TestBudgetError(t *testing.T) {
+	if err := budgetError(fmt.Errorf("lost connection")); errors.Is(err, ErrSessionTimeLimit) || errors.Is(err, ErrDailyBudgetUsed) {
+		t.Errorf("unexpected budget error for a lost connection: %v", err)
+	}
+}
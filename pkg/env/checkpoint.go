@@ -0,0 +1,57 @@
+package env
+
+import (
+	"context"
+	"fmt"
+)
+
+// syncCommand flushes the VM's filesystems, so environment metadata and home
+// directories are on disk before the VM stops
+const syncCommand = "sudo sync"
+
+// Checkpoint prepares the VM to be stopped. It waits for environment
+// creations, repairs, and deletions in progress to finish and flushes the
+// VM's filesystems. The environments stay locked until the returned function
+// is called, so no new operation starts before the VM stops; call it once
+// the VM is stopped.
+//
+// Checkpoint doesn't start the VM: callers check that it's running first.
+func (m *Manager) Checkpoint(ctx context.Context) (func(), error) {
+	if err := m.ensureSSH(ctx); err != nil {
+		return nil, err
+	}
+
+	var unlocks []func()
+	release := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+
+	unlock, err := m.locks.lock(ctx, recoveryLockName)
+	if err != nil {
+		return nil, err
+	}
+	unlocks = append(unlocks, unlock)
+
+	envs, err := m.scanEnvironments(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	for _, env := range envs {
+		unlock, err := m.locks.lock(ctx, env.Name)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("failed to wait for %s: %w", env.Name, err)
+		}
+		unlocks = append(unlocks, unlock)
+	}
+
+	m.debugf("", "Flushing VM filesystems for %d environments", len(envs))
+	if _, err := m.sshClient.ExecContext(ctx, syncCommand); err != nil {
+		release()
+		return nil, fmt.Errorf("failed to flush VM filesystems: %w", err)
+	}
+	return release, nil
+}
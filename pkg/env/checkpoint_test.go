@@ -0,0 +1,80 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	mock := newMockExecutor()
+	mock.setResponse(scanCommand, "app-a1b2\trunning\t\nweb-c3d4\tpaused\t\n")
+	mock.setResponse(syncCommand, "")
+	m := newManagerWithExecutor(mock)
+	m.locks = &locker{dir: t.TempDir()}
+
+	release, err := m.Checkpoint(context.Background())
+	if err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if mock.callCount(syncCommand) != 1 {
+		t.Error("expected the VM's filesystems to be flushed")
+	}
+
+	// Environments stay locked until released
+	for _, name := range []string{recoveryLockName, "app-a1b2", "web-c3d4"} {
+		if _, ok, err := m.locks.tryLock(name); err != nil || ok {
+			t.Errorf("expected %s to be locked, got ok=%v err=%v", name, ok, err)
+		}
+	}
+	release()
+	unlock, ok, err := m.locks.tryLock("app-a1b2")
+	if err != nil || !ok {
+		t.Fatalf("expected the environment to be released, got ok=%v err=%v", ok, err)
+	}
+	unlock()
+}
+
+func TestCheckpoint_WaitsForOperations(t *testing.T) {
+	mock := newMockExecutor()
+	mock.setResponse(scanCommand, "app-a1b2\tprovisioning\t\n")
+	mock.setResponse(syncCommand, "")
+	m := newManagerWithExecutor(mock)
+	m.locks = &locker{dir: t.TempDir()}
+
+	// A creation in progress holds the environment's lock
+	unlock, err := m.locks.lock(context.Background(), "app-a1b2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockPollInterval)
+	defer cancel()
+	if _, err := m.Checkpoint(ctx); err == nil {
+		t.Fatal("expected Checkpoint to wait for the creation until the context ended")
+	}
+	if mock.callCount(syncCommand) != 0 {
+		t.Error("expected no flush before operations finished")
+	}
+
+	// Failed checkpoints release what they locked
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if unlockRecovery, err := m.locks.lock(ctx, recoveryLockName); err != nil {
+		t.Errorf("expected the recovery lock to be released: %v", err)
+	} else {
+		unlockRecovery()
+	}
+}
+
+func TestCheckpoint_FlushFails(t *testing.T) {
+	mock := newMockExecutor()
+	mock.setResponse(scanCommand, "")
+	mock.setError(syncCommand, fmt.Errorf("exit status 1"))
+
+	if _, err := newManagerWithExecutor(mock).Checkpoint(context.Background()); err == nil {
+		t.Error("expected an error when the flush fails")
+	}
+}
@@ -0,0 +1,309 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/helper"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// RemoteCommand is a shell command llima-box runs in the VM while setting up,
+// entering, or deleting an environment. The functions returning them don't
+// touch the VM, so the commands can be inspected and tested as they are.
+type RemoteCommand struct {
+	// Purpose says what the command is for, as in "failed to <Purpose>"
+	Purpose string
+
+	// Script is the command line, parsed by the VM user's shell
+	Script string
+
+	// BestEffort commands may fail without stopping the commands after
+	// them; the failure is reported as a warning
+	BestEffort bool
+}
+
+// StartNamespaceCommands returns the commands starting the keeper process
+// that holds an environment's mount and PID namespaces. The keeper's PID is
+// written to the environment's namespace.pid file. A keeper that's already
+// alive is kept, so two starts racing in the VM leave one namespace.
+func StartNamespaceCommands(envName string) []RemoteCommand {
+	pidFile := envDir(envName) + "/namespace.pid"
+	return []RemoteCommand{
+		{
+			Purpose: "create namespace directory",
+			Script:  fmt.Sprintf("sudo mkdir -p %s", envDir(envName)),
+		},
+		{
+			Purpose: "create namespace",
+			Script: vmLockScript(envName, fmt.Sprintf(
+				`p=$(cat %[1]s 2>/dev/null) && [ -n "$p" ] && kill -0 "$p" 2>/dev/null || { sudo unshare --mount --pid --fork --propagation private bash -c 'sleep infinity' >/dev/null 2>&1 & echo $! | sudo tee %[1]s >/dev/null; }`,
+				pidFile,
+			)),
+		},
+	}
+}
+
+// SetupNamespaceCommands returns the commands preparing env's view of the
+// filesystem inside the namespace held by pid: its workspace, as its
+// MountDriver realizes it, toolchain and reference mounts, the sandbox
+// metadata, and the login profile. References are resolved on the host
+// first, so this fails if one is missing or unsafe.
+func (m *Manager) SetupNamespaceCommands(env *Environment, project *config.Project, pid string) ([]RemoteCommand, error) {
+	cmds := env.Mount().MountCommands(env, pid)
+	cmds = append(cmds, layerMountCommands(pid, project.Toolchains)...)
+
+	refs, err := m.referenceMountCommands(env, pid)
+	if err != nil {
+		return nil, err
+	}
+	cmds = append(cmds, refs...)
+
+	info, err := sandboxInfoCommands(env, project, pid)
+	if err != nil {
+		return nil, err
+	}
+	cmds = append(cmds, info...)
+
+	return append(cmds, profileCommand(env, project.Toolchains)), nil
+}
+
+// checkEnterOptions rejects commands and options EnterNamespace can't run
+func checkEnterOptions(cmd []string, opts EnterOptions) error {
+	if !opts.Exec {
+		return nil
+	}
+	if len(cmd) == 0 {
+		return fmt.Errorf("exec needs a command")
+	}
+	if strings.Contains(cmd[0], "=") {
+		return fmt.Errorf("exec can't run a program whose name contains '=': %q", cmd[0])
+	}
+	if len(opts.GuardPatterns) > 0 {
+		return fmt.Errorf("guard patterns need a shell and can't be used with exec")
+	}
+	return nil
+}
+
+// EnterCommand returns the command EnterNamespace runs over SSH to enter
+// env's namespace as its user and run cmd, or a login shell if cmd is empty.
+// It refuses quarantined environments and joins the environment's resource
+// limits; the session's own sandbox metadata, with its limits, is named by
+// SessionInfoVar. The session is recorded in the environment's audit log and marks the
+// environment as in use while it runs. The values of opts.Env never appear in
+// the command: they're read from the session variable file written by
+// writeSessionVars.
+func EnterCommand(env *Environment, project *config.Project, cmd []string, opts EnterOptions) (string, error) {
+	if err := checkEnterOptions(cmd, opts); err != nil {
+		return "", err
+	}
+
+	kind := AuditShell
+	switch {
+	case opts.Exec:
+		kind = AuditExec
+	case len(cmd) > 0:
+		kind = AuditCommand
+	}
+	if len(opts.Env) > 0 && opts.varsFile == "" {
+		return "", fmt.Errorf("session variables need a session variable file")
+	}
+
+	var sshCmd string
+	if opts.helper {
+		var err error
+		if sshCmd, err = helperEnterCommand(env, project, cmd, opts); err != nil {
+			return "", err
+		}
+	} else {
+		sshCmd = runnerEnterCommand(env, project, cmd, opts)
+	}
+	sshCmd, err := auditScript(env.Name, kind, cmd, env.dir(), sshCmd)
+	if err != nil {
+		return "", err
+	}
+	sshCmd = heartbeatScript(env.Name, sshCmd)
+	sshCmd, err = sessionInfoScript(env.Name, newSandboxInfo(env, project, opts.Budget), sshCmd)
+	if err != nil {
+		return "", err
+	}
+	if !opts.Budget.IsZero() {
+		sshCmd = budgetScript(env.Name, opts.Budget, sshCmd)
+	}
+	return quarantineCheckScript(env.Name) + "\n" + joinLimitsScript(env.Name) + "\n" + sshCmd, nil
+}
+
+// runnerEnterCommand returns the command entering env's namespace for
+// EnterCommand when the VM has no helper
+func runnerEnterCommand(env *Environment, project *config.Project, cmd []string, opts EnterOptions) string {
+	// Commands are joined into one string for the user's shell, like ssh,
+	// unless they're executed directly
+	runner := NewRemoteRunner(env.Name).AsUser(env.Name).InDir(env.dir())
+	if opts.Exec {
+		for _, v := range sandboxVars(env) {
+			runner = runner.WithEnv(v.Key, v.Value)
+		}
+		for _, v := range templateVars(env) {
+			runner = runner.WithEnv(v.Key, v.Value)
+		}
+		runner = runner.WithEnv("PATH", toolchainPath(project.Toolchains))
+	}
+	if len(opts.Env) > 0 {
+		names := make([]string, len(opts.Env))
+		for i, v := range opts.Env {
+			names[i] = v.Key
+		}
+		runner = runner.withVarsFile(opts.varsFile, names)
+	}
+	if !opts.Budget.IsZero() {
+		runner = runner.withTimeout("${limit}s")
+	}
+	runner = runner.withEnvExpr(SessionInfoVar, sessionInfoPath())
+	switch {
+	case opts.Exec:
+		return runner.Exec(cmd...)
+	case len(cmd) > 0:
+		return runner.Script(strings.Join(cmd, " "))
+	default:
+		return runner.LoginShell()
+	}
+}
+
+// helperEnterCommand returns the command entering env's namespace for
+// EnterCommand through the helper. The session is described by one JSON
+// argument, so nothing in it is parsed by a shell on the way; the shell's
+// PID names the session's metadata file, as in sessionInfoPath.
+func helperEnterCommand(env *Environment, project *config.Project, cmd []string, opts EnterOptions) (string, error) {
+	req := helper.EnterEnvRequest{
+		Name:       env.Name,
+		Dir:        env.dir(),
+		SessionEnv: []string{SessionInfoVar + "=" + sandboxMountPoint + "/sessions/" + helper.SessionPlaceholder + ".json"},
+		VarsFile:   opts.varsFile,
+	}
+	switch {
+	case opts.Exec:
+		req.Mode, req.Command = helper.ModeExec, cmd
+		for _, v := range append(sandboxVars(env), templateVars(env)...) {
+			req.Env = append(req.Env, v.Key+"="+v.Value)
+		}
+		req.Env = append(req.Env, "PATH="+toolchainPath(project.Toolchains))
+	case len(cmd) > 0:
+		req.Mode, req.Script = helper.ModeScript, strings.Join(cmd, " ")
+	default:
+		req.Mode = helper.ModeShell
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s request: %w", helper.OpEnterEnv, err)
+	}
+	c := "sudo "
+	if !opts.Budget.IsZero() {
+		// timeout(1) runs as root, so nothing in the environment can stop
+		// it (see withTimeout)
+		c += fmt.Sprintf("timeout --foreground --kill-after=%d ${limit}s ", int(sessionKillGrace/time.Second))
+	}
+	return c + vm.HelperPath + " " + helper.OpEnterEnv + " --session $$ " + shellquote.Quote(string(data)), nil
+}
+
+// SetupCommand returns the command running the project's setup script,
+// .llima-box/setup.sh, if it has one. The script runs with bash inside env's
+// namespace as its user, from the project directory, after toolchains are
+// mounted; it stops at the first failing command.
+func SetupCommand(env *Environment) string {
+	script := config.ProjectDir + "/" + config.ProjectSetupFile
+	return NewRemoteRunner(env.Name).AsUser(env.Name).InDir(env.dir()).
+		Script(fmt.Sprintf("if [ -f %[1]s ]; then bash -eo pipefail %[1]s; fi", script))
+}
+
+// templateSetupCommand returns the command running the setup script of the
+// template env was created from. Like the project's setup script, it runs
+// with bash inside env's namespace as its user, from the project directory,
+// and stops at the first failing command.
+func templateSetupCommand(env *Environment) string {
+	return NewRemoteRunner(env.Name).AsUser(env.Name).InDir(env.dir()).
+		Command("bash", "-eo", "pipefail", "-c", env.Template.Setup)
+}
+
+// DeleteCommands returns the commands deleting an environment: its
+// processes and namespace keeper, resource limits, user account and home
+// directory, overlay, and state. workspace, when set, is the environment's VM workspace, which is removed
+// too.
+func DeleteCommands(envName, workspace string) []RemoteCommand {
+	cmds := []RemoteCommand{
+		{
+			Purpose:    "kill namespace processes",
+			Script:     fmt.Sprintf("sudo pkill -u %s || true", envName),
+			BestEffort: true,
+		},
+		// The keeper runs as root, so pkill -u leaves it behind
+		stopKeeperCommand(envName),
+		{
+			// The cgroup only exists while the VM is up and goes away once
+			// its processes have exited
+			Purpose:    "remove resource limits",
+			Script:     fmt.Sprintf("sudo rmdir %s 2>/dev/null || true", cgroupDir(envName)),
+			BestEffort: true,
+		},
+		{
+			Purpose: "delete user",
+			Script: fmt.Sprintf("if ! id %[1]s >/dev/null 2>&1; then :; elif [ -x %[2]s ]; then sudo %[2]s delete-user %[1]s; else sudo userdel -r %[1]s; fi",
+				envName, vm.HelperPath),
+		},
+	}
+	if workspace != "" {
+		cmds = append(cmds, RemoteCommand{
+			Purpose: "remove workspace",
+			Script:  fmt.Sprintf("sudo rm -rf %s", shellWord(workspace)),
+		})
+	}
+	return append(cmds, RemoteCommand{
+		Purpose: "remove workspace overlay",
+		Script:  fmt.Sprintf("sudo rm -rf %s", overlayDir(envName)),
+	}, RemoteCommand{
+		Purpose: "remove environment state",
+		Script:  fmt.Sprintf("sudo rm -rf %s", envDir(envName)),
+	})
+}
+
+// runCommands runs cmds in order, stopping at the first failure of a
+// command that isn't best-effort. The commands are sent in batches, so a
+// sequence costs one round-trip unless a best-effort command fails.
+func (m *Manager) runCommands(ctx context.Context, cmds []RemoteCommand) error {
+	for len(cmds) > 0 {
+		scripts := make([]string, len(cmds))
+		for i, c := range cmds {
+			scripts[i] = c.Script
+		}
+		results, err := m.sshClient.ExecBatch(ctx, scripts)
+
+		for i, result := range results {
+			if result.Status == 0 {
+				continue
+			}
+			c := cmds[i]
+			failure := result.Err()
+			if output := strings.TrimSpace(result.Output); output != "" {
+				failure = fmt.Errorf("%w (output: %s)", failure, output)
+			}
+			if !c.BestEffort {
+				return fmt.Errorf("failed to %s: %w", c.Purpose, failure)
+			}
+			m.warnf("", "failed to %s: %v", c.Purpose, failure)
+		}
+		if err != nil {
+			if len(results) < len(cmds) {
+				return fmt.Errorf("failed to %s: %w", cmds[len(results)].Purpose, err)
+			}
+			return err
+		}
+		// A best-effort failure stops the batch; carry on after it
+		cmds = cmds[len(results):]
+	}
+	return nil
+}
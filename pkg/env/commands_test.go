@@ -0,0 +1,182 @@
+package env
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/dotenv"
+	"github.com/middlendian/llima-box/pkg/env/templates"
+)
+
+// update rewrites the golden files with the commands generated now:
+//
+//	go test ./pkg/env -run Golden -update
+var update = flag.Bool("update", false, "update golden files in testdata/golden")
+
+// checkGolden compares got with testdata/golden/<name>.golden
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil { // #nosec G306 -- test data
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path) // #nosec G304 -- test data
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("commands differ from %s (run with -update if the change is intended)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// formatCommands renders commands for a golden file
+func formatCommands(cmds []RemoteCommand) string {
+	var b strings.Builder
+	for _, c := range cmds {
+		fmt.Fprintf(&b, "# %s", c.Purpose)
+		if c.BestEffort {
+			b.WriteString(" (best effort)")
+		}
+		fmt.Fprintf(&b, "\n%s\n\n", c.Script)
+	}
+	return b.String()
+}
+
+func TestGolden_StartNamespace(t *testing.T) {
+	checkGolden(t, "start_namespace", formatCommands(StartNamespaceCommands("app-a1b2")))
+}
+
+func TestGolden_SetupNamespace(t *testing.T) {
+	project := &config.Project{
+		Toolchains: []config.Toolchain{{Name: "node-22", Install: "tar -xJ -C \"$LAYER\""}},
+		Labels:     map[string]string{"trust": "untrusted"},
+	}
+
+	tests := []struct {
+		name string
+		env  *Environment
+	}{
+		{name: "setup_namespace", env: &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/my app"}},
+		{name: "setup_namespace_workspace", env: &Environment{Name: "scratch-c3d4", ProjectPath: VMWorkspaceRoot + "/scratch", Driver: vmOnlyMount}},
+		{name: "setup_namespace_overlay", env: &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/my app", Driver: config.WorkspaceOverlay}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newManagerWithExecutor(newMockExecutor())
+			cmds, err := m.SetupNamespaceCommands(tt.env, project, "4242")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tt.name, formatCommands(cmds))
+		})
+	}
+}
+
+func TestGolden_Enter(t *testing.T) {
+	env := &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/my app"}
+	project := &config.Project{Toolchains: []config.Toolchain{{Name: "go", Install: "true"}}}
+
+	tests := []struct {
+		name string
+		cmd  []string
+		opts EnterOptions
+	}{
+		{name: "enter_shell"},
+		{name: "enter_command", cmd: []string{"git", "status", "&&", "make"}},
+		{name: "enter_exec", cmd: []string{"grep", "-rn", "$(reboot); *", "src"}, opts: EnterOptions{Exec: true}},
+		{
+			name: "enter_budget",
+			cmd:  []string{"claude"},
+			opts: EnterOptions{
+				Budget:   config.SessionBudget{MaxSession: 30 * time.Minute, MaxDaily: 2 * time.Hour},
+				Env:      []dotenv.Var{{Key: "API_TOKEN", Value: "it's secret"}},
+				varsFile: sessionVarsDir + "/f00d",
+			},
+		},
+		{
+			name: "enter_exec_vars",
+			cmd:  []string{"make"},
+			opts: EnterOptions{
+				Exec:     true,
+				Env:      []dotenv.Var{{Key: "API_TOKEN", Value: "it's secret"}},
+				varsFile: sessionVarsDir + "/f00d",
+			},
+		},
+		{name: "enter_shell_helper", opts: EnterOptions{helper: true}},
+		{
+			name: "enter_budget_helper",
+			cmd:  []string{"claude"},
+			opts: EnterOptions{
+				Budget:   config.SessionBudget{MaxSession: 30 * time.Minute, MaxDaily: 2 * time.Hour},
+				Env:      []dotenv.Var{{Key: "API_TOKEN", Value: "it's secret"}},
+				varsFile: sessionVarsDir + "/f00d",
+				helper:   true,
+			},
+		},
+		{
+			name: "enter_exec_helper",
+			cmd:  []string{"grep", "-rn", "$(reboot); *", "src"},
+			opts: EnterOptions{Exec: true, helper: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EnterCommand(env, project, tt.cmd, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tt.name, got+"\n")
+		})
+	}
+}
+
+func TestGolden_Setup(t *testing.T) {
+	checkGolden(t, "setup", SetupCommand(&Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/my app"})+"\n")
+
+	env := &Environment{
+		Name:        "app-a1b2",
+		ProjectPath: "/Users/alice/my app",
+		Template:    &templates.Template{Name: "python-ml", Setup: "python3 -m venv \"$HOME/.venv\"\necho 'done'\n"},
+	}
+	checkGolden(t, "setup_template", templateSetupCommand(env)+"\n")
+}
+
+func TestGolden_Delete(t *testing.T) {
+	checkGolden(t, "delete", formatCommands(DeleteCommands("app-a1b2", "")))
+	checkGolden(t, "delete_workspace", formatCommands(DeleteCommands("scratch-c3d4", VMWorkspaceRoot+"/scratch")))
+}
+
+func TestRunCommands(t *testing.T) {
+	mock := newMockExecutor()
+	mock.setError("best effort", fmt.Errorf("boom"))
+	mock.setResponse("required", "no such file\n")
+	mock.setError("required", fmt.Errorf("boom"))
+	m := newManagerWithExecutor(mock)
+
+	err := m.runCommands(t.Context(), []RemoteCommand{
+		{Purpose: "try", Script: "best effort", BestEffort: true},
+		{Purpose: "do the thing", Script: "required"},
+		{Purpose: "never", Script: "after"},
+	})
+	if err == nil || err.Error() != "failed to do the thing: command failed: exit status 1 (output: no such file)" {
+		t.Errorf("expected the required command's failure with its output, got: %v", err)
+	}
+	if mock.callCount("best effort") != 1 || mock.callCount("required") != 1 || mock.callCount("after") != 0 {
+		t.Errorf("expected no commands after a failure, got %v", mock.calls)
+	}
+}
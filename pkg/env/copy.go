@@ -0,0 +1,84 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/middlendian/llima-box/pkg/ssh"
+)
+
+// sftpServer is OpenSSH's SFTP server in the VM image
+const sftpServer = "/usr/lib/openssh/sftp-server"
+
+// CopyOptions configure CopyTo and CopyFrom
+type CopyOptions struct {
+	// Recursive copies directories and everything in them. Without it,
+	// copying a directory is an error.
+	Recursive bool
+
+	// Progress, when set, is called as data is copied
+	Progress func(ssh.TransferProgress)
+}
+
+// copyPath resolves p inside env. Paths in a VM workspace are confined to
+// it; elsewhere, relative paths are relative to the project directory.
+func copyPath(env *Environment, p string) (string, error) {
+	if !env.Mount().HostProject() {
+		return workspacePath(env, p)
+	}
+	if path.IsAbs(p) {
+		return path.Clean(p), nil
+	}
+	return path.Join(env.dir(), p), nil
+}
+
+// transferOptions returns options for a transfer through an SFTP server
+// running as env's user inside its namespace. Files are read and written
+// with that user's permissions, so symlinks in the environment can't reach
+// anything the user couldn't, and copies land where the environment sees
+// them.
+func transferOptions(env *Environment, opts CopyOptions) ssh.TransferOptions {
+	return ssh.TransferOptions{
+		Recursive: opts.Recursive,
+		Progress:  opts.Progress,
+		Server:    NewRemoteRunner(env.Name).AsUser(env.Name).Exec(sftpServer),
+	}
+}
+
+// CopyTo copies a host file or directory into env over SFTP. dst is relative
+// to the project directory (the workspace, for an isolated environment); an
+// existing directory receives the copy inside it. The files are written as
+// the environment's user.
+func (m *Manager) CopyTo(ctx context.Context, env *Environment, hostPath, dst string, opts CopyOptions) error {
+	vmPath, err := copyPath(env, dst)
+	if err != nil {
+		return err
+	}
+
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+	if err := m.sshClient.Upload(ctx, hostPath, vmPath, transferOptions(env, opts)); err != nil {
+		return fmt.Errorf("failed to copy %s into %s: %w", hostPath, env.Name, err)
+	}
+	return nil
+}
+
+// CopyFrom copies a file or directory from env to the host over SFTP. src is
+// relative to the project directory (the workspace, for an isolated
+// environment). The files are read as the environment's user.
+func (m *Manager) CopyFrom(ctx context.Context, env *Environment, src, hostPath string, opts CopyOptions) error {
+	vmPath, err := copyPath(env, src)
+	if err != nil {
+		return err
+	}
+
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+	if err := m.sshClient.Download(ctx, vmPath, hostPath, transferOptions(env, opts)); err != nil {
+		return fmt.Errorf("failed to copy %s from %s: %w", src, env.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	project := &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/app", VMPath: "/mnt/host/app"}
+	workspace := &Environment{Name: "scratch-c3d4", ProjectPath: VMWorkspaceRoot + "/scratch", Driver: vmOnlyMount}
+
+	tests := []struct {
+		name    string
+		env     *Environment
+		upload  bool
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "relative to the project", env: project, upload: true, path: "data", want: "/mnt/host/app/data"},
+		{name: "absolute in a project environment", env: project, path: "/tmp/out.log", want: "/tmp/out.log"},
+		{name: "relative to the workspace", env: workspace, path: "dist", want: workspace.ProjectPath + "/dist"},
+		{name: "absolute in a workspace", env: workspace, upload: true, path: "/dist", want: workspace.ProjectPath + "/dist"},
+		{name: "outside the workspace", env: workspace, path: "../other", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			m := newManagerWithExecutor(mock)
+			opts := CopyOptions{Recursive: true}
+
+			var err error
+			if tt.upload {
+				err = m.CopyTo(t.Context(), tt.env, "/Users/alice/file", tt.path, opts)
+			} else {
+				err = m.CopyFrom(t.Context(), tt.env, tt.path, "/Users/alice/file", opts)
+			}
+			if tt.wantErr {
+				if err == nil || len(mock.transfers) != 0 {
+					t.Fatalf("expected an error and no transfer, got %v, %+v", err, mock.transfers)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("copy failed: %v", err)
+			}
+
+			if len(mock.transfers) != 1 {
+				t.Fatalf("expected one transfer, got %+v", mock.transfers)
+			}
+			tr := mock.transfers[0]
+			vmPath := tr.src
+			if tr.upload {
+				vmPath = tr.dst
+			}
+			if tr.upload != tt.upload || vmPath != tt.want {
+				t.Errorf("expected upload=%v with VM path %s, got %+v", tt.upload, tt.want, tr)
+			}
+			if !tr.opts.Recursive {
+				t.Error("expected the recursive option to be passed on")
+			}
+			wantServer := "--setuid=$(id -u " + tt.env.Name + ")"
+			if !strings.Contains(tr.opts.Server, wantServer) || !strings.HasSuffix(tr.opts.Server, " "+sftpServer) {
+				t.Errorf("expected the SFTP server to run as %s, got %s", tt.env.Name, tr.opts.Server)
+			}
+		})
+	}
+}
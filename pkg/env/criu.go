@@ -0,0 +1,192 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrCRIUUnavailable is returned by CheckpointProcesses and RestoreProcesses
+// when CRIU isn't installed in the VM
+var ErrCRIUUnavailable = errors.New("CRIU is not installed in the VM")
+
+// criuCheckCommand succeeds if CRIU is installed in the VM
+const criuCheckCommand = "command -v criu >/dev/null"
+
+// criuOptions are passed to both criu dump and criu restore: open TCP
+// connections, sockets connected outside the environment, and file locks
+// are saved and restored, and the project, toolchain, and reference bind
+// mounts are matched with the VM's mounts of the same sources
+const criuOptions = "--tcp-established --ext-unix-sk --file-locks --ext-mount-map auto --enable-external-sharing --enable-external-masters"
+
+// processesDir returns the directory holding the CRIU images of an
+// environment's checkpointed processes
+func processesDir(envName string) string {
+	return envDir(envName) + "/processes"
+}
+
+// namespaceInitScript prints the PID of the first process of the named
+// environment's PID namespace, the root of the tree CRIU dumps. It walks
+// down from the namespace keeper until a process is in another PID
+// namespace, since the keeper is started through sudo and unshare.
+func namespaceInitScript(envName string) string {
+	return fmt.Sprintf(
+		`p=$(sudo cat %s) && ns=$(sudo readlink /proc/"$p"/ns/pid) && while [ "$(sudo readlink /proc/"$p"/ns/pid)" = "$ns" ]; do p=$(pgrep -o -P "$p") || exit 1; done && echo "$p"`,
+		envDir(envName)+"/namespace.pid",
+	)
+}
+
+// CheckpointProcessesCommands returns the commands saving the named
+// environment's process tree with CRIU, which stops the processes once
+// they're saved. The environment is then marked as paused, so recovery
+// doesn't start a fresh namespace over it after a VM restart, and its
+// namespace keeper is cleared. An earlier checkpoint is replaced.
+func CheckpointProcessesCommands(envName string) []RemoteCommand {
+	dir := processesDir(envName)
+	pidFile := envDir(envName) + "/namespace.pid"
+	return []RemoteCommand{
+		{
+			Purpose: "clear previous process checkpoint",
+			Script:  fmt.Sprintf("sudo rm -rf %[1]s && sudo mkdir -p %[1]s", dir),
+		},
+		{
+			Purpose: "checkpoint environment processes",
+			Script: fmt.Sprintf(`init=$(%s) && sudo criu dump --tree "$init" --images-dir %s --log-file dump.log %s`,
+				namespaceInitScript(envName), dir, criuOptions),
+		},
+		{
+			Purpose: "mark environment as paused",
+			Script:  fmt.Sprintf("sudo touch %s", pausedPath(envName)),
+		},
+		{
+			Purpose: "stop namespace keeper",
+			Script:  fmt.Sprintf(`pid=$(sudo cat %[1]s 2>/dev/null) && [ -n "$pid" ] && sudo kill "$pid" 2>/dev/null; sudo rm -f %[1]s`, pidFile),
+		},
+	}
+}
+
+// RestoreProcessesCommands returns the commands restoring the processes
+// saved by CheckpointProcessesCommands in a new namespace. The restored
+// namespace's first process becomes the environment's namespace keeper, and
+// the images are removed, since processes can only be restored once.
+func RestoreProcessesCommands(envName string) []RemoteCommand {
+	dir := processesDir(envName)
+	return []RemoteCommand{
+		{
+			Purpose: "restore environment processes",
+			Script: fmt.Sprintf("sudo criu restore --images-dir %[1]s --log-file restore.log --restore-detached --pidfile %[1]s/restored.pid %[2]s",
+				dir, criuOptions),
+		},
+		{
+			Purpose: "record restored namespace",
+			Script:  fmt.Sprintf("sudo cp %s/restored.pid %s/namespace.pid && sudo rm -f %s", dir, envDir(envName), pausedPath(envName)),
+		},
+		{
+			Purpose:    "remove process checkpoint",
+			Script:     fmt.Sprintf("sudo rm -rf %s", dir),
+			BestEffort: true,
+		},
+	}
+}
+
+// checkCRIU returns ErrCRIUUnavailable if CRIU isn't installed in the VM
+func (m *Manager) checkCRIU(ctx context.Context) error {
+	if _, err := m.sshClient.ExecContext(ctx, criuCheckCommand); err != nil {
+		return fmt.Errorf("%w (install it in the VM, e.g. from the CRIU PPA, to checkpoint processes)", ErrCRIUUnavailable)
+	}
+	return nil
+}
+
+// CheckpointProcesses saves the processes running in the named environment
+// with CRIU and stops them, so RestoreProcesses can bring them back as they
+// were, even after the VM restarts. The environment is listed as
+// checkpointed until then.
+//
+// This is experimental. Only processes that are part of the namespace's
+// process tree are saved, such as background jobs left running after their
+// session ended: CRIU refuses to checkpoint while a session is open.
+func (m *Manager) CheckpointProcesses(ctx context.Context, envName string) error {
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+
+	unlock, err := m.locks.lock(ctx, envName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("[ -d %s ]", envDir(envName))); err != nil {
+		return fmt.Errorf("environment %s does not exist", envName)
+	}
+	if err := m.checkNotQuarantined(ctx, envName); err != nil {
+		return err
+	}
+
+	m.probes.invalidate()
+	if running, _ := m.Exists(ctx, envName); !running {
+		return fmt.Errorf("environment %s is not running, so it has no processes to checkpoint", envName)
+	}
+	if err := m.checkCRIU(ctx); err != nil {
+		return err
+	}
+
+	m.debugf(envName, "Checkpointing processes of %s", envName)
+	if err := m.runCommands(ctx, CheckpointProcessesCommands(envName)); err != nil {
+		return fmt.Errorf("%w (see %s/dump.log in the VM)", err, processesDir(envName))
+	}
+	return nil
+}
+
+// RestoreProcesses restores the processes saved by CheckpointProcesses in
+// a new namespace for the named environment. The environment must not be
+// running: a namespace started since, e.g. by shell, has to be stopped
+// first.
+func (m *Manager) RestoreProcesses(ctx context.Context, envName string) error {
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+
+	unlock, err := m.locks.lock(ctx, envName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("[ -d %s ]", envDir(envName))); err != nil {
+		return fmt.Errorf("environment %s does not exist", envName)
+	}
+	if err := m.checkNotQuarantined(ctx, envName); err != nil {
+		return err
+	}
+	if _, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("sudo test -e %s/inventory.img", processesDir(envName))); err != nil {
+		return fmt.Errorf("environment %s has no process checkpoint", envName)
+	}
+
+	m.probes.invalidate()
+	if running, _ := m.Exists(ctx, envName); running {
+		return fmt.Errorf("environment %s is running; stop it first with 'llima-box stop'", envName)
+	}
+	if err := m.checkCRIU(ctx); err != nil {
+		return err
+	}
+
+	// The toolchain layers the processes had mounted have to be there again
+	md, err := m.readMetadata(ctx, envName)
+	if err != nil {
+		return err
+	}
+	project, err := loadProject(md.environment(envName))
+	if err != nil {
+		return err
+	}
+	if err := m.ensureLayers(ctx, project.Toolchains); err != nil {
+		return err
+	}
+
+	m.debugf(envName, "Restoring processes of %s", envName)
+	if err := m.runCommands(ctx, RestoreProcessesCommands(envName)); err != nil {
+		return fmt.Errorf("%w (see %s/restore.log in the VM)", err, processesDir(envName))
+	}
+	return nil
+}
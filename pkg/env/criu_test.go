@@ -0,0 +1,120 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGolden_ProcessCheckpoint(t *testing.T) {
+	checkGolden(t, "checkpoint_processes", formatCommands(CheckpointProcessesCommands("app-a1b2")))
+	checkGolden(t, "restore_processes", formatCommands(RestoreProcessesCommands("app-a1b2")))
+}
+
+func TestCheckpointProcesses(t *testing.T) {
+	tests := []struct {
+		name      string
+		stopped   bool
+		noCRIU    bool
+		wantErr   string
+		wantCalls int
+	}{
+		{name: "running environment", wantCalls: 1},
+		{name: "stopped environment", stopped: true, wantErr: "not running"},
+		{name: "no CRIU", noCRIU: true, wantErr: ErrCRIUUnavailable.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			if tt.stopped {
+				mock.setError(existsCommand("app-a1b2"), fmt.Errorf("exit status 1"))
+			}
+			if tt.noCRIU {
+				mock.setError(criuCheckCommand, fmt.Errorf("exit status 1"))
+			}
+
+			err := newManagerWithExecutor(mock).CheckpointProcesses(context.Background(), "app-a1b2")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("CheckpointProcesses() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("CheckpointProcesses() failed: %v", err)
+			}
+
+			for _, c := range CheckpointProcessesCommands("app-a1b2") {
+				if got := mock.callCount(c.Script); got != tt.wantCalls {
+					t.Errorf("%s ran %d times, want %d", c.Purpose, got, tt.wantCalls)
+				}
+			}
+		})
+	}
+}
+
+func TestRestoreProcesses(t *testing.T) {
+	projectPath := t.TempDir()
+	checkpointed := "sudo test -e /envs/app-a1b2/processes/inventory.img"
+
+	tests := []struct {
+		name         string
+		running      bool
+		noCheckpoint bool
+		quarantined  bool
+		wantErr      string
+		wantCalls    int
+	}{
+		{name: "checkpointed environment", wantCalls: 1},
+		{name: "started again since", running: true, wantErr: "stop it first"},
+		{name: "no checkpoint", noCheckpoint: true, wantErr: "no process checkpoint"},
+		{name: "quarantined", quarantined: true, wantErr: ErrQuarantined.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			mock.setResponse(readMetadataCommand("app-a1b2"), fmt.Sprintf(`{"projectPath":%q}`, projectPath))
+			if !tt.running {
+				mock.setError(existsCommand("app-a1b2"), fmt.Errorf("exit status 1"))
+			}
+			if tt.noCheckpoint {
+				mock.setError(checkpointed, fmt.Errorf("exit status 1"))
+			}
+			if tt.quarantined {
+				mock.setError("[ ! -e /envs/app-a1b2/quarantined ]", fmt.Errorf("exit status 1"))
+			}
+
+			err := newManagerWithExecutor(mock).RestoreProcesses(context.Background(), "app-a1b2")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RestoreProcesses() error = %v, want %q", err, tt.wantErr)
+				}
+				if tt.quarantined && !errors.Is(err, ErrQuarantined) {
+					t.Errorf("expected ErrQuarantined, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("RestoreProcesses() failed: %v", err)
+			}
+
+			for _, c := range RestoreProcessesCommands("app-a1b2") {
+				if got := mock.callCount(c.Script); got != tt.wantCalls {
+					t.Errorf("%s ran %d times, want %d", c.Purpose, got, tt.wantCalls)
+				}
+			}
+		})
+	}
+}
+
+func TestParseScan_Checkpointed(t *testing.T) {
+	if !strings.Contains(scanCommand, `"$d/processes/inventory.img" && s=checkpointed`) {
+		t.Errorf("expected the scan to report checkpointed environments, got %s", scanCommand)
+	}
+	envs := parseScan("app-a1b2\tcheckpointed\t{\"projectPath\":\"/Users/me/app\",\"step\":\"setup-done\",\"version\":2}\n")
+	if len(envs) != 1 || envs[0].Status != StatusCheckpointed {
+		t.Fatalf("expected a checkpointed environment, got %+v", envs[0])
+	}
+}
@@ -0,0 +1,92 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/middlendian/llima-box/internal/linewriter"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// EventLevel is how much an Event matters to the user
+type EventLevel string
+
+const (
+	// EventDebug reports a step the manager is taking, for progress
+	// displays and troubleshooting
+	EventDebug EventLevel = "debug"
+
+	// EventWarning reports a problem the manager worked around, such as a
+	// best-effort step that failed
+	EventWarning EventLevel = "warning"
+)
+
+// Event is a progress report from a Manager operation
+type Event struct {
+	Level EventLevel
+
+	// Environment is the environment the event is about, or empty for
+	// events about the VM or several environments
+	Environment string
+
+	// Code identifies warnings programs may want to act on, such as
+	// WarningSyncedFolder; it's empty for most events
+	Code string
+
+	// Message is the report for the user. It may include names, paths,
+	// and command output read from the VM, so displays should escape
+	// control characters.
+	Message string
+}
+
+// ProgressFunc receives a Manager's events as they happen (see
+// Options.Progress). It's called from the goroutine running the operation,
+// so it should return quickly.
+type ProgressFunc func(Event)
+
+// StderrProgress writes events to stderr, debug events in gray. It's the
+// default for managers made with NewManagerWithOptions.
+func StderrProgress(e Event) {
+	switch e.Level {
+	case EventWarning:
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", e.Message)
+	default:
+		fmt.Fprintf(os.Stderr, "\033[90mDEBUG\033[0m: %s\n", e.Message)
+	}
+}
+
+// emit calls p with e, unless p is nil
+func (p ProgressFunc) emit(e Event) {
+	if p != nil {
+		p(e)
+	}
+}
+
+// debugf reports a step of an operation on envName, which is empty if the
+// step isn't about one environment
+func (m *Manager) debugf(envName, format string, args ...interface{}) {
+	m.options.Progress.emit(Event{Level: EventDebug, Environment: envName, Message: fmt.Sprintf(format, args...)})
+}
+
+// warnf reports a problem an operation on envName worked around
+func (m *Manager) warnf(envName, format string, args ...interface{}) {
+	m.options.Progress.emit(Event{Level: EventWarning, Environment: envName, Message: fmt.Sprintf(format, args...)})
+}
+
+// clientProgress reports the SSH client's warnings as the manager's own
+func (m *Manager) clientProgress(e vm.Event) {
+	level := EventDebug
+	if e.Level == vm.EventWarning {
+		level = EventWarning
+	}
+	m.options.Progress.emit(Event{Level: level, Message: e.Message})
+}
+
+// streamCommand runs cmd in the VM, reporting each line of its output, such
+// as a package install's, as a debug event about envName while it runs
+func (m *Manager) streamCommand(ctx context.Context, envName, cmd string) error {
+	lines := linewriter.New(func(line string) { m.debugf(envName, "%s", line) })
+	defer lines.Flush()
+	return m.sshClient.ExecContextStreaming(ctx, cmd, lines)
+}
@@ -0,0 +1,66 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	mock.setError("best effort", fmt.Errorf("boom"))
+
+	var events []Event
+	m := newManagerWithExecutor(mock)
+	m.options.Progress = func(e Event) { events = append(events, e) }
+
+	if err := m.Stop(context.Background(), "app-a1b2"); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if err := m.runCommands(context.Background(), []RemoteCommand{{Purpose: "try", Script: "best effort", BestEffort: true}}); err != nil {
+		t.Fatalf("runCommands failed: %v", err)
+	}
+
+	want := []Event{
+		{Level: EventDebug, Environment: "app-a1b2", Message: "Stopping app-a1b2"},
+		{Level: EventWarning, Message: "failed to try: command failed: exit status 1"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+}
+
+func TestProgressUnset(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+
+	// Managers built without a ProgressFunc stay quiet
+	if err := newManagerWithExecutor(mock).Stop(context.Background(), "app-a1b2"); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+}
+
+func TestProgress_StreamedOutput(t *testing.T) {
+	mock := newMockExecutor()
+	cmd := installPackagesCommand([]string{"ripgrep"})
+	mock.setResponse(cmd, "Reading package lists...\nSetting up ripgrep\n")
+
+	var events []Event
+	m := newManagerWithExecutor(mock)
+	m.options.Progress = func(e Event) { events = append(events, e) }
+
+	if err := m.streamCommand(context.Background(), "app-a1b2", cmd); err != nil {
+		t.Fatalf("streamCommand failed: %v", err)
+	}
+
+	// The output reaches the callback, not the host's stderr
+	want := []Event{
+		{Level: EventDebug, Environment: "app-a1b2", Message: "Reading package lists..."},
+		{Level: EventDebug, Environment: "app-a1b2", Message: "Setting up ripgrep"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+}
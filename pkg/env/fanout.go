@@ -0,0 +1,182 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/ssh"
+)
+
+// DefaultFanOutConcurrency is how many environments ExecAll runs a command in
+// at once when no concurrency is set
+const DefaultFanOutConcurrency = 8
+
+// ErrNotRunning is reported by ExecAll for matching environments whose
+// namespace isn't running; they're skipped rather than restarted
+var ErrNotRunning = errors.New("environment is not running")
+
+// ExecAllOptions configures ExecAll
+type ExecAllOptions struct {
+	// Labels selects the environments whose project configuration has all
+	// of these labels. Empty selects every environment.
+	Labels map[string]string
+
+	// Concurrency bounds how many environments run the command at once
+	// (default: DefaultFanOutConcurrency)
+	Concurrency int
+
+	// Enter configures each command. Output is collected rather than
+	// streamed, so its Session and GuardPatterns don't apply.
+	Enter EnterOptions
+
+	// Configure, when set, adjusts Enter for each environment, such as to
+	// add the variables from its project's .env file or its session budget
+	Configure func(env *Environment, opts *EnterOptions) error
+}
+
+// ExecResult is the outcome of ExecAll in one environment
+type ExecResult struct {
+	// Environment is the environment the command ran in
+	Environment *Environment
+
+	// Output is the command's combined stdout and stderr
+	Output string
+
+	// ExitStatus is the command's exit status, or -1 if it didn't run or
+	// didn't report one
+	ExitStatus int
+
+	// Duration is how long the command ran
+	Duration time.Duration
+
+	// Err explains why the command failed or didn't run; nil on success
+	Err error
+}
+
+// ExecAll runs cmd in every environment matching opts.Labels, several at a
+// time, and returns one result per environment, sorted by name, for
+// fleet-wide maintenance like clearing caches. Failures in one environment
+// don't stop the others; the error is only for failing to list them.
+func (m *Manager) ExecAll(ctx context.Context, cmd []string, opts ExecAllOptions) ([]ExecResult, error) {
+	if len(opts.Enter.GuardPatterns) > 0 {
+		return nil, fmt.Errorf("guard patterns need a terminal and can't be used across environments")
+	}
+	if err := checkEnterOptions(cmd, opts.Enter); err != nil {
+		return nil, err
+	}
+
+	envs, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultFanOutConcurrency
+	}
+	slots := make(chan struct{}, concurrency)
+
+	var results []ExecResult
+	for _, env := range envs {
+		matches, err := matchesLabels(env, opts.Labels)
+		switch {
+		case err != nil:
+			results = append(results, ExecResult{Environment: env, ExitStatus: -1, Err: err})
+		case !matches:
+			// Not selected
+		case env.Status != StatusRunning:
+			err := fmt.Errorf("%w (%s)", ErrNotRunning, env.Status)
+			results = append(results, ExecResult{Environment: env, ExitStatus: -1, Err: err})
+		default:
+			results = append(results, ExecResult{Environment: env})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(result *ExecResult) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			m.execIn(ctx, result, cmd, opts)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// execIn runs cmd in result's environment and records the outcome in result
+func (m *Manager) execIn(ctx context.Context, result *ExecResult, cmd []string, opts ExecAllOptions) {
+	env := result.Environment
+	project, err := loadProject(env)
+	if err != nil {
+		result.Err = err
+		return
+	}
+
+	enter := opts.Enter
+	if opts.Configure != nil {
+		if err := opts.Configure(env, &enter); err != nil {
+			result.Err = err
+			return
+		}
+	}
+	enter, err = m.writeSessionVars(ctx, enter)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	sshCmd, err := EnterCommand(env, project, cmd, enter)
+	if err != nil {
+		m.removeSessionVars(enter)
+		result.Err = err
+		return
+	}
+
+	started := time.Now()
+	result.Output, err = m.sshClient.ExecContext(ctx, sshCmd)
+	result.Duration = time.Since(started)
+	if err != nil {
+		m.removeSessionVars(enter)
+	}
+	output := &outputTail{}
+	_, _ = output.Write([]byte(result.Output))
+	m.recordExec(env, cmd, started, output, err)
+	result.ExitStatus = ssh.ExitStatus(err)
+	if err != nil && !enter.Budget.IsZero() {
+		err = budgetError(err)
+	}
+	result.Err = err
+}
+
+// matchesLabels reports whether env's project configuration has all of
+// labels. Environments without a host project have no labels.
+func matchesLabels(env *Environment, labels map[string]string) (bool, error) {
+	if len(labels) == 0 {
+		return true, nil
+	}
+	if !env.Mount().HostProject() || env.ProjectPath == "" {
+		return false, nil
+	}
+
+	project, err := loadProject(env)
+	if err != nil {
+		return false, err
+	}
+	for k, v := range labels {
+		if got, ok := project.Labels[k]; !ok || got != v {
+			return false, nil
+		}
+	}
+	return true, nil
+}
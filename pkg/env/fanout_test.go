@@ -0,0 +1,129 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/ssh"
+)
+
+// writeProjectLabels creates a project directory whose configuration has
+// labels
+func writeProjectLabels(t *testing.T, labels string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := config.ProjectConfigPath(dir)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("labels:\n"+labels), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestExecAll(t *testing.T) {
+	api := writeProjectLabels(t, "  team: payments\n")
+	web := writeProjectLabels(t, "  team: web\n")
+	worker := writeProjectLabels(t, "  team: payments\n")
+	cmd := []string{"rm", "-rf", "~/.cache/pip"}
+
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	mock.setResponse(scanCommand, fmt.Sprintf(
+		"web-c3d4\trunning\t{\"projectPath\":%q}\napi-a1b2\trunning\t{\"projectPath\":%q}\nworker-e5f6\tpaused\t{\"projectPath\":%q}\n",
+		web, api, worker))
+
+	apiProject, err := config.LoadProject(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCmd, err := EnterCommand(&Environment{Name: "api-a1b2", ProjectPath: api}, apiProject, cmd, EnterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	webProject, err := config.LoadProject(web)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webCmd, err := EnterCommand(&Environment{Name: "web-c3d4", ProjectPath: web}, webProject, cmd, EnterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.setResponse(apiCmd, "removed\n")
+	mock.setResponse(webCmd, "permission denied\n")
+	mock.setError(webCmd, &ssh.ExitError{Status: 1})
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []string
+	}{
+		{
+			name: "all environments",
+			want: []string{"api-a1b2 0 removed", "web-c3d4 1 permission denied", "worker-e5f6 -1 not running"},
+		},
+		{
+			name:   "by label",
+			labels: map[string]string{"team": "payments"},
+			want:   []string{"api-a1b2 0 removed", "worker-e5f6 -1 not running"},
+		},
+		{
+			name:   "no match",
+			labels: map[string]string{"team": "ops"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := newManagerWithExecutor(mock).ExecAll(context.Background(), cmd, ExecAllOptions{Labels: tt.labels, Concurrency: 2})
+			if err != nil {
+				t.Fatalf("ExecAll failed: %v", err)
+			}
+
+			var got []string
+			for _, r := range results {
+				detail := strings.TrimSpace(r.Output)
+				if errors.Is(r.Err, ErrNotRunning) {
+					detail = "not running"
+				}
+				got = append(got, fmt.Sprintf("%s %d %s", r.Environment.Name, r.ExitStatus, detail))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got results:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestExecAll_Configure(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	mock.setResponse(scanCommand, "scratch-a1b2\trunning\t{\"projectPath\":\"/work/scratch\",\"isolated\":true}\n")
+
+	var configured []string
+	_, err := newManagerWithExecutor(mock).ExecAll(context.Background(), []string{"true"}, ExecAllOptions{
+		Configure: func(env *Environment, opts *EnterOptions) error {
+			configured = append(configured, env.Name)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("ExecAll failed: %v", err)
+	}
+	if strings.Join(configured, ",") != "scratch-a1b2" {
+		t.Errorf("expected each environment to be configured, got %v", configured)
+	}
+
+	if _, err := newManagerWithExecutor(mock).ExecAll(context.Background(), []string{"true"}, ExecAllOptions{
+		Enter: EnterOptions{GuardPatterns: []string{"rm"}},
+	}); err == nil {
+		t.Error("expected guard patterns to be refused")
+	}
+}
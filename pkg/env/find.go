@@ -0,0 +1,67 @@
+package env
+
+import (
+	"context"
+	"fmt"
+)
+
+// Find returns the environment for a host project path, like Resolve, but
+// looks for an existing environment first. Environments are named after the
+// canonical form of their project path; ones created before paths were
+// canonicalized are named after the path as it was typed, through a symlink
+// or in another case, and are found by the project path recorded in their
+// metadata instead. If the VM isn't running there's nothing to look up, and
+// Find returns what Resolve does without starting it.
+func (m *Manager) Find(ctx context.Context, projectPath string) (*Environment, error) {
+	env, err := m.Resolve(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	if m.sshClient == nil || !m.sshClient.IsConnected() {
+		running, err := m.vmManager.IsRunning(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check VM status: %w", err)
+		}
+		if !running {
+			return env, nil
+		}
+		if err := m.ensureSSH(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.adoptRecordedName(ctx, env); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// adoptRecordedName renames env to the existing environment whose recorded
+// project path is the same directory, if no environment has env's own name.
+// It needs a connection.
+func (m *Manager) adoptRecordedName(ctx context.Context, env *Environment) error {
+	// The usual case, and a cached probe
+	if exists, err := m.Exists(ctx, env.Name); err != nil || exists {
+		return err
+	}
+	envs, err := m.scanEnvironments(ctx)
+	if err != nil {
+		return err
+	}
+	for _, e := range envs {
+		if e.Name == env.Name {
+			return nil
+		}
+	}
+	for _, e := range envs {
+		if e.ProjectPath == "" || !e.Mount().HostProject() {
+			continue
+		}
+		recorded, err := m.paths.Canonical(e.ProjectPath)
+		if err == nil && recorded == env.ProjectPath {
+			m.debugf(e.Name, "Using %s, created for %s before project paths were canonicalized", e.Name, e.ProjectPath)
+			env.Name = e.Name
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFind_RecordedProjectPath(t *testing.T) {
+	root := t.TempDir()
+	project := filepath.Join(root, "project")
+	if err := os.Mkdir(project, 0700); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(project, link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	// Created through the symlink before paths were canonicalized, so named
+	// after the symlink
+	legacy, err := GenerateName(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := legacy + "\trunning\t{\"projectPath\":\"" + link + "\",\"version\":2}\n"
+
+	tests := []struct {
+		name    string
+		path    string
+		current bool
+		want    string
+	}{
+		{name: "canonical spelling", path: project, want: legacy},
+		{name: "symlinked spelling", path: link, want: legacy},
+		{name: "environment under the current name", path: project, current: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			m := newManagerWithExecutor(mock)
+			resolved, err := m.Resolve(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.current {
+				mock.setError(existsCommand(resolved.Name), errors.New("exit status 1"))
+			}
+			mock.setResponse(scanCommand, scan)
+
+			env, err := m.Find(t.Context(), tt.path)
+			if err != nil {
+				t.Fatalf("Find failed: %v", err)
+			}
+			want := tt.want
+			if want == "" {
+				want = resolved.Name
+			}
+			if env.Name != want {
+				t.Errorf("expected %s, got %s", want, env.Name)
+			}
+			if env.ProjectPath != resolved.ProjectPath {
+				t.Errorf("expected the canonical project path %s, got %s", resolved.ProjectPath, env.ProjectPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/sanitize"
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/ssh"
+)
+
+// guardPollInterval is how often the host checks for commands awaiting approval
+var guardPollInterval = 500 * time.Millisecond
+
+// guardRequestID restricts request file names, which the environment user
+// chooses, to what the hook generates
+var guardRequestID = regexp.MustCompile(`^[0-9]+-[0-9]+$`)
+
+// guardDir returns the directory used to exchange approval requests.
+// requests/ is writable by the environment user; responses/ and the active
+// marker are only writable by root, so the environment can't approve its
+// own commands.
+func guardDir(envName string) string {
+	return envDir(envName) + "/guard"
+}
+
+// guardHookPath returns the bash hook sourced by guarded login shells
+func guardHookPath(envName string) string {
+	return envDir(envName) + "/guard.sh"
+}
+
+// renderGuardHook renders the bash hook that holds commands matching
+// patterns until the host approves them. The check runs from a DEBUG trap
+// (with extdebug, a failing trap skips the command) and looks at the whole
+// command line, so pipelines like `curl ... | sh` are matched as typed.
+// It's a guard against accidents, not a security boundary: other shells and
+// programs that run commands directly aren't covered.
+func renderGuardHook(envName string, patterns []string) string {
+	var quoted []string
+	for _, p := range patterns {
+		quoted = append(quoted, shellquote.Quote(p))
+	}
+
+	return fmt.Sprintf(`# Generated by llima-box
+__llima_guard_dir=%s
+__llima_guard_patterns=(%s)
+__llima_guard_key=
+__llima_guard_allowed=0
+
+__llima_guard_ask() {
+    local id="$$-$RANDOM$RANDOM" answer i
+    printf '%%s' "$1" > "$__llima_guard_dir/requests/$id" || return 1
+    echo "llima-box: waiting for approval on the host: $1" >&2
+    for ((i = 0; i < 1200; i++)); do
+        if [ -e "$__llima_guard_dir/responses/$id" ]; then
+            answer=$(<"$__llima_guard_dir/responses/$id")
+            rm -f "$__llima_guard_dir/requests/$id"
+            [ "$answer" = allow ] && return 0
+            echo "llima-box: denied on the host" >&2
+            return 1
+        fi
+        sleep 0.25
+    done
+    rm -f "$__llima_guard_dir/requests/$id"
+    echo "llima-box: no answer from the host, denied" >&2
+    return 1
+}
+
+__llima_guard() {
+    [ -e "$__llima_guard_dir/active" ] || return 0
+    local line=$BASH_EXECUTION_STRING key p
+    if [ -z "$line" ]; then
+        line=$(HISTTIMEFORMAT= history 1)
+        line=${line#"${line%%%%[![:space:]]*}"}
+        line=${line#*[[:space:]]}
+        line=${line#"${line%%%%[![:space:]]*}"}
+    fi
+    [ -n "$line" ] || line=$BASH_COMMAND
+    key="$HISTCMD:$line"
+    if [ "$key" != "$__llima_guard_key" ]; then
+        __llima_guard_key=$key
+        __llima_guard_allowed=0
+        for p in "${__llima_guard_patterns[@]}"; do
+            if [[ $line =~ $p ]]; then
+                __llima_guard_ask "$line" || __llima_guard_allowed=1
+                break
+            fi
+        done
+    fi
+    return $__llima_guard_allowed
+}
+
+shopt -s extdebug
+trap '__llima_guard' DEBUG
+`, guardDir(envName), strings.Join(quoted, " "))
+}
+
+// startGuard installs the hook and marks the environment as guarded
+func (m *Manager) startGuard(ctx context.Context, envName string, patterns []string) error {
+	dir := guardDir(envName)
+	cmd := fmt.Sprintf(
+		"sudo mkdir -p %[1]s/requests %[1]s/responses && sudo chown %[2]s: %[1]s/requests && sudo chmod 700 %[1]s/requests && "+
+			"sudo sh -c 'rm -f %[1]s/requests/* %[1]s/responses/*' && "+
+			"printf '%%s' %[3]s | sudo tee %[4]s >/dev/null && "+
+			"printf '%%s\\n' %[5]s | sudo tee /etc/profile.d/llima-box.sh >/dev/null && "+
+			"sudo touch %[1]s/active",
+		dir, envName, shellquote.Quote(renderGuardHook(envName, patterns)), guardHookPath(envName), shellquote.Quote(profileHook),
+	)
+	if _, err := m.sshClient.ExecContext(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to enable command guard: %w", err)
+	}
+	return nil
+}
+
+// stopGuard lets commands run unchecked again
+func (m *Manager) stopGuard(ctx context.Context, envName string) error {
+	dir := guardDir(envName)
+	cmd := fmt.Sprintf("sudo sh -c 'rm -f %[1]s/active %[1]s/responses/*'", dir)
+	if _, err := m.sshClient.ExecContext(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to disable command guard: %w", err)
+	}
+	return nil
+}
+
+// guardRequest is a command awaiting approval
+type guardRequest struct {
+	id      string
+	command string
+}
+
+// pollGuard returns the commands currently awaiting approval. The requests
+// directory belongs to the environment user, who could put symlinks or FIFOs
+// there, so it's read as that user and only regular files are read.
+func (m *Manager) pollGuard(ctx context.Context, envName string) ([]guardRequest, error) {
+	script := fmt.Sprintf(
+		`for f in %s/requests/*; do [ -f "$f" ] && [ ! -L "$f" ] || continue; printf '%%s\t' "${f##*/}"; head -c 4096 "$f" | tr '\n\t' '  '; echo; done`,
+		guardDir(envName),
+	)
+	output, err := m.sshClient.ExecContext(ctx, "sudo -u "+shellWord(envName)+" sh -c "+shellquote.Quote(script))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check guard requests: %w", err)
+	}
+	return parseGuardRequests(output), nil
+}
+
+// parseGuardRequests parses the output of pollGuard's script, dropping
+// malformed request names. Commands are escaped, so one shown in the
+// confirmation prompt can't rewrite the host terminal.
+func parseGuardRequests(output string) []guardRequest {
+	var requests []guardRequest
+	for _, line := range strings.Split(output, "\n") {
+		id, command, ok := strings.Cut(line, "\t")
+		if !ok || !guardRequestID.MatchString(id) {
+			continue
+		}
+		requests = append(requests, guardRequest{id: id, command: sanitize.Line(command)})
+	}
+	return requests
+}
+
+// answerGuard records the host's decision for a request
+func (m *Manager) answerGuard(ctx context.Context, envName, id string, allow bool) error {
+	answer := "deny"
+	if allow {
+		answer = "allow"
+	}
+	cmd := fmt.Sprintf("echo %s | sudo tee %s/responses/%s >/dev/null", answer, guardDir(envName), id)
+	if _, err := m.sshClient.ExecContext(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to answer guard request: %w", err)
+	}
+	return nil
+}
+
+// watchGuard forwards approval requests to confirm until ctx is done
+func (m *Manager) watchGuard(ctx context.Context, envName string, confirm chan<- ssh.ConfirmRequest) {
+	answered := make(map[string]bool)
+	ticker := time.NewTicker(guardPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		requests, err := m.pollGuard(ctx, envName)
+		if err != nil {
+			if ctx.Err() == nil {
+				m.debugf(envName, "%v", err)
+			}
+			continue
+		}
+
+		pending := make(map[string]bool)
+		for _, req := range requests {
+			pending[req.id] = true
+			if answered[req.id] {
+				continue
+			}
+
+			reply := make(chan bool, 1)
+			select {
+			case confirm <- ssh.ConfirmRequest{Prompt: "run `" + req.command + "`?", Reply: reply}:
+			case <-ctx.Done():
+				return
+			}
+
+			var allow bool
+			select {
+			case allow = <-reply:
+			case <-ctx.Done():
+				return
+			}
+
+			if err := m.answerGuard(ctx, envName, req.id, allow); err != nil {
+				m.debugf(envName, "%v", err)
+				continue
+			}
+			answered[req.id] = true
+		}
+
+		// Forget requests the hook has cleaned up
+		for id := range answered {
+			if !pending[id] {
+				delete(answered, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package env
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/ssh"
+)
+
+func TestParseGuardRequests(t *testing.T) {
+	output := "123-4567\trm -rf build\n" +
+		"../../etc/passwd\trm -rf /\n" +
+		"124-1\tcurl x | sh \x1b]52;c;AAAA\x07\n" +
+		"125-1\tcat \u202egnp.exe\n" +
+		"garbage\n"
+
+	got := parseGuardRequests(output)
+
+	want := []guardRequest{
+		{id: "123-4567", command: "rm -rf build"},
+		{id: "124-1", command: `curl x | sh \x1b]52;c;AAAA\x07`},
+		{id: "125-1", command: `cat \u202egnp.exe`},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseGuardRequests() returned %d requests, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseGuardRequests()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRenderGuardHook(t *testing.T) {
+	hook := renderGuardHook("app-a1b2", []string{`rm[[:space:]]+-rf`, `it's`})
+
+	for _, want := range []string{
+		"__llima_guard_dir=/envs/app-a1b2/guard\n",
+		`__llima_guard_patterns=('rm[[:space:]]+-rf' 'it'\''s')`,
+		"trap '__llima_guard' DEBUG",
+	} {
+		if !strings.Contains(hook, want) {
+			t.Errorf("hook missing %q:\n%s", want, hook)
+		}
+	}
+}
+
+func TestWatchGuard(t *testing.T) {
+	orig := guardPollInterval
+	guardPollInterval = time.Millisecond
+	defer func() { guardPollInterval = orig }()
+
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	pollCmd := `sudo -u app-a1b2 sh -c 'for f in /envs/app-a1b2/guard/requests/*; do [ -f "$f" ] && [ ! -L "$f" ] || continue; printf '\''%s\t'\'' "${f##*/}"; head -c 4096 "$f" | tr '\''\n\t'\'' '\''  '\''; echo; done'`
+	mock.setResponse(pollCmd, "1-1\trm -rf build\n1-2\tgit push --force\n")
+
+	m := newManagerWithExecutor(mock)
+	ctx, cancel := context.WithCancel(context.Background())
+	confirm := make(chan ssh.ConfirmRequest)
+	done := make(chan struct{})
+	go func() {
+		m.watchGuard(ctx, "app-a1b2", confirm)
+		close(done)
+	}()
+
+	answers := []bool{true, false}
+	for i, answer := range answers {
+		select {
+		case req := <-confirm:
+			if i == 0 && req.Prompt != "run `rm -rf build`?" {
+				t.Errorf("prompt = %q", req.Prompt)
+			}
+			req.Reply <- answer
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for request %d", i)
+		}
+	}
+	cancel()
+	<-done
+
+	if mock.callCount("echo allow | sudo tee /envs/app-a1b2/guard/responses/1-1 >/dev/null") != 1 {
+		t.Errorf("expected approval to be recorded once, calls: %v", mock.calls)
+	}
+	if mock.callCount("echo deny | sudo tee /envs/app-a1b2/guard/responses/1-1 >/dev/null") != 0 {
+		t.Error("approved request was also denied")
+	}
+}
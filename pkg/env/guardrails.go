@@ -0,0 +1,69 @@
+package env
+
+import (
+	"context"
+	"path"
+)
+
+// ProjectAccess is how an environment reaches its project directory
+type ProjectAccess string
+
+const (
+	// ProjectReadWrite environments write straight to the host project
+	ProjectReadWrite ProjectAccess = "read-write"
+
+	// ProjectOverlay environments write to a copy-on-write overlay kept in
+	// the VM; the host project is read-only to them
+	ProjectOverlay ProjectAccess = "overlay"
+
+	// ProjectVMOnly environments work in a VM workspace and can't reach
+	// host files
+	ProjectVMOnly ProjectAccess = "vm-only"
+)
+
+// Guardrails describe what an environment's sandbox lets it do, for the
+// people and agents working in it
+type Guardrails struct {
+	// Name is the environment name
+	Name string
+
+	// ProjectPath is the project directory on the host, or the VM
+	// workspace
+	ProjectPath string
+
+	// Path is the project directory inside the environment
+	Path string
+
+	Access ProjectAccess
+
+	// References are the read-only reference directories inside the
+	// environment
+	References []string
+
+	// Limits are the environment's resource limits
+	Limits Limits
+}
+
+// Guardrails returns the guardrails of an existing environment, as returned
+// by Create
+func (m *Manager) Guardrails(ctx context.Context, env *Environment) (*Guardrails, error) {
+	limits, err := m.Limits(ctx, env.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Guardrails{
+		Name:        env.Name,
+		ProjectPath: env.ProjectPath,
+		Path:        env.dir(),
+		Access:      env.Mount().Access(),
+		Limits:      limits,
+	}
+	// VM workspaces get no references (see referenceMountCommands)
+	if env.Mount().HostProject() {
+		for _, ref := range m.references(env) {
+			g.References = append(g.References, path.Join(ReferenceMountRoot, ref.Name))
+		}
+	}
+	return g, nil
+}
@@ -0,0 +1,60 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+func TestGuardrails(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      *Environment
+		wantAcc  ProjectAccess
+		wantRefs []string
+	}{
+		{
+			name:     "read-write project",
+			env:      &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/app"},
+			wantAcc:  ProjectReadWrite,
+			wantRefs: []string{ReferenceMountRoot + "/datasets"},
+		},
+		{
+			name:     "overlay",
+			env:      &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/app", Driver: config.WorkspaceOverlay},
+			wantAcc:  ProjectOverlay,
+			wantRefs: []string{ReferenceMountRoot + "/datasets"},
+		},
+		{
+			name:    "VM workspace",
+			env:     &Environment{Name: "scratch-c3d4", ProjectPath: VMWorkspaceRoot + "/scratch", Driver: vmOnlyMount},
+			wantAcc: ProjectVMOnly,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.setResponse(fmt.Sprintf("sudo cat %s 2>/dev/null || true", limitsPath(tt.env.Name)), "")
+			m := newManagerWithExecutor(mock)
+			m.options.References = []Reference{{Name: "datasets", Path: "~/datasets"}}
+
+			g, err := m.Guardrails(context.Background(), tt.env)
+			if err != nil {
+				t.Fatalf("Guardrails() failed: %v", err)
+			}
+			if g.Access != tt.wantAcc {
+				t.Errorf("Access = %q, want %q", g.Access, tt.wantAcc)
+			}
+			if !reflect.DeepEqual(g.References, tt.wantRefs) {
+				t.Errorf("References = %v, want %v", g.References, tt.wantRefs)
+			}
+			if !g.Limits.IsZero() {
+				t.Errorf("expected no limits, got %+v", g.Limits)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package env
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HeartbeatInterval is how often a running session marks its environment
+// as in use. An environment whose last mark is at most two intervals old
+// has a session running (see Environment.Active).
+const HeartbeatInterval = time.Minute
+
+// heartbeatPath returns the file sessions in the named environment touch
+// while they run. Its modification time is when the environment was last
+// used. The file belongs to the VM user, so sessions update it without sudo
+// and the environment's own user can't.
+func heartbeatPath(envName string) string {
+	return envDir(envName) + "/heartbeat"
+}
+
+// heartbeatScript wraps command, a session, so the heartbeat file is touched
+// when it starts, every HeartbeatInterval while it runs, and when it ends.
+// The touching loop stops with the session, or within an interval if the
+// session's shell is killed. The script exits with command's status.
+func heartbeatScript(envName, command string) string {
+	hb := shellWord(heartbeatPath(envName))
+	return strings.Join([]string{
+		fmt.Sprintf(`{ [ -O %[1]s ] || sudo install -m 644 -o "$(id -un)" /dev/null %[1]s; touch %[1]s; } 2>/dev/null`, hb),
+		fmt.Sprintf(`( while sleep %d && kill -0 $$; do touch %s; done ) >/dev/null 2>&1 </dev/null &`,
+			int(HeartbeatInterval/time.Second), hb),
+		`heartbeat_pid=$!`,
+		command,
+		`heartbeat_rc=$?`,
+		fmt.Sprintf(`kill $heartbeat_pid 2>/dev/null; touch %s 2>/dev/null`, hb),
+		`(exit $heartbeat_rc)`,
+	}, "\n")
+}
+
+// parseHeartbeat parses the modification time of the heartbeat file, in
+// seconds since the epoch, as printed by scanCommand. It's the zero time if
+// no session has run since heartbeats were recorded.
+func parseHeartbeat(field string) time.Time {
+	secs, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+	if err != nil || secs <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(secs, 0)
+}
+
+// Active reports whether a session was running in the environment at now,
+// judging by its last heartbeat
+func (e *Environment) Active(now time.Time) bool {
+	return !e.LastActive.IsZero() && now.Sub(e.LastActive) <= 2*HeartbeatInterval
+}
@@ -0,0 +1,39 @@
+package env
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnvironmentActive(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		lastActive time.Time
+		want       bool
+	}{
+		{name: "never used", want: false},
+		{name: "heartbeat just now", lastActive: now.Add(-30 * time.Second), want: true},
+		{name: "one missed heartbeat", lastActive: now.Add(-2 * HeartbeatInterval), want: true},
+		{name: "session ended", lastActive: now.Add(-3 * time.Hour), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Environment{LastActive: tt.lastActive}
+			if got := e.Active(now); got != tt.want {
+				t.Errorf("Active() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHeartbeat(t *testing.T) {
+	if got := parseHeartbeat("1760000000\n"); !got.Equal(time.Unix(1760000000, 0)) {
+		t.Errorf("parseHeartbeat() = %v", got)
+	}
+	for _, field := range []string{"", "not a time", "0"} {
+		if got := parseHeartbeat(field); !got.IsZero() {
+			t.Errorf("parseHeartbeat(%q) = %v, want the zero time", field, got)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/helper"
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// helperLockName serializes installing the helper between concurrent CLIs
+const helperLockName = "helper"
+
+// HelperBinary returns the file name of the helper built for a VM
+// architecture (amd64 or arm64), as shipped with llima-box releases
+func HelperBinary(arch string) string {
+	return "llima-box-helper-linux-" + arch
+}
+
+// vmArchitectures maps uname -m in the VM to Go architecture names
+var vmArchitectures = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+	"arm64":   "arm64",
+}
+
+// helperCommand returns the command running a helper operation with req as
+// its JSON argument
+func helperCommand(op string, req any) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s request: %w", op, err)
+	}
+	return "sudo " + vm.HelperPath + " " + op + " " + shellquote.Quote(string(data)), nil
+}
+
+// callHelper runs a helper operation and decodes its reply into resp
+func (m *Manager) callHelper(ctx context.Context, op string, req, resp any) error {
+	cmd, err := helperCommand(op, req)
+	if err != nil {
+		return err
+	}
+	output, err := m.sshClient.ExecContext(ctx, cmd)
+	if err != nil {
+		if output = strings.TrimSpace(output); output != "" {
+			err = fmt.Errorf("%w (output: %s)", err, output)
+		}
+		return fmt.Errorf("llima-box-helper %s failed: %w", op, err)
+	}
+	if err := json.Unmarshal([]byte(output), resp); err != nil {
+		return fmt.Errorf("invalid reply from llima-box-helper %s: %w", op, err)
+	}
+	return nil
+}
+
+// helperProtocol returns the protocol version of the helper installed in
+// the VM, or 0 if it's missing or the shell script older VMs have
+func (m *Manager) helperProtocol(ctx context.Context) int {
+	output, err := m.sshClient.ExecContext(ctx, vm.HelperPath+" "+helper.OpVersion+" 2>/dev/null")
+	if err != nil {
+		return 0
+	}
+	var v helper.Version
+	if json.Unmarshal([]byte(output), &v) != nil {
+		return 0
+	}
+	return v.Protocol
+}
+
+// ensureHelper checks for the helper in the VM, installing the one from
+// Options.HelperDir if it's missing or speaks another protocol. Without it,
+// environments are set up, entered, and deleted with shell scripts.
+func (m *Manager) ensureHelper(ctx context.Context) {
+	m.helper = m.helperProtocol(ctx) == helper.Protocol
+	if m.helper || m.options.HelperDir == "" {
+		return
+	}
+
+	unlock, err := m.locks.lock(ctx, helperLockName)
+	if err != nil {
+		m.debugf("", "Not installing llima-box-helper: %v", err)
+		return
+	}
+	defer unlock()
+	if m.helper = m.helperProtocol(ctx) == helper.Protocol; m.helper {
+		return
+	}
+
+	if err := m.installHelper(ctx); err != nil {
+		m.debugf("", "Not installing llima-box-helper, using setup scripts: %v", err)
+		return
+	}
+	m.helper = m.helperProtocol(ctx) == helper.Protocol
+}
+
+// installHelper copies the helper built for the VM's architecture from
+// Options.HelperDir to vm.HelperPath
+func (m *Manager) installHelper(ctx context.Context) error {
+	output, err := m.sshClient.ExecContext(ctx, "uname -m")
+	if err != nil {
+		return fmt.Errorf("failed to read the VM architecture: %w", err)
+	}
+	arch, ok := vmArchitectures[strings.TrimSpace(output)]
+	if !ok {
+		return fmt.Errorf("unsupported VM architecture %q", strings.TrimSpace(output))
+	}
+	local := filepath.Join(m.options.HelperDir, HelperBinary(arch))
+	if _, err := os.Stat(local); err != nil {
+		return err
+	}
+
+	// A private directory, so nothing can swap the file before it's
+	// installed
+	output, err = m.sshClient.ExecContext(ctx, "mktemp -d")
+	if err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	dir := strings.TrimSpace(output)
+	defer func() { _, _ = m.sshClient.ExecContext(context.WithoutCancel(ctx), "rm -rf "+shellWord(dir)) }()
+
+	if err := m.sshClient.Upload(ctx, local, dir+"/llima-box-helper", ssh.TransferOptions{}); err != nil {
+		return fmt.Errorf("failed to copy llima-box-helper: %w", err)
+	}
+	if _, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("sudo install -m 755 -o root -g root %s %s", shellWord(dir+"/llima-box-helper"), vm.HelperPath)); err != nil {
+		return fmt.Errorf("failed to install llima-box-helper: %w", err)
+	}
+	m.debugf("", "Installed llima-box-helper (protocol %d)", helper.Protocol)
+	return nil
+}
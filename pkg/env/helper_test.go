@@ -0,0 +1,205 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/dotenv"
+	"github.com/middlendian/llima-box/pkg/helper"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// helperVersionCommand is the command probing the installed helper
+const helperVersionCommand = vm.HelperPath + " version 2>/dev/null"
+
+func TestHelperLayoutMatches(t *testing.T) {
+	for _, tt := range []struct{ name, env, helper string }{
+		{"envs", envDir("x"), helper.EnvsDir + "/x"},
+		{"locks", vmLocksDir, helper.LocksDir},
+		{"homes", homeBase, helper.HomeBase},
+		{"workspaces", VMWorkspaceRoot, helper.WorkspaceRoot},
+		{"overlays", OverlayRoot, helper.OverlayRoot},
+		{"cgroups", cgroupRoot, helper.CgroupRoot},
+		{"session variables", sessionVarsDir, helper.SessionVarsDir},
+		{"group", vm.EnvGroup, helper.EnvGroup},
+		{"PATH", defaultPath, helper.DefaultPath},
+	} {
+		if tt.env != tt.helper {
+			t.Errorf("%s: pkg/env has %q, the helper %q", tt.name, tt.env, tt.helper)
+		}
+	}
+}
+
+func TestEnsureHelper_Installed(t *testing.T) {
+	mock := newMockExecutor()
+	mock.setResponse(helperVersionCommand, `{"protocol":1}`)
+	m := newManagerWithExecutor(mock)
+
+	m.ensureHelper(context.Background())
+	if !m.helper {
+		t.Error("expected the installed helper to be used")
+	}
+	if len(mock.calls) != 1 {
+		t.Errorf("expected only the version probe, got %v", mock.calls)
+	}
+}
+
+func TestEnsureHelper_ShellScript(t *testing.T) {
+	// VMs made by older releases have the shell helper, which has no
+	// version operation
+	mock := newMockExecutor()
+	mock.setError(helperVersionCommand, fmt.Errorf("exit status 1"))
+	m := newManagerWithExecutor(mock)
+
+	m.ensureHelper(context.Background())
+	if m.helper {
+		t.Error("expected setup scripts without the helper")
+	}
+	if len(mock.calls) != 1 {
+		t.Errorf("expected nothing installed without Options.HelperDir, got %v", mock.calls)
+	}
+}
+
+// installingExecutor reports the helper as installed once the install
+// command has run
+type installingExecutor struct {
+	*mockExecutor
+	installed bool
+}
+
+func (e *installingExecutor) ExecContext(ctx context.Context, cmd string) (string, error) {
+	if strings.HasPrefix(cmd, "sudo install ") {
+		e.installed = true
+	}
+	if cmd == helperVersionCommand && e.installed {
+		return `{"protocol":1}`, nil
+	}
+	return e.mockExecutor.ExecContext(ctx, cmd)
+}
+
+func TestEnsureHelper_Install(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, HelperBinary("arm64")), []byte("ELF"), 0755); err != nil { // #nosec G306 -- test file
+		t.Fatal(err)
+	}
+
+	mock := newMockExecutor()
+	mock.setError(helperVersionCommand, fmt.Errorf("exit status 1"))
+	mock.setResponse("uname -m", "aarch64\n")
+	mock.setResponse("mktemp -d", "/tmp/tmp.x1\n")
+	mock.setResponse("sudo install -m 755 -o root -g root /tmp/tmp.x1/llima-box-helper "+vm.HelperPath, "")
+	mock.setResponse("rm -rf /tmp/tmp.x1", "")
+	executor := &installingExecutor{mockExecutor: mock}
+	m := newManagerWithExecutor(executor)
+	m.options.HelperDir = dir
+
+	m.ensureHelper(context.Background())
+	if !m.helper {
+		t.Fatalf("expected the helper to be installed, calls: %v", mock.calls)
+	}
+	if string(mock.files["/tmp/tmp.x1/llima-box-helper"]) != "ELF" {
+		t.Errorf("expected the arm64 helper uploaded, got transfers %+v", mock.transfers)
+	}
+	if mock.callCount("rm -rf /tmp/tmp.x1") != 1 {
+		t.Error("expected the upload directory removed")
+	}
+}
+
+func TestEnsureHelper_UnsupportedArchitecture(t *testing.T) {
+	mock := newMockExecutor()
+	mock.setError(helperVersionCommand, fmt.Errorf("exit status 1"))
+	mock.setResponse("uname -m", "riscv64\n")
+	m := newManagerWithExecutor(mock)
+	m.options.HelperDir = t.TempDir()
+
+	m.ensureHelper(context.Background())
+	if m.helper {
+		t.Error("expected setup scripts on an unsupported architecture")
+	}
+	if len(mock.transfers) != 0 {
+		t.Errorf("expected nothing uploaded, got %+v", mock.transfers)
+	}
+}
+
+func TestDeleteEnv_Helper(t *testing.T) {
+	req := helper.DeleteEnvRequest{Name: "app-a1b2", Workspace: VMWorkspaceRoot + "/scratch"}
+	cmd, err := helperCommand(helper.OpDeleteEnv, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `sudo /usr/local/sbin/llima-box-helper delete-env '{"name":"app-a1b2","workspace":"/mnt/lima-llima-box-data/workspaces/scratch"}'`; cmd != want {
+		t.Errorf("helperCommand() = %q, want %q", cmd, want)
+	}
+
+	mock := newMockExecutor()
+	mock.setResponse(cmd, `{"warnings":["failed to kill namespace processes: pkill failed"]}`+"\n")
+	m := newManagerWithExecutor(mock)
+	m.helper = true
+	var events []Event
+	m.options.Progress = func(e Event) { events = append(events, e) }
+
+	if err := m.deleteEnv(context.Background(), req.Name, req.Workspace); err != nil {
+		t.Fatalf("deleteEnv failed: %v", err)
+	}
+	if len(mock.calls) != 1 {
+		t.Errorf("expected one helper call, got %v", mock.calls)
+	}
+	if len(events) != 1 || events[0].Level != EventWarning || !strings.Contains(events[0].Message, "pkill failed") {
+		t.Errorf("expected the helper's warning reported, got %+v", events)
+	}
+}
+
+func TestDeleteEnv_HelperFails(t *testing.T) {
+	cmd, err := helperCommand(helper.OpDeleteEnv, helper.DeleteEnvRequest{Name: "app-a1b2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := newMockExecutor()
+	mock.setError(cmd, fmt.Errorf("exit status 1"))
+	mock.setResponse(cmd, "llima-box-helper: app-a1b2 is a system account\n")
+	m := newManagerWithExecutor(mock)
+	m.helper = true
+
+	err = m.deleteEnv(context.Background(), "app-a1b2", "")
+	if err == nil || !strings.Contains(err.Error(), "system account") {
+		t.Errorf("expected the helper's error, got %v", err)
+	}
+}
+
+func TestCreateUser_Helper(t *testing.T) {
+	cmd, err := helperCommand(helper.OpCreateEnv, helper.CreateEnvRequest{Name: "app-a1b2", Shell: DefaultShell})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := newMockExecutor()
+	mock.setResponse(cmd, "{}\n")
+	m := newManagerWithExecutor(mock)
+	m.helper = true
+
+	if err := m.createUser(context.Background(), "app-a1b2"); err != nil {
+		t.Fatalf("createUser failed: %v", err)
+	}
+	if len(mock.calls) != 1 || mock.calls[0] != cmd {
+		t.Errorf("expected only %q, got %v", cmd, mock.calls)
+	}
+}
+
+func TestHelperVarsFile(t *testing.T) {
+	data := helperVarsFile([]dotenv.Var{{Key: "API_TOKEN", Value: "it's $(secret)"}, {Key: "EMPTY"}})
+	var vars []string
+	if err := json.Unmarshal(data, &vars); err != nil {
+		t.Fatalf("invalid variable file %s: %v", data, err)
+	}
+	if want := []string{"API_TOKEN=it's $(secret)", "EMPTY="}; !reflect.DeepEqual(vars, want) {
+		t.Errorf("helperVarsFile() = %q, want %q", vars, want)
+	}
+	if _, err := helper.ParseVarsFile(data); err != nil {
+		t.Errorf("the helper refuses the file: %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+package env
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/ssh"
+)
+
+// MaxHistoryOutput is how much of a command's output its history record
+// keeps. Longer output keeps its end, where failures are reported.
+const MaxHistoryOutput = 16 * 1024
+
+// maxHistoryRecords is how many records an environment's exec history keeps;
+// older ones are dropped once the file holds twice as many
+const maxHistoryRecords = 500
+
+// historyLockWait bounds how long recording waits for another process
+// appending to the same history
+const historyLockWait = 5 * time.Second
+
+// ExecRecord describes a command run in an environment without a terminal,
+// as by 'llima-box exec', so automated runs can be reconstructed afterwards
+type ExecRecord struct {
+	// Command is the command as it was given
+	Command []string `json:"command"`
+
+	// Dir is the VM directory the command ran in
+	Dir string `json:"dir"`
+
+	// StartedAt is when the command started
+	StartedAt time.Time `json:"startedAt"`
+
+	// DurationMs is how long the command ran, in milliseconds
+	DurationMs int64 `json:"durationMs"`
+
+	// ExitStatus is the command's exit status, or -1 if it didn't report
+	// one
+	ExitStatus int `json:"exitStatus"`
+
+	// Error describes why the command didn't run or finish, if it didn't
+	Error string `json:"error,omitempty"`
+
+	// Output is the command's stdout and stderr as they arrived, cut to
+	// the last MaxHistoryOutput bytes
+	Output string `json:"output,omitempty"`
+
+	// Truncated is set when the beginning of the output was dropped
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Duration returns how long the command ran
+func (r ExecRecord) Duration() time.Duration {
+	return time.Duration(r.DurationMs) * time.Millisecond
+}
+
+// execHistory keeps the exec history of each environment in a JSON lines
+// file on the host, separate from the shell history inside the environment,
+// where a command run in it could rewrite it. Histories outlive their
+// environments, so a deleted environment's runs can still be looked up.
+//
+// Like journal, a nil history or one with an empty directory records
+// nothing; managers built for tests have none.
+type execHistory struct {
+	dir string
+}
+
+// newExecHistory returns the exec history kept under the host state
+// directory for instanceName
+func newExecHistory(instanceName string) *execHistory {
+	return &execHistory{dir: filepath.Join(instanceStateDir(instanceName), "history")}
+}
+
+// path returns the file holding envName's history
+func (h *execHistory) path(envName string) string {
+	return filepath.Join(h.dir, envName+".jsonl")
+}
+
+// append adds r to envName's history, dropping the oldest records once
+// there are too many
+func (h *execHistory) append(envName string, r ExecRecord) error {
+	if h == nil || h.dir == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode history record: %w", err)
+	}
+
+	// Appends from concurrent execs are serialized, so trimming doesn't
+	// lose any
+	ctx, cancel := context.WithTimeout(context.Background(), historyLockWait)
+	defer cancel()
+	unlock, err := (&locker{dir: h.dir}).lock(ctx, envName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(h.path(envName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600) // #nosec G304 -- name is an environment name
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return h.trim(envName)
+}
+
+// trim rewrites envName's history with its newest maxHistoryRecords records
+// once it holds twice as many
+func (h *execHistory) trim(envName string) error {
+	lines, err := h.lines(envName)
+	if err != nil || len(lines) <= 2*maxHistoryRecords {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, line := range lines[len(lines)-maxHistoryRecords:] {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	tmp := h.path(envName) + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to trim history: %w", err)
+	}
+	if err := os.Rename(tmp, h.path(envName)); err != nil {
+		return fmt.Errorf("failed to trim history: %w", err)
+	}
+	return nil
+}
+
+// lines returns the lines of envName's history file
+func (h *execHistory) lines(envName string) ([][]byte, error) {
+	f, err := os.Open(h.path(envName)) // #nosec G304 -- name is an environment name
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*MaxHistoryOutput)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			lines = append(lines, bytes.Clone(scanner.Bytes()))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	return lines, nil
+}
+
+// read returns envName's history, oldest first. Records that can't be
+// decoded, such as one cut short by a crash, are skipped.
+func (h *execHistory) read(envName string) ([]ExecRecord, error) {
+	if h == nil || h.dir == "" {
+		return nil, nil
+	}
+	lines, err := h.lines(envName)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]ExecRecord, 0, len(lines))
+	for _, line := range lines {
+		var r ExecRecord
+		if json.Unmarshal(line, &r) == nil {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// ExecHistory returns the last limit commands run without a terminal in the
+// named environment, oldest first; a limit of 0 returns all that are kept.
+// The history is kept on the host, so it's available without the VM and
+// after the environment is deleted.
+func (m *Manager) ExecHistory(envName string, limit int) ([]ExecRecord, error) {
+	records, err := m.history.read(envName)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	return records, nil
+}
+
+// recordExec adds the outcome of cmd, run in env from started until it
+// ended with err, to env's exec history. Failing to record it doesn't fail
+// the command.
+func (m *Manager) recordExec(env *Environment, cmd []string, started time.Time, output *outputTail, err error) {
+	r := ExecRecord{
+		Command:    cmd,
+		Dir:        env.dir(),
+		StartedAt:  started.UTC(),
+		DurationMs: time.Since(started).Milliseconds(),
+		ExitStatus: ssh.ExitStatus(err),
+	}
+	if err != nil && r.ExitStatus <= 0 {
+		r.Error = err.Error()
+	}
+	if output != nil {
+		r.Output, r.Truncated = output.String()
+	}
+	if err := m.history.append(env.Name, r); err != nil {
+		m.warnf(env.Name, "failed to record command in history: %v", err)
+	}
+}
+
+// outputTail keeps the last MaxHistoryOutput bytes written to it. It's safe
+// for the concurrent writes of a command's stdout and stderr.
+type outputTail struct {
+	mu        sync.Mutex
+	buf       []byte
+	truncated bool
+}
+
+// Write implements io.Writer
+func (t *outputTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - MaxHistoryOutput; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+		t.truncated = true
+	}
+	return len(p), nil
+}
+
+// String returns the output kept and whether earlier output was dropped
+func (t *outputTail) String() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf), t.truncated
+}
+
+// teeOutput returns w copying to tail as well; a nil w only goes to tail
+func teeOutput(w io.Writer, tail *outputTail) io.Writer {
+	if w == nil {
+		return tail
+	}
+	return io.MultiWriter(w, tail)
+}
+
+// shellHistoryFile returns the history file of shell, relative to the
+// user's home directory
+func shellHistoryFile(shell string) string {
+	if path.Base(shell) == "zsh" {
+		return ".zsh_history"
+	}
+	return ".bash_history"
+}
+
+// shellHistoryCommand returns the command printing the shell history of
+// envName's user. A missing history file prints nothing.
+func shellHistoryCommand(envName, shell string) string {
+	return fmt.Sprintf(
+		`h=$(getent passwd %[1]s | cut -d: -f6) && [ -n "$h" ] && { sudo cat "$h/%[2]s" 2>/dev/null || true; }`,
+		envName, shellHistoryFile(shell),
+	)
+}
+
+// ShellHistory returns the shell history of the named environment's
+// interactive sessions, as the shell saved it
+func (m *Manager) ShellHistory(ctx context.Context, envName string) (string, error) {
+	if err := m.ensureSSH(ctx); err != nil {
+		return "", err
+	}
+	output, err := m.sshClient.ExecContext(ctx, shellHistoryCommand(envName, m.options.Shell))
+	if err != nil {
+		return "", fmt.Errorf("environment %s does not exist", envName)
+	}
+	return output, nil
+}
@@ -0,0 +1,141 @@
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/ssh"
+)
+
+func TestOutputTail(t *testing.T) {
+	tail := &outputTail{}
+	_, _ = tail.Write([]byte("start\n"))
+	if out, truncated := tail.String(); out != "start\n" || truncated {
+		t.Fatalf("expected the whole output, got %q truncated=%v", out, truncated)
+	}
+
+	_, _ = tail.Write(bytes.Repeat([]byte("x"), MaxHistoryOutput))
+	_, _ = tail.Write([]byte("end"))
+	out, truncated := tail.String()
+	if len(out) != MaxHistoryOutput || !strings.HasSuffix(out, "xend") || !truncated {
+		t.Errorf("expected the last %d bytes, got %d bytes ending %q truncated=%v", MaxHistoryOutput, len(out), out[len(out)-4:], truncated)
+	}
+}
+
+func TestExecHistory(t *testing.T) {
+	m := newManagerWithExecutor(newMockExecutor())
+	m.history = &execHistory{dir: t.TempDir()}
+
+	for i := range 2*maxHistoryRecords + 1 {
+		if err := m.history.append("app-a1b2", ExecRecord{Command: []string{"echo", fmt.Sprint(i)}}); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+
+	records, err := m.ExecHistory("app-a1b2", 0)
+	if err != nil {
+		t.Fatalf("ExecHistory failed: %v", err)
+	}
+	if len(records) != maxHistoryRecords || records[len(records)-1].Command[1] != fmt.Sprint(2*maxHistoryRecords) {
+		t.Fatalf("expected the newest %d records after trimming, got %d", maxHistoryRecords, len(records))
+	}
+
+	records, err = m.ExecHistory("app-a1b2", 2)
+	if err != nil || len(records) != 2 || records[0].Command[1] != fmt.Sprint(2*maxHistoryRecords-1) {
+		t.Errorf("expected the last 2 records oldest first, got %v (err %v)", records, err)
+	}
+
+	if records, err := m.ExecHistory("other-c3d4", 0); err != nil || len(records) != 0 {
+		t.Errorf("expected no history for another environment, got %v (err %v)", records, err)
+	}
+}
+
+func TestEnterNamespace_RecordsExecs(t *testing.T) {
+	env := &Environment{Name: "app-a1b2", ProjectPath: t.TempDir()}
+
+	tests := []struct {
+		name       string
+		cmd        []string
+		stdout     bool
+		err        error
+		wantRecord bool
+		wantStatus int
+	}{
+		{name: "exec", cmd: []string{"make", "test"}, stdout: true, wantRecord: true},
+		{name: "failed exec", cmd: []string{"false"}, stdout: true, err: &ssh.ExitError{Status: 2}, wantRecord: true, wantStatus: 2},
+		{name: "terminal session", cmd: []string{"make", "test"}},
+		{name: "interactive shell", stdout: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			m := newManagerWithExecutor(mock)
+			m.history = &execHistory{dir: t.TempDir()}
+
+			project, err := loadProject(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sshCmd, err := EnterCommand(env, project, tt.cmd, EnterOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			mock.setResponse(sshCmd, "ok 12 tests\n")
+			if tt.err != nil {
+				mock.setError(sshCmd, tt.err)
+			}
+
+			var opts EnterOptions
+			var stdout bytes.Buffer
+			if tt.stdout {
+				opts.Session.Stdout = &stdout
+			}
+			_ = m.EnterNamespace(t.Context(), env, tt.cmd, opts)
+
+			records, err := m.ExecHistory(env.Name, 0)
+			if err != nil {
+				t.Fatalf("ExecHistory failed: %v", err)
+			}
+			if !tt.wantRecord {
+				if len(records) != 0 {
+					t.Errorf("expected no history, got %v", records)
+				}
+				return
+			}
+			if len(records) != 1 {
+				t.Fatalf("expected one record, got %v", records)
+			}
+			r := records[0]
+			if strings.Join(r.Command, " ") != strings.Join(tt.cmd, " ") || r.Dir != env.dir() || r.ExitStatus != tt.wantStatus || r.Output != "ok 12 tests\n" || r.Error != "" {
+				t.Errorf("unexpected record %+v", r)
+			}
+			if time.Since(r.StartedAt) > time.Minute {
+				t.Errorf("expected the start time to be recorded, got %v", r.StartedAt)
+			}
+			if stdout.String() != "ok 12 tests\n" {
+				t.Errorf("expected the output to still reach stdout, got %q", stdout.String())
+			}
+		})
+	}
+}
+
+func TestShellHistoryCommand(t *testing.T) {
+	tests := []struct {
+		shell string
+		want  string
+	}{
+		{"/bin/bash", `h=$(getent passwd app-a1b2 | cut -d: -f6) && [ -n "$h" ] && { sudo cat "$h/.bash_history" 2>/dev/null || true; }`},
+		{"/usr/bin/zsh", `h=$(getent passwd app-a1b2 | cut -d: -f6) && [ -n "$h" ] && { sudo cat "$h/.zsh_history" 2>/dev/null || true; }`},
+	}
+
+	for _, tt := range tests {
+		if got := shellHistoryCommand("app-a1b2", tt.shell); got != tt.want {
+			t.Errorf("shellHistoryCommand(%s) = %s, want %s", tt.shell, got, tt.want)
+		}
+	}
+}
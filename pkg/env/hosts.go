@@ -0,0 +1,138 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// HostsDomain is the domain environments are registered under: each is
+// reachable as <name>.llima.local
+const HostsDomain = "llima.local"
+
+// hostsLockName serializes rewriting the VM's /etc/hosts
+const hostsLockName = "hosts"
+
+// Markers around the entries llima-box manages in a hosts file. Everything
+// outside them is left alone.
+const (
+	hostsBegin = "# BEGIN llima-box environments"
+	hostsEnd   = "# END llima-box environments"
+)
+
+// hostsMarkers returns the markers around instanceName's block. Each
+// instance has its own, so instances sharing the host's hosts file don't
+// remove each other's names; the default instance's is unmarked.
+func hostsMarkers(instanceName string) (begin, end string) {
+	if instanceName == "" || instanceName == vm.DefaultInstanceName {
+		return hostsBegin, hostsEnd
+	}
+	return hostsBegin + " (" + instanceName + ")", hostsEnd + " (" + instanceName + ")"
+}
+
+// Hostname returns the name an environment is registered under
+func Hostname(envName string) string {
+	return envName + "." + HostsDomain
+}
+
+// HostsEntries returns hosts file lines mapping each environment's
+// hostname to addr, sorted by name
+func HostsEntries(addr string, envNames []string) []string {
+	names := append([]string(nil), envNames...)
+	sort.Strings(names)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = addr + " " + Hostname(name)
+	}
+	return lines
+}
+
+// ReplaceHostsBlock returns the hosts file content with the block for the VM
+// instanceName replaced by entries, or removed if there are none. The rest of
+// the file is kept as it is.
+func ReplaceHostsBlock(content, instanceName string, entries []string) string {
+	begin, end := hostsMarkers(instanceName)
+	var kept []string
+	inBlock := false
+	for _, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		switch {
+		case line == begin:
+			inBlock = true
+		case line == end:
+			inBlock = false
+		case !inBlock:
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == 1 && kept[0] == "" {
+		kept = nil
+	}
+
+	if len(entries) > 0 {
+		kept = append(kept, begin)
+		kept = append(kept, entries...)
+		kept = append(kept, end)
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	return strings.Join(kept, "\n") + "\n"
+}
+
+// syncHostnames registers every environment in the VM's /etc/hosts, so
+// services in one environment can reach another's by name. Environments
+// share the VM's network, so the names resolve to the loopback address and
+// are told apart by port. Failures are only reported: names are a
+// convenience, not something an environment needs to work.
+func (m *Manager) syncHostnames(ctx context.Context) {
+	if err := m.writeHostnames(ctx); err != nil {
+		m.warnf("", "failed to update environment hostnames: %v", err)
+	}
+}
+
+func (m *Manager) writeHostnames(ctx context.Context) error {
+	unlock, err := m.locks.lock(ctx, hostsLockName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	envs, err := m.scanEnvironments(ctx)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(envs))
+	for i, e := range envs {
+		names[i] = e.Name
+	}
+
+	current, err := m.sshClient.ExecContext(ctx, "cat /etc/hosts")
+	if err != nil {
+		return fmt.Errorf("failed to read /etc/hosts: %w", err)
+	}
+	updated := ReplaceHostsBlock(current, m.instanceName, HostsEntries("127.0.0.1", names))
+	if updated == current {
+		return nil
+	}
+
+	// Rewriting in place keeps the file's inode, which some setups bind-mount
+	cmd := fmt.Sprintf("printf '%%s' %s | sudo tee /etc/hosts >/dev/null", shellquote.Quote(updated))
+	if _, err := m.sshClient.ExecContext(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to write /etc/hosts: %w", err)
+	}
+	return nil
+}
+
+// SyncHostnames registers every environment in the VM's /etc/hosts now,
+// including ones created before hostnames were registered. Creating and
+// deleting environments keeps the names up to date on their own.
+func (m *Manager) SyncHostnames(ctx context.Context) error {
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+	return m.writeHostnames(ctx)
+}
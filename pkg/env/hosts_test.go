@@ -0,0 +1,103 @@
+package env
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHostsEntries(t *testing.T) {
+	got := HostsEntries("127.0.0.1", []string{"web-c3d4", "api-a1b2"})
+	want := []string{"127.0.0.1 api-a1b2.llima.local", "127.0.0.1 web-c3d4.llima.local"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HostsEntries() = %v, want %v", got, want)
+	}
+}
+
+func TestReplaceHostsBlock(t *testing.T) {
+	entries := []string{"127.0.0.1 api-a1b2.llima.local"}
+	block := hostsBegin + "\n127.0.0.1 api-a1b2.llima.local\n" + hostsEnd + "\n"
+	otherBlock := hostsBegin + " (client-a)\n127.0.0.1 web-c3d4.llima.local\n" + hostsEnd + " (client-a)\n"
+
+	tests := []struct {
+		name     string
+		content  string
+		instance string
+		entries  []string
+		want     string
+	}{
+		{
+			name:    "adds block",
+			content: "127.0.0.1 localhost\n",
+			entries: entries,
+			want:    "127.0.0.1 localhost\n" + block,
+		},
+		{
+			name:    "replaces block and keeps the rest",
+			content: "127.0.0.1 localhost\n" + hostsBegin + "\n127.0.0.1 old-0a0b.llima.local\n" + hostsEnd + "\n::1 localhost\n",
+			entries: entries,
+			want:    "127.0.0.1 localhost\n::1 localhost\n" + block,
+		},
+		{
+			name:    "removes block without entries",
+			content: "127.0.0.1 localhost\n" + block,
+			want:    "127.0.0.1 localhost\n",
+		},
+		{
+			name:    "unchanged",
+			content: "127.0.0.1 localhost\n" + block,
+			entries: entries,
+			want:    "127.0.0.1 localhost\n" + block,
+		},
+		{
+			name:    "empty file",
+			entries: entries,
+			want:    block,
+		},
+		{
+			name:     "keeps other instances' blocks",
+			content:  otherBlock,
+			instance: "llima-box",
+			entries:  entries,
+			want:     otherBlock + block,
+		},
+		{
+			name:     "other instance",
+			content:  "127.0.0.1 localhost\n" + block + otherBlock,
+			instance: "client-a",
+			want:     "127.0.0.1 localhost\n" + block,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReplaceHostsBlock(tt.content, tt.instance, tt.entries); got != tt.want {
+				t.Errorf("ReplaceHostsBlock() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncHostnames(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	mock.setResponse(scanCommand, "api-a1b2\trunning\t\nweb-c3d4\tpaused\t\n")
+	mock.setResponse("cat /etc/hosts", "127.0.0.1 localhost\n")
+
+	if err := newManagerWithExecutor(mock).SyncHostnames(context.Background()); err != nil {
+		t.Fatalf("SyncHostnames failed: %v", err)
+	}
+
+	var write string
+	for _, call := range mock.calls {
+		if strings.HasSuffix(call, "| sudo tee /etc/hosts >/dev/null") {
+			write = call
+		}
+	}
+	for _, want := range []string{"127.0.0.1 localhost", "127.0.0.1 api-a1b2.llima.local", "127.0.0.1 web-c3d4.llima.local"} {
+		if !strings.Contains(write, want) {
+			t.Errorf("expected /etc/hosts to be written with %q, got %q", want, write)
+		}
+	}
+}
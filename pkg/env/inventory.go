@@ -0,0 +1,153 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Inventory lists the software an environment was provisioned with, so
+// environments with a vulnerable package can be found without entering
+// each one
+type Inventory struct {
+	// Environment is the environment name
+	Environment string `json:"environment"`
+
+	// CollectedAt is when the package versions were read
+	CollectedAt time.Time `json:"collectedAt"`
+
+	// Packages are the Debian packages installed in the VM, which every
+	// environment sees
+	Packages []InventoryPackage `json:"packages"`
+
+	// Toolchains are the toolchain layers mounted in the environment
+	Toolchains []InventoryToolchain `json:"toolchains,omitempty"`
+}
+
+// InventoryPackage is an installed Debian package
+type InventoryPackage struct {
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	Architecture string `json:"architecture,omitempty"`
+
+	// Requested is set for packages the environment's Dockerfile or
+	// template asked for, as opposed to those the VM came with or other
+	// environments installed
+	Requested bool `json:"requested,omitempty"`
+}
+
+// InventoryToolchain is a toolchain layer mounted in an environment
+type InventoryToolchain struct {
+	// Name is the toolchain's name, as in /opt/toolchains/<name>
+	Name string `json:"name"`
+
+	// Layer is the layer built for it, which changes with its install
+	// script
+	Layer string `json:"layer"`
+}
+
+// inventoryPath returns the file holding the package versions recorded for
+// an environment: the time they were read, then one tab-separated line per
+// package with its name, version, and architecture
+func inventoryPath(envName string) string {
+	return envDir(envName) + "/packages.tsv"
+}
+
+// recordInventoryCommand returns the command recording the VM's installed
+// packages for the named environment. The list is made in the VM and
+// replaces the previous one in one step.
+func recordInventoryCommand(envName string) string {
+	return fmt.Sprintf(
+		`{ date -u +%%FT%%TZ && dpkg-query -W -f '${Package}\t${Version}\t${Architecture}\n'; } | sudo tee %[1]s.tmp >/dev/null && sudo mv -f %[1]s.tmp %[1]s`,
+		inventoryPath(envName),
+	)
+}
+
+// parseInventory decodes a file written by recordInventoryCommand. Package
+// names in requested are marked as requested.
+func parseInventory(envName, data string, requested map[string]bool) (*Inventory, error) {
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	collected, err := time.Parse(time.RFC3339, strings.TrimSpace(lines[0]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid package inventory of %s: %w", envName, err)
+	}
+
+	inv := &Inventory{Environment: envName, CollectedAt: collected, Packages: []InventoryPackage{}}
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+		pkg := InventoryPackage{Name: fields[0], Version: fields[1], Requested: requested[fields[0]]}
+		if len(fields) > 2 {
+			pkg.Architecture = fields[2]
+		}
+		inv.Packages = append(inv.Packages, pkg)
+	}
+	return inv, nil
+}
+
+// requestedPackages returns the names of the packages md says the
+// environment asked for, without version pins
+func requestedPackages(md *metadata) map[string]bool {
+	var packages []string
+	if md.Provisioned != nil {
+		packages = append(packages, md.Provisioned.Packages...)
+	}
+	if md.Template != nil {
+		packages = append(packages, md.Template.Packages...)
+	}
+	requested := make(map[string]bool, len(packages))
+	for _, pkg := range packages {
+		name, _, _ := strings.Cut(pkg, "=")
+		requested[name] = true
+	}
+	return requested
+}
+
+// recordInventory records the packages installed for envName once its
+// provisioning is done. Failing to record them doesn't fail provisioning;
+// Inventory reads them again when they're missing.
+func (m *Manager) recordInventory(ctx context.Context, envName string) {
+	if _, err := m.sshClient.ExecContext(ctx, recordInventoryCommand(envName)); err != nil {
+		m.warnf(envName, "failed to record the package inventory of %s: %v", envName, err)
+	}
+}
+
+// Inventory returns the packages and toolchains of the named environment,
+// as recorded when it was last provisioned. With refresh, or if none were
+// recorded, the installed packages are read again first.
+func (m *Manager) Inventory(ctx context.Context, envName string, refresh bool) (*Inventory, error) {
+	if err := m.ensureSSH(ctx); err != nil {
+		return nil, err
+	}
+
+	md, err := m.readMetadata(ctx, envName)
+	if err != nil {
+		return nil, fmt.Errorf("environment %s does not exist", envName)
+	}
+
+	output, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("sudo cat %s", inventoryPath(envName)))
+	if err != nil || refresh {
+		if _, err := m.sshClient.ExecContext(ctx, recordInventoryCommand(envName)); err != nil {
+			return nil, fmt.Errorf("failed to read installed packages: %w", err)
+		}
+		if output, err = m.sshClient.ExecContext(ctx, fmt.Sprintf("sudo cat %s", inventoryPath(envName))); err != nil {
+			return nil, fmt.Errorf("failed to read package inventory: %w", err)
+		}
+	}
+
+	inv, err := parseInventory(envName, output, requestedPackages(md))
+	if err != nil {
+		return nil, err
+	}
+	if md.Provisioned != nil {
+		for name, layer := range md.Provisioned.Toolchains {
+			inv.Toolchains = append(inv.Toolchains, InventoryToolchain{Name: name, Layer: layer})
+		}
+		sort.Slice(inv.Toolchains, func(i, j int) bool { return inv.Toolchains[i].Name < inv.Toolchains[j].Name })
+	}
+	return inv, nil
+}
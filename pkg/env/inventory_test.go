@@ -0,0 +1,84 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseInventory(t *testing.T) {
+	data := "2026-01-02T03:04:05Z\nopenssl\t3.0.13-0ubuntu3.4\tamd64\ncurl\t8.5.0-2ubuntu10.6\tamd64\n\n"
+	inv, err := parseInventory("app-a1b2", data, map[string]bool{"curl": true})
+	if err != nil {
+		t.Fatalf("parseInventory failed: %v", err)
+	}
+	if !inv.CollectedAt.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("expected the collection time, got %v", inv.CollectedAt)
+	}
+	want := []InventoryPackage{
+		{Name: "openssl", Version: "3.0.13-0ubuntu3.4", Architecture: "amd64"},
+		{Name: "curl", Version: "8.5.0-2ubuntu10.6", Architecture: "amd64", Requested: true},
+	}
+	if fmt.Sprint(inv.Packages) != fmt.Sprint(want) {
+		t.Errorf("packages = %+v, want %+v", inv.Packages, want)
+	}
+
+	if _, err := parseInventory("app-a1b2", "openssl\t3.0\n", nil); err == nil {
+		t.Error("expected an error for an inventory without a collection time")
+	}
+}
+
+func TestInventory(t *testing.T) {
+	readCmd := "sudo cat /envs/app-a1b2/packages.tsv"
+	md := `{"projectPath":"/p","step":"setup-done","version":2,"provisioned":{"packages":["libpq-dev=16.1"],"toolchains":{"go":"go-0a1b2c3d4e5f"}},"template":{"name":"node","packages":["nodejs"]}}`
+
+	tests := []struct {
+		name       string
+		refresh    bool
+		wantRecord int
+	}{
+		{name: "recorded"},
+		{name: "refreshed", refresh: true, wantRecord: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.setResponse(readMetadataCommand("app-a1b2"), md)
+			mock.setResponse(recordInventoryCommand("app-a1b2"), "")
+			mock.setResponse(readCmd, "2026-01-02T03:04:05Z\nlibpq-dev\t16.1\tarm64\nnodejs\t18.19.1\tarm64\nzlib1g\t1.3\tarm64\n")
+
+			inv, err := newManagerWithExecutor(mock).Inventory(context.Background(), "app-a1b2", tt.refresh)
+			if err != nil {
+				t.Fatalf("Inventory failed: %v", err)
+			}
+			if got := mock.callCount(recordInventoryCommand("app-a1b2")); got != tt.wantRecord {
+				t.Errorf("recorded packages %d times, want %d", got, tt.wantRecord)
+			}
+			if len(inv.Toolchains) != 1 || inv.Toolchains[0] != (InventoryToolchain{Name: "go", Layer: "go-0a1b2c3d4e5f"}) {
+				t.Errorf("expected the go toolchain, got %+v", inv.Toolchains)
+			}
+			for _, p := range inv.Packages {
+				if p.Requested != (p.Name == "libpq-dev" || p.Name == "nodejs") {
+					t.Errorf("package %s requested = %v", p.Name, p.Requested)
+				}
+			}
+		})
+	}
+
+	t.Run("not recorded yet", func(t *testing.T) {
+		mock := newMockExecutor()
+		mock.setResponse(readMetadataCommand("app-a1b2"), md)
+		mock.setResponse(recordInventoryCommand("app-a1b2"), "")
+		mock.setError(readCmd, fmt.Errorf("exit status 1"))
+
+		_, err := newManagerWithExecutor(mock).Inventory(context.Background(), "app-a1b2", false)
+		if mock.callCount(recordInventoryCommand("app-a1b2")) != 1 {
+			t.Errorf("expected the packages to be recorded, ran %v", mock.calls)
+		}
+		if err == nil {
+			t.Error("expected an error when the recorded packages can't be read")
+		}
+	})
+}
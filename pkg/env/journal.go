@@ -0,0 +1,202 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Journaled operations
+const (
+	opCreate = "create"
+	opDelete = "delete"
+	opRepair = "repair"
+)
+
+// journalEntry records an operation on an environment that has started but
+// not finished
+type journalEntry struct {
+	Op        string    `json:"op"`
+	Env       string    `json:"env"`
+	StartedAt time.Time `json:"startedAt"`
+
+	// Workspace is the environment's VM workspace, for isolated
+	// environments
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// journal records the operations changing environments in files on the
+// host, one per environment, for as long as they run. An entry left behind
+// belongs to a CLI that was killed or a host that crashed midway; the next
+// llima-box to connect replays it, finishing or undoing the operation, so
+// the environment isn't left in an unknown state.
+//
+// Like locker, a nil journal or one with an empty directory records
+// nothing; managers built for tests have none.
+type journal struct {
+	dir string
+
+	// progress, if set, is told about entries that can't be removed
+	progress ProgressFunc
+}
+
+// newJournal returns a journal kept under the host state directory for
+// instanceName
+func newJournal(instanceName string, progress ProgressFunc) *journal {
+	return &journal{dir: filepath.Join(instanceStateDir(instanceName), "journal"), progress: progress}
+}
+
+// path returns the file holding envName's entry
+func (j *journal) path(envName string) string {
+	return filepath.Join(j.dir, envName+".json")
+}
+
+// begin records that an operation has started. The returned function
+// removes the entry once the operation has returned, whether it succeeded
+// or not: a failure is reported to the user, while an entry only outlives
+// its operation if the process dies.
+func (j *journal) begin(e journalEntry) (func(), error) {
+	if j == nil || j.dir == "" {
+		return func() {}, nil
+	}
+
+	e.StartedAt = time.Now().UTC()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+	if err := os.MkdirAll(j.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	tmp := j.path(e.Env) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	if err := os.Rename(tmp, j.path(e.Env)); err != nil {
+		return nil, fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	return func() { j.remove(e.Env) }, nil
+}
+
+// remove deletes envName's entry
+func (j *journal) remove(envName string) {
+	if err := os.Remove(j.path(envName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		j.progress.emit(Event{Level: EventWarning, Environment: envName, Message: fmt.Sprintf("failed to remove journal entry for %s: %v", envName, err)})
+	}
+}
+
+// entry returns envName's entry, or nil if there is none
+func (j *journal) entry(envName string) (*journalEntry, error) {
+	data, err := os.ReadFile(j.path(envName)) // #nosec G304 -- envName is a validated environment name
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal entry: %w", err)
+	}
+	var e journalEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("failed to parse journal entry for %s: %w", envName, err)
+	}
+	return &e, nil
+}
+
+// pending returns the names of the environments with entries
+func (j *journal) pending() ([]string, error) {
+	if j == nil || j.dir == "" {
+		return nil, nil
+	}
+	files, err := os.ReadDir(j.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	var names []string
+	for _, f := range files {
+		if name, ok := strings.CutSuffix(f.Name(), ".json"); ok && !f.IsDir() {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// replayJournal finishes or undoes operations whose CLI died midway.
+// Operations still running in another process hold their environment's lock
+// and are left alone. Failures are reported but don't prevent using the VM;
+// the entry is kept so the next start tries again.
+func (m *Manager) replayJournal(ctx context.Context) {
+	names, err := m.journal.pending()
+	if err != nil {
+		m.warnf("", "%v", err)
+		return
+	}
+
+	for _, name := range names {
+		unlock, ok, err := m.locks.tryLock(name)
+		if err != nil {
+			m.warnf(name, "failed to replay journal for %s: %v", name, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		// The operation may have finished since the journal was listed
+		e, err := m.journal.entry(name)
+		if err == nil && e != nil {
+			err = m.replay(ctx, e)
+		}
+		if err != nil {
+			m.warnf(name, "failed to recover interrupted operation on %s: %v", name, err)
+		} else if e != nil {
+			m.journal.remove(name)
+		}
+		unlock()
+	}
+}
+
+// replay finishes or undoes an interrupted operation. A delete is finished;
+// its commands are safe to run again. A create that hadn't got past its
+// first step is undone, so it doesn't linger as a provisioning environment;
+// later steps are checkpointed and resume on the next shell. A repair is
+// run again.
+func (m *Manager) replay(ctx context.Context, e *journalEntry) error {
+	m.probes.invalidate()
+	switch e.Op {
+	case opDelete:
+		m.debugf(e.Env, "Finishing interrupted delete of %s", e.Env)
+		return m.deleteEnv(ctx, e.Env, e.Workspace)
+
+	case opCreate:
+		md, err := m.readMetadata(ctx, e.Env)
+		if errors.Is(err, errNoMetadata) {
+			// Nothing was recorded
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if md.Step != stepStarted {
+			// Setup resumes from its checkpoint
+			return nil
+		}
+		m.debugf(e.Env, "Undoing interrupted create of %s", e.Env)
+		return m.deleteEnv(ctx, e.Env, e.Workspace)
+
+	case opRepair:
+		m.debugf(e.Env, "Retrying interrupted repair of %s", e.Env)
+		if err := m.restartEnvironment(ctx, e.Env); err != nil {
+			m.warnf(e.Env, "environment %s needs repair: %v", e.Env, err)
+			return m.markNeedsRepair(ctx, e.Env)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown operation %q", e.Op)
+}
@@ -0,0 +1,125 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	j := &journal{dir: t.TempDir()}
+
+	done, err := j.begin(journalEntry{Op: opDelete, Env: "app-a1b2", Workspace: VMWorkspaceRoot + "/app"})
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+
+	names, err := j.pending()
+	if err != nil || len(names) != 1 || names[0] != "app-a1b2" {
+		t.Fatalf("expected one pending entry, got %v (err %v)", names, err)
+	}
+	e, err := j.entry("app-a1b2")
+	if err != nil || e == nil {
+		t.Fatalf("entry failed: %v", err)
+	}
+	if e.Op != opDelete || e.Workspace != VMWorkspaceRoot+"/app" || e.StartedAt.IsZero() {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	done()
+	if names, _ := j.pending(); len(names) != 0 {
+		t.Errorf("expected no pending entries after the operation returned, got %v", names)
+	}
+}
+
+func TestJournal_Disabled(t *testing.T) {
+	var j *journal
+	done, err := j.begin(journalEntry{Op: opCreate, Env: "app-a1b2"})
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	done()
+	if names, err := j.pending(); err != nil || names != nil {
+		t.Errorf("expected nothing pending, got %v (err %v)", names, err)
+	}
+}
+
+func TestReplayJournal(t *testing.T) {
+	tests := []struct {
+		name       string
+		entry      journalEntry
+		metadata   string
+		readErr    bool
+		locked     bool
+		wantDelete bool
+		wantKept   bool
+	}{
+		{
+			name:       "interrupted delete is finished",
+			entry:      journalEntry{Op: opDelete, Env: "app-a1b2"},
+			wantDelete: true,
+		},
+		{
+			name:       "create interrupted before its first step is undone",
+			entry:      journalEntry{Op: opCreate, Env: "app-a1b2"},
+			metadata:   `{"projectPath":"/p","step":"started","version":2}`,
+			wantDelete: true,
+		},
+		{
+			name:     "create interrupted later resumes on the next shell",
+			entry:    journalEntry{Op: opCreate, Env: "app-a1b2"},
+			metadata: `{"projectPath":"/p","step":"user-created","version":2}`,
+		},
+		{
+			name:  "create interrupted before anything was recorded is dropped",
+			entry: journalEntry{Op: opCreate, Env: "app-a1b2"},
+		},
+		{
+			name:     "create whose metadata can't be read is kept",
+			entry:    journalEntry{Op: opCreate, Env: "app-a1b2"},
+			readErr:  true,
+			wantKept: true,
+		},
+		{
+			name:     "operation still running elsewhere is left alone",
+			entry:    journalEntry{Op: opDelete, Env: "app-a1b2"},
+			locked:   true,
+			wantKept: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			mock.setResponse(readMetadataCommand("app-a1b2"), tt.metadata)
+			if tt.readErr {
+				mock.setError(readMetadataCommand("app-a1b2"), fmt.Errorf("connection lost"))
+			}
+			m := newManagerWithExecutor(mock)
+			m.locks = &locker{dir: t.TempDir()}
+			m.journal = &journal{dir: t.TempDir()}
+
+			if _, err := m.journal.begin(tt.entry); err != nil {
+				t.Fatal(err)
+			}
+			if tt.locked {
+				unlock, err := m.locks.lock(t.Context(), tt.entry.Env)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer unlock()
+			}
+
+			m.replayJournal(t.Context())
+
+			if got := calledWith(mock, "sudo userdel -r app-a1b2"); got != tt.wantDelete {
+				t.Errorf("expected delete: %v, got calls %v", tt.wantDelete, mock.calls)
+			}
+			_, err := os.Stat(m.journal.path(tt.entry.Env))
+			if kept := err == nil; kept != tt.wantKept {
+				t.Errorf("expected entry kept: %v, got %v", tt.wantKept, kept)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package env
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/dotenv"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+const (
+	// layersDir holds built toolchain layers on the VM data disk
+	layersDir = vm.DataDiskMountPoint + "/layers"
+
+	// toolchainMountRoot is where layers appear inside environments
+	toolchainMountRoot = "/opt/toolchains"
+
+	// layerBuildUser is the unprivileged system user toolchain install
+	// scripts run as
+	layerBuildUser = "llima-box-build"
+
+	// profileHook sources the per-environment profile for login shells, and
+	// the command guard hook for bash
+	profileHook = `[ -r "/envs/$USER/profile.sh" ] && . "/envs/$USER/profile.sh"
+[ -n "$BASH_VERSION" ] && [ -r "/envs/$USER/guard.sh" ] && . "/envs/$USER/guard.sh"`
+)
+
+// layerKey returns the cache key for a toolchain layer.
+// Environments declaring the same name and install script share a layer.
+func layerKey(tc config.Toolchain) string {
+	sum := sha256.Sum256([]byte(tc.Name + "\x00" + tc.Install))
+	return fmt.Sprintf("%s-%x", tc.Name, sum[:6])
+}
+
+// buildLayerCommand returns the command that builds a layer if it isn't cached.
+// The build runs under a per-layer lock into a staging directory that is only
+// renamed into place on success, so concurrent or interrupted builds never
+// leave a partial layer behind. Install scripts come from the project, which
+// the agent can edit, so they run as layerBuildUser, which only owns the
+// staging directory and a scratch home; the finished layer is handed to root.
+func buildLayerCommand(tc config.Toolchain) string {
+	dir := layersDir + "/" + layerKey(tc)
+	script := fmt.Sprintf(
+		`if [ ! -d %[1]s ]; then `+
+			`id -u %[2]s >/dev/null 2>&1 || useradd --system --no-create-home --shell /usr/sbin/nologin %[2]s; `+
+			`rm -rf %[1]s.tmp %[1]s.home && mkdir %[1]s.tmp %[1]s.home && chown %[2]s: %[1]s.tmp %[1]s.home && `+
+			`runuser -u %[2]s -- env LAYER=%[1]s.tmp HOME=%[1]s.home bash -eo pipefail -c "$1" && `+
+			`rm -rf %[1]s.home && chown -hR root:root %[1]s.tmp && mv %[1]s.tmp %[1]s; fi`,
+		dir, layerBuildUser,
+	)
+	return fmt.Sprintf("sudo mkdir -p %s && sudo flock %s.lock sh -c %s _ %s",
+		layersDir, dir, shellquote.Quote(script), shellquote.Quote(tc.Install))
+}
+
+// installScriptHash returns the short sha256 of a toolchain's install script,
+// shown when the script is offered for confirmation
+func installScriptHash(tc config.Toolchain) string {
+	sum := sha256.Sum256([]byte(tc.Install))
+	return fmt.Sprintf("%x", sum[:6])
+}
+
+// ensureLayers builds any toolchain layers that aren't cached yet
+func (m *Manager) ensureLayers(ctx context.Context, toolchains []config.Toolchain) error {
+	for _, tc := range toolchains {
+		if _, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("[ -d %s/%s ]", layersDir, layerKey(tc))); err == nil {
+			continue
+		}
+
+		m.debugf("", "Building toolchain layer %s (cached for later environments)", tc.Name)
+		if err := m.streamCommand(ctx, "", buildLayerCommand(tc)); err != nil {
+			return fmt.Errorf("failed to build toolchain %s: %w", tc.Name, err)
+		}
+	}
+	return nil
+}
+
+// layerMountCommands returns the commands bind-mounting the toolchain layers
+// read-only into the namespace held by pid. Toolchains that are already
+// mounted are left alone.
+func layerMountCommands(pid string, toolchains []config.Toolchain) []RemoteCommand {
+	cmds := make([]RemoteCommand, 0, len(toolchains))
+	for _, tc := range toolchains {
+		src := layersDir + "/" + layerKey(tc)
+		dst := toolchainMountRoot + "/" + tc.Name
+		cmds = append(cmds, RemoteCommand{
+			Purpose: "mount toolchain " + tc.Name,
+			Script:  pidRunner(pid).Script(readOnlyBindScript(src, dst)),
+		})
+	}
+	return cmds
+}
+
+// renderProfile returns the per-environment login profile, which also tells
+// programs which sandbox they're running in
+func renderProfile(env *Environment, toolchains []config.Toolchain) string {
+	var b strings.Builder
+	b.WriteString("# Generated by llima-box\n")
+	for _, v := range sandboxVars(env) {
+		fmt.Fprintf(&b, "export %s=%s\n", v.Key, shellWord(v.Value))
+	}
+	for _, v := range templateVars(env) {
+		fmt.Fprintf(&b, "export %s=%s\n", v.Key, shellWord(v.Value))
+	}
+	for _, tc := range toolchains {
+		fmt.Fprintf(&b, "export PATH=%s/%s/bin:$PATH\n", toolchainMountRoot, tc.Name)
+	}
+	return b.String()
+}
+
+// sandboxVars are the variables telling programs which environment they run in
+func sandboxVars(env *Environment) []dotenv.Var {
+	return []dotenv.Var{
+		{Key: "LLIMA_BOX_ENV", Value: env.Name},
+		{Key: "LLIMA_BOX_PROJECT", Value: env.dir()},
+		{Key: "LLIMA_BOX_ENV_FILE", Value: SandboxInfoPath},
+	}
+}
+
+// templateVars are the variables set by the template env was created from
+func templateVars(env *Environment) []dotenv.Var {
+	if env.Template == nil {
+		return nil
+	}
+	return env.Template.Vars()
+}
+
+// toolchainPath returns defaultPath with the toolchains' bin directories in
+// front, in the order the profile would leave them
+func toolchainPath(toolchains []config.Toolchain) string {
+	dirs := make([]string, 0, len(toolchains)+1)
+	for i := len(toolchains) - 1; i >= 0; i-- {
+		dirs = append(dirs, toolchainMountRoot+"/"+toolchains[i].Name+"/bin")
+	}
+	return strings.Join(append(dirs, defaultPath), ":")
+}
+
+// profileCommand returns the command installing the profile hook and
+// writing env's profile
+func profileCommand(env *Environment, toolchains []config.Toolchain) RemoteCommand {
+	return RemoteCommand{
+		Purpose: "write environment profile",
+		Script: fmt.Sprintf(
+			"printf '%%s\\n' %s | sudo tee /etc/profile.d/llima-box.sh >/dev/null && printf '%%s' %s | sudo tee /envs/%s/profile.sh >/dev/null",
+			shellquote.Quote(profileHook),
+			shellquote.Quote(renderProfile(env, toolchains)),
+			env.Name,
+		),
+	}
+}
@@ -0,0 +1,92 @@
+package env
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/env/templates"
+)
+
+func TestLayerKey(t *testing.T) {
+	a := config.Toolchain{Name: "node", Install: "install node 22"}
+	b := config.Toolchain{Name: "node", Install: "install node 20"}
+
+	if layerKey(a) != layerKey(a) {
+		t.Error("layerKey is not deterministic")
+	}
+	if layerKey(a) == layerKey(b) {
+		t.Error("different install scripts produced the same layer key")
+	}
+	if !strings.HasPrefix(layerKey(a), "node-") {
+		t.Errorf("expected key to start with toolchain name, got %s", layerKey(a))
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "simple", want: "'simple'"},
+		{input: "with space", want: "'with space'"},
+		{input: "it's", want: `'it'\''s'`},
+		{input: "", want: "''"},
+		{input: "$(rm -rf /)", want: "'$(rm -rf /)'"},
+	}
+
+	for _, tt := range tests {
+		if got := shellquote.Quote(tt.input); got != tt.want {
+			t.Errorf("shellquote.Quote(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRenderProfile(t *testing.T) {
+	env := &Environment{
+		Name:        "app-a1b2",
+		ProjectPath: "/Users/alice/my app",
+		Template:    &templates.Template{Name: "python-ml", Env: map[string]string{"PYTHONUNBUFFERED": "1", "GREETING": "it's $HOME"}},
+	}
+	profile := renderProfile(env, []config.Toolchain{{Name: "node"}, {Name: "go"}})
+
+	for _, want := range []string{
+		"export LLIMA_BOX_ENV=app-a1b2",
+		"export GREETING='it'\\''s $HOME'\nexport PYTHONUNBUFFERED=1",
+		"export LLIMA_BOX_PROJECT='/Users/alice/my app'",
+		"export LLIMA_BOX_ENV_FILE=/run/llima-box/env.json",
+		"export PATH=/opt/toolchains/node/bin:$PATH",
+		"export PATH=/opt/toolchains/go/bin:$PATH",
+	} {
+		if !strings.Contains(profile, want) {
+			t.Errorf("profile missing %q:\n%s", want, profile)
+		}
+	}
+}
+
+func TestBuildLayerCommand(t *testing.T) {
+	tc := config.Toolchain{Name: "node", Install: "echo 'hi'"}
+	cmd := buildLayerCommand(tc)
+
+	if !strings.Contains(cmd, "flock "+layersDir+"/"+layerKey(tc)+".lock") {
+		t.Errorf("expected build to be locked per layer: %s", cmd)
+	}
+	if !strings.HasSuffix(cmd, shellquote.Quote(tc.Install)) {
+		t.Errorf("expected install script passed as quoted argument: %s", cmd)
+	}
+	if !strings.Contains(cmd, "runuser -u "+layerBuildUser+" -- ") {
+		t.Errorf("expected install script to run as %s: %s", layerBuildUser, cmd)
+	}
+	if !strings.Contains(cmd, "chown -hR root:root "+layersDir+"/"+layerKey(tc)+".tmp && mv") {
+		t.Errorf("expected the finished layer to be handed to root: %s", cmd)
+	}
+}
+
+func TestToolchainPath(t *testing.T) {
+	got := toolchainPath([]config.Toolchain{{Name: "node"}, {Name: "go"}})
+	want := "/opt/toolchains/go/bin:/opt/toolchains/node/bin:" + defaultPath
+	if got != want {
+		t.Errorf("toolchainPath() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,205 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+)
+
+// cgroupRoot is the cgroup v2 directory holding one cgroup per environment
+// with resource limits
+const cgroupRoot = "/sys/fs/cgroup/llima-box"
+
+// cpuPeriod is the cgroup CPU accounting period in microseconds; a limit of
+// n CPUs allows n periods of CPU time per period
+const cpuPeriod = 100000
+
+// exitLimitsFailed is the status a session exits with when its environment
+// has limits that couldn't be applied, instead of running unlimited
+const exitLimitsFailed = 78
+
+// NoSwap is the Limits.Swap value keeping an environment out of swap
+// entirely
+const NoSwap int64 = -1
+
+// Limits caps the CPU and memory used by all sessions of an environment
+// together. Zero values mean no limit.
+type Limits struct {
+	// CPUs is the CPU time allowed, in cores (e.g. 1.5)
+	CPUs float64
+
+	// Memory is the memory allowed in bytes. Processes are reclaimed and
+	// then killed by the kernel's OOM killer when it's exceeded.
+	Memory int64
+
+	// Swap is the swap space allowed in bytes, or NoSwap. Once it's used
+	// up, memory beyond the Memory limit isn't swapped out and the OOM
+	// killer steps in, so one environment can't push the whole VM into
+	// swap. It only matters if the VM has swap, like the zram device
+	// llima-box sets up.
+	Swap int64
+}
+
+// IsZero reports whether no limit is set
+func (l Limits) IsZero() bool {
+	return l.CPUs == 0 && l.Memory == 0 && l.Swap == 0
+}
+
+// cgroupDir returns the cgroup of the named environment
+func cgroupDir(envName string) string {
+	return cgroupRoot + "/" + envName
+}
+
+// limitsPath returns the file recording an environment's limits, which
+// outlives the cgroup across VM restarts. Each line holds a cgroup interface
+// file and the value to write to it.
+func limitsPath(envName string) string {
+	return envDir(envName) + "/limits"
+}
+
+// formatLimits returns the contents of the limits file for l
+func formatLimits(l Limits) string {
+	cpu := "max"
+	if l.CPUs > 0 {
+		cpu = strconv.FormatInt(int64(math.Ceil(l.CPUs*cpuPeriod)), 10)
+	}
+	memory := "max"
+	if l.Memory > 0 {
+		memory = strconv.FormatInt(l.Memory, 10)
+	}
+	swap := "max"
+	switch {
+	case l.Swap == NoSwap:
+		swap = "0"
+	case l.Swap > 0:
+		swap = strconv.FormatInt(l.Swap, 10)
+	}
+	return fmt.Sprintf("cpu.max %s %d\nmemory.max %s\nmemory.swap.max %s\n", cpu, cpuPeriod, memory, swap)
+}
+
+// parseLimits reads a limits file written by SetLimits
+func parseLimits(data string) (Limits, error) {
+	var l Limits
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[1] == "max" {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return Limits{}, fmt.Errorf("invalid limit %q", line)
+		}
+		switch fields[0] {
+		case "cpu.max":
+			period := int64(cpuPeriod)
+			if len(fields) > 2 {
+				if period, err = strconv.ParseInt(fields[2], 10, 64); err != nil || period <= 0 {
+					return Limits{}, fmt.Errorf("invalid limit %q", line)
+				}
+			}
+			l.CPUs = float64(value) / float64(period)
+		case "memory.max":
+			l.Memory = value
+		case "memory.swap.max":
+			l.Swap = value
+			if value == 0 {
+				l.Swap = NoSwap
+			}
+		}
+	}
+	return l, nil
+}
+
+// applyLimitsScript returns a script creating the named environment's
+// cgroup and writing the limits recorded for it. The cpu and memory
+// controllers are enabled on the way down from the cgroup root. The script
+// fails if any step does, except lifting a limit the kernel doesn't offer,
+// like swap on kernels without swap accounting.
+func applyLimitsScript(envName string) string {
+	cg := cgroupDir(envName)
+	return strings.Join([]string{
+		"sudo mkdir -p " + shellWord(cg),
+		"echo '+cpu +memory' | sudo tee /sys/fs/cgroup/cgroup.subtree_control " + shellWord(cgroupRoot+"/cgroup.subtree_control") + " >/dev/null",
+		fmt.Sprintf(`sudo cat %[1]s | while read -r file value; do case "$value" in max*) [ -e %[2]s/"$file" ] || continue;; esac; echo "$value" | sudo tee %[2]s/"$file" >/dev/null || exit 1; done`,
+			shellWord(limitsPath(envName)), shellWord(cg)),
+	}, " && ")
+}
+
+// joinLimitsScript returns the lines starting a session that move it into
+// the named environment's cgroup, so the session and everything it starts
+// count against the environment's limits. Environments without limits are
+// left alone. A session whose limits can't be applied doesn't start.
+func joinLimitsScript(envName string) string {
+	return fmt.Sprintf(
+		`if sudo test -f %[1]s; then { %[2]s && echo $$ | sudo tee %[3]s/cgroup.procs >/dev/null; } || { echo 'llima-box: failed to apply resource limits' >&2; exit %[4]d; }; fi`,
+		shellWord(limitsPath(envName)), applyLimitsScript(envName), shellWord(cgroupDir(envName)), exitLimitsFailed,
+	)
+}
+
+// Limits returns the resource limits of an environment
+func (m *Manager) Limits(ctx context.Context, envName string) (Limits, error) {
+	if err := m.ensureSSH(ctx); err != nil {
+		return Limits{}, err
+	}
+
+	output, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("sudo cat %s 2>/dev/null || true", limitsPath(envName)))
+	if err != nil {
+		return Limits{}, fmt.Errorf("failed to read resource limits: %w", err)
+	}
+	return parseLimits(output)
+}
+
+// SetLimits sets the resource limits of an environment. They apply to its
+// running sessions at once and to every session started later, until
+// they're changed; zero Limits removes them.
+func (m *Manager) SetLimits(ctx context.Context, envName string, limits Limits) error {
+	if limits.CPUs < 0 || limits.Memory < 0 || (limits.Swap < 0 && limits.Swap != NoSwap) {
+		return fmt.Errorf("resource limits must not be negative")
+	}
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+
+	// Removed limits are written as "max" first to lift them from running
+	// sessions
+	cmd := fmt.Sprintf("printf '%%s' %s | sudo tee %s >/dev/null && %s",
+		shellquote.Quote(formatLimits(limits)), limitsPath(envName), applyLimitsScript(envName))
+	if limits.IsZero() {
+		cmd += " && sudo rm -f " + limitsPath(envName)
+	}
+
+	if _, err := m.sshClient.ExecContext(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to set resource limits (the VM needs cgroup v2): %w", err)
+	}
+	return nil
+}
+
+// memorySizePattern matches memory sizes such as "4G", "512MiB", or "1.5GB"
+var memorySizePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?) ?([KMGT]?)(?:I?B)?$`)
+
+// ParseMemorySize parses a memory size such as "4G" or "512MiB" into bytes.
+// Units are binary: K is 1024 bytes. A number without a unit is in bytes.
+func ParseMemorySize(s string) (int64, error) {
+	match := memorySizePattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if match == nil {
+		return 0, fmt.Errorf("invalid memory size %q (use a size such as 4G or 512M)", s)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory size %q: %w", s, err)
+	}
+	shift := strings.Index("KMGT", match[2]) + 1
+	if match[2] == "" {
+		shift = 0
+	}
+	bytes := value * float64(int64(1)<<(10*shift))
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("memory size %q is too large", s)
+	}
+	return int64(bytes), nil
+}
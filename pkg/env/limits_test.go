@@ -0,0 +1,192 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMemorySize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{input: "4G", want: 4 << 30},
+		{input: "512M", want: 512 << 20},
+		{input: "512MiB", want: 512 << 20},
+		{input: "1.5GB", want: 3 << 29},
+		{input: "2g", want: 2 << 30},
+		{input: "1048576", want: 1 << 20},
+		{input: "0", want: 0},
+		{input: "4 GiB", want: 4 << 30},
+		{input: "", wantErr: true},
+		{input: "-1G", wantErr: true},
+		{input: "4X", wantErr: true},
+		{input: "G", wantErr: true},
+		{input: "99999999999T", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMemorySize(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMemorySize failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitsFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		want   string
+	}{
+		{
+			name:   "cpu and memory",
+			limits: Limits{CPUs: 2, Memory: 4 << 30},
+			want:   "cpu.max 200000 100000\nmemory.max 4294967296\nmemory.swap.max max\n",
+		},
+		{
+			name:   "fractional cpus only",
+			limits: Limits{CPUs: 0.5},
+			want:   "cpu.max 50000 100000\nmemory.max max\nmemory.swap.max max\n",
+		},
+		{
+			name:   "memory with limited swap",
+			limits: Limits{Memory: 4 << 30, Swap: 1 << 30},
+			want:   "cpu.max max 100000\nmemory.max 4294967296\nmemory.swap.max 1073741824\n",
+		},
+		{
+			name:   "no swap",
+			limits: Limits{Memory: 4 << 30, Swap: NoSwap},
+			want:   "cpu.max max 100000\nmemory.max 4294967296\nmemory.swap.max 0\n",
+		},
+		{
+			name: "no limits",
+			want: "cpu.max max 100000\nmemory.max max\nmemory.swap.max max\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := formatLimits(tt.limits)
+			if data != tt.want {
+				t.Errorf("formatLimits() = %q, want %q", data, tt.want)
+			}
+			got, err := parseLimits(data)
+			if err != nil {
+				t.Fatalf("parseLimits failed: %v", err)
+			}
+			if got != tt.limits {
+				t.Errorf("parseLimits() = %+v, want %+v", got, tt.limits)
+			}
+		})
+	}
+
+	// Files written before swap could be limited have no swap line
+	if got, err := parseLimits("cpu.max max 100000\nmemory.max 1024\n"); err != nil || got != (Limits{Memory: 1024}) {
+		t.Errorf("parseLimits() of an older file = %+v, %v", got, err)
+	}
+
+	if _, err := parseLimits("memory.max lots\n"); err == nil {
+		t.Error("expected an error for an invalid limits file")
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		limits     Limits
+		wantWrite  string
+		wantRemove bool
+		wantErr    string
+	}{
+		{
+			name:      "records and applies limits",
+			limits:    Limits{CPUs: 1.5, Memory: 1 << 30},
+			wantWrite: "printf '%s' 'cpu.max 150000 100000\nmemory.max 1073741824\nmemory.swap.max max\n' | sudo tee /envs/app-a1b2/limits",
+		},
+		{
+			name:       "zero limits lift and remove them",
+			wantWrite:  "printf '%s' 'cpu.max max 100000\nmemory.max max\nmemory.swap.max max\n' | sudo tee /envs/app-a1b2/limits",
+			wantRemove: true,
+		},
+		{
+			name:    "negative limits",
+			limits:  Limits{CPUs: -1},
+			wantErr: "must not be negative",
+		},
+		{
+			name:    "negative swap",
+			limits:  Limits{Swap: -2},
+			wantErr: "must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			m := newManagerWithExecutor(mock)
+
+			err := m.SetLimits(t.Context(), "app-a1b2", tt.limits)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetLimits failed: %v", err)
+			}
+
+			if len(mock.calls) != 1 {
+				t.Fatalf("expected one command, got %v", mock.calls)
+			}
+			cmd := mock.calls[0]
+			if !strings.HasPrefix(cmd, tt.wantWrite) {
+				t.Errorf("expected the limits to be recorded, got:\n%s", cmd)
+			}
+			if !strings.Contains(cmd, "sudo mkdir -p /sys/fs/cgroup/llima-box/app-a1b2") {
+				t.Errorf("expected the limits to be applied to the cgroup, got:\n%s", cmd)
+			}
+			if got := strings.HasSuffix(cmd, "sudo rm -f /envs/app-a1b2/limits"); got != tt.wantRemove {
+				t.Errorf("limits file removed = %v, want %v:\n%s", got, tt.wantRemove, cmd)
+			}
+		})
+	}
+}
+
+func TestEnterNamespace_Limits(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	m := newManagerWithExecutor(mock)
+	env := &Environment{Name: "app-a1b2", Driver: vmOnlyMount}
+
+	if err := m.EnterNamespace(t.Context(), env, []string{"make"}, EnterOptions{}); err != nil {
+		t.Fatalf("EnterNamespace failed: %v", err)
+	}
+
+	if len(mock.calls) != 1 {
+		t.Fatalf("expected one command, got %v", mock.calls)
+	}
+	cmd := mock.calls[0]
+	join := strings.Index(cmd, "echo $$ | sudo tee /sys/fs/cgroup/llima-box/app-a1b2/cgroup.procs")
+	session := strings.Index(cmd, "nsenter")
+	if join < 0 || session < join {
+		t.Errorf("expected the session to join the environment's cgroup before entering the namespace, got:\n%s", cmd)
+	}
+	if !strings.Contains(cmd, "if sudo test -f /envs/app-a1b2/limits; then") {
+		t.Errorf("expected the cgroup to be joined only when limits are set, got:\n%s", cmd)
+	}
+}
@@ -0,0 +1,153 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// lockPollInterval is how often a busy lock is retried
+const lockPollInterval = 100 * time.Millisecond
+
+// ErrBusy is returned when another llima-box process holds an environment's
+// lock for longer than the manager waits (see Options.LockWait)
+var ErrBusy = errors.New("environment is busy")
+
+// recoveryLockName serializes post-boot recovery between concurrent CLIs
+const recoveryLockName = "recovery"
+
+// vmStartLockName serializes starting the VM between concurrent CLIs
+const vmStartLockName = "vm-start"
+
+// locker serializes changes to the environment inventory between llima-box
+// processes on the host. Every operation that creates, restarts, or deletes an
+// environment runs from the host, so host file locks cover concurrent CLI
+// invocations without holding a lock open across SSH commands.
+//
+// A nil locker, or one with an empty directory, doesn't lock; managers built
+// for tests have none.
+type locker struct {
+	dir string
+
+	// wait bounds how long lock waits for a busy lock before failing with
+	// ErrBusy. Zero waits until the context ends; a negative wait doesn't
+	// wait at all.
+	wait time.Duration
+
+	// progress, if set, is told when lock starts waiting
+	progress ProgressFunc
+}
+
+// newLocker returns a locker keeping its lock files under the host state
+// directory for instanceName, waiting up to wait for busy locks
+func newLocker(instanceName string, wait time.Duration, progress ProgressFunc) *locker {
+	return &locker{dir: filepath.Join(instanceStateDir(instanceName), "locks"), wait: wait, progress: progress}
+}
+
+// instanceStateDir returns the host state directory for instanceName's
+// environments, or one under the temporary directory if the state directory
+// is unknown. The default instance keeps its state at the top, where it was
+// before other instances could be used.
+func instanceStateDir(instanceName string) string {
+	dir, err := config.StateDir()
+	if err != nil {
+		dir = filepath.Join(os.TempDir(), "llima-box")
+	}
+	if instanceName == "" || instanceName == vm.DefaultInstanceName {
+		return dir
+	}
+	return filepath.Join(dir, "instances", instanceName)
+}
+
+// vmLocksDir holds the lock files of vmLockScript. /run is a tmpfs, so
+// they're gone after a VM restart along with their holders.
+const vmLocksDir = "/run/llima-box/locks"
+
+// vmLockScript returns a command running script as root under the named
+// lock inside the VM. Host locks only serialize llima-box processes that
+// share a state directory; this guards the steps that must not run twice at
+// once, like creating the user or starting the namespace keeper, against
+// any other. Processes script leaves running don't hold the lock.
+func vmLockScript(name, script string) string {
+	return fmt.Sprintf("sudo mkdir -p %[1]s && sudo flock -o %[1]s/%[2]s.lock sh -c %[3]s", vmLocksDir, name, shellquote.Quote(script))
+}
+
+// lock acquires the named lock, waiting until it's free, the locker's wait
+// runs out, or ctx ends. The returned function releases it. Locks are released by the OS if the process
+// dies, so a crash never leaves an environment locked.
+func (l *locker) lock(ctx context.Context, name string) (func(), error) {
+	if l == nil || l.dir == "" {
+		return func() {}, nil
+	}
+
+	if err := os.MkdirAll(l.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	path := filepath.Join(l.dir, name+".lock")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600) // #nosec G304 -- name is an environment name or a fixed lock name
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	var deadline <-chan time.Time
+	if l.wait > 0 {
+		timer := time.NewTimer(l.wait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for waited := false; ; waited = true {
+		busy, err := lockFile(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", name, err)
+		}
+		if !busy {
+			break
+		}
+		if l.wait < 0 && ctx.Err() == nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("%w: %s is being changed by another llima-box process", ErrBusy, name)
+		}
+		if !waited && ctx.Err() == nil {
+			l.progress.emit(Event{Level: EventDebug, Environment: name, Message: fmt.Sprintf("Waiting for another llima-box process to finish with %s", name)})
+		}
+
+		select {
+		case <-deadline:
+			_ = f.Close()
+			return nil, fmt.Errorf("%w: %s is still being changed by another llima-box process after %s", ErrBusy, name, l.wait)
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, fmt.Errorf("gave up waiting for lock %s: %w", name, ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	return func() {
+		unlockFile(f)
+		_ = f.Close()
+	}, nil
+}
+
+// tryLock acquires the named lock if it's free. ok is false if another
+// process holds it.
+func (l *locker) tryLock(name string) (unlock func(), ok bool, err error) {
+	// lock tries once before giving up on a cancelled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	unlock, err = l.lock(ctx, name)
+	if errors.Is(err, context.Canceled) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return unlock, true, nil
+}
@@ -0,0 +1,122 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocker(t *testing.T) {
+	l := &locker{dir: t.TempDir()}
+
+	unlock, err := l.lock(context.Background(), "app-a1b2")
+	if err != nil {
+		t.Fatalf("lock failed: %v", err)
+	}
+
+	// flock locks belong to the open file, so a second open conflicts even
+	// within one process
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockPollInterval)
+	defer cancel()
+	if _, err := l.lock(ctx, "app-a1b2"); err == nil {
+		t.Fatal("expected second lock to wait until the context ended")
+	}
+
+	// Other names are independent
+	unlockOther, err := l.lock(context.Background(), "other-c3d4")
+	if err != nil {
+		t.Fatalf("lock of another name failed: %v", err)
+	}
+	unlockOther()
+
+	unlock()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	unlock, err = l.lock(ctx, "app-a1b2")
+	if err != nil {
+		t.Fatalf("lock after release failed: %v", err)
+	}
+	unlock()
+}
+
+func TestLocker_TryLock(t *testing.T) {
+	l := &locker{dir: t.TempDir()}
+
+	unlock, ok, err := l.tryLock("app-a1b2")
+	if err != nil || !ok {
+		t.Fatalf("expected a free lock, got ok=%v err=%v", ok, err)
+	}
+	if _, ok, err := l.tryLock("app-a1b2"); err != nil || ok {
+		t.Fatalf("expected a held lock to be reported busy, got ok=%v err=%v", ok, err)
+	}
+	unlock()
+}
+
+func TestLocker_Wait(t *testing.T) {
+	dir := t.TempDir()
+	unlock, err := (&locker{dir: dir}).lock(context.Background(), "app-a1b2")
+	if err != nil {
+		t.Fatalf("lock failed: %v", err)
+	}
+	defer unlock()
+
+	tests := []struct {
+		name string
+		wait time.Duration
+	}{
+		{name: "bounded", wait: 2 * lockPollInterval},
+		{name: "no wait", wait: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &locker{dir: dir, wait: tt.wait}
+			if _, err := l.lock(context.Background(), "app-a1b2"); !errors.Is(err, ErrBusy) {
+				t.Fatalf("expected ErrBusy, got %v", err)
+			}
+
+			// tryLock still reports a held lock without an error
+			if _, ok, err := l.tryLock("app-a1b2"); err != nil || ok {
+				t.Errorf("expected tryLock to report the lock busy, got ok=%v err=%v", ok, err)
+			}
+		})
+	}
+}
+
+func TestVMLockScript(t *testing.T) {
+	got := vmLockScript("app-a1b2", "id app-a1b2 || echo 'new'")
+	want := `sudo mkdir -p /run/llima-box/locks && sudo flock -o /run/llima-box/locks/app-a1b2.lock sh -c 'id app-a1b2 || echo '\''new'\'''`
+	if got != want {
+		t.Errorf("vmLockScript() = %s, want %s", got, want)
+	}
+}
+
+func TestLocker_Disabled(t *testing.T) {
+	var l *locker
+	unlock, err := l.lock(context.Background(), "app-a1b2")
+	if err != nil {
+		t.Fatalf("lock failed: %v", err)
+	}
+	unlock()
+}
+
+func TestInstanceStateDir(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/tmp/xdg-state")
+
+	tests := []struct {
+		instance string
+		want     string
+	}{
+		{"", "/tmp/xdg-state/llima-box"},
+		{"llima-box", "/tmp/xdg-state/llima-box"},
+		{"client-a", "/tmp/xdg-state/llima-box/instances/client-a"},
+	}
+
+	for _, tt := range tests {
+		if got := instanceStateDir(tt.instance); got != filepath.FromSlash(tt.want) {
+			t.Errorf("instanceStateDir(%q) = %q, want %q", tt.instance, got, tt.want)
+		}
+	}
+}
@@ -2,13 +2,19 @@ package env
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io"
+	"path"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/dotenv"
+	"github.com/middlendian/llima-box/pkg/env/templates"
+	"github.com/middlendian/llima-box/pkg/helper"
+	"github.com/middlendian/llima-box/pkg/pathmap"
 	"github.com/middlendian/llima-box/pkg/ssh"
 	"github.com/middlendian/llima-box/pkg/vm"
 )
@@ -20,20 +26,215 @@ type Environment struct {
 
 	// ProjectPath is the absolute path to the project directory
 	ProjectPath string
+
+	// VMPath is where the project directory appears inside the VM, if it
+	// differs from ProjectPath (see Resolve)
+	VMPath string
+
+	// Status is the namespace status, as reported by List
+	Status Status
+
+	// Driver names the mount driver realizing the workspace (see Mount),
+	// as recorded when the environment was created: config.WorkspaceBind,
+	// config.WorkspaceOverlay, whose changes are kept in the VM apart from
+	// the host project (see Options.Overlay), or the driver of VM
+	// workspaces, which hide host files (see CreateInVM). It's set by
+	// Create and List.
+	Driver string
+
+	// Reserved is what the project declared it needs, as reported by List
+	Reserved Reservation
+
+	// Template is the template the environment was created from, if any.
+	// It's set by Create and List; set it before calling Create to create a
+	// new environment from a template.
+	Template *templates.Template
+
+	// Quarantine says why and when the environment was quarantined, as
+	// reported by List
+	Quarantine *QuarantineRecord
+
+	// LastActive is when a session last ran in the environment, as
+	// reported by List: a running session updates it every
+	// HeartbeatInterval. It's zero if no session has run since.
+	LastActive time.Time
+}
+
+// remoteExecutor defines the interface for executing commands in the VM
+type remoteExecutor interface {
+	ExecContext(ctx context.Context, cmd string) (string, error)
+	ExecContextInput(ctx context.Context, cmd string, stdin io.Reader) (string, error)
+	ExecBatch(ctx context.Context, cmds []string) ([]ssh.BatchResult, error)
+	ExecContextStreaming(ctx context.Context, cmd string, output io.Writer) error
+	ExecInteractiveContext(ctx context.Context, cmd string, opts ssh.SessionOptions) error
+	Upload(ctx context.Context, localPath, remotePath string, opts ssh.TransferOptions) error
+	Download(ctx context.Context, remotePath, localPath string, opts ssh.TransferOptions) error
+	ForwardRemotePort(ctx context.Context, remoteAddr, localAddr string) (*ssh.Forward, error)
+	IsConnected() bool
+	Close() error
 }
 
 // Manager handles environment lifecycle operations
 type Manager struct {
 	vmManager    *vm.Manager
-	sshClient    *ssh.Client
+	sshClient    remoteExecutor
 	instanceName string
+	probes       *probeCache
+	locks        *locker
+	setups       *setupQueue
+	journal      *journal
+	history      *execHistory
+	paths        *pathmap.Mapper
+	options      Options
+
+	// helper tells whether the VM has the helper (see ensureHelper)
+	helper bool
+}
+
+// DefaultShell is the login shell of environment users
+const DefaultShell = "/bin/bash"
+
+// Options configure a Manager. Zero values use the defaults.
+type Options struct {
+	// Shell is the login shell given to new environment users (default:
+	// DefaultShell). It must be installed in the VM. Command guards and the
+	// environment profile rely on a shell that reads /etc/profile.
+	Shell string
+
+	// Retry configures connecting to the VM over SSH (default:
+	// DefaultConnectRetry)
+	Retry ssh.RetryConfig
+
+	// DeniedPaths lists directories Create refuses as, inside, or around a
+	// project directory ("~/" is expanded). Nil uses
+	// config.DefaultDeniedPaths.
+	DeniedPaths []string
+
+	// References are host directories mounted read-only into every
+	// environment under ReferenceMountRoot
+	References []Reference
+
+	// StrictResources makes Create refuse projects whose declared
+	// resources the VM can't fit with ErrInsufficientCapacity, instead of
+	// warning
+	StrictResources bool
+
+	// Overlay makes Create give new environments a copy-on-write overlay
+	// of their project directory. Files they change are kept in the VM
+	// instead of being written to the host, and can be listed with Changes
+	// or thrown away with Discard. Existing environments and VM workspaces
+	// are left as they are. A project can ask for an overlay itself with
+	// "workspace: overlay" in its configuration.
+	Overlay bool
+
+	// AllowSynced lets Create set up environments for project directories
+	// in cloud-synced folders, such as Dropbox or iCloud Drive, which are
+	// refused with ErrSyncedProjectPath otherwise. Existing ones only get a
+	// warning (Code WarningSyncedFolder) without it.
+	AllowSynced bool
+
+	// BeforeCreate, if set, is called before a new environment is set up;
+	// an error stops Create. Resuming an interrupted setup or returning an
+	// existing environment doesn't call it.
+	BeforeCreate func(ctx context.Context, env *Environment) error
+
+	// AfterCreate, if set, is called once Create finishes setting up an
+	// environment
+	AfterCreate func(ctx context.Context, env *Environment)
+
+	// ConfirmProvisioningChange, if set, is called when Create finds that
+	// the project's packages, toolchains, or profile variables changed since
+	// the existing environment was set up. If it returns true, only the
+	// change is applied; otherwise the change is reported as a warning and
+	// offered again next time.
+	ConfirmProvisioningChange func(ctx context.Context, env *Environment, change *ProvisioningChange) bool
+
+	// LockWait bounds how long operations on an environment wait while
+	// another llima-box process creates, changes, or deletes it before
+	// failing with ErrBusy. Zero waits until the context ends; a negative
+	// value fails at once.
+	LockWait time.Duration
+
+	// MaxSetups bounds how many environments are set up at once by the
+	// llima-box processes on this host; others wait in line, oldest first
+	// (default: DefaultMaxSetups). A negative value doesn't limit them.
+	MaxSetups int
+
+	// Progress, if set, receives the manager's debug messages and
+	// warnings, so programs embedding llima-box can show them in their own
+	// way. NewManagerWithOptions defaults it to StderrProgress.
+	Progress ProgressFunc
+
+	// HelperDir holds the helper binaries for the VM (see HelperBinary).
+	// The helper is copied into a VM that doesn't have it, and environments
+	// are then set up, entered, and deleted through it rather than with
+	// shell scripts. Empty only uses a helper that's already installed.
+	HelperDir string
+}
+
+// DefaultConnectRetry returns the retry settings for connecting to the VM,
+// which can take a while to accept connections after it boots
+func DefaultConnectRetry() ssh.RetryConfig {
+	return ssh.RetryConfig{
+		MaxAttempts:  5,
+		InitialDelay: 2 * time.Second,
+		MaxDelay:     10 * time.Second,
+		Multiplier:   2.0,
+	}
 }
 
 // NewManager creates a new environment manager
 func NewManager(vmManager *vm.Manager) *Manager {
+	return NewManagerWithOptions(vmManager, Options{})
+}
+
+// NewManagerWithOptions creates a new environment manager with options
+func NewManagerWithOptions(vmManager *vm.Manager, opts Options) *Manager {
+	if opts.Shell == "" {
+		opts.Shell = DefaultShell
+	}
+	if opts.Retry.MaxAttempts == 0 {
+		opts.Retry = DefaultConnectRetry()
+	}
+	if opts.DeniedPaths == nil {
+		opts.DeniedPaths = config.DefaultDeniedPaths()
+	}
+	if opts.Progress == nil {
+		opts.Progress = StderrProgress
+	}
+	locks := newLocker(vmManager.GetInstanceName(), opts.LockWait, opts.Progress)
 	return &Manager{
 		vmManager:    vmManager,
 		instanceName: vmManager.GetInstanceName(),
+		probes:       newProbeCache(probeCacheTTL),
+		locks:        locks,
+		setups:       newSetupQueue(locks, opts.MaxSetups, opts.Progress),
+		journal:      newJournal(vmManager.GetInstanceName(), opts.Progress),
+		history:      newExecHistory(vmManager.GetInstanceName()),
+		paths:        newHostPaths(vmManager, opts.Progress),
+		options:      opts,
+	}
+}
+
+// newHostPaths returns the mapper for the VM's host mounts. Without one,
+// host paths are used in the VM unchanged, which matches Lima's defaults on
+// macOS and Linux.
+func newHostPaths(vmManager *vm.Manager, progress ProgressFunc) *pathmap.Mapper {
+	mounts, err := vmManager.HostMounts()
+	if err != nil {
+		progress.emit(Event{Level: EventWarning, Message: err.Error()})
+		return nil
+	}
+	return pathmap.ForHost(mounts)
+}
+
+// newManagerWithExecutor creates a manager with a connected executor (for testing)
+func newManagerWithExecutor(executor remoteExecutor) *Manager {
+	return &Manager{
+		sshClient:    executor,
+		instanceName: vm.DefaultInstanceName,
+		probes:       newProbeCache(probeCacheTTL),
+		options:      Options{Shell: DefaultShell, Retry: DefaultConnectRetry(), DeniedPaths: config.DefaultDeniedPaths()},
 	}
 }
 
@@ -44,37 +245,118 @@ func (m *Manager) ensureSSH(ctx context.Context) error {
 	}
 
 	// Ensure VM is running
-	if err := m.vmManager.EnsureRunning(ctx); err != nil {
-		return fmt.Errorf("failed to ensure VM is running: %w", err)
+	existed, err := m.vmManager.Exists(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check VM existence: %w", err)
+	}
+	running := false
+	if existed {
+		if running, err = m.vmManager.IsRunning(ctx); err != nil {
+			return fmt.Errorf("failed to check VM status: %w", err)
+		}
+	}
+	if !running {
+		// Other llima-box processes may be starting it too; the first
+		// starts it and the others find it running
+		unlock, err := m.locks.lock(ctx, vmStartLockName)
+		if err != nil {
+			return err
+		}
+		err = m.vmManager.EnsureRunning(ctx)
+		unlock()
+		if err != nil {
+			return fmt.Errorf("failed to ensure VM is running: %w", err)
+		}
+	}
+	if !existed {
+		// A new VM has new host keys
+		if err := ssh.ForgetHostKey(m.instanceName); err != nil {
+			m.warnf("", "%v", err)
+		}
 	}
 
 	// Create SSH client
-	client, err := ssh.NewClient(m.instanceName)
+	client, err := ssh.NewClientForVM(ctx, m.vmManager)
 	if err != nil {
 		return fmt.Errorf("failed to create SSH client: %w", err)
 	}
+	client.SetProgress(m.clientProgress)
 
 	// Connect with retries
-	retryConfig := ssh.RetryConfig{
-		MaxAttempts:  5,
-		InitialDelay: 2 * time.Second,
-		MaxDelay:     10 * time.Second,
-		Multiplier:   2.0,
-	}
-	if err := client.ConnectWithRetry(retryConfig); err != nil {
+	if err := client.ConnectWithRetry(m.options.Retry); err != nil {
 		return fmt.Errorf("failed to connect SSH: %w", err)
 	}
 
 	m.sshClient = client
+
+	// Bring a VM set up by an older llima-box up to date before touching
+	// its environments
+	if err := m.migrate(ctx); err != nil {
+		_ = client.Close()
+		m.sshClient = nil
+		return err
+	}
+
+	// Environments are handled by the helper when the VM has it
+	m.ensureHelper(ctx)
+
+	// Finish or undo operations of CLIs that died midway
+	m.replayJournal(ctx)
+
+	// Namespace keepers don't survive a VM restart
+	m.recoverAfterBoot(ctx)
+
 	return nil
 }
 
-// Create creates a new environment or returns existing one
+// Create creates a new environment or returns existing one. Directories
+// whose files an agent shouldn't see, such as the home directory or one
+// holding credentials, are refused with ErrUnsafeProjectPath.
 func (m *Manager) Create(ctx context.Context, projectPath string) (*Environment, error) {
-	// Get absolute path
-	absPath, err := filepath.Abs(projectPath)
+	return m.CreateFromTemplate(ctx, projectPath, nil)
+}
+
+// CreateFromTemplate is like Create, but a new environment is set up with
+// tmpl's packages, variables, mounts, and setup script as well. An existing
+// environment is returned as it is, keeping the template it was created
+// from.
+func (m *Manager) CreateFromTemplate(ctx context.Context, projectPath string, tmpl *templates.Template) (*Environment, error) {
+	env, err := m.Resolve(projectPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		return nil, err
+	}
+	if err := m.checkProjectPath(env.ProjectPath); err != nil {
+		return nil, err
+	}
+	if err := m.ensureSSH(ctx); err != nil {
+		return nil, err
+	}
+	if err := m.adoptRecordedName(ctx, env); err != nil {
+		return nil, err
+	}
+	env.Template = tmpl
+	return m.create(ctx, env)
+}
+
+// Resolve returns the environment for a host project path without creating
+// it. The path is canonicalized first, so every spelling of a directory
+// (relative, through a symlink, or in a different case on case-insensitive
+// hosts) resolves to the same environment; Find also finds environments
+// named after another spelling. Directories that aren't mounted into the VM
+// can't have an environment.
+func (m *Manager) Resolve(projectPath string) (*Environment, error) {
+	absPath, err := m.paths.Canonical(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	vmPath, err := m.paths.ToVM(absPath)
+	if err != nil {
+		var shared []string
+		for _, mount := range m.paths.Mounts() {
+			shared = append(shared, mount.Host)
+		}
+		return nil, fmt.Errorf("%w (shared directories: %s)", err, strings.Join(shared, ", "))
 	}
 
 	// Generate environment name
@@ -83,42 +365,165 @@ func (m *Manager) Create(ctx context.Context, projectPath string) (*Environment,
 		return nil, fmt.Errorf("failed to generate environment name: %w", err)
 	}
 
+	env := &Environment{Name: envName, ProjectPath: absPath}
+	if vmPath != absPath {
+		env.VMPath = vmPath
+	}
+	return env, nil
+}
+
+// dir returns the project directory's path inside the VM
+func (e *Environment) dir() string {
+	if e.VMPath != "" {
+		return e.VMPath
+	}
+	return e.ProjectPath
+}
+
+// create provisions env, resuming an earlier attempt, or returns it if it
+// already exists
+func (m *Manager) create(ctx context.Context, env *Environment) (*Environment, error) {
 	// Ensure SSH connection
 	if err := m.ensureSSH(ctx); err != nil {
 		return nil, err
 	}
 
-	// Check if environment already exists
-	exists, err := m.Exists(ctx, envName)
+	// Another llima-box process may be creating or deleting the same
+	// environment
+	unlock, err := m.locks.lock(ctx, env.Name)
 	if err != nil {
 		return nil, err
 	}
+	defer unlock()
 
-	env := &Environment{
-		Name:        envName,
-		ProjectPath: absPath,
+	entry := journalEntry{Op: opCreate, Env: env.Name, Workspace: env.workspaceDir()}
+	done, err := m.journal.begin(entry)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	running, err := m.Exists(ctx, env.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load project configuration; it chooses a new environment's workspace
+	// mode, unless the environment comes with its own
+	project, err := loadProject(env)
+	if err != nil {
+		return nil, err
+	}
+	mount := env.Driver
+	if mount == "" {
+		mount = project.Workspace
+		if m.options.Overlay {
+			mount = config.WorkspaceOverlay
+		}
+	}
+
+	// Resume from the last recorded step. Without a record (a new
+	// environment, or one created before metadata was kept) every step runs;
+	// steps skip work that's already done.
+	md, err := m.readMetadata(ctx, env.Name)
+	switch {
+	case errors.Is(err, errNoMetadata):
+		md = &metadata{CreatedAt: time.Now().UTC(), Step: stepStarted, Template: env.Template, Mount: mount}
+		if md.Mount == "" {
+			md.Mount = config.WorkspaceBind
+		}
+	case err != nil:
+		return nil, err
+	}
+	if md.Quarantine != nil {
+		return nil, fmt.Errorf("%w: %s (release it with 'llima-box quarantine --release' or delete it)", ErrQuarantined, env.Name)
+	}
+	md.ProjectPath = env.ProjectPath
+	if env.Template != nil && (md.Template == nil || md.Template.Name != env.Template.Name) {
+		m.warnf(env.Name, "%s already exists; template %s only applies to new environments", env.Name, env.Template.Name)
+	}
+	env.Template = md.Template
+	if mount != "" && mount != md.Mount && md.Step != stepStarted {
+		m.warnf(env.Name, "%s already exists with a %s workspace; workspace modes only apply to new environments", env.Name, md.Mount)
+	}
+	env.Driver = md.Mount
+	if err := m.checkSyncedPath(env, md.Step == stepStarted && !running); err != nil {
+		return nil, err
 	}
 
-	if exists {
-		// Environment already exists, return it
+	if running && md.complete() {
+		// Environment already exists; pick up references added and
+		// configuration changed since it was set up
+		if err := m.syncReferences(ctx, env); err != nil {
+			return nil, err
+		}
+		if err := m.syncProvisioning(ctx, env, md, project); err != nil {
+			return nil, err
+		}
 		return env, nil
 	}
 
-	// Create user account
-	if err := m.createUser(ctx, envName); err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+	// Setting up is expensive; a burst of new environments waits in line
+	release, err := m.setups.acquire(ctx, env.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if md.Step == stepStarted && m.options.BeforeCreate != nil {
+		if err := m.options.BeforeCreate(ctx, env); err != nil {
+			return nil, err
+		}
 	}
 
-	// Create namespace
-	if err := m.createNamespace(ctx, env); err != nil {
-		// Try to clean up user on failure
-		_ = m.deleteUser(ctx, envName)
-		return nil, fmt.Errorf("failed to create namespace: %w", err)
+	// New environments are checked against what the VM has left
+	if md.Step == stepStarted {
+		reservation, err := reservationFor(project)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.checkCapacity(ctx, env, reservation); err != nil {
+			return nil, err
+		}
+		if !reservation.IsZero() {
+			md.Resources = &reservation
+		}
 	}
 
+	// Everything probed so far is about to change
+	m.probes.invalidate()
+
+	settingUp := !md.complete()
+	if err := m.provision(ctx, env, project, md, running); err != nil {
+		return nil, err
+	}
+	if err := m.syncProvisioning(ctx, env, md, project); err != nil {
+		return nil, err
+	}
+	m.syncHostnames(ctx)
+
+	if settingUp && m.options.AfterCreate != nil {
+		m.options.AfterCreate(ctx, env)
+	}
 	return env, nil
 }
 
+// loadProject loads the configuration of env's project. Workspaces that
+// live in the VM are out of reach of the host-side config loader and use the
+// defaults.
+func loadProject(env *Environment) (*config.Project, error) {
+	if !env.Mount().HostProject() {
+		return &config.Project{}, nil
+	}
+	return config.LoadProject(env.ProjectPath)
+}
+
+// workspaceDir returns the VM directory holding the environment's
+// workspace, or "" if it's the host project; see MountDriver.WorkspaceDir
+func (e *Environment) workspaceDir() string {
+	return e.Mount().WorkspaceDir(e)
+}
+
 // Exists checks if an environment exists
 func (m *Manager) Exists(ctx context.Context, envName string) (bool, error) {
 	if err := m.ensureSSH(ctx); err != nil {
@@ -127,38 +532,22 @@ func (m *Manager) Exists(ctx context.Context, envName string) (bool, error) {
 
 	// Check if user account exists
 	cmd := fmt.Sprintf("id %[1]s && [ -e /envs/%[1]s/namespace.pid ] && kill -0 $(cat /envs/%[1]s/namespace.pid)", envName)
-	_, err := m.sshClient.ExecContext(ctx, cmd)
+	_, err := m.probe(ctx, cmd)
 	return err == nil, nil
 }
 
-// List returns all environments
+// List returns all environments with their status. The project path is
+// empty for environments created before metadata was recorded.
 func (m *Manager) List(ctx context.Context) ([]*Environment, error) {
 	if err := m.ensureSSH(ctx); err != nil {
 		return nil, err
 	}
 
-	cmd := "find /envs/. -type d -maxdepth 1 -mindepth 1 | xargs basename"
-	output, err := m.sshClient.ExecContext(ctx, cmd)
+	envs, err := m.scanEnvironments(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list environments: %w", err)
 	}
 
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	var envs []*Environment
-
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-
-		env := &Environment{
-			Name:        line,
-			ProjectPath: "", // Unknown without metadata
-		}
-
-		envs = append(envs, env)
-	}
-
 	return envs, nil
 }
 
@@ -168,74 +557,212 @@ func (m *Manager) Delete(ctx context.Context, envName string) error {
 		return err
 	}
 
-	// Check if environment exists
-	exists, err := m.Exists(ctx, envName)
+	unlock, err := m.locks.lock(ctx, envName)
 	if err != nil {
 		return err
 	}
-	if !exists {
+	defer unlock()
+
+	// Check if environment exists. Environments whose namespace has died
+	// can still be deleted.
+	checkCmd := fmt.Sprintf("id %[1]s || [ -d %[2]s ]", envName, envDir(envName))
+	if _, err := m.sshClient.ExecContext(ctx, checkCmd); err != nil {
 		return fmt.Errorf("environment %s does not exist", envName)
 	}
 
-	// Kill processes in the namespace
-	if err := m.killNamespaceProcesses(ctx, envName); err != nil {
-		// Log but continue - processes might already be dead
-		fmt.Printf("Warning: failed to kill namespace processes: %v\n", err)
+	m.probes.invalidate()
+
+	// VM workspaces go with the environment
+	var workspace string
+	if md, err := m.readMetadata(ctx, envName); err == nil {
+		workspace = md.environment(envName).workspaceDir()
+	}
+
+	done, err := m.journal.begin(journalEntry{Op: opDelete, Env: envName, Workspace: workspace})
+	if err != nil {
+		return err
 	}
+	defer done()
 
-	// Delete user account (includes home directory)
-	if err := m.deleteUser(ctx, envName); err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+	if err := m.deleteEnv(ctx, envName, workspace); err != nil {
+		return err
 	}
+	m.syncHostnames(ctx)
+	return nil
+}
 
+// deleteEnv deletes an environment with the helper, or runs DeleteCommands
+// without it
+func (m *Manager) deleteEnv(ctx context.Context, envName, workspace string) error {
+	if !m.helper {
+		return m.runCommands(ctx, DeleteCommands(envName, workspace))
+	}
+	var resp helper.DeleteEnvResponse
+	if err := m.callHelper(ctx, helper.OpDeleteEnv, helper.DeleteEnvRequest{Name: envName, Workspace: workspace}, &resp); err != nil {
+		return err
+	}
+	for _, w := range resp.Warnings {
+		m.warnf(envName, "%s", w)
+	}
 	return nil
 }
 
-// EnterNamespace enters an environment's namespace and executes a command
-func (m *Manager) EnterNamespace(ctx context.Context, env *Environment, cmd []string) error {
+// EnterOptions configures a session entered with EnterNamespace
+type EnterOptions struct {
+	// Session configures the underlying SSH session
+	Session ssh.SessionOptions
+
+	// GuardPatterns, when non-empty, holds commands matching these POSIX
+	// extended regular expressions until they're confirmed at the host
+	// terminal. Only bash login shells in the environment are guarded.
+	GuardPatterns []string
+
+	// Budget limits the session's length and the environment's daily
+	// session time. The limits are enforced inside the VM; a session that
+	// reaches them is ended and returns ErrSessionTimeLimit, and no session
+	// starts once the day's budget is used up (ErrDailyBudgetUsed).
+	Budget config.SessionBudget
+
+	// Env sets variables for the session only, such as those allowed from
+	// the project's .env file. Names must be valid variable names.
+	Env []dotenv.Var
+
+	// Exec runs cmd as an argument vector without a shell: each element is
+	// passed to the program as one argument, with no word splitting,
+	// globbing, or expansion, so callers can pass untrusted arguments as
+	// they are. The login profile doesn't run; the program gets the
+	// toolchain PATH, the LLIMA_BOX_* variables, and Env. Exec needs a
+	// command and can't be combined with GuardPatterns.
+	Exec bool
+
+	// varsFile is the session variable file passing Env, set by
+	// writeSessionVars
+	varsFile string
+
+	// helper enters the namespace through the helper, set by
+	// EnterNamespace when the VM has it
+	helper bool
+}
+
+// EnterNamespace enters an environment's namespace and executes a command.
+// A command that exits unsuccessfully returns an error carrying its status
+// (see ssh.ExitStatus). Commands run without a terminal (opts.Session.Stdout
+// set) are added to the environment's exec history (see ExecHistory).
+func (m *Manager) EnterNamespace(ctx context.Context, env *Environment, cmd []string, opts EnterOptions) (err error) {
+	if err := checkEnterOptions(cmd, opts); err != nil {
+		return err
+	}
+
 	if err := m.ensureSSH(ctx); err != nil {
 		return err
 	}
 
-	pidFile := fmt.Sprintf("/envs/%s/namespace.pid", env.Name)
+	project, err := loadProject(env)
+	if err != nil {
+		return err
+	}
 
-	// Build the nsenter command to enter the namespace and run as the environment user
-	var sshCmd string
-	if len(cmd) == 0 {
-		// Interactive shell - don't use -c, let su start a proper login shell
-		sshCmd = fmt.Sprintf(
-			"sudo nsenter --target=$(sudo cat %s) --mount --wdns=%s su --login %s",
-			pidFile,
-			env.ProjectPath,
-			env.Name,
-		)
-	} else {
-		// Specific command - use -c to execute it
-		command := strings.Join(cmd, " ")
-		sshCmd = fmt.Sprintf(
-			"sudo nsenter --target=$(sudo cat %s) --mount --wdns=%s su --login %s --command %q",
-			pidFile,
-			env.ProjectPath,
-			env.Name,
-			command,
-		)
+	// Exec skips the login profile, so the template's variables are passed
+	// directly; environments from Resolve don't know their template yet
+	if opts.Exec && env.Template == nil {
+		if md, err := m.readMetadata(ctx, env.Name); err == nil {
+			env.Template = md.Template
+		}
+	}
+
+	opts.helper = m.helper
+	opts, err = m.writeSessionVars(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			m.removeSessionVars(opts)
+		}
+	}()
+
+	sshCmd, err := EnterCommand(env, project, cmd, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(opts.GuardPatterns) > 0 {
+		if err := m.startGuard(ctx, env.Name, opts.GuardPatterns); err != nil {
+			return err
+		}
+		defer func() {
+			if err := m.stopGuard(context.Background(), env.Name); err != nil {
+				m.warnf(env.Name, "%v", err)
+			}
+		}()
+
+		confirm := make(chan ssh.ConfirmRequest)
+		guardCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go m.watchGuard(guardCtx, env.Name, confirm)
+		opts.Session.Confirm = confirm
+	}
+
+	if len(cmd) > 0 && opts.Session.Stdout != nil {
+		output := &outputTail{}
+		opts.Session.Stdout = teeOutput(opts.Session.Stdout, output)
+		opts.Session.Stderr = teeOutput(opts.Session.Stderr, output)
+		started := time.Now()
+		defer func() { m.recordExec(env, cmd, started, output, err) }()
 	}
 
 	// Execute interactively
-	return m.sshClient.ExecInteractive(sshCmd)
+	err = m.sshClient.ExecInteractiveContext(ctx, sshCmd, opts.Session)
+	if ssh.ExitStatus(err) == exitQuarantined {
+		return fmt.Errorf("%w: %s", ErrQuarantined, env.Name)
+	}
+	if err != nil && !opts.Budget.IsZero() {
+		return budgetError(err)
+	}
+	return err
+}
+
+// homeBase is the parent directory for environment homes on the VM data disk.
+// VMs created without the data disk fall back to /home.
+const homeBase = vm.DataDiskMountPoint + "/home"
+
+// createUserCommand returns the command creating an environment's user
+// account with the given login shell. The home directory goes on the data
+// disk when it is mounted.
+// After VM recreation the home may already exist on the disk; useradd keeps
+// it and chown hands it to the (possibly renumbered) new user. An account
+// created by a concurrent setup in the meantime is kept. The VM's helper
+// creates the account, in the group sudo refuses; VMs provisioned before
+// it existed get a plain useradd.
+func createUserCommand(username, shell string) string {
+	return vmLockScript(username, fmt.Sprintf(
+		"id %[2]s >/dev/null 2>&1 && exit 0; if [ -x %[4]s ]; then exec sudo %[4]s create-user %[2]s %[3]s; fi; "+
+			"base=/home; [ -d %[1]s ] && base=%[1]s; sudo useradd -m -b $base -s %[3]s %[2]s && sudo chown -R %[2]s:%[2]s $base/%[2]s",
+		homeBase,
+		username,
+		shellWord(shell),
+		vm.HelperPath,
+	))
 }
 
 // createUser creates a Linux user account for the environment
 func (m *Manager) createUser(ctx context.Context, username string) error {
-	// Create user with home directory
-	cmd := fmt.Sprintf("sudo useradd -m -s /bin/bash %s", username)
+	if m.helper {
+		m.debugf(username, "Creating user %s with llima-box-helper", username)
+		if err := m.callHelper(ctx, helper.OpCreateEnv, helper.CreateEnvRequest{Name: username, Shell: m.options.Shell}, &helper.CreateEnvResponse{}); err != nil {
+			return fmt.Errorf("failed to create user account: %w", err)
+		}
+		return nil
+	}
+
+	cmd := createUserCommand(username, m.options.Shell)
 
-	fmt.Fprintf(os.Stderr, "\033[90mDEBUG\033[0m: Creating user: %s\n", cmd)
+	m.debugf(username, "Creating user: %s", cmd)
 
 	output, err := m.sshClient.ExecContext(ctx, cmd)
 	if err != nil {
 		if output != "" {
-			fmt.Fprintf(os.Stderr, "\033[90mDEBUG\033[0m: User creation output: %s\n", output)
+			m.debugf(username, "User creation output: %s", output)
 		}
 		return fmt.Errorf("failed to create user account: %w", err)
 	}
@@ -243,79 +770,85 @@ func (m *Manager) createUser(ctx context.Context, username string) error {
 	return nil
 }
 
-// deleteUser deletes a Linux user account
-func (m *Manager) deleteUser(ctx context.Context, username string) error {
-	// Delete user and home directory
-	cmd := fmt.Sprintf("sudo userdel -r %s", username)
-	_, err := m.sshClient.ExecContext(ctx, cmd)
-	return err
+// createNamespace creates a persistent namespace for the environment and
+// sets up its filesystem
+func (m *Manager) createNamespace(ctx context.Context, env *Environment, project *config.Project) error {
+	pid, err := m.startNamespace(ctx, env)
+	if err != nil {
+		return err
+	}
+	return m.setupNamespaceFilesystem(ctx, env, pid, project)
 }
 
-// createNamespace creates a persistent namespace for the environment
-func (m *Manager) createNamespace(ctx context.Context, env *Environment) error {
+// startNamespace starts the keeper process holding the environment's
+// namespace and returns its PID
+func (m *Manager) startNamespace(ctx context.Context, env *Environment) (string, error) {
 	pidFile := fmt.Sprintf("/envs/%s/namespace.pid", env.Name)
 
-	// Create the /envs directory
-	mkdirCmd := fmt.Sprintf("sudo mkdir -p /envs/%s", env.Name)
-	if _, err := m.sshClient.ExecContext(ctx, mkdirCmd); err != nil {
-		return fmt.Errorf("failed to create namespace directory: %w", err)
-	}
-
-	// Build the unshare command with proper namespace setup
-	// This creates mount and PID namespaces, runs a sleep process to keep them alive
-	unshareCmd := fmt.Sprintf(`sudo unshare --mount --pid --fork --propagation private bash -c 'sleep infinity' >/dev/null 2>&1 & echo $! | sudo tee %s >/dev/null`, pidFile)
-
-	fmt.Fprintf(os.Stderr, "\033[90mDEBUG\033[0m: Creating namespace: %s\n", unshareCmd)
-
-	// Execute the unshare command
-	if _, err := m.sshClient.ExecContext(ctx, unshareCmd); err != nil {
-		return fmt.Errorf("failed to create namespace: %w", err)
+	// Create the /envs directory and a keeper process holding new mount and
+	// PID namespaces
+	m.debugf(env.Name, "Creating namespace for %s", env.Name)
+	if m.helper {
+		req := helper.CreateEnvRequest{Name: env.Name, Shell: m.options.Shell, Namespace: true}
+		if err := m.callHelper(ctx, helper.OpCreateEnv, req, &helper.CreateEnvResponse{}); err != nil {
+			return "", fmt.Errorf("failed to create namespace: %w", err)
+		}
+	} else if err := m.runCommands(ctx, StartNamespaceCommands(env.Name)); err != nil {
+		return "", err
 	}
 
 	// Wait a moment for the namespace to stabilize
 	time.Sleep(500 * time.Millisecond)
 
 	// Verify namespace PID file exists
-	fmt.Fprintf(os.Stderr, "\033[90mDEBUG\033[0m: Verifying namespace PID file at: %s\n", pidFile)
+	m.debugf(env.Name, "Verifying namespace PID file at: %s", pidFile)
 
 	// Read the PID file
 	catCmd := fmt.Sprintf("sudo cat %s 2>&1", pidFile)
 	catOutput, catErr := m.sshClient.ExecContext(ctx, catCmd)
 	if catErr != nil {
-		fmt.Fprintf(os.Stderr, "\033[90mDEBUG\033[0m: Failed to read PID file: %v\nOutput: %s\n", catErr, catOutput)
-		return fmt.Errorf("namespace PID file not created: %s (error: %w, output: %s)", pidFile, catErr, catOutput)
+		m.debugf(env.Name, "Failed to read PID file: %v\nOutput: %s", catErr, catOutput)
+		return "", fmt.Errorf("namespace PID file not created: %s (error: %w, output: %s)", pidFile, catErr, catOutput)
 	}
 
 	pid := strings.TrimSpace(catOutput)
-	fmt.Fprintf(os.Stderr, "\033[90mDEBUG\033[0m: Namespace PID: %s\n", pid)
+	m.debugf(env.Name, "Namespace PID: %s", pid)
 
 	// Verify the namespace process is still running
 	checkProcCmd := fmt.Sprintf("sudo kill -0 %s 2>&1", pid)
 	checkOutput, checkErr := m.sshClient.ExecContext(ctx, checkProcCmd)
 	if checkErr != nil {
-		fmt.Fprintf(os.Stderr, "\033[90mDEBUG\033[0m: Namespace process check failed: %v\nOutput: %s\n", checkErr, checkOutput)
-		return fmt.Errorf("namespace process (PID %s) is not running: %w", pid, checkErr)
+		m.debugf(env.Name, "Namespace process check failed: %v\nOutput: %s", checkErr, checkOutput)
+		return "", fmt.Errorf("namespace process (PID %s) is not running: %w", pid, checkErr)
 	}
 
-	fmt.Fprintf(os.Stderr, "\033[90mDEBUG\033[0m: Namespace ready (PID %s is running)\n", pid)
-	return nil
+	m.debugf(env.Name, "Namespace ready (PID %s is running)", pid)
+
+	return pid, nil
 }
 
-// killNamespaceProcesses kills all processes running in the namespace
-func (m *Manager) killNamespaceProcesses(ctx context.Context, username string) error {
-	// Kill all processes owned by the user
-	cmd := fmt.Sprintf("sudo pkill -u %s || true", username)
-	_, err := m.sshClient.ExecContext(ctx, cmd)
-	return err
+// setupNamespaceFilesystem prepares the environment's view of the filesystem
+// inside its namespace and the login profile that goes with it
+func (m *Manager) setupNamespaceFilesystem(ctx context.Context, env *Environment, pid string, project *config.Project) error {
+	cmds, err := m.SetupNamespaceCommands(env, project, pid)
+	if err != nil {
+		return err
+	}
+	return m.runCommands(ctx, cmds)
 }
 
-// GetProjectPath attempts to recover the project path for an environment
-// This is a best-effort operation since we don't store metadata yet
+// GetProjectPath returns the project path for an environment from its
+// metadata, falling back to a best-effort guess for environments created
+// before metadata was recorded
 func (m *Manager) GetProjectPath(ctx context.Context, envName string) (string, error) {
 	if err := m.ensureSSH(ctx); err != nil {
 		return "", err
 	}
 
+	if md, err := m.readMetadata(ctx, envName); err == nil {
+		return md.ProjectPath, nil
+	}
+
 	// Read the namespace PID
 	pidFile := fmt.Sprintf("/envs/%s/namespace.pid", envName)
 	pidOutput, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("cat %s", pidFile))
@@ -324,17 +857,24 @@ func (m *Manager) GetProjectPath(ctx context.Context, envName string) (string, e
 	}
 	pid := strings.TrimSpace(pidOutput)
 
-	// Try to find the project path from the namespace mounts
-	// This is a heuristic - look for bind mounts in /proc/mounts
-	cmd := fmt.Sprintf("sudo nsenter --mount=/proc/%s/ns/mnt findmnt -n -o TARGET | grep -E '^/Users|^/home' | grep -v '^/home/%s$' | head -n1 || echo ''",
-		pid, envName)
-
-	output, err := m.sshClient.ExecContext(ctx, cmd)
+	// Try to find the project path from the namespace mounts: the first
+	// host directory mounted into the VM that isn't the environment's home
+	output, err := m.sshClient.ExecContext(ctx, pidRunner(pid).Command("findmnt", "-ln", "-o", "TARGET"))
 	if err != nil {
 		return "", fmt.Errorf("failed to get project path: %w", err)
 	}
 
-	projectPath := strings.TrimSpace(output)
+	projectPath := ""
+	for _, target := range strings.Split(output, "\n") {
+		target = strings.TrimSpace(target)
+		if m.paths == nil || target == "" || path.Base(target) == envName {
+			continue
+		}
+		if host, ok := m.paths.ToHost(target); ok {
+			projectPath = host
+			break
+		}
+	}
 	if projectPath == "" {
 		return "", fmt.Errorf("could not determine project path for %s", envName)
 	}
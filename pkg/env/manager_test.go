@@ -1,9 +1,169 @@
 package env
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/pathmap"
+	"github.com/middlendian/llima-box/pkg/ssh"
 )
 
+// mockExecutor implements remoteExecutor for testing
+type mockExecutor struct {
+	// mu guards calls for commands run concurrently
+	mu sync.Mutex
+	// responses maps commands to their output
+	responses map[string]string
+	// errors maps commands to errors
+	errors map[string]error
+	// calls tracks all executed commands
+	calls []string
+	// allowUnexpected makes unknown commands succeed with empty output
+	allowUnexpected bool
+	// transfers tracks Upload and Download calls
+	transfers []mockTransfer
+	// files holds the contents of VM files: Upload stores them, and
+	// Download writes those that are present to the host
+	files map[string][]byte
+	// inputs holds what ExecContextInput passed to each command
+	inputs map[string][]byte
+}
+
+// mockTransfer records one Upload or Download
+type mockTransfer struct {
+	upload   bool
+	src, dst string
+	opts     ssh.TransferOptions
+}
+
+func newMockExecutor() *mockExecutor {
+	return &mockExecutor{
+		responses: make(map[string]string),
+		errors:    make(map[string]error),
+		files:     make(map[string][]byte),
+		inputs:    make(map[string][]byte),
+	}
+}
+
+func (m *mockExecutor) ExecContext(_ context.Context, cmd string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, cmd)
+
+	if err, ok := m.errors[cmd]; ok {
+		return m.responses[cmd], err
+	}
+	if resp, ok := m.responses[cmd]; ok {
+		return resp, nil
+	}
+	if m.allowUnexpected {
+		return "", nil
+	}
+	return "", fmt.Errorf("unexpected command: %s", cmd)
+}
+
+// ExecBatch runs cmds one at a time through ExecContext, so batched
+// commands are recorded and answered like any other
+func (m *mockExecutor) ExecBatch(ctx context.Context, cmds []string) ([]ssh.BatchResult, error) {
+	var results []ssh.BatchResult
+	for _, cmd := range cmds {
+		output, err := m.ExecContext(ctx, cmd)
+		result := ssh.BatchResult{Output: output}
+		if err != nil {
+			result.Status = max(ssh.ExitStatus(err), 1)
+		}
+		results = append(results, result)
+		if err != nil {
+			break
+		}
+	}
+	return results, nil
+}
+
+// ExecContextInput records stdin and answers like ExecContext
+func (m *mockExecutor) ExecContextInput(ctx context.Context, cmd string, stdin io.Reader) (string, error) {
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	m.inputs[cmd] = data
+	m.mu.Unlock()
+	return m.ExecContext(ctx, cmd)
+}
+
+func (m *mockExecutor) ExecContextStreaming(ctx context.Context, cmd string, output io.Writer) error {
+	response, err := m.ExecContext(ctx, cmd)
+	_, _ = io.WriteString(output, response)
+	return err
+}
+
+// ExecInteractiveContext answers like ExecContext, writing the response to
+// opts.Stdout when it's set
+func (m *mockExecutor) ExecInteractiveContext(ctx context.Context, cmd string, opts ssh.SessionOptions) error {
+	output, err := m.ExecContext(ctx, cmd)
+	if opts.Stdout != nil {
+		_, _ = io.WriteString(opts.Stdout, output)
+	}
+	return err
+}
+
+func (m *mockExecutor) Upload(_ context.Context, localPath, remotePath string, opts ssh.TransferOptions) error {
+	m.transfers = append(m.transfers, mockTransfer{upload: true, src: localPath, dst: remotePath, opts: opts})
+	if data, err := os.ReadFile(localPath); err == nil { // #nosec G304 -- test file
+		m.files[remotePath] = data
+	}
+	return nil
+}
+
+func (m *mockExecutor) Download(_ context.Context, remotePath, localPath string, opts ssh.TransferOptions) error {
+	m.transfers = append(m.transfers, mockTransfer{src: remotePath, dst: localPath, opts: opts})
+	if data, ok := m.files[remotePath]; ok {
+		return os.WriteFile(localPath, data, 0600)
+	}
+	return nil
+}
+
+func (m *mockExecutor) ForwardRemotePort(_ context.Context, remoteAddr, localAddr string) (*ssh.Forward, error) {
+	return nil, fmt.Errorf("no port forwarding in tests")
+}
+
+func (m *mockExecutor) IsConnected() bool { return true }
+
+func (m *mockExecutor) Close() error { return nil }
+
+func (m *mockExecutor) setResponse(cmd, output string) {
+	m.responses[cmd] = output
+}
+
+func (m *mockExecutor) setError(cmd string, err error) {
+	m.errors[cmd] = err
+}
+
+// callCount returns how many times a command was executed
+func (m *mockExecutor) callCount(cmd string) int {
+	n := 0
+	for _, call := range m.calls {
+		if call == cmd {
+			n++
+		}
+	}
+	return n
+}
+
+// existsCommand is the probe used by Manager.Exists
+func existsCommand(envName string) string {
+	return fmt.Sprintf("id %[1]s && [ -e /envs/%[1]s/namespace.pid ] && kill -0 $(cat /envs/%[1]s/namespace.pid)", envName)
+}
+
 func TestIsValidEnvironmentName(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -85,3 +245,228 @@ func TestEnvironmentStruct(t *testing.T) {
 		t.Errorf("Expected ProjectPath to be '/Users/test/project', got %s", env.ProjectPath)
 	}
 }
+
+func TestResolve(t *testing.T) {
+	home, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := filepath.Join(home, "app")
+	if err := os.Mkdir(project, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(project, filepath.Join(home, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newManagerWithExecutor(newMockExecutor())
+	m.paths = pathmap.New([]pathmap.Mount{{Host: home}, {Host: "/srv/shared", VM: "/mnt/shared"}}, "linux")
+
+	want, err := GenerateName(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		in         string
+		wantPath   string
+		wantVMPath string
+		wantErr    bool
+	}{
+		{name: "project path", in: project, wantPath: project},
+		{name: "through a symlink", in: filepath.Join(home, "link"), wantPath: project},
+		{name: "mount point", in: "/srv/shared/app", wantPath: "/srv/shared/app", wantVMPath: "/mnt/shared/app"},
+		{name: "not shared", in: "/opt/app", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := m.Resolve(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, pathmap.ErrNotShared) {
+					t.Errorf("expected ErrNotShared, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if env.ProjectPath != tt.wantPath || env.VMPath != tt.wantVMPath {
+				t.Errorf("got %s (VM %q), want %s (VM %q)", env.ProjectPath, env.VMPath, tt.wantPath, tt.wantVMPath)
+			}
+			if tt.wantPath == project && env.Name != want {
+				t.Errorf("Name = %s, want %s", env.Name, want)
+			}
+		})
+	}
+}
+
+func TestExists_CachesProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		probeOK bool
+		runs    int
+	}{
+		{name: "existing environment", probeOK: true, runs: 1},
+		// Failures aren't cached; they may be transient
+		{name: "missing environment", probeOK: false, runs: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			cmd := existsCommand("my-project-a1b2")
+			if tt.probeOK {
+				mock.setResponse(cmd, "")
+			} else {
+				mock.setError(cmd, fmt.Errorf("exit status 1"))
+			}
+
+			mgr := newManagerWithExecutor(mock)
+			ctx := context.Background()
+
+			for i := 0; i < 3; i++ {
+				exists, err := mgr.Exists(ctx, "my-project-a1b2")
+				if err != nil {
+					t.Fatalf("Exists failed: %v", err)
+				}
+				if exists != tt.probeOK {
+					t.Errorf("expected exists=%v, got %v", tt.probeOK, exists)
+				}
+			}
+
+			if n := mock.callCount(cmd); n != tt.runs {
+				t.Errorf("expected probe to run %d times, ran %d times", tt.runs, n)
+			}
+		})
+	}
+}
+
+func TestProbeCache_Expiry(t *testing.T) {
+	mock := newMockExecutor()
+	cmd := existsCommand("my-project-a1b2")
+	mock.setResponse(cmd, "")
+
+	mgr := newManagerWithExecutor(mock)
+	now := time.Now()
+	mgr.probes.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, _ = mgr.Exists(ctx, "my-project-a1b2")
+	now = now.Add(probeCacheTTL + time.Millisecond)
+	_, _ = mgr.Exists(ctx, "my-project-a1b2")
+
+	if n := mock.callCount(cmd); n != 2 {
+		t.Errorf("expected expired probe to rerun, ran %d times", n)
+	}
+}
+
+func TestProbeCache_Invalidate(t *testing.T) {
+	mock := newMockExecutor()
+	cmd := existsCommand("my-project-a1b2")
+	mock.setResponse(cmd, "")
+
+	mgr := newManagerWithExecutor(mock)
+	ctx := context.Background()
+
+	_, _ = mgr.Exists(ctx, "my-project-a1b2")
+	mgr.probes.invalidate()
+	_, _ = mgr.Exists(ctx, "my-project-a1b2")
+
+	if n := mock.callCount(cmd); n != 2 {
+		t.Errorf("expected invalidated probe to rerun, ran %d times", n)
+	}
+}
+
+func TestProbe_CancelledContextNotCached(t *testing.T) {
+	mock := newMockExecutor()
+	cmd := existsCommand("my-project-a1b2")
+	mock.setError(cmd, context.Canceled)
+
+	mgr := newManagerWithExecutor(mock)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _ = mgr.probe(ctx, cmd)
+	if _, ok := mgr.probes.get(cmd); ok {
+		t.Error("expected result of cancelled probe not to be cached")
+	}
+}
+
+func TestEnterNamespace_Exec(t *testing.T) {
+	env := &Environment{Name: "app-a1b2", Driver: vmOnlyMount}
+
+	tests := []struct {
+		name    string
+		cmd     []string
+		opts    EnterOptions
+		wantErr string
+	}{
+		{
+			name: "runs argv without a shell",
+			cmd:  []string{"grep", "-r", "$(reboot); *", "."},
+			opts: EnterOptions{Exec: true},
+		},
+		{
+			name:    "needs a command",
+			opts:    EnterOptions{Exec: true},
+			wantErr: "needs a command",
+		},
+		{
+			name:    "program name with =",
+			cmd:     []string{"A=b", "sh"},
+			opts:    EnterOptions{Exec: true},
+			wantErr: "contains '='",
+		},
+		{
+			name:    "guard needs a shell",
+			cmd:     []string{"rm", "-rf", "build"},
+			opts:    EnterOptions{Exec: true, GuardPatterns: []string{"rm"}},
+			wantErr: "need a shell",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			m := newManagerWithExecutor(mock)
+
+			err := m.EnterNamespace(t.Context(), env, tt.cmd, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				if len(mock.calls) != 0 {
+					t.Errorf("expected no commands, got %v", mock.calls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EnterNamespace failed: %v", err)
+			}
+
+			if !calledWith(mock, "env -i -- ") || !calledWith(mock, "LLIMA_BOX_ENV=app-a1b2") || !calledWith(mock, ` grep -r '$(reboot); *' .`) {
+				t.Errorf("expected the argv to be executed directly, got %v", mock.calls)
+			}
+			if calledWith(mock, "su --login") {
+				t.Errorf("expected no login shell, got %v", mock.calls)
+			}
+		})
+	}
+}
+
+func TestCreate_MetadataReadError(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	mock.setError(readMetadataCommand("app-a1b2"), errors.New("connection lost"))
+	env := &Environment{Name: "app-a1b2", ProjectPath: t.TempDir()}
+
+	if _, err := newManagerWithExecutor(mock).create(context.Background(), env); err == nil {
+		t.Fatal("expected an unreadable metadata file to fail the create")
+	}
+	if calledWith(mock, "useradd") || calledWith(mock, "metadata.json.tmp") {
+		t.Errorf("expected the environment not to be set up again, got calls %v", mock.calls)
+	}
+}
@@ -0,0 +1,128 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/env/templates"
+)
+
+// metadata is the environment record stored at /envs/<name>/metadata.json.
+// It holds what's needed to rebuild an environment's namespace after the VM
+// restarts, and how far provisioning got.
+type metadata struct {
+	ProjectPath string    `json:"projectPath"`
+	CreatedAt   time.Time `json:"createdAt"`
+
+	// Step is the last completed provisioning step. Records written before
+	// steps were tracked have none and belong to complete environments.
+	Step string `json:"step,omitempty"`
+
+	// Mount names the mount driver realizing the environment's workspace;
+	// see Environment.Driver
+	Mount string `json:"mount,omitempty"`
+
+	// Isolated and Overlay recorded the workspace mode before mount
+	// drivers were; upgradeMetadata turns them into Mount
+	Isolated bool `json:"isolated,omitempty"`
+	Overlay  bool `json:"overlay,omitempty"`
+
+	// Resources are what the project declared it needs when the environment
+	// was created
+	Resources *Reservation `json:"resources,omitempty"`
+
+	// Template is a copy of the template the environment was created from
+	Template *templates.Template `json:"template,omitempty"`
+
+	// Provisioned is the provisioning configuration the environment was
+	// last brought up to date with, and ProvisionHash its hash
+	Provisioned   *ProvisioningConfig `json:"provisioned,omitempty"`
+	ProvisionHash string              `json:"provisionHash,omitempty"`
+
+	// Quarantine is set while the environment is quarantined
+	Quarantine *QuarantineRecord `json:"quarantine,omitempty"`
+
+	// Version is the metadata format version; records without one are
+	// version 0. Older records are upgraded as they're read.
+	Version int `json:"version,omitempty"`
+}
+
+// environment returns the environment md describes, named envName
+func (md *metadata) environment(envName string) *Environment {
+	return &Environment{Name: envName, ProjectPath: md.ProjectPath, Driver: md.Mount, Template: md.Template}
+}
+
+// envDir returns the VM directory holding an environment's state
+func envDir(envName string) string {
+	return "/envs/" + envName
+}
+
+// metadataPath returns the path of an environment's metadata file
+func metadataPath(envName string) string {
+	return envDir(envName) + "/metadata.json"
+}
+
+// writeMetadata stores the metadata for an environment. The file is written
+// to a temporary name and renamed into place, so readers and a crash
+// mid-write only ever see the old or the new record.
+func (m *Manager) writeMetadata(ctx context.Context, envName string, md *metadata) error {
+	md.Version = metadataVersion
+	data, err := json.Marshal(md)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	path := metadataPath(envName)
+	cmd := fmt.Sprintf(
+		"sudo mkdir -p %[3]s && printf '%%s\\n' %[1]s | sudo tee %[2]s.tmp >/dev/null && sudo sync %[2]s.tmp && sudo mv -f %[2]s.tmp %[2]s",
+		shellquote.Quote(string(data)), path, envDir(envName),
+	)
+	if _, err := m.sshClient.ExecContext(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// errNoMetadata is returned by readMetadata for environments without a
+// metadata file: new ones, and ones created before metadata was recorded
+var errNoMetadata = errors.New("no metadata recorded")
+
+// readMetadataCommand prints an environment's metadata file, or nothing if
+// there's none. It fails if the file exists but can't be read.
+func readMetadataCommand(envName string) string {
+	return fmt.Sprintf("sudo cat %[1]s 2>/dev/null || sudo test ! -e %[1]s", metadataPath(envName))
+}
+
+// readMetadata loads the metadata for an environment, returning
+// errNoMetadata if none was recorded. Metadata is written whole, so an empty
+// file counts as none.
+func (m *Manager) readMetadata(ctx context.Context, envName string) (*metadata, error) {
+	output, err := m.sshClient.ExecContext(ctx, readMetadataCommand(envName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if strings.TrimSpace(output) == "" {
+		return nil, errNoMetadata
+	}
+	return parseMetadata(output)
+}
+
+// parseMetadata decodes a metadata file
+func parseMetadata(data string) (*metadata, error) {
+	var md metadata
+	if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &md); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+	if md.ProjectPath == "" {
+		return nil, fmt.Errorf("metadata has no project path")
+	}
+	if err := upgradeMetadata(&md); err != nil {
+		return nil, err
+	}
+	return &md, nil
+}
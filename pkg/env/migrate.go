@@ -0,0 +1,174 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+// LayoutVersion is the version of the VM layout (the /envs tree, namespace
+// keepers, and the files around them) this llima-box writes. A VM set up by
+// an older llima-box is brought up to date by its pending migrations when
+// llima-box connects.
+const LayoutVersion = 1
+
+// layoutVersionPath records the VM's layout version. Environment scans only
+// look at directories, so the file doesn't show up as an environment.
+const layoutVersionPath = "/envs/.layout-version"
+
+// migrationLockName serializes layout migrations between concurrent CLIs
+const migrationLockName = "migration"
+
+// Migration brings the VM layout from Version-1 to Version
+type Migration struct {
+	// Version is the layout version the migration produces
+	Version int
+
+	// Commands change the layout. They run before the new version is
+	// recorded, so they must be safe to run again if a migration is
+	// interrupted.
+	Commands []RemoteCommand
+}
+
+// migrations lists the layout migrations in order, one per version
+var migrations = []Migration{
+	{
+		// Namespace PID files used to live in the environment user's home
+		// directory
+		Version: 1,
+		Commands: []RemoteCommand{{
+			Purpose: "move namespace PID files to /envs",
+			// Home directories aren't readable by the VM user, so the
+			// glob runs as root
+			Script: `sudo sh -c 'for f in /home/*/namespace.pid; do [ -e "$f" ] || continue; ` +
+				`n=$(basename "$(dirname "$f")"); ` +
+				`mkdir -p "/envs/$n" && mv -n "$f" "/envs/$n/namespace.pid" && rm -f "$f"; done'`,
+		}},
+	},
+}
+
+// PendingMigrations returns the migrations bringing the layout from version
+// to LayoutVersion
+func PendingMigrations(version int) []Migration {
+	var pending []Migration
+	for _, mig := range migrations {
+		if mig.Version > version {
+			pending = append(pending, mig)
+		}
+	}
+	return pending
+}
+
+// MigrationCommands returns the commands running the migrations from
+// version, each followed by recording the version it produces, so an
+// interrupted upgrade resumes from the last finished migration
+func MigrationCommands(version int) []RemoteCommand {
+	var cmds []RemoteCommand
+	for _, mig := range PendingMigrations(version) {
+		cmds = append(cmds, mig.Commands...)
+		cmds = append(cmds, RemoteCommand{
+			Purpose: fmt.Sprintf("record layout version %d", mig.Version),
+			Script:  fmt.Sprintf("sudo mkdir -p /envs && echo %d | sudo tee %s >/dev/null", mig.Version, layoutVersionPath),
+		})
+	}
+	return cmds
+}
+
+// layoutVersion reads the VM's layout version. A VM without a record was set
+// up before layouts were versioned and is at version 0.
+func (m *Manager) layoutVersion(ctx context.Context) (int, error) {
+	output, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("cat %s 2>/dev/null || true", layoutVersionPath))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read layout version: %w", err)
+	}
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(output)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse layout version %q: %w", output, err)
+	}
+	return version, nil
+}
+
+// migrate runs the layout migrations the VM is missing. It fails if the VM
+// was set up by a newer llima-box, whose layout this one could damage.
+func (m *Manager) migrate(ctx context.Context) error {
+	version, err := m.layoutVersion(ctx)
+	if err != nil || version == LayoutVersion {
+		return err
+	}
+	if version > LayoutVersion {
+		return fmt.Errorf("the VM was set up by a newer llima-box (layout version %d, this one supports %d); upgrade llima-box", version, LayoutVersion)
+	}
+
+	// Concurrent CLIs wait for whichever one migrates first
+	unlock, err := m.locks.lock(ctx, migrationLockName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if version, err = m.layoutVersion(ctx); err != nil {
+		return err
+	}
+
+	m.probes.invalidate()
+	if err := m.runCommands(ctx, MigrationCommands(version)); err != nil {
+		return fmt.Errorf("failed to migrate the VM from layout version %d: %w", version, err)
+	}
+	return nil
+}
+
+// metadataVersion is the version of the metadata format this llima-box
+// writes
+const metadataVersion = 3
+
+// metadataMigrations upgrade a metadata record from each version to the
+// next; metadataMigrations[i] takes a record from version i to i+1
+var metadataMigrations = []func(md *metadata){
+	// Records written before provisioning steps were tracked belong to
+	// complete environments
+	func(md *metadata) {
+		if md.Step == "" {
+			md.Step = stepMountsDone
+		}
+	},
+	// Environments created before setup scripts existed are complete;
+	// their setup script isn't run retroactively
+	func(md *metadata) {
+		if md.Step == stepMountsDone {
+			md.Step = stepSetupDone
+		}
+	},
+	// Workspace modes were flags before they were mount drivers
+	func(md *metadata) {
+		switch {
+		case md.Isolated:
+			md.Mount = vmOnlyMount
+		case md.Overlay:
+			md.Mount = config.WorkspaceOverlay
+		default:
+			md.Mount = config.WorkspaceBind
+		}
+		md.Isolated, md.Overlay = false, false
+	},
+}
+
+// upgradeMetadata brings a metadata record to metadataVersion
+func upgradeMetadata(md *metadata) error {
+	if md.Version < 0 {
+		return fmt.Errorf("invalid metadata version %d", md.Version)
+	}
+	if md.Version > metadataVersion {
+		return fmt.Errorf("metadata version %d is newer than this llima-box supports (%d); upgrade llima-box", md.Version, metadataVersion)
+	}
+	for _, upgrade := range metadataMigrations[md.Version:] {
+		upgrade(md)
+	}
+	md.Version = metadataVersion
+	return nil
+}
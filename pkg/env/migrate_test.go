@@ -0,0 +1,103 @@
+package env
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGolden_Migrations(t *testing.T) {
+	checkGolden(t, "migrations", formatCommands(MigrationCommands(0)))
+}
+
+func TestMigrations_Ordered(t *testing.T) {
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			t.Errorf("migrations[%d] has version %d, want %d", i, mig.Version, i+1)
+		}
+	}
+	if len(migrations) != LayoutVersion {
+		t.Errorf("LayoutVersion is %d but there are %d migrations", LayoutVersion, len(migrations))
+	}
+	if len(metadataMigrations) != metadataVersion {
+		t.Errorf("metadataVersion is %d but there are %d metadata migrations", metadataVersion, len(metadataMigrations))
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	versionCmd := fmt.Sprintf("cat %s 2>/dev/null || true", layoutVersionPath)
+
+	tests := []struct {
+		name    string
+		version string
+		wantRun bool
+		wantErr string
+	}{
+		{name: "unversioned VM", version: "", wantRun: true},
+		{name: "current", version: fmt.Sprintf("%d\n", LayoutVersion)},
+		{name: "newer llima-box", version: fmt.Sprintf("%d\n", LayoutVersion+1), wantErr: "set up by a newer llima-box"},
+		{name: "garbage", version: "x\n", wantErr: "failed to parse layout version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			mock.setResponse(versionCmd, tt.version)
+			m := newManagerWithExecutor(mock)
+
+			err := m.migrate(t.Context())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("migrate failed: %v", err)
+			}
+
+			recorded := calledWith(mock, fmt.Sprintf("echo %d | sudo tee %s", LayoutVersion, layoutVersionPath))
+			if recorded != tt.wantRun {
+				t.Errorf("expected migrations to run: %v, got calls %v", tt.wantRun, mock.calls)
+			}
+		})
+	}
+}
+
+func TestUpgradeMetadata(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		wantStep  string
+		wantMount string
+		wantErr   string
+	}{
+		{name: "before steps were tracked", data: `{"projectPath":"/p"}`, wantStep: stepSetupDone, wantMount: "bind"},
+		{name: "unversioned with step", data: `{"projectPath":"/p","step":"user-created"}`, wantStep: stepUserCreated, wantMount: "bind"},
+		{name: "before setup scripts", data: `{"projectPath":"/p","step":"mounts-done","version":1}`, wantStep: stepSetupDone, wantMount: "bind"},
+		{name: "overlay before mount drivers", data: `{"projectPath":"/p","step":"setup-done","overlay":true,"version":2}`, wantStep: stepSetupDone, wantMount: "overlay"},
+		{name: "VM workspace before mount drivers", data: `{"projectPath":"/p","step":"setup-done","isolated":true,"version":2}`, wantStep: stepSetupDone, wantMount: "vm-only"},
+		{name: "current", data: `{"projectPath":"/p","step":"mounts-done","mount":"overlay","version":3}`, wantStep: stepMountsDone, wantMount: "overlay"},
+		{name: "newer", data: `{"projectPath":"/p","version":99}`, wantErr: "metadata version 99 is newer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := parseMetadata(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if md.Step != tt.wantStep || md.Version != metadataVersion {
+				t.Errorf("expected step %q at version %d, got %q at %d", tt.wantStep, metadataVersion, md.Step, md.Version)
+			}
+			if md.Mount != tt.wantMount || md.Isolated || md.Overlay {
+				t.Errorf("expected mount %q without flags, got %+v", tt.wantMount, md)
+			}
+		})
+	}
+}
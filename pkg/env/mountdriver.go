@@ -0,0 +1,108 @@
+package env
+
+import (
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+// MountDriver realizes an environment's workspace: how its project
+// directory appears inside its namespace, and what the environment can do
+// with the host's files. An environment's driver is picked when it's
+// created and recorded by name in its metadata; see Environment.Mount.
+type MountDriver interface {
+	// Name is the driver's name, as chosen in the project configuration
+	// and recorded in the environment's metadata
+	Name() string
+
+	// Access is how the environment reaches its project directory
+	Access() ProjectAccess
+
+	// WritesHost reports whether the environment's writes land in the host
+	// project directory
+	WritesHost() bool
+
+	// HostProject reports whether the project directory is on the host, so
+	// its configuration and files can be read there and reference
+	// directories are mounted alongside it
+	HostProject() bool
+
+	// WorkspaceDir returns the VM directory holding env's workspace, which
+	// is created, archived, and deleted with the environment, or "" if the
+	// workspace is the host project
+	WorkspaceDir(env *Environment) string
+
+	// MountCommands returns the commands realizing env's workspace inside
+	// the namespace held by pid
+	MountCommands(env *Environment, pid string) []RemoteCommand
+}
+
+// vmOnlyMount is the name of the driver serving VM workspaces. It isn't a
+// mode projects can choose.
+const vmOnlyMount = "vm-only"
+
+// mountDrivers are the drivers by name
+var mountDrivers = map[string]MountDriver{
+	config.WorkspaceBind:    bindDriver{},
+	config.WorkspaceOverlay: overlayDriver{},
+	vmOnlyMount:             vmOnlyDriver{},
+}
+
+// bindDriver shows the host project, mounted into the VM by Lima, as it is.
+// The namespace inherits the mount, so there's nothing to do.
+type bindDriver struct{}
+
+func (bindDriver) Name() string          { return config.WorkspaceBind }
+func (bindDriver) Access() ProjectAccess { return ProjectReadWrite }
+func (bindDriver) WritesHost() bool      { return true }
+func (bindDriver) HostProject() bool     { return true }
+
+func (bindDriver) WorkspaceDir(*Environment) string                   { return "" }
+func (bindDriver) MountCommands(*Environment, string) []RemoteCommand { return nil }
+
+// overlayDriver mounts a copy-on-write overlay over the host project; see
+// overlayMountScript
+type overlayDriver struct{}
+
+func (overlayDriver) Name() string          { return config.WorkspaceOverlay }
+func (overlayDriver) Access() ProjectAccess { return ProjectOverlay }
+func (overlayDriver) WritesHost() bool      { return false }
+func (overlayDriver) HostProject() bool     { return true }
+
+func (overlayDriver) WorkspaceDir(*Environment) string { return "" }
+
+func (overlayDriver) MountCommands(env *Environment, pid string) []RemoteCommand {
+	return []RemoteCommand{overlayMountCommand(env, pid)}
+}
+
+// vmOnlyDriver serves VM workspaces (see CreateInVM), which are plain
+// directories in the VM; the host's directories are hidden
+type vmOnlyDriver struct{}
+
+func (vmOnlyDriver) Name() string          { return vmOnlyMount }
+func (vmOnlyDriver) Access() ProjectAccess { return ProjectVMOnly }
+func (vmOnlyDriver) WritesHost() bool      { return false }
+func (vmOnlyDriver) HostProject() bool     { return false }
+
+// WorkspaceDir returns the workspace under VMWorkspaceRoot. Paths elsewhere
+// aren't the environment's to remove.
+func (vmOnlyDriver) WorkspaceDir(env *Environment) string {
+	if strings.HasPrefix(env.ProjectPath, VMWorkspaceRoot+"/") {
+		return env.ProjectPath
+	}
+	return ""
+}
+
+func (vmOnlyDriver) MountCommands(_ *Environment, pid string) []RemoteCommand {
+	return []RemoteCommand{maskHostMountsCommand(pid)}
+}
+
+// Mount returns the driver realizing the environment's workspace, named by
+// Driver. Environments without one, such as those Resolve returns before
+// they're created, bind the host project.
+func (e *Environment) Mount() MountDriver {
+	if d, ok := mountDrivers[e.Driver]; ok {
+		return d
+	}
+	return bindDriver{}
+}
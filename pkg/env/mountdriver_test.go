@@ -0,0 +1,79 @@
+package env
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+func TestEnvironmentMount(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        Environment
+		want       string
+		access     ProjectAccess
+		writesHost bool
+		onHost     bool
+		dir        string
+		mounts     []string
+	}{
+		{
+			name:       "bind",
+			env:        Environment{Name: "app", ProjectPath: "/Users/me/app"},
+			want:       "bind",
+			access:     ProjectReadWrite,
+			writesHost: true,
+			onHost:     true,
+		},
+		{
+			name:   "overlay",
+			env:    Environment{Name: "app", ProjectPath: "/Users/me/app", Driver: config.WorkspaceOverlay},
+			want:   "overlay",
+			access: ProjectOverlay,
+			onHost: true,
+			mounts: []string{"mount workspace overlay"},
+		},
+		{
+			name:   "vm-only",
+			env:    Environment{Name: "scratch", ProjectPath: VMWorkspaceRoot + "/scratch", Driver: vmOnlyMount},
+			want:   "vm-only",
+			access: ProjectVMOnly,
+			dir:    VMWorkspaceRoot + "/scratch",
+			mounts: []string{"hide host mounts"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := tt.env.Mount()
+			if driver.Name() != tt.want {
+				t.Errorf("Name() = %q, want %q", driver.Name(), tt.want)
+			}
+			if driver.Access() != tt.access {
+				t.Errorf("Access() = %q, want %q", driver.Access(), tt.access)
+			}
+			if driver.WritesHost() != tt.writesHost {
+				t.Errorf("WritesHost() = %t, want %t", driver.WritesHost(), tt.writesHost)
+			}
+			if driver.HostProject() != tt.onHost {
+				t.Errorf("HostProject() = %t, want %t", driver.HostProject(), tt.onHost)
+			}
+			if got := driver.WorkspaceDir(&tt.env); got != tt.dir {
+				t.Errorf("WorkspaceDir() = %q, want %q", got, tt.dir)
+			}
+
+			cmds := driver.MountCommands(&tt.env, "42")
+			var purposes []string
+			for _, c := range cmds {
+				purposes = append(purposes, c.Purpose)
+				if !strings.Contains(c.Script, "nsenter") {
+					t.Errorf("%s doesn't run in the namespace: %s", c.Purpose, c.Script)
+				}
+			}
+			if strings.Join(purposes, ",") != strings.Join(tt.mounts, ",") {
+				t.Errorf("MountCommands() = %v, want %v", purposes, tt.mounts)
+			}
+		})
+	}
+}
@@ -19,9 +19,10 @@ func GenerateName(projectPath string) (string, error) {
 		return "", fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	// Extract basename
+	// Extract basename. Roots have none: "/", or a drive or share root such
+	// as C:\ on Windows.
 	basename := filepath.Base(absPath)
-	if basename == "." || basename == "/" {
+	if basename == "." || filepath.Dir(absPath) == absPath {
 		return "", fmt.Errorf("invalid project path: %s", projectPath)
 	}
 
@@ -77,6 +77,12 @@ func TestGenerateName(t *testing.T) {
 			wantErr:     false,
 			description: "Trailing hyphens removed",
 		},
+		{
+			name:        "filesystem root",
+			path:        "/",
+			wantErr:     true,
+			description: "Roots have no basename to name the environment after",
+		},
 		// Note: "." gets converted to absolute path by filepath.Abs,
 		// so it's actually valid (will be the basename of cwd)
 	}
@@ -0,0 +1,240 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// OverlayRoot is the VM directory holding the writable layers of overlay
+// environments. It's on the data disk, so an environment's changes survive
+// a VM restart like its home directory does.
+const OverlayRoot = vm.DataDiskMountPoint + "/overlays"
+
+// overlayDir returns the VM directory holding an environment's overlay: the
+// upper layer receiving its changes and overlayfs's work directory
+func overlayDir(envName string) string {
+	return OverlayRoot + "/" + envName
+}
+
+// overlayMountedScript returns a test succeeding if an overlay is mounted
+// at dir
+func overlayMountedScript(dir string) string {
+	return fmt.Sprintf("findmnt -rn -t overlay --mountpoint %s >/dev/null", shellWord(dir))
+}
+
+// overlayMountScript returns a script mounting env's overlay over its
+// project directory, unless it's already mounted. The host project is the
+// read-only lower layer. The upper layer's root takes the project
+// directory's owner and mode, since overlayfs shows it as the merged
+// directory.
+func overlayMountScript(env *Environment) string {
+	dir := shellWord(env.dir())
+	upper := overlayDir(env.Name) + "/upper"
+	work := overlayDir(env.Name) + "/work"
+	return fmt.Sprintf(
+		"%[1]s || { mkdir -p %[3]s %[4]s && chown --reference=%[2]s %[3]s && chmod --reference=%[2]s %[3]s && "+
+			"mount -t overlay llima-box-overlay -o lowerdir=%[2]s,upperdir=%[3]s,workdir=%[4]s %[2]s; }",
+		overlayMountedScript(env.dir()), dir, upper, work,
+	)
+}
+
+// overlayMountCommand returns the command mounting env's overlay inside the
+// namespace held by pid. The namespace has private mount propagation, so the
+// VM and other environments still see the host project as it is.
+func overlayMountCommand(env *Environment, pid string) RemoteCommand {
+	return RemoteCommand{Purpose: "mount workspace overlay", Script: pidRunner(pid).Script(overlayMountScript(env))}
+}
+
+// DiscardCommands returns the commands throwing away the changes env made
+// to its overlay: its processes are stopped, since they may hold files of
+// the overlay open, the overlay is unmounted and its layers removed, and an
+// empty overlay is mounted again. A stopped environment only has its layers
+// removed; it gets an empty overlay when it's next started.
+func DiscardCommands(env *Environment) []RemoteCommand {
+	dir := env.dir()
+	return []RemoteCommand{
+		{
+			Purpose:    "kill environment processes",
+			Script:     fmt.Sprintf("sudo pkill -u %s || true", env.Name),
+			BestEffort: true,
+		},
+		{
+			Purpose: "unmount workspace overlay",
+			Script:  ifNamespaceScript(env.Name, NewRemoteRunner(env.Name).Script(fmt.Sprintf("if %s; then umount -l %s; fi", overlayMountedScript(dir), shellWord(dir)))),
+		},
+		{
+			Purpose: "remove overlay changes",
+			Script:  fmt.Sprintf("sudo rm -rf %s", overlayDir(env.Name)),
+		},
+		{
+			Purpose: "mount workspace overlay",
+			Script:  ifNamespaceScript(env.Name, NewRemoteRunner(env.Name).Script(overlayMountScript(env))),
+		},
+	}
+}
+
+// ChangeKind says how a file in an overlay differs from the host project
+type ChangeKind string
+
+const (
+	// ChangeAdded files don't exist in the host project
+	ChangeAdded ChangeKind = "added"
+
+	// ChangeModified files exist in the host project with other contents or
+	// attributes
+	ChangeModified ChangeKind = "modified"
+
+	// ChangeDeleted files exist in the host project but were removed in
+	// the environment
+	ChangeDeleted ChangeKind = "deleted"
+)
+
+// Change is a file an overlay environment changed
+type Change struct {
+	// Path is relative to the project directory
+	Path string `json:"path"`
+
+	Kind ChangeKind `json:"kind"`
+}
+
+// overlayChangesCommand returns the command listing an overlay's upper
+// layer: files, symlinks, and empty directories, each as a type letter and
+// a path. Deletions are character devices (overlayfs whiteouts).
+func overlayChangesCommand(envName string) string {
+	return fmt.Sprintf("if sudo test -d %[1]s; then sudo find %[1]s -mindepth 1 \\( ! -type d -o -empty \\) -printf '%%y %%P\\n'; fi",
+		overlayDir(envName)+"/upper")
+}
+
+// parseOverlayChanges turns overlayChangesCommand output into changes,
+// sorted by path. exists tells whether a path is in the host project, which
+// separates added files from modified ones.
+func parseOverlayChanges(output string, exists func(path string) bool) []Change {
+	var changes []Change
+	for _, line := range strings.Split(output, "\n") {
+		kind, p, ok := strings.Cut(line, " ")
+		if !ok || p == "" {
+			continue
+		}
+		c := Change{Path: p, Kind: ChangeModified}
+		switch {
+		case kind == "c":
+			c.Kind = ChangeDeleted
+		case !exists(p):
+			c.Kind = ChangeAdded
+		}
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// overlayPatchCommand returns the command printing the changes as a
+// unified diff between the host project, which is the lower layer, and the
+// upper layer. Directories are skipped, since their files are listed
+// themselves. It fails only if diff had trouble (status 2 or more).
+func overlayPatchCommand(env *Environment, changes []Change) string {
+	lines := []string{
+		`d() { sudo test -d "$2" || sudo test -d "$4" || sudo diff -u --label "$1" --label "$3" "$2" "$4" || [ $? -eq 1 ]; }`,
+		"rc=0",
+	}
+	upper := overlayDir(env.Name) + "/upper/"
+	for _, c := range changes {
+		oldLabel, oldFile := "a/"+c.Path, env.dir()+"/"+c.Path
+		newLabel, newFile := "b/"+c.Path, upper+c.Path
+		switch c.Kind {
+		case ChangeAdded:
+			oldLabel, oldFile = "/dev/null", "/dev/null"
+		case ChangeDeleted:
+			newLabel, newFile = "/dev/null", "/dev/null"
+		}
+		lines = append(lines, fmt.Sprintf("d %s %s %s %s || rc=$?",
+			shellWord(oldLabel), shellWord(oldFile), shellWord(newLabel), shellWord(newFile)))
+	}
+	lines = append(lines, "exit $rc")
+	return strings.Join(lines, "\n")
+}
+
+// overlayEnvironment returns the metadata of an existing overlay
+// environment
+func (m *Manager) overlayEnvironment(ctx context.Context, env *Environment) (*metadata, error) {
+	md, err := m.readMetadata(ctx, env.Name)
+	if err != nil {
+		return nil, fmt.Errorf("environment %s does not exist", env.Name)
+	}
+	if md.Mount != config.WorkspaceOverlay {
+		return nil, fmt.Errorf("environment %s has no overlay; its changes go straight to the project (create it with --overlay)", env.Name)
+	}
+	return md, nil
+}
+
+// Changes returns the files an overlay environment changed compared to the
+// host project. The host project itself is untouched until the changes are
+// copied back.
+func (m *Manager) Changes(ctx context.Context, env *Environment) ([]Change, error) {
+	if err := m.ensureSSH(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := m.overlayEnvironment(ctx, env); err != nil {
+		return nil, err
+	}
+
+	output, err := m.sshClient.ExecContext(ctx, overlayChangesCommand(env.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list overlay changes: %w", err)
+	}
+	return parseOverlayChanges(output, func(p string) bool {
+		_, err := os.Lstat(filepath.Join(env.ProjectPath, filepath.FromSlash(p)))
+		return err == nil
+	}), nil
+}
+
+// Patch returns the changes of an overlay environment, as returned by
+// Changes, as a unified diff against the host project. Binary files are
+// only reported as differing.
+func (m *Manager) Patch(ctx context.Context, env *Environment, changes []Change) (string, error) {
+	if len(changes) == 0 {
+		return "", nil
+	}
+	if err := m.ensureSSH(ctx); err != nil {
+		return "", err
+	}
+
+	output, err := m.sshClient.ExecContext(ctx, overlayPatchCommand(env, changes))
+	if err != nil {
+		return "", fmt.Errorf("failed to diff overlay changes: %w: %s", err, strings.TrimSpace(output))
+	}
+	return output, nil
+}
+
+// Discard throws away the changes an overlay environment made, so it sees
+// the host project as it is again. Processes running in the environment are
+// ended.
+func (m *Manager) Discard(ctx context.Context, env *Environment) error {
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+
+	unlock, err := m.locks.lock(ctx, env.Name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := m.overlayEnvironment(ctx, env); err != nil {
+		return err
+	}
+	if err := m.checkNotQuarantined(ctx, env.Name); err != nil {
+		return err
+	}
+
+	m.probes.invalidate()
+	m.debugf(env.Name, "Discarding the overlay changes of %s", env.Name)
+	return m.runCommands(ctx, DiscardCommands(env))
+}
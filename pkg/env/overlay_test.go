@@ -0,0 +1,94 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+func TestGolden_Discard(t *testing.T) {
+	env := &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/my app", Driver: config.WorkspaceOverlay}
+	checkGolden(t, "discard", formatCommands(DiscardCommands(env)))
+}
+
+func TestParseOverlayChanges(t *testing.T) {
+	output := "f src/main.go\nc old.txt\nf notes.md\nd build\nl link\n\n"
+	inProject := map[string]bool{"src/main.go": true, "old.txt": true}
+
+	got := parseOverlayChanges(output, func(p string) bool { return inProject[p] })
+	want := []Change{
+		{Path: "build", Kind: ChangeAdded},
+		{Path: "link", Kind: ChangeAdded},
+		{Path: "notes.md", Kind: ChangeAdded},
+		{Path: "old.txt", Kind: ChangeDeleted},
+		{Path: "src/main.go", Kind: ChangeModified},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseOverlayChanges() = %+v, want %+v", got, want)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	projectPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(projectPath, "main.go"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	env := &Environment{Name: "app-a1b2", ProjectPath: projectPath}
+
+	mock := newMockExecutor()
+	mock.setResponse(readMetadataCommand("app-a1b2"), `{"projectPath":"`+projectPath+`","overlay":true}`)
+	mock.setResponse(overlayChangesCommand("app-a1b2"), "f main.go\nf new.go\n")
+
+	changes, err := newManagerWithExecutor(mock).Changes(context.Background(), env)
+	if err != nil {
+		t.Fatalf("Changes() failed: %v", err)
+	}
+	want := []Change{{Path: "main.go", Kind: ChangeModified}, {Path: "new.go", Kind: ChangeAdded}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Changes() = %+v, want %+v", changes, want)
+	}
+}
+
+func TestDiscard_NoOverlay(t *testing.T) {
+	env := &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/app"}
+
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	mock.setResponse(readMetadataCommand("app-a1b2"), `{"projectPath":"/Users/alice/app"}`)
+
+	err := newManagerWithExecutor(mock).Discard(context.Background(), env)
+	if err == nil || !strings.Contains(err.Error(), "has no overlay") {
+		t.Fatalf("Discard() error = %v, want one about the missing overlay", err)
+	}
+	for _, c := range DiscardCommands(env) {
+		if mock.callCount(c.Script) != 0 {
+			t.Errorf("%s ran without an overlay", c.Purpose)
+		}
+	}
+}
+
+func TestOverlayPatchCommand(t *testing.T) {
+	env := &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/my app", Driver: config.WorkspaceOverlay}
+	script := overlayPatchCommand(env, []Change{
+		{Path: "main.go", Kind: ChangeModified},
+		{Path: "new.go", Kind: ChangeAdded},
+		{Path: "old.go", Kind: ChangeDeleted},
+	})
+
+	upper := overlayDir("app-a1b2") + "/upper/"
+	for _, want := range []string{
+		"d a/main.go '/Users/alice/my app/main.go' b/main.go " + upper + "main.go || rc=$?",
+		"d /dev/null /dev/null b/new.go " + upper + "new.go || rc=$?",
+		"d a/old.go '/Users/alice/my app/old.go' /dev/null /dev/null || rc=$?",
+		"exit $rc",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected %q in:\n%s", want, script)
+		}
+	}
+}
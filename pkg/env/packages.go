@@ -0,0 +1,102 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/dockerfile"
+	"github.com/middlendian/llima-box/pkg/env/templates"
+)
+
+// installPackagesCommand returns the command that installs apt packages that
+// aren't installed yet. The package index is only refreshed when something
+// needs installing. Version pins (pkg=1.2) only apply to the install.
+func installPackagesCommand(packages []string) string {
+	names := make([]string, len(packages))
+	quoted := make([]string, len(packages))
+	for i, pkg := range packages {
+		name, _, _ := strings.Cut(pkg, "=")
+		names[i] = shellquote.Quote(name)
+		quoted[i] = shellquote.Quote(pkg)
+	}
+	return fmt.Sprintf(
+		"dpkg -s %s >/dev/null 2>&1 || { sudo apt-get update && sudo DEBIAN_FRONTEND=noninteractive apt-get install -y -o DPkg::Lock::Timeout=120 %s; }",
+		strings.Join(names, " "), strings.Join(quoted, " "),
+	)
+}
+
+// checkPackages returns an error for the first entry that isn't a Debian
+// package name. apt-get install runs as root and would install a local .deb
+// file given by path.
+func checkPackages(packages []string) error {
+	for _, pkg := range packages {
+		if !dockerfile.ValidPackage(pkg) {
+			return fmt.Errorf("invalid package name %q", pkg)
+		}
+	}
+	return nil
+}
+
+// ensureTemplatePackages installs the apt packages of the template an
+// environment is created from
+func (m *Manager) ensureTemplatePackages(ctx context.Context, tmpl *templates.Template) error {
+	if tmpl == nil || len(tmpl.Packages) == 0 {
+		return nil
+	}
+
+	if err := checkPackages(tmpl.Packages); err != nil {
+		return fmt.Errorf("template %s: %w", tmpl.Name, err)
+	}
+	m.debugf("", "Ensuring %d package(s) from template %s", len(tmpl.Packages), tmpl.Name)
+	if err := m.streamCommand(ctx, "", installPackagesCommand(tmpl.Packages)); err != nil {
+		return fmt.Errorf("failed to install template packages: %w", err)
+	}
+	return nil
+}
+
+// ensurePackages installs the apt packages imported from the project's
+// Dockerfile, if one is configured. Packages are installed VM-wide, like the
+// VM's base packages.
+func (m *Manager) ensurePackages(ctx context.Context, projectPath string, project *config.Project) error {
+	path := project.DockerfilePath(projectPath)
+	if path == "" {
+		return nil
+	}
+
+	provisioning, err := dockerfile.Load(path, project.Dockerfile.Stage)
+	if err != nil {
+		return err
+	}
+	for _, step := range provisioning.Skipped {
+		m.debugf("", "Skipping Dockerfile step (not imported): %s", step)
+	}
+	if len(provisioning.Packages) == 0 {
+		return nil
+	}
+
+	if err := checkPackages(provisioning.Packages); err != nil {
+		return fmt.Errorf("%s: %w", project.Dockerfile.Path, err)
+	}
+	m.debugf("", "Ensuring %d package(s) from %s", len(provisioning.Packages), project.Dockerfile.Path)
+	if err := m.streamCommand(ctx, "", installPackagesCommand(provisioning.Packages)); err != nil {
+		return fmt.Errorf("failed to install Dockerfile packages: %w", err)
+	}
+	return nil
+}
+
+// dockerfilePackages returns the apt packages imported from the project's
+// Dockerfile, or nil if none is configured
+func dockerfilePackages(projectPath string, project *config.Project) ([]string, error) {
+	path := project.DockerfilePath(projectPath)
+	if path == "" {
+		return nil, nil
+	}
+	provisioning, err := dockerfile.Load(path, project.Dockerfile.Stage)
+	if err != nil {
+		return nil, err
+	}
+	return provisioning.Packages, nil
+}
@@ -0,0 +1,85 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+func TestEnsurePackages(t *testing.T) {
+	projectPath := t.TempDir()
+	content := "FROM ubuntu:24.04\nRUN apt-get update && apt-get install -y jq ripgrep\n"
+	if err := os.WriteFile(filepath.Join(projectPath, "Dockerfile"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write Dockerfile: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		project   *config.Project
+		wantCalls []string
+	}{
+		{
+			name:    "no dockerfile",
+			project: &config.Project{},
+		},
+		{
+			name:      "dockerfile packages",
+			project:   &config.Project{Dockerfile: &config.DockerfileSource{Path: "Dockerfile"}},
+			wantCalls: []string{installPackagesCommand([]string{"jq", "ripgrep"})},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			m := newManagerWithExecutor(mock)
+
+			if err := m.ensurePackages(context.Background(), projectPath, tt.project); err != nil {
+				t.Fatalf("ensurePackages failed: %v", err)
+			}
+			if len(mock.calls) != len(tt.wantCalls) {
+				t.Fatalf("calls = %q, want %q", mock.calls, tt.wantCalls)
+			}
+			for i, want := range tt.wantCalls {
+				if mock.calls[i] != want {
+					t.Errorf("calls[%d] = %q, want %q", i, mock.calls[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestInstallPackagesCommand(t *testing.T) {
+	got := installPackagesCommand([]string{"jq", "pkg-config=1.8.1-2"})
+	want := "dpkg -s 'jq' 'pkg-config' >/dev/null 2>&1 || { sudo apt-get update && sudo DEBIAN_FRONTEND=noninteractive apt-get install -y -o DPkg::Lock::Timeout=120 'jq' 'pkg-config=1.8.1-2'; }"
+	if got != want {
+		t.Errorf("installPackagesCommand() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCheckPackages(t *testing.T) {
+	tests := []struct {
+		name     string
+		packages []string
+		wantErr  bool
+	}{
+		{name: "names and pins", packages: []string{"jq", "pkg-config=1.8.1-2", "g++"}},
+		{name: "relative path", packages: []string{"./x.deb"}, wantErr: true},
+		{name: "absolute path", packages: []string{"jq", "/Users/me/proj/evil.deb"}, wantErr: true},
+		{name: "deb file", packages: []string{"evil.deb"}, wantErr: true},
+		{name: "url", packages: []string{"https://example.com/tool.deb"}, wantErr: true},
+		{name: "option", packages: []string{"--allow-downgrades"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkPackages(tt.packages); (err != nil) != tt.wantErr {
+				t.Errorf("checkPackages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
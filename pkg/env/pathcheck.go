@@ -0,0 +1,51 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+// ErrUnsafeProjectPath is returned for project directories that must not be
+// mounted into an environment
+var ErrUnsafeProjectPath = errors.New("refusing to mount this directory into an environment")
+
+// checkProjectPath refuses project directories that would expose more than
+// a project: the filesystem root, directories containing the whole home
+// directory, and anything on the denylist or containing something on it.
+// projectPath must be canonical.
+func (m *Manager) checkProjectPath(projectPath string) error {
+	if projectPath == "/" {
+		return fmt.Errorf("%w: / is the whole filesystem", ErrUnsafeProjectPath)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	if home, err = m.paths.Canonical(home); err != nil {
+		return err
+	}
+	if m.paths.Contains(projectPath, home) {
+		return fmt.Errorf("%w: %s contains your whole home directory, including SSH keys and cloud credentials; use the project's own directory instead",
+			ErrUnsafeProjectPath, projectPath)
+	}
+
+	for _, denied := range m.options.DeniedPaths {
+		dir, err := m.paths.Canonical(config.ExpandHome(denied, home))
+		if err != nil {
+			return err
+		}
+		switch {
+		case m.paths.Contains(dir, projectPath):
+			return fmt.Errorf("%w: %s is inside %s, which holds credentials (paths.deny in the host configuration)",
+				ErrUnsafeProjectPath, projectPath, dir)
+		case m.paths.Contains(projectPath, dir):
+			return fmt.Errorf("%w: %s contains %s, which holds credentials (paths.deny in the host configuration); use a directory holding only the project",
+				ErrUnsafeProjectPath, projectPath, dir)
+		}
+	}
+	return nil
+}
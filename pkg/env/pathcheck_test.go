@@ -0,0 +1,69 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckProjectPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if resolved, err := filepath.EvalSymlinks(home); err == nil {
+		home = resolved
+	}
+	if err := os.MkdirAll(filepath.Join(home, "Library", "Keychains"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		denied  []string
+		wantErr bool
+	}{
+		{name: "project below home", path: filepath.Join(home, "src", "app")},
+		{name: "filesystem root", path: "/", wantErr: true},
+		{name: "home directory", path: home, wantErr: true},
+		{name: "parent of home", path: filepath.Dir(home), wantErr: true},
+		{name: "inside a denied directory", path: filepath.Join(home, ".ssh", "keys"), wantErr: true},
+		{name: "contains a denied directory", path: filepath.Join(home, "Library"), wantErr: true},
+		{name: "denied directory itself", path: filepath.Join(home, ".aws"), wantErr: true},
+		{name: "similar name is allowed", path: filepath.Join(home, ".ssh-tools")},
+		{
+			name:    "custom denylist",
+			path:    filepath.Join(home, "work", "secrets"),
+			denied:  []string{"~/work/secrets"},
+			wantErr: true,
+		},
+		{
+			name:   "empty denylist allows credential directories",
+			path:   filepath.Join(home, ".ssh"),
+			denied: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newManagerWithExecutor(newMockExecutor())
+			if tt.denied != nil {
+				m.options.DeniedPaths = tt.denied
+			}
+
+			err := m.checkProjectPath(tt.path)
+			if tt.wantErr && !errors.Is(err, ErrUnsafeProjectPath) {
+				t.Errorf("expected ErrUnsafeProjectPath for %s, got: %v", tt.path, err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("expected %s to be allowed, got: %v", tt.path, err)
+			}
+		})
+	}
+
+	m := newManagerWithExecutor(newMockExecutor())
+	m.options.DeniedPaths = []string{}
+	if err := m.checkProjectPath(home); !errors.Is(err, ErrUnsafeProjectPath) {
+		t.Errorf("expected the home directory to be refused with an empty denylist, got: %v", err)
+	}
+}
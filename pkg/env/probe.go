@@ -0,0 +1,77 @@
+package env
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// probeCacheTTL is how long probe results are reused. It only needs to span
+// a single CLI operation, which typically checks the same state several times.
+const probeCacheTTL = 2 * time.Second
+
+// probeResult is a cached probe command result
+type probeResult struct {
+	output string
+	at     time.Time
+}
+
+// probeCache caches results of idempotent, read-only probe commands
+// (id, kill -0 on the keeper, ...) so repeated checks within one operation
+// don't each pay a full SSH round trip. Only successes are cached: a failure
+// may be a dropped connection rather than an answer.
+type probeCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]probeResult
+}
+
+func newProbeCache(ttl time.Duration) *probeCache {
+	return &probeCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]probeResult),
+	}
+}
+
+// get returns a cached result if one exists and hasn't expired
+func (c *probeCache) get(cmd string) (probeResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, ok := c.entries[cmd]
+	if !ok || c.now().Sub(r.at) > c.ttl {
+		return probeResult{}, false
+	}
+	return r, true
+}
+
+// put stores the output of a successful probe
+func (c *probeCache) put(cmd, output string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[cmd] = probeResult{output: output, at: c.now()}
+}
+
+// invalidate drops all cached results. Called before any mutating operation.
+func (c *probeCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]probeResult)
+}
+
+// probe runs a read-only command, reusing a recent result when available
+func (m *Manager) probe(ctx context.Context, cmd string) (string, error) {
+	if r, ok := m.probes.get(cmd); ok {
+		return r.output, nil
+	}
+
+	output, err := m.sshClient.ExecContext(ctx, cmd)
+	if err == nil {
+		m.probes.put(cmd, output)
+	}
+	return output, err
+}
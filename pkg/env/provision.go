@@ -0,0 +1,208 @@
+package env
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+// Provisioning steps, in the order Create runs them. After each step the
+// step's name is recorded in the environment's metadata, so an interrupted
+// Create resumes after the last completed step.
+const (
+	// stepStarted is recorded before the first step runs
+	stepStarted = "started"
+
+	// stepPackagesInstalled: Dockerfile packages and toolchain layers are in
+	// place. Both are shared by the whole VM.
+	stepPackagesInstalled = "packages-installed"
+
+	// stepUserCreated: the environment's user account exists, along with its
+	// workspace for isolated environments
+	stepUserCreated = "user-created"
+
+	// stepNamespaceUp: the namespace keeper process is running
+	stepNamespaceUp = "namespace-up"
+
+	// stepMountsDone: toolchains are mounted and the profile is written
+	stepMountsDone = "mounts-done"
+
+	// stepSetupDone: the project's setup script has run. The environment is
+	// complete.
+	stepSetupDone = "setup-done"
+)
+
+// provisionSteps lists the steps after stepStarted in order
+var provisionSteps = []string{stepPackagesInstalled, stepUserCreated, stepNamespaceUp, stepMountsDone, stepSetupDone}
+
+// stepIndex returns the position of a completed step in provisionSteps: -1
+// when no step has completed yet. Metadata without a step predates step
+// tracking and belongs to a complete environment.
+func stepIndex(step string) int {
+	if step == "" {
+		return len(provisionSteps) - 1
+	}
+	for i, s := range provisionSteps {
+		if s == step {
+			return i
+		}
+	}
+	return -1
+}
+
+// complete reports whether every provisioning step has completed
+func (md *metadata) complete() bool {
+	return stepIndex(md.Step) == len(provisionSteps)-1
+}
+
+// provision runs the provisioning steps that haven't completed yet,
+// checkpointing each in the environment's metadata. running tells whether the
+// namespace keeper is alive; namespaces and their mounts don't survive a VM
+// restart, so without a keeper those steps run again.
+func (m *Manager) provision(ctx context.Context, env *Environment, project *config.Project, md *metadata, running bool) error {
+	done := stepIndex(md.Step)
+	setupRan := done >= stepIndex(stepSetupDone)
+	if !running && done > stepIndex(stepUserCreated) {
+		done = stepIndex(stepUserCreated)
+	}
+
+	if md.Step == stepStarted {
+		if err := m.writeMetadata(ctx, env.Name, md); err != nil {
+			return err
+		}
+	}
+
+	for _, step := range provisionSteps[done+1:] {
+		// The setup script runs once, when the environment is created, not
+		// each time its namespace is rebuilt
+		if step != stepSetupDone || !setupRan {
+			m.debugf(env.Name, "Provisioning %s: %s", env.Name, step)
+			if err := m.runProvisionStep(ctx, step, env, project, running); err != nil {
+				if ctx.Err() != nil {
+					m.undoInterruptedStep(ctx, step, env)
+				}
+				return fmt.Errorf("environment setup stopped before %s (run again to resume): %w", step, err)
+			}
+		}
+
+		md.Step = step
+		if err := m.writeMetadata(ctx, env.Name, md); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interruptCleanupTimeout bounds the cleanup after an interrupted step
+const interruptCleanupTimeout = 10 * time.Second
+
+// undoInterruptedStep cleans up after a step cancelled midway. Most steps
+// are safe to run again as they are; a namespace keeper started by an
+// interrupted namespace-up step would be orphaned by the retry, so it's
+// stopped. Failures are only logged, since the caller is already returning
+// the cancellation.
+func (m *Manager) undoInterruptedStep(ctx context.Context, step string, env *Environment) {
+	if step != stepNamespaceUp {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), interruptCleanupTimeout)
+	defer cancel()
+
+	pidFile := envDir(env.Name) + "/namespace.pid"
+	cmd := fmt.Sprintf(`pid=$(sudo cat %[1]s 2>/dev/null) && [ -n "$pid" ] && sudo kill "$pid"; sudo rm -f %[1]s`, pidFile)
+	m.debugf(env.Name, "Stopping namespace keeper of interrupted setup: %s", cmd)
+	if _, err := m.sshClient.ExecContext(ctx, cmd); err != nil {
+		m.warnf(env.Name, "failed to stop namespace keeper of %s: %v", env.Name, err)
+	}
+}
+
+// runProvisionStep performs one provisioning step. Steps tolerate work that
+// was already done, since a crash can happen after a step's work but before
+// its checkpoint is recorded.
+func (m *Manager) runProvisionStep(ctx context.Context, step string, env *Environment, project *config.Project, running bool) error {
+	switch step {
+	case stepPackagesInstalled:
+		if err := m.ensurePackages(ctx, env.ProjectPath, project); err != nil {
+			return err
+		}
+		if err := m.ensureTemplatePackages(ctx, env.Template); err != nil {
+			return err
+		}
+		return m.ensureLayers(ctx, project.Toolchains)
+
+	case stepUserCreated:
+		if _, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("id %s", env.Name)); err != nil {
+			if err := m.createUser(ctx, env.Name); err != nil {
+				return fmt.Errorf("failed to create user: %w", err)
+			}
+		}
+		if dir := env.workspaceDir(); dir != "" {
+			return m.createWorkspace(ctx, env.Name, dir)
+		}
+		return nil
+
+	case stepNamespaceUp:
+		if running {
+			return nil
+		}
+		if _, err := m.sshClient.ExecContext(ctx, clearNamespaceCommand(env.Name)); err != nil {
+			return fmt.Errorf("failed to remove stale namespace PID file: %w", err)
+		}
+		_, err := m.startNamespace(ctx, env)
+		return err
+
+	case stepMountsDone:
+		// Toolchains added to the project since the layers were built
+		if err := m.ensureLayers(ctx, project.Toolchains); err != nil {
+			return err
+		}
+		output, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("sudo cat %s/namespace.pid", envDir(env.Name)))
+		if err != nil {
+			return fmt.Errorf("failed to read namespace PID: %w", err)
+		}
+		return m.setupNamespaceFilesystem(ctx, env, strings.TrimSpace(output), project)
+
+	case stepSetupDone:
+		if err := checkSetupScript(env); err != nil {
+			return err
+		}
+		if env.Template != nil && env.Template.Setup != "" {
+			if err := m.streamCommand(ctx, env.Name, templateSetupCommand(env)); err != nil {
+				return fmt.Errorf("setup script of template %s failed: %w", env.Template.Name, err)
+			}
+		}
+		if err := m.streamCommand(ctx, env.Name, SetupCommand(env)); err != nil {
+			return fmt.Errorf("setup script %s/%s failed: %w", config.ProjectDir, config.ProjectSetupFile, err)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown provisioning step %q", step)
+	}
+}
+
+// checkSetupScript refuses a setup script with Windows line endings, which
+// bash fails on with "$'\r': command not found" errors that don't say why.
+// Scripts are checked on the host, so VM workspaces aren't checked.
+func checkSetupScript(env *Environment) error {
+	if !env.Mount().HostProject() {
+		return nil
+	}
+	path := filepath.Join(env.ProjectPath, config.ProjectDir, config.ProjectSetupFile)
+	data, err := os.ReadFile(path) // #nosec G304 -- the project's own setup script
+	if err != nil {
+		// A missing script is skipped in the VM
+		return nil
+	}
+	if bytes.Contains(data, []byte("\r\n")) {
+		return fmt.Errorf("setup script %s has Windows (CRLF) line endings; convert it to LF, e.g. with dos2unix", path)
+	}
+	return nil
+}
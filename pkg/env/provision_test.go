@@ -0,0 +1,243 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+func TestStepIndex(t *testing.T) {
+	tests := []struct {
+		step         string
+		want         int
+		wantComplete bool
+	}{
+		{step: stepStarted, want: -1},
+		{step: stepPackagesInstalled, want: 0},
+		{step: stepNamespaceUp, want: 2},
+		{step: stepMountsDone, want: 3},
+		{step: stepSetupDone, want: 4, wantComplete: true},
+		{step: "", want: 4, wantComplete: true},
+		{step: "bogus", want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.step, func(t *testing.T) {
+			if got := stepIndex(tt.step); got != tt.want {
+				t.Errorf("stepIndex(%q) = %d, want %d", tt.step, got, tt.want)
+			}
+			md := &metadata{Step: tt.step}
+			if got := md.complete(); got != tt.wantComplete {
+				t.Errorf("complete() = %v, want %v", got, tt.wantComplete)
+			}
+		})
+	}
+}
+
+func TestProvision(t *testing.T) {
+	const (
+		envName   = "app-a1b2"
+		useradd   = "useradd"
+		unshare   = "sudo unshare --mount --pid --fork"
+		mountCmd  = "mount --bind"
+		setup     = "bash -eo pipefail .llima-box/setup.sh"
+		idCommand = "id " + envName
+	)
+	project := &config.Project{Toolchains: []config.Toolchain{{Name: "node", Install: "echo node"}}}
+
+	tests := []struct {
+		name      string
+		step      string
+		running   bool
+		userFound bool
+		wantRun   []string
+		wantSkip  []string
+		wantSteps []string
+	}{
+		{
+			name:      "new environment",
+			step:      stepStarted,
+			wantRun:   []string{useradd, unshare, mountCmd, setup},
+			wantSteps: provisionSteps,
+		},
+		{
+			name:      "interrupted after the namespace came up",
+			step:      stepNamespaceUp,
+			running:   true,
+			userFound: true,
+			wantRun:   []string{mountCmd, setup},
+			wantSkip:  []string{useradd, unshare},
+			wantSteps: []string{stepMountsDone, stepSetupDone},
+		},
+		{
+			name:      "interrupted before the setup script finished",
+			step:      stepMountsDone,
+			running:   true,
+			userFound: true,
+			wantRun:   []string{setup},
+			wantSkip:  []string{useradd, unshare, mountCmd},
+			wantSteps: []string{stepSetupDone},
+		},
+		{
+			name:      "interrupted after user creation was recorded",
+			step:      stepUserCreated,
+			userFound: true,
+			wantRun:   []string{unshare, mountCmd, setup},
+			wantSkip:  []string{useradd},
+			wantSteps: []string{stepNamespaceUp, stepMountsDone, stepSetupDone},
+		},
+		{
+			name:      "user created but not recorded",
+			step:      stepPackagesInstalled,
+			userFound: true,
+			wantRun:   []string{unshare, mountCmd, setup},
+			wantSkip:  []string{useradd},
+			wantSteps: []string{stepUserCreated, stepNamespaceUp, stepMountsDone, stepSetupDone},
+		},
+		{
+			name:      "complete environment after VM restart",
+			step:      stepSetupDone,
+			userFound: true,
+			wantRun:   []string{unshare, mountCmd},
+			wantSkip:  []string{useradd, setup},
+			wantSteps: []string{stepNamespaceUp, stepMountsDone, stepSetupDone},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			if !tt.userFound {
+				mock.setError(idCommand, fmt.Errorf("exit status 1"))
+			}
+			m := newManagerWithExecutor(mock)
+
+			env := &Environment{Name: envName, ProjectPath: t.TempDir()}
+			md := &metadata{ProjectPath: env.ProjectPath, Step: tt.step}
+			if err := m.provision(context.Background(), env, project, md, tt.running); err != nil {
+				t.Fatalf("provision failed: %v", err)
+			}
+			if md.Step != stepSetupDone {
+				t.Errorf("Step = %q, want %q", md.Step, stepSetupDone)
+			}
+
+			for _, want := range tt.wantRun {
+				if !calledWith(mock, want) {
+					t.Errorf("expected a command containing %q", want)
+				}
+			}
+			for _, skip := range tt.wantSkip {
+				if calledWith(mock, skip) {
+					t.Errorf("unexpected command containing %q", skip)
+				}
+			}
+
+			var recorded []string
+			for _, call := range mock.calls {
+				if strings.Contains(call, "metadata.json.tmp") {
+					for _, step := range provisionSteps {
+						if strings.Contains(call, `"step":"`+step+`"`) {
+							recorded = append(recorded, step)
+						}
+					}
+				}
+			}
+			if strings.Join(recorded, ",") != strings.Join(tt.wantSteps, ",") {
+				t.Errorf("recorded steps %v, want %v", recorded, tt.wantSteps)
+			}
+		})
+	}
+}
+
+func TestProvision_StopsAtFailedStep(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	mock.setError("id app-a1b2", fmt.Errorf("exit status 1"))
+	m := newManagerWithExecutor(mock)
+
+	env := &Environment{Name: "app-a1b2", ProjectPath: t.TempDir()}
+	mock.setError(createUserCommand(env.Name, DefaultShell), fmt.Errorf("exit status 9"))
+
+	md := &metadata{ProjectPath: env.ProjectPath, Step: stepStarted}
+	err := m.provision(context.Background(), env, &config.Project{}, md, false)
+	if err == nil || !strings.Contains(err.Error(), "run again to resume") {
+		t.Fatalf("expected resumable error, got: %v", err)
+	}
+	if md.Step != stepPackagesInstalled {
+		t.Errorf("Step = %q, want %q", md.Step, stepPackagesInstalled)
+	}
+	if calledWith(mock, "sudo unshare") {
+		t.Error("expected no namespace after a failed step")
+	}
+}
+
+func TestProvision_InterruptedNamespaceStopsKeeper(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	m := newManagerWithExecutor(mock)
+
+	env := &Environment{Name: "app-a1b2", ProjectPath: t.TempDir()}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mock.setError("sudo cat /envs/app-a1b2/namespace.pid 2>&1", context.Canceled)
+
+	md := &metadata{ProjectPath: env.ProjectPath, Step: stepUserCreated}
+	if err := m.provision(ctx, env, &config.Project{}, md, false); err == nil {
+		t.Fatal("expected an error")
+	}
+	if md.Step != stepUserCreated {
+		t.Errorf("Step = %q, want %q", md.Step, stepUserCreated)
+	}
+	if !calledWith(mock, `sudo kill "$pid"; sudo rm -f /envs/app-a1b2/namespace.pid`) {
+		t.Errorf("expected the keeper of the interrupted step to be stopped, got %v", mock.calls)
+	}
+}
+
+// calledWith reports whether any executed command contains substr
+func calledWith(mock *mockExecutor, substr string) bool {
+	for _, call := range mock.calls {
+		if strings.Contains(call, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCheckSetupScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		driver  string
+		wantErr bool
+	}{
+		{name: "no script"},
+		{name: "unix line endings", script: "#!/bin/bash\nnpm ci\n"},
+		{name: "windows line endings", script: "#!/bin/bash\r\nnpm ci\r\n", wantErr: true},
+		{name: "isolated workspace", script: "npm ci\r\n", driver: vmOnlyMount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.script != "" {
+				if err := os.MkdirAll(filepath.Join(dir, config.ProjectDir), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, config.ProjectDir, config.ProjectSetupFile), []byte(tt.script), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := checkSetupScript(&Environment{Name: "app-a1b2", ProjectPath: dir, Driver: tt.driver})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkSetupScript() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Reasons an environment is an orphan
+const (
+	// OrphanProjectMissing is an environment whose host project directory no
+	// longer exists
+	OrphanProjectMissing = "project directory no longer exists"
+
+	// OrphanKeeperDied is an environment whose namespace keeper died and
+	// couldn't be restarted
+	OrphanKeeperDied = "namespace keeper died and wasn't restarted"
+
+	// OrphanNoState is a leftover environment user account without an
+	// environment directory, e.g. from a deletion that was cut short
+	OrphanNoState = "user account without environment state"
+)
+
+// usersCommand lists the VM's user accounts with their home directories
+const usersCommand = "getent passwd | cut -d: -f1,6"
+
+// Orphan is an environment Prune would delete
+type Orphan struct {
+	// Environment is the orphaned environment. Accounts without state only
+	// have a name.
+	Environment *Environment
+
+	// Reason says why it's an orphan (one of the Orphan* constants)
+	Reason string
+}
+
+// Orphans finds environments that are no longer of use: those whose host
+// project directory is gone, whose namespace keeper died and wasn't
+// restarted when the VM booted, and environment user accounts left without
+// an environment directory. Paused environments and those being set up
+// only are if their project is gone; VM workspaces, whose project lives in
+// the VM, only are if their keeper died. Quarantined environments never are.
+func (m *Manager) Orphans(ctx context.Context) ([]Orphan, error) {
+	// List restarts the namespaces that died with a VM restart first, so
+	// keepers that are still dead afterwards really are broken
+	envs, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []Orphan
+	known := make(map[string]bool, len(envs))
+	for _, env := range envs {
+		known[env.Name] = true
+		if reason := orphanReason(env); reason != "" {
+			orphans = append(orphans, Orphan{Environment: env, Reason: reason})
+		}
+	}
+
+	output, err := m.sshClient.ExecContext(ctx, usersCommand)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		name, home, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || known[name] || !IsValidEnvironmentName(name) {
+			continue
+		}
+		if strings.HasPrefix(home, homeBase+"/") || strings.HasPrefix(home, "/home/") {
+			orphans = append(orphans, Orphan{Environment: &Environment{Name: name}, Reason: OrphanNoState})
+		}
+	}
+	return orphans, nil
+}
+
+// orphanReason returns why env is an orphan, or "" if it isn't
+func orphanReason(env *Environment) string {
+	// Quarantined environments are kept for investigation
+	if env.Status == StatusQuarantined {
+		return ""
+	}
+	if env.Mount().HostProject() && env.ProjectPath != "" {
+		if _, err := os.Stat(env.ProjectPath); errors.Is(err, os.ErrNotExist) {
+			return OrphanProjectMissing
+		}
+	}
+	if env.Status == StatusStopped || env.Status == StatusNeedsRepair {
+		return OrphanKeeperDied
+	}
+	return ""
+}
+
+// Prune deletes the environments Orphans finds, with their user accounts,
+// PID files, and /envs directories, and returns those it deleted. It
+// carries on past failures and reports them together.
+func (m *Manager) Prune(ctx context.Context) ([]Orphan, error) {
+	orphans, err := m.Orphans(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []Orphan
+	var failures []string
+	for _, o := range orphans {
+		if err := m.Delete(ctx, o.Environment.Name); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", o.Environment.Name, err))
+			continue
+		}
+		pruned = append(pruned, o)
+	}
+
+	if len(failures) > 0 {
+		return pruned, fmt.Errorf("failed to prune some environments: %s", strings.Join(failures, "; "))
+	}
+	return pruned, nil
+}
@@ -0,0 +1,66 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOrphans(t *testing.T) {
+	live := t.TempDir()
+	gone := filepath.Join(t.TempDir(), "deleted-project")
+
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	mock.setResponse(scanCommand, strings.Join([]string{
+		fmt.Sprintf("live-a1b2\trunning\t{\"projectPath\":%q}", live),
+		fmt.Sprintf("gone-c3d4\trunning\t{\"projectPath\":%q}", gone),
+		fmt.Sprintf("dead-e5f6\tneeds-repair\t{\"projectPath\":%q}", live),
+		fmt.Sprintf("paused-0a1b\tpaused\t{\"projectPath\":%q}", live),
+		"scratch-2c3d\tstopped\t{\"projectPath\":\"/work/scratch\",\"isolated\":true}",
+		"vmonly-4e5f\trunning\t{\"projectPath\":\"/work/vmonly\",\"isolated\":true}",
+		fmt.Sprintf("held-6c7d\tquarantined\t{\"projectPath\":%q}", gone),
+	}, "\n")+"\n")
+	mock.setResponse(usersCommand, "root:/root\nlima:/home/lima.linux\nlive-a1b2:/mnt/lima-llima-box-data/home/live-a1b2\nleft-6a7b:/mnt/lima-llima-box-data/home/left-6a7b\nsvc-8c9d:/var/lib/svc\n")
+
+	orphans, err := newManagerWithExecutor(mock).Orphans(context.Background())
+	if err != nil {
+		t.Fatalf("Orphans failed: %v", err)
+	}
+
+	var got []string
+	for _, o := range orphans {
+		got = append(got, o.Environment.Name+": "+o.Reason)
+	}
+	want := []string{
+		"gone-c3d4: " + OrphanProjectMissing,
+		"dead-e5f6: " + OrphanKeeperDied,
+		"scratch-2c3d: " + OrphanKeeperDied,
+		"left-6a7b: " + OrphanNoState,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got orphans:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPrune(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	mock.setResponse(scanCommand, "dead-e5f6\tstopped\t\nbusy-0a1b\tneeds-repair\t\n")
+	mock.setError("id busy-0a1b || [ -d /envs/busy-0a1b ]", fmt.Errorf("exit status 1"))
+
+	pruned, err := newManagerWithExecutor(mock).Prune(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "busy-0a1b") {
+		t.Errorf("expected the failed deletion to be reported, got %v", err)
+	}
+	if len(pruned) != 1 || pruned[0].Environment.Name != "dead-e5f6" {
+		t.Fatalf("expected dead-e5f6 to be pruned, got %v", pruned)
+	}
+	for _, c := range DeleteCommands("dead-e5f6", "") {
+		if mock.callCount(c.Script) != 1 {
+			t.Errorf("expected %q to run", c.Purpose)
+		}
+	}
+}
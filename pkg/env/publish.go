@@ -0,0 +1,29 @@
+package env
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/middlendian/llima-box/pkg/ssh"
+)
+
+// PublishHostPort makes a service listening on hostPort on the host's
+// loopback interface reachable inside the VM at localhost:vmPort. Every
+// environment shares the VM's network, so the address is the same in each
+// of them, such as localhost:11434 for a local LLM server. The port is
+// published until the returned forward is closed or the connection to the
+// VM is lost.
+func (m *Manager) PublishHostPort(ctx context.Context, vmPort, hostPort int) (*ssh.Forward, error) {
+	if err := m.ensureSSH(ctx); err != nil {
+		return nil, err
+	}
+
+	vmAddr := fmt.Sprintf("127.0.0.1:%d", vmPort)
+	hostAddr := fmt.Sprintf("localhost:%d", hostPort)
+	forward, err := m.sshClient.ForwardRemotePort(ctx, vmAddr, hostAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish host port %d: %w", hostPort, err)
+	}
+	m.debugf("", "Publishing %s on the host at %s in the VM", hostAddr, vmAddr)
+	return forward, nil
+}
@@ -0,0 +1,216 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// ErrQuarantined is returned for sessions and operations that would change a
+// quarantined environment
+var ErrQuarantined = errors.New("environment is quarantined")
+
+// exitQuarantined is the status a session exits with when its environment
+// is quarantined
+const exitQuarantined = 77
+
+// QuarantineRecord says why and when an environment was quarantined. It's
+// kept in the environment's metadata.
+type QuarantineRecord struct {
+	// Reason is what the user gave for the quarantine, if anything
+	Reason string `json:"reason,omitempty"`
+
+	// At is when the environment was quarantined
+	At time.Time `json:"at"`
+}
+
+// quarantinedPath returns the marker file of a quarantined environment.
+// Sessions don't start in environments with it, and recovery leaves them
+// alone after a VM restart.
+func quarantinedPath(envName string) string {
+	return envDir(envName) + "/quarantined"
+}
+
+// quarantineRulesPath returns the firewall rules file that keeps a
+// quarantined environment cut off across VM restarts
+func quarantineRulesPath(envName string) string {
+	return vm.FirewallRulesDir + "/quarantine-" + envName + ".nft"
+}
+
+// quarantineComment tags the firewall rule cutting off an environment
+func quarantineComment(envName string) string {
+	return "quarantine " + envName
+}
+
+// quarantineRule returns the nft command dropping all traffic of an
+// environment's user. It goes first in the output chain, so connections
+// that were already open are cut off too.
+func quarantineRule(envName string) string {
+	return fmt.Sprintf(`insert rule inet %s %s meta skuid %s counter drop comment "%s"`,
+		vm.FirewallTable, vm.FirewallOutputChain, envName, quarantineComment(envName))
+}
+
+// quarantineCheckScript returns the line starting a session that refuses
+// to enter a quarantined environment
+func quarantineCheckScript(envName string) string {
+	return fmt.Sprintf("if [ -e %s ]; then echo %s >&2; exit %d; fi",
+		quarantinedPath(envName), shellquote.Quote("llima-box: "+envName+" is quarantined"), exitQuarantined)
+}
+
+// ifNamespaceScript returns a script running cmd only if the named
+// environment's namespace keeper is alive. Stopped environments have no
+// namespace to change.
+func ifNamespaceScript(envName, cmd string) string {
+	return fmt.Sprintf(`if p=$(sudo cat %s 2>/dev/null) && [ -n "$p" ] && sudo kill -0 "$p" 2>/dev/null; then %s; fi`,
+		envDir(envName)+"/namespace.pid", cmd)
+}
+
+// readOnlyMountedScript returns a test succeeding if dir is itself mounted
+// read-only
+func readOnlyMountedScript(dir string) string {
+	return fmt.Sprintf("findmnt -rno OPTIONS --mountpoint %s | grep -q '^ro'", shellWord(dir))
+}
+
+// QuarantineCommands returns the commands quarantining env: it's marked
+// first, so no new session starts while the rest happens, then its processes
+// are stopped with SIGSTOP, its user's network traffic is dropped, and its
+// project directory is bind-mounted read-only over itself in its namespace.
+// Each command can run again after a partial quarantine.
+func QuarantineCommands(env *Environment) []RemoteCommand {
+	rule := quarantineRule(env.Name)
+	dir := env.dir()
+	return []RemoteCommand{
+		{
+			Purpose: "mark environment as quarantined",
+			Script:  fmt.Sprintf("sudo touch %s", quarantinedPath(env.Name)),
+		},
+		{
+			Purpose: "freeze environment processes",
+			Script:  fmt.Sprintf("sudo pkill -STOP -u %s; [ $? -le 1 ]", env.Name),
+		},
+		{
+			Purpose: "revoke network access",
+			Script: fmt.Sprintf(
+				"{ sudo nft list chain inet %[1]s %[2]s | grep -qF %[3]s || sudo nft %[4]s; } && printf '%%s\\n' %[4]s | sudo tee %[5]s >/dev/null",
+				vm.FirewallTable, vm.FirewallOutputChain, shellquote.Quote(`comment "`+quarantineComment(env.Name)+`"`), shellquote.Quote(rule), quarantineRulesPath(env.Name),
+			),
+		},
+		{
+			Purpose: "make workspace read-only",
+			Script: ifNamespaceScript(env.Name, NewRemoteRunner(env.Name).Script(fmt.Sprintf(
+				"%[2]s || { mount --bind %[1]s %[1]s && mount -o remount,bind,ro %[1]s; }", shellWord(dir), readOnlyMountedScript(dir),
+			))),
+		},
+	}
+}
+
+// ReleaseCommands returns the commands undoing QuarantineCommands, in
+// reverse order. The quarantine mark is cleared last, so a release cut short
+// can run again.
+func ReleaseCommands(env *Environment) []RemoteCommand {
+	dir := env.dir()
+	return []RemoteCommand{
+		{
+			Purpose: "make workspace writable",
+			Script:  ifNamespaceScript(env.Name, NewRemoteRunner(env.Name).Script(fmt.Sprintf("if %[2]s; then umount %[1]s; fi", shellWord(dir), readOnlyMountedScript(dir)))),
+		},
+		{
+			Purpose: "restore network access",
+			Script: fmt.Sprintf(
+				`sudo rm -f %[4]s && for h in $(sudo nft -a list chain inet %[1]s %[2]s | sed -n 's/.*comment "%[3]s" # handle \([0-9]*\)$/\1/p'); do sudo nft delete rule inet %[1]s %[2]s handle "$h" || exit 1; done`,
+				vm.FirewallTable, vm.FirewallOutputChain, quarantineComment(env.Name), quarantineRulesPath(env.Name),
+			),
+		},
+		{
+			Purpose: "resume environment processes",
+			Script:  fmt.Sprintf("sudo pkill -CONT -u %s; [ $? -le 1 ]", env.Name),
+		},
+		{
+			Purpose: "clear quarantine mark",
+			Script:  fmt.Sprintf("sudo rm -f %s", quarantinedPath(env.Name)),
+		},
+	}
+}
+
+// Quarantine freezes env's processes, revokes its network access, and
+// makes its project directory read-only, keeping everything else as it is
+// for investigation, e.g. after an agent did something alarming. The
+// environment is listed as quarantined, and no session starts in it, until
+// Release; it can still be deleted. reason is recorded in its metadata.
+func (m *Manager) Quarantine(ctx context.Context, env *Environment, reason string) error {
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+
+	unlock, err := m.locks.lock(ctx, env.Name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("[ -d %s ]", envDir(env.Name))); err != nil {
+		return fmt.Errorf("environment %s does not exist", env.Name)
+	}
+
+	m.probes.invalidate()
+	m.debugf(env.Name, "Quarantining %s", env.Name)
+	if err := m.runCommands(ctx, QuarantineCommands(env)); err != nil {
+		return err
+	}
+
+	// The environment is contained either way; the record only explains it
+	md, err := m.readMetadata(ctx, env.Name)
+	if err == nil {
+		md.Quarantine = &QuarantineRecord{Reason: reason, At: time.Now().UTC()}
+		err = m.writeMetadata(ctx, env.Name, md)
+	}
+	if err != nil {
+		m.warnf(env.Name, "failed to record the quarantine of %s: %v", env.Name, err)
+	}
+	return nil
+}
+
+// Release lifts the quarantine of env: its network access and writable
+// project directory are restored, and its processes continue where they
+// were stopped
+func (m *Manager) Release(ctx context.Context, env *Environment) error {
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+
+	unlock, err := m.locks.lock(ctx, env.Name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("[ -e %s ]", quarantinedPath(env.Name))); err != nil {
+		return fmt.Errorf("environment %s is not quarantined", env.Name)
+	}
+
+	m.probes.invalidate()
+	m.debugf(env.Name, "Releasing %s from quarantine", env.Name)
+
+	// The record goes first: a release cut short leaves the environment
+	// marked, so it can be run again
+	if md, err := m.readMetadata(ctx, env.Name); err == nil && md.Quarantine != nil {
+		md.Quarantine = nil
+		if err := m.writeMetadata(ctx, env.Name, md); err != nil {
+			return err
+		}
+	}
+	return m.runCommands(ctx, ReleaseCommands(env))
+}
+
+// checkNotQuarantined returns ErrQuarantined if the named environment is
+// quarantined
+func (m *Manager) checkNotQuarantined(ctx context.Context, envName string) error {
+	if _, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("[ ! -e %s ]", quarantinedPath(envName))); err != nil {
+		return fmt.Errorf("%w: %s (release it with 'llima-box quarantine --release' or delete it)", ErrQuarantined, envName)
+	}
+	return nil
+}
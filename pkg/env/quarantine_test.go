@@ -0,0 +1,96 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/ssh"
+)
+
+func TestGolden_Quarantine(t *testing.T) {
+	env := &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/my app"}
+	checkGolden(t, "quarantine", formatCommands(QuarantineCommands(env)))
+	checkGolden(t, "release", formatCommands(ReleaseCommands(env)))
+}
+
+func TestQuarantine(t *testing.T) {
+	env := &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/app"}
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	mock.setResponse(readMetadataCommand("app-a1b2"), `{"projectPath":"/Users/alice/app","step":"setup-done","version":2}`)
+
+	if err := newManagerWithExecutor(mock).Quarantine(context.Background(), env, "deleted the test suite"); err != nil {
+		t.Fatalf("Quarantine failed: %v", err)
+	}
+
+	for _, c := range QuarantineCommands(env) {
+		if mock.callCount(c.Script) != 1 {
+			t.Errorf("expected to %s", c.Purpose)
+		}
+	}
+	if !calledWith(mock, `"quarantine":{"reason":"deleted the test suite"`) {
+		t.Errorf("expected the quarantine to be recorded in the metadata, got %v", mock.calls)
+	}
+}
+
+func TestQuarantine_BlocksSessions(t *testing.T) {
+	env := &Environment{Name: "app-a1b2", ProjectPath: t.TempDir()}
+
+	t.Run("stop", func(t *testing.T) {
+		mock := newMockExecutor()
+		mock.allowUnexpected = true
+		mock.setError("[ ! -e /envs/app-a1b2/quarantined ]", fmt.Errorf("exit status 1"))
+
+		err := newManagerWithExecutor(mock).Stop(context.Background(), env.Name)
+		if !errors.Is(err, ErrQuarantined) {
+			t.Errorf("expected ErrQuarantined, got %v", err)
+		}
+		for _, c := range StopCommands(env.Name) {
+			if mock.callCount(c.Script) != 0 {
+				t.Errorf("expected not to %s", c.Purpose)
+			}
+		}
+	})
+
+	t.Run("enter", func(t *testing.T) {
+		mock := newMockExecutor()
+		mock.allowUnexpected = true
+		m := newManagerWithExecutor(mock)
+		project, err := loadProject(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd, err := EnterCommand(env, project, nil, EnterOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(cmd, quarantineCheckScript(env.Name)+"\n") {
+			t.Fatalf("expected the session to check for a quarantine first, got:\n%s", cmd)
+		}
+		mock.setError(cmd, &ssh.ExitError{Status: exitQuarantined})
+
+		if err := m.EnterNamespace(context.Background(), env, nil, EnterOptions{}); !errors.Is(err, ErrQuarantined) {
+			t.Errorf("expected ErrQuarantined, got %v", err)
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		mock := newMockExecutor()
+		mock.allowUnexpected = true
+		mock.setResponse(readMetadataCommand("app-a1b2"), fmt.Sprintf(`{"projectPath":%q,"step":"setup-done","quarantine":{"at":"2026-01-02T03:04:05Z"},"version":2}`, env.ProjectPath))
+
+		if _, err := newManagerWithExecutor(mock).create(context.Background(), env); !errors.Is(err, ErrQuarantined) {
+			t.Errorf("expected ErrQuarantined, got %v", err)
+		}
+	})
+}
+
+func TestParseScan_Quarantined(t *testing.T) {
+	envs := parseScan("app-a1b2\tquarantined\t{\"projectPath\":\"/Users/me/app\",\"quarantine\":{\"reason\":\"curl | sh\",\"at\":\"2026-01-02T03:04:05Z\"}}\n")
+	if len(envs) != 1 || envs[0].Status != StatusQuarantined || envs[0].Quarantine == nil || envs[0].Quarantine.Reason != "curl | sh" {
+		t.Fatalf("expected a quarantined environment with its reason, got %+v", envs)
+	}
+}
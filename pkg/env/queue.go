@@ -0,0 +1,151 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultMaxSetups is how many environments are set up at once when
+// Options.MaxSetups isn't set
+const DefaultMaxSetups = 2
+
+// setupSlotLock and setupTicketPrefix name the lock files of setupQueue
+const (
+	setupSlotLock     = "setup-slot-%d"
+	setupTicketPrefix = "setup-queue-"
+)
+
+// setupQueue bounds how many environment setups and VM starts run at once
+// across llima-box processes, so a burst of agents asking for environments
+// doesn't provision them all in parallel and starve the VM. Each setup holds
+// one of max slot locks. Waiting processes hold a ticket lock named by their
+// arrival time and take a slot only when fewer than max tickets are ahead of
+// them, so they're served in order; a dead process's ticket is free and
+// removed by the next waiter.
+//
+// Like locker, a nil queue, or one whose locker is disabled, doesn't queue.
+type setupQueue struct {
+	locks *locker
+	max   int
+
+	// progress, if set, is told the queue position while waiting
+	progress ProgressFunc
+}
+
+// newSetupQueue returns a queue keeping its locks with locks, allowing max
+// setups at once. A negative max doesn't queue; zero allows
+// DefaultMaxSetups.
+func newSetupQueue(locks *locker, max int, progress ProgressFunc) *setupQueue {
+	if max == 0 {
+		max = DefaultMaxSetups
+	}
+	return &setupQueue{locks: locks, max: max, progress: progress}
+}
+
+// acquire waits for a setup slot for name, for as long as the locker
+// waits for busy locks. The returned function frees the slot. Even without
+// anyone waiting, a ticket is taken first, so a process arriving later can't
+// take the slot a waiting one is about to get.
+func (q *setupQueue) acquire(ctx context.Context, name string) (func(), error) {
+	if q == nil || q.max < 0 || q.locks == nil || q.locks.dir == "" {
+		return func() {}, nil
+	}
+
+	ticket := fmt.Sprintf("%s%020d-%d", setupTicketPrefix, time.Now().UnixNano(), os.Getpid())
+	unlockTicket, _, err := q.locks.tryLock(ticket)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		unlockTicket()
+		_ = os.Remove(filepath.Join(q.locks.dir, ticket+".lock"))
+	}()
+
+	var deadline <-chan time.Time
+	if q.locks.wait > 0 {
+		timer := time.NewTimer(q.locks.wait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	reported := -1
+	for {
+		ahead, err := q.ahead(ticket)
+		if err != nil {
+			return nil, err
+		}
+		if ahead < q.max {
+			release, ok, err := q.trySlot()
+			if err != nil || ok {
+				return release, err
+			}
+		}
+		if q.locks.wait < 0 {
+			return nil, fmt.Errorf("%w: %d environment setups are already running", ErrBusy, q.max)
+		}
+		if ahead != reported {
+			msg := fmt.Sprintf("Waiting for one of %d running setups to finish before setting up %s", q.max, name)
+			if ahead > 0 {
+				msg = fmt.Sprintf("Waiting to set up %s: %d ahead in the queue, %d running", name, ahead, q.max)
+			}
+			q.progress.emit(Event{Level: EventDebug, Environment: name, Message: msg})
+			reported = ahead
+		}
+
+		select {
+		case <-deadline:
+			return nil, fmt.Errorf("%w: still waiting to set up %s after %s", ErrBusy, name, q.locks.wait)
+		case <-ctx.Done():
+			return nil, fmt.Errorf("gave up waiting to set up %s: %w", name, ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// trySlot takes a free slot, if there is one
+func (q *setupQueue) trySlot() (func(), bool, error) {
+	for i := 0; i < q.max; i++ {
+		release, ok, err := q.locks.tryLock(fmt.Sprintf(setupSlotLock, i))
+		if err != nil || ok {
+			return release, ok, err
+		}
+	}
+	return nil, false, nil
+}
+
+// ahead returns how many live tickets arrived before ticket. Tickets whose
+// process is gone are removed.
+func (q *setupQueue) ahead(ticket string) (int, error) {
+	entries, err := os.ReadDir(q.locks.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read setup queue: %w", err)
+	}
+	var tickets []string
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".lock")
+		if strings.HasPrefix(name, setupTicketPrefix) && name < ticket {
+			tickets = append(tickets, name)
+		}
+	}
+	sort.Strings(tickets)
+
+	ahead := 0
+	for _, t := range tickets {
+		unlock, free, err := q.locks.tryLock(t)
+		if err != nil {
+			return 0, err
+		}
+		if !free {
+			ahead++
+			continue
+		}
+		// Left behind by a process that died waiting
+		unlock()
+		_ = os.Remove(filepath.Join(q.locks.dir, t+".lock"))
+	}
+	return ahead, nil
+}
@@ -0,0 +1,84 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetupQueue(t *testing.T) {
+	dir := t.TempDir()
+	q := newSetupQueue(&locker{dir: dir}, 1, nil)
+
+	release, err := q.acquire(context.Background(), "app-a1b2")
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	// The only slot is taken
+	var events []Event
+	waiting := newSetupQueue(&locker{dir: dir, wait: 3 * lockPollInterval}, 1, func(e Event) { events = append(events, e) })
+	if _, err := waiting.acquire(context.Background(), "other-c3d4"); !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected ErrBusy while the slot is taken, got %v", err)
+	}
+	if len(events) != 1 || events[0].Environment != "other-c3d4" || !strings.Contains(events[0].Message, "Waiting") {
+		t.Errorf("expected one report of the wait, got %+v", events)
+	}
+	noWait := newSetupQueue(&locker{dir: dir, wait: -1}, 1, nil)
+	if _, err := noWait.acquire(context.Background(), "other-c3d4"); !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected ErrBusy without waiting, got %v", err)
+	}
+
+	release()
+	release, err = noWait.acquire(context.Background(), "other-c3d4")
+	if err != nil {
+		t.Fatalf("acquire after release failed: %v", err)
+	}
+	release()
+
+	// Waiters leave no tickets behind
+	if matches, _ := filepath.Glob(filepath.Join(dir, setupTicketPrefix+"*")); len(matches) != 0 {
+		t.Errorf("expected no tickets left, got %v", matches)
+	}
+}
+
+func TestSetupQueue_Ahead(t *testing.T) {
+	dir := t.TempDir()
+	q := newSetupQueue(&locker{dir: dir}, 2, nil)
+
+	// A ticket held by a waiting process counts; one left by a process that
+	// died doesn't, and is removed
+	unlock, _, err := q.locks.tryLock(setupTicketPrefix + "00000000000000000001-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	stale := filepath.Join(dir, setupTicketPrefix+"00000000000000000002-20.lock")
+	if err := os.WriteFile(stale, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ahead, err := q.ahead(setupTicketPrefix + "00000000000000000003-30")
+	if err != nil {
+		t.Fatalf("ahead failed: %v", err)
+	}
+	if ahead != 1 {
+		t.Errorf("expected one ticket ahead, got %d", ahead)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected the stale ticket to be removed, got %v", err)
+	}
+}
+
+func TestSetupQueue_Disabled(t *testing.T) {
+	for _, q := range []*setupQueue{nil, newSetupQueue(nil, 0, nil), newSetupQueue(&locker{dir: t.TempDir()}, -1, nil)} {
+		release, err := q.acquire(context.Background(), "app-a1b2")
+		if err != nil {
+			t.Fatalf("acquire failed: %v", err)
+		}
+		release()
+	}
+}
@@ -0,0 +1,291 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/ssh"
+)
+
+// Status describes whether an environment's namespace is usable
+type Status string
+
+const (
+	// StatusRunning means the namespace keeper process is alive
+	StatusRunning Status = "running"
+
+	// StatusStopped means the keeper process is gone (e.g. after a VM restart)
+	// and hasn't been restarted yet
+	StatusStopped Status = "stopped"
+
+	// StatusNeedsRepair means the keeper couldn't be restarted automatically.
+	// Entering the environment with `shell` from its project rebuilds it.
+	StatusNeedsRepair Status = "needs-repair"
+
+	// StatusProvisioning means creating the environment hasn't finished,
+	// either because it's in progress or because it was interrupted. Entering
+	// the environment resumes provisioning.
+	StatusProvisioning Status = "provisioning"
+
+	// StatusPaused means the environment was stopped with Stop. Its files are
+	// kept; Resume, or entering it with shell, restarts it.
+	StatusPaused Status = "paused"
+
+	// StatusQuarantined means the environment was quarantined with
+	// Quarantine. Its processes are frozen and no session starts in it until
+	// it's released.
+	StatusQuarantined Status = "quarantined"
+
+	// StatusCheckpointed means the environment's processes were saved and
+	// stopped with CheckpointProcesses. RestoreProcesses brings them back;
+	// Resume, or entering it with shell, starts it afresh instead.
+	StatusCheckpointed Status = "checkpointed"
+)
+
+// recoveryMarker is created once stale environments have been handled for
+// the current VM boot. /run is a tmpfs, so it disappears on restart.
+const recoveryMarker = "/run/llima-box/recovered"
+
+// needsRepairPath returns the marker file flagging an environment whose
+// namespace couldn't be restarted
+func needsRepairPath(envName string) string {
+	return envDir(envName) + "/needs-repair"
+}
+
+// scanCommand prints one tab-separated line per environment directory:
+// name, status, the metadata JSON (empty if missing), and the modification
+// time of the heartbeat file in seconds since the epoch (empty if missing)
+const scanCommand = `for d in /envs/*/; do ` +
+	`[ -d "$d" ] || continue; ` +
+	`n=$(basename "$d"); s=stopped; ` +
+	`[ -e "$d/needs-repair" ] && s=needs-repair; ` +
+	`[ -e "$d/paused" ] && s=paused; ` +
+	`sudo test -e "$d/processes/inventory.img" && s=checkpointed; ` +
+	`p=$(sudo cat "$d/namespace.pid" 2>/dev/null) && [ -n "$p" ] && sudo kill -0 "$p" 2>/dev/null && s=running; ` +
+	`[ -e "$d/quarantined" ] && s=quarantined; ` +
+	`printf '%s\t%s\t%s\t%s\n' "$n" "$s" "$(sudo cat "$d/metadata.json" 2>/dev/null | tr -d '\n')" "$(stat -c %Y "$d/heartbeat" 2>/dev/null)"; ` +
+	`done`
+
+// scanEnvironments reports every environment in the VM with its status and,
+// when metadata is available, its project path
+func (m *Manager) scanEnvironments(ctx context.Context) ([]*Environment, error) {
+	output, err := m.sshClient.ExecContext(ctx, scanCommand)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan environments: %w", err)
+	}
+	return parseScan(output), nil
+}
+
+// Scan lists the environments in the VM over an existing connection. Unlike
+// List it never restarts dead namespaces, so monitoring sees the VM as it is.
+func Scan(ctx context.Context, client *ssh.Client) ([]*Environment, error) {
+	m := &Manager{sshClient: client}
+	return m.scanEnvironments(ctx)
+}
+
+// parseScan parses the output of scanCommand
+func parseScan(output string) []*Environment {
+	var envs []*Environment
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, "\t", 4)
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+
+		env := &Environment{
+			Name:   fields[0],
+			Status: Status(fields[1]),
+		}
+		if len(fields) >= 3 && fields[2] != "" {
+			if md, err := parseMetadata(fields[2]); err == nil {
+				env.ProjectPath = md.ProjectPath
+				env.Driver = md.Mount
+				env.Template = md.Template
+				env.Quarantine = md.Quarantine
+				if md.Resources != nil {
+					env.Reserved = *md.Resources
+				}
+				if !md.complete() && env.Status != StatusNeedsRepair {
+					env.Status = StatusProvisioning
+				}
+			}
+		}
+		if len(fields) == 4 {
+			env.LastActive = parseHeartbeat(fields[3])
+		}
+		envs = append(envs, env)
+	}
+	return envs
+}
+
+// RepairResult describes what RepairStale did with one environment
+type RepairResult struct {
+	// Name is the environment name
+	Name string
+
+	// Restarted is true if the namespace keeper was restarted
+	Restarted bool
+
+	// Err explains why the environment was marked as needing repair
+	Err error
+}
+
+// RepairStale finds environments whose namespace keeper has died, typically
+// because the VM restarted, and restarts them from their metadata.
+// Environments that can't be restarted are marked as needing repair so List
+// reports them accurately.
+func (m *Manager) RepairStale(ctx context.Context) ([]RepairResult, error) {
+	if err := m.ensureSSH(ctx); err != nil {
+		return nil, err
+	}
+	return m.repairStale(ctx)
+}
+
+func (m *Manager) repairStale(ctx context.Context) ([]RepairResult, error) {
+	envs, err := m.scanEnvironments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []RepairResult
+	for _, env := range envs {
+		if env.Status != StatusStopped {
+			continue
+		}
+
+		result, err := m.repairEnvironment(ctx, env.Name)
+		if err != nil {
+			return results, err
+		}
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
+
+	return results, nil
+}
+
+// repairEnvironment restarts a stopped environment under its lock. It returns
+// nil if another process restarted or deleted the environment in the
+// meantime.
+func (m *Manager) repairEnvironment(ctx context.Context, envName string) (*RepairResult, error) {
+	unlock, err := m.locks.lock(ctx, envName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	m.probes.invalidate()
+	checkCmd := fmt.Sprintf("[ -d %s ]", envDir(envName))
+	if _, err := m.sshClient.ExecContext(ctx, checkCmd); err != nil {
+		return nil, nil
+	}
+	if running, _ := m.Exists(ctx, envName); running {
+		return nil, nil
+	}
+
+	done, err := m.journal.begin(journalEntry{Op: opRepair, Env: envName})
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	result := &RepairResult{Name: envName}
+	if err := m.restartEnvironment(ctx, envName); err != nil {
+		result.Err = err
+		if markErr := m.markNeedsRepair(ctx, envName); markErr != nil {
+			return nil, markErr
+		}
+	} else {
+		result.Restarted = true
+	}
+	return result, nil
+}
+
+// recoverAfterBoot runs RepairStale once per VM boot. Failures are reported
+// but don't prevent using the VM.
+func (m *Manager) recoverAfterBoot(ctx context.Context) {
+	markerCmd := fmt.Sprintf("[ -e %s ]", recoveryMarker)
+	if _, err := m.sshClient.ExecContext(ctx, markerCmd); err == nil {
+		return
+	}
+
+	// Concurrent CLIs wait for whichever one recovers first
+	unlock, err := m.locks.lock(ctx, recoveryLockName)
+	if err != nil {
+		m.warnf("", "failed to recover environments: %v", err)
+		return
+	}
+	defer unlock()
+	if _, err := m.sshClient.ExecContext(ctx, markerCmd); err == nil {
+		return
+	}
+
+	results, err := m.repairStale(ctx)
+	if err != nil {
+		m.warnf("", "failed to recover environments: %v", err)
+		return
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			m.warnf(r.Name, "environment %s needs repair: %v", r.Name, r.Err)
+		} else {
+			m.debugf(r.Name, "Restarted namespace for %s", r.Name)
+		}
+	}
+
+	markCmd := fmt.Sprintf("sudo mkdir -p /run/llima-box && sudo touch %s", recoveryMarker)
+	if _, err := m.sshClient.ExecContext(ctx, markCmd); err != nil {
+		m.warnf("", "failed to record environment recovery: %v", err)
+	}
+}
+
+// restartEnvironment restarts the namespace of an existing environment using
+// its stored metadata
+func (m *Manager) restartEnvironment(ctx context.Context, envName string) error {
+	md, err := m.readMetadata(ctx, envName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("id %s", envName)); err != nil {
+		return fmt.Errorf("user account %s is missing", envName)
+	}
+
+	return m.restartNamespace(ctx, md.environment(envName))
+}
+
+// restartNamespace replaces a dead namespace keeper for an environment whose
+// user account still exists
+func (m *Manager) restartNamespace(ctx context.Context, env *Environment) error {
+	project, err := loadProject(env)
+	if err != nil {
+		return err
+	}
+	if err := m.ensurePackages(ctx, env.ProjectPath, project); err != nil {
+		return err
+	}
+	if err := m.ensureLayers(ctx, project.Toolchains); err != nil {
+		return err
+	}
+
+	if _, err := m.sshClient.ExecContext(ctx, clearNamespaceCommand(env.Name)); err != nil {
+		return fmt.Errorf("failed to remove stale namespace PID file: %w", err)
+	}
+
+	if err := m.createNamespace(ctx, env, project); err != nil {
+		return fmt.Errorf("failed to create namespace: %w", err)
+	}
+
+	return nil
+}
+
+// markNeedsRepair flags an environment whose namespace couldn't be restarted
+func (m *Manager) markNeedsRepair(ctx context.Context, envName string) error {
+	cmd := fmt.Sprintf("sudo rm -f %s/namespace.pid && sudo touch %s", envDir(envName), needsRepairPath(envName))
+	if _, err := m.sshClient.ExecContext(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to mark %s as needing repair: %w", envName, err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+func TestParseScan(t *testing.T) {
+	output := "app-a1b2\trunning\t{\"projectPath\":\"/Users/me/app\",\"createdAt\":\"2025-01-01T00:00:00Z\"}\n" +
+		"old-c3d4\tstopped\t\n" +
+		"web-e5f6\tneeds-repair\tnot json\n" +
+		"idle-0a0b\tpaused\t\n" +
+		"used-1c2d\trunning\t\t1760000000\n" +
+		"\n"
+
+	envs := parseScan(output)
+
+	want := []Environment{
+		{Name: "app-a1b2", Status: StatusRunning, ProjectPath: "/Users/me/app", Driver: config.WorkspaceBind},
+		{Name: "old-c3d4", Status: StatusStopped},
+		{Name: "web-e5f6", Status: StatusNeedsRepair},
+		{Name: "idle-0a0b", Status: StatusPaused},
+		{Name: "used-1c2d", Status: StatusRunning, LastActive: time.Unix(1760000000, 0)},
+	}
+	if len(envs) != len(want) {
+		t.Fatalf("parseScan() returned %d environments, want %d", len(envs), len(want))
+	}
+	for i, w := range want {
+		if *envs[i] != w {
+			t.Errorf("parseScan()[%d] = %+v, want %+v", i, *envs[i], w)
+		}
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{name: "valid", data: `{"projectPath":"/Users/me/app"}` + "\n", want: "/Users/me/app"},
+		{name: "missing path", data: `{}`, wantErr: true},
+		{name: "invalid", data: `{`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := parseMetadata(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMetadata() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && md.ProjectPath != tt.want {
+				t.Errorf("parseMetadata() path = %q, want %q", md.ProjectPath, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepairStale(t *testing.T) {
+	projectPath := t.TempDir()
+	metadataJSON := fmt.Sprintf(`{"projectPath":%q}`, projectPath)
+
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	mock.setResponse(scanCommand, "live-a1b2\trunning\t\n"+
+		"ok-c3d4\tstopped\t"+metadataJSON+"\n"+
+		"lost-e5f6\tstopped\t\n"+
+		"broken-0a0b\tneeds-repair\t\n"+
+		"idle-7c8d\tpaused\t"+metadataJSON+"\n")
+	mock.setResponse(readMetadataCommand("ok-c3d4"), metadataJSON)
+	mock.setResponse(readMetadataCommand("lost-e5f6"), "")
+	mock.setError(existsCommand("ok-c3d4"), fmt.Errorf("exit status 1"))
+	mock.setError(existsCommand("lost-e5f6"), fmt.Errorf("exit status 1"))
+
+	m := newManagerWithExecutor(mock)
+	results, err := m.RepairStale(context.Background())
+	if err != nil {
+		t.Fatalf("RepairStale failed: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("RepairStale() returned %d results, want 2", len(results))
+	}
+	if results[0].Name != "ok-c3d4" || !results[0].Restarted || results[0].Err != nil {
+		t.Errorf("results[0] = %+v, want ok-c3d4 restarted", results[0])
+	}
+	if results[1].Name != "lost-e5f6" || results[1].Restarted || results[1].Err == nil {
+		t.Errorf("results[1] = %+v, want lost-e5f6 needing repair", results[1])
+	}
+
+	if mock.callCount(StartNamespaceCommands("ok-c3d4")[1].Script) != 1 {
+		t.Error("expected namespace keeper to be restarted for ok-c3d4")
+	}
+	if mock.callCount("sudo rm -f /envs/lost-e5f6/namespace.pid && sudo touch /envs/lost-e5f6/needs-repair") != 1 {
+		t.Error("expected lost-e5f6 to be marked as needing repair")
+	}
+	for _, call := range mock.calls {
+		if call == "sudo mkdir -p /envs/live-a1b2" || call == "sudo touch /envs/broken-0a0b/needs-repair" || strings.Contains(call, "idle-7c8d") {
+			t.Errorf("unexpected command for environment that needs no recovery: %s", call)
+		}
+	}
+}
+
+func TestRepairStale_RestartedConcurrently(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	mock.setResponse(scanCommand, "ok-c3d4\tstopped\t{\"projectPath\":\"/p\"}\n")
+
+	// Another process restarted the namespace between the scan and the lock
+	m := newManagerWithExecutor(mock)
+	results, err := m.RepairStale(context.Background())
+	if err != nil {
+		t.Fatalf("RepairStale failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("RepairStale() = %+v, want no results", results)
+	}
+	if mock.callCount(readMetadataCommand("ok-c3d4")) != 0 {
+		t.Error("expected running environment not to be restarted again")
+	}
+}
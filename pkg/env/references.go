@@ -0,0 +1,133 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+// ReferenceMountRoot is where reference directories appear in environments
+const ReferenceMountRoot = "/mnt/ref"
+
+// Reference is a host directory mounted read-only into every environment at
+// ReferenceMountRoot/<Name>, such as a shared datasets folder or a sibling
+// repository
+type Reference struct {
+	// Name is the directory name under ReferenceMountRoot
+	Name string
+
+	// Path is the host directory ("~/" is expanded). It must be shared with
+	// the VM and pass the same safety checks as project directories.
+	Path string
+}
+
+// readOnlyBindScript returns a script bind-mounting src read-only at dst,
+// unless something is already mounted there
+func readOnlyBindScript(src, dst string) string {
+	return fmt.Sprintf(
+		"mountpoint -q %[2]s || { mkdir -p %[2]s && mount --bind %[1]s %[2]s && mount -o remount,bind,ro %[2]s; }",
+		shellWord(src), shellWord(dst),
+	)
+}
+
+// referenceMount is a resolved Reference
+type referenceMount struct {
+	name   string
+	vmPath string
+}
+
+// references returns the references mounted into env: the configured ones,
+// followed by the mounts of the template env was created from. A configured
+// reference hides a template mount of the same name.
+func (m *Manager) references(env *Environment) []Reference {
+	if env.Template == nil || len(env.Template.Mounts) == 0 {
+		return m.options.References
+	}
+	refs := make([]Reference, 0, len(m.options.References)+len(env.Template.Mounts))
+	refs = append(refs, m.options.References...)
+	for _, mount := range env.Template.Mounts {
+		refs = append(refs, Reference{Name: mount.MountName(), Path: mount.Path})
+	}
+	return refs
+}
+
+// referenceMounts resolves refs to the VM paths to mount. Each must be a
+// directory that's shared with the VM and that could be a project directory.
+func (m *Manager) referenceMounts(refs []Reference) ([]referenceMount, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	mounts := make([]referenceMount, 0, len(refs))
+	for _, ref := range refs {
+		hostPath, err := m.paths.Canonical(config.ExpandHome(ref.Path, home))
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(hostPath); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("reference %s: %s is not a directory", ref.Name, hostPath)
+		}
+		if err := m.checkProjectPath(hostPath); err != nil {
+			return nil, fmt.Errorf("reference %s: %w", ref.Name, err)
+		}
+		vmPath, err := m.paths.ToVM(hostPath)
+		if err != nil {
+			return nil, fmt.Errorf("reference %s: %w", ref.Name, err)
+		}
+		mounts = append(mounts, referenceMount{name: ref.Name, vmPath: vmPath})
+	}
+	return mounts, nil
+}
+
+// referenceMountCommands returns the commands bind-mounting env's reference
+// directories read-only into the namespace held by pid. References already
+// mounted are left alone. VM workspaces don't get them, since they hide host
+// files.
+func (m *Manager) referenceMountCommands(env *Environment, pid string) ([]RemoteCommand, error) {
+	refs := m.references(env)
+	if !env.Mount().HostProject() || len(refs) == 0 {
+		return nil, nil
+	}
+
+	mounts, err := m.referenceMounts(refs)
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := make([]RemoteCommand, 0, len(mounts))
+	for _, ref := range mounts {
+		cmds = append(cmds, RemoteCommand{
+			Purpose: "mount reference " + ref.name,
+			Script:  pidRunner(pid).Script(readOnlyBindScript(ref.vmPath, ReferenceMountRoot+"/"+ref.name)),
+		})
+	}
+	return cmds, nil
+}
+
+// mountReferences mounts env's reference directories into the namespace
+// held by pid
+func (m *Manager) mountReferences(ctx context.Context, env *Environment, pid string) error {
+	cmds, err := m.referenceMountCommands(env, pid)
+	if err != nil {
+		return err
+	}
+	return m.runCommands(ctx, cmds)
+}
+
+// syncReferences mounts references added to the configuration since env's
+// namespace was set up
+func (m *Manager) syncReferences(ctx context.Context, env *Environment) error {
+	if !env.Mount().HostProject() || len(m.references(env)) == 0 {
+		return nil
+	}
+
+	output, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("sudo cat %s/namespace.pid", envDir(env.Name)))
+	if err != nil {
+		return fmt.Errorf("failed to read namespace PID: %w", err)
+	}
+	return m.mountReferences(ctx, env, strings.TrimSpace(output))
+}
@@ -0,0 +1,123 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/env/templates"
+)
+
+func TestMountReferences(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if resolved, err := filepath.EvalSymlinks(home); err == nil {
+		home = resolved
+	}
+	for _, dir := range []string{"datasets", "src/api", ".ssh"} {
+		if err := os.MkdirAll(filepath.Join(home, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(home, "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		refs       []Reference
+		template   *templates.Template
+		driver     string
+		wantMounts []string
+		wantErr    string
+		unsafe     bool
+	}{
+		{
+			name: "mounts each reference read-only",
+			refs: []Reference{
+				{Name: "datasets", Path: "~/datasets"},
+				{Name: "api", Path: filepath.Join(home, "src", "api")},
+			},
+			wantMounts: []string{
+				"mount --bind " + filepath.Join(home, "datasets") + " /mnt/ref/datasets && mount -o remount,bind,ro /mnt/ref/datasets",
+				"mount --bind " + filepath.Join(home, "src", "api") + " /mnt/ref/api && mount -o remount,bind,ro /mnt/ref/api",
+			},
+		},
+		{
+			name:     "template mounts follow the configured references",
+			refs:     []Reference{{Name: "datasets", Path: "~/datasets"}},
+			template: &templates.Template{Name: "api", Mounts: []templates.Mount{{Path: "~/src/api"}, {Name: "datasets", Path: "~/src"}}},
+			wantMounts: []string{
+				"mount --bind " + filepath.Join(home, "datasets") + " /mnt/ref/datasets && mount -o remount,bind,ro /mnt/ref/datasets",
+				"mount --bind " + filepath.Join(home, "src", "api") + " /mnt/ref/api && mount -o remount,bind,ro /mnt/ref/api",
+				"mount --bind " + filepath.Join(home, "src") + " /mnt/ref/datasets && mount -o remount,bind,ro /mnt/ref/datasets",
+			},
+		},
+		{
+			name:   "isolated workspaces get no references",
+			refs:   []Reference{{Name: "datasets", Path: "~/datasets"}},
+			driver: vmOnlyMount,
+		},
+		{
+			name:    "missing directory",
+			refs:    []Reference{{Name: "gone", Path: "~/gone"}},
+			wantErr: "reference gone: " + filepath.Join(home, "gone") + " is not a directory",
+		},
+		{
+			name:    "file instead of directory",
+			refs:    []Reference{{Name: "notes", Path: "~/notes.txt"}},
+			wantErr: "is not a directory",
+		},
+		{
+			name:   "denied directory",
+			refs:   []Reference{{Name: "keys", Path: "~/.ssh"}},
+			unsafe: true,
+		},
+		{
+			name:   "home directory",
+			refs:   []Reference{{Name: "home", Path: home}},
+			unsafe: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			m := newManagerWithExecutor(mock)
+			m.options.References = tt.refs
+			env := &Environment{Name: "app-a1b2", ProjectPath: filepath.Join(home, "app"), Driver: tt.driver, Template: tt.template}
+
+			err := m.mountReferences(t.Context(), env, "4242")
+			switch {
+			case tt.unsafe:
+				if !errors.Is(err, ErrUnsafeProjectPath) {
+					t.Fatalf("expected ErrUnsafeProjectPath, got: %v", err)
+				}
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+				}
+			case err != nil:
+				t.Fatalf("mountReferences failed: %v", err)
+			}
+			if tt.unsafe || tt.wantErr != "" {
+				if len(mock.calls) != 0 {
+					t.Errorf("expected nothing to be mounted, got %v", mock.calls)
+				}
+				return
+			}
+
+			if len(mock.calls) != len(tt.wantMounts) {
+				t.Fatalf("expected %d commands, got %v", len(tt.wantMounts), mock.calls)
+			}
+			for _, want := range tt.wantMounts {
+				if !calledWith(mock, want) {
+					t.Errorf("expected a command containing %q, got %v", want, mock.calls)
+				}
+			}
+		})
+	}
+}
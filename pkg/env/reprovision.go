@@ -0,0 +1,291 @@
+package env
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+// ProvisioningConfig is what an environment is provisioned from in its
+// project configuration: the packages imported from the Dockerfile, the
+// toolchains, and the variables its login profile exports. It's recorded in
+// the environment's metadata, so later changes can be applied on their own.
+type ProvisioningConfig struct {
+	// Packages are the apt packages imported from the project's Dockerfile
+	Packages []string `json:"packages,omitempty"`
+
+	// Toolchains maps toolchain names to the layers built for them, which
+	// change with the install script
+	Toolchains map[string]string `json:"toolchains,omitempty"`
+
+	// Env holds the variables the environment's profile exports
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// Hash returns a digest of the configuration. Equal configurations have the
+// same hash whatever the order of their packages.
+func (c *ProvisioningConfig) Hash() string {
+	sorted := *c
+	sorted.Packages = slices.Sorted(slices.Values(c.Packages))
+	data, _ := json.Marshal(sorted) // maps are encoded in key order
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ProvisioningChange is how a project's provisioning configuration changed
+// since its environment was set up or last updated
+type ProvisioningChange struct {
+	// AddedPackages are installed by Apply
+	AddedPackages []string
+
+	// RemovedPackages stay installed; packages are shared by the whole VM
+	RemovedPackages []string
+
+	// Toolchains are the toolchains added or whose install script changed.
+	// Apply builds and mounts them.
+	Toolchains []string
+
+	// RemovedToolchains are unmounted by Apply
+	RemovedToolchains []string
+
+	// Env names the profile variables that were added, changed, or removed.
+	// Apply rewrites the profile; sessions started afterwards see them.
+	Env []string
+
+	// from and to are the configurations compared
+	from, to *ProvisioningConfig
+
+	// toolchains are the project's toolchains, whose install scripts are
+	// shown by Summary
+	toolchains []config.Toolchain
+}
+
+// IsZero reports whether nothing changed
+func (c *ProvisioningChange) IsZero() bool {
+	return len(c.AddedPackages)+len(c.RemovedPackages)+len(c.Toolchains)+len(c.RemovedToolchains)+len(c.Env) == 0
+}
+
+// Summary describes the change, one item per line
+func (c *ProvisioningChange) Summary() []string {
+	var lines []string
+	if len(c.AddedPackages) > 0 {
+		lines = append(lines, "install packages: "+strings.Join(c.AddedPackages, ", "))
+	}
+	if len(c.RemovedPackages) > 0 {
+		lines = append(lines, "packages no longer listed (kept installed): "+strings.Join(c.RemovedPackages, ", "))
+	}
+	for _, name := range c.Toolchains {
+		lines = append(lines, c.toolchainSummary(name))
+	}
+	if len(c.RemovedToolchains) > 0 {
+		lines = append(lines, "unmount toolchains: "+strings.Join(c.RemovedToolchains, ", "))
+	}
+	if len(c.Env) > 0 {
+		lines = append(lines, "update variables: "+strings.Join(c.Env, ", "))
+	}
+	return lines
+}
+
+// toolchainSummary describes building and mounting the named toolchain,
+// with the install script that runs in the VM and its hash
+func (c *ProvisioningChange) toolchainSummary(name string) string {
+	i := slices.IndexFunc(c.toolchains, func(tc config.Toolchain) bool { return tc.Name == name })
+	if i < 0 {
+		return "build and mount toolchain " + name
+	}
+	tc := c.toolchains[i]
+	var b strings.Builder
+	fmt.Fprintf(&b, "build and mount toolchain %s, running its install script (sha256 %s):", name, installScriptHash(tc))
+	for _, line := range strings.Split(strings.TrimRight(tc.Install, "\n"), "\n") {
+		b.WriteString("\n      " + line)
+	}
+	return b.String()
+}
+
+// diffProvisioning compares the configuration an environment was
+// provisioned from with the current one
+func diffProvisioning(from, to *ProvisioningConfig) *ProvisioningChange {
+	c := &ProvisioningChange{from: from, to: to}
+	for _, pkg := range to.Packages {
+		if !slices.Contains(from.Packages, pkg) {
+			c.AddedPackages = append(c.AddedPackages, pkg)
+		}
+	}
+	for _, pkg := range from.Packages {
+		if !slices.Contains(to.Packages, pkg) {
+			c.RemovedPackages = append(c.RemovedPackages, pkg)
+		}
+	}
+	c.Toolchains, c.RemovedToolchains = diffMaps(from.Toolchains, to.Toolchains)
+	changed, removed := diffMaps(from.Env, to.Env)
+	c.Env = slices.Sorted(slices.Values(append(changed, removed...)))
+	return c
+}
+
+// diffMaps returns the sorted keys of to that are new or have a different
+// value than in from, and the sorted keys of from missing from to
+func diffMaps(from, to map[string]string) (changed, removed []string) {
+	for k, v := range to {
+		if old, ok := from[k]; !ok || old != v {
+			changed = append(changed, k)
+		}
+	}
+	for k := range from {
+		if _, ok := to[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// provisioningConfig returns the configuration env is provisioned from with
+// project
+func provisioningConfig(env *Environment, project *config.Project) (*ProvisioningConfig, error) {
+	packages, err := dockerfilePackages(env.ProjectPath, project)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ProvisioningConfig{Packages: packages}
+	if len(project.Toolchains) > 0 {
+		c.Toolchains = make(map[string]string, len(project.Toolchains))
+		for _, tc := range project.Toolchains {
+			c.Toolchains[tc.Name] = layerKey(tc)
+		}
+	}
+	c.Env = map[string]string{"PATH": toolchainPath(project.Toolchains)}
+	for _, v := range append(sandboxVars(env), templateVars(env)...) {
+		c.Env[v.Key] = v.Value
+	}
+	return c, nil
+}
+
+// syncProvisioning compares the project's provisioning configuration with
+// the one recorded in md. The first time, the current configuration is
+// recorded. When it changed, the change is applied if the
+// ConfirmProvisioningChange option accepts it; otherwise it's reported and
+// offered again next time.
+func (m *Manager) syncProvisioning(ctx context.Context, env *Environment, md *metadata, project *config.Project) error {
+	current, err := provisioningConfig(env, project)
+	if err != nil {
+		return err
+	}
+	if md.ProvisionHash == current.Hash() {
+		return nil
+	}
+	if md.Provisioned == nil {
+		return m.recordProvisioning(ctx, env.Name, md, current)
+	}
+
+	change := diffProvisioning(md.Provisioned, current)
+	change.toolchains = project.Toolchains
+	if change.IsZero() {
+		return m.recordProvisioning(ctx, env.Name, md, current)
+	}
+	if m.options.ConfirmProvisioningChange == nil || !m.options.ConfirmProvisioningChange(ctx, env, change) {
+		m.warnf(env.Name, "the provisioning configuration of %s changed and wasn't applied: %s", env.Name, strings.Join(change.Summary(), "; "))
+		return nil
+	}
+	if err := m.applyProvisioning(ctx, env, project, change); err != nil {
+		return err
+	}
+	return m.recordProvisioning(ctx, env.Name, md, current)
+}
+
+// ProvisioningDrift returns how the configuration of env's project changed
+// since the environment was last brought up to date with it, or nil if it
+// didn't or the environment has no record of it. Nothing is changed;
+// creating the environment again offers the change to
+// Options.ConfirmProvisioningChange.
+func (m *Manager) ProvisioningDrift(ctx context.Context, env *Environment) (*ProvisioningChange, error) {
+	if err := m.ensureSSH(ctx); err != nil {
+		return nil, err
+	}
+	md, err := m.readMetadata(ctx, env.Name)
+	if err != nil || md.Provisioned == nil {
+		return nil, nil
+	}
+
+	recorded := *env
+	recorded.Driver = md.Mount
+	recorded.Template = md.Template
+	project, err := loadProject(&recorded)
+	if err != nil {
+		return nil, err
+	}
+	current, err := provisioningConfig(&recorded, project)
+	if err != nil {
+		return nil, err
+	}
+	if md.ProvisionHash == current.Hash() {
+		return nil, nil
+	}
+	if change := diffProvisioning(md.Provisioned, current); !change.IsZero() {
+		change.toolchains = project.Toolchains
+		return change, nil
+	}
+	return nil, nil
+}
+
+// recordProvisioning stores c in md as the configuration env is provisioned
+// from, and records the packages it was provisioned with
+func (m *Manager) recordProvisioning(ctx context.Context, envName string, md *metadata, c *ProvisioningConfig) error {
+	md.Provisioned = c
+	md.ProvisionHash = c.Hash()
+	if err := m.writeMetadata(ctx, envName, md); err != nil {
+		return err
+	}
+	m.recordInventory(ctx, envName)
+	return nil
+}
+
+// applyProvisioning applies change to env's running namespace: new packages
+// are installed, new and changed toolchains are built and mounted in place
+// of the old ones, removed toolchains are unmounted, and the profile is
+// rewritten
+func (m *Manager) applyProvisioning(ctx context.Context, env *Environment, project *config.Project, change *ProvisioningChange) error {
+	m.debugf(env.Name, "Applying provisioning changes to %s: %s", env.Name, strings.Join(change.Summary(), "; "))
+	m.probes.invalidate()
+
+	if len(change.AddedPackages) > 0 {
+		if err := checkPackages(change.AddedPackages); err != nil {
+			return err
+		}
+		if err := m.streamCommand(ctx, env.Name, installPackagesCommand(change.AddedPackages)); err != nil {
+			return fmt.Errorf("failed to install Dockerfile packages: %w", err)
+		}
+	}
+	if err := m.ensureLayers(ctx, project.Toolchains); err != nil {
+		return err
+	}
+
+	output, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("sudo cat %s/namespace.pid", envDir(env.Name)))
+	if err != nil {
+		return fmt.Errorf("failed to read namespace PID: %w", err)
+	}
+	pid := strings.TrimSpace(output)
+
+	var cmds []RemoteCommand
+	for _, name := range append(slices.Clone(change.RemovedToolchains), change.Toolchains...) {
+		if _, ok := change.from.Toolchains[name]; !ok {
+			continue
+		}
+		dst := shellWord(toolchainMountRoot + "/" + name)
+		cmds = append(cmds, RemoteCommand{
+			Purpose: "unmount toolchain " + name,
+			Script:  pidRunner(pid).Script(fmt.Sprintf("if mountpoint -q %[1]s; then umount %[1]s; fi", dst)),
+		})
+	}
+	cmds = append(cmds, layerMountCommands(pid, project.Toolchains)...)
+	cmds = append(cmds, profileCommand(env, project.Toolchains))
+	return m.runCommands(ctx, cmds)
+}
@@ -0,0 +1,200 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+func TestDiffProvisioning(t *testing.T) {
+	from := &ProvisioningConfig{
+		Packages:   []string{"curl", "jq"},
+		Toolchains: map[string]string{"node": "node-aaa", "go": "go-bbb"},
+		Env:        map[string]string{"PATH": "/usr/bin", "LLIMA_BOX_ENV": "app-a1b2", "OLD": "1"},
+	}
+	to := &ProvisioningConfig{
+		Packages:   []string{"jq", "ripgrep"},
+		Toolchains: map[string]string{"node": "node-ccc", "rust": "rust-ddd"},
+		Env:        map[string]string{"PATH": "/opt/toolchains/rust/bin:/usr/bin", "LLIMA_BOX_ENV": "app-a1b2"},
+	}
+
+	got := diffProvisioning(from, to)
+	want := &ProvisioningChange{
+		AddedPackages:     []string{"ripgrep"},
+		RemovedPackages:   []string{"curl"},
+		Toolchains:        []string{"node", "rust"},
+		RemovedToolchains: []string{"go"},
+		Env:               []string{"OLD", "PATH"},
+		from:              from,
+		to:                to,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffProvisioning() = %+v, want %+v", got, want)
+	}
+	if diffProvisioning(from, from).IsZero() != true {
+		t.Error("expected no change between equal configurations")
+	}
+}
+
+func TestProvisioningChangeSummary(t *testing.T) {
+	tc := config.Toolchain{Name: "go", Install: "curl -fsSL https://go.dev/dl/go.tgz | tar -xz -C \"$LAYER\"\nmv \"$LAYER/go/bin\" \"$LAYER/bin\"\n"}
+	change := &ProvisioningChange{AddedPackages: []string{"jq"}, Toolchains: []string{"go"}, toolchains: []config.Toolchain{tc}}
+
+	want := []string{
+		"install packages: jq",
+		"build and mount toolchain go, running its install script (sha256 " + installScriptHash(tc) + "):\n" +
+			"      curl -fsSL https://go.dev/dl/go.tgz | tar -xz -C \"$LAYER\"\n" +
+			"      mv \"$LAYER/go/bin\" \"$LAYER/bin\"",
+	}
+	if got := change.Summary(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
+
+func TestProvisioningConfigHash(t *testing.T) {
+	a := &ProvisioningConfig{Packages: []string{"curl", "jq"}, Env: map[string]string{"A": "1", "B": "2"}}
+	b := &ProvisioningConfig{Packages: []string{"jq", "curl"}, Env: map[string]string{"B": "2", "A": "1"}}
+	if a.Hash() != b.Hash() {
+		t.Error("expected the package order not to change the hash")
+	}
+	b.Env["A"] = "3"
+	if a.Hash() == b.Hash() {
+		t.Error("expected a changed variable to change the hash")
+	}
+}
+
+func TestSyncProvisioning(t *testing.T) {
+	projectPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(projectPath, "Dockerfile"), []byte("FROM ubuntu\nRUN apt-get install -y jq ripgrep\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env := &Environment{Name: "app-a1b2", ProjectPath: projectPath}
+	project := &config.Project{
+		Dockerfile: &config.DockerfileSource{Path: "Dockerfile"},
+		Toolchains: []config.Toolchain{{Name: "node", Install: "echo node"}},
+	}
+	current, err := provisioningConfig(env, project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Set up before ripgrep and the toolchain were added
+	recorded := &ProvisioningConfig{Packages: []string{"jq"}, Env: maps.Clone(current.Env)}
+	recorded.Env["PATH"] = defaultPath
+
+	tests := []struct {
+		name        string
+		recorded    *ProvisioningConfig
+		accept      bool
+		wantAsked   bool
+		wantApplied bool
+		wantRecord  bool
+	}{
+		{name: "first time records the configuration", wantRecord: true},
+		{name: "unchanged", recorded: current},
+		{name: "change accepted", recorded: recorded, accept: true, wantAsked: true, wantApplied: true, wantRecord: true},
+		{name: "change declined", recorded: recorded, wantAsked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			m := newManagerWithExecutor(mock)
+
+			var asked *ProvisioningChange
+			m.options.ConfirmProvisioningChange = func(_ context.Context, _ *Environment, change *ProvisioningChange) bool {
+				asked = change
+				return tt.accept
+			}
+
+			md := &metadata{ProjectPath: projectPath, Step: stepSetupDone, Provisioned: tt.recorded}
+			if tt.recorded != nil {
+				md.ProvisionHash = tt.recorded.Hash()
+			}
+			if err := m.syncProvisioning(context.Background(), env, md, project); err != nil {
+				t.Fatalf("syncProvisioning failed: %v", err)
+			}
+
+			if (asked != nil) != tt.wantAsked {
+				t.Fatalf("asked = %v, want %v", asked != nil, tt.wantAsked)
+			}
+			if asked != nil && (!reflect.DeepEqual(asked.AddedPackages, []string{"ripgrep"}) || !reflect.DeepEqual(asked.Toolchains, []string{"node"}) || !reflect.DeepEqual(asked.Env, []string{"PATH"})) {
+				t.Errorf("unexpected change %+v", asked)
+			}
+			if applied := mock.callCount(installPackagesCommand([]string{"ripgrep"})) == 1 && calledWith(mock, "/etc/profile.d/llima-box.sh"); applied != tt.wantApplied {
+				t.Errorf("applied = %v, want %v (calls: %v)", applied, tt.wantApplied, mock.calls)
+			}
+			if recorded := calledWith(mock, `"provisionHash":"`+current.Hash()+`"`); recorded != tt.wantRecord {
+				t.Errorf("recorded = %v, want %v", recorded, tt.wantRecord)
+			}
+			if strings.Contains(strings.Join(mock.calls, "\n"), installPackagesCommand([]string{"jq", "ripgrep"})) {
+				t.Error("expected only the new package to be installed")
+			}
+		})
+	}
+}
+
+func TestProvisioningDrift(t *testing.T) {
+	projectPath := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(projectPath, config.ProjectDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config.ProjectConfigPath(projectPath), []byte("toolchains:\n  - name: node\n    install: echo node\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env := &Environment{Name: "app-a1b2", ProjectPath: projectPath}
+	project, err := config.LoadProject(projectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := provisioningConfig(env, project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Set up before the toolchain was added
+	before := &ProvisioningConfig{Env: maps.Clone(current.Env)}
+	before.Env["PATH"] = defaultPath
+
+	tests := []struct {
+		name      string
+		recorded  *ProvisioningConfig
+		wantDrift bool
+	}{
+		{name: "no record"},
+		{name: "up to date", recorded: current},
+		{name: "toolchain added", recorded: before, wantDrift: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := &metadata{ProjectPath: projectPath, Step: stepSetupDone, Provisioned: tt.recorded}
+			if tt.recorded != nil {
+				md.ProvisionHash = tt.recorded.Hash()
+			}
+			data, err := json.Marshal(md)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mock := newMockExecutor()
+			mock.setResponse(readMetadataCommand("app-a1b2"), string(data))
+
+			change, err := newManagerWithExecutor(mock).ProvisioningDrift(context.Background(), env)
+			if err != nil {
+				t.Fatalf("ProvisioningDrift failed: %v", err)
+			}
+			if (change != nil) != tt.wantDrift {
+				t.Fatalf("drift = %+v, want drift %v", change, tt.wantDrift)
+			}
+			if change != nil && !reflect.DeepEqual(change.Toolchains, []string{"node"}) {
+				t.Errorf("unexpected change %+v", change)
+			}
+		})
+	}
+}
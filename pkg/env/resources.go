@@ -0,0 +1,133 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+// ErrInsufficientCapacity is returned by Create with Options.StrictResources
+// when the VM can't fit the resources the project declares next to those of
+// the other environments
+var ErrInsufficientCapacity = errors.New("not enough VM capacity left for the project's declared resources")
+
+// capacityCommand prints the VM's CPU count and its total memory line
+const capacityCommand = "nproc && grep '^MemTotal:' /proc/meminfo"
+
+// Reservation is the CPU and memory an environment's project declared it
+// needs (see config.Resources). Nothing enforces it; it's compared with the
+// VM's capacity when environments are created.
+type Reservation struct {
+	// CPUs is the number of cores
+	CPUs float64 `json:"cpus,omitempty"`
+
+	// Memory is in bytes
+	Memory int64 `json:"memory,omitempty"`
+}
+
+// IsZero reports whether nothing is declared
+func (r Reservation) IsZero() bool {
+	return r.CPUs == 0 && r.Memory == 0
+}
+
+// reservationFor returns the resources project declares
+func reservationFor(project *config.Project) (Reservation, error) {
+	if project == nil || project.Resources == nil {
+		return Reservation{}, nil
+	}
+	r := Reservation{CPUs: project.Resources.CPUs}
+	if project.Resources.Memory != "" {
+		memory, err := ParseMemorySize(project.Resources.Memory)
+		if err != nil {
+			return Reservation{}, fmt.Errorf("resources: %w", err)
+		}
+		r.Memory = memory
+	}
+	return r, nil
+}
+
+// checkCapacity compares what env's project declares with what the VM has
+// left after the declarations of the other environments. A shortfall is a
+// warning, or ErrInsufficientCapacity with Options.StrictResources.
+// Environments without a declaration count as needing nothing.
+func (m *Manager) checkCapacity(ctx context.Context, env *Environment, want Reservation) error {
+	if want.IsZero() {
+		return nil
+	}
+
+	output, err := m.sshClient.ExecContext(ctx, capacityCommand)
+	if err != nil {
+		return fmt.Errorf("failed to read VM capacity: %w", err)
+	}
+	capacity, err := parseCapacity(output)
+	if err != nil {
+		return err
+	}
+	envs, err := m.scanEnvironments(ctx)
+	if err != nil {
+		return err
+	}
+	var reserved Reservation
+	for _, e := range envs {
+		if e.Name != env.Name {
+			reserved.CPUs += e.Reserved.CPUs
+			reserved.Memory += e.Reserved.Memory
+		}
+	}
+
+	shortfalls := capacityShortfalls(capacity, reserved, want)
+	if len(shortfalls) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("%s declares more than the VM has left: %s", env.Name, strings.Join(shortfalls, "; "))
+	if m.options.StrictResources {
+		return fmt.Errorf("%w: %s", ErrInsufficientCapacity, msg)
+	}
+	m.warnf(env.Name, "%s. Environments may slow each other down.", msg)
+	return nil
+}
+
+// capacityShortfalls describes each resource for which want doesn't fit in
+// what capacity has left after reserved
+func capacityShortfalls(capacity, reserved, want Reservation) []string {
+	var shortfalls []string
+	if want.CPUs > 0 && reserved.CPUs+want.CPUs > capacity.CPUs {
+		shortfalls = append(shortfalls, fmt.Sprintf("%g CPUs wanted, %g of %g free",
+			want.CPUs, max(capacity.CPUs-reserved.CPUs, 0), capacity.CPUs))
+	}
+	if want.Memory > 0 && reserved.Memory+want.Memory > capacity.Memory {
+		shortfalls = append(shortfalls, fmt.Sprintf("%s memory wanted, %s of %s free",
+			formatGiB(want.Memory), formatGiB(max(capacity.Memory-reserved.Memory, 0)), formatGiB(capacity.Memory)))
+	}
+	return shortfalls
+}
+
+// formatGiB formats a memory size in GiB
+func formatGiB(bytes int64) string {
+	return strconv.FormatFloat(float64(bytes)/(1<<30), 'f', 1, 64) + "GiB"
+}
+
+// parseCapacity parses the output of capacityCommand
+func parseCapacity(output string) (Reservation, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 {
+		return Reservation{}, fmt.Errorf("unexpected VM capacity output %q", output)
+	}
+	cpus, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return Reservation{}, fmt.Errorf("invalid CPU count %q", lines[0])
+	}
+	fields := strings.Fields(lines[1])
+	if len(fields) < 2 {
+		return Reservation{}, fmt.Errorf("invalid memory line %q", lines[1])
+	}
+	kb, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return Reservation{}, fmt.Errorf("invalid memory line %q", lines[1])
+	}
+	return Reservation{CPUs: float64(cpus), Memory: kb * 1024}, nil
+}
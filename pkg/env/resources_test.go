@@ -0,0 +1,101 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+func TestReservationFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		project *config.Project
+		want    Reservation
+		wantErr bool
+	}{
+		{name: "none", project: &config.Project{}},
+		{name: "cpus and memory", project: &config.Project{Resources: &config.Resources{CPUs: 1.5, Memory: "2G"}}, want: Reservation{CPUs: 1.5, Memory: 2 << 30}},
+		{name: "invalid memory", project: &config.Project{Resources: &config.Resources{Memory: "lots"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reservationFor(tt.project)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reservationFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("reservationFor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCapacity(t *testing.T) {
+	got, err := parseCapacity("4\nMemTotal:        8000000 kB\n")
+	if err != nil {
+		t.Fatalf("parseCapacity failed: %v", err)
+	}
+	if want := (Reservation{CPUs: 4, Memory: 8000000 * 1024}); got != want {
+		t.Errorf("parseCapacity() = %+v, want %+v", got, want)
+	}
+
+	for _, output := range []string{"", "four\nMemTotal: 1 kB\n", "4\nMemTotal:\n"} {
+		if _, err := parseCapacity(output); err == nil {
+			t.Errorf("expected an error for %q", output)
+		}
+	}
+}
+
+func TestCapacityShortfalls(t *testing.T) {
+	capacity := Reservation{CPUs: 4, Memory: 8 << 30}
+
+	tests := []struct {
+		name     string
+		reserved Reservation
+		want     Reservation
+		expect   []string
+	}{
+		{name: "fits", reserved: Reservation{CPUs: 2, Memory: 4 << 30}, want: Reservation{CPUs: 2, Memory: 4 << 30}},
+		{name: "cpus", reserved: Reservation{CPUs: 3}, want: Reservation{CPUs: 2}, expect: []string{"2 CPUs wanted, 1 of 4 free"}},
+		{
+			name:     "both, overcommitted",
+			reserved: Reservation{CPUs: 6, Memory: 10 << 30},
+			want:     Reservation{CPUs: 1, Memory: 1 << 30},
+			expect:   []string{"1 CPUs wanted, 0 of 4 free", "1.0GiB memory wanted, 0.0GiB of 8.0GiB free"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := capacityShortfalls(capacity, tt.reserved, tt.want); !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("capacityShortfalls() = %q, want %q", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestCheckCapacity(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		mock := newMockExecutor()
+		mock.setResponse(capacityCommand, "4\nMemTotal: 8388608 kB\n")
+		mock.setResponse(scanCommand, "api-a1b2\trunning\t{\"projectPath\":\"/work/api\",\"resources\":{\"cpus\":3}}\n")
+		m := newManagerWithExecutor(mock)
+		m.options.StrictResources = strict
+
+		env := &Environment{Name: "web-c3d4"}
+		if err := m.checkCapacity(context.Background(), env, Reservation{CPUs: 1}); err != nil {
+			t.Errorf("strict=%v: expected 1 CPU to fit, got %v", strict, err)
+		}
+		err := m.checkCapacity(context.Background(), env, Reservation{CPUs: 2})
+		if strict && !errors.Is(err, ErrInsufficientCapacity) {
+			t.Errorf("expected ErrInsufficientCapacity, got %v", err)
+		}
+		if !strict && err != nil {
+			t.Errorf("expected only a warning, got %v", err)
+		}
+	}
+}
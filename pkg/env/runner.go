@@ -0,0 +1,281 @@
+package env
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+)
+
+// RemoteRunner builds the shell commands that run programs inside an
+// environment's mount namespace. The commands are sent over SSH and parsed by
+// the VM user's shell, so every path, argument, and script is quoted here, in
+// one place, rather than at each call site.
+//
+// Runners are values; each With/As/In method returns a modified copy. Start
+// from NewRemoteRunner.
+type RemoteRunner struct {
+	// target is a shell expression yielding the namespace keeper's PID
+	target string
+	user   string
+	dir    string
+	env    []string
+
+	// exprEnv holds assignments whose values are shell expressions, quoted
+	// for expansion (see withEnvExpr)
+	exprEnv []string
+
+	// varsFile is a session variable file setting the variables named in
+	// fileVars (see withVarsFile)
+	varsFile string
+	fileVars []string
+
+	// timeout is a shell expression yielding a time limit for timeout(1)
+	timeout string
+}
+
+// NewRemoteRunner returns a runner for the named environment's namespace.
+// Commands run as root unless AsUser is used.
+func NewRemoteRunner(envName string) RemoteRunner {
+	return RemoteRunner{target: fmt.Sprintf("$(sudo cat %s)", shellWord(envDir(envName)+"/namespace.pid"))}
+}
+
+// pidRunner returns a runner for the namespace held by the process pid
+func pidRunner(pid string) RemoteRunner {
+	return RemoteRunner{target: shellWord(pid)}
+}
+
+// AsUser runs commands as user through a login shell, so the user's profile
+// (including toolchain PATH entries) applies
+func (r RemoteRunner) AsUser(user string) RemoteRunner {
+	r.user = user
+	return r
+}
+
+// InDir runs commands in dir
+func (r RemoteRunner) InDir(dir string) RemoteRunner {
+	r.dir = dir
+	return r
+}
+
+// WithEnv sets an environment variable for commands. key must be a valid
+// variable name.
+func (r RemoteRunner) WithEnv(key, value string) RemoteRunner {
+	r.env = append(r.env[:len(r.env):len(r.env)], key+"="+value)
+	return r
+}
+
+// withEnvExpr sets an environment variable to the value of expr, a shell
+// expression expanded by the VM user's shell as the command starts, such as
+// a path containing "$$". expr goes in double quotes as it is, so it must
+// come from llima-box, never from users or projects.
+func (r RemoteRunner) withEnvExpr(key, expr string) RemoteRunner {
+	r.exprEnv = append(r.exprEnv[:len(r.exprEnv):len(r.exprEnv)], key+`="`+expr+`"`)
+	return r
+}
+
+// withVarsFile passes the variables named in names through the session
+// variable file path (see writeSessionVars) instead of the command line. The
+// file is read and removed by root before the namespace is entered.
+func (r RemoteRunner) withVarsFile(path string, names []string) RemoteRunner {
+	r.varsFile = path
+	r.fileVars = names
+	return r
+}
+
+// withTimeout ends commands after limit, a shell expression such as
+// "${limit}s" (unquoted, so the enclosing script can compute it). timeout(1)
+// runs as root, so nothing in the environment can stop it, and in the
+// foreground, so an interactive shell keeps its terminal. It only reaches
+// the command itself; budgetScript kills what the command leaves behind.
+func (r RemoteRunner) withTimeout(limit string) RemoteRunner {
+	r.timeout = limit
+	return r
+}
+
+// Command returns a command running argv. Arguments are passed through
+// unchanged; nothing in them is interpreted by a shell.
+func (r RemoteRunner) Command(argv ...string) string {
+	if r.user != "" {
+		return r.su(r.userScript(shellJoin(argv)))
+	}
+	return r.rootCommand(shellJoin(argv))
+}
+
+// Script returns a command running script with sh as root, or with the
+// user's login shell after AsUser
+func (r RemoteRunner) Script(script string) string {
+	if r.user != "" {
+		return r.su(r.userScript(script))
+	}
+	return r.rootCommand("sh -c " + shellquote.Quote(script))
+}
+
+// defaultPath is the PATH for commands started with Exec, before toolchain
+// directories are added
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// Exec returns a command running argv directly as the user set with AsUser.
+// nsenter switches to the user and env executes the program, so no shell in
+// the environment parses the arguments and no login profile runs. The program
+// starts with an empty environment apart from HOME, USER, LOGNAME, PATH
+// (defaultPath), and the variables set with WithEnv or withVarsFile, which
+// can override them. Supplementary groups are dropped. env would take a
+// program name containing "=" for a variable, so argv[0] must not contain
+// one.
+func (r RemoteRunner) Exec(argv ...string) string {
+	user := shellWord(r.user)
+	vars := []string{"USER=" + r.user, "LOGNAME=" + r.user, "PATH=" + defaultPath}
+	home := fmt.Sprintf("\"HOME=$(getent passwd %s | cut -d: -f6)\"", user)
+	env := "env -i --"
+	if r.varsFile != "" {
+		// The environment was emptied before the file was read; the
+		// file's variables win over the ones set here
+		env = "env --"
+		vars = r.withoutFileVars(append(vars, r.env...))
+		if slices.Contains(r.fileVars, "HOME") {
+			home = ""
+		}
+	} else {
+		vars = append(vars, r.env...)
+	}
+	exprs := r.withoutFileVars(r.exprEnv)
+	cmd := fmt.Sprintf("%s --setuid=$(id -u %[2]s) --setgid=$(id -g %[2]s) %[3]s", r.nsenter(true), user, env)
+	if home != "" {
+		cmd += " " + home
+	}
+	if len(vars) > 0 {
+		cmd += " " + shellJoin(vars)
+	}
+	if len(exprs) > 0 {
+		cmd += " " + strings.Join(exprs, " ")
+	}
+	return cmd + " " + shellJoin(argv)
+}
+
+// LoginShell returns a command starting an interactive login shell for the
+// user set with AsUser. Login shells start in the user's home directory, so
+// InDir doesn't apply. Variables set with WithEnv or withVarsFile are kept
+// through the login by su's environment whitelist.
+func (r RemoteRunner) LoginShell() string {
+	return r.nsenter(false) + r.loginEnv(r.env) + " su --login " + r.whitelist(r.env) + shellWord(r.user)
+}
+
+// loginEnv returns the env(1) prefix setting vars and the withEnvExpr
+// variables for su, or nothing
+func (r RemoteRunner) loginEnv(vars []string) string {
+	words := r.withoutFileVars(vars)
+	if len(words) == 0 && len(r.exprEnv) == 0 {
+		return ""
+	}
+	cmd := " env"
+	if len(words) > 0 {
+		cmd += " " + shellJoin(words)
+	}
+	if len(r.exprEnv) > 0 {
+		cmd += " " + strings.Join(r.exprEnv, " ")
+	}
+	return cmd
+}
+
+// whitelist returns su's option keeping vars, the withEnvExpr variables,
+// and the session variable file's variables through the login, or nothing
+func (r RemoteRunner) whitelist(vars []string) string {
+	var names []string
+	for _, kv := range append(r.withoutFileVars(vars), r.exprEnv...) {
+		name, _, _ := strings.Cut(kv, "=")
+		names = append(names, name)
+	}
+	names = append(names, r.fileVars...)
+	if len(names) == 0 {
+		return ""
+	}
+	return "--whitelist-environment=" + strings.Join(names, ",") + " "
+}
+
+// withoutFileVars drops the assignments to variables the session variable
+// file sets
+func (r RemoteRunner) withoutFileVars(vars []string) []string {
+	var kept []string
+	for _, kv := range vars {
+		name, _, _ := strings.Cut(kv, "=")
+		if !slices.Contains(r.fileVars, name) {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
+
+// nsenter returns the command prefix entering the namespace as root. With a
+// session variable file, a root shell reads the file first; clean empties
+// its environment before, for Exec.
+func (r RemoteRunner) nsenter(clean bool) string {
+	cmd := "nsenter --target=" + r.target + " --mount"
+	if r.timeout != "" {
+		cmd = fmt.Sprintf("timeout --foreground --kill-after=%d %s %s", int(sessionKillGrace/time.Second), r.timeout, cmd)
+	}
+	if r.dir != "" {
+		cmd += " --wdns=" + shellWord(r.dir)
+	}
+	switch {
+	case r.varsFile == "":
+		return "sudo " + cmd
+	case clean:
+		return "sudo env -i PATH=" + defaultPath + " sh -c " + shellquote.Quote(sourceVarsScript) + " sh " + shellWord(r.varsFile) + " " + cmd
+	default:
+		return "sudo sh -c " + shellquote.Quote(sourceVarsScript) + " sh " + shellWord(r.varsFile) + " " + cmd
+	}
+}
+
+// rootCommand runs an already quoted command line as root
+func (r RemoteRunner) rootCommand(command string) string {
+	cmd := r.nsenter(false)
+	if len(r.env) > 0 {
+		cmd += " env " + shellJoin(r.env)
+	}
+	return cmd + " " + command
+}
+
+// userScript prefixes script with the environment and directory changes,
+// which su --login would otherwise reset
+func (r RemoteRunner) userScript(script string) string {
+	var parts []string
+	for _, kv := range r.env {
+		parts = append(parts, "export "+shellWord(kv))
+	}
+	if r.dir != "" {
+		parts = append(parts, "cd "+shellWord(r.dir))
+	}
+	return strings.Join(append(parts, script), " && ")
+}
+
+// su runs script through the user's login shell. Variables from the session
+// variable file and withEnvExpr are kept through the login; those set with
+// WithEnv are exported by the script (see userScript).
+func (r RemoteRunner) su(script string) string {
+	return r.nsenter(false) + r.loginEnv(nil) + " su --login " + r.whitelist(nil) + shellWord(r.user) + " --command " + shellquote.Quote(script)
+}
+
+// safeWord matches words that need no quoting in a POSIX shell
+var safeWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellWord quotes s as a single shell word, leaving words without special
+// characters as they are for readability
+func shellWord(s string) string {
+	if safeWord.MatchString(s) {
+		return s
+	}
+	return shellquote.Quote(s)
+}
+
+// shellJoin quotes each word and joins them into a command line
+func shellJoin(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = shellWord(w)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,141 @@
+package env
+
+import "testing"
+
+func TestRemoteRunner(t *testing.T) {
+	const target = "sudo nsenter --target=$(sudo cat /envs/app-a1b2/namespace.pid) --mount"
+	const source = `sudo sh -c 'f=$1 && shift && set -a && . "$f" && set +a && rm -f "$f" && exec "$@"' sh /run/llima-box-sessions/f00d`
+	base := NewRemoteRunner("app-a1b2")
+	user := base.AsUser("app-a1b2").InDir("/Users/alice/my project")
+	withFile := user.withVarsFile("/run/llima-box-sessions/f00d", []string{"API_TOKEN", "PATH"})
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{
+			name: "root command",
+			got:  base.Command("test", "-e", "/tmp/ready"),
+			want: target + " test -e /tmp/ready",
+		},
+		{
+			name: "root command quotes arguments",
+			got:  base.Command("touch", "/tmp/a b", "it's", "$(reboot)"),
+			want: target + ` touch '/tmp/a b' 'it'\''s' '$(reboot)'`,
+		},
+		{
+			name: "root command with directory and environment",
+			got:  base.InDir("/srv/app").WithEnv("MODE", "a b").Command("make"),
+			want: target + " --wdns=/srv/app env 'MODE=a b' make",
+		},
+		{
+			name: "root script",
+			got:  base.Script("mkdir -p '/shared/x' && mount --bind '/a' '/shared/x'"),
+			want: target + ` sh -c 'mkdir -p '\''/shared/x'\'' && mount --bind '\''/a'\'' '\''/shared/x'\'''`,
+		},
+		{
+			name: "pid target",
+			got:  pidRunner("4242").Command("findmnt", "-n"),
+			want: "sudo nsenter --target=4242 --mount findmnt -n",
+		},
+		{
+			name: "login shell",
+			got:  user.LoginShell(),
+			want: target + " --wdns='/Users/alice/my project' su --login app-a1b2",
+		},
+		{
+			name: "login shell with environment",
+			got:  user.WithEnv("DATABASE_URL", "postgres://u:p w@db").WithEnv("APP_ENV", "dev").LoginShell(),
+			want: target + " --wdns='/Users/alice/my project' env 'DATABASE_URL=postgres://u:p w@db' APP_ENV=dev su --login --whitelist-environment=DATABASE_URL,APP_ENV app-a1b2",
+		},
+		{
+			name: "user script",
+			got:  user.Script("go test ./... && echo $HOME"),
+			want: target + ` --wdns='/Users/alice/my project' su --login app-a1b2 --command 'cd '\''/Users/alice/my project'\'' && go test ./... && echo $HOME'`,
+		},
+		{
+			name: "user exec",
+			got:  user.WithEnv("CI", "1").Exec("grep", "-r", "$(reboot); *", "."),
+			want: target + ` --wdns='/Users/alice/my project' --setuid=$(id -u app-a1b2) --setgid=$(id -g app-a1b2) env -i -- "HOME=$(getent passwd app-a1b2 | cut -d: -f6)" USER=app-a1b2 LOGNAME=app-a1b2 PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin CI=1 grep -r '$(reboot); *' .`,
+		},
+		{
+			name: "user command with environment",
+			got:  user.WithEnv("CI", "1").Command("npm", "run", "build; rm -rf /"),
+			want: target + ` --wdns='/Users/alice/my project' su --login app-a1b2 --command 'export CI=1 && cd '\''/Users/alice/my project'\'' && npm run '\''build; rm -rf /'\'''`,
+		},
+		{
+			name: "login shell with expression",
+			got:  user.WithEnv("CI", "1").withEnvExpr("SESSION", "/run/$$").LoginShell(),
+			want: target + ` --wdns='/Users/alice/my project' env CI=1 SESSION="/run/$$" su --login --whitelist-environment=CI,SESSION app-a1b2`,
+		},
+		{
+			name: "user script with expression",
+			got:  user.withEnvExpr("SESSION", "/run/$$").Script("make"),
+			want: target + ` --wdns='/Users/alice/my project' env SESSION="/run/$$" su --login --whitelist-environment=SESSION app-a1b2 --command 'cd '\''/Users/alice/my project'\'' && make'`,
+		},
+		{
+			name: "user exec with expression",
+			got:  user.withEnvExpr("SESSION", "/run/$$").Exec("make"),
+			want: target + ` --wdns='/Users/alice/my project' --setuid=$(id -u app-a1b2) --setgid=$(id -g app-a1b2) env -i -- "HOME=$(getent passwd app-a1b2 | cut -d: -f6)" USER=app-a1b2 LOGNAME=app-a1b2 PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin SESSION="/run/$$" make`,
+		},
+		{
+			name: "login shell with session variable file",
+			got:  withFile.LoginShell(),
+			want: source + " nsenter --target=$(sudo cat /envs/app-a1b2/namespace.pid) --mount --wdns='/Users/alice/my project' su --login --whitelist-environment=API_TOKEN,PATH app-a1b2",
+		},
+		{
+			name: "user script with session variable file",
+			got:  withFile.Script("make"),
+			want: source + ` nsenter --target=$(sudo cat /envs/app-a1b2/namespace.pid) --mount --wdns='/Users/alice/my project' su --login --whitelist-environment=API_TOKEN,PATH app-a1b2 --command 'cd '\''/Users/alice/my project'\'' && make'`,
+		},
+		{
+			name: "user exec with session variable file",
+			got:  withFile.WithEnv("CI", "1").Exec("make"),
+			want: `sudo env -i PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin sh -c 'f=$1 && shift && set -a && . "$f" && set +a && rm -f "$f" && exec "$@"' sh /run/llima-box-sessions/f00d nsenter --target=$(sudo cat /envs/app-a1b2/namespace.pid) --mount --wdns='/Users/alice/my project' --setuid=$(id -u app-a1b2) --setgid=$(id -g app-a1b2) env -- "HOME=$(getent passwd app-a1b2 | cut -d: -f6)" USER=app-a1b2 LOGNAME=app-a1b2 CI=1 make`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoteRunner_CopiesAreIndependent(t *testing.T) {
+	base := NewRemoteRunner("app-a1b2").WithEnv("A", "1")
+	first := base.WithEnv("B", "2")
+	second := base.WithEnv("C", "3")
+
+	if got, want := first.Command("true"), NewRemoteRunner("app-a1b2").WithEnv("A", "1").WithEnv("B", "2").Command("true"); got != want {
+		t.Errorf("first runner changed by second: %s", got)
+	}
+	if got, want := second.Command("true"), NewRemoteRunner("app-a1b2").WithEnv("A", "1").WithEnv("C", "3").Command("true"); got != want {
+		t.Errorf("second runner = %s, want %s", got, want)
+	}
+}
+
+func TestShellWord(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "/envs/app-a1b2/namespace.pid", want: "/envs/app-a1b2/namespace.pid"},
+		{in: "KEY=value", want: "KEY=value"},
+		{in: "", want: "''"},
+		{in: "a b", want: "'a b'"},
+		{in: "~", want: "'~'"},
+		{in: "*.go", want: "'*.go'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := shellWord(tt.in); got != tt.want {
+				t.Errorf("shellWord(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+const (
+	// sandboxMountPoint is where environments find their sandbox metadata
+	sandboxMountPoint = "/run/llima-box"
+
+	// SandboxInfoPath is the sandbox metadata file inside environments. It's
+	// read-only there and also named by $LLIMA_BOX_ENV_FILE.
+	SandboxInfoPath = sandboxMountPoint + "/env.json"
+
+	// SessionInfoVar names a session's own copy of the sandbox metadata,
+	// which adds the session's limits. Each session has one, so concurrent
+	// sessions don't overwrite each other's limits.
+	SessionInfoVar = "LLIMA_BOX_SESSION_FILE"
+)
+
+// SandboxInfo is what programs inside an environment can learn about the
+// sandbox they run in, from SandboxInfoPath
+type SandboxInfo struct {
+	// Name is the environment name
+	Name string `json:"name"`
+
+	// ProjectPath is the project directory on the host
+	ProjectPath string `json:"projectPath"`
+
+	// Path is the project directory inside the environment
+	Path string `json:"path"`
+
+	// Isolated is set for VM-only workspaces, which can't reach host files
+	Isolated bool `json:"isolated,omitempty"`
+
+	// Labels are the labels from the project configuration
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Limits are the limits of the session the file belongs to; they're
+	// empty in SandboxInfoPath, which no session owns
+	Limits SandboxLimits `json:"limits"`
+}
+
+// SandboxLimits are the limits configured for an environment's sessions.
+// Zero means unlimited.
+type SandboxLimits struct {
+	MaxSessionSeconds int64 `json:"maxSessionSeconds,omitempty"`
+	MaxDailySeconds   int64 `json:"maxDailySeconds,omitempty"`
+}
+
+// sandboxDir returns the VM directory mounted read-only at
+// sandboxMountPoint inside an environment. The directory, not the file, is
+// mounted so the file can be replaced from outside.
+func sandboxDir(envName string) string {
+	return envDir(envName) + "/sandbox"
+}
+
+// sessionInfoDir returns the VM directory holding the sessions' metadata
+// files, named after the PID of the shell running each session
+func sessionInfoDir(envName string) string {
+	return sandboxDir(envName) + "/sessions"
+}
+
+// newSandboxInfo describes env and the limits of a session
+func newSandboxInfo(env *Environment, project *config.Project, budget config.SessionBudget) *SandboxInfo {
+	return &SandboxInfo{
+		Name:        env.Name,
+		ProjectPath: env.ProjectPath,
+		Path:        env.dir(),
+		Isolated:    !env.Mount().HostProject(),
+		Labels:      project.Labels,
+		Limits: SandboxLimits{
+			MaxSessionSeconds: int64(budget.MaxSession.Seconds()),
+			MaxDailySeconds:   int64(budget.MaxDaily.Seconds()),
+		},
+	}
+}
+
+// writeSandboxInfoCommand returns the command replacing an environment's
+// sandbox metadata file
+func writeSandboxInfoCommand(envName string, info *SandboxInfo) (string, error) {
+	return replaceInfoCommand(sandboxDir(envName), "env.json", info)
+}
+
+// replaceInfoCommand returns the command replacing the metadata file name in
+// dir with info. name may hold a shell expression such as "$$". The file is
+// written under a temporary name of its own and renamed, so readers and
+// concurrent writers never see a partial file.
+func replaceInfoCommand(dir, name string, info *SandboxInfo) (string, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode sandbox metadata: %w", err)
+	}
+	return fmt.Sprintf(
+		`sudo mkdir -p %[1]s && t=$(sudo mktemp %[1]s/.info.XXXXXX) && printf '%%s\n' %[2]s | sudo tee "$t" >/dev/null && sudo chmod 644 "$t" && sudo mv -f "$t" %[1]s/%[3]s`,
+		shellWord(dir), shellquote.Quote(string(data)), name,
+	), nil
+}
+
+// sessionInfoScript wraps command, a session's script, so the session has
+// its own sandbox metadata file, with its limits, while it runs. The path is
+// passed in SessionInfoVar. The session starts even if writing fails. The
+// script exits with command's status.
+func sessionInfoScript(envName string, info *SandboxInfo, command string) (string, error) {
+	dir := sessionInfoDir(envName)
+	write, err := replaceInfoCommand(dir, "$$.json", info)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		"{ " + write + "; } 2>/dev/null",
+		command,
+		`session_info_rc=$?`,
+		fmt.Sprintf(`sudo rm -f %s/$$.json 2>/dev/null`, shellWord(dir)),
+		`(exit $session_info_rc)`,
+	}, "\n"), nil
+}
+
+// sessionInfoPath returns the path of the running session's metadata file
+// inside the environment, a shell expression for withEnvExpr
+func sessionInfoPath() string {
+	return sandboxMountPoint + "/sessions/$$.json"
+}
+
+// sandboxInfoCommands returns the commands writing env's sandbox metadata
+// and mounting it read-only into the namespace held by pid. The namespace is
+// new, so the metadata of sessions that ran in an earlier one is removed.
+func sandboxInfoCommands(env *Environment, project *config.Project, pid string) ([]RemoteCommand, error) {
+	write, err := writeSandboxInfoCommand(env.Name, newSandboxInfo(env, project, config.SessionBudget{}))
+	if err != nil {
+		return nil, err
+	}
+	return []RemoteCommand{
+		{Purpose: "write sandbox metadata", Script: "sudo rm -rf " + shellWord(sessionInfoDir(env.Name)) + " && " + write},
+		{Purpose: "mount sandbox metadata", Script: pidRunner(pid).Script(readOnlyBindScript(sandboxDir(env.Name), sandboxMountPoint))},
+	}, nil
+}
+
+// publishSandboxInfo writes env's sandbox metadata and mounts it into the
+// namespace held by pid
+func (m *Manager) publishSandboxInfo(ctx context.Context, env *Environment, pid string, project *config.Project) error {
+	cmds, err := sandboxInfoCommands(env, project, pid)
+	if err != nil {
+		return err
+	}
+	return m.runCommands(ctx, cmds)
+}
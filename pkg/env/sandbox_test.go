@@ -0,0 +1,71 @@
+package env
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+func TestNewSandboxInfo(t *testing.T) {
+	env := &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/app"}
+	project := &config.Project{Labels: map[string]string{"trust": "untrusted"}}
+	budget := config.SessionBudget{MaxSession: 30 * time.Minute}
+
+	data, err := json.Marshal(newSandboxInfo(env, project, budget))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"name":"app-a1b2","projectPath":"/Users/alice/app","path":"/Users/alice/app","labels":{"trust":"untrusted"},"limits":{"maxSessionSeconds":1800}}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+}
+
+func TestPublishSandboxInfo(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	m := newManagerWithExecutor(mock)
+	env := &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/app"}
+
+	if err := m.publishSandboxInfo(t.Context(), env, "4242", &config.Project{}); err != nil {
+		t.Fatalf("publishSandboxInfo failed: %v", err)
+	}
+
+	if !calledWith(mock, `t=$(sudo mktemp /envs/app-a1b2/sandbox/.info.XXXXXX)`) || !calledWith(mock, `sudo mv -f "$t" /envs/app-a1b2/sandbox/env.json`) {
+		t.Errorf("expected the metadata file to be written through a temporary file of its own, got %v", mock.calls)
+	}
+	if !calledWith(mock, "mount --bind /envs/app-a1b2/sandbox /run/llima-box && mount -o remount,bind,ro /run/llima-box") {
+		t.Errorf("expected a read-only mount in the namespace, got %v", mock.calls)
+	}
+}
+
+func TestEnterNamespace_SandboxInfo(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	m := newManagerWithExecutor(mock)
+	env := &Environment{Name: "app-a1b2", ProjectPath: t.TempDir()}
+
+	opts := EnterOptions{Budget: config.SessionBudget{MaxDaily: time.Hour}}
+	if err := m.EnterNamespace(t.Context(), env, nil, opts); err != nil {
+		t.Fatalf("EnterNamespace failed: %v", err)
+	}
+
+	// The session writes its own file, not the environment's
+	session := mock.calls[len(mock.calls)-1]
+	if strings.Contains(session, "/sandbox/env.json") {
+		t.Errorf("expected the session to leave the environment's metadata alone, got:\n%s", session)
+	}
+	write := `sudo mv -f "$t" /envs/app-a1b2/sandbox/sessions/$$.json`
+	if !strings.Contains(session, write) || !strings.Contains(session, `"maxDailySeconds":3600`) {
+		t.Errorf("expected the session to publish its limits in a file of its own, got:\n%s", session)
+	}
+	if !strings.Contains(session, SessionInfoVar+`="/run/llima-box/sessions/$$.json"`) {
+		t.Errorf("expected the session to be told its file, got:\n%s", session)
+	}
+	if !strings.Contains(session, "sudo rm -f /envs/app-a1b2/sandbox/sessions/$$.json") {
+		t.Errorf("expected the session's file to be removed when it ends, got:\n%s", session)
+	}
+}
@@ -0,0 +1,82 @@
+package env
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/dotenv"
+)
+
+// sessionVarsDir is the root-only VM directory passing session variables
+// (EnterOptions.Env) to sessions about to start. It's on tmpfs, so the
+// values never reach a disk, and each file is removed as its session starts.
+const sessionVarsDir = "/run/llima-box-sessions"
+
+// sourceVarsScript is the root shell script entering a session with
+// variables: it exports the assignments in the file $1, removes the file,
+// and runs the rest of its arguments. The values never appear on a command
+// line, where sudo would log them and other users could read them in /proc.
+const sourceVarsScript = `f=$1 && shift && set -a && . "$f" && set +a && rm -f "$f" && exec "$@"`
+
+// sessionVarsFile returns the contents of a session variable file: one
+// quoted shell assignment per variable
+func sessionVarsFile(vars []dotenv.Var) []byte {
+	var b bytes.Buffer
+	for _, v := range vars {
+		fmt.Fprintf(&b, "%s=%s\n", v.Key, shellquote.Quote(v.Value))
+	}
+	return b.Bytes()
+}
+
+// helperVarsFile returns the contents of a session variable file read by
+// the helper: a JSON list of NAME=VALUE variables
+func helperVarsFile(vars []dotenv.Var) []byte {
+	list := make([]string, len(vars))
+	for i, v := range vars {
+		list[i] = v.Key + "=" + v.Value
+	}
+	data, _ := json.Marshal(list)
+	return data
+}
+
+// writeSessionVarsCommand returns the command storing a session variable
+// file, read from standard input, at path
+func writeSessionVarsCommand(path string) string {
+	return "sudo sh -c " + shellquote.Quote(`umask 077 && mkdir -p `+sessionVarsDir+` && cat > "$1"`) + " sh " + shellWord(path)
+}
+
+// writeSessionVars passes opts.Env to the session in a file of its own,
+// returning opts pointing at it. Sessions without variables need no file.
+func (m *Manager) writeSessionVars(ctx context.Context, opts EnterOptions) (EnterOptions, error) {
+	if len(opts.Env) == 0 {
+		return opts, nil
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return opts, fmt.Errorf("failed to name the session variable file: %w", err)
+	}
+	path := sessionVarsDir + "/" + hex.EncodeToString(id)
+	data := sessionVarsFile(opts.Env)
+	if opts.helper {
+		data = helperVarsFile(opts.Env)
+	}
+	if _, err := m.sshClient.ExecContextInput(ctx, writeSessionVarsCommand(path), bytes.NewReader(data)); err != nil {
+		return opts, fmt.Errorf("failed to pass session variables: %w", err)
+	}
+	opts.varsFile = path
+	return opts, nil
+}
+
+// removeSessionVars removes the variable file of a session that may not
+// have started, and so not have removed it itself
+func (m *Manager) removeSessionVars(opts EnterOptions) {
+	if opts.varsFile == "" {
+		return
+	}
+	_, _ = m.sshClient.ExecContext(context.Background(), "sudo rm -f "+shellWord(opts.varsFile))
+}
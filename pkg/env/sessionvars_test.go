@@ -0,0 +1,51 @@
+package env
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/dotenv"
+)
+
+func TestEnterNamespace_SessionVars(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	m := newManagerWithExecutor(mock)
+	env := &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/app"}
+
+	opts := EnterOptions{Env: []dotenv.Var{{Key: "API_TOKEN", Value: "it's secret"}}}
+	if err := m.EnterNamespace(t.Context(), env, []string{"make"}, opts); err != nil {
+		t.Fatalf("EnterNamespace failed: %v", err)
+	}
+
+	if len(mock.calls) != 2 {
+		t.Fatalf("expected the variables to be written, then the session, got %v", mock.calls)
+	}
+	for _, call := range mock.calls {
+		if strings.Contains(call, "secret") {
+			t.Errorf("a variable's value is on the command line:\n%s", call)
+		}
+	}
+
+	write := mock.calls[0]
+	if got, want := string(mock.inputs[write]), "API_TOKEN='it'\\''s secret'\n"; got != want {
+		t.Errorf("session variable file = %q, want %q", got, want)
+	}
+	path := write[strings.LastIndex(write, " ")+1:]
+	if !strings.HasPrefix(path, sessionVarsDir+"/") {
+		t.Fatalf("expected the file in %s, got: %s", sessionVarsDir, write)
+	}
+	session := mock.calls[1]
+	if !strings.Contains(session, " sh "+path+" nsenter ") || !strings.Contains(session, "--whitelist-environment="+SessionInfoVar+",API_TOKEN ") {
+		t.Errorf("expected the session to read %s, got:\n%s", path, session)
+	}
+}
+
+func TestEnterCommand_NeedsVarsFile(t *testing.T) {
+	env := &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/app"}
+	opts := EnterOptions{Env: []dotenv.Var{{Key: "API_TOKEN", Value: "secret"}}}
+	if _, err := EnterCommand(env, &config.Project{}, nil, opts); err == nil {
+		t.Error("expected an error for variables without a session variable file")
+	}
+}
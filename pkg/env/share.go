@@ -0,0 +1,123 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+)
+
+// shareMountRoot is where shared directories appear in the receiving environment
+const shareMountRoot = "/shared"
+
+// hostMountFSTypes are the filesystem types of the host directories Lima
+// mounts into the VM, as findmnt reports them
+var hostMountFSTypes = map[string]bool{"virtiofs": true, "9p": true, "fuse.sshfs": true}
+
+// ShareMountPoint returns where dir from src appears inside the environment it
+// is shared with: /shared/<src-name>/<basename>
+func ShareMountPoint(src *Environment, dir string) string {
+	return path.Join(shareMountRoot, src.Name, path.Base(resolveEnvPath(src, dir)))
+}
+
+// resolveEnvPath resolves a path relative to the environment's project directory
+func resolveEnvPath(env *Environment, p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join(env.dir(), p)
+}
+
+// Share bind-mounts dir from src into peer at ShareMountPoint, read-only unless
+// writable is set. The peer user is granted access through POSIX ACLs, so no
+// other environment gains access; directories on host mounts, which don't
+// support them, are refused. Callers are responsible for obtaining the
+// user's consent before sharing.
+//
+// The directory is resolved in src's namespace and then mounted from peer's
+// namespace; both derive from the VM root, so project and home paths resolve
+// to the same files in each.
+func (m *Manager) Share(ctx context.Context, src, peer *Environment, dir string, writable bool) (string, error) {
+	if src.Name == peer.Name {
+		return "", fmt.Errorf("cannot share a directory with its own environment")
+	}
+
+	if err := m.ensureSSH(ctx); err != nil {
+		return "", err
+	}
+
+	for _, e := range []*Environment{src, peer} {
+		exists, err := m.Exists(ctx, e.Name)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return "", fmt.Errorf("environment %s does not exist", e.Name)
+		}
+	}
+
+	dir = resolveEnvPath(src, dir)
+	mountPoint := ShareMountPoint(src, dir)
+
+	// The directory must exist in the source environment
+	if _, err := m.sshClient.ExecContext(ctx, NewRemoteRunner(src.Name).Script("test -d "+shellquote.Quote(dir))); err != nil {
+		return "", fmt.Errorf("%s is not a directory in environment %s", dir, src.Name)
+	}
+
+	// Lima's host mounts don't support the ACLs granting access
+	output, err := m.sshClient.ExecContext(ctx, NewRemoteRunner(src.Name).Command("findmnt", "-n", "-o", "FSTYPE", "-T", dir))
+	if err != nil {
+		return "", fmt.Errorf("failed to check the filesystem of %s: %w", dir, err)
+	}
+	if fsType := strings.TrimSpace(output); hostMountFSTypes[fsType] {
+		return "", fmt.Errorf("cannot share %s: it's on a host mount (%s), which doesn't support the ACLs sharing relies on; "+
+			"share a directory on the VM's disk instead, such as one in the environment's home directory or an overlay workspace", dir, fsType)
+	}
+
+	// Grant the peer user access, including to files created later
+	perms := "rX"
+	if writable {
+		perms = "rwX"
+	}
+	acl := fmt.Sprintf("u:%[1]s:%[2]s,d:u:%[1]s:%[2]s", peer.Name, perms)
+	if output, err := m.sshClient.ExecContext(ctx, NewRemoteRunner(src.Name).Script(fmt.Sprintf("setfacl -R -m %s %s", acl, shellquote.Quote(dir)))); err != nil {
+		return "", fmt.Errorf("failed to grant %s access to %s: %w (output: %s)", peer.Name, dir, err, output)
+	}
+
+	// Mount it into the peer's namespace
+	script := fmt.Sprintf("mkdir -p %[2]s && mount --bind %[1]s %[2]s", shellquote.Quote(dir), shellquote.Quote(mountPoint))
+	if !writable {
+		script += fmt.Sprintf(" && mount -o remount,bind,ro %s", shellquote.Quote(mountPoint))
+	}
+	if output, err := m.sshClient.ExecContext(ctx, NewRemoteRunner(peer.Name).Script(script)); err != nil {
+		return "", fmt.Errorf("failed to mount shared directory: %w (output: %s)", err, output)
+	}
+
+	return mountPoint, nil
+}
+
+// Unshare removes a directory previously shared from src with peer and
+// revokes the peer user's access
+func (m *Manager) Unshare(ctx context.Context, src, peer *Environment, dir string) error {
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+
+	dir = resolveEnvPath(src, dir)
+	mountPoint := ShareMountPoint(src, dir)
+
+	// Unmount first so the peer loses access even if ACL removal fails
+	script := fmt.Sprintf("umount %[1]s && rmdir %[1]s", shellquote.Quote(mountPoint))
+	if output, err := m.sshClient.ExecContext(ctx, NewRemoteRunner(peer.Name).Script(script)); err != nil {
+		return fmt.Errorf("failed to unmount shared directory: %w (output: %s)", err, output)
+	}
+
+	acl := fmt.Sprintf("u:%[1]s,d:u:%[1]s", peer.Name)
+	if output, err := m.sshClient.ExecContext(ctx, NewRemoteRunner(src.Name).Script(fmt.Sprintf("setfacl -R -x %s %s", acl, shellquote.Quote(dir)))); err != nil {
+		return fmt.Errorf("failed to revoke %s access to %s: %w (output: %s)", peer.Name, dir, err, output)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestShareMountPoint(t *testing.T) {
+	src := &Environment{Name: "planner-a1b2", ProjectPath: "/Users/alice/planner"}
+
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{dir: "artifacts", want: "/shared/planner-a1b2/artifacts"},
+		{dir: "out/build/", want: "/shared/planner-a1b2/build"},
+		{dir: "/tmp/handoff", want: "/shared/planner-a1b2/handoff"},
+	}
+
+	for _, tt := range tests {
+		if got := ShareMountPoint(src, tt.dir); got != tt.want {
+			t.Errorf("ShareMountPoint(%q) = %s, want %s", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestShare(t *testing.T) {
+	src := &Environment{Name: "planner-a1b2", ProjectPath: "/Users/alice/planner"}
+	peer := &Environment{Name: "executor-c3d4", ProjectPath: "/Users/alice/executor"}
+
+	tests := []struct {
+		name     string
+		writable bool
+		wantACL  string
+		wantRO   bool
+	}{
+		{name: "read-only", writable: false, wantACL: "u:executor-c3d4:rX,d:u:executor-c3d4:rX", wantRO: true},
+		{name: "writable", writable: true, wantACL: "u:executor-c3d4:rwX,d:u:executor-c3d4:rwX", wantRO: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+
+			mgr := newManagerWithExecutor(mock)
+			mountPoint, err := mgr.Share(context.Background(), src, peer, "artifacts", tt.writable)
+			if err != nil {
+				t.Fatalf("Share failed: %v", err)
+			}
+			if mountPoint != "/shared/planner-a1b2/artifacts" {
+				t.Errorf("unexpected mount point %s", mountPoint)
+			}
+
+			all := strings.Join(mock.calls, "\n")
+			if !strings.Contains(all, tt.wantACL) {
+				t.Errorf("expected ACL %s in commands:\n%s", tt.wantACL, all)
+			}
+			if strings.Contains(all, "remount,bind,ro") != tt.wantRO {
+				t.Errorf("expected read-only remount=%v in commands:\n%s", tt.wantRO, all)
+			}
+
+			last := mock.calls[len(mock.calls)-1]
+			if !strings.Contains(last, "/envs/executor-c3d4/namespace.pid") {
+				t.Errorf("expected mount to run in peer namespace: %s", last)
+			}
+		})
+	}
+}
+
+func TestShare_Errors(t *testing.T) {
+	src := &Environment{Name: "planner-a1b2", ProjectPath: "/Users/alice/planner"}
+	peer := &Environment{Name: "executor-c3d4", ProjectPath: "/Users/alice/executor"}
+
+	t.Run("same environment", func(t *testing.T) {
+		mgr := newManagerWithExecutor(newMockExecutor())
+		if _, err := mgr.Share(context.Background(), src, src, "artifacts", false); err == nil {
+			t.Error("expected error sharing with self")
+		}
+	})
+
+	t.Run("peer missing", func(t *testing.T) {
+		mock := newMockExecutor()
+		mock.allowUnexpected = true
+		mock.setError(existsCommand(peer.Name), fmt.Errorf("exit status 1"))
+
+		mgr := newManagerWithExecutor(mock)
+		_, err := mgr.Share(context.Background(), src, peer, "artifacts", false)
+		if err == nil || !strings.Contains(err.Error(), "executor-c3d4 does not exist") {
+			t.Errorf("expected missing peer error, got: %v", err)
+		}
+	})
+
+	t.Run("not a directory", func(t *testing.T) {
+		mock := newMockExecutor()
+		mock.allowUnexpected = true
+		mock.setError(NewRemoteRunner(src.Name).Script("test -d '/Users/alice/planner/artifacts'"), fmt.Errorf("exit status 1"))
+
+		mgr := newManagerWithExecutor(mock)
+		_, err := mgr.Share(context.Background(), src, peer, "artifacts", false)
+		if err == nil || !strings.Contains(err.Error(), "is not a directory") {
+			t.Errorf("expected not a directory error, got: %v", err)
+		}
+	})
+
+	t.Run("host mount", func(t *testing.T) {
+		mock := newMockExecutor()
+		mock.allowUnexpected = true
+		mock.setResponse(NewRemoteRunner(src.Name).Command("findmnt", "-n", "-o", "FSTYPE", "-T", "/Users/alice/planner/artifacts"), "virtiofs\n")
+
+		mgr := newManagerWithExecutor(mock)
+		_, err := mgr.Share(context.Background(), src, peer, "artifacts", false)
+		if err == nil || !strings.Contains(err.Error(), "host mount (virtiofs)") {
+			t.Errorf("expected host mount error, got: %v", err)
+		}
+		if calledWith(mock, "setfacl") {
+			t.Errorf("expected no ACL changes, got calls %v", mock.calls)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package env
+
+import (
+	"context"
+	"fmt"
+)
+
+// pausedPath returns the marker file of an environment stopped with Stop.
+// Environments with it are left alone when stale namespaces are restarted
+// after a VM restart.
+func pausedPath(envName string) string {
+	return envDir(envName) + "/paused"
+}
+
+// clearNamespaceCommand removes what's left of an environment's previous
+// namespace before a new keeper starts: its PID file and the markers saying
+// why it isn't running
+func clearNamespaceCommand(envName string) string {
+	return fmt.Sprintf("sudo rm -f %s/namespace.pid %s %s", envDir(envName), needsRepairPath(envName), pausedPath(envName))
+}
+
+// StopCommands returns the commands stopping an environment: it's marked as
+// paused first, so an interrupted stop isn't undone by recovery, then its
+// processes and namespace keeper are killed. The user account, home
+// directory, and metadata are kept.
+func StopCommands(envName string) []RemoteCommand {
+	return []RemoteCommand{
+		{
+			Purpose: "mark environment as paused",
+			Script:  fmt.Sprintf("sudo touch %s", pausedPath(envName)),
+		},
+		{
+			Purpose:    "kill environment processes",
+			Script:     fmt.Sprintf("sudo pkill -u %s || true", envName),
+			BestEffort: true,
+		},
+		stopKeeperCommand(envName),
+	}
+}
+
+// stopKeeperCommand returns the command killing an environment's namespace
+// keeper and removing its PID file. The namespace, with its mounts, goes
+// away with the last process in it.
+func stopKeeperCommand(envName string) RemoteCommand {
+	return RemoteCommand{
+		Purpose: "stop namespace keeper",
+		Script:  fmt.Sprintf(`pid=$(sudo cat %[1]s 2>/dev/null) && [ -n "$pid" ] && sudo kill "$pid"; sudo rm -f %[1]s`, envDir(envName)+"/namespace.pid"),
+	}
+}
+
+// Stop kills an environment's processes and namespace, keeping its user
+// account, home directory, and metadata, so Resume can bring it back as it
+// was. A stopped environment is listed as paused; it isn't restarted after a
+// VM restart, but creating it again, as shell does, resumes it.
+func (m *Manager) Stop(ctx context.Context, envName string) error {
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+
+	unlock, err := m.locks.lock(ctx, envName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("[ -d %s ]", envDir(envName))); err != nil {
+		return fmt.Errorf("environment %s does not exist", envName)
+	}
+	if err := m.checkNotQuarantined(ctx, envName); err != nil {
+		return err
+	}
+
+	m.probes.invalidate()
+	m.debugf(envName, "Stopping %s", envName)
+	return m.runCommands(ctx, StopCommands(envName))
+}
+
+// Resume restarts the namespace of an environment stopped with Stop, or
+// whose namespace died, and mounts the project and toolchains in it again.
+// It does nothing if the environment is running.
+func (m *Manager) Resume(ctx context.Context, envName string) error {
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+
+	unlock, err := m.locks.lock(ctx, envName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := m.sshClient.ExecContext(ctx, fmt.Sprintf("[ -d %s ]", envDir(envName))); err != nil {
+		return fmt.Errorf("environment %s does not exist", envName)
+	}
+	if err := m.checkNotQuarantined(ctx, envName); err != nil {
+		return err
+	}
+
+	m.probes.invalidate()
+	if running, _ := m.Exists(ctx, envName); running {
+		return nil
+	}
+
+	// An interrupted resume is finished like an interrupted repair
+	done, err := m.journal.begin(journalEntry{Op: opRepair, Env: envName})
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	m.debugf(envName, "Resuming %s", envName)
+	return m.restartEnvironment(ctx, envName)
+}
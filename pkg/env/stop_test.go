@@ -0,0 +1,85 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGolden_Stop(t *testing.T) {
+	checkGolden(t, "stop", formatCommands(StopCommands("app-a1b2")))
+}
+
+func TestStop(t *testing.T) {
+	tests := []struct {
+		name      string
+		missing   bool
+		wantErr   string
+		wantCalls int
+	}{
+		{name: "existing environment", wantCalls: 1},
+		{name: "missing environment", missing: true, wantErr: "does not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			if tt.missing {
+				mock.setError("[ -d /envs/app-a1b2 ]", fmt.Errorf("exit status 1"))
+			}
+
+			err := newManagerWithExecutor(mock).Stop(context.Background(), "app-a1b2")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Stop() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Stop() failed: %v", err)
+			}
+
+			for _, c := range StopCommands("app-a1b2") {
+				if got := mock.callCount(c.Script); got != tt.wantCalls {
+					t.Errorf("%s ran %d times, want %d", c.Purpose, got, tt.wantCalls)
+				}
+			}
+		})
+	}
+}
+
+func TestResume(t *testing.T) {
+	projectPath := t.TempDir()
+	keeper := StartNamespaceCommands("app-a1b2")[1].Script
+
+	tests := []struct {
+		name        string
+		running     bool
+		wantRestart bool
+	}{
+		{name: "paused", wantRestart: true},
+		{name: "already running", running: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.allowUnexpected = true
+			mock.setResponse(readMetadataCommand("app-a1b2"), fmt.Sprintf(`{"projectPath":%q}`, projectPath))
+			if !tt.running {
+				mock.setError(existsCommand("app-a1b2"), fmt.Errorf("exit status 1"))
+			}
+
+			if err := newManagerWithExecutor(mock).Resume(context.Background(), "app-a1b2"); err != nil {
+				t.Fatalf("Resume() failed: %v", err)
+			}
+
+			if restarted := mock.callCount(keeper) == 1; restarted != tt.wantRestart {
+				t.Errorf("namespace keeper restarted = %v, want %v", restarted, tt.wantRestart)
+			}
+			if cleared := mock.callCount(clearNamespaceCommand("app-a1b2")) == 1; cleared != tt.wantRestart {
+				t.Errorf("paused marker cleared = %v, want %v", cleared, tt.wantRestart)
+			}
+		})
+	}
+}
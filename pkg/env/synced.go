@@ -0,0 +1,114 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrSyncedProjectPath is returned when a new environment's project
+// directory is in a folder a cloud storage client syncs, unless
+// Options.AllowSynced is set
+var ErrSyncedProjectPath = errors.New("project directory is in a cloud-synced folder")
+
+// WarningSyncedFolder is the Code of the warning about an existing
+// environment whose project directory is in a cloud-synced folder
+const WarningSyncedFolder = "synced-folder"
+
+// syncedFolders are the home-relative folders cloud storage clients sync,
+// by service. Entries ending in "*" match any folder starting with the rest,
+// such as "OneDrive - Contoso" or "Dropbox (Personal)".
+var syncedFolders = []struct {
+	service string
+	folder  string
+}{
+	{"Dropbox", "Dropbox"},
+	{"Dropbox", "Dropbox (*"},
+	{"Dropbox", "Library/CloudStorage/Dropbox*"},
+	{"iCloud Drive", "Library/Mobile Documents"},
+	{"iCloud Drive", "iCloud Drive"},
+	{"OneDrive", "OneDrive"},
+	{"OneDrive", "OneDrive - *"},
+	{"OneDrive", "Library/CloudStorage/OneDrive-*"},
+	{"Google Drive", "Google Drive"},
+	{"Google Drive", "My Drive"},
+	{"Google Drive", "Library/CloudStorage/GoogleDrive-*"},
+	{"a cloud storage provider", "Library/CloudStorage/*"},
+}
+
+// syncedFolder returns the service syncing projectPath and the synced
+// folder it's in, or empty strings if it isn't in one. Both paths must be
+// canonical.
+func syncedFolder(projectPath, home string) (service, folder string) {
+	rel, err := filepath.Rel(home, projectPath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", ""
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for _, s := range syncedFolders {
+		want := strings.Split(s.folder, "/")
+		if len(parts) < len(want) {
+			continue
+		}
+		if matchFolder(parts[:len(want)], want) {
+			return s.service, filepath.Join(home, filepath.Join(parts[:len(want)]...))
+		}
+	}
+	return "", ""
+}
+
+// matchFolder reports whether path components match a syncedFolders
+// pattern, ignoring case like the hosts that run these clients
+func matchFolder(parts, want []string) bool {
+	for i, w := range want {
+		if prefix, ok := strings.CutSuffix(w, "*"); ok {
+			if len(parts[i]) < len(prefix) || !strings.EqualFold(parts[i][:len(prefix)], prefix) {
+				return false
+			}
+			continue
+		}
+		if !strings.EqualFold(parts[i], w) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSyncedPath looks for env's project directory in a cloud-synced
+// folder. The environment writes to the host project through its mount, and
+// the sync client sends those writes to the cloud and other devices, where
+// they conflict with edits made there and leave the sandbox. A new
+// environment is refused unless Options.AllowSynced is set; an existing one
+// gets a warning. Environments whose writes stay in the VM, like overlay
+// environments, are fine.
+func (m *Manager) checkSyncedPath(env *Environment, isNew bool) error {
+	if !env.Mount().WritesHost() || m.options.AllowSynced {
+		return nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	if home, err = m.paths.Canonical(home); err != nil {
+		return nil
+	}
+	service, folder := syncedFolder(env.ProjectPath, home)
+	if service == "" {
+		return nil
+	}
+
+	if isNew {
+		return fmt.Errorf("%w: %s is synced by %s (%s); changes the environment makes would be uploaded and could conflict with other devices. "+
+			"Move the project, use an overlay, or allow it with --allow-synced", ErrSyncedProjectPath, env.ProjectPath, service, folder)
+	}
+	m.options.Progress.emit(Event{
+		Level:       EventWarning,
+		Environment: env.Name,
+		Code:        WarningSyncedFolder,
+		Message: fmt.Sprintf("%s is synced by %s (%s); changes made in %s are uploaded and could conflict with other devices",
+			env.ProjectPath, service, folder, env.Name),
+	})
+	return nil
+}
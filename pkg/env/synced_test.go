@@ -0,0 +1,91 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+func TestSyncedFolder(t *testing.T) {
+	home := "/Users/alice"
+	tests := []struct {
+		path        string
+		wantService string
+		wantFolder  string
+	}{
+		{path: "/Users/alice/src/app"},
+		{path: "/Users/alice/Dropbox/src/app", wantService: "Dropbox", wantFolder: "/Users/alice/Dropbox"},
+		{path: "/Users/alice/Dropbox (Personal)/app", wantService: "Dropbox", wantFolder: "/Users/alice/Dropbox (Personal)"},
+		{path: "/Users/alice/dropbox/app", wantService: "Dropbox", wantFolder: "/Users/alice/dropbox"},
+		{path: "/Users/alice/DropboxTools/app"},
+		{path: "/Users/alice/OneDrive - Contoso/app", wantService: "OneDrive", wantFolder: "/Users/alice/OneDrive - Contoso"},
+		{
+			path:        "/Users/alice/Library/Mobile Documents/com~apple~CloudDocs/app",
+			wantService: "iCloud Drive",
+			wantFolder:  "/Users/alice/Library/Mobile Documents",
+		},
+		{
+			path:        "/Users/alice/Library/CloudStorage/GoogleDrive-alice@example.com/My Drive/app",
+			wantService: "Google Drive",
+			wantFolder:  "/Users/alice/Library/CloudStorage/GoogleDrive-alice@example.com",
+		},
+		{
+			path:        "/Users/alice/Library/CloudStorage/Box-Box/app",
+			wantService: "a cloud storage provider",
+			wantFolder:  "/Users/alice/Library/CloudStorage/Box-Box",
+		},
+		{path: "/Users/alice/Library/Caches/app"},
+		{path: "/opt/Dropbox/app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			service, folder := syncedFolder(tt.path, home)
+			if service != tt.wantService || folder != tt.wantFolder {
+				t.Errorf("syncedFolder() = %q, %q, want %q, %q", service, folder, tt.wantService, tt.wantFolder)
+			}
+		})
+	}
+}
+
+func TestCheckSyncedPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if resolved, err := filepath.EvalSymlinks(home); err == nil {
+		home = resolved
+	}
+	projectPath := filepath.Join(home, "Dropbox", "app")
+	if err := os.MkdirAll(projectPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	env := &Environment{Name: "app-a1b2", ProjectPath: projectPath}
+
+	m := newManagerWithExecutor(newMockExecutor())
+	var events []Event
+	m.options.Progress = func(e Event) { events = append(events, e) }
+
+	if err := m.checkSyncedPath(env, true); !errors.Is(err, ErrSyncedProjectPath) {
+		t.Errorf("expected ErrSyncedProjectPath for a new environment, got %v", err)
+	}
+
+	if err := m.checkSyncedPath(env, false); err != nil {
+		t.Errorf("expected only a warning for an existing environment, got %v", err)
+	}
+	if len(events) != 1 || events[0].Code != WarningSyncedFolder {
+		t.Errorf("expected a %s warning, got %+v", WarningSyncedFolder, events)
+	}
+
+	m.options.AllowSynced = true
+	if err := m.checkSyncedPath(env, true); err != nil {
+		t.Errorf("expected AllowSynced to allow the environment, got %v", err)
+	}
+
+	m.options.AllowSynced = false
+	env.Driver = config.WorkspaceOverlay
+	if err := m.checkSyncedPath(env, true); err != nil {
+		t.Errorf("expected an overlay environment to be allowed, got %v", err)
+	}
+}
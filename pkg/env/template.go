@@ -0,0 +1,49 @@
+package env
+
+import (
+	"regexp"
+	"strings"
+)
+
+// templateVariable matches the variables a command template can use
+var templateVariable = regexp.MustCompile(`\{(args|project|env)\}`)
+
+// ExpandCommand expands a project command template into a shell command
+// line for env. Templates can use:
+//
+//   - {args}: the extra arguments, each quoted as one shell word
+//   - {project}: the project directory inside the VM
+//   - {env}: the environment name
+//
+// Other braces are left alone, so shell syntax like ${HOME} or awk programs
+// pass through unchanged. A template without {args} gets the extra arguments
+// appended, like npm run.
+func ExpandCommand(template string, env *Environment, args []string) string {
+	values := map[string]string{
+		"args":    shellJoin(args),
+		"project": shellWord(env.dir()),
+		"env":     env.Name,
+	}
+
+	var b strings.Builder
+	usesArgs := false
+	last := 0
+	for _, m := range templateVariable.FindAllStringSubmatchIndex(template, -1) {
+		// ${args} and friends are shell parameters, not template variables
+		if m[0] > 0 && template[m[0]-1] == '$' {
+			continue
+		}
+		name := template[m[2]:m[3]]
+		usesArgs = usesArgs || name == "args"
+		b.WriteString(template[last:m[0]])
+		b.WriteString(values[name])
+		last = m[1]
+	}
+	b.WriteString(template[last:])
+
+	command := strings.TrimSpace(b.String())
+	if !usesArgs && len(args) > 0 {
+		command += " " + shellJoin(args)
+	}
+	return command
+}
@@ -0,0 +1,57 @@
+package env
+
+import "testing"
+
+func TestExpandCommand(t *testing.T) {
+	env := &Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/my app"}
+
+	tests := []struct {
+		name     string
+		template string
+		args     []string
+		want     string
+	}{
+		{
+			name:     "args",
+			template: "pytest {args}",
+			args:     []string{"-k", "foo and not bar"},
+			want:     "pytest -k 'foo and not bar'",
+		},
+		{
+			name:     "no args",
+			template: "pytest {args}",
+			want:     "pytest",
+		},
+		{
+			name:     "args appended without placeholder",
+			template: "npm run build",
+			args:     []string{"--watch"},
+			want:     "npm run build --watch",
+		},
+		{
+			name:     "project and env",
+			template: "tar -czf /tmp/{env}.tgz -C {project} .",
+			want:     "tar -czf /tmp/app-a1b2.tgz -C '/Users/alice/my app' .",
+		},
+		{
+			name:     "args quoted against injection",
+			template: "echo {args}",
+			args:     []string{"$(reboot)"},
+			want:     "echo '$(reboot)'",
+		},
+		{
+			name:     "shell braces left alone",
+			template: `echo ${args} ${HOME} && awk '{print $1}' {args}`,
+			args:     []string{"f.txt"},
+			want:     `echo ${args} ${HOME} && awk '{print $1}' f.txt`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExpandCommand(tt.template, env, tt.args); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
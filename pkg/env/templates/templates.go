@@ -0,0 +1,280 @@
+// Package templates provides environment templates: named sets of apt
+// packages, environment variables, read-only mounts, and a setup script that
+// preconfigure a new environment, as in `llima-box shell --template
+// python-ml`.
+//
+// Templates are YAML files in the templates directory of the llima-box
+// configuration directory (~/.config/llima-box/templates/<name>.yaml):
+//
+//	description: Python for data science
+//	packages: [python3-venv, python3-dev]
+//	env:
+//	  PYTHONUNBUFFERED: "1"
+//	mounts:
+//	  - path: ~/datasets
+//	setup: |
+//	  python3 -m venv "$HOME/.venv"
+//
+// A few templates are built in; a file with the same name replaces one.
+package templates
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/dockerfile"
+	"github.com/middlendian/llima-box/pkg/dotenv"
+)
+
+// ErrNotFound is returned by Load for a template that isn't built in or in
+// the templates directory
+var ErrNotFound = errors.New("template not found")
+
+// fileExt is the extension of template files
+const fileExt = ".yaml"
+
+var (
+	// namePattern restricts template names to safe file name components
+	namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+	// varPattern matches environment variable names
+	varPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// mountNamePattern matches directory names under the reference mount
+	// root
+	mountNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+//go:embed builtin/*.yaml
+var builtin embed.FS
+
+// Template preconfigures new environments. Templates only apply when an
+// environment is created; the environment keeps a copy, so editing or
+// removing the file later doesn't change it.
+type Template struct {
+	// Name is the template name, from its file name
+	Name string `yaml:"-" json:"name"`
+
+	// Description says what the template sets up
+	Description string `yaml:"description" json:"description,omitempty"`
+
+	// Packages are apt packages installed in the VM, like those imported
+	// from a project's Dockerfile
+	Packages []string `yaml:"packages" json:"packages,omitempty"`
+
+	// Env holds variables exported in the environment's sessions. Values are
+	// used as they are, without expansion.
+	Env map[string]string `yaml:"env" json:"env,omitempty"`
+
+	// Mounts are host directories mounted read-only into the environment,
+	// like the host configuration's references
+	Mounts []Mount `yaml:"mounts" json:"mounts,omitempty"`
+
+	// Setup is a bash script run once in the new environment, as its user
+	// and from the project directory, before the project's own setup script
+	Setup string `yaml:"setup" json:"setup,omitempty"`
+}
+
+// Mount is a host directory a template mounts read-only into environments
+// under /mnt/ref
+type Mount struct {
+	// Name is the directory name under /mnt/ref (default: the base name of
+	// Path)
+	Name string `yaml:"name" json:"name,omitempty"`
+
+	// Path is the host directory ("~/" is expanded). It must be under a VM
+	// mount and not a denied path.
+	Path string `yaml:"path" json:"path"`
+}
+
+// MountName returns the directory name the mount appears under
+func (m Mount) MountName() string {
+	if m.Name != "" {
+		return m.Name
+	}
+	return filepath.Base(filepath.Clean(m.Path))
+}
+
+// Dir returns the directory holding the user's templates (default:
+// ~/.config/llima-box/templates)
+func Dir() (string, error) {
+	dir, err := config.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "templates"), nil
+}
+
+// Load returns the named template from the templates directory, or the
+// built-in template of that name
+func Load(name string) (*Template, error) {
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid template name %q", name)
+	}
+
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	t, err := loadFile(filepath.Join(dir, name+fileExt))
+	if !errors.Is(err, os.ErrNotExist) {
+		return t, err
+	}
+
+	t, err = loadBuiltin(name)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return t, err
+	}
+
+	return nil, fmt.Errorf("%w: %s (available: %s)", ErrNotFound, name, strings.Join(names(dir), ", "))
+}
+
+// names returns the names of the built-in templates and the template files
+// in dir, sorted, without loading them
+func names(dir string) []string {
+	seen := make(map[string]bool)
+	builtins, _ := fs.ReadDir(builtin, "builtin")
+	files, _ := os.ReadDir(dir)
+	for _, e := range append(builtins, files...) {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), fileExt) {
+			seen[strings.TrimSuffix(e.Name(), fileExt)] = true
+		}
+	}
+
+	list := make([]string, 0, len(seen))
+	for name := range seen {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// List returns the built-in templates and those in the templates directory,
+// sorted by name
+func List() ([]*Template, error) {
+	byName := make(map[string]*Template)
+
+	entries, err := fs.ReadDir(builtin, "builtin")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read built-in templates: %w", err)
+	}
+	for _, e := range entries {
+		t, err := loadBuiltin(strings.TrimSuffix(e.Name(), fileExt))
+		if err != nil {
+			return nil, err
+		}
+		byName[t.Name] = t
+	}
+
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err = os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read templates directory: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), fileExt) {
+			continue
+		}
+		t, err := loadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		byName[t.Name] = t
+	}
+
+	templates := make([]*Template, 0, len(byName))
+	for _, t := range byName {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// loadFile loads the template file at path
+func loadFile(path string) (*Template, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- a template in the user's configuration directory
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	return parse(strings.TrimSuffix(filepath.Base(path), fileExt), path, data)
+}
+
+// loadBuiltin loads the named built-in template
+func loadBuiltin(name string) (*Template, error) {
+	path := "builtin/" + name + fileExt
+	data, err := builtin.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse(name, path, data)
+}
+
+// parse decodes and validates the template called name, read from path
+func parse(name, path string, data []byte) (*Template, error) {
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid template name %q (from %s)", name, path)
+	}
+	t := &Template{Name: name}
+	if err := config.DecodeFile(path, data, t, t.Validate); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Validate checks the template for errors
+func (t *Template) Validate() error {
+	for i, pkg := range t.Packages {
+		if !dockerfile.ValidPackage(pkg) {
+			return fmt.Errorf("packages[%d]: invalid package name %q", i, pkg)
+		}
+	}
+
+	for key := range t.Env {
+		if !varPattern.MatchString(key) {
+			return fmt.Errorf("env: invalid variable name %q", key)
+		}
+		if strings.HasPrefix(key, "LLIMA_BOX_") {
+			return fmt.Errorf("env: %s is set by llima-box", key)
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, m := range t.Mounts {
+		if !strings.HasPrefix(m.Path, "~/") && !filepath.IsAbs(m.Path) {
+			return fmt.Errorf("mounts[%d]: path %q must be absolute or start with ~/", i, m.Path)
+		}
+		name := m.MountName()
+		if !mountNamePattern.MatchString(name) {
+			return fmt.Errorf("mounts[%d]: invalid name %q", i, name)
+		}
+		if names[name] {
+			return fmt.Errorf("mounts[%d]: duplicate name %q", i, name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// Vars returns the template's variables, sorted by name
+func (t *Template) Vars() []dotenv.Var {
+	vars := make([]dotenv.Var, 0, len(t.Env))
+	for k, v := range t.Env {
+		vars = append(vars, dotenv.Var{Key: k, Value: v})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Key < vars[j].Key })
+	return vars
+}
@@ -0,0 +1,130 @@
+package templates
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTemplate writes a template file to the templates directory
+func writeTemplate(t *testing.T, name, content string) {
+	t.Helper()
+	dir, err := Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+fileExt), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	writeTemplate(t, "rust", "description: Rust\npackages: [cargo]\nenv:\n  CARGO_TERM_COLOR: always\nmounts:\n  - path: ~/crates\n")
+	writeTemplate(t, "node", "description: Node from the team\npackages: [nodejs]\n")
+	writeTemplate(t, "broken", "packages: [cargo]\nenv:\n  LLIMA_BOX_ENV: x\n")
+
+	tests := []struct {
+		name     string
+		template string
+		wantDesc string
+		wantErr  string
+		notFound bool
+	}{
+		{name: "user template", template: "rust", wantDesc: "Rust"},
+		{name: "built-in template", template: "python-ml", wantDesc: "Python with a virtual environment"},
+		{name: "user template replaces built-in", template: "node", wantDesc: "Node from the team"},
+		{name: "not found", template: "cobol", wantErr: "available: broken, node, python-ml, rust", notFound: true},
+		{name: "invalid name", template: "../rust", wantErr: "invalid template name"},
+		{name: "invalid template", template: "broken", wantErr: "broken.yaml:2: env: LLIMA_BOX_ENV is set by llima-box"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Load(tt.template)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || errors.Is(err, ErrNotFound) != tt.notFound {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if tmpl.Name != tt.template || !strings.HasPrefix(tmpl.Description, tt.wantDesc) {
+				t.Errorf("expected template %s described as %q, got %+v", tt.template, tt.wantDesc, tmpl)
+			}
+		})
+	}
+}
+
+func TestList_BuiltinTemplatesAreValid(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	all, err := List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var names []string
+	for _, tmpl := range all {
+		names = append(names, tmpl.Name)
+		if tmpl.Description == "" {
+			t.Errorf("built-in template %s has no description", tmpl.Name)
+		}
+	}
+	if strings.Join(names, ",") != "node,python-ml" {
+		t.Errorf("expected the built-in templates, got %v", names)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    Template
+		wantErr string
+	}{
+		{
+			name: "valid",
+			tmpl: Template{
+				Packages: []string{"python3-venv", "libssl-dev=3.0.2-0ubuntu1"},
+				Env:      map[string]string{"PYTHONUNBUFFERED": "1"},
+				Mounts:   []Mount{{Path: "~/datasets"}, {Name: "api", Path: "/work/api"}},
+			},
+		},
+		{name: "package option", tmpl: Template{Packages: []string{"-y"}}, wantErr: "packages[0]: invalid package name"},
+		{name: "package file", tmpl: Template{Packages: []string{"evil.deb"}}, wantErr: "invalid package name"},
+		{name: "package with shell", tmpl: Template{Packages: []string{"curl;reboot"}}, wantErr: "invalid package name"},
+		{name: "variable name", tmpl: Template{Env: map[string]string{"MY-VAR": "x"}}, wantErr: "env: invalid variable name"},
+		{name: "reserved variable", tmpl: Template{Env: map[string]string{"LLIMA_BOX_PROJECT": "x"}}, wantErr: "set by llima-box"},
+		{name: "relative mount", tmpl: Template{Mounts: []Mount{{Path: "datasets"}}}, wantErr: "mounts[0]: path"},
+		{name: "duplicate mount", tmpl: Template{Mounts: []Mount{{Path: "~/a/data"}, {Path: "~/b/data"}}}, wantErr: "mounts[1]: duplicate name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tmpl.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected a valid template, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestVars(t *testing.T) {
+	tmpl := &Template{Env: map[string]string{"B": "2", "A": "1"}}
+	vars := tmpl.Vars()
+	if len(vars) != 2 || vars[0].Key != "A" || vars[1].Key != "B" || vars[1].Value != "2" {
+		t.Errorf("expected variables sorted by name, got %v", vars)
+	}
+}
@@ -0,0 +1,187 @@
+package env
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/watch"
+)
+
+// Timeline sources
+const (
+	// TimelineAudit events come from the environment's audit log
+	TimelineAudit = "audit"
+
+	// TimelineExec events come from the exec history on the host
+	TimelineExec = "exec"
+
+	// TimelineFiles events are workspace files' modification times
+	TimelineFiles = "files"
+)
+
+// Timeline events
+const (
+	// TimelineStarted is a session starting
+	TimelineStarted = "started"
+
+	// TimelineEnded is a session ending
+	TimelineEnded = "ended"
+
+	// TimelineRan is a command from the exec history that isn't in the audit
+	// log, such as one run before it was kept
+	TimelineRan = "ran"
+
+	// TimelineModified is a workspace file's last modification
+	TimelineModified = "modified"
+)
+
+// execMatchWindow is how far apart an exec history record and an audit log
+// session may start and still be the same command: the record's time is
+// taken on the host, the session's in the VM
+const execMatchWindow = 5 * time.Second
+
+// TimelineEvent is one step of what happened in an environment
+type TimelineEvent struct {
+	Time time.Time `json:"time"`
+
+	// Source is TimelineAudit, TimelineExec, or TimelineFiles
+	Source string `json:"source"`
+
+	// Event is TimelineStarted, TimelineEnded, TimelineRan, or TimelineModified
+	Event string `json:"event"`
+
+	// Session identifies the audit log session the event belongs to
+	Session string `json:"session,omitempty"`
+
+	// Kind is the session's AuditShell, AuditCommand, or AuditExec
+	Kind string `json:"kind,omitempty"`
+
+	// Command is the session's or exec history record's command
+	Command []string `json:"command,omitempty"`
+
+	// Dir is the VM directory the command ran in
+	Dir string `json:"dir,omitempty"`
+
+	// ExitStatus is the exit status of an ended session or a command
+	ExitStatus *int `json:"exitStatus,omitempty"`
+
+	// Error is why an exec command didn't run or finish, from the exec
+	// history
+	Error string `json:"error,omitempty"`
+
+	// Path is a modified file, relative to the project directory
+	Path string `json:"path,omitempty"`
+}
+
+// BuildTimeline merges an environment's audit log sessions, exec history
+// records, and workspace file modification times into one list, oldest
+// first. Exec history records are linked to the audit log sessions that ran
+// them, adding their errors to the session's end; those without one are
+// listed on their own. Files are listed if they were modified after the
+// first session or command started, as earlier changes weren't made in the
+// environment's recorded history.
+func BuildTimeline(sessions []AuditEntry, records []ExecRecord, files map[string]time.Time) []TimelineEvent {
+	events := []TimelineEvent{}
+	matched := make([]bool, len(records))
+	var first time.Time
+
+	for _, s := range sessions {
+		start := TimelineEvent{Time: s.StartedAt, Source: TimelineAudit, Event: TimelineStarted, Session: s.Session, Kind: s.Kind, Command: s.Command, Dir: s.Dir}
+		events = append(events, start)
+		if first.IsZero() || s.StartedAt.Before(first) {
+			first = s.StartedAt
+		}
+		if s.EndedAt == nil {
+			continue
+		}
+		end := TimelineEvent{Time: *s.EndedAt, Source: TimelineAudit, Event: TimelineEnded, Session: s.Session, Kind: s.Kind, Command: s.Command, ExitStatus: s.ExitStatus}
+		if s.Kind == AuditExec {
+			if i := matchExecRecord(s, records, matched); i >= 0 {
+				matched[i] = true
+				end.Error = records[i].Error
+			}
+		}
+		events = append(events, end)
+	}
+
+	for i, r := range records {
+		if matched[i] {
+			continue
+		}
+		status := r.ExitStatus
+		events = append(events, TimelineEvent{Time: r.StartedAt, Source: TimelineExec, Event: TimelineRan, Command: r.Command, Dir: r.Dir, ExitStatus: &status, Error: r.Error})
+		if first.IsZero() || r.StartedAt.Before(first) {
+			first = r.StartedAt
+		}
+	}
+
+	if !first.IsZero() {
+		for path, modified := range files {
+			if !modified.Before(first) {
+				events = append(events, TimelineEvent{Time: modified, Source: TimelineFiles, Event: TimelineModified, Path: path})
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Time.Equal(events[j].Time) {
+			return events[i].Path < events[j].Path
+		}
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events
+}
+
+// matchExecRecord returns the index of the unmatched exec history record of
+// the exec session s, or -1 if there is none
+func matchExecRecord(s AuditEntry, records []ExecRecord, matched []bool) int {
+	for i, r := range records {
+		if matched[i] || !reflect.DeepEqual(r.Command, s.Command) {
+			continue
+		}
+		if d := r.StartedAt.Sub(s.StartedAt); d > -execMatchWindow && d < execMatchWindow {
+			return i
+		}
+	}
+	return -1
+}
+
+// workspaceModTimes returns the modification time of every file in the
+// project directory on the host, skipping version control and dependency
+// directories
+func workspaceModTimes(projectPath string) (map[string]time.Time, error) {
+	snapshot, err := watch.Scan(projectPath, watch.DefaultIgnore)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]time.Time, len(snapshot))
+	for path := range snapshot {
+		files[path], _ = snapshot.ModTime(path)
+	}
+	return files, nil
+}
+
+// Timeline reconstructs what happened in env, in order: the sessions in its
+// audit log, the commands in its exec history, and the workspace files
+// changed since (see BuildTimeline). Only the last change to each file is
+// known. Files of isolated environments live in the VM and aren't listed.
+func (m *Manager) Timeline(ctx context.Context, env *Environment) ([]TimelineEvent, error) {
+	sessions, err := m.Audit(ctx, env.Name)
+	if err != nil {
+		return nil, err
+	}
+	records, err := m.ExecHistory(env.Name, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var files map[string]time.Time
+	if env.Mount().HostProject() && env.ProjectPath != "" {
+		if files, err = workspaceModTimes(env.ProjectPath); err != nil {
+			m.warnf(env.Name, "failed to list workspace changes: %v", err)
+		}
+	}
+	return BuildTimeline(sessions, records, files), nil
+}
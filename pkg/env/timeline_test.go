@@ -0,0 +1,90 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	at := func(min int) time.Time { return time.Date(2026, 1, 2, 3, min, 0, 0, time.UTC) }
+	ptr := func(tm time.Time) *time.Time { return &tm }
+	zero, one := 0, 1
+
+	sessions := []AuditEntry{
+		{Session: "1-10", Kind: AuditShell, Dir: "/p", StartedAt: at(0), EndedAt: ptr(at(30)), ExitStatus: &zero},
+		{Session: "2-20", Kind: AuditExec, Command: []string{"make", "test"}, Dir: "/p", StartedAt: at(10), EndedAt: ptr(at(12)), ExitStatus: &one},
+	}
+	records := []ExecRecord{
+		// The same run as session 2-20, timed on the host
+		{Command: []string{"make", "test"}, Dir: "/p", StartedAt: at(10).Add(time.Second), ExitStatus: 1, Error: "tests failed"},
+		// Run before the audit log was kept
+		{Command: []string{"ls"}, Dir: "/p", StartedAt: at(0).Add(-time.Hour)},
+	}
+	files := map[string]time.Time{
+		"main.go":   at(11),
+		"README.md": at(0).Add(-2 * time.Hour),
+	}
+
+	events := BuildTimeline(sessions, records, files)
+	var got []string
+	for _, e := range events {
+		got = append(got, fmt.Sprintf("%02d %s %s %s%s", e.Time.Minute(), e.Source, e.Event, e.Path, e.Error))
+	}
+	want := []string{
+		"00 exec ran ",
+		"00 audit started ",
+		"10 audit started ",
+		"11 files modified main.go",
+		"12 audit ended tests failed",
+		"30 audit ended ",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("timeline:\n%v\nwant:\n%v", got, want)
+	}
+
+	if events := BuildTimeline(nil, nil, files); len(events) != 0 {
+		t.Errorf("expected no file changes without sessions to anchor them, got %+v", events)
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, "main.go"), []byte("package main"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+
+	mock := newMockExecutor()
+	mock.setResponse("[ -d /envs/app-a1b2 ] && { sudo cat /envs/app-a1b2/audit.log.1 /envs/app-a1b2/audit.log 2>/dev/null || true; }",
+		`{"session":"1-10","time":"`+started+`","event":"start","kind":"shell","dir":"/p"}`+"\n")
+
+	tests := []struct {
+		name      string
+		driver    string
+		wantFiles int
+	}{
+		{name: "host workspace", wantFiles: 1},
+		{name: "isolated workspace", driver: vmOnlyMount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := newManagerWithExecutor(mock).Timeline(context.Background(), &Environment{Name: "app-a1b2", ProjectPath: project, Driver: tt.driver})
+			if err != nil {
+				t.Fatalf("Timeline failed: %v", err)
+			}
+			files := 0
+			for _, e := range events {
+				if e.Source == TimelineFiles {
+					files++
+				}
+			}
+			if len(events) != 1+tt.wantFiles || files != tt.wantFiles {
+				t.Errorf("expected the session and %d file changes, got %+v", tt.wantFiles, events)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// usageCommand lists every process in the VM with its owner and resource use
+const usageCommand = "ps -eo user:64=,pid=,pcpu=,rss=,args="
+
+// Process is a process running in an environment
+type Process struct {
+	PID        int
+	CPUPercent float64
+	MemoryKB   int64
+	Command    string
+}
+
+// ResourceUsage summarizes the processes running in an environment
+type ResourceUsage struct {
+	// CPUPercent is the combined CPU usage, where 100 is one full core
+	CPUPercent float64
+
+	// MemoryKB is the combined resident memory
+	MemoryKB int64
+
+	// Processes lists the environment's processes, busiest first
+	Processes []Process
+}
+
+// Usage returns the resource usage of each environment with running
+// processes, keyed by environment name
+func (m *Manager) Usage(ctx context.Context) (map[string]*ResourceUsage, error) {
+	if err := m.ensureSSH(ctx); err != nil {
+		return nil, err
+	}
+
+	output, err := m.sshClient.ExecContext(ctx, usageCommand)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource usage: %w", err)
+	}
+
+	return parseUsage(output), nil
+}
+
+// parseUsage aggregates the output of usageCommand by environment user.
+// Processes of other users (root, the VM user) are skipped.
+func parseUsage(output string) map[string]*ResourceUsage {
+	usage := make(map[string]*ResourceUsage)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || !IsValidEnvironmentName(fields[0]) {
+			continue
+		}
+
+		pid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		cpu, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			continue
+		}
+		rss, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		u, ok := usage[fields[0]]
+		if !ok {
+			u = &ResourceUsage{}
+			usage[fields[0]] = u
+		}
+		u.CPUPercent += cpu
+		u.MemoryKB += rss
+		u.Processes = append(u.Processes, Process{
+			PID:        pid,
+			CPUPercent: cpu,
+			MemoryKB:   rss,
+			Command:    strings.Join(fields[4:], " "),
+		})
+	}
+
+	for _, u := range usage {
+		sort.SliceStable(u.Processes, func(i, j int) bool {
+			return u.Processes[i].CPUPercent > u.Processes[j].CPUPercent
+		})
+	}
+
+	return usage
+}
+
+// DiskUsage returns the disk space, in kilobytes, that deleting each of envs
+// would free: the home directory, the state directory under /envs, and for
+// isolated environments the workspace
+func (m *Manager) DiskUsage(ctx context.Context, envs []*Environment) (map[string]int64, error) {
+	if len(envs) == 0 {
+		return map[string]int64{}, nil
+	}
+	if err := m.ensureSSH(ctx); err != nil {
+		return nil, err
+	}
+
+	output, err := m.sshClient.ExecContext(ctx, diskUsageCommand(envs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get disk usage: %w", err)
+	}
+
+	return parseDiskUsage(output), nil
+}
+
+// diskUsageCommand prints one tab-separated line per environment: the name
+// and the total size of its directories in kilobytes. Missing directories
+// are skipped.
+func diskUsageCommand(envs []*Environment) string {
+	parts := make([]string, 0, len(envs))
+	for _, e := range envs {
+		dirs := fmt.Sprintf("$(getent passwd %[1]s | cut -d: -f6) %[2]s", shellWord(e.Name), shellWord(envDir(e.Name)))
+		if dir := e.workspaceDir(); dir != "" {
+			dirs += " " + shellWord(dir)
+		}
+		parts = append(parts, fmt.Sprintf("printf '%%s\\t%%s\\n' %s \"$(sudo du -skc %s 2>/dev/null | tail -n1 | cut -f1)\"", shellWord(e.Name), dirs))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// parseDiskUsage parses the output of diskUsageCommand
+func parseDiskUsage(output string) map[string]int64 {
+	usage := make(map[string]int64)
+	for _, line := range strings.Split(output, "\n") {
+		name, size, ok := strings.Cut(line, "\t")
+		if !ok || name == "" {
+			continue
+		}
+		kb, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+		if err != nil {
+			continue
+		}
+		usage[name] = kb
+	}
+	return usage
+}
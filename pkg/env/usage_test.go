@@ -0,0 +1,52 @@
+package env
+
+import "testing"
+
+func TestParseUsage(t *testing.T) {
+	output := "root            1  0.0  1234 /sbin/init\n" +
+		"app-a1b2     1001  1.5  2048 -bash\n" +
+		"app-a1b2     1002 97.0 10240 go test ./...\n" +
+		"web-c3d4     1003  0.2   512 sleep 60\n" +
+		"malformed\n"
+
+	usage := parseUsage(output)
+
+	if len(usage) != 2 {
+		t.Fatalf("parseUsage() returned %d environments, want 2", len(usage))
+	}
+	if _, ok := usage["root"]; ok {
+		t.Error("parseUsage() included non-environment user root")
+	}
+
+	app := usage["app-a1b2"]
+	if app == nil {
+		t.Fatal("parseUsage() missing app-a1b2")
+	}
+	if app.CPUPercent != 98.5 || app.MemoryKB != 12288 {
+		t.Errorf("app-a1b2 usage = %.1f%% %dKB, want 98.5%% 12288KB", app.CPUPercent, app.MemoryKB)
+	}
+	if len(app.Processes) != 2 || app.Processes[0].Command != "go test ./..." || app.Processes[0].PID != 1002 {
+		t.Errorf("app-a1b2 processes = %+v, want busiest first", app.Processes)
+	}
+}
+
+func TestDiskUsageCommand(t *testing.T) {
+	envs := []*Environment{
+		{Name: "app-a1b2", ProjectPath: "/Users/alice/app"},
+		{Name: "scratch-c3d4", ProjectPath: VMWorkspaceRoot + "/scratch", Driver: vmOnlyMount},
+	}
+	got := diskUsageCommand(envs)
+	want := `printf '%s\t%s\n' app-a1b2 "$(sudo du -skc $(getent passwd app-a1b2 | cut -d: -f6) /envs/app-a1b2 2>/dev/null | tail -n1 | cut -f1)"; ` +
+		`printf '%s\t%s\n' scratch-c3d4 "$(sudo du -skc $(getent passwd scratch-c3d4 | cut -d: -f6) /envs/scratch-c3d4 ` + VMWorkspaceRoot + `/scratch 2>/dev/null | tail -n1 | cut -f1)"`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseDiskUsage(t *testing.T) {
+	usage := parseDiskUsage("app-a1b2\t2048\nscratch-c3d4\t\nmalformed\n")
+
+	if len(usage) != 1 || usage["app-a1b2"] != 2048 {
+		t.Errorf("parseDiskUsage() = %v, want only app-a1b2 with 2048KB", usage)
+	}
+}
@@ -0,0 +1,99 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+)
+
+// waitPollInterval is how often WaitFor re-checks its condition
+var waitPollInterval = time.Second
+
+// Condition is a state inside an environment that WaitFor can wait on
+type Condition interface {
+	// command returns a shell command run in the VM that exits with
+	// status 0 once the condition holds
+	command(env *Environment) string
+
+	// String describes the condition for error messages
+	String() string
+}
+
+type fileExists struct{ path string }
+
+// FileExists is satisfied once path exists in the environment's filesystem.
+// Relative paths are resolved against the project directory.
+func FileExists(p string) Condition {
+	return fileExists{path: p}
+}
+
+func (c fileExists) command(env *Environment) string {
+	p := c.path
+	if !path.IsAbs(p) {
+		p = path.Join(env.dir(), p)
+	}
+	return NewRemoteRunner(env.Name).Command("test", "-e", p)
+}
+
+func (c fileExists) String() string {
+	return fmt.Sprintf("file %s exists", c.path)
+}
+
+type portListening struct{ port int }
+
+// PortListening is satisfied once a TCP listener is bound to port
+func PortListening(port int) Condition {
+	return portListening{port: port}
+}
+
+func (c portListening) command(_ *Environment) string {
+	return fmt.Sprintf("ss -Hltn 'sport = :%d' | grep -q .", c.port)
+}
+
+func (c portListening) String() string {
+	return fmt.Sprintf("port %d listening", c.port)
+}
+
+type processExited struct{ pid int }
+
+// ProcessExited is satisfied once the process with the given VM PID is gone
+func ProcessExited(pid int) Condition {
+	return processExited{pid: pid}
+}
+
+func (c processExited) command(_ *Environment) string {
+	return fmt.Sprintf("! sudo kill -0 %d 2>/dev/null", c.pid)
+}
+
+func (c processExited) String() string {
+	return fmt.Sprintf("process %d exited", c.pid)
+}
+
+// WaitFor blocks until cond holds inside env or ctx is done.
+// Use a context deadline to bound the wait.
+func (m *Manager) WaitFor(ctx context.Context, env *Environment, cond Condition) error {
+	if err := m.ensureSSH(ctx); err != nil {
+		return err
+	}
+
+	cmd := cond.command(env)
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.sshClient.ExecContext(ctx, cmd); err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("timed out waiting for %s: %w", cond, ctx.Err())
+			}
+			return fmt.Errorf("stopped waiting for %s: %w", cond, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
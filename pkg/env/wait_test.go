@@ -0,0 +1,115 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyExecutor fails a command a fixed number of times before succeeding
+type flakyExecutor struct {
+	*mockExecutor
+	failures int
+}
+
+func (f *flakyExecutor) ExecContext(_ context.Context, cmd string) (string, error) {
+	f.calls = append(f.calls, cmd)
+	if f.failures > 0 {
+		f.failures--
+		return "", fmt.Errorf("exit status 1")
+	}
+	return "", nil
+}
+
+func TestConditionCommands(t *testing.T) {
+	env := &Environment{Name: "my-project-a1b2", ProjectPath: "/Users/alice/my project"}
+
+	tests := []struct {
+		name string
+		cond Condition
+		want string
+	}{
+		{
+			name: "relative file",
+			cond: FileExists("out/done"),
+			want: "sudo nsenter --target=$(sudo cat /envs/my-project-a1b2/namespace.pid) --mount test -e '/Users/alice/my project/out/done'",
+		},
+		{
+			name: "absolute file",
+			cond: FileExists("/tmp/ready"),
+			want: "sudo nsenter --target=$(sudo cat /envs/my-project-a1b2/namespace.pid) --mount test -e /tmp/ready",
+		},
+		{
+			name: "port",
+			cond: PortListening(3000),
+			want: "ss -Hltn 'sport = :3000' | grep -q .",
+		},
+		{
+			name: "process",
+			cond: ProcessExited(4242),
+			want: "! sudo kill -0 4242 2>/dev/null",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cond.command(env); got != tt.want {
+				t.Errorf("command() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	waitPollInterval = time.Millisecond
+	defer func() { waitPollInterval = time.Second }()
+
+	env := &Environment{Name: "my-project-a1b2", ProjectPath: "/Users/alice/my-project"}
+
+	t.Run("condition becomes true", func(t *testing.T) {
+		exec := &flakyExecutor{mockExecutor: newMockExecutor(), failures: 3}
+		mgr := newManagerWithExecutor(exec)
+
+		if err := mgr.WaitFor(context.Background(), env, PortListening(8080)); err != nil {
+			t.Fatalf("WaitFor failed: %v", err)
+		}
+		if len(exec.calls) != 4 {
+			t.Errorf("expected 4 checks, got %d", len(exec.calls))
+		}
+	})
+
+	t.Run("context deadline", func(t *testing.T) {
+		exec := &flakyExecutor{mockExecutor: newMockExecutor(), failures: 1 << 30}
+		mgr := newManagerWithExecutor(exec)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		err := mgr.WaitFor(ctx, env, FileExists("done"))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "file done exists") {
+			t.Errorf("expected condition in error, got: %v", err)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		exec := &flakyExecutor{mockExecutor: newMockExecutor(), failures: 1 << 30}
+		mgr := newManagerWithExecutor(exec)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := mgr.WaitFor(ctx, env, FileExists("done"))
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected cancellation, got: %v", err)
+		}
+		if strings.Contains(err.Error(), "timed out") {
+			t.Errorf("expected a cancelled wait not to be reported as a timeout, got: %v", err)
+		}
+	})
+}
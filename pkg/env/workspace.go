@@ -0,0 +1,97 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// VMWorkspaceRoot is the VM directory holding the workspaces of isolated
+// environments. It's on the data disk, next to the environments' home
+// directories.
+const VMWorkspaceRoot = vm.DataDiskMountPoint + "/workspaces"
+
+// workspaceNamePattern matches valid isolated workspace names
+var workspaceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,62}$`)
+
+// hostMountTypes are the filesystem types Lima uses to mount host
+// directories into the VM
+var hostMountTypes = []string{"virtiofs", "9p", "fuse.sshfs"}
+
+// VMWorkspace returns the isolated environment for the named workspace. Its
+// project directory lives inside the VM rather than on the host. The
+// environment isn't created; use CreateInVM for that.
+func VMWorkspace(name string) (*Environment, error) {
+	if !workspaceNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid workspace name %q (use lowercase letters, digits, '.', '_' and '-')", name)
+	}
+
+	dir := VMWorkspaceRoot + "/" + name
+	envName, err := GenerateName(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate environment name: %w", err)
+	}
+	return &Environment{Name: envName, ProjectPath: dir, Driver: vmOnlyMount}, nil
+}
+
+// CreateInVM creates an isolated environment for the named workspace, or
+// returns the existing one. The workspace directory lives inside the VM, and
+// the host directories Lima mounts into the VM are hidden from the
+// environment, so nothing running in it can read or write host files. Files
+// move in and out only through CopyTo and CopyFrom.
+//
+// Isolated environments have no project configuration file and use the
+// defaults.
+func (m *Manager) CreateInVM(ctx context.Context, name string) (*Environment, error) {
+	env, err := VMWorkspace(name)
+	if err != nil {
+		return nil, err
+	}
+	return m.create(ctx, env)
+}
+
+// createWorkspace creates the VM workspace directory dir of an environment,
+// owned by its user
+func (m *Manager) createWorkspace(ctx context.Context, envName, dir string) error {
+	cmd := fmt.Sprintf("sudo install -d -m 0755 -o %s -g %s %s", envName, envName, shellWord(dir))
+	if _, err := m.sshClient.ExecContext(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to create workspace: %w", err)
+	}
+	return nil
+}
+
+// maskHostMountsScript returns a script hiding every host directory mounted
+// into the VM behind an empty read-only tmpfs. Nested mounts are masked
+// before their parents (reverse order), since masking a parent first would
+// make them unreachable. Targets already masked are skipped, so the script
+// can run again in the same namespace.
+func maskHostMountsScript() string {
+	return fmt.Sprintf(`findmnt -rn -o TARGET -t %s | sort -r | while read -r t; do `+
+		`t=$(printf '%%b' "$t"); `+
+		`[ "$(stat -f -c %%T "$t")" = tmpfs ] || mount -t tmpfs -o ro,size=4k,mode=0555 llima-box-masked "$t" || exit 1; `+
+		`done`, strings.Join(hostMountTypes, ","))
+}
+
+// maskHostMountsCommand returns the command hiding the host's directories
+// inside the namespace held by pid. The namespace has private mount
+// propagation, so the VM and other environments are unaffected.
+func maskHostMountsCommand(pid string) RemoteCommand {
+	return RemoteCommand{Purpose: "hide host mounts", Script: pidRunner(pid).Script(maskHostMountsScript())}
+}
+
+// workspacePath resolves p inside an environment's VM workspace. Relative
+// and absolute paths are both taken relative to the workspace directory.
+func workspacePath(env *Environment, p string) (string, error) {
+	if env.Mount().HostProject() {
+		return "", fmt.Errorf("environment %s has no VM workspace; its files are on the host", env.Name)
+	}
+	full := path.Join(env.ProjectPath, p)
+	if full != env.ProjectPath && !strings.HasPrefix(full, env.ProjectPath+"/") {
+		return "", fmt.Errorf("path %s is outside the workspace", p)
+	}
+	return full, nil
+}
@@ -0,0 +1,143 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+func TestVMWorkspace(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "scratch"},
+		{name: "agent-run.2"},
+		{name: "", wantErr: true},
+		{name: "Scratch", wantErr: true},
+		{name: "../etc", wantErr: true},
+		{name: "a/b", wantErr: true},
+		{name: "-x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := VMWorkspace(tt.name)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error for %q", tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want := VMWorkspaceRoot + "/" + tt.name; env.ProjectPath != want {
+				t.Errorf("ProjectPath = %s, want %s", env.ProjectPath, want)
+			}
+			if env.Driver != vmOnlyMount {
+				t.Errorf("Driver = %q, want %q", env.Driver, vmOnlyMount)
+			}
+			if !IsValidEnvironmentName(env.Name) {
+				t.Errorf("invalid environment name %s", env.Name)
+			}
+		})
+	}
+}
+
+func TestWorkspacePath(t *testing.T) {
+	env := &Environment{Name: "scratch-a1b2", ProjectPath: VMWorkspaceRoot + "/scratch", Driver: vmOnlyMount}
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "dist/app.tar", want: env.ProjectPath + "/dist/app.tar"},
+		{in: "/dist", want: env.ProjectPath + "/dist"},
+		{in: "", want: env.ProjectPath},
+		{in: "a/../b", want: env.ProjectPath + "/b"},
+		{in: "../other", wantErr: true},
+		{in: "../scratch2/x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := workspacePath(env, tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("workspacePath(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := workspacePath(&Environment{Name: "app-a1b2", ProjectPath: "/Users/alice/app"}, "x"); err == nil {
+		t.Error("expected error for an environment without a VM workspace")
+	}
+}
+
+func TestProvision_Isolated(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	m := newManagerWithExecutor(mock)
+
+	env, err := VMWorkspace("scratch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.setError("id "+env.Name, fmt.Errorf("exit status 1"))
+
+	md := &metadata{ProjectPath: env.ProjectPath, Step: stepStarted, Mount: vmOnlyMount}
+	if err := m.provision(context.Background(), env, &config.Project{}, md, false); err != nil {
+		t.Fatalf("provision failed: %v", err)
+	}
+
+	wantWorkspace := fmt.Sprintf("sudo install -d -m 0755 -o %s -g %s %s", env.Name, env.Name, env.ProjectPath)
+	if !calledWith(mock, wantWorkspace) {
+		t.Errorf("expected workspace creation: %s", wantWorkspace)
+	}
+	if !calledWith(mock, "llima-box-masked") {
+		t.Error("expected host mounts to be masked")
+	}
+	if !calledWith(mock, `"mount":"vm-only"`) {
+		t.Error("expected the mount driver to be recorded in metadata")
+	}
+}
+
+func TestProvision_NotIsolatedKeepsHostMounts(t *testing.T) {
+	mock := newMockExecutor()
+	mock.allowUnexpected = true
+	m := newManagerWithExecutor(mock)
+
+	env := &Environment{Name: "app-a1b2", ProjectPath: t.TempDir()}
+	md := &metadata{ProjectPath: env.ProjectPath, Step: stepStarted}
+	if err := m.provision(context.Background(), env, &config.Project{}, md, false); err != nil {
+		t.Fatalf("provision failed: %v", err)
+	}
+
+	for _, call := range mock.calls {
+		if strings.Contains(call, "llima-box-masked") || strings.Contains(call, "install -d") {
+			t.Errorf("unexpected isolation command: %s", call)
+		}
+	}
+}
+
+func TestParseScan_Isolated(t *testing.T) {
+	// Recorded before mount drivers, as a flag
+	output := "scratch-a1b2\trunning\t" + `{"projectPath":"` + VMWorkspaceRoot + `/scratch","createdAt":"2025-01-01T00:00:00Z","isolated":true}`
+	envs := parseScan(output)
+	if len(envs) != 1 || envs[0].Driver != vmOnlyMount {
+		t.Fatalf("expected one isolated environment, got %+v", envs)
+	}
+}
@@ -0,0 +1,129 @@
+// Package export converts an environment's provisioning into container build
+// files, so a setup prototyped in llima-box can be reused for CI images.
+//
+// The generated Dockerfile starts from the VM's base image, installs the VM's
+// base packages and any packages imported from the project's Dockerfile, and
+// runs each toolchain install script from the project
+// configuration into the same /opt/toolchains/<name> directory used inside
+// environments.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/dockerfile"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+const (
+	// FormatDockerfile produces a Dockerfile
+	FormatDockerfile = "dockerfile"
+
+	// FormatDevcontainer produces a devcontainer.json with its Dockerfile
+	FormatDevcontainer = "devcontainer"
+
+	// DevcontainerFile is the devcontainer configuration file name
+	DevcontainerFile = "devcontainer.json"
+
+	// DockerfileName is the Dockerfile name used next to devcontainer.json
+	DockerfileName = "Dockerfile"
+
+	// ContainerUser is the unprivileged user created in the image
+	ContainerUser = "dev"
+
+	// toolchainRoot matches where toolchains are mounted in environments
+	toolchainRoot = "/opt/toolchains"
+
+	// heredocDelimiter terminates install scripts in the Dockerfile
+	heredocDelimiter = "LLIMA_BOX_EOF"
+)
+
+// Dockerfile renders a Dockerfile reproducing the environment for the
+// project at projectPath. Install scripts are embedded as heredocs, which
+// requires BuildKit.
+func Dockerfile(projectPath string, project *config.Project) (string, error) {
+	var b strings.Builder
+	b.WriteString("# syntax=docker/dockerfile:1\n")
+	fmt.Fprintf(&b, "# Generated by llima-box export from %s\n", projectPath)
+	fmt.Fprintf(&b, "FROM %s\n\n", vm.BaseImage)
+
+	b.WriteString("ENV DEBIAN_FRONTEND=noninteractive\n")
+	b.WriteString("RUN apt-get update \\\n")
+	fmt.Fprintf(&b, "    && apt-get install -y %s \\\n", strings.Join(vm.BasePackages, " "))
+	b.WriteString("    && rm -rf /var/lib/apt/lists/*\n")
+
+	if path := project.DockerfilePath(projectPath); path != "" {
+		provisioning, err := dockerfile.Load(path, project.Dockerfile.Stage)
+		if err != nil {
+			return "", err
+		}
+		if len(provisioning.Packages) > 0 {
+			fmt.Fprintf(&b, "\n# Packages from %s\n", project.Dockerfile.Path)
+			b.WriteString("RUN apt-get update \\\n")
+			fmt.Fprintf(&b, "    && apt-get install -y %s \\\n", strings.Join(provisioning.Packages, " "))
+			b.WriteString("    && rm -rf /var/lib/apt/lists/*\n")
+		}
+	}
+
+	var paths []string
+	for _, tc := range project.Toolchains {
+		if containsLine(tc.Install, heredocDelimiter) {
+			return "", fmt.Errorf("toolchain %s: install script contains the heredoc delimiter %s", tc.Name, heredocDelimiter)
+		}
+
+		dir := toolchainRoot + "/" + tc.Name
+		fmt.Fprintf(&b, "\n# Toolchain: %s\n", tc.Name)
+		fmt.Fprintf(&b, "RUN mkdir -p %s\n", dir)
+		fmt.Fprintf(&b, "RUN LAYER=%s bash -eo pipefail <<'%s'\n", dir, heredocDelimiter)
+		b.WriteString(strings.TrimRight(tc.Install, "\n"))
+		fmt.Fprintf(&b, "\n%s\n", heredocDelimiter)
+		paths = append([]string{dir + "/bin"}, paths...)
+	}
+	if len(paths) > 0 {
+		fmt.Fprintf(&b, "ENV PATH=%s:$PATH\n", strings.Join(paths, ":"))
+	}
+
+	fmt.Fprintf(&b, "\nRUN useradd -m -s /bin/bash %s\n", ContainerUser)
+	fmt.Fprintf(&b, "USER %s\n", ContainerUser)
+
+	return b.String(), nil
+}
+
+// devcontainer is the subset of devcontainer.json written by Devcontainer
+type devcontainer struct {
+	Name       string            `json:"name"`
+	Build      devcontainerBuild `json:"build"`
+	RemoteUser string            `json:"remoteUser"`
+}
+
+type devcontainerBuild struct {
+	Dockerfile string `json:"dockerfile"`
+}
+
+// Devcontainer renders a devcontainer.json that builds the Dockerfile
+// written next to it
+func Devcontainer(projectPath string) ([]byte, error) {
+	data, err := json.MarshalIndent(devcontainer{
+		Name:       filepath.Base(projectPath),
+		Build:      devcontainerBuild{Dockerfile: DockerfileName},
+		RemoteUser: ContainerUser,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode devcontainer.json: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// containsLine reports whether any line of s equals line
+func containsLine(s, line string) bool {
+	for _, l := range strings.Split(s, "\n") {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
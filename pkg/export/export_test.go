@@ -0,0 +1,99 @@
+package export
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+func TestDockerfile(t *testing.T) {
+	project := &config.Project{
+		Toolchains: []config.Toolchain{
+			{Name: "node-22", Install: "curl -fsSL https://example.com/node.tar.xz |\n  tar -xJ -C \"$LAYER\"\n"},
+			{Name: "go-1.24", Install: "echo go"},
+		},
+	}
+
+	got, err := Dockerfile("/Users/me/app", project)
+	if err != nil {
+		t.Fatalf("Dockerfile failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"# syntax=docker/dockerfile:1\n",
+		"# Generated by llima-box export from /Users/me/app\n",
+		"FROM ubuntu:24.04\n",
+		"apt-get install -y build-essential curl git acl",
+		"RUN mkdir -p /opt/toolchains/node-22\n" +
+			"RUN LAYER=/opt/toolchains/node-22 bash -eo pipefail <<'LLIMA_BOX_EOF'\n" +
+			"curl -fsSL https://example.com/node.tar.xz |\n  tar -xJ -C \"$LAYER\"\n" +
+			"LLIMA_BOX_EOF\n",
+		// Later toolchains come first on PATH, as in environment profiles
+		"ENV PATH=/opt/toolchains/go-1.24/bin:/opt/toolchains/node-22/bin:$PATH\n",
+		"USER dev\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Dockerfile missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestDockerfile_NoToolchains(t *testing.T) {
+	got, err := Dockerfile("/Users/me/app", &config.Project{})
+	if err != nil {
+		t.Fatalf("Dockerfile failed: %v", err)
+	}
+	if strings.Contains(got, "ENV PATH") {
+		t.Errorf("Dockerfile without toolchains sets PATH:\n%s", got)
+	}
+}
+
+func TestDockerfile_ImportedPackages(t *testing.T) {
+	projectPath := t.TempDir()
+	content := "FROM ubuntu:24.04\nRUN apt-get update && apt-get install -y jq\n"
+	if err := os.WriteFile(filepath.Join(projectPath, "Dockerfile"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write Dockerfile: %v", err)
+	}
+
+	project := &config.Project{Dockerfile: &config.DockerfileSource{Path: "Dockerfile"}}
+	got, err := Dockerfile(projectPath, project)
+	if err != nil {
+		t.Fatalf("Dockerfile failed: %v", err)
+	}
+	if !strings.Contains(got, "# Packages from Dockerfile\nRUN apt-get update \\\n    && apt-get install -y jq \\\n") {
+		t.Errorf("Dockerfile missing imported packages:\n%s", got)
+	}
+}
+
+func TestDockerfile_DelimiterInScript(t *testing.T) {
+	project := &config.Project{
+		Toolchains: []config.Toolchain{{Name: "bad", Install: "cat <<LLIMA_BOX_EOF\nx\nLLIMA_BOX_EOF\n"}},
+	}
+
+	if _, err := Dockerfile("/Users/me/app", project); err == nil {
+		t.Error("expected error for install script containing the heredoc delimiter")
+	}
+}
+
+func TestDevcontainer(t *testing.T) {
+	data, err := Devcontainer("/Users/me/app")
+	if err != nil {
+		t.Fatalf("Devcontainer failed: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got["name"] != "app" || got["remoteUser"] != "dev" {
+		t.Errorf("unexpected devcontainer.json: %s", data)
+	}
+	build, _ := got["build"].(map[string]interface{})
+	if build["dockerfile"] != "Dockerfile" {
+		t.Errorf("build.dockerfile = %v, want Dockerfile", build["dockerfile"])
+	}
+}
@@ -0,0 +1,167 @@
+// Package frames encodes a command's output as a stream of events for
+// programs that run llima-box over a pipe.
+//
+// Each event is a JSON object preceded by its length as a 4-byte big-endian
+// unsigned integer. A run produces a start event, stdout and stderr events
+// as output arrives, and one exit event. Output data is base64-encoded in
+// JSON, so binary output and partial UTF-8 sequences survive intact, and
+// stdout and stderr stay apart without a terminal merging them.
+package frames
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	// TypeStart is the first event of a run
+	TypeStart = "start"
+
+	// TypeStdout carries data the command wrote to standard output
+	TypeStdout = "stdout"
+
+	// TypeStderr carries data the command wrote to standard error
+	TypeStderr = "stderr"
+
+	// TypeExit is the last event of a run
+	TypeExit = "exit"
+)
+
+// MaxFrameSize is the largest event a Reader accepts
+const MaxFrameSize = 16 << 20
+
+// Event is one framed event
+type Event struct {
+	// Type is one of the Type constants
+	Type string `json:"type"`
+
+	// Time is when the event was written
+	Time time.Time `json:"time"`
+
+	// Data is the output of stdout and stderr events
+	Data []byte `json:"data,omitempty"`
+
+	// Environment and Command describe the run in the start event
+	Environment string   `json:"environment,omitempty"`
+	Command     []string `json:"command,omitempty"`
+
+	// ExitCode is the command's exit status in the exit event: -1 when the
+	// command didn't report one, for example because the connection dropped
+	ExitCode *int `json:"exitCode,omitempty"`
+
+	// Error explains an exit without an exit status
+	Error string `json:"error,omitempty"`
+
+	// DurationMs is how long the command ran, in the exit event
+	DurationMs int64 `json:"durationMs,omitempty"`
+}
+
+// Writer writes framed events. It's safe for concurrent use, so stdout and
+// stderr can be copied from separate goroutines.
+type Writer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewWriter returns a Writer framing events onto w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, now: time.Now}
+}
+
+// Write frames one event, setting its time
+func (w *Writer) Write(e Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	e.Time = w.now().UTC()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	frame := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data))) // #nosec G115 -- events are far below 4 GiB
+	frame = append(frame, data...)
+	if _, err := w.w.Write(frame); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
+}
+
+// Stream returns an io.Writer turning each write into an event of the given
+// type, for use as a command's stdout or stderr
+func (w *Writer) Stream(eventType string) io.Writer {
+	return &streamWriter{w: w, eventType: eventType}
+}
+
+// streamWriter adapts a Writer to io.Writer for one event type
+type streamWriter struct {
+	w         *Writer
+	eventType string
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	data := make([]byte, len(p))
+	copy(data, p)
+	if err := s.w.Write(Event{Type: s.eventType, Data: data}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Exit builds the exit event for a command that ended with err after
+// running for elapsed. exitCode is the command's exit status, or -1.
+func Exit(exitCode int, err error, elapsed time.Duration) Event {
+	e := Event{Type: TypeExit, ExitCode: &exitCode, DurationMs: elapsed.Milliseconds()}
+	if exitCode < 0 && err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// Reader reads framed events
+type Reader struct {
+	r io.Reader
+}
+
+// NewReader returns a Reader reading events from r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Read returns the next event, or io.EOF after the last one
+func (r *Reader) Read() (Event, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Event{}, fmt.Errorf("truncated frame header: %w", err)
+		}
+		return Event{}, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxFrameSize {
+		return Event{}, fmt.Errorf("frame of %d bytes exceeds the %d byte limit", size, MaxFrameSize)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return Event{}, fmt.Errorf("truncated frame: %w", err)
+	}
+
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return Event{}, fmt.Errorf("failed to decode event: %w", err)
+	}
+	return e, nil
+}
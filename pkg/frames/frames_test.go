@@ -0,0 +1,92 @@
+package frames
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	events := []Event{
+		{Type: TypeStart, Environment: "app-a1b2", Command: []string{"make", "test"}},
+		{Type: TypeStdout, Data: []byte("ok\n")},
+		{Type: TypeStderr, Data: []byte{0xff, 0xfe, '\n'}},
+		Exit(0, nil, 1500*time.Millisecond),
+	}
+	for _, e := range events {
+		if err := w.Write(e); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	r := NewReader(&buf)
+	for i, want := range events {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("event %d: Read failed: %v", i, err)
+		}
+		if got.Type != want.Type || !bytes.Equal(got.Data, want.Data) || got.Environment != want.Environment {
+			t.Errorf("event %d: got %+v, want %+v", i, got, want)
+		}
+		if got.Time.IsZero() {
+			t.Errorf("event %d: missing time", i)
+		}
+	}
+
+	if _, err := r.Read(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF after the last event, got %v", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	_, _ = fmt.Fprint(w.Stream(TypeStderr), "warning\n")
+
+	e, err := NewReader(&buf).Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if e.Type != TypeStderr || string(e.Data) != "warning\n" {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestExit(t *testing.T) {
+	if e := Exit(2, errors.New("exit status 2"), time.Second); *e.ExitCode != 2 || e.Error != "" || e.DurationMs != 1000 {
+		t.Errorf("exit status: got %+v", e)
+	}
+	if e := Exit(-1, errors.New("connection lost"), 0); *e.ExitCode != -1 || e.Error != "connection lost" {
+		t.Errorf("no exit status: got %+v", e)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "truncated header", input: "\x00\x00", wantErr: "truncated frame header"},
+		{name: "truncated frame", input: "\x00\x00\x00\x10{}", wantErr: "truncated frame"},
+		{name: "oversized frame", input: "\x7f\x00\x00\x00", wantErr: "exceeds"},
+		{name: "invalid json", input: "\x00\x00\x00\x01x", wantErr: "failed to decode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(strings.NewReader(tt.input)).Read()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+// Package health evaluates the state of the llima-box VM and its
+// environments for monitoring.
+//
+// A Report is a list of named checks, each OK, degraded, or failed. Only
+// failed checks are hard failures that a monitoring script should act on:
+// the VM is down, unreachable, or out of disk. Problems that llima-box
+// repairs on its own, such as a namespace keeper that died with a VM
+// restart, are reported as degraded.
+package health
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/env"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	// StatusOK means the check passed
+	StatusOK Status = "ok"
+
+	// StatusDegraded means something needs attention but isn't broken
+	StatusDegraded Status = "degraded"
+
+	// StatusFailed is a hard failure
+	StatusFailed Status = "failed"
+)
+
+// severity orders statuses from best to worst
+func (s Status) severity() int {
+	switch s {
+	case StatusOK:
+		return 0
+	case StatusDegraded:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Check is the result of one health check
+type Check struct {
+	// Name identifies the check, e.g. "vm", "ssh", "disk:/", or
+	// "environment:my-project-a1b2"
+	Name string `json:"name"`
+
+	// Status is the outcome
+	Status Status `json:"status"`
+
+	// Message explains the outcome
+	Message string `json:"message"`
+}
+
+// Report collects the results of a health check run
+type Report struct {
+	// Status is the worst status of any check
+	Status Status `json:"status"`
+
+	// CheckedAt is when the checks ran
+	CheckedAt time.Time `json:"checkedAt"`
+
+	// Checks lists every check in the order it ran
+	Checks []Check `json:"checks"`
+}
+
+// NewReport returns an empty, healthy report
+func NewReport(now time.Time) *Report {
+	return &Report{Status: StatusOK, CheckedAt: now.UTC(), Checks: []Check{}}
+}
+
+// Add records a check, lowering the overall status if needed
+func (r *Report) Add(name string, status Status, format string, args ...any) {
+	r.Checks = append(r.Checks, Check{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+	if status.severity() > r.Status.severity() {
+		r.Status = status
+	}
+}
+
+// Failed reports whether any check failed
+func (r *Report) Failed() bool {
+	return r.Status == StatusFailed
+}
+
+// Disk thresholds, as the percentage of a filesystem that's free
+const (
+	// DiskDegradedPercent reports a filesystem as degraded
+	DiskDegradedPercent = 15
+
+	// DiskFailedPercent reports a filesystem as failed: package installs and
+	// builds start failing around here
+	DiskFailedPercent = 5
+)
+
+// Filesystem is the space on one mounted filesystem, in kilobytes
+type Filesystem struct {
+	MountPoint string
+	SizeKB     int64
+	AvailKB    int64
+}
+
+// FreePercent returns the percentage of the filesystem that's available
+func (f Filesystem) FreePercent() float64 {
+	if f.SizeKB <= 0 {
+		return 0
+	}
+	return float64(f.AvailKB) * 100 / float64(f.SizeKB)
+}
+
+// ParseDF parses the output of `df -Pk`
+func ParseDF(output string) ([]Filesystem, error) {
+	var filesystems []Filesystem
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[0] == "Filesystem" {
+			continue
+		}
+
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse df output: %w", err)
+		}
+		avail, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse df output: %w", err)
+		}
+		filesystems = append(filesystems, Filesystem{
+			// Mount points with spaces span the remaining fields
+			MountPoint: strings.Join(fields[5:], " "),
+			SizeKB:     size,
+			AvailKB:    avail,
+		})
+	}
+	return filesystems, nil
+}
+
+// AddDisk records a check for a filesystem's free space
+func (r *Report) AddDisk(f Filesystem) {
+	free := f.FreePercent()
+	status := StatusOK
+	switch {
+	case free < DiskFailedPercent:
+		status = StatusFailed
+	case free < DiskDegradedPercent:
+		status = StatusDegraded
+	}
+	r.Add("disk:"+f.MountPoint, status, "%.1f%% free (%d MiB of %d MiB)", free, f.AvailKB/1024, f.SizeKB/1024)
+}
+
+// AddEnvironment records a check for an environment's namespace keeper
+func (r *Report) AddEnvironment(e *env.Environment) {
+	name := "environment:" + e.Name
+	switch e.Status {
+	case env.StatusRunning:
+		r.Add(name, StatusOK, "namespace keeper is running")
+	case env.StatusProvisioning:
+		r.Add(name, StatusDegraded, "setup was interrupted; it resumes on the next shell")
+	case env.StatusStopped:
+		r.Add(name, StatusDegraded, "namespace keeper is not running; it restarts on the next shell")
+	case env.StatusNeedsRepair:
+		r.Add(name, StatusDegraded, "namespace couldn't be restarted; run shell in the project to rebuild it")
+	case env.StatusPaused:
+		r.Add(name, StatusOK, "stopped on request; resume restarts it")
+	case env.StatusCheckpointed:
+		r.Add(name, StatusOK, "processes checkpointed; restore-processes brings them back")
+	case env.StatusQuarantined:
+		r.Add(name, StatusDegraded, "quarantined; kept frozen for investigation until released")
+	default:
+		r.Add(name, StatusDegraded, "unknown status %q", e.Status)
+	}
+}
@@ -0,0 +1,126 @@
+package health
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/env"
+)
+
+func TestReportStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []Status
+		want       Status
+		wantFailed bool
+	}{
+		{name: "empty", want: StatusOK},
+		{name: "all ok", statuses: []Status{StatusOK, StatusOK}, want: StatusOK},
+		{name: "degraded", statuses: []Status{StatusOK, StatusDegraded, StatusOK}, want: StatusDegraded},
+		{name: "failed wins", statuses: []Status{StatusFailed, StatusDegraded}, want: StatusFailed, wantFailed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReport(time.Now())
+			for _, s := range tt.statuses {
+				r.Add("check", s, "message")
+			}
+			if r.Status != tt.want {
+				t.Errorf("Status = %s, want %s", r.Status, tt.want)
+			}
+			if r.Failed() != tt.wantFailed {
+				t.Errorf("Failed() = %v, want %v", r.Failed(), tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestParseDF(t *testing.T) {
+	output := `Filesystem     1024-blocks     Used Available Capacity Mounted on
+/dev/vda1         40000000 20000000  20000000      50% /
+/dev/vdb1         51200000 50000000   1200000      98% /mnt/lima-llima-box-data
+`
+	filesystems, err := ParseDF(output)
+	if err != nil {
+		t.Fatalf("ParseDF failed: %v", err)
+	}
+	if len(filesystems) != 2 {
+		t.Fatalf("expected 2 filesystems, got %d", len(filesystems))
+	}
+	if f := filesystems[1]; f.MountPoint != "/mnt/lima-llima-box-data" || f.SizeKB != 51200000 || f.AvailKB != 1200000 {
+		t.Errorf("unexpected filesystem: %+v", f)
+	}
+
+	if _, err := ParseDF("/dev/vda1 x 1 2 3% /"); err == nil {
+		t.Error("expected error for malformed output")
+	}
+}
+
+func TestAddDisk(t *testing.T) {
+	tests := []struct {
+		availKB int64
+		want    Status
+	}{
+		{availKB: 50, want: StatusOK},
+		{availKB: 15, want: StatusOK},
+		{availKB: 10, want: StatusDegraded},
+		{availKB: 4, want: StatusFailed},
+	}
+
+	for _, tt := range tests {
+		r := NewReport(time.Now())
+		r.AddDisk(Filesystem{MountPoint: "/", SizeKB: 100, AvailKB: tt.availKB})
+		if got := r.Checks[0].Status; got != tt.want {
+			t.Errorf("%d%% free: status = %s, want %s", tt.availKB, got, tt.want)
+		}
+	}
+}
+
+func TestAddEnvironment(t *testing.T) {
+	tests := []struct {
+		status env.Status
+		want   Status
+	}{
+		{status: env.StatusRunning, want: StatusOK},
+		{status: env.StatusStopped, want: StatusDegraded},
+		{status: env.StatusNeedsRepair, want: StatusDegraded},
+		{status: env.StatusProvisioning, want: StatusDegraded},
+		{status: env.StatusPaused, want: StatusOK},
+		{status: env.StatusQuarantined, want: StatusDegraded},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			r := NewReport(time.Now())
+			r.AddEnvironment(&env.Environment{Name: "app-a1b2", Status: tt.status})
+			c := r.Checks[0]
+			if c.Name != "environment:app-a1b2" || c.Status != tt.want {
+				t.Errorf("got %+v, want status %s", c, tt.want)
+			}
+			if r.Failed() {
+				t.Error("environment problems must not be hard failures")
+			}
+		})
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	r := NewReport(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	r.Add("vm", StatusOK, "running")
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"status":"ok","checkedAt":"2025-01-02T03:04:05Z","checks":[{"name":"vm","status":"ok","message":"running"}]}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	if data, _ := json.Marshal(NewReport(time.Now())); !strings.Contains(string(data), `"checks":[]`) {
+		t.Errorf("empty report should have an empty checks array: %s", data)
+	}
+}
@@ -0,0 +1,70 @@
+package health
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Load is the VM's load average: the number of processes running or waiting
+// to run, averaged over one, five, and fifteen minutes
+type Load struct {
+	One     float64 `json:"one"`
+	Five    float64 `json:"five"`
+	Fifteen float64 `json:"fifteen"`
+}
+
+// ParseLoadAvg parses the contents of /proc/loadavg
+func ParseLoadAvg(output string) (Load, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 3 {
+		return Load{}, fmt.Errorf("failed to parse load average: %q", strings.TrimSpace(output))
+	}
+	var values [3]float64
+	for i := range values {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return Load{}, fmt.Errorf("failed to parse load average: %w", err)
+		}
+		values[i] = v
+	}
+	return Load{One: values[0], Five: values[1], Fifteen: values[2]}, nil
+}
+
+// Memory is the VM's memory, in kilobytes
+type Memory struct {
+	TotalKB int64
+	AvailKB int64
+}
+
+// ParseMemInfo parses the contents of /proc/meminfo
+func ParseMemInfo(output string) (Memory, error) {
+	var m Memory
+	var haveTotal, haveAvail bool
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		var dst *int64
+		switch fields[0] {
+		case "MemTotal:":
+			dst, haveTotal = &m.TotalKB, true
+		case "MemAvailable:":
+			dst, haveAvail = &m.AvailKB, true
+		default:
+			continue
+		}
+		v, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return Memory{}, fmt.Errorf("failed to parse meminfo: %w", err)
+		}
+		*dst = v
+	}
+	if !haveTotal || !haveAvail {
+		return Memory{}, fmt.Errorf("failed to parse meminfo: MemTotal or MemAvailable missing")
+	}
+	return m, nil
+}
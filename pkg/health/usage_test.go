@@ -0,0 +1,61 @@
+package health
+
+import "testing"
+
+func TestParseLoadAvg(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    Load
+		wantErr bool
+	}{
+		{name: "proc", output: "0.52 0.38 0.21 2/187 4242\n", want: Load{One: 0.52, Five: 0.38, Fifteen: 0.21}},
+		{name: "too short", output: "0.52 0.38", wantErr: true},
+		{name: "not a number", output: "x 0.38 0.21 2/187 4242", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLoadAvg(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLoadAvg() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLoadAvg() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMemInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    Memory
+		wantErr bool
+	}{
+		{
+			name: "proc",
+			output: `MemTotal:        4010084 kB
+MemFree:          812344 kB
+MemAvailable:    3007563 kB
+Buffers:          101232 kB
+`,
+			want: Memory{TotalKB: 4010084, AvailKB: 3007563},
+		},
+		{name: "no MemAvailable", output: "MemTotal:        4010084 kB\n", wantErr: true},
+		{name: "not a number", output: "MemTotal: x kB\nMemAvailable: 1 kB\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMemInfo(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMemInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMemInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+)
+
+// Account is an environment user as the helper found it
+type Account struct {
+	UID  int
+	GID  int
+	Home string
+}
+
+// Session is the program an enter-env request becomes
+type Session struct {
+	// Args is the nsenter command entering the namespace
+	Args []string
+
+	// Env is its environment
+	Env []string
+}
+
+// sessionIDPattern matches session IDs: the PID of the SSH session's shell
+var sessionIDPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// EnterSession returns the session entering the namespace of the keeper pid
+// as account for r. Login shells start from environ, the helper's own
+// environment; fileVars are the variables of r's session variable file, and
+// session replaces SessionPlaceholder in r.SessionEnv.
+//
+// nsenter switches to the user in ModeExec and runs the command itself, so
+// no shell parses it; supplementary groups are dropped. The other modes go
+// through su --login, which keeps the request's variables through its
+// environment whitelist.
+func EnterSession(r *EnterEnvRequest, pid int, account Account, environ, fileVars []string, session string) (*Session, error) {
+	if err := r.Check(); err != nil {
+		return nil, err
+	}
+	sessionEnv := make([]string, len(r.SessionEnv))
+	for i, kv := range r.SessionEnv {
+		if strings.Contains(kv, SessionPlaceholder) && !sessionIDPattern.MatchString(session) {
+			return nil, fmt.Errorf("invalid session ID %q", session)
+		}
+		sessionEnv[i] = strings.ReplaceAll(kv, SessionPlaceholder, session)
+	}
+	vars := append(append(append([]string(nil), r.Env...), sessionEnv...), fileVars...)
+
+	args := []string{"nsenter", "--target=" + strconv.Itoa(pid), "--mount"}
+	if r.Dir != "" {
+		args = append(args, "--wdns="+r.Dir)
+	}
+
+	if r.Mode == ModeExec {
+		base := []string{"HOME=" + account.Home, "USER=" + r.Name, "LOGNAME=" + r.Name, "PATH=" + DefaultPath}
+		args = append(args, "--setuid="+strconv.Itoa(account.UID), "--setgid="+strconv.Itoa(account.GID), "--")
+		return &Session{Args: append(args, r.Command...), Env: mergeEnv(base, vars)}, nil
+	}
+
+	args = append(args, "--", "su", "--login")
+	if len(vars) > 0 {
+		names := make([]string, 0, len(vars))
+		for _, kv := range vars {
+			name, _, _ := strings.Cut(kv, "=")
+			names = append(names, name)
+		}
+		args = append(args, "--whitelist-environment="+strings.Join(mergeNames(names), ","))
+	}
+	args = append(args, r.Name)
+	if r.Mode == ModeScript {
+		script := r.Script
+		if r.Dir != "" {
+			// su --login starts in the user's home
+			script = "cd " + shellquote.Quote(r.Dir) + " && " + script
+		}
+		args = append(args, "--command", script)
+	}
+	return &Session{Args: args, Env: mergeEnv(environ, vars)}, nil
+}
+
+// ParseVarsFile returns the variables of a session variable file
+func ParseVarsFile(data []byte) ([]string, error) {
+	var vars []string
+	if err := json.Unmarshal(data, &vars); err != nil {
+		return nil, fmt.Errorf("invalid session variable file: %w", err)
+	}
+	for _, kv := range vars {
+		if err := checkVar(kv); err != nil {
+			return nil, err
+		}
+	}
+	return vars, nil
+}
+
+// mergeEnv returns base with vars set: a variable set again replaces the
+// earlier value where it was, as env(1) would
+func mergeEnv(base, vars []string) []string {
+	merged := append([]string(nil), base...)
+	index := make(map[string]int, len(merged))
+	for i, kv := range merged {
+		name, _, _ := strings.Cut(kv, "=")
+		index[name] = i
+	}
+	for _, kv := range vars {
+		name, _, _ := strings.Cut(kv, "=")
+		if i, ok := index[name]; ok {
+			merged[i] = kv
+			continue
+		}
+		index[name] = len(merged)
+		merged = append(merged, kv)
+	}
+	return merged
+}
+
+// mergeNames returns names without repeats, in order
+func mergeNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	var merged []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			merged = append(merged, name)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,115 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnterSession(t *testing.T) {
+	account := Account{UID: 1001, GID: 1002, Home: "/home/app-a1b2"}
+	environ := []string{"PATH=/usr/bin:/bin", "TERM=xterm", "SUDO_USER=lima"}
+	sessionEnv := []string{"LLIMA_BOX_SESSION_FILE=/run/llima-box/sessions/" + SessionPlaceholder + ".json"}
+
+	tests := []struct {
+		name     string
+		req      EnterEnvRequest
+		fileVars []string
+		want     Session
+	}{
+		{
+			name: "exec passes arguments as they are",
+			req: EnterEnvRequest{
+				Name:       "app-a1b2",
+				Dir:        "/Users/alice/my app",
+				Mode:       ModeExec,
+				Command:    []string{"grep", "-rn", "$(reboot); *", "src"},
+				Env:        []string{"LLIMA_BOX_ENV=app-a1b2", "PATH=/opt/toolchains/go/bin:" + DefaultPath},
+				SessionEnv: sessionEnv,
+			},
+			fileVars: []string{"API_TOKEN=it's secret", "HOME=/tmp/home"},
+			want: Session{
+				Args: []string{"nsenter", "--target=4242", "--mount", "--wdns=/Users/alice/my app", "--setuid=1001", "--setgid=1002", "--", "grep", "-rn", "$(reboot); *", "src"},
+				Env: []string{
+					"HOME=/tmp/home", "USER=app-a1b2", "LOGNAME=app-a1b2", "PATH=/opt/toolchains/go/bin:" + DefaultPath,
+					"LLIMA_BOX_ENV=app-a1b2", "LLIMA_BOX_SESSION_FILE=/run/llima-box/sessions/77.json", "API_TOKEN=it's secret",
+				},
+			},
+		},
+		{
+			name: "script runs from the directory",
+			req: EnterEnvRequest{
+				Name:       "app-a1b2",
+				Dir:        "/Users/alice/it's",
+				Mode:       ModeScript,
+				Script:     "git status && make",
+				SessionEnv: sessionEnv,
+			},
+			fileVars: []string{"API_TOKEN=x"},
+			want: Session{
+				Args: []string{
+					"nsenter", "--target=4242", "--mount", "--wdns=/Users/alice/it's", "--", "su", "--login",
+					"--whitelist-environment=LLIMA_BOX_SESSION_FILE,API_TOKEN", "app-a1b2",
+					"--command", `cd '/Users/alice/it'\''s' && git status && make`,
+				},
+				Env: append(environ[:len(environ):len(environ)], "LLIMA_BOX_SESSION_FILE=/run/llima-box/sessions/77.json", "API_TOKEN=x"),
+			},
+		},
+		{
+			name: "login shell",
+			req:  EnterEnvRequest{Name: "app-a1b2", Dir: "/work", Mode: ModeShell},
+			want: Session{
+				Args: []string{"nsenter", "--target=4242", "--mount", "--wdns=/work", "--", "su", "--login", "app-a1b2"},
+				Env:  environ,
+			},
+		},
+		{
+			name:     "variables set twice are kept once",
+			req:      EnterEnvRequest{Name: "app-a1b2", Mode: ModeShell, Env: []string{"TERM=dumb", "A=1"}},
+			fileVars: []string{"A=2"},
+			want: Session{
+				Args: []string{"nsenter", "--target=4242", "--mount", "--", "su", "--login", "--whitelist-environment=TERM,A", "app-a1b2"},
+				Env:  []string{"PATH=/usr/bin:/bin", "TERM=dumb", "SUDO_USER=lima", "A=2"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EnterSession(&tt.req, 4242, account, environ, tt.fileVars, "77")
+			if err != nil {
+				t.Fatalf("EnterSession failed: %v", err)
+			}
+			if !reflect.DeepEqual(got.Args, tt.want.Args) {
+				t.Errorf("Args = %q, want %q", got.Args, tt.want.Args)
+			}
+			if !reflect.DeepEqual(got.Env, tt.want.Env) {
+				t.Errorf("Env = %q, want %q", got.Env, tt.want.Env)
+			}
+		})
+	}
+}
+
+func TestEnterSession_InvalidSession(t *testing.T) {
+	req := &EnterEnvRequest{Name: "app-a1b2", Mode: ModeShell, SessionEnv: []string{"F=/" + SessionPlaceholder}}
+	for _, session := range []string{"", "1;id", "$$"} {
+		if _, err := EnterSession(req, 4242, Account{}, nil, nil, session); err == nil {
+			t.Errorf("expected session ID %q to be refused", session)
+		}
+	}
+}
+
+func TestParseVarsFile(t *testing.T) {
+	vars, err := ParseVarsFile([]byte(`["API_TOKEN=it's $(secret)","EMPTY="]`))
+	if err != nil {
+		t.Fatalf("ParseVarsFile failed: %v", err)
+	}
+	if want := []string{"API_TOKEN=it's $(secret)", "EMPTY="}; !reflect.DeepEqual(vars, want) {
+		t.Errorf("ParseVarsFile() = %q, want %q", vars, want)
+	}
+
+	for _, data := range []string{`API_TOKEN='x'`, `["NOVALUE"]`, `["BAD NAME=1"]`} {
+		if _, err := ParseVarsFile([]byte(data)); err == nil {
+			t.Errorf("expected %s to be refused", data)
+		}
+	}
+}
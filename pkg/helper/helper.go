@@ -0,0 +1,249 @@
+// Package helper is the protocol of llima-box-helper, the program llima-box
+// installs in the VM to create, delete, and enter environments.
+//
+// The CLI calls the helper over SSH with sudo, passing one operation and its
+// request as a single JSON argument:
+//
+//	sudo /usr/local/sbin/llima-box-helper create-env '{"name":"app-a1b2","shell":"/bin/bash"}'
+//
+// The helper runs useradd, unshare, nsenter and the like with argument
+// vectors, never through a shell, so names, paths, and commands reach them
+// unchanged whatever they contain. Replies are JSON on standard output;
+// failures are reported on standard error with a non-zero exit status.
+//
+// The request types and the functions building argument vectors are
+// portable, so the CLI and its tests share them with the helper; the helper
+// itself only builds for Linux (cmd/llima-box-helper).
+package helper
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Protocol is the version of the requests and replies. The CLI reinstalls a
+// helper reporting another version.
+const Protocol = 1
+
+// Operations
+const (
+	// OpVersion replies with a Version
+	OpVersion = "version"
+
+	// OpCreateEnv takes a CreateEnvRequest and replies with a
+	// CreateEnvResponse
+	OpCreateEnv = "create-env"
+
+	// OpDeleteEnv takes a DeleteEnvRequest and replies with a
+	// DeleteEnvResponse
+	OpDeleteEnv = "delete-env"
+
+	// OpEnterEnv takes an EnterEnvRequest and becomes the session; it
+	// doesn't reply
+	OpEnterEnv = "enter-env"
+
+	// OpCreateUser and OpDeleteUser are the operations of the shell helper
+	// the binary replaces, kept for older CLIs: create-user NAME SHELL and
+	// delete-user NAME
+	OpCreateUser = "create-user"
+	OpDeleteUser = "delete-user"
+)
+
+// VM layout the helper works in. pkg/env has its own copies of these paths
+// and checks in its tests that they agree.
+const (
+	// EnvsDir holds each environment's state directory
+	EnvsDir = "/envs"
+
+	// LocksDir holds the VM-side locks shared with the CLI's scripts
+	LocksDir = "/run/llima-box/locks"
+
+	// HomeBase is where environment homes go when the data disk is mounted;
+	// /home is used otherwise
+	HomeBase = "/mnt/lima-llima-box-data/home"
+
+	// WorkspaceRoot holds VM workspaces
+	WorkspaceRoot = "/mnt/lima-llima-box-data/workspaces"
+
+	// OverlayRoot holds workspace overlays
+	OverlayRoot = "/mnt/lima-llima-box-data/overlays"
+
+	// CgroupRoot holds environments' resource limits
+	CgroupRoot = "/sys/fs/cgroup/llima-box"
+
+	// SessionVarsDir holds session variable files (see
+	// EnterEnvRequest.VarsFile)
+	SessionVarsDir = "/run/llima-box-sessions"
+
+	// EnvGroup is the group of environment users; sudo refuses its members
+	EnvGroup = "llima-box-env"
+
+	// DefaultPath is the PATH of commands run in ModeExec
+	DefaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+)
+
+// Version is the reply to OpVersion
+type Version struct {
+	Protocol int `json:"protocol"`
+}
+
+// CreateEnvRequest creates an environment's user account and, with
+// Namespace, starts the keeper process holding its mount and PID
+// namespaces. Both are kept if they exist, so the request can be repeated.
+type CreateEnvRequest struct {
+	// Name is the environment and user name
+	Name string `json:"name"`
+
+	// Shell is the user's login shell; it must be listed in /etc/shells
+	Shell string `json:"shell"`
+
+	// Namespace starts the namespace keeper unless one is alive
+	Namespace bool `json:"namespace,omitempty"`
+}
+
+// CreateEnvResponse is the reply to a CreateEnvRequest
+type CreateEnvResponse struct {
+	// NamespacePID is the keeper's PID, with CreateEnvRequest.Namespace
+	NamespacePID int `json:"namespacePid,omitempty"`
+}
+
+// DeleteEnvRequest deletes an environment: its processes and namespace
+// keeper, resource limits, user account and home directory, overlay, and
+// state, and its VM workspace if it has one
+type DeleteEnvRequest struct {
+	// Name is the environment and user name
+	Name string `json:"name"`
+
+	// Workspace is the environment's VM workspace, which must be under
+	// WorkspaceRoot
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// DeleteEnvResponse is the reply to a DeleteEnvRequest
+type DeleteEnvResponse struct {
+	// Warnings describe the best-effort steps that failed
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Session modes
+const (
+	// ModeShell starts the user's login shell
+	ModeShell = "shell"
+
+	// ModeScript runs Script with the user's login shell
+	ModeScript = "script"
+
+	// ModeExec runs Command directly, without a shell or login profile
+	ModeExec = "exec"
+)
+
+// SessionPlaceholder stands for the session ID, passed with --session, in
+// the values of EnterEnvRequest.SessionEnv
+const SessionPlaceholder = "{session}"
+
+// EnterEnvRequest enters an environment's namespace as its user
+type EnterEnvRequest struct {
+	// Name is the environment and user name
+	Name string `json:"name"`
+
+	// Dir is the directory the session starts in
+	Dir string `json:"dir,omitempty"`
+
+	// Mode is ModeShell, ModeScript, or ModeExec
+	Mode string `json:"mode"`
+
+	// Script is the command line run in ModeScript
+	Script string `json:"script,omitempty"`
+
+	// Command is the argument vector run in ModeExec
+	Command []string `json:"command,omitempty"`
+
+	// Env holds NAME=VALUE variables for the session. In ModeExec they're
+	// the program's environment, after HOME, USER, LOGNAME, and PATH, which
+	// they can override; login shells keep them through su.
+	Env []string `json:"env,omitempty"`
+
+	// SessionEnv holds variables like Env whose values have
+	// SessionPlaceholder replaced with the session ID
+	SessionEnv []string `json:"sessionEnv,omitempty"`
+
+	// VarsFile is a session variable file under SessionVarsDir holding a
+	// JSON list of NAME=VALUE variables, which win over Env. The helper
+	// removes it as the session starts, so the values never appear on a
+	// command line.
+	VarsFile string `json:"varsFile,omitempty"`
+}
+
+// namePattern matches the names the helper accepts for environments: plain
+// user names that can't be taken for options
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// varPattern matches environment variable names
+var varPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// CheckName returns an error unless name can be an environment's name
+func CheckName(name string) error {
+	if !namePattern.MatchString(name) || len(name) > 32 {
+		return fmt.Errorf("invalid environment name %q", name)
+	}
+	return nil
+}
+
+// CheckWorkspace returns an error unless dir is a VM workspace directory
+func CheckWorkspace(dir string) error {
+	if dir == "" || path.Clean(dir) != dir || !strings.HasPrefix(dir, WorkspaceRoot+"/") || strings.Contains(strings.TrimPrefix(dir, WorkspaceRoot+"/"), "/") {
+		return fmt.Errorf("invalid workspace %q: not a directory of %s", dir, WorkspaceRoot)
+	}
+	return nil
+}
+
+// CheckVarsFile returns an error unless file is a session variable file
+func CheckVarsFile(file string) error {
+	if path.Dir(file) != SessionVarsDir || strings.HasPrefix(path.Base(file), ".") {
+		return fmt.Errorf("invalid session variable file %q", file)
+	}
+	return nil
+}
+
+// Check returns an error for a request the helper refuses
+func (r *EnterEnvRequest) Check() error {
+	if err := CheckName(r.Name); err != nil {
+		return err
+	}
+	switch r.Mode {
+	case ModeShell:
+	case ModeScript:
+		if r.Script == "" {
+			return fmt.Errorf("script mode needs a script")
+		}
+	case ModeExec:
+		if len(r.Command) == 0 {
+			return fmt.Errorf("exec mode needs a command")
+		}
+	default:
+		return fmt.Errorf("unknown session mode %q", r.Mode)
+	}
+	if r.Dir != "" && !path.IsAbs(r.Dir) {
+		return fmt.Errorf("session directory %q isn't absolute", r.Dir)
+	}
+	for _, kv := range append(append([]string(nil), r.Env...), r.SessionEnv...) {
+		if err := checkVar(kv); err != nil {
+			return err
+		}
+	}
+	if r.VarsFile != "" {
+		return CheckVarsFile(r.VarsFile)
+	}
+	return nil
+}
+
+// checkVar returns an error unless kv is a NAME=VALUE assignment
+func checkVar(kv string) error {
+	name, _, ok := strings.Cut(kv, "=")
+	if !ok || !varPattern.MatchString(name) {
+		return fmt.Errorf("invalid variable %q", kv)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "app-a1b2"},
+		{name: "9lives-0f0f"},
+		{name: "", wantErr: true},
+		{name: "-rf", wantErr: true},
+		{name: "../etc", wantErr: true},
+		{name: "App-a1b2", wantErr: true},
+		{name: "app a1b2", wantErr: true},
+		{name: "app;reboot", wantErr: true},
+		{name: strings.Repeat("a", 33), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckName(tt.name); (err != nil) != tt.wantErr {
+				t.Errorf("CheckName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckWorkspace(t *testing.T) {
+	tests := []struct {
+		dir     string
+		wantErr bool
+	}{
+		{dir: WorkspaceRoot + "/scratch"},
+		{dir: "", wantErr: true},
+		{dir: WorkspaceRoot, wantErr: true},
+		{dir: WorkspaceRoot + "/", wantErr: true},
+		{dir: WorkspaceRoot + "/../overlays", wantErr: true},
+		{dir: WorkspaceRoot + "/scratch/sub", wantErr: true},
+		{dir: "/etc", wantErr: true},
+		{dir: WorkspaceRoot + "-other/scratch", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			if err := CheckWorkspace(tt.dir); (err != nil) != tt.wantErr {
+				t.Errorf("CheckWorkspace(%q) error = %v, wantErr %v", tt.dir, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnterEnvRequest_Check(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     EnterEnvRequest
+		wantErr string
+	}{
+		{name: "shell", req: EnterEnvRequest{Name: "app-a1b2", Mode: ModeShell}},
+		{name: "script", req: EnterEnvRequest{Name: "app-a1b2", Mode: ModeScript, Script: "make"}},
+		{name: "exec", req: EnterEnvRequest{Name: "app-a1b2", Mode: ModeExec, Command: []string{"make"}, Env: []string{"A=1"}}},
+		{name: "vars file", req: EnterEnvRequest{Name: "app-a1b2", Mode: ModeShell, VarsFile: SessionVarsDir + "/f00d"}},
+		{name: "bad name", req: EnterEnvRequest{Name: "root;id", Mode: ModeShell}, wantErr: "invalid environment name"},
+		{name: "unknown mode", req: EnterEnvRequest{Name: "app-a1b2", Mode: "sudo"}, wantErr: "unknown session mode"},
+		{name: "empty script", req: EnterEnvRequest{Name: "app-a1b2", Mode: ModeScript}, wantErr: "needs a script"},
+		{name: "empty command", req: EnterEnvRequest{Name: "app-a1b2", Mode: ModeExec}, wantErr: "needs a command"},
+		{name: "relative dir", req: EnterEnvRequest{Name: "app-a1b2", Mode: ModeShell, Dir: "src"}, wantErr: "isn't absolute"},
+		{name: "bad variable", req: EnterEnvRequest{Name: "app-a1b2", Mode: ModeShell, Env: []string{"LD_PRELOAD"}}, wantErr: "invalid variable"},
+		{name: "bad session variable", req: EnterEnvRequest{Name: "app-a1b2", Mode: ModeShell, SessionEnv: []string{"A B=1"}}, wantErr: "invalid variable"},
+		{name: "vars file elsewhere", req: EnterEnvRequest{Name: "app-a1b2", Mode: ModeShell, VarsFile: "/etc/shadow"}, wantErr: "invalid session variable file"},
+		{name: "vars file escaping", req: EnterEnvRequest{Name: "app-a1b2", Mode: ModeShell, VarsFile: SessionVarsDir + "/../shadow"}, wantErr: "invalid session variable file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Check()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Check() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Check() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Package hooks runs commands on the host at points in an environment's
+// lifecycle.
+//
+// Hooks let teams connect llima-box to their own tools, such as opening a
+// ticket when an agent's environment is created, tracking the time spent in
+// sessions, or taking a custom backup before an environment is deleted,
+// without changing llima-box. Each hook is a shell command from the host
+// configuration; it learns what it runs for from LLIMA_BOX_* environment
+// variables.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/hostcmd"
+)
+
+// ErrHookFailed is returned when a hook exits unsuccessfully or doesn't
+// finish within its timeout
+var ErrHookFailed = errors.New("hook failed")
+
+// DefaultTimeout is how long a hook may run when no timeout is set
+const DefaultTimeout = 5 * time.Minute
+
+// Event is a point in an environment's lifecycle at which a hook runs
+type Event string
+
+const (
+	// PreCreate runs before a new environment is set up. A failure stops
+	// the creation.
+	PreCreate Event = "pre-create"
+
+	// PostCreate runs once a new environment is set up
+	PostCreate Event = "post-create"
+
+	// PreDelete runs before an environment is deleted. A failure stops the
+	// deletion.
+	PreDelete Event = "pre-delete"
+
+	// PostExec runs when a shell or command in an environment finishes
+	PostExec Event = "post-exec"
+)
+
+// Blocking reports whether a failing hook for e stops the operation. Hooks
+// that run afterwards can only be reported.
+func (e Event) Blocking() bool {
+	return e == PreCreate || e == PreDelete
+}
+
+// Context describes what a hook runs for
+type Context struct {
+	// Environment is the environment's name
+	Environment string
+
+	// ProjectPath is the environment's project directory
+	ProjectPath string
+
+	// Instance is the Lima instance of the environment's VM
+	Instance string
+
+	// Command is what ran, for PostExec; empty for an interactive shell
+	Command []string
+
+	// ExitStatus is the command's exit status, for PostExec. It's -1 if the
+	// command didn't report one.
+	ExitStatus int
+
+	// Duration is how long the command ran, for PostExec
+	Duration time.Duration
+}
+
+// Hook is a command run through sh (cmd.exe on Windows) at an event. It gets
+// the event and its context in these environment variables:
+//
+//	LLIMA_BOX_HOOK         the event, e.g. "pre-create"
+//	LLIMA_BOX_ENV          the environment's name
+//	LLIMA_BOX_PROJECT      the environment's project directory
+//	LLIMA_BOX_INSTANCE     the VM's Lima instance
+//	LLIMA_BOX_COMMAND      the command that ran (post-exec)
+//	LLIMA_BOX_EXIT_STATUS  the command's exit status (post-exec)
+//	LLIMA_BOX_DURATION     how long the command ran, in seconds (post-exec)
+//
+// The hook's output goes to standard error, so it doesn't mix with the
+// output of commands run in the environment.
+type Hook struct {
+	// Event is when the hook runs
+	Event Event
+
+	// Command is the shell command to run
+	Command string
+
+	// Timeout bounds how long the hook may run (default: DefaultTimeout)
+	Timeout time.Duration
+}
+
+// Run runs the hook for c and waits for it to finish. Failures wrap
+// ErrHookFailed.
+func (h *Hook) Run(ctx context.Context, c Context) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := hostcmd.Command(ctx, h.Command)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), h.environ(c)...)
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w: %s hook didn't finish within %s", ErrHookFailed, h.Event, timeout)
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case errors.As(err, &exitErr):
+		return fmt.Errorf("%w: %s hook exited with status %d", ErrHookFailed, h.Event, exitErr.ExitCode())
+	default:
+		return fmt.Errorf("failed to run %s hook: %w", h.Event, err)
+	}
+}
+
+// environ returns the variables describing the hook's event and c
+func (h *Hook) environ(c Context) []string {
+	vars := []string{
+		"LLIMA_BOX_HOOK=" + string(h.Event),
+		"LLIMA_BOX_ENV=" + c.Environment,
+		"LLIMA_BOX_PROJECT=" + c.ProjectPath,
+		"LLIMA_BOX_INSTANCE=" + c.Instance,
+	}
+	if h.Event == PostExec {
+		vars = append(vars,
+			"LLIMA_BOX_COMMAND="+strings.Join(c.Command, " "),
+			"LLIMA_BOX_EXIT_STATUS="+strconv.Itoa(c.ExitStatus),
+			"LLIMA_BOX_DURATION="+strconv.FormatInt(int64(c.Duration.Seconds()), 10),
+		)
+	}
+	return vars
+}
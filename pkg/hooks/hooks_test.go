@@ -0,0 +1,77 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHookRun(t *testing.T) {
+	c := Context{
+		Environment: "app-a1b2",
+		ProjectPath: "/Users/alice/app",
+		Instance:    "llima-box",
+		Command:     []string{"make", "test"},
+		ExitStatus:  2,
+		Duration:    90 * time.Second,
+	}
+
+	tests := []struct {
+		name    string
+		event   Event
+		command string
+		timeout time.Duration
+		wantErr string
+	}{
+		{name: "success", event: PreCreate, command: "exit 0"},
+		{name: "failure", event: PreDelete, command: "exit 3", wantErr: "pre-delete hook exited with status 3"},
+		{name: "timed out", event: PostCreate, command: "sleep 5", timeout: 50 * time.Millisecond, wantErr: "didn't finish within"},
+		{
+			name:    "environment variables",
+			event:   PreCreate,
+			command: `[ "$LLIMA_BOX_HOOK" = pre-create ] && [ "$LLIMA_BOX_ENV" = app-a1b2 ] && [ "$LLIMA_BOX_PROJECT" = /Users/alice/app ] && [ "$LLIMA_BOX_INSTANCE" = llima-box ] && [ -z "$LLIMA_BOX_COMMAND" ]`,
+		},
+		{
+			name:    "command result",
+			event:   PostExec,
+			command: `[ "$LLIMA_BOX_COMMAND" = "make test" ] && [ "$LLIMA_BOX_EXIT_STATUS" = 2 ] && [ "$LLIMA_BOX_DURATION" = 90 ]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := &Hook{Event: tt.event, Command: tt.command, Timeout: tt.timeout}
+			err := hook.Run(context.Background(), c)
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected success, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrHookFailed) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected a failure containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestHookRun_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := (&Hook{Event: PostExec, Command: "sleep 5"}).Run(ctx, Context{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestEventBlocking(t *testing.T) {
+	for event, want := range map[Event]bool{PreCreate: true, PostCreate: false, PreDelete: true, PostExec: false} {
+		if got := event.Blocking(); got != want {
+			t.Errorf("%s.Blocking() = %v, want %v", event, got, want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Event is a line logged by a maintenance task
+type Event struct {
+	// Task is the name of the task that logged the line
+	Task string
+
+	// Message is the logged line
+	Message string
+}
+
+// RecentEvents returns up to n of the most recent lines from each task log
+func RecentEvents(ctx context.Context, exec executor, n int) ([]Event, error) {
+	// tail prints a "==> file <==" header before each file's lines
+	cmd := fmt.Sprintf("sudo sh -c 'tail -v -n %d %s/maintenance-*.log 2>/dev/null' || true", n, LogDir)
+	output, err := exec.ExecContext(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read maintenance logs: %w", err)
+	}
+	return parseTail(output), nil
+}
+
+// parseTail parses multi-file tail output into events
+func parseTail(output string) []Event {
+	var events []Event
+	var task string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "==> ") && strings.HasSuffix(line, " <==") {
+			file := path.Base(strings.TrimSuffix(strings.TrimPrefix(line, "==> "), " <=="))
+			task = strings.TrimSuffix(strings.TrimPrefix(file, "maintenance-"), ".log")
+			continue
+		}
+		if strings.TrimSpace(line) == "" || task == "" {
+			continue
+		}
+		events = append(events, Event{Task: task, Message: line})
+	}
+	return events
+}
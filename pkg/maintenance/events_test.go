@@ -0,0 +1,26 @@
+package maintenance
+
+import "testing"
+
+func TestParseTail(t *testing.T) {
+	output := "==> /var/log/llima-box/maintenance-apt-clean.log <==\n" +
+		"Reading package lists...\n" +
+		"\n" +
+		"==> /var/log/llima-box/maintenance-tmp-prune.log <==\n" +
+		"removed '/tmp/old'\n"
+
+	got := parseTail(output)
+
+	want := []Event{
+		{Task: "apt-clean", Message: "Reading package lists..."},
+		{Task: "tmp-prune", Message: "removed '/tmp/old'"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseTail() returned %d events, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseTail()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Package maintenance installs and runs scheduled maintenance tasks inside
+// the llima-box VM.
+//
+// Tasks are rendered into /etc/cron.d/llima-box so the VM's cron daemon runs
+// them even when llima-box itself isn't running. Each task runs under a
+// non-blocking lock (overlapping runs are skipped) and logs to
+// /var/log/llima-box/maintenance-<name>.log.
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/middlendian/llima-box/internal/shellquote"
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+const (
+	// CronFile is the cron table managed by llima-box inside the VM
+	CronFile = "/etc/cron.d/llima-box"
+
+	// LogDir holds maintenance task logs inside the VM
+	LogDir = "/var/log/llima-box"
+)
+
+// executor runs commands inside the VM
+type executor interface {
+	ExecContext(ctx context.Context, cmd string) (string, error)
+	ExecContextStreaming(ctx context.Context, cmd string, output io.Writer) error
+}
+
+// Scheduler manages maintenance tasks inside the VM
+type Scheduler struct {
+	exec  executor
+	tasks []config.MaintenanceTask
+}
+
+// NewScheduler creates a scheduler for the given tasks
+func NewScheduler(exec executor, tasks []config.MaintenanceTask) *Scheduler {
+	return &Scheduler{exec: exec, tasks: tasks}
+}
+
+// Tasks returns the configured tasks
+func (s *Scheduler) Tasks() []config.MaintenanceTask {
+	return s.tasks
+}
+
+// Sync installs the cron table for the configured tasks, replacing any
+// previous one. With no tasks the cron table is removed.
+func (s *Scheduler) Sync(ctx context.Context) error {
+	if len(s.tasks) == 0 {
+		if _, err := s.exec.ExecContext(ctx, "sudo rm -f "+CronFile); err != nil {
+			return fmt.Errorf("failed to remove maintenance schedule: %w", err)
+		}
+		return nil
+	}
+
+	cmd := fmt.Sprintf("sudo mkdir -p %s && printf '%%s' %s | sudo tee %s >/dev/null && sudo chmod 644 %s",
+		LogDir, shellquote.Quote(renderCrontab(s.tasks)), CronFile, CronFile)
+	if _, err := s.exec.ExecContext(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to install maintenance schedule: %w", err)
+	}
+	return nil
+}
+
+// Run runs a task immediately, writing its output to output as it runs
+func (s *Scheduler) Run(ctx context.Context, name string, output io.Writer) error {
+	for _, task := range s.tasks {
+		if task.Name == name {
+			if err := s.exec.ExecContextStreaming(ctx, "sudo "+taskCommand(task), output); err != nil {
+				return fmt.Errorf("maintenance task %s failed: %w", name, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown maintenance task %q", name)
+}
+
+// taskCommand wraps a task's command with its lock
+func taskCommand(task config.MaintenanceTask) string {
+	return fmt.Sprintf("flock -n /run/llima-box-%s.lock sh -c %s", task.Name, shellquote.Quote(task.Command))
+}
+
+// renderCrontab renders tasks as an /etc/cron.d table
+func renderCrontab(tasks []config.MaintenanceTask) string {
+	var b strings.Builder
+	b.WriteString("# Managed by llima-box - changes will be overwritten\n")
+	b.WriteString("SHELL=/bin/sh\n")
+	b.WriteString("PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin\n")
+	for _, task := range tasks {
+		// cron treats unescaped % as a newline
+		line := strings.ReplaceAll(taskCommand(task), "%", `\%`)
+		fmt.Fprintf(&b, "%s root %s >>%s/maintenance-%s.log 2>&1\n", task.Schedule, line, LogDir, task.Name)
+	}
+	return b.String()
+}
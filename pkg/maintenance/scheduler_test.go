@@ -0,0 +1,87 @@
+package maintenance
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/config"
+)
+
+// recordingExecutor records executed commands
+type recordingExecutor struct {
+	calls    []string
+	streamed []string
+}
+
+func (r *recordingExecutor) ExecContext(_ context.Context, cmd string) (string, error) {
+	r.calls = append(r.calls, cmd)
+	return "", nil
+}
+
+func (r *recordingExecutor) ExecContextStreaming(_ context.Context, cmd string, _ io.Writer) error {
+	r.streamed = append(r.streamed, cmd)
+	return nil
+}
+
+func TestRenderCrontab(t *testing.T) {
+	tasks := []config.MaintenanceTask{
+		{Name: "apt-clean", Schedule: "@weekly", Command: "apt-get clean"},
+		{Name: "stamp", Schedule: "0 3 * * *", Command: "date +%F > /tmp/stamp"},
+	}
+
+	got := renderCrontab(tasks)
+
+	want := []string{
+		"@weekly root flock -n /run/llima-box-apt-clean.lock sh -c 'apt-get clean' >>/var/log/llima-box/maintenance-apt-clean.log 2>&1",
+		`0 3 * * * root flock -n /run/llima-box-stamp.lock sh -c 'date +\%F > /tmp/stamp' >>/var/log/llima-box/maintenance-stamp.log 2>&1`,
+	}
+	for _, line := range want {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("crontab missing line:\n%s\ngot:\n%s", line, got)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	t.Run("installs crontab", func(t *testing.T) {
+		exec := &recordingExecutor{}
+		s := NewScheduler(exec, config.DefaultMaintenanceTasks())
+
+		if err := s.Sync(context.Background()); err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		if len(exec.calls) != 1 || !strings.Contains(exec.calls[0], "sudo tee "+CronFile) {
+			t.Errorf("expected crontab install, got %v", exec.calls)
+		}
+	})
+
+	t.Run("removes crontab without tasks", func(t *testing.T) {
+		exec := &recordingExecutor{}
+		s := NewScheduler(exec, nil)
+
+		if err := s.Sync(context.Background()); err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		if len(exec.calls) != 1 || exec.calls[0] != "sudo rm -f "+CronFile {
+			t.Errorf("expected crontab removal, got %v", exec.calls)
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	exec := &recordingExecutor{}
+	s := NewScheduler(exec, config.DefaultMaintenanceTasks())
+
+	if err := s.Run(context.Background(), "apt-clean", io.Discard); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(exec.streamed) != 1 || exec.streamed[0] != "sudo flock -n /run/llima-box-apt-clean.lock sh -c 'apt-get clean'" {
+		t.Errorf("unexpected command: %v", exec.streamed)
+	}
+
+	if err := s.Run(context.Background(), "nope", io.Discard); err == nil {
+		t.Error("expected error for unknown task")
+	}
+}
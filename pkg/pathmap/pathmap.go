@@ -0,0 +1,225 @@
+// Package pathmap translates host paths into the paths where the VM sees
+// them.
+//
+// Lima mounts host directories into the VM. On macOS and Linux hosts a
+// directory is mounted at the same path it has on the host; on Windows hosts
+// drive letters become /mnt/<drive>. Host filesystems on macOS and Windows
+// are usually case-insensitive while the VM's is not, so a path typed in the
+// wrong case works on the host but not in the VM. A Mapper canonicalizes host
+// paths and maps them through the VM's mounts in one place, so callers don't
+// need to know any of this.
+package pathmap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ErrNotShared is returned for host paths outside every mount
+var ErrNotShared = errors.New("path is not shared with the VM")
+
+// Mount is a host directory mounted into the VM
+type Mount struct {
+	// Host is the absolute host path of the mounted directory
+	Host string
+
+	// VM is where the directory appears inside the VM
+	VM string
+}
+
+// Mapper maps host paths through a set of mounts. A nil Mapper maps every
+// path to itself.
+type Mapper struct {
+	mounts []Mount
+	goos   string
+}
+
+// New returns a Mapper for mounts on a host running goos (a runtime.GOOS
+// value). Mounts without a VM path get the default for goos.
+func New(mounts []Mount, goos string) *Mapper {
+	m := &Mapper{goos: goos}
+	for _, mount := range mounts {
+		host := m.clean(mount.Host)
+		vm := mount.VM
+		if vm == "" {
+			vm = DefaultVMPath(host, goos)
+		}
+		m.mounts = append(m.mounts, Mount{Host: host, VM: path.Clean(vm)})
+	}
+	return m
+}
+
+// ForHost returns a Mapper for mounts on the current host
+func ForHost(mounts []Mount) *Mapper {
+	return New(mounts, runtime.GOOS)
+}
+
+// DefaultVMPath returns where Lima mounts a host directory when no mount
+// point is configured: the same path, except that Windows drive letters
+// become /mnt/<drive>
+func DefaultVMPath(hostPath, goos string) string {
+	if goos != "windows" {
+		return path.Clean(hostPath)
+	}
+	p := strings.ReplaceAll(hostPath, `\`, "/")
+	if len(p) >= 2 && p[1] == ':' {
+		p = "/mnt/" + strings.ToLower(p[:1]) + "/" + strings.TrimPrefix(p[2:], "/")
+	}
+	return path.Clean(p)
+}
+
+// Mounts returns the mounts the Mapper translates through
+func (m *Mapper) Mounts() []Mount {
+	if m == nil {
+		return nil
+	}
+	return append([]Mount(nil), m.mounts...)
+}
+
+// caseInsensitive reports whether host paths compare without regard to case
+func (m *Mapper) caseInsensitive() bool {
+	return m.goos == "darwin" || m.goos == "windows"
+}
+
+// clean normalizes a host path's separators and redundant elements
+func (m *Mapper) clean(p string) string {
+	if m.goos == "windows" {
+		p = strings.ReplaceAll(p, `\`, "/")
+	}
+	return path.Clean(p)
+}
+
+// ToVM returns where the host path hostPath appears in the VM. hostPath must
+// be absolute; use Canonical first for paths typed by a user. Paths outside
+// every mount return ErrNotShared.
+func (m *Mapper) ToVM(hostPath string) (string, error) {
+	if m == nil {
+		return hostPath, nil
+	}
+
+	p := m.clean(hostPath)
+	best := -1
+	for i, mount := range m.mounts {
+		if m.within(p, mount.Host) && (best < 0 || len(mount.Host) > len(m.mounts[best].Host)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", fmt.Errorf("%w: %s", ErrNotShared, hostPath)
+	}
+
+	mount := m.mounts[best]
+	return path.Join(mount.VM, p[len(mount.Host):]), nil
+}
+
+// ToHost returns the host path for a VM path inside one of the mounts
+func (m *Mapper) ToHost(vmPath string) (string, bool) {
+	if m == nil {
+		return vmPath, true
+	}
+
+	p := path.Clean(vmPath)
+	best := -1
+	for i, mount := range m.mounts {
+		inside := mount.VM == "/" || p == mount.VM || strings.HasPrefix(p, mount.VM+"/")
+		if inside && (best < 0 || len(mount.VM) > len(m.mounts[best].VM)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", false
+	}
+
+	mount := m.mounts[best]
+	host := path.Join(mount.Host, strings.TrimPrefix(p, mount.VM))
+	if m.goos == "windows" {
+		host = strings.ReplaceAll(host, "/", `\`)
+	}
+	return host, true
+}
+
+// Contains reports whether the host path p is dir or inside it, comparing
+// without regard to case on case-insensitive hosts. Both paths must be
+// canonical.
+func (m *Mapper) Contains(dir, p string) bool {
+	if m == nil {
+		m = &Mapper{}
+	}
+	return m.within(m.clean(p), m.clean(dir))
+}
+
+// within reports whether p is prefix or inside it
+func (m *Mapper) within(p, prefix string) bool {
+	if len(p) < len(prefix) {
+		return false
+	}
+	head := p[:len(prefix)]
+	if m.caseInsensitive() {
+		if !strings.EqualFold(head, prefix) {
+			return false
+		}
+	} else if head != prefix {
+		return false
+	}
+	return len(p) == len(prefix) || p[len(prefix)] == '/' || strings.HasSuffix(prefix, "/")
+}
+
+// Canonical returns the absolute form of a host path with symlinks resolved
+// (macOS /tmp is /private/tmp, for example) and, on case-insensitive hosts,
+// each existing element spelled as it is on disk. Elements that don't exist
+// are kept as given. The result names the same directory however the user
+// typed it, so it's safe to derive names from.
+func (m *Mapper) Canonical(hostPath string) (string, error) {
+	abs, err := filepath.Abs(hostPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+
+	if m != nil && m.caseInsensitive() {
+		abs = canonicalCase(abs)
+	}
+	return abs, nil
+}
+
+// canonicalCase spells each element of an absolute path the way its
+// directory lists it, stopping at the first element that can't be found
+func canonicalCase(abs string) string {
+	vol := filepath.VolumeName(abs)
+	parts := strings.Split(strings.TrimPrefix(abs[len(vol):], string(filepath.Separator)), string(filepath.Separator))
+
+	dir := vol + string(filepath.Separator)
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return filepath.Join(append([]string{dir}, parts[i:]...)...)
+		}
+
+		match := ""
+		for _, e := range entries {
+			if e.Name() == part {
+				match = part
+				break
+			}
+			if match == "" && strings.EqualFold(e.Name(), part) {
+				match = e.Name()
+			}
+		}
+		if match == "" {
+			return filepath.Join(append([]string{dir}, parts[i:]...)...)
+		}
+		dir = filepath.Join(dir, match)
+	}
+	return dir
+}
@@ -0,0 +1,250 @@
+package pathmap
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestToVM(t *testing.T) {
+	tests := []struct {
+		name    string
+		goos    string
+		mounts  []Mount
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "macOS home mounted at the same path",
+			goos:   "darwin",
+			mounts: []Mount{{Host: "/Users/alice"}},
+			in:     "/Users/alice/src/app",
+			want:   "/Users/alice/src/app",
+		},
+		{
+			name:   "macOS prefix in another case",
+			goos:   "darwin",
+			mounts: []Mount{{Host: "/Users/alice"}},
+			in:     "/users/ALICE/src/app",
+			want:   "/Users/alice/src/app",
+		},
+		{
+			name:    "Linux is case-sensitive",
+			goos:    "linux",
+			mounts:  []Mount{{Host: "/home/alice"}},
+			in:      "/Home/alice/app",
+			wantErr: true,
+		},
+		{
+			name:    "external volume not mounted",
+			goos:    "darwin",
+			mounts:  []Mount{{Host: "/Users/alice"}},
+			in:      "/Volumes/External/app",
+			wantErr: true,
+		},
+		{
+			name:   "external volume with explicit mount point",
+			goos:   "darwin",
+			mounts: []Mount{{Host: "/Users/alice"}, {Host: "/Volumes/External", VM: "/mnt/external"}},
+			in:     "/Volumes/External/app",
+			want:   "/mnt/external/app",
+		},
+		{
+			name:    "sibling with common prefix",
+			goos:    "linux",
+			mounts:  []Mount{{Host: "/home/alice"}},
+			in:      "/home/alice2/app",
+			wantErr: true,
+		},
+		{
+			name:   "longest mount wins",
+			goos:   "linux",
+			mounts: []Mount{{Host: "/home/alice"}, {Host: "/home/alice/work", VM: "/work"}},
+			in:     "/home/alice/work/app",
+			want:   "/work/app",
+		},
+		{
+			name:   "mount root itself",
+			goos:   "linux",
+			mounts: []Mount{{Host: "/home/alice"}},
+			in:     "/home/alice",
+			want:   "/home/alice",
+		},
+		{
+			name:   "Windows drive letter",
+			goos:   "windows",
+			mounts: []Mount{{Host: `C:\Users\alice`}},
+			in:     `c:\users\alice\src\app`,
+			want:   "/mnt/c/Users/alice/src/app",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.mounts, tt.goos).ToVM(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrNotShared) {
+					t.Errorf("expected ErrNotShared, got %q, %v", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ToVM(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToHost(t *testing.T) {
+	tests := []struct {
+		name   string
+		goos   string
+		mounts []Mount
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "same path",
+			goos:   "darwin",
+			mounts: []Mount{{Host: "/Users/alice"}},
+			in:     "/Users/alice/app",
+			want:   "/Users/alice/app",
+			wantOK: true,
+		},
+		{
+			name:   "mount point",
+			goos:   "linux",
+			mounts: []Mount{{Host: "/srv/data", VM: "/mnt/data"}},
+			in:     "/mnt/data/x",
+			want:   "/srv/data/x",
+			wantOK: true,
+		},
+		{
+			name:   "not mounted",
+			goos:   "linux",
+			mounts: []Mount{{Host: "/home/alice"}},
+			in:     "/opt/toolchains/node",
+		},
+		{
+			name:   "Windows",
+			goos:   "windows",
+			mounts: []Mount{{Host: `C:\Users\alice`}},
+			in:     "/mnt/c/Users/alice/app",
+			want:   `C:\Users\alice\app`,
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := New(tt.mounts, tt.goos).ToHost(tt.in)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("ToHost(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDefaultVMPath(t *testing.T) {
+	tests := []struct {
+		goos string
+		in   string
+		want string
+	}{
+		{goos: "darwin", in: "/Users/alice/", want: "/Users/alice"},
+		{goos: "linux", in: "/home/alice", want: "/home/alice"},
+		{goos: "windows", in: `D:\`, want: "/mnt/d"},
+		{goos: "windows", in: `C:\Users\alice`, want: "/mnt/c/Users/alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.goos+" "+tt.in, func(t *testing.T) {
+			if got := DefaultVMPath(tt.in, tt.goos); got != tt.want {
+				t.Errorf("DefaultVMPath(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilMapper(t *testing.T) {
+	var m *Mapper
+	if got, err := m.ToVM("/anywhere"); err != nil || got != "/anywhere" {
+		t.Errorf("ToVM = %q, %v; want identity", got, err)
+	}
+	if got, ok := m.ToHost("/anywhere"); !ok || got != "/anywhere" {
+		t.Errorf("ToHost = %q, %v; want identity", got, ok)
+	}
+}
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		goos string
+		dir  string
+		p    string
+		want bool
+	}{
+		{goos: "linux", dir: "/home/alice", p: "/home/alice", want: true},
+		{goos: "linux", dir: "/home/alice", p: "/home/alice/src", want: true},
+		{goos: "linux", dir: "/home/alice", p: "/home/alice2", want: false},
+		{goos: "linux", dir: "/home/alice", p: "/home/Alice/src", want: false},
+		{goos: "darwin", dir: "/Users/alice", p: "/users/Alice/src", want: true},
+		{goos: "linux", dir: "/", p: "/etc", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := New(nil, tt.goos).Contains(tt.dir, tt.p); got != tt.want {
+			t.Errorf("Contains(%q, %q) on %s = %v, want %v", tt.dir, tt.p, tt.goos, got, tt.want)
+		}
+	}
+
+	var m *Mapper
+	if !m.Contains("/home/alice", "/home/alice/src") {
+		t.Error("expected a nil mapper to compare paths")
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := filepath.Join(root, "MyProject")
+	if err := os.Mkdir(project, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(project, link); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		goos string
+		in   string
+		want string
+	}{
+		{name: "symlink resolved", goos: "linux", in: link, want: project},
+		{name: "redundant elements", goos: "linux", in: project + "/../MyProject/.", want: project},
+		{name: "case kept on case-sensitive hosts", goos: "linux", in: filepath.Join(root, "myproject"), want: filepath.Join(root, "myproject")},
+		{name: "case canonicalized", goos: "darwin", in: filepath.Join(root, "myproject"), want: project},
+		{name: "missing elements kept", goos: "darwin", in: filepath.Join(root, "myproject", "New"), want: filepath.Join(project, "New")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(nil, tt.goos).Canonical(tt.in)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Canonical(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentChannelType is the channel type servers open to reach a forwarded agent
+const agentChannelType = "auth-agent@openssh.com"
+
+// errKeyNotAllowed is returned when a sandbox asks the agent to use a key
+// outside the allowlist
+var errKeyNotAllowed = errors.New("agent: key not in allowlist")
+
+// errAgentReadOnly is returned for requests that would modify the host agent
+var errAgentReadOnly = errors.New("agent: forwarded agent is read-only")
+
+// filteringAgent exposes only allowlisted keys of an underlying agent.
+// Keys are matched by SHA256 fingerprint (as printed by `ssh-add -l`) or by
+// comment. Requests that modify the host agent are refused.
+type filteringAgent struct {
+	agent   agent.ExtendedAgent
+	allowed []string
+}
+
+// newFilteringAgent wraps a so only keys matching allowed are visible
+func newFilteringAgent(a agent.ExtendedAgent, allowed []string) *filteringAgent {
+	return &filteringAgent{agent: a, allowed: allowed}
+}
+
+// allows reports whether key matches an allowlist entry
+func (f *filteringAgent) allows(key ssh.PublicKey, comment string) bool {
+	fingerprint := ssh.FingerprintSHA256(key)
+	for _, entry := range f.allowed {
+		if entry == fingerprint || entry == comment {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedKey reports whether key is one of the visible keys. The comment
+// isn't part of sign requests, so the underlying list is consulted.
+func (f *filteringAgent) allowedKey(key ssh.PublicKey) (bool, error) {
+	keys, err := f.List()
+	if err != nil {
+		return false, err
+	}
+	marshaled := string(key.Marshal())
+	for _, k := range keys {
+		if string(k.Marshal()) == marshaled {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// List returns the allowlisted keys held by the underlying agent
+func (f *filteringAgent) List() ([]*agent.Key, error) {
+	keys, err := f.agent.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var visible []*agent.Key
+	for _, key := range keys {
+		if f.allows(key, key.Comment) {
+			visible = append(visible, key)
+		}
+	}
+	return visible, nil
+}
+
+// Sign signs data with an allowlisted key
+func (f *filteringAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return f.SignWithFlags(key, data, 0)
+}
+
+// SignWithFlags signs data with an allowlisted key
+func (f *filteringAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	ok, err := f.allowedKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errKeyNotAllowed
+	}
+	return f.agent.SignWithFlags(key, data, flags)
+}
+
+// Signers returns signers for the allowlisted keys
+func (f *filteringAgent) Signers() ([]ssh.Signer, error) {
+	signers, err := f.agent.Signers()
+	if err != nil {
+		return nil, err
+	}
+
+	var visible []ssh.Signer
+	for _, signer := range signers {
+		ok, err := f.allowedKey(signer.PublicKey())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			visible = append(visible, signer)
+		}
+	}
+	return visible, nil
+}
+
+// Add is refused; the sandbox must not load keys into the host agent
+func (f *filteringAgent) Add(agent.AddedKey) error {
+	return errAgentReadOnly
+}
+
+// Remove is refused; the sandbox must not remove keys from the host agent
+func (f *filteringAgent) Remove(ssh.PublicKey) error {
+	return errAgentReadOnly
+}
+
+// RemoveAll is refused; the sandbox must not remove keys from the host agent
+func (f *filteringAgent) RemoveAll() error {
+	return errAgentReadOnly
+}
+
+// Lock is refused; the sandbox must not lock the host agent
+func (f *filteringAgent) Lock([]byte) error {
+	return errAgentReadOnly
+}
+
+// Unlock is refused; the sandbox must not unlock the host agent
+func (f *filteringAgent) Unlock([]byte) error {
+	return errAgentReadOnly
+}
+
+// Extension is refused; extensions could bypass the allowlist
+func (f *filteringAgent) Extension(string, []byte) ([]byte, error) {
+	return nil, agent.ErrExtensionUnsupported
+}
+
+// agentForwarder serves forwarded agent channels for a connection. The
+// channel handler can only be registered once per connection, so each
+// session swaps in the agent it should expose.
+type agentForwarder struct {
+	mu      sync.Mutex
+	current agent.Agent
+}
+
+// set changes the agent served to new agent channels
+func (f *agentForwarder) set(a agent.Agent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.current = a
+}
+
+// get returns the agent to serve, or nil if forwarding is disabled
+func (f *agentForwarder) get() agent.Agent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.current
+}
+
+// serve accepts agent channels opened by the server
+func (f *agentForwarder) serve(channels <-chan ssh.NewChannel) {
+	for ch := range channels {
+		a := f.get()
+		if a == nil {
+			_ = ch.Reject(ssh.Prohibited, "agent forwarding not enabled")
+			continue
+		}
+
+		channel, reqs, err := ch.Accept()
+		if err != nil {
+			continue
+		}
+		go ssh.DiscardRequests(reqs)
+		go func() {
+			_ = agent.ServeAgent(a, channel)
+			_ = channel.Close()
+		}()
+	}
+}
+
+// AgentKeyCount returns how many keys the host SSH agent at SSH_AUTH_SOCK
+// holds, to check that sessions can forward it
+func AgentKeyCount() (int, error) {
+	authSock := os.Getenv("SSH_AUTH_SOCK")
+	if authSock == "" {
+		return 0, fmt.Errorf("SSH_AUTH_SOCK not set")
+	}
+
+	conn, err := net.Dial("unix", authSock)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to SSH agent: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list SSH agent keys: %w", err)
+	}
+	return len(keys), nil
+}
+
+// setupAgentForwarding forwards the host SSH agent to the session. When
+// allowedKeys is non-empty, only those keys are exposed. The returned
+// function stops forwarding and releases the agent connection.
+func (c *Client) setupAgentForwarding(session *ssh.Session, allowedKeys []string) (func(), error) {
+	// Check if SSH_AUTH_SOCK is set
+	authSock := os.Getenv("SSH_AUTH_SOCK")
+	if authSock == "" {
+		return nil, fmt.Errorf("SSH_AUTH_SOCK not set")
+	}
+
+	conn, err := net.Dial("unix", authSock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH agent: %w", err)
+	}
+
+	var forwarded agent.Agent = agent.NewClient(conn)
+	if len(allowedKeys) > 0 {
+		filtered := newFilteringAgent(agent.NewClient(conn), allowedKeys)
+		keys, err := filtered.List()
+		if err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to list SSH agent keys: %w", err)
+		}
+		if len(keys) == 0 {
+			_ = conn.Close()
+			return nil, fmt.Errorf("none of the allowed keys %v are loaded in the SSH agent", allowedKeys)
+		}
+		forwarded = filtered
+	}
+
+	if c.agentForwarder == nil {
+		channels := c.client.HandleChannelOpen(agentChannelType)
+		if channels == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("agent channel handler already registered")
+		}
+		c.agentForwarder = &agentForwarder{}
+		go c.agentForwarder.serve(channels)
+	}
+	c.agentForwarder.set(forwarded)
+
+	stop := func() {
+		c.agentForwarder.set(nil)
+		_ = conn.Close()
+	}
+
+	if err := agent.RequestAgentForwarding(session); err != nil {
+		stop()
+		return nil, fmt.Errorf("failed to request agent forwarding: %w", err)
+	}
+
+	return stop, nil
+}
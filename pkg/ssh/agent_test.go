@@ -0,0 +1,164 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// newTestKeyring returns an agent holding one generated key per comment
+func newTestKeyring(t *testing.T, comments ...string) (agent.ExtendedAgent, map[string]ssh.PublicKey) {
+	t.Helper()
+
+	keyring := agent.NewKeyring().(agent.ExtendedAgent)
+	keys := make(map[string]ssh.PublicKey)
+	for _, comment := range comments {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		if err := keyring.Add(agent.AddedKey{PrivateKey: priv, Comment: comment}); err != nil {
+			t.Fatalf("failed to add key: %v", err)
+		}
+		sshPub, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatalf("failed to convert key: %v", err)
+		}
+		keys[comment] = sshPub
+	}
+	return keyring, keys
+}
+
+func TestFilteringAgentList(t *testing.T) {
+	keyring, keys := newTestKeyring(t, "work", "personal", "deploy")
+
+	tests := []struct {
+		name    string
+		allowed []string
+		want    []string
+	}{
+		{name: "by comment", allowed: []string{"deploy"}, want: []string{"deploy"}},
+		{name: "by fingerprint", allowed: []string{ssh.FingerprintSHA256(keys["work"])}, want: []string{"work"}},
+		{name: "multiple", allowed: []string{"work", "deploy"}, want: []string{"work", "deploy"}},
+		{name: "no match", allowed: []string{"missing"}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFilteringAgent(keyring, tt.allowed)
+			listed, err := f.List()
+			if err != nil {
+				t.Fatalf("List failed: %v", err)
+			}
+
+			got := make(map[string]bool)
+			for _, key := range listed {
+				got[key.Comment] = true
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("List() returned %d keys, want %d", len(got), len(tt.want))
+			}
+			for _, comment := range tt.want {
+				if !got[comment] {
+					t.Errorf("List() missing key %q", comment)
+				}
+			}
+		})
+	}
+}
+
+func TestFilteringAgentSign(t *testing.T) {
+	keyring, keys := newTestKeyring(t, "work", "personal")
+	f := newFilteringAgent(keyring, []string{"work"})
+	data := []byte("challenge")
+
+	sig, err := f.Sign(keys["work"], data)
+	if err != nil {
+		t.Fatalf("Sign with allowed key failed: %v", err)
+	}
+	if err := keys["work"].Verify(data, sig); err != nil {
+		t.Errorf("signature doesn't verify: %v", err)
+	}
+
+	if _, err := f.Sign(keys["personal"], data); !errors.Is(err, errKeyNotAllowed) {
+		t.Errorf("Sign with disallowed key error = %v, want %v", err, errKeyNotAllowed)
+	}
+
+	signers, err := f.Signers()
+	if err != nil {
+		t.Fatalf("Signers failed: %v", err)
+	}
+	if len(signers) != 1 {
+		t.Fatalf("Signers() returned %d signers, want 1", len(signers))
+	}
+}
+
+func TestFilteringAgentReadOnly(t *testing.T) {
+	keyring, keys := newTestKeyring(t, "work")
+	f := newFilteringAgent(keyring, []string{"work"})
+
+	if err := f.RemoveAll(); !errors.Is(err, errAgentReadOnly) {
+		t.Errorf("RemoveAll() error = %v, want %v", err, errAgentReadOnly)
+	}
+	if err := f.Remove(keys["work"]); !errors.Is(err, errAgentReadOnly) {
+		t.Errorf("Remove() error = %v, want %v", err, errAgentReadOnly)
+	}
+	if err := f.Lock([]byte("pass")); !errors.Is(err, errAgentReadOnly) {
+		t.Errorf("Lock() error = %v, want %v", err, errAgentReadOnly)
+	}
+
+	listed, err := keyring.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(listed) != 1 {
+		t.Errorf("underlying agent has %d keys, want 1", len(listed))
+	}
+}
+
+func TestAgentKeyCount(t *testing.T) {
+	keyring, _ := newTestKeyring(t, "work", "personal")
+
+	// Short path: Unix socket paths are limited to about 100 bytes
+	dir, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("Unix sockets unavailable: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = agent.ServeAgent(keyring, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	t.Setenv("SSH_AUTH_SOCK", sock)
+	if n, err := AgentKeyCount(); err != nil || n != 2 {
+		t.Errorf("AgentKeyCount() = %d, %v, want 2 keys", n, err)
+	}
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	if _, err := AgentKeyCount(); err == nil || !strings.Contains(err.Error(), "not set") {
+		t.Errorf("expected an error without an agent, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package ssh
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BatchResult is what one command of a batch did
+type BatchResult struct {
+	// Output is the command's combined stdout and stderr
+	Output string
+
+	// Status is the command's exit status
+	Status int
+}
+
+// Err returns nil if the command succeeded, and an *ExitError carrying its
+// exit status otherwise
+func (r BatchResult) Err() error {
+	if r.Status == 0 {
+		return nil
+	}
+	return &ExitError{Status: r.Status}
+}
+
+// ExecBatch runs cmds in order in a single session, so a sequence of short
+// commands pays for one round-trip instead of one per command. Each command
+// runs in its own subshell, as it would in a session of its own. The batch
+// stops after the first command that fails; its result is the last one
+// returned.
+//
+// The error is only set if the batch couldn't run or didn't finish, for
+// example because the connection was lost. The results of the commands that
+// finished are returned with it.
+func (c *Client) ExecBatch(ctx context.Context, cmds []string) ([]BatchResult, error) {
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+
+	marker, err := batchMarker()
+	if err != nil {
+		return nil, err
+	}
+	output, err := c.ExecContext(ctx, batchScript(marker, cmds))
+	results, complete := parseBatchOutput(marker, output)
+	if err != nil && complete {
+		// The script exits with the status of the command that stopped it
+		err = nil
+	}
+	if err == nil && !complete {
+		err = fmt.Errorf("batch ended without reporting all results")
+	}
+	return results, err
+}
+
+// batchMarker returns a line prefix commands won't print by accident
+func batchMarker() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate batch marker: %w", err)
+	}
+	return "llima-box-batch-" + hex.EncodeToString(b), nil
+}
+
+// batchScript returns a script running cmds in subshells and printing a
+// marker line with each one's exit status after its output. It stops after
+// the first failure, printing a final marker line with "end".
+func batchScript(marker string, cmds []string) string {
+	var b strings.Builder
+	b.WriteString("exec 2>&1\n")
+	for _, cmd := range cmds {
+		fmt.Fprintf(&b, "(\n%s\n)\ns=$?; printf '\\n%s %%d\\n' $s; [ $s -eq 0 ] || { echo %s end; exit $s; }\n", cmd, marker, marker)
+	}
+	fmt.Fprintf(&b, "echo %s end\n", marker)
+	return b.String()
+}
+
+// parseBatchOutput splits the output of batchScript into results. complete
+// is false if the script didn't reach its end.
+func parseBatchOutput(marker, output string) (results []BatchResult, complete bool) {
+	rest := output
+	for {
+		i := strings.Index(rest, "\n"+marker+" ")
+		if i < 0 {
+			// A batch whose first command printed nothing starts with the
+			// end marker
+			return results, strings.HasPrefix(rest, marker+" end\n")
+		}
+		out := rest[:i]
+		line, after, _ := strings.Cut(rest[i+1+len(marker)+1:], "\n")
+		if line == "end" {
+			return results, true
+		}
+		status, err := strconv.Atoi(line)
+		if err != nil {
+			return results, false
+		}
+		results = append(results, BatchResult{Output: out, Status: status})
+		rest = after
+		if strings.HasPrefix(rest, marker+" end\n") {
+			return results, true
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package ssh
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestBatchScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	const marker = "llima-box-batch-test"
+
+	tests := []struct {
+		name         string
+		cmds         []string
+		want         []BatchResult
+		wantComplete bool
+	}{
+		{
+			name: "all succeed",
+			cmds: []string{"echo one", "true", "printf 'no newline'", "echo err >&2"},
+			want: []BatchResult{
+				{Output: "one\n"},
+				{Output: ""},
+				{Output: "no newline"},
+				{Output: "err\n"},
+			},
+			wantComplete: true,
+		},
+		{
+			name: "stops at the first failure",
+			cmds: []string{"echo before", "echo failing; exit 3", "echo never"},
+			want: []BatchResult{
+				{Output: "before\n"},
+				{Output: "failing\n", Status: 3},
+			},
+			wantComplete: true,
+		},
+		{
+			name: "commands run in subshells",
+			cmds: []string{"cd /; exit 0", "x=1 # a comment", "echo ${x:-unset}"},
+			want: []BatchResult{
+				{Output: ""},
+				{Output: ""},
+				{Output: "unset\n"},
+			},
+			wantComplete: true,
+		},
+		{
+			name:         "first command fails silently",
+			cmds:         []string{"false"},
+			want:         []BatchResult{{Status: 1}},
+			wantComplete: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, _ := exec.Command("sh", "-c", batchScript(marker, tt.cmds)).Output() // #nosec G204 -- test script
+			got, complete := parseBatchOutput(marker, string(out))
+			if complete != tt.wantComplete {
+				t.Errorf("expected complete=%v, got %v for output %q", tt.wantComplete, complete, out)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBatchOutput_Incomplete(t *testing.T) {
+	const marker = "llima-box-batch-test"
+	got, complete := parseBatchOutput(marker, "one\n\n"+marker+" 0\npartial")
+	if complete {
+		t.Error("expected a batch without an end marker to be incomplete")
+	}
+	if len(got) != 1 || got[0].Output != "one\n" {
+		t.Errorf("expected the finished command's result, got %+v", got)
+	}
+}
+
+func TestBatchResult_Err(t *testing.T) {
+	if err := (BatchResult{}).Err(); err != nil {
+		t.Errorf("expected no error for status 0, got %v", err)
+	}
+	var exitErr *ExitError
+	if err := (BatchResult{Status: 2}).Err(); !errors.As(err, &exitErr) || exitErr.Status != 2 {
+		t.Errorf("expected an *ExitError with status 2, got %v", err)
+	}
+}
@@ -1,12 +1,16 @@
 package ssh
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/middlendian/llima-box/pkg/vm"
@@ -20,17 +24,36 @@ type Client struct {
 	instance     *vm.Instance
 	sshConfig    *ssh.ClientConfig
 	client       *ssh.Client
+
+	// agentForwarder serves forwarded agent channels once registered
+	agentForwarder *agentForwarder
+
+	// progress receives warnings about problems the client works around
+	progress vm.ProgressFunc
 }
 
 // NewClient creates a new SSH client for the given Lima instance
 func NewClient(instanceName string) (*Client, error) {
+	return NewClientContext(context.Background(), instanceName)
+}
+
+// NewClientContext is NewClient with a context bounding the lookup of the
+// instance
+func NewClientContext(ctx context.Context, instanceName string) (*Client, error) {
 	if instanceName == "" {
 		return nil, fmt.Errorf("instance name cannot be empty")
 	}
+	return NewClientForVM(ctx, vm.NewManager(instanceName))
+}
 
-	// Get instance details using VM manager
-	vmManager := vm.NewManager(instanceName)
-	inst, err := vmManager.GetInstance()
+// NewClientForVM creates a new SSH client for the instance vmManager
+// manages. The instance is looked up through vmManager, so a command that
+// just checked the VM's status doesn't list the instances again. The client
+// reports its warnings to vmManager's progress function until SetProgress
+// is called.
+func NewClientForVM(ctx context.Context, vmManager *vm.Manager) (*Client, error) {
+	instanceName := vmManager.GetInstanceName()
+	inst, err := vmManager.GetInstance(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to inspect instance %s: %w", instanceName, err)
 	}
@@ -43,9 +66,29 @@ func NewClient(instanceName string) (*Client, error) {
 	return &Client{
 		instanceName: instanceName,
 		instance:     inst,
+		progress:     vmManager.Progress(),
 	}, nil
 }
 
+// SetProgress sets the function receiving the client's warnings, such as
+// SSH agent forwarding being unavailable for a session; nil discards them
+func (c *Client) SetProgress(progress vm.ProgressFunc) {
+	c.progress = progress
+}
+
+// warnf reports a problem the client worked around
+func (c *Client) warnf(format string, args ...interface{}) {
+	if c.progress != nil {
+		c.progress(vm.Event{Level: vm.EventWarning, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// UserKeyPath returns the private key Lima creates in limaHome for logging
+// in to its VMs
+func UserKeyPath(limaHome string) string {
+	return filepath.Join(limaHome, "_config", "user")
+}
+
 // Connect establishes SSH connection to the Lima VM
 func (c *Client) Connect() error {
 	if c.client != nil {
@@ -65,7 +108,7 @@ func (c *Client) Connect() error {
 		return fmt.Errorf("failed to get Lima home: %w", err)
 	}
 	keyPaths := []string{
-		filepath.Join(limaHome, "_config", "user"),
+		UserKeyPath(limaHome),
 		filepath.Join(c.instance.Dir, "ssh_key"),
 	}
 
@@ -89,11 +132,17 @@ func (c *Client) Connect() error {
 		return fmt.Errorf("no valid SSH keys found in %v", keyPaths)
 	}
 
+	// The VM's host key is trusted on first use and verified afterwards
+	knownHosts, err := KnownHostsPath()
+	if err != nil {
+		return fmt.Errorf("failed to locate known hosts file: %w", err)
+	}
+
 	// Create SSH client config
 	c.sshConfig = &ssh.ClientConfig{
 		User:            user,
 		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // #nosec G106 -- Lima VMs are trusted local VMs
+		HostKeyCallback: hostKeyCallback(knownHosts, c.instanceName),
 		Timeout:         10 * time.Second,
 	}
 
@@ -117,72 +166,46 @@ func (c *Client) Connect() error {
 // Exec executes a command on the VM and returns the output
 // This is for non-interactive commands
 func (c *Client) Exec(cmd string) (string, error) {
-	if c.client == nil {
-		if err := c.Connect(); err != nil {
-			return "", err
-		}
-	}
-
-	// Create a session
-	session, err := c.client.NewSession()
-	if err != nil {
-		return "", fmt.Errorf("failed to create session: %w", err)
-	}
-	defer func() { _ = session.Close() }()
-
-	// Run command and capture output
-	output, err := session.CombinedOutput(cmd)
-	if err != nil {
-		return string(output), fmt.Errorf("command failed: %w", err)
-	}
-
-	return string(output), nil
+	return c.ExecContext(context.Background(), cmd)
 }
 
-// ExecContext executes a command with context support
+// ExecContext executes a command and returns its combined stdout and stderr.
+// A command that exits unsuccessfully returns an *ExitError with its exit
+// status. If ctx ends first, the session is closed, which kills the command,
+// and the output it wrote until then is returned with ctx's error.
 func (c *Client) ExecContext(ctx context.Context, cmd string) (string, error) {
-	if c.client == nil {
-		if err := c.Connect(); err != nil {
-			return "", err
-		}
-	}
-
-	// Create a session
-	session, err := c.client.NewSession()
-	if err != nil {
-		return "", fmt.Errorf("failed to create session: %w", err)
-	}
-	defer func() { _ = session.Close() }()
-
-	// Create channel for command completion
-	done := make(chan error, 1)
-	var output []byte
+	var output syncBuffer
+	err := c.run(ctx, cmd, nil, &output, &output)
+	return output.String(), err
+}
 
-	go func() {
-		output, err = session.CombinedOutput(cmd)
-		done <- err
-	}()
+// ExecContextInput runs a command like ExecContext, with stdin as its
+// standard input. Data passed this way, unlike the command line, isn't
+// logged by sudo or visible to other users in the VM.
+func (c *Client) ExecContextInput(ctx context.Context, cmd string, stdin io.Reader) (string, error) {
+	var output syncBuffer
+	err := c.run(ctx, cmd, stdin, &output, &output)
+	return output.String(), err
+}
 
-	// Wait for command or context cancellation
-	select {
-	case <-ctx.Done():
-		_ = session.Signal(ssh.SIGKILL)
-		return "", ctx.Err()
-	case err := <-done:
-		if err != nil {
-			return string(output), fmt.Errorf("command failed: %w", err)
-		}
-		return string(output), nil
-	}
+// ExecContextStreaming executes a command like ExecContext, writing its
+// stdout and stderr to output as they arrive instead of collecting them
+func (c *Client) ExecContextStreaming(ctx context.Context, cmd string, output io.Writer) error {
+	return c.run(ctx, cmd, nil, output, output)
 }
 
-// ExecContextStreaming executes a command with context support and streams output to stderr
-func (c *Client) ExecContextStreaming(ctx context.Context, cmd string) error {
+// run runs cmd in a session of its own that lives as long as ctx, reading
+// stdin, if set, and writing its output to stdout and stderr. It returns once
+// the session's goroutines are done with the writers.
+func (c *Client) run(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) error {
 	if c.client == nil {
 		if err := c.Connect(); err != nil {
 			return err
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	// Create a session
 	session, err := c.client.NewSession()
@@ -191,33 +214,77 @@ func (c *Client) ExecContextStreaming(ctx context.Context, cmd string) error {
 	}
 	defer func() { _ = session.Close() }()
 
-	// Stream output directly to stderr for real-time feedback
-	session.Stdout = os.Stderr
-	session.Stderr = os.Stderr
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if err := session.Start(cmd); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
 
-	// Create channel for command completion
+	// Wait returns after the output has been copied, so waiting for it
+	// after closing the session means nothing writes to the output later
 	done := make(chan error, 1)
-
 	go func() {
-		done <- session.Run(cmd)
+		done <- session.Wait()
 	}()
 
-	// Wait for command or context cancellation
 	select {
 	case <-ctx.Done():
 		_ = session.Signal(ssh.SIGKILL)
+		_ = session.Close()
+		<-done
 		return ctx.Err()
 	case err := <-done:
-		if err != nil {
-			return fmt.Errorf("command failed: %w", err)
-		}
-		return nil
+		return exitError(err)
 	}
 }
 
+// SessionOptions configures an interactive session
+type SessionOptions struct {
+	// Clipboard, when set, receives data that remote programs copy via OSC 52
+	// escape sequences. The sequences are removed from the terminal output.
+	Clipboard ClipboardFunc
+
+	// IdleTimeout, when non-zero, closes the session after this long without
+	// input, so an unattended session (and its forwarded SSH agent) doesn't
+	// stay usable indefinitely. The session then returns ErrIdleTimeout.
+	IdleTimeout time.Duration
+
+	// AgentKeys, when non-empty, restricts the forwarded SSH agent to keys
+	// matching these SHA256 fingerprints or comments. Other identities
+	// loaded in the host agent aren't visible to the session.
+	AgentKeys []string
+
+	// Confirm, when set, delivers requests to ask the user for approval at
+	// the host terminal. While a prompt is shown, input goes to the prompt
+	// rather than the session. Without a terminal every request is denied.
+	// Reply channels should be buffered.
+	Confirm <-chan ConfirmRequest
+
+	// Stdout and Stderr, when Stdout is set, receive the command's output
+	// instead of the host's standard streams. No PTY is requested, so the
+	// two streams stay separate. A nil Stderr discards error output.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
 // ExecInteractive executes a command interactively with terminal support
 // This is for commands that need user interaction (like shells)
 func (c *Client) ExecInteractive(cmd string) error {
+	return c.ExecInteractiveWithOptions(cmd, SessionOptions{})
+}
+
+// ExecInteractiveWithOptions executes a command interactively with the given
+// session options
+func (c *Client) ExecInteractiveWithOptions(cmd string, opts SessionOptions) error {
+	return c.ExecInteractiveContext(context.Background(), cmd, opts)
+}
+
+// ExecInteractiveContext executes a command interactively with the given
+// session options. Cancelling ctx hangs up the remote command, restores the
+// terminal, and returns ctx.Err(). A command that exits unsuccessfully
+// returns an *ExitError.
+func (c *Client) ExecInteractiveContext(ctx context.Context, cmd string, opts SessionOptions) (runErr error) {
 	if c.client == nil {
 		if err := c.Connect(); err != nil {
 			return err
@@ -232,27 +299,64 @@ func (c *Client) ExecInteractive(cmd string) error {
 	defer func() { _ = session.Close() }()
 
 	// Setup SSH agent forwarding if available
-	if err := setupAgentForwarding(session); err != nil {
+	stopAgent, err := c.setupAgentForwarding(session, opts.AgentKeys)
+	if err != nil {
 		// SSH agent forwarding is optional, continue without it
-		fmt.Fprintf(os.Stderr, "Warning: SSH agent forwarding not available: %v\n", err)
+		c.warnf("SSH agent forwarding not available: %v", err)
+	} else {
+		defer stopAgent()
 	}
 
 	// Connect stdin, stdout, stderr
 	session.Stdin = os.Stdin
+	if opts.Confirm != nil {
+		var mux *inputMux
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			mux = newInputMux(os.Stdin)
+			session.Stdin = mux
+		}
+		stop := serveConfirmations(opts.Confirm, mux)
+		defer stop()
+	}
+	var idleExpired atomic.Bool
+	if opts.IdleTimeout > 0 {
+		activity := newActivityReader(session.Stdin)
+		session.Stdin = activity
+		stop := watchIdle(activity, opts.IdleTimeout, func() {
+			idleExpired.Store(true)
+			_ = session.Signal(ssh.SIGHUP)
+			_ = session.Close()
+		})
+		defer stop()
+	}
 	session.Stdout = os.Stdout
 	session.Stderr = os.Stderr
+	if opts.Clipboard != nil {
+		session.Stdout = newOSC52Filter(os.Stdout, opts.Clipboard)
+	}
+	if opts.Stdout != nil {
+		session.Stdout = opts.Stdout
+		session.Stderr = opts.Stderr
+		if session.Stderr == nil {
+			session.Stderr = io.Discard
+		}
+	}
 
 	// Get terminal size
 	fd := int(os.Stdin.Fd())
-	if term.IsTerminal(fd) {
-		// Request pseudo terminal
-		state, err := term.MakeRaw(fd)
+	if opts.Stdout == nil && term.IsTerminal(fd) {
+		// Request pseudo terminal. Unless the remote command exits on its
+		// own, it may have left the terminal in a mode of its own, which is
+		// reset along with the raw mode.
+		guard, err := guardTerminal(fd, os.Stdout)
 		if err != nil {
-			return fmt.Errorf("failed to make terminal raw: %w", err)
+			return err
 		}
-		defer func() { _ = term.Restore(fd, state) }()
+		// runErr starts out as an error so a panic counts as an abnormal end
+		runErr = errors.New("session did not finish")
+		defer func() { guard.restore(!sessionEndedCleanly(runErr)) }()
 
-		width, height, err := term.GetSize(fd)
+		width, height, err := terminalSize(fd)
 		if err != nil {
 			width, height = 80, 24 // Default size
 		}
@@ -266,16 +370,34 @@ func (c *Client) ExecInteractive(cmd string) error {
 			return fmt.Errorf("failed to request PTY: %w", err)
 		}
 
-		// Handle terminal resize
-		go handleTerminalResize(session, fd)
+		stopResize := handleTerminalResize(session, fd, width, height)
+		defer stopResize()
 	}
 
 	// Run command
-	if err := session.Run(cmd); err != nil {
-		return fmt.Errorf("command failed: %w", err)
-	}
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(cmd)
+	}()
 
-	return nil
+	select {
+	case <-ctx.Done():
+		// The deferred restore puts the terminal back once the session is
+		// torn down. As in run, waiting for the session means nothing
+		// writes to the output after this returns.
+		_ = session.Signal(ssh.SIGHUP)
+		_ = session.Close()
+		<-done
+		return ctx.Err()
+	case err := <-done:
+		if err != nil {
+			if idleExpired.Load() {
+				return ErrIdleTimeout
+			}
+			return exitError(err)
+		}
+		return nil
+	}
 }
 
 // ExecPipe executes a command and returns pipes for stdin, stdout, stderr
@@ -347,39 +469,85 @@ func (c *Client) GetInstanceName() string {
 	return c.instanceName
 }
 
-// setupAgentForwarding sets up SSH agent forwarding for the session
-func setupAgentForwarding(session *ssh.Session) error {
-	// Check if SSH_AUTH_SOCK is set
-	authSock := os.Getenv("SSH_AUTH_SOCK")
-	if authSock == "" {
-		return fmt.Errorf("SSH_AUTH_SOCK not set")
+// GetSSHConfigPath returns the path to Lima's SSH config for the instance
+func (c *Client) GetSSHConfigPath() string {
+	return filepath.Join(c.instance.Dir, "ssh.config")
+}
+
+// ExitError is returned when a remote command ran but exited unsuccessfully
+type ExitError struct {
+	// Status is the command's exit status
+	Status int
+
+	// Signal is the signal that killed the command, such as "KILL", if it
+	// was killed
+	Signal string
+
+	err *ssh.ExitError
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != "" {
+		return fmt.Sprintf("command failed: killed by signal %s", e.Signal)
 	}
+	return fmt.Sprintf("command failed: exit status %d", e.Status)
+}
 
-	// Verify the socket exists
-	if _, err := os.Stat(authSock); err != nil {
-		return fmt.Errorf("SSH agent socket not found: %w", err)
+// Unwrap returns the error from the SSH library, if there is one
+func (e *ExitError) Unwrap() error {
+	if e.err == nil {
+		return nil
 	}
+	return e.err
+}
 
-	// Request agent forwarding
-	ok, err := session.SendRequest("auth-agent-req@openssh.com", true, nil)
-	if err != nil {
-		return fmt.Errorf("failed to request agent forwarding: %w", err)
+// exitError converts the error of a finished session into an *ExitError
+// when the command reported how it exited
+func exitError(err error) error {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitError{Status: exitErr.ExitStatus(), Signal: exitErr.Signal(), err: exitErr}
 	}
-	if !ok {
-		return fmt.Errorf("agent forwarding request denied")
+	if err != nil {
+		return fmt.Errorf("command failed: %w", err)
 	}
-
 	return nil
 }
 
-// handleTerminalResize monitors terminal size changes and updates the remote PTY
-func handleTerminalResize(_ *ssh.Session, _ int) {
-	// This is a simplified version - a full implementation would use SIGWINCH
-	// For now, we'll just set the initial size
-	// A production version would listen for terminal resize signals
+// syncBuffer is a bytes.Buffer that stdout and stderr can be copied into
+// at the same time
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
 }
 
-// GetSSHConfigPath returns the path to Lima's SSH config for the instance
-func (c *Client) GetSSHConfigPath() string {
-	return filepath.Join(c.instance.Dir, "ssh.config")
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// ExitStatus returns the remote exit status carried by an error returned from
+// command execution: 0 for nil, the remote status for a command that exited
+// unsuccessfully, and -1 if the command didn't report one (e.g. the
+// connection was lost).
+func ExitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Status
+	}
+	var sshErr *ssh.ExitError
+	if errors.As(err, &sshErr) {
+		return sshErr.ExitStatus()
+	}
+	return -1
 }
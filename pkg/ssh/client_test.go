@@ -2,9 +2,12 @@ package ssh
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"testing"
 	"time"
+
+	"golang.org/x/crypto/ssh"
 )
 
 // TestNewClient tests client creation
@@ -256,3 +259,25 @@ func TestGetUser(t *testing.T) {
 	}
 	t.Logf("SSH user: %s", user)
 }
+
+// TestExitStatus tests exit status extraction from errors
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil", err: nil, want: 0},
+		{name: "other error", err: fmt.Errorf("connection lost"), want: -1},
+		{name: "wrapped exit error", err: fmt.Errorf("command failed: %w", &ssh.ExitError{Waitmsg: ssh.Waitmsg{}}), want: 0},
+		{name: "exit error", err: fmt.Errorf("failed to run: %w", &ExitError{Status: 2}), want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitStatus(tt.err); got != tt.want {
+				t.Errorf("ExitStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
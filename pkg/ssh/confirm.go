@@ -0,0 +1,156 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ConfirmRequest asks the user at the host terminal to approve an action
+// while an interactive session is running
+type ConfirmRequest struct {
+	// Prompt is the question shown to the user
+	Prompt string
+
+	// Reply receives the user's answer
+	Reply chan<- bool
+}
+
+// inputMux owns the terminal input of an interactive session. Input normally
+// flows to the session; while a confirmation prompt is shown it goes to the
+// prompt instead, so the remote side can't answer its own prompt.
+type inputMux struct {
+	mu      sync.Mutex
+	prompt  *activePrompt
+	session chan []byte
+	done    chan struct{}
+	pending []byte
+	err     error
+}
+
+// activePrompt receives input while a confirmation prompt is shown
+type activePrompt struct {
+	keys   chan []byte
+	closed chan struct{}
+}
+
+// newInputMux starts reading r. Reading stops when r returns an error.
+func newInputMux(r io.Reader) *inputMux {
+	m := &inputMux{session: make(chan []byte), done: make(chan struct{})}
+	chunks := make(chan []byte)
+
+	go func() {
+		defer close(chunks)
+		for {
+			buf := make([]byte, 256)
+			n, err := r.Read(buf)
+			if n > 0 {
+				chunks <- buf[:n]
+			}
+			if err != nil {
+				m.mu.Lock()
+				m.err = err
+				m.mu.Unlock()
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer close(m.done)
+		defer close(m.session)
+		for chunk := range chunks {
+			m.mu.Lock()
+			prompt := m.prompt
+			m.mu.Unlock()
+
+			if prompt != nil {
+				select {
+				case prompt.keys <- chunk:
+					continue
+				case <-prompt.closed:
+					// Answered in the meantime; the input belongs to the session
+				}
+			}
+			m.session <- chunk
+		}
+	}()
+
+	return m
+}
+
+// Read implements io.Reader for the session's stdin
+func (m *inputMux) Read(p []byte) (int, error) {
+	if len(m.pending) == 0 {
+		chunk, ok := <-m.session
+		if !ok {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			return 0, m.err
+		}
+		m.pending = chunk
+	}
+
+	n := copy(p, m.pending)
+	m.pending = m.pending[n:]
+	return n, nil
+}
+
+// confirm shows prompt on w and waits for a y/n key press. The terminal is in
+// raw mode, so lines end with \r\n. Enter, n, Ctrl-C, and Ctrl-D answer no;
+// other keys are ignored.
+func (m *inputMux) confirm(w io.Writer, prompt string) bool {
+	p := &activePrompt{keys: make(chan []byte), closed: make(chan struct{})}
+	m.mu.Lock()
+	m.prompt = p
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.prompt = nil
+		m.mu.Unlock()
+		close(p.closed)
+	}()
+
+	_, _ = fmt.Fprintf(w, "\r\n\033[33mCONFIRM\033[0m: %s [y/N] ", prompt)
+	for {
+		select {
+		case <-m.done:
+			_, _ = fmt.Fprint(w, "no\r\n")
+			return false
+		case chunk := <-p.keys:
+			for _, key := range chunk {
+				switch key {
+				case 'y', 'Y':
+					_, _ = fmt.Fprint(w, "yes\r\n")
+					return true
+				case 'n', 'N', '\r', '\n', 3, 4:
+					_, _ = fmt.Fprint(w, "no\r\n")
+					return false
+				}
+			}
+		}
+	}
+}
+
+// serveConfirmations answers requests until the returned function is called.
+// With no terminal input (mux is nil) every request is denied.
+func serveConfirmations(requests <-chan ConfirmRequest, mux *inputMux) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case req := <-requests:
+				if mux == nil {
+					_, _ = fmt.Fprintf(os.Stderr, "Denied without a terminal to confirm: %s\n", req.Prompt)
+					req.Reply <- false
+					continue
+				}
+				req.Reply <- mux.confirm(os.Stderr, req.Prompt)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,97 @@
+package ssh
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// readN reads exactly n bytes from r or fails the test after a timeout
+func readN(t *testing.T, r io.Reader, n int) string {
+	t.Helper()
+
+	result := make(chan string, 1)
+	go func() {
+		buf := make([]byte, n)
+		_, _ = io.ReadFull(r, buf)
+		result <- string(buf)
+	}()
+
+	select {
+	case s := <-result:
+		return s
+	case <-time.After(time.Second):
+		t.Fatal("timed out reading session input")
+		return ""
+	}
+}
+
+func TestInputMux(t *testing.T) {
+	pr, pw := io.Pipe()
+	m := newInputMux(pr)
+
+	go func() { _, _ = pw.Write([]byte("ls\r")) }()
+	if got := readN(t, m, 3); got != "ls\r" {
+		t.Fatalf("session input = %q, want %q", got, "ls\r")
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{name: "yes", input: "y", want: true},
+		{name: "no", input: "n", want: false},
+		{name: "enter", input: "\r", want: false},
+		{name: "ignores other keys", input: "xY", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			answer := make(chan bool, 1)
+			go func() { answer <- m.confirm(&out, "allow?") }()
+
+			// Wait for the prompt to take over input
+			for {
+				m.mu.Lock()
+				active := m.prompt != nil
+				m.mu.Unlock()
+				if active {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			_, _ = pw.Write([]byte(tt.input))
+			select {
+			case got := <-answer:
+				if got != tt.want {
+					t.Errorf("confirm() = %v, want %v", got, tt.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("timed out waiting for answer")
+			}
+		})
+	}
+
+	// Input goes back to the session after prompting
+	go func() { _, _ = pw.Write([]byte("pwd")) }()
+	if got := readN(t, m, 3); got != "pwd" {
+		t.Errorf("session input after prompt = %q, want %q", got, "pwd")
+	}
+
+	// Input ending answers an open prompt with no
+	answer := make(chan bool, 1)
+	go func() { answer <- m.confirm(io.Discard, "allow?") }()
+	_ = pw.Close()
+	select {
+	case got := <-answer:
+		if got {
+			t.Error("confirm() = true after input ended, want false")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for answer after input ended")
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// enableVirtualTerminal makes out interpret the escape sequences remote
+// programs write. Unix terminals always do.
+func enableVirtualTerminal(*os.File) (restore func()) {
+	return func() {}
+}
+
+// resetTerminalSettings restores the line discipline of the terminal on
+// standard input
+func resetTerminalSettings() error {
+	cmd := exec.Command("stty", "sane")
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to reset terminal settings: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+//go:build windows
+
+package ssh
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// enableVirtualTerminal makes the console on out interpret the escape
+// sequences remote programs write, which Windows consoles only do when asked.
+// Consoles too old to support it are left as they are: the session still
+// works, with escape sequences shown as text.
+func enableVirtualTerminal(out *os.File) (restore func()) {
+	h := windows.Handle(out.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(h, &mode); err != nil {
+		return func() {}
+	}
+	if err := windows.SetConsoleMode(h, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING|windows.DISABLE_NEWLINE_AUTO_RETURN); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: console doesn't support terminal escape sequences; output may look garbled\n")
+		return func() {}
+	}
+	return func() { _ = windows.SetConsoleMode(h, mode) }
+}
+
+// resetTerminalSettings puts the console on standard input back in line
+// mode with echo, as cmd.exe and PowerShell expect it
+func resetTerminalSettings() error {
+	mode := uint32(windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT | windows.ENABLE_ECHO_INPUT |
+		windows.ENABLE_INSERT_MODE | windows.ENABLE_QUICK_EDIT_MODE | windows.ENABLE_EXTENDED_FLAGS)
+	if err := windows.SetConsoleMode(windows.Handle(os.Stdin.Fd()), mode); err != nil {
+		return fmt.Errorf("failed to reset terminal settings: %w", err)
+	}
+	return nil
+}
@@ -34,6 +34,13 @@
 //		log.Fatal(err)
 //	}
 //
+// When standard input is a terminal, it's in raw mode for the session and is
+// restored however the session ends, including on SIGTERM or SIGHUP. If the
+// remote command didn't exit on its own (the connection dropped, the context
+// was cancelled), modes it may have left on, such as the alternate screen or
+// mouse reporting, are reset as well. ResetTerminal recovers a terminal left
+// raw by a process that was killed outright.
+//
 // # SSH Agent Forwarding
 //
 // SSH agent forwarding is automatically enabled when:
@@ -44,6 +51,32 @@
 // This allows Git operations and other SSH-based tools to work
 // seamlessly inside the VM using your host's SSH keys.
 //
+// Set SessionOptions.AgentKeys to expose only selected keys, matched by
+// SHA256 fingerprint or comment. The forwarded agent is then read-only, so
+// a sandbox can push to one repository without using every identity loaded
+// on the host.
+//
+// # Port Forwarding
+//
+// ForwardLocalPort makes a port in the VM reachable on the host, and
+// ForwardRemotePort a host port reachable in the VM. Both relay connections
+// over the SSH connection until the context is cancelled:
+//
+//	fwd, err := client.ForwardLocalPort(ctx, "127.0.0.1:3000", "localhost:3000")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer fwd.Close()
+//
+// # File Transfer
+//
+// Upload and Download copy files and, with TransferOptions.Recursive,
+// directories over SFTP. TransferOptions.Server runs a command as the SFTP
+// server instead of the sftp subsystem, for example to transfer files as
+// another user:
+//
+//	err := client.Upload(ctx, "./data", "/tmp/data", ssh.TransferOptions{Recursive: true})
+//
 // # Connection Management
 //
 // The client automatically connects on first command execution.
@@ -64,4 +97,17 @@
 // All methods return descriptive errors. Connection failures,
 // command execution errors, and SSH configuration issues are
 // properly wrapped with context.
+//
+// A command that ran but exited unsuccessfully returns an *ExitError with
+// its exit status:
+//
+//	output, err := client.ExecContext(ctx, "make test")
+//	var exitErr *ssh.ExitError
+//	if errors.As(err, &exitErr) {
+//		fmt.Printf("tests failed with status %d:\n%s", exitErr.Status, output)
+//	}
+//
+// When the context ends first, the command's session is closed and
+// ExecContext returns the output written until then with the context's
+// error.
 package ssh
@@ -0,0 +1,157 @@
+package ssh_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/middlendian/llima-box/pkg/vm"
+	"github.com/middlendian/llima-box/testing/limafake"
+)
+
+func TestMain(m *testing.M) {
+	limafake.Main()
+	os.Exit(m.Run())
+}
+
+// connect returns a client connected to a fake VM
+func connect(t *testing.T) (*limafake.Harness, *ssh.Client) {
+	t.Helper()
+	h := limafake.New(t)
+	h.CreateInstance("llima-box", true)
+	client, err := ssh.NewClient("llima-box")
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return h, client
+}
+
+func TestExecContext_ExitError(t *testing.T) {
+	h, client := connect(t)
+	h.Server.Handle(`^fail$`, func(cmd *limafake.Command) int {
+		_, _ = fmt.Fprint(cmd.Stdout, "out ")
+		_, _ = fmt.Fprint(cmd.Stderr, "err")
+		return 3
+	})
+
+	output, err := client.ExecContext(context.Background(), "fail")
+	var exitErr *ssh.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Status != 3 {
+		t.Fatalf("expected *ExitError with status 3, got %v", err)
+	}
+	if ssh.ExitStatus(err) != 3 {
+		t.Errorf("ExitStatus() = %d, want 3", ssh.ExitStatus(err))
+	}
+	if !strings.Contains(output, "out ") || !strings.Contains(output, "err") {
+		t.Errorf("expected stdout and stderr in the output, got %q", output)
+	}
+
+	if output, err := client.ExecContext(context.Background(), "true"); err != nil || output != "" {
+		t.Errorf("expected success without output, got %q, %v", output, err)
+	}
+}
+
+func TestExecContext_Cancel(t *testing.T) {
+	h, client := connect(t)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	h.Server.Handle(`^slow$`, func(cmd *limafake.Command) int {
+		_, _ = fmt.Fprint(cmd.Stdout, "partial")
+		<-release
+		return 0
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	output, err := client.ExecContext(ctx, "slow")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline error, got %v", err)
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Errorf("expected ExecContext to return when the context ended, took %s", time.Since(started))
+	}
+	if output != "partial" {
+		t.Errorf("expected the output written before cancellation, got %q", output)
+	}
+
+	// The connection is still usable
+	if _, err := client.ExecContext(context.Background(), "true"); err != nil {
+		t.Errorf("expected the next command to run, got %v", err)
+	}
+}
+
+// lateWriter records writes made after it's closed
+type lateWriter struct {
+	closed atomic.Bool
+	late   atomic.Int32
+}
+
+func (w *lateWriter) Write(p []byte) (int, error) {
+	if w.closed.Load() {
+		w.late.Add(1)
+	}
+	return len(p), nil
+}
+
+func TestExecInteractiveContext_CancelWaitsForOutput(t *testing.T) {
+	h, client := connect(t)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	h.Server.Handle(`^chatty$`, func(cmd *limafake.Command) int {
+		for {
+			select {
+			case <-release:
+				return 0
+			default:
+			}
+			if _, err := fmt.Fprint(cmd.Stdout, "output\n"); err != nil {
+				return 1
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	out := &lateWriter{}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := client.ExecInteractiveContext(ctx, "chatty", ssh.SessionOptions{Stdout: out, Stderr: out})
+	out.closed.Store(true)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline error, got %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := out.late.Load(); n > 0 {
+		t.Errorf("expected no output after ExecInteractiveContext returned, got %d writes", n)
+	}
+}
+
+func TestExecInteractiveContext_AgentWarning(t *testing.T) {
+	h, client := connect(t)
+	h.Server.Handle(`^true$`, func(*limafake.Command) int { return 0 })
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	var events []vm.Event
+	client.SetProgress(func(e vm.Event) { events = append(events, e) })
+	if err := client.ExecInteractiveContext(context.Background(), "true", ssh.SessionOptions{Stdout: io.Discard}); err != nil {
+		t.Fatalf("ExecInteractiveContext failed: %v", err)
+	}
+
+	want := []vm.Event{{Level: vm.EventWarning, Message: "SSH agent forwarding not available: SSH_AUTH_SOCK not set"}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+}
@@ -0,0 +1,208 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+)
+
+// Forward is an open port forward. Connections accepted on one side are
+// relayed to an address dialed on the other until the forward is closed.
+type Forward struct {
+	listener net.Listener
+	dial     func(ctx context.Context) (net.Conn, error)
+	target   string
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+
+	done chan struct{}
+	err  error
+}
+
+// ForwardLocalPort listens on localAddr on the host and relays each
+// connection over SSH to remoteAddr, dialed from inside the VM, so a server
+// in an environment can be reached from the host. Use port 0 for any free
+// port and Addr to find it. The forward runs until ctx is cancelled or it's
+// closed.
+func (c *Client) ForwardLocalPort(ctx context.Context, localAddr, remoteAddr string) (*Forward, error) {
+	if c.client == nil {
+		if err := c.Connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := (&net.ListenConfig{}).Listen(ctx, "tcp", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", localAddr, err)
+	}
+
+	dial := func(ctx context.Context) (net.Conn, error) {
+		return c.client.DialContext(ctx, "tcp", remoteAddr)
+	}
+	return startForward(ctx, listener, dial, remoteAddr), nil
+}
+
+// ForwardRemotePort asks the VM's SSH server to listen on remoteAddr and
+// relays each connection to localAddr, dialed from the host, so a service on
+// the host can be reached from inside the VM. The forward runs until ctx is
+// cancelled, it's closed, or the connection to the VM is lost.
+func (c *Client) ForwardRemotePort(ctx context.Context, remoteAddr, localAddr string) (*Forward, error) {
+	if c.client == nil {
+		if err := c.Connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := c.client.Listen("tcp", remoteAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s in the VM: %w", remoteAddr, err)
+	}
+
+	dial := func(ctx context.Context) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "tcp", localAddr)
+	}
+	return startForward(ctx, listener, dial, localAddr), nil
+}
+
+// startForward relays connections accepted by listener to connections made
+// by dial until ctx is done or the listener fails
+func startForward(ctx context.Context, listener net.Listener, dial func(ctx context.Context) (net.Conn, error), target string) *Forward {
+	f := &Forward{
+		listener: listener,
+		dial:     dial,
+		target:   target,
+		conns:    make(map[net.Conn]struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = listener.Close()
+		case <-f.done:
+		}
+	}()
+
+	go func() {
+		var conns sync.WaitGroup
+		defer close(f.done)
+		defer conns.Wait()
+		defer f.closeConns()
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+					f.err = fmt.Errorf("failed to accept connection: %w", err)
+				}
+				return
+			}
+			if !f.track(conn) {
+				_ = conn.Close()
+				return
+			}
+
+			conns.Add(1)
+			go func() {
+				defer conns.Done()
+				f.relay(ctx, conn)
+			}()
+		}
+	}()
+
+	return f
+}
+
+// relay copies data between conn and a new connection to the target until
+// either side closes
+func (f *Forward) relay(ctx context.Context, conn net.Conn) {
+	defer f.untrack(conn)
+	defer func() { _ = conn.Close() }()
+
+	target, err := f.dial(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to connect to %s: %v\n", f.target, err)
+		return
+	}
+	if !f.track(target) {
+		_ = target.Close()
+		return
+	}
+	defer f.untrack(target)
+	defer func() { _ = target.Close() }()
+
+	// Closing both connections when either direction finishes unblocks the
+	// other copy
+	var once sync.Once
+	closeBoth := func() {
+		once.Do(func() {
+			_ = conn.Close()
+			_ = target.Close()
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(target, conn)
+		closeBoth()
+		close(done)
+	}()
+	_, _ = io.Copy(conn, target)
+	closeBoth()
+	<-done
+}
+
+// track records an open connection so it's closed with the forward. It
+// reports false once the forward is shutting down.
+func (f *Forward) track(conn net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.conns == nil {
+		return false
+	}
+	f.conns[conn] = struct{}{}
+	return true
+}
+
+func (f *Forward) untrack(conn net.Conn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conns, conn)
+}
+
+// closeConns closes every open connection and stops tracking new ones
+func (f *Forward) closeConns() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn := range f.conns {
+		_ = conn.Close()
+	}
+	f.conns = nil
+}
+
+// Addr returns the address the forward listens on
+func (f *Forward) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// Close stops accepting connections and closes the open ones
+func (f *Forward) Close() error {
+	err := f.listener.Close()
+	<-f.done
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// Wait blocks until the forward stops. It returns nil when it was closed or
+// its context cancelled, and the error otherwise.
+func (f *Forward) Wait() error {
+	<-f.done
+	return f.err
+}
@@ -0,0 +1,138 @@
+package ssh
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// echoServer accepts connections on a local port and echoes each line back
+func echoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// startTestForward forwards a free local port to target with a plain dialer
+func startTestForward(t *testing.T, ctx context.Context, target string) *Forward {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	dial := func(ctx context.Context) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "tcp", target)
+	}
+	return startForward(ctx, listener, dial, target)
+}
+
+func TestForward_Relays(t *testing.T) {
+	f := startTestForward(t, t.Context(), echoServer(t))
+	defer func() { _ = f.Close() }()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", f.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to connect to forward: %v", err)
+		}
+		if _, err := conn.Write([]byte("hello\n")); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil || line != "hello\n" {
+			t.Errorf("expected echoed line, got %q, %v", line, err)
+		}
+		_ = conn.Close()
+	}
+}
+
+func TestForward_CloseEndsConnections(t *testing.T) {
+	f := startTestForward(t, t.Context(), echoServer(t))
+
+	conn, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect to forward: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("expected the open connection to be closed")
+	}
+	if err := f.Wait(); err != nil {
+		t.Errorf("expected Wait to return nil after Close, got %v", err)
+	}
+}
+
+func TestForward_StopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	f := startTestForward(t, ctx, echoServer(t))
+	cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- f.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected nil after cancellation, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("forward didn't stop after cancellation")
+	}
+
+	if _, err := net.Dial("tcp", f.Addr().String()); err == nil {
+		t.Error("expected the listener to be closed")
+	}
+}
+
+func TestForward_UnreachableTarget(t *testing.T) {
+	// Reserve a port, then free it so nothing listens there
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	target := listener.Addr().String()
+	_ = listener.Close()
+
+	f := startTestForward(t, t.Context(), target)
+	defer func() { _ = f.Close() }()
+
+	conn, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect to forward: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("expected the connection to be closed when the target is unreachable")
+	}
+}
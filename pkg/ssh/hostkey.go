@@ -0,0 +1,130 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// ErrHostKeyChanged is returned when a VM presents a different host key than
+// the one recorded when llima-box first connected to it
+var ErrHostKeyChanged = errors.New("VM host key changed")
+
+// KnownHostsPath returns the file recording the host keys of llima-box's VMs
+// (default: ~/.config/llima-box/known_hosts)
+func KnownHostsPath() (string, error) {
+	dir, err := config.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "known_hosts"), nil
+}
+
+// hostKeyCallback returns a callback that accepts the host key recorded for
+// instanceName in the known hosts file at path, and records the key on the
+// first connection. Keys are recorded by instance name rather than address,
+// since Lima may forward SSH from a different port each time the VM starts.
+func hostKeyCallback(path, instanceName string) ssh.HostKeyCallback {
+	return func(_ string, remote net.Addr, key ssh.PublicKey) error {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return fmt.Errorf("failed to create known hosts directory: %w", err)
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600) // #nosec G304 -- llima-box's own known hosts file
+		if err != nil {
+			return fmt.Errorf("failed to open known hosts file: %w", err)
+		}
+		_ = f.Close()
+
+		check, err := knownhosts.New(path)
+		if err != nil {
+			return fmt.Errorf("failed to read known hosts file: %w", err)
+		}
+		err = check(net.JoinHostPort(instanceName, "22"), remote, key)
+
+		var keyErr *knownhosts.KeyError
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &keyErr) && len(keyErr.Want) == 0:
+			return recordHostKey(path, instanceName, key)
+		case errors.As(err, &keyErr):
+			return fmt.Errorf("%w for instance %s (recorded in %s); if the VM was recreated, run again with --trust-new-hostkey", ErrHostKeyChanged, instanceName, path)
+		default:
+			return err
+		}
+	}
+}
+
+// recordHostKey appends instanceName's key to the known hosts file at path
+func recordHostKey(path, instanceName string, key ssh.PublicKey) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600) // #nosec G304 -- llima-box's own known hosts file
+	if err != nil {
+		return fmt.Errorf("failed to open known hosts file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := fmt.Fprintln(f, knownhosts.Line([]string{instanceName}, key)); err != nil {
+		return fmt.Errorf("failed to record host key: %w", err)
+	}
+	return nil
+}
+
+// ForgetHostKey removes the host key recorded for instanceName, so the key
+// the VM presents on the next connection is trusted and recorded. It's for
+// VMs that were recreated, which get new host keys.
+func ForgetHostKey(instanceName string) error {
+	path, err := KnownHostsPath()
+	if err != nil {
+		return err
+	}
+	return forgetHostKey(path, instanceName)
+}
+
+func forgetHostKey(path, instanceName string) error {
+	data, err := os.ReadFile(path) // #nosec G304 -- llima-box's own known hosts file
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read known hosts file: %w", err)
+	}
+
+	host := knownhosts.Normalize(instanceName)
+	var kept []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && hasHost(fields[0], host) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	content := strings.Join(kept, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	if content == string(data) {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to write known hosts file: %w", err)
+	}
+	return nil
+}
+
+// hasHost reports whether the comma-separated host patterns of a known hosts
+// line include host
+func hasHost(patterns, host string) bool {
+	for _, p := range strings.Split(patterns, ",") {
+		if p == host {
+			return true
+		}
+	}
+	return false
+}
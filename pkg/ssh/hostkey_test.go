@@ -0,0 +1,75 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("failed to convert key: %v", err)
+	}
+	return key
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "llima-box", "known_hosts")
+	first, second := newHostKey(t), newHostKey(t)
+	remote := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 60022}
+	check := hostKeyCallback(path, "llima-box")
+
+	// Trusted and recorded on first use
+	if err := check("127.0.0.1:60022", remote, first); err != nil {
+		t.Fatalf("expected the first key to be trusted, got %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected the key to be recorded: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "llima-box ssh-ed25519 ") {
+		t.Errorf("expected an entry for the instance, got %q", data)
+	}
+
+	// Verified by instance, whatever port Lima forwards from
+	if err := check("127.0.0.1:60023", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 60023}, first); err != nil {
+		t.Errorf("expected the recorded key to be accepted, got %v", err)
+	}
+	if err := check("127.0.0.1:60022", remote, second); !errors.Is(err, ErrHostKeyChanged) {
+		t.Errorf("expected ErrHostKeyChanged, got %v", err)
+	}
+
+	// Other instances have their own keys
+	if err := hostKeyCallback(path, "client-a")("127.0.0.1:60022", remote, second); err != nil {
+		t.Errorf("expected another instance's first key to be trusted, got %v", err)
+	}
+
+	if err := forgetHostKey(path, "llima-box"); err != nil {
+		t.Fatalf("forgetHostKey failed: %v", err)
+	}
+	if err := check("127.0.0.1:60022", remote, second); err != nil {
+		t.Errorf("expected a new key to be trusted after forgetting, got %v", err)
+	}
+	if err := hostKeyCallback(path, "client-a")("127.0.0.1:60022", remote, second); err != nil {
+		t.Errorf("expected another instance's key to be kept, got %v", err)
+	}
+}
+
+func TestForgetHostKey_NoFile(t *testing.T) {
+	if err := forgetHostKey(filepath.Join(t.TempDir(), "known_hosts"), "llima-box"); err != nil {
+		t.Errorf("expected no error without a known hosts file, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package ssh
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrIdleTimeout is returned when an interactive session is closed because
+// it received no input for SessionOptions.IdleTimeout
+var ErrIdleTimeout = errors.New("session closed after idle timeout")
+
+// maxIdleCheckInterval caps how often the idle watcher polls
+const maxIdleCheckInterval = 5 * time.Second
+
+// activityReader wraps a reader and records when input was last received
+type activityReader struct {
+	r    io.Reader
+	last atomic.Int64
+}
+
+func newActivityReader(r io.Reader) *activityReader {
+	a := &activityReader{r: r}
+	a.last.Store(time.Now().UnixNano())
+	return a
+}
+
+// Read implements io.Reader
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.last.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// idleFor returns how long it has been since the last input
+func (a *activityReader) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, a.last.Load()))
+}
+
+// watchIdle calls onIdle once when a has seen no input for timeout.
+// The returned function stops the watcher.
+func watchIdle(a *activityReader, timeout time.Duration, onIdle func()) (stop func()) {
+	interval := timeout / 4
+	if interval > maxIdleCheckInterval {
+		interval = maxIdleCheckInterval
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if a.idleFor(now) >= timeout {
+					onIdle()
+					return
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
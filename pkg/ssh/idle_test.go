@@ -0,0 +1,55 @@
+package ssh
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActivityReader(t *testing.T) {
+	a := newActivityReader(strings.NewReader("input"))
+	a.last.Store(time.Now().Add(-time.Hour).UnixNano())
+
+	if a.idleFor(time.Now()) < time.Hour {
+		t.Fatal("expected reader to be idle for an hour")
+	}
+
+	if _, err := io.ReadAll(a); err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+
+	if a.idleFor(time.Now()) > time.Minute {
+		t.Error("expected read to reset idle time")
+	}
+}
+
+func TestWatchIdle(t *testing.T) {
+	t.Run("fires when idle", func(t *testing.T) {
+		a := newActivityReader(strings.NewReader(""))
+		fired := make(chan struct{})
+
+		stop := watchIdle(a, 20*time.Millisecond, func() { close(fired) })
+		defer stop()
+
+		select {
+		case <-fired:
+		case <-time.After(time.Second):
+			t.Fatal("idle watcher did not fire")
+		}
+	})
+
+	t.Run("stopped before timeout", func(t *testing.T) {
+		a := newActivityReader(strings.NewReader(""))
+		fired := make(chan struct{}, 1)
+
+		stop := watchIdle(a, 50*time.Millisecond, func() { fired <- struct{}{} })
+		stop()
+
+		select {
+		case <-fired:
+			t.Fatal("stopped watcher fired")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package ssh
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"sync"
+	"time"
+)
+
+// osc52Prefix starts an OSC 52 "set clipboard" sequence: ESC ] 52 ;
+var osc52Prefix = []byte("\x1b]52;")
+
+// maxOSC52Size bounds a buffered OSC 52 sequence. Anything longer is passed
+// through untouched rather than held back from the terminal.
+const maxOSC52Size = 64 << 10
+
+// osc52HoldTimeout is how long bytes that may start a sequence are held for
+// the rest of it. Programs write a sequence in one go, so after a pause the
+// bytes are passed through: a lone ESC, say, must reach the terminal.
+var osc52HoldTimeout = 50 * time.Millisecond
+
+// ClipboardFunc receives data that a remote program asked to copy
+type ClipboardFunc func(data []byte) error
+
+// osc52Filter is an io.Writer that strips OSC 52 clipboard sequences from a
+// terminal stream and hands their decoded payload to a ClipboardFunc. All
+// other bytes are passed through unchanged. Sequences split across writes
+// are reassembled, unless the rest takes longer than osc52HoldTimeout.
+type osc52Filter struct {
+	out     io.Writer
+	handler ClipboardFunc
+
+	// mu guards the fields below, which the hold timer also uses
+	mu       sync.Mutex
+	pending  []byte
+	timer    *time.Timer
+	deadline time.Time
+}
+
+func newOSC52Filter(out io.Writer, handler ClipboardFunc) *osc52Filter {
+	return &osc52Filter{out: out, handler: handler}
+}
+
+// Write implements io.Writer
+func (f *osc52Filter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.write(p)
+	f.hold()
+	return len(p), err
+}
+
+// write filters p, holding back a trailing partial sequence
+func (f *osc52Filter) write(p []byte) error {
+	f.pending = append(f.pending, p...)
+
+	for len(f.pending) > 0 {
+		start := bytes.Index(f.pending, osc52Prefix)
+		if start < 0 {
+			// Hold back a trailing partial prefix, flush the rest
+			keep := partialPrefixLen(f.pending, osc52Prefix)
+			if err := f.flush(len(f.pending) - keep); err != nil {
+				return err
+			}
+			break
+		}
+
+		if err := f.flush(start); err != nil {
+			return err
+		}
+
+		end, termLen := findOSCTerminator(f.pending[len(osc52Prefix):])
+		if end < 0 {
+			if len(f.pending) > maxOSC52Size {
+				// Not a sequence we are willing to buffer; pass it through
+				if err := f.flush(len(f.pending)); err != nil {
+					return err
+				}
+			}
+			break
+		}
+
+		payload := f.pending[len(osc52Prefix) : len(osc52Prefix)+end]
+		f.handle(payload)
+		f.pending = f.pending[len(osc52Prefix)+end+termLen:]
+	}
+
+	return nil
+}
+
+// hold passes the pending bytes through if nothing completes them within
+// osc52HoldTimeout
+func (f *osc52Filter) hold() {
+	if len(f.pending) == 0 {
+		if f.timer != nil {
+			f.timer.Stop()
+		}
+		return
+	}
+	f.deadline = time.Now().Add(osc52HoldTimeout)
+	if f.timer == nil {
+		f.timer = time.AfterFunc(osc52HoldTimeout, f.expire)
+	} else {
+		f.timer.Reset(osc52HoldTimeout)
+	}
+}
+
+// expire passes held bytes through once their hold has run out. A timer
+// that fired while a Write extended the hold does nothing.
+func (f *osc52Filter) expire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if time.Now().Before(f.deadline) {
+		return
+	}
+	_ = f.flush(len(f.pending))
+}
+
+// flush writes the first n pending bytes to the underlying writer
+func (f *osc52Filter) flush(n int) error {
+	if n <= 0 {
+		return nil
+	}
+	_, err := f.out.Write(f.pending[:n])
+	f.pending = f.pending[n:]
+	return err
+}
+
+// handle decodes an OSC 52 payload ("<selection>;<base64>") and passes it on.
+// Clipboard queries ("?") and malformed payloads are dropped.
+func (f *osc52Filter) handle(payload []byte) {
+	sep := bytes.IndexByte(payload, ';')
+	if sep < 0 {
+		return
+	}
+	encoded := payload[sep+1:]
+	if string(encoded) == "?" {
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return
+	}
+	// Errors can't be reported mid-session without corrupting the terminal
+	_ = f.handler(data)
+}
+
+// findOSCTerminator finds BEL or ST (ESC \) and returns its index and length
+func findOSCTerminator(b []byte) (index, length int) {
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == '\a':
+			return i, 1
+		case b[i] == '\x1b' && i+1 < len(b) && b[i+1] == '\\':
+			return i, 2
+		}
+	}
+	return -1, 0
+}
+
+// partialPrefixLen returns the length of the longest suffix of b that is a
+// proper prefix of prefix
+func partialPrefixLen(b, prefix []byte) int {
+	for n := len(prefix) - 1; n > 0; n-- {
+		if len(b) >= n && bytes.Equal(b[len(b)-n:], prefix[:n]) {
+			return n
+		}
+	}
+	return 0
+}
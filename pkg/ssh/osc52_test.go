@@ -0,0 +1,172 @@
+package ssh
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func osc52(data string, term string) string {
+	return "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(data)) + term
+}
+
+func TestOSC52Filter(t *testing.T) {
+	tests := []struct {
+		name       string
+		writes     []string
+		wantOut    string
+		wantCopied []string
+	}{
+		{
+			name:    "plain output",
+			writes:  []string{"hello\r\n", "\x1b[31mred\x1b[0m"},
+			wantOut: "hello\r\n\x1b[31mred\x1b[0m",
+		},
+		{
+			name:       "BEL terminated",
+			writes:     []string{"before" + osc52("copied", "\a") + "after"},
+			wantOut:    "beforeafter",
+			wantCopied: []string{"copied"},
+		},
+		{
+			name:       "ST terminated",
+			writes:     []string{osc52("copied", "\x1b\\")},
+			wantCopied: []string{"copied"},
+		},
+		{
+			name: "split across writes",
+			writes: func() []string {
+				seq := "x" + osc52("split payload", "\a") + "y"
+				return []string{seq[:3], seq[3:10], seq[10:]}
+			}(),
+			wantOut:    "xy",
+			wantCopied: []string{"split payload"},
+		},
+		{
+			name:       "multiple sequences",
+			writes:     []string{osc52("one", "\a") + "-" + osc52("two", "\a")},
+			wantOut:    "-",
+			wantCopied: []string{"one", "two"},
+		},
+		{
+			name:    "query is dropped",
+			writes:  []string{"\x1b]52;c;?\a"},
+			wantOut: "",
+		},
+		{
+			name:    "other OSC sequences pass through",
+			writes:  []string{"\x1b]0;title\a"},
+			wantOut: "\x1b]0;title\a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			var copied []string
+			f := newOSC52Filter(&out, func(data []byte) error {
+				copied = append(copied, string(data))
+				return nil
+			})
+
+			for _, w := range tt.writes {
+				n, err := f.Write([]byte(w))
+				if err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+				if n != len(w) {
+					t.Errorf("Write returned %d, want %d", n, len(w))
+				}
+			}
+
+			if out.String() != tt.wantOut {
+				t.Errorf("output = %q, want %q", out.String(), tt.wantOut)
+			}
+			if len(copied) != len(tt.wantCopied) {
+				t.Fatalf("copied %q, want %q", copied, tt.wantCopied)
+			}
+			for i := range copied {
+				if copied[i] != tt.wantCopied[i] {
+					t.Errorf("copied[%d] = %q, want %q", i, copied[i], tt.wantCopied[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOSC52Filter_HoldsPartialPrefix(t *testing.T) {
+	var out bytes.Buffer
+	f := newOSC52Filter(&out, func([]byte) error { return nil })
+
+	_, _ = f.Write([]byte("text\x1b]5"))
+	if out.String() != "text" {
+		t.Errorf("expected partial prefix held back, got %q", out.String())
+	}
+
+	_, _ = f.Write([]byte("x"))
+	if out.String() != "text\x1b]5x" {
+		t.Errorf("expected held bytes flushed, got %q", out.String())
+	}
+}
+
+// lockedBuffer is a bytes.Buffer the filter's hold timer can write to while
+// a test reads it
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestOSC52Filter_FlushesAfterPause(t *testing.T) {
+	osc52HoldTimeout = 10 * time.Millisecond
+	defer func() { osc52HoldTimeout = 50 * time.Millisecond }()
+
+	tests := []struct {
+		name  string
+		write string
+	}{
+		{name: "lone ESC", write: "vim\x1b"},
+		{name: "unterminated sequence", write: "\x1b]52;c;AAAA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out lockedBuffer
+			f := newOSC52Filter(&out, func([]byte) error { return nil })
+
+			_, _ = f.Write([]byte(tt.write))
+			deadline := time.Now().Add(5 * time.Second)
+			for out.String() != tt.write {
+				if time.Now().After(deadline) {
+					t.Fatalf("expected held bytes to be passed through after a pause, got %q", out.String())
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestOSC52Filter_SizeCap(t *testing.T) {
+	var out lockedBuffer
+	f := newOSC52Filter(&out, func([]byte) error { return nil })
+
+	seq := "\x1b]52;c;" + strings.Repeat("A", maxOSC52Size)
+	_, _ = f.Write([]byte(seq))
+	if out.String() != seq {
+		t.Errorf("expected a sequence past %d bytes to be passed through at once, got %d bytes", maxOSC52Size, len(out.String()))
+	}
+}
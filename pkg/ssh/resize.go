@@ -0,0 +1,64 @@
+package ssh
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// windowChanger is the part of an SSH session that resizes its PTY
+type windowChanger interface {
+	WindowChange(height, width int) error
+}
+
+// terminalSize returns the size of the terminal on fd. Windows consoles only
+// report their size for the output handle, so standard output is tried next.
+func terminalSize(fd int) (width, height int, err error) {
+	width, height, err = term.GetSize(fd)
+	if err != nil {
+		width, height, err = term.GetSize(int(os.Stdout.Fd()))
+	}
+	return width, height, err
+}
+
+// handleTerminalResize keeps the remote PTY's size in step with the local
+// terminal on fd, which was width by height columns and rows when the PTY
+// was requested, so full-screen programs like vim and tmux redraw for the new
+// size. The returned function stops watching.
+func handleTerminalResize(session windowChanger, fd, width, height int) (stop func()) {
+	changes, stopChanges := terminalResizes()
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		followResizes(session, func() (int, int, error) { return terminalSize(fd) }, width, height, changes, done)
+	}()
+
+	return func() {
+		stopChanges()
+		close(done)
+		<-finished
+	}
+}
+
+// followResizes sends a window change to session each time changes signals
+// that size reports something other than the last size sent, until done is
+// closed. Sizes that can't be read are skipped.
+func followResizes(session windowChanger, size func() (width, height int, err error), width, height int, changes <-chan struct{}, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-changes:
+			w, h, err := size()
+			if err != nil || (w == width && h == height) {
+				continue
+			}
+			if err := session.WindowChange(h, w); err != nil {
+				// The session ended; it no longer has a PTY to resize
+				return
+			}
+			width, height = w, h
+		}
+	}
+}
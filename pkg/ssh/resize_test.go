@@ -0,0 +1,73 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// fakeWindow records the window changes sent to a session
+type fakeWindow struct {
+	mu      sync.Mutex
+	changes []string
+	err     error
+}
+
+func (f *fakeWindow) WindowChange(height, width int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.changes = append(f.changes, fmt.Sprintf("%dx%d", width, height))
+	return f.err
+}
+
+func TestFollowResizes(t *testing.T) {
+	sizes := []struct {
+		width, height int
+		err           error
+	}{
+		{width: 80, height: 24},             // unchanged
+		{width: 120, height: 40},            // resized
+		{err: errors.New("not a terminal")}, // unreadable
+		{width: 120, height: 40},            // unchanged since the last change
+		{width: 100, height: 30},            // resized again
+	}
+
+	window := &fakeWindow{}
+	changes := make(chan struct{})
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	next := 0
+	go func() {
+		defer close(finished)
+		followResizes(window, func() (int, int, error) {
+			s := sizes[next]
+			next++
+			return s.width, s.height, s.err
+		}, 80, 24, changes, done)
+	}()
+
+	for range sizes {
+		changes <- struct{}{}
+	}
+	close(done)
+	<-finished
+
+	if want := []string{"120x40", "100x30"}; !reflect.DeepEqual(window.changes, want) {
+		t.Errorf("sent window changes %v, want %v", window.changes, want)
+	}
+}
+
+func TestFollowResizes_SessionEnded(t *testing.T) {
+	window := &fakeWindow{err: errors.New("session closed")}
+	changes := make(chan struct{}, 1)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		followResizes(window, func() (int, int, error) { return 100, 30, nil }, 80, 24, changes, make(chan struct{}))
+	}()
+
+	changes <- struct{}{}
+	<-finished
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// terminalResizes signals each time the terminal is resized, as reported by
+// SIGWINCH, until stop is called
+func terminalResizes() (changes <-chan struct{}, stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+
+	ch := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return ch, func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTerminalResizes(t *testing.T) {
+	changes, stop := terminalResizes()
+	defer stop()
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGWINCH); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected SIGWINCH to be reported")
+	}
+}
@@ -0,0 +1,37 @@
+//go:build windows
+
+package ssh
+
+import "time"
+
+// resizePollInterval is how often the console size is checked. Windows has
+// no resize signal; console input reports resizes as input events, which
+// would have to be taken from the session's standard input.
+const resizePollInterval = 250 * time.Millisecond
+
+// terminalResizes signals every resizePollInterval that the console may
+// have been resized, until stop is called
+func terminalResizes() (changes <-chan struct{}, stop func()) {
+	ticker := time.NewTicker(resizePollInterval)
+
+	ch := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return ch, func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -1,6 +1,7 @@
 package ssh
 
 import (
+	"errors"
 	"fmt"
 	"time"
 )
@@ -37,6 +38,10 @@ func (c *Client) ConnectWithRetry(config RetryConfig) error {
 		if err == nil {
 			return nil
 		}
+		// A changed host key won't change back by waiting
+		if errors.Is(err, ErrHostKeyChanged) {
+			return err
+		}
 
 		lastErr = err
 
@@ -0,0 +1,104 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// terminalResetSequence turns off modes a full-screen program may leave on
+// when its session ends abnormally: text attributes, the hidden cursor, the
+// alternate screen, mouse reporting, and bracketed paste
+const terminalResetSequence = "\033[0m\033[?25h\033[?1049l\033[?1000l\033[?1002l\033[?1003l\033[?1006l\033[?2004l"
+
+// terminalGuard puts the host terminal in raw mode for an interactive
+// session and makes sure it's restored however the session ends: normally,
+// with an error, through a panic in the session's goroutine, or when the
+// process is asked to terminate.
+type terminalGuard struct {
+	fd    int
+	out   io.Writer
+	state *term.State
+	once  sync.Once
+
+	// restoreConsole undoes enableVirtualTerminal
+	restoreConsole func()
+
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+// guardTerminal makes the terminal on fd raw until the guard is restored.
+// Output for resetting the terminal goes to out.
+func guardTerminal(fd int, out io.Writer) (*terminalGuard, error) {
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make terminal raw: %w", err)
+	}
+
+	g := &terminalGuard{
+		fd:             fd,
+		out:            out,
+		state:          state,
+		restoreConsole: enableVirtualTerminal(os.Stdout),
+		signals:        make(chan os.Signal, 1),
+		done:           make(chan struct{}),
+	}
+
+	// Whoever handles the signal may not get to restore the terminal before
+	// the process exits; restoring it here first is harmless
+	signal.Notify(g.signals, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		select {
+		case <-g.signals:
+			g.restore(true)
+		case <-g.done:
+		}
+	}()
+
+	return g, nil
+}
+
+// restore puts the terminal back in the mode it had before the guard. With
+// reset, modes the remote program may have left on are turned off too.
+// Only the first call has an effect.
+func (g *terminalGuard) restore(reset bool) {
+	g.once.Do(func() {
+		signal.Stop(g.signals)
+		close(g.done)
+		_ = term.Restore(g.fd, g.state)
+		if reset {
+			_, _ = io.WriteString(g.out, terminalResetSequence)
+		}
+		g.restoreConsole()
+	})
+}
+
+// sessionEndedCleanly reports whether an interactive session ended with an
+// exit status from the remote command, which then had the chance to leave
+// the terminal as it found it
+func sessionEndedCleanly(err error) bool {
+	return ExitStatus(err) >= 0
+}
+
+// ResetTerminal restores sane settings on the host terminal, for when a
+// process that had it in raw mode was killed before it could restore it
+func ResetTerminal() error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("standard input is not a terminal")
+	}
+
+	if err := resetTerminalSettings(); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(os.Stdout, terminalResetSequence); err != nil {
+		return fmt.Errorf("failed to reset terminal modes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSessionEndedCleanly(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "success", err: nil, want: true},
+		{name: "exit status", err: fmt.Errorf("command failed: %w", &ssh.ExitError{}), want: true},
+		{name: "connection lost", err: &ssh.ExitMissingError{}, want: false},
+		{name: "idle timeout", err: ErrIdleTimeout, want: false},
+		{name: "panic", err: errors.New("session did not finish"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sessionEndedCleanly(tt.err); got != tt.want {
+				t.Errorf("sessionEndedCleanly(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// TransferOptions configure Upload and Download
+type TransferOptions struct {
+	// Recursive copies directories and everything in them. Without it,
+	// copying a directory is an error.
+	Recursive bool
+
+	// Progress, when set, is called as data is copied
+	Progress func(TransferProgress)
+
+	// Server is a command run in the VM as the SFTP server, for example to
+	// read and write files as another user. Empty uses the SSH server's sftp
+	// subsystem.
+	Server string
+}
+
+// TransferProgress reports how far a transfer has got
+type TransferProgress struct {
+	// Path is the destination of the file being copied
+	Path string
+
+	// Bytes is the amount copied so far, of Total bytes in all files
+	Bytes int64
+	Total int64
+}
+
+// Upload copies the host file or directory localPath to remotePath in the VM.
+// If remotePath is an existing directory, the copy is made inside it, like
+// cp. Symlinks inside copied directories are recreated rather than followed.
+func (c *Client) Upload(ctx context.Context, localPath, remotePath string, opts TransferOptions) error {
+	client, closeSFTP, err := c.openSFTP(opts.Server)
+	if err != nil {
+		return err
+	}
+	defer closeSFTP()
+	return transfer(ctx, localFS{}, remoteFS{client}, localPath, remotePath, opts)
+}
+
+// Download copies the VM file or directory remotePath to localPath on the
+// host. If localPath is an existing directory, the copy is made inside it,
+// like cp. Symlinks inside copied directories are recreated rather than
+// followed.
+func (c *Client) Download(ctx context.Context, remotePath, localPath string, opts TransferOptions) error {
+	client, closeSFTP, err := c.openSFTP(opts.Server)
+	if err != nil {
+		return err
+	}
+	defer closeSFTP()
+	return transfer(ctx, remoteFS{client}, localFS{}, remotePath, localPath, opts)
+}
+
+// openSFTP starts an SFTP session, through server if it's set
+func (c *Client) openSFTP(server string) (*sftp.Client, func(), error) {
+	if c.client == nil {
+		if err := c.Connect(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if server == "" {
+		client, err := sftp.NewClient(c.client)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to start SFTP session: %w", err)
+		}
+		return client, func() { _ = client.Close() }, nil
+	}
+
+	session, err := c.client.NewSession()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		_ = session.Close()
+		return nil, nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		_ = session.Close()
+		return nil, nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	if err := session.Start(server); err != nil {
+		_ = session.Close()
+		return nil, nil, fmt.Errorf("failed to start SFTP server: %w", err)
+	}
+
+	client, err := sftp.NewClientPipe(stdout, stdin)
+	if err != nil {
+		_ = session.Close()
+		return nil, nil, fmt.Errorf("failed to start SFTP session: %w (output: %s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return client, func() {
+		_ = client.Close()
+		_ = session.Close()
+	}, nil
+}
+
+// transferFS is one side of a transfer: the host or the VM
+type transferFS interface {
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Readlink(name string) (string, error)
+	Open(name string) (io.ReadCloser, error)
+	Create(name string, perm os.FileMode) (io.WriteCloser, error)
+	Mkdir(name string, perm os.FileMode) error
+	Symlink(target, name string) error
+	Join(elem ...string) string
+	Base(name string) string
+}
+
+// transfer copies src on one side to dst on the other
+func transfer(ctx context.Context, from, to transferFS, src, dst string, opts TransferOptions) error {
+	info, err := from.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", src, err)
+	}
+	if info.IsDir() && !opts.Recursive {
+		return fmt.Errorf("%s is a directory", src)
+	}
+
+	if dstInfo, err := to.Stat(dst); err == nil && dstInfo.IsDir() {
+		dst = to.Join(dst, from.Base(src))
+	}
+
+	t := &transferrer{ctx: ctx, from: from, to: to, progress: opts.Progress}
+	if t.progress != nil {
+		if t.total, err = treeSize(from, src, info); err != nil {
+			return err
+		}
+	}
+	return t.copy(src, dst, info)
+}
+
+// treeSize returns the number of bytes in the regular files under p
+func treeSize(fsys transferFS, p string, info os.FileInfo) (int64, error) {
+	if !info.IsDir() {
+		if info.Mode().IsRegular() {
+			return info.Size(), nil
+		}
+		return 0, nil
+	}
+
+	entries, err := fsys.ReadDir(p)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	var total int64
+	for _, entry := range entries {
+		size, err := treeSize(fsys, fsys.Join(p, entry.Name()), entry)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// transferrer holds the state of one transfer
+type transferrer struct {
+	ctx      context.Context
+	from, to transferFS
+	progress func(TransferProgress)
+	total    int64
+	done     int64
+}
+
+// copy copies the file, directory, or symlink src described by info to dst
+func (t *transferrer) copy(src, dst string, info os.FileInfo) error {
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+
+	switch {
+	case info.IsDir():
+		return t.copyDir(src, dst, info)
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := t.from.Readlink(src)
+		if err != nil {
+			return fmt.Errorf("failed to read link %s: %w", src, err)
+		}
+		if err := t.to.Symlink(target, dst); err != nil {
+			return fmt.Errorf("failed to create link %s: %w", dst, err)
+		}
+		return nil
+	case info.Mode().IsRegular():
+		return t.copyFile(src, dst, info)
+	default:
+		fmt.Fprintf(os.Stderr, "Warning: skipping %s (not a regular file)\n", src)
+		return nil
+	}
+}
+
+func (t *transferrer) copyDir(src, dst string, info os.FileInfo) error {
+	if err := t.to.Mkdir(dst, info.Mode().Perm()); err != nil {
+		if existing, statErr := t.to.Stat(dst); statErr != nil || !existing.IsDir() {
+			return fmt.Errorf("failed to create directory %s: %w", dst, err)
+		}
+	}
+
+	entries, err := t.from.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", src, err)
+	}
+	for _, entry := range entries {
+		if err := t.copy(t.from.Join(src, entry.Name()), t.to.Join(dst, entry.Name()), entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *transferrer) copyFile(src, dst string, info os.FileInfo) error {
+	in, err := t.from.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := t.to.Create(dst, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+
+	_, err = io.Copy(out, &progressReader{r: in, t: t, path: dst})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return nil
+}
+
+// progressReader reports data read through it and stops when the
+// transfer's context is done
+type progressReader struct {
+	r    io.Reader
+	t    *transferrer
+	path string
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	if err := p.t.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := p.r.Read(b)
+	if n > 0 && p.t.progress != nil {
+		p.t.done += int64(n)
+		p.t.progress(TransferProgress{Path: p.path, Bytes: p.t.done, Total: p.t.total})
+	}
+	return n, err
+}
+
+// localFS is the host side of a transfer
+type localFS struct{}
+
+func (localFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+func (localFS) Readlink(name string) (string, error)  { return os.Readlink(name) }
+func (localFS) Symlink(target, name string) error     { return os.Symlink(target, name) }
+func (localFS) Mkdir(name string, perm os.FileMode) error {
+	return os.Mkdir(name, perm)
+}
+func (localFS) Join(elem ...string) string { return filepath.Join(elem...) }
+func (localFS) Base(name string) string    { return filepath.Base(name) }
+
+// ReadDir lists a directory without following symlinks, like the SFTP side
+func (localFS) ReadDir(name string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (localFS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name) // #nosec G304 -- the caller chose the file to copy
+}
+
+func (localFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm) // #nosec G304 -- the caller chose the destination
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(perm); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// remoteFS is the VM side of a transfer
+type remoteFS struct {
+	client *sftp.Client
+}
+
+func (r remoteFS) Stat(name string) (os.FileInfo, error)      { return r.client.Stat(name) }
+func (r remoteFS) ReadDir(name string) ([]os.FileInfo, error) { return r.client.ReadDir(name) }
+func (r remoteFS) Readlink(name string) (string, error)       { return r.client.ReadLink(name) }
+func (r remoteFS) Symlink(target, name string) error          { return r.client.Symlink(target, name) }
+func (r remoteFS) Mkdir(name string, perm os.FileMode) error {
+	if err := r.client.Mkdir(name); err != nil {
+		return err
+	}
+	return r.client.Chmod(name, perm)
+}
+func (remoteFS) Join(elem ...string) string { return path.Join(elem...) }
+func (remoteFS) Base(name string) string    { return path.Base(name) }
+
+func (r remoteFS) Open(name string) (io.ReadCloser, error) {
+	return r.client.Open(name)
+}
+
+func (r remoteFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	f, err := r.client.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(perm); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
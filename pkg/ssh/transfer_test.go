@@ -0,0 +1,178 @@
+package ssh
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// pipeConn joins a reader and a writer into one connection
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// newTestSFTP returns the VM side of a transfer, served from the local
+// filesystem by an in-process SFTP server
+func newTestSFTP(t *testing.T) remoteFS {
+	t.Helper()
+	serverRead, clientWrite := io.Pipe()
+	clientRead, serverWrite := io.Pipe()
+
+	server, err := sftp.NewServer(pipeConn{serverRead, serverWrite})
+	if err != nil {
+		t.Fatalf("failed to start SFTP server: %v", err)
+	}
+	go func() { _ = server.Serve() }()
+
+	client, err := sftp.NewClientPipe(clientRead, clientWrite)
+	if err != nil {
+		t.Fatalf("failed to start SFTP client: %v", err)
+	}
+	// Closing the server ends the client's connection
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = client.Close()
+	})
+	return remoteFS{client}
+}
+
+// writeTree creates files under dir from a map of relative paths to contents
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, p string) string {
+	t.Helper()
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", p, err)
+	}
+	return string(data)
+}
+
+func TestTransfer(t *testing.T) {
+	tests := []struct {
+		name      string
+		upload    bool
+		recursive bool
+		// dst is relative to the destination directory
+		dst       string
+		wantFiles map[string]string
+		wantLink  string
+		wantErr   string
+	}{
+		{
+			name:    "directory without recursive",
+			upload:  true,
+			dst:     ".",
+			wantErr: "is a directory",
+		},
+		{
+			name:      "upload a directory",
+			upload:    true,
+			recursive: true,
+			dst:       ".",
+			wantFiles: map[string]string{"src/notes.txt": "notes", "src/lib/a.go": "package a"},
+			wantLink:  "src/link",
+		},
+		{
+			name:      "upload a directory to a new name",
+			upload:    true,
+			recursive: true,
+			dst:       "copy",
+			wantFiles: map[string]string{"copy/notes.txt": "notes", "copy/lib/a.go": "package a"},
+			wantLink:  "copy/link",
+		},
+		{
+			name:      "download a directory",
+			recursive: true,
+			dst:       ".",
+			wantFiles: map[string]string{"src/notes.txt": "notes", "src/lib/a.go": "package a"},
+			wantLink:  "src/link",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir, dstDir := t.TempDir(), t.TempDir()
+			writeTree(t, srcDir, map[string]string{"src/notes.txt": "notes", "src/lib/a.go": "package a"})
+			if err := os.Symlink("notes.txt", filepath.Join(srcDir, "src", "link")); err != nil {
+				t.Fatal(err)
+			}
+
+			from, to := transferFS(newTestSFTP(t)), transferFS(localFS{})
+			if tt.upload {
+				from, to = to, from
+			}
+
+			var last TransferProgress
+			opts := TransferOptions{Recursive: tt.recursive, Progress: func(p TransferProgress) { last = p }}
+			err := transfer(t.Context(), from, to, filepath.Join(srcDir, "src"), filepath.Join(dstDir, tt.dst), opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("transfer failed: %v", err)
+			}
+
+			for name, want := range tt.wantFiles {
+				p := filepath.Join(dstDir, name)
+				if got := readFile(t, p); got != want {
+					t.Errorf("%s: got %q, want %q", name, got, want)
+				}
+				if info, err := os.Stat(p); err == nil && info.Mode().Perm() != 0640 {
+					t.Errorf("%s: expected mode 0640, got %v", name, info.Mode().Perm())
+				}
+			}
+			if target, err := os.Readlink(filepath.Join(dstDir, tt.wantLink)); err != nil || target != "notes.txt" {
+				t.Errorf("expected the symlink to be recreated, got %q, %v", target, err)
+			}
+			if last.Total != int64(len("notes")+len("package a")) || last.Bytes != last.Total {
+				t.Errorf("expected progress to reach %d bytes, got %+v", len("notes")+len("package a"), last)
+			}
+		})
+	}
+}
+
+func TestTransfer_File(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	writeTree(t, srcDir, map[string]string{"report.csv": "a,b\n"})
+	writeTree(t, dstDir, map[string]string{"old.csv": "stale"})
+
+	remote := newTestSFTP(t)
+	if err := transfer(t.Context(), localFS{}, remote, filepath.Join(srcDir, "report.csv"), dstDir, TransferOptions{}); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if got := readFile(t, filepath.Join(dstDir, "report.csv")); got != "a,b\n" {
+		t.Errorf("expected the file inside the directory, got %q", got)
+	}
+
+	// An existing file is replaced
+	if err := transfer(t.Context(), remote, localFS{}, filepath.Join(srcDir, "report.csv"), filepath.Join(dstDir, "old.csv"), TransferOptions{}); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if got := readFile(t, filepath.Join(dstDir, "old.csv")); got != "a,b\n" {
+		t.Errorf("expected the file to be replaced, got %q", got)
+	}
+
+	if err := transfer(t.Context(), remote, localFS{}, filepath.Join(srcDir, "missing"), dstDir, TransferOptions{}); err == nil {
+		t.Error("expected an error for a missing source")
+	}
+}
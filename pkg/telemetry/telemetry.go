@@ -0,0 +1,127 @@
+// Package telemetry sends opt-in, anonymous usage reports, so the
+// maintainers can see which llima-box features are used and how they fail.
+//
+// Nothing is sent unless the host configuration enables telemetry. A
+// Report holds only the command's name, the names of the flags it was given,
+// the category of the error it ended with, and the host's OS and
+// architecture. Paths, arguments, flag values, environment names, and error
+// messages are never included, and there's no user or machine identifier.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/approval"
+	"github.com/middlendian/llima-box/pkg/backup"
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/pathmap"
+)
+
+// sendTimeout bounds sending a report, which happens as a command exits
+const sendTimeout = 2 * time.Second
+
+// Report is one command run
+type Report struct {
+	// Command is the command's name, such as "shell" or "maintenance run"
+	Command string `json:"command"`
+
+	// Flags lists the names of the flags set on the command line, without
+	// their values
+	Flags []string `json:"flags,omitempty"`
+
+	// Error is the category of the error the command ended with (see
+	// Categorize), or empty if it succeeded
+	Error string `json:"error,omitempty"`
+
+	// OS and Arch describe the host
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+}
+
+// NewReport returns a report for command on this host
+func NewReport(command string, flags []string, err error) Report {
+	return Report{Command: command, Flags: flags, Error: Categorize(err), OS: runtime.GOOS, Arch: runtime.GOARCH}
+}
+
+// Error categories that aren't one of llima-box's own errors
+const (
+	// CategoryInterrupted is a command cancelled by Ctrl-C or a signal
+	CategoryInterrupted = "interrupted"
+
+	// CategoryTimeout is a command that ran out of time
+	CategoryTimeout = "timeout"
+
+	// CategoryNetwork is a failed connection, usually to the VM
+	CategoryNetwork = "network"
+
+	// CategoryOther is every other error
+	CategoryOther = "other"
+)
+
+// categories maps llima-box's errors to their categories, checked in order
+var categories = []struct {
+	target error
+	name   string
+}{
+	{context.Canceled, CategoryInterrupted},
+	{context.DeadlineExceeded, CategoryTimeout},
+	{env.ErrUnsafeProjectPath, "unsafe-project-path"},
+	{env.ErrSessionTimeLimit, "session-time-limit"},
+	{env.ErrDailyBudgetUsed, "daily-budget-used"},
+	{pathmap.ErrNotShared, "path-not-shared"},
+	{approval.ErrDenied, "not-approved"},
+	{backup.ErrNotFound, "backup-not-found"},
+}
+
+// Categorize returns the category of err: a fixed name that says what kind
+// of failure it was without any of its details. nil has no category.
+func Categorize(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, c := range categories {
+		if errors.Is(err, c.target) {
+			return c.name
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return CategoryNetwork
+	}
+	return CategoryOther
+}
+
+// Send posts r to endpoint as JSON. It gives up after a couple of seconds,
+// so an unreachable endpoint doesn't hold up the command.
+func Send(ctx context.Context, endpoint string, r Report) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	body, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send report: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to send report: %s", resp.Status)
+	}
+	return nil
+}
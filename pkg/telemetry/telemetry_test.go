@@ -0,0 +1,72 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/env"
+	"github.com/middlendian/llima-box/pkg/pathmap"
+)
+
+func TestCategorize(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "success", err: nil, want: ""},
+		{name: "interrupted", err: fmt.Errorf("failed to run command: %w", context.Canceled), want: CategoryInterrupted},
+		{name: "timeout", err: context.DeadlineExceeded, want: CategoryTimeout},
+		{name: "unsafe path", err: fmt.Errorf("%w: /Users/alice/.ssh", env.ErrUnsafeProjectPath), want: "unsafe-project-path"},
+		{name: "not shared", err: fmt.Errorf("%w (shared directories: /Users/alice)", pathmap.ErrNotShared), want: "path-not-shared"},
+		{name: "network", err: fmt.Errorf("failed to connect SSH: %w", &net.OpError{Op: "dial", Err: errors.New("refused")}), want: CategoryNetwork},
+		{name: "other", err: errors.New("environment app-a1b2 does not exist"), want: CategoryOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Categorize(tt.err); got != tt.want {
+				t.Errorf("Categorize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	var got Report
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode report: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	r := NewReport("shell", []string{"cpus"}, env.ErrSessionTimeLimit)
+	if err := Send(context.Background(), server.URL, r); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, r) {
+		t.Errorf("server received %+v, want %+v", got, r)
+	}
+}
+
+func TestSend_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	if err := Send(context.Background(), server.URL, NewReport("list", nil, nil)); err == nil {
+		t.Error("expected an error for a 503 response")
+	}
+}
@@ -1,11 +1,199 @@
 package vm
 
-import _ "embed"
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
 
 //go:embed lima.yaml
 var embeddedConfig string
 
+// BaseImage is the container image matching the VM's operating system
+const BaseImage = "ubuntu:24.04"
+
+// BasePackages lists the apt packages installed when provisioning the VM.
+// It must match the apt-get install line in lima.yaml.
+var BasePackages = []string{"build-essential", "curl", "git", "acl", "nftables"}
+
+const (
+	// FirewallTable is the nftables table holding the VM's firewall profile
+	FirewallTable = "llima-box"
+
+	// FirewallEnvChain is the chain in FirewallTable that outbound traffic
+	// passes through before the default accept; per-environment rules go here
+	FirewallEnvChain = "env-output"
+
+	// FirewallOutputChain is the chain in FirewallTable filtering all
+	// outbound traffic, ahead of the rule accepting established connections
+	FirewallOutputChain = "output"
+
+	// FirewallRulesDir holds *.nft files loaded with the firewall profile at
+	// boot, for per-environment rules that must survive VM restarts
+	FirewallRulesDir = "/etc/llima-box/nftables.d"
+)
+
+const (
+	// HelperPath is the in-VM helper creating and deleting environment
+	// users. It refuses to touch system accounts and the VM user, and logs
+	// every call. lima.yaml installs a shell script there, which llima-box
+	// replaces with the llima-box-helper binary (see pkg/helper).
+	HelperPath = "/usr/local/sbin/llima-box-helper"
+
+	// EnvGroup is the group of environment users; sudo refuses its members
+	EnvGroup = "llima-box-env"
+)
+
 // GetEmbeddedConfig returns the embedded Lima configuration YAML
 func GetEmbeddedConfig() (string, error) {
 	return embeddedConfig, nil
 }
+
+// Settings override parts of the embedded Lima configuration. Zero values
+// keep the embedded defaults.
+type Settings struct {
+	// CPUs is the number of virtual CPUs
+	CPUs int
+
+	// Memory and Disk are sizes in Lima's notation, e.g. "8GiB"
+	Memory string
+	Disk   string
+
+	// MountType is Lima's mount driver: "reverse-sshfs", "9p", or "virtiofs"
+	MountType string
+
+	// Mounts replaces the host directories mounted into the VM
+	Mounts []Mount
+
+	// Instance is the Lima instance the configuration is for. Instances
+	// other than DefaultInstanceName get their own data disk and an SSH port
+	// picked by Lima, so they can run side by side.
+	Instance string
+}
+
+// Mount is a host directory mounted into the VM
+type Mount struct {
+	// Location is the host directory; "~" is the user's home directory
+	Location string `yaml:"location"`
+
+	// MountPoint is where it appears in the VM (default: the same path)
+	MountPoint string `yaml:"mountPoint,omitempty"`
+
+	// Writable lets the VM write to the directory
+	Writable bool `yaml:"writable"`
+}
+
+// RenderConfig returns the embedded Lima configuration with s applied.
+// Comments and the provisioning scripts are kept.
+func RenderConfig(s Settings) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(embeddedConfig), &doc); err != nil {
+		return "", fmt.Errorf("failed to parse embedded configuration: %w", err)
+	}
+	root := doc.Content[0]
+
+	if s.CPUs != 0 {
+		if err := setKey(root, "cpus", s.CPUs); err != nil {
+			return "", err
+		}
+	}
+	for key, value := range map[string]string{"memory": s.Memory, "disk": s.Disk, "mountType": s.MountType} {
+		if value == "" {
+			continue
+		}
+		if err := setKey(root, key, value); err != nil {
+			return "", err
+		}
+	}
+	if len(s.Mounts) > 0 {
+		if err := setKey(root, "mounts", s.Mounts); err != nil {
+			return "", err
+		}
+	}
+	if s.Instance != "" && s.Instance != DefaultInstanceName {
+		if err := separateInstance(root, s.Instance); err != nil {
+			return "", err
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return "", fmt.Errorf("failed to render configuration: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("failed to render configuration: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// setKey sets key in the mapping node to value, adding the key if it isn't
+// there yet
+func setKey(mapping *yaml.Node, key string, value any) error {
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			// Keep the comments attached to the old value
+			node.HeadComment = mapping.Content[i+1].HeadComment
+			node.LineComment = mapping.Content[i+1].LineComment
+			mapping.Content[i+1] = &node
+			return nil
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &node)
+	return nil
+}
+
+// separateInstance changes the configuration so the instance doesn't share
+// the default instance's data disk or SSH port. The data disk is linked to
+// DataDiskMountPoint at boot, so paths in the VM are the same in every
+// instance.
+func separateInstance(root *yaml.Node, instanceName string) error {
+	disk := dataDiskFor(instanceName)
+	if disks := mappingValue(root, "additionalDisks"); disks != nil {
+		for _, d := range disks.Content {
+			if name := mappingValue(d, "name"); name != nil && name.Value == DataDiskName {
+				name.Value = disk
+			}
+		}
+	}
+
+	ssh := mappingValue(root, "ssh")
+	if ssh == nil {
+		return fmt.Errorf("embedded configuration has no ssh section")
+	}
+	if err := setKey(ssh, "localPort", 0); err != nil {
+		return err
+	}
+
+	provision := mappingValue(root, "provision")
+	if provision == nil {
+		return fmt.Errorf("embedded configuration has no provision section")
+	}
+	var link yaml.Node
+	script := fmt.Sprintf("#!/bin/bash\nset -eux -o pipefail\n\nln -sfn /mnt/lima-%s %s\n", disk, DataDiskMountPoint)
+	if err := link.Encode(map[string]string{"mode": "system", "script": script}); err != nil {
+		return fmt.Errorf("failed to encode provision: %w", err)
+	}
+	provision.Content = append([]*yaml.Node{&link}, provision.Content...)
+	return nil
+}
+
+// mappingValue returns the value of key in the mapping node, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CopyToVM copies a host file (or directory, with recursive) into the VM
+// using `limactl copy`. It works without llima-box's own SSH client, so it
+// can stage files before that client is able to connect, e.g. during first
+// provisioning. Copied files are owned by the VM's default user; use sudo
+// inside the VM to move them into protected locations.
+func (m *Manager) CopyToVM(ctx context.Context, hostPath, vmPath string, recursive bool) error {
+	src, err := copyHostPath(hostPath)
+	if err != nil {
+		return err
+	}
+	dst, err := m.copyVMPath(vmPath)
+	if err != nil {
+		return err
+	}
+	if err := m.copy(ctx, src, dst, recursive); err != nil {
+		return fmt.Errorf("failed to copy %s to VM: %w", hostPath, err)
+	}
+	return nil
+}
+
+// CopyFromVM copies a file (or directory, with recursive) from the VM to the
+// host using `limactl copy`
+func (m *Manager) CopyFromVM(ctx context.Context, vmPath, hostPath string, recursive bool) error {
+	src, err := m.copyVMPath(vmPath)
+	if err != nil {
+		return err
+	}
+	dst, err := copyHostPath(hostPath)
+	if err != nil {
+		return err
+	}
+	if err := m.copy(ctx, src, dst, recursive); err != nil {
+		return fmt.Errorf("failed to copy %s from VM: %w", vmPath, err)
+	}
+	return nil
+}
+
+// copy runs limactl copy once the VM is known to be running
+func (m *Manager) copy(ctx context.Context, src, dst string, recursive bool) error {
+	running, err := m.IsRunning(ctx)
+	if err != nil {
+		return err
+	}
+	if !running {
+		return fmt.Errorf("instance %s is not running", m.instanceName)
+	}
+
+	args := []string{"copy"}
+	if recursive {
+		args = append(args, "--recursive")
+	}
+	args = append(args, src, dst)
+
+	_, err = m.execLimactl(ctx, 0, args...)
+	return err
+}
+
+// copyVMPath returns the limactl copy argument for an absolute VM path.
+// Relative paths would resolve against the VM user's home directory, which
+// isn't what callers of this package expect.
+func (m *Manager) copyVMPath(vmPath string) (string, error) {
+	if !path.IsAbs(vmPath) {
+		return "", fmt.Errorf("VM path must be absolute: %s", vmPath)
+	}
+	return m.instanceName + ":" + vmPath, nil
+}
+
+// copyHostPath returns the limactl copy argument for a host path. limactl
+// treats anything before a colon as an instance name, so host paths with a
+// colon can't be copied.
+func copyHostPath(hostPath string) (string, error) {
+	abs, err := filepath.Abs(hostPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	if strings.Contains(abs, ":") {
+		return "", fmt.Errorf("host path contains a colon, which limactl copy can't handle: %s", abs)
+	}
+	return abs, nil
+}
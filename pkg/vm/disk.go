@@ -0,0 +1,99 @@
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// DataDiskName is the name of the Lima disk holding environment home
+	// directories in the default instance. It must match the additionalDisks
+	// entry in lima.yaml.
+	DataDiskName = "llima-box-data"
+
+	// DataDiskSize is the size used when creating the data disk
+	DataDiskSize = "50GiB"
+
+	// DataDiskMountPoint is where Lima mounts the data disk inside the VM.
+	// Other instances' data disks are linked here.
+	DataDiskMountPoint = "/mnt/lima-" + DataDiskName
+)
+
+// dataDiskFor returns the data disk of instanceName. Lima disks aren't
+// per instance, so instances other than the default one add their name.
+func dataDiskFor(instanceName string) string {
+	if instanceName == "" || instanceName == DefaultInstanceName {
+		return DataDiskName
+	}
+	return DataDiskName + "-" + instanceName
+}
+
+// Disk represents a Lima additional disk
+type Disk struct {
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	Dir        string `json:"dir"`
+	Instance   string `json:"instance"`
+	MountPoint string `json:"mountPoint"`
+}
+
+// listDisks lists all Lima additional disks
+func (m *Manager) listDisks(ctx context.Context) ([]Disk, error) {
+	output, err := m.execLimactl(ctx, m.timeouts.query(), "disk", "list", "--json")
+	if err != nil {
+		return nil, err
+	}
+
+	// Like `limactl list --json`, disk list outputs JSON Lines
+	var disks []Disk
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var disk Disk
+		if err := json.Unmarshal([]byte(line), &disk); err != nil {
+			return nil, fmt.Errorf("failed to parse limactl disk list output line: %w", err)
+		}
+		disks = append(disks, disk)
+	}
+
+	return disks, nil
+}
+
+// GetDataDisk returns the data disk details, or nil if it doesn't exist
+func (m *Manager) GetDataDisk(ctx context.Context) (*Disk, error) {
+	disks, err := m.listDisks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list disks: %w", err)
+	}
+
+	for _, disk := range disks {
+		if disk.Name == dataDiskFor(m.instanceName) {
+			return &disk, nil
+		}
+	}
+	return nil, nil
+}
+
+// EnsureDataDisk creates the data disk if it doesn't exist yet.
+// An existing disk is reused as-is so environment homes survive VM recreation.
+func (m *Manager) EnsureDataDisk(ctx context.Context) error {
+	disk, err := m.GetDataDisk(ctx)
+	if err != nil {
+		return err
+	}
+	if disk != nil {
+		return nil
+	}
+
+	_, err = m.execLimactl(ctx, m.timeouts.lifecycle(), "disk", "create", dataDiskFor(m.instanceName), "--size="+DataDiskSize)
+	if err != nil {
+		return fmt.Errorf("failed to create data disk: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package vm
+
+import (
+	"fmt"
+	"os"
+)
+
+// EventLevel is how much an Event matters to the user
+type EventLevel string
+
+const (
+	// EventDebug reports a limactl command being run and its output
+	EventDebug EventLevel = "debug"
+
+	// EventInfo reports a slow step, such as creating or starting the VM
+	EventInfo EventLevel = "info"
+
+	// EventWarning reports a problem the manager worked around
+	EventWarning EventLevel = "warning"
+)
+
+// Event is a progress report from a Manager operation
+type Event struct {
+	Level EventLevel
+
+	// Message is the report for the user. It may include limactl's output,
+	// so displays should escape control characters.
+	Message string
+}
+
+// ProgressFunc receives a Manager's events as they happen (see
+// Manager.SetProgress). It's called from the goroutine running the
+// operation, so it should return quickly.
+type ProgressFunc func(Event)
+
+// StderrProgress writes events to stderr, debug events in gray. It's the
+// default for new managers.
+func StderrProgress(e Event) {
+	switch e.Level {
+	case EventWarning:
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", e.Message)
+	case EventInfo:
+		fmt.Fprintln(os.Stderr, e.Message)
+	default:
+		fmt.Fprintf(os.Stderr, "\033[90mDEBUG\033[0m: %s\n", e.Message)
+	}
+}
+
+// emit calls p with e, unless p is nil
+func (p ProgressFunc) emit(level EventLevel, format string, args ...interface{}) {
+	if p != nil {
+		p(Event{Level: level, Message: fmt.Sprintf(format, args...)})
+	}
+}
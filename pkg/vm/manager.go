@@ -5,25 +5,73 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/middlendian/llima-box/internal/linewriter"
 )
 
 const (
-	// DefaultInstanceName is the name of the Lima VM instance
+	// DefaultInstanceName is the name of the Lima VM instance used unless
+	// another is configured
 	DefaultInstanceName = "llima-box"
 )
 
+const (
+	// DefaultQueryTimeout bounds limactl commands reading the VM's state
+	// unless Timeouts.Query is set
+	DefaultQueryTimeout = time.Minute
+
+	// DefaultLifecycleTimeout bounds creating, starting, stopping, and
+	// deleting the VM unless Timeouts.Lifecycle is set. Creating it
+	// downloads the VM image, which can take a while.
+	DefaultLifecycleTimeout = 30 * time.Minute
+)
+
+// Timeouts bound how long limactl commands may run, so a hung limactl
+// fails the command instead of blocking it forever. Zero fields use the
+// defaults. Copies are only bound by their context, since their duration
+// depends on how much is copied.
+type Timeouts struct {
+	// Query bounds commands reading the VM's state, such as limactl list
+	Query time.Duration
+
+	// Lifecycle bounds creating, starting, stopping, and deleting the VM
+	Lifecycle time.Duration
+}
+
+// query returns the timeout of commands reading the VM's state
+func (t Timeouts) query() time.Duration {
+	if t.Query > 0 {
+		return t.Query
+	}
+	return DefaultQueryTimeout
+}
+
+// lifecycle returns the timeout of commands changing the VM's state
+func (t Timeouts) lifecycle() time.Duration {
+	if t.Lifecycle > 0 {
+		return t.Lifecycle
+	}
+	return DefaultLifecycleTimeout
+}
+
 // commandExecutor defines the interface for executing limactl commands
 type commandExecutor interface {
 	exec(ctx context.Context, limactl string, args ...string) ([]byte, error)
 }
 
-// realExecutor implements commandExecutor using os/exec
-type realExecutor struct{}
+// realExecutor implements commandExecutor using os/exec. Commands and their
+// output are reported to progress.
+type realExecutor struct {
+	progress ProgressFunc
+}
 
 func (e *realExecutor) exec(ctx context.Context, limactl string, args ...string) ([]byte, error) {
 	// Check if limactl is in PATH
@@ -32,36 +80,35 @@ func (e *realExecutor) exec(ctx context.Context, limactl string, args ...string)
 	}
 
 	// Log the command being executed
-	cmdStr := fmt.Sprintf("%s %s", limactl, strings.Join(args, " "))
-	fmt.Fprintf(os.Stderr, "\033[90mDEBUG\033[0m: Executing: %s\n", cmdStr)
+	e.progress.emit(EventDebug, "Executing: %s %s", limactl, strings.Join(args, " "))
 
 	// #nosec G204 -- args are controlled internally and validated
 	cmd := exec.CommandContext(ctx, limactl, args...)
 
-	// For create/start commands, stream output directly to stderr for real-time feedback
+	// For create/start commands, report output as it arrives for real-time feedback
 	// For other commands (like list --json), capture output for parsing
 	var stdout, stderr bytes.Buffer
-	needCapture := len(args) > 0 && (args[0] == "list" || strings.Contains(strings.Join(args, " "), "--json"))
+	joined := strings.Join(args, " ")
+	needCapture := len(args) > 0 && (args[0] == "list" || strings.Contains(joined, "--json") || strings.Contains(joined, "--version"))
 
 	if needCapture {
 		// Capture output for parsing
 		cmd.Stdout = &stdout
 		cmd.Stderr = &stderr
 	} else {
-		// Stream output directly to terminal for real-time feedback
-		cmd.Stdout = os.Stderr
-		cmd.Stderr = os.Stderr
+		// Report output line by line for real-time feedback
+		lines := linewriter.New(func(line string) { e.progress.emit(EventDebug, "%s", line) })
+		defer lines.Flush()
+		cmd.Stdout = lines
+		cmd.Stderr = lines
 	}
 
 	err := cmd.Run()
 
 	if needCapture {
 		// Log captured stderr for debugging
-		if stderr.Len() > 0 {
-			stderrStr := strings.TrimSpace(stderr.String())
-			if stderrStr != "" {
-				fmt.Fprintf(os.Stderr, "\033[90mDEBUG\033[0m: limactl stderr:\n%s\n", stderrStr)
-			}
+		if stderrStr := strings.TrimSpace(stderr.String()); stderrStr != "" {
+			e.progress.emit(EventDebug, "limactl stderr:\n%s", stderrStr)
 		}
 
 		if err != nil {
@@ -100,25 +147,70 @@ type UserConfig struct {
 	Name *string `json:"name,omitempty"`
 }
 
+// instancesTTL is how long the output of limactl list is reused. A command
+// usually asks whether the VM exists, whether it's running, and for its
+// details in quick succession, and one limactl list answers all three.
+const instancesTTL = 2 * time.Second
+
 // Manager handles Lima VM lifecycle operations
 type Manager struct {
 	instanceName string
+	settings     Settings
 	limactl      string
 	executor     commandExecutor
+	timeouts     Timeouts
+	progress     ProgressFunc
+
+	// mu guards the cached limactl list output; commands starting,
+	// stopping, creating, or deleting the VM clear it
+	mu        sync.Mutex
+	instances []Instance
+	listedAt  time.Time
 }
 
 // NewManager creates a new VM manager
 func NewManager(instanceName string) *Manager {
+	return NewManagerWithSettings(instanceName, Settings{})
+}
+
+// NewManagerWithSettings creates a VM manager that creates the VM with
+// settings applied to the embedded configuration. Settings only take effect
+// when the VM is created; an existing VM keeps its configuration.
+func NewManagerWithSettings(instanceName string, settings Settings) *Manager {
 	if instanceName == "" {
 		instanceName = DefaultInstanceName
 	}
+	settings.Instance = instanceName
 	return &Manager{
 		instanceName: instanceName,
+		settings:     settings,
 		limactl:      "limactl",
-		executor:     &realExecutor{},
+		executor:     &realExecutor{progress: StderrProgress},
+		progress:     StderrProgress,
 	}
 }
 
+// SetProgress sets the function receiving the manager's progress events,
+// including the limactl commands it runs and their output. Managers report
+// to StderrProgress unless it's set; nil discards the events.
+func (m *Manager) SetProgress(progress ProgressFunc) {
+	m.progress = progress
+	if e, ok := m.executor.(*realExecutor); ok {
+		e.progress = progress
+	}
+}
+
+// Progress returns the function receiving the manager's progress events
+// (see SetProgress)
+func (m *Manager) Progress() ProgressFunc {
+	return m.progress
+}
+
+// SetTimeouts sets how long limactl commands may run
+func (m *Manager) SetTimeouts(t Timeouts) {
+	m.timeouts = t
+}
+
 // newManagerWithExecutor creates a new VM manager with a custom executor (for testing)
 func newManagerWithExecutor(instanceName string, executor commandExecutor) *Manager {
 	if instanceName == "" {
@@ -131,16 +223,28 @@ func newManagerWithExecutor(instanceName string, executor commandExecutor) *Mana
 	}
 }
 
-// execLimactl executes a limactl command
-func (m *Manager) execLimactl(ctx context.Context, args ...string) ([]byte, error) {
+// execLimactl executes a limactl command, stopping it after timeout unless
+// timeout is zero
+func (m *Manager) execLimactl(ctx context.Context, timeout time.Duration, args ...string) ([]byte, error) {
+	parent := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	// Add --tty=false to prevent ANSI color codes and interactive output
 	fullArgs := append([]string{"--tty=false"}, args...)
-	return m.executor.exec(ctx, m.limactl, fullArgs...)
+	output, err := m.executor.exec(ctx, m.limactl, fullArgs...)
+	if err != nil && parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("limactl %s didn't finish within %s: %w", strings.Join(args, " "), timeout, context.DeadlineExceeded)
+	}
+	return output, err
 }
 
 // Exists checks if the VM instance exists
-func (m *Manager) Exists() (bool, error) {
-	instances, err := m.listInstances()
+func (m *Manager) Exists(ctx context.Context) (bool, error) {
+	instances, err := m.listInstances(ctx)
 	if err != nil {
 		return false, fmt.Errorf("failed to list instances: %w", err)
 	}
@@ -153,9 +257,16 @@ func (m *Manager) Exists() (bool, error) {
 	return false, nil
 }
 
-// listInstances lists all Lima instances
-func (m *Manager) listInstances() ([]Instance, error) {
-	output, err := m.execLimactl(context.Background(), "list", "--json")
+// listInstances lists all Lima instances. The list is reused for
+// instancesTTL, so the queries of one command cost one limactl list.
+func (m *Manager) listInstances(ctx context.Context) ([]Instance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.listedAt.IsZero() && time.Since(m.listedAt) < instancesTTL {
+		return m.instances, nil
+	}
+
+	output, err := m.execLimactl(ctx, m.timeouts.query(), "list", "--json")
 	if err != nil {
 		return nil, err
 	}
@@ -177,12 +288,21 @@ func (m *Manager) listInstances() ([]Instance, error) {
 		instances = append(instances, instance)
 	}
 
+	m.instances, m.listedAt = instances, time.Now()
 	return instances, nil
 }
 
+// forgetInstances drops the cached limactl list output after the VM's state
+// changed, or may have
+func (m *Manager) forgetInstances() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.instances, m.listedAt = nil, time.Time{}
+}
+
 // IsRunning checks if the VM is currently running
-func (m *Manager) IsRunning() (bool, error) {
-	inst, err := m.GetInstance()
+func (m *Manager) IsRunning(ctx context.Context) (bool, error) {
+	inst, err := m.GetInstance(ctx)
 	if err != nil {
 		return false, fmt.Errorf("failed to inspect instance: %w", err)
 	}
@@ -191,8 +311,8 @@ func (m *Manager) IsRunning() (bool, error) {
 }
 
 // GetInstance returns the instance details
-func (m *Manager) GetInstance() (*Instance, error) {
-	instances, err := m.listInstances()
+func (m *Manager) GetInstance(ctx context.Context) (*Instance, error) {
+	instances, err := m.listInstances(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -208,7 +328,7 @@ func (m *Manager) GetInstance() (*Instance, error) {
 
 // Create creates a new Lima VM instance with the embedded configuration
 func (m *Manager) Create(ctx context.Context) error {
-	exists, err := m.Exists()
+	exists, err := m.Exists(ctx)
 	if err != nil {
 		return err
 	}
@@ -216,8 +336,13 @@ func (m *Manager) Create(ctx context.Context) error {
 		return fmt.Errorf("instance %s already exists", m.instanceName)
 	}
 
+	// The data disk must exist before the instance that references it
+	if err := m.EnsureDataDisk(ctx); err != nil {
+		return err
+	}
+
 	// Get configuration YAML
-	configYAML, err := GetEmbeddedConfig()
+	configYAML, err := RenderConfig(m.settings)
 	if err != nil {
 		return fmt.Errorf("failed to get configuration: %w", err)
 	}
@@ -234,17 +359,36 @@ func (m *Manager) Create(ctx context.Context) error {
 	}()
 
 	// Create instance with limactl
-	_, err = m.execLimactl(ctx, "create", "--name="+m.instanceName, configPath)
+	defer m.forgetInstances()
+	_, err = m.execLimactl(ctx, m.timeouts.lifecycle(), "create", "--name="+m.instanceName, configPath)
 	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+			m.removeInterruptedInstance(ctx)
+		}
 		return fmt.Errorf("failed to create instance: %w", err)
 	}
 
 	return nil
 }
 
+// interruptCleanupTimeout bounds the cleanup after an interrupted create
+const interruptCleanupTimeout = 30 * time.Second
+
+// removeInterruptedInstance deletes what an interrupted limactl create left
+// behind, so the next run creates the VM from scratch instead of failing on a
+// half-written instance. The data disk is kept.
+func (m *Manager) removeInterruptedInstance(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), interruptCleanupTimeout)
+	defer cancel()
+
+	if _, err := m.execLimactl(ctx, 0, "delete", m.instanceName, "--force"); err != nil {
+		m.progress.emit(EventWarning, "failed to remove partially created instance %s: %v", m.instanceName, err)
+	}
+}
+
 // Start starts the Lima VM instance
 func (m *Manager) Start(ctx context.Context) error {
-	inst, err := m.GetInstance()
+	inst, err := m.GetInstance(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get instance: %w", err)
 	}
@@ -255,7 +399,8 @@ func (m *Manager) Start(ctx context.Context) error {
 	}
 
 	// Start the instance
-	_, err = m.execLimactl(ctx, "start", m.instanceName)
+	defer m.forgetInstances()
+	_, err = m.execLimactl(ctx, m.timeouts.lifecycle(), "start", m.instanceName)
 	if err != nil {
 		return fmt.Errorf("failed to start instance: %w", err)
 	}
@@ -265,12 +410,13 @@ func (m *Manager) Start(ctx context.Context) error {
 
 // Stop stops the Lima VM instance gracefully
 func (m *Manager) Stop(ctx context.Context) error {
-	_, err := m.GetInstance()
+	_, err := m.GetInstance(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get instance: %w", err)
 	}
 
-	_, err = m.execLimactl(ctx, "stop", m.instanceName)
+	defer m.forgetInstances()
+	_, err = m.execLimactl(ctx, m.timeouts.lifecycle(), "stop", m.instanceName)
 	if err != nil {
 		return fmt.Errorf("failed to stop instance: %w", err)
 	}
@@ -280,7 +426,7 @@ func (m *Manager) Stop(ctx context.Context) error {
 
 // Delete deletes the Lima VM instance
 func (m *Manager) Delete(ctx context.Context, force bool) error {
-	_, err := m.GetInstance()
+	_, err := m.GetInstance(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get instance: %w", err)
 	}
@@ -290,7 +436,8 @@ func (m *Manager) Delete(ctx context.Context, force bool) error {
 		args = append(args, "--force")
 	}
 
-	_, err = m.execLimactl(ctx, args...)
+	defer m.forgetInstances()
+	_, err = m.execLimactl(ctx, m.timeouts.lifecycle(), args...)
 	if err != nil {
 		return fmt.Errorf("failed to delete instance: %w", err)
 	}
@@ -298,39 +445,41 @@ func (m *Manager) Delete(ctx context.Context, force bool) error {
 	return nil
 }
 
-// EnsureRunning ensures the VM is running, starting it if necessary
+// EnsureRunning ensures the VM is running, starting it if necessary. It
+// lists the instances afresh, since another process may have started the VM
+// since it was last listed.
 func (m *Manager) EnsureRunning(ctx context.Context) error {
-	exists, err := m.Exists()
+	m.forgetInstances()
+	exists, err := m.Exists(ctx)
 	if err != nil {
 		return err
 	}
 
 	if !exists {
-		fmt.Printf("Creating Lima VM instance '%s'...\n", m.instanceName)
+		m.progress.emit(EventInfo, "Creating Lima VM instance '%s'...", m.instanceName)
 		if err := m.Create(ctx); err != nil {
 			return err
 		}
 	}
 
-	running, err := m.IsRunning()
+	running, err := m.IsRunning(ctx)
 	if err != nil {
 		return err
 	}
 
 	if !running {
-		fmt.Printf("Starting Lima VM instance '%s'...\n", m.instanceName)
+		m.progress.emit(EventInfo, "Starting Lima VM instance '%s'...", m.instanceName)
 		if err := m.Start(ctx); err != nil {
 			return err
 		}
-		fmt.Println("VM started successfully")
 	}
 
 	return nil
 }
 
 // GetConfigPath returns the path to the Lima configuration file
-func (m *Manager) GetConfigPath() (string, error) {
-	inst, err := m.GetInstance()
+func (m *Manager) GetConfigPath(ctx context.Context) (string, error) {
+	inst, err := m.GetInstance(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -338,6 +487,29 @@ func (m *Manager) GetConfigPath() (string, error) {
 	return configPath, nil
 }
 
+// Config returns the instance's Lima configuration, or the one it would be
+// created with if it doesn't exist yet
+func (m *Manager) Config(ctx context.Context) (string, error) {
+	exists, err := m.Exists(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return RenderConfig(m.settings)
+	}
+
+	configPath, err := m.GetConfigPath(ctx)
+	if err != nil {
+		return "", err
+	}
+	// #nosec G304 -- Path is inside the Lima instance directory
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read instance configuration: %w", err)
+	}
+	return string(data), nil
+}
+
 // GetLimaHome returns the Lima home directory
 func (m *Manager) GetLimaHome() (string, error) {
 	// Check LIMA_HOME environment variable
@@ -2,11 +2,17 @@ package vm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/middlendian/llima-box/pkg/pathmap"
+	"gopkg.in/yaml.v3"
 )
 
 // mockExecutor implements commandExecutor for testing
@@ -82,7 +88,7 @@ func TestListInstances_SingleObject(t *testing.T) {
 
 	mgr := newManagerWithExecutor("llima-box", mock)
 
-	instances, err := mgr.listInstances()
+	instances, err := mgr.listInstances(context.Background())
 	if err != nil {
 		t.Fatalf("listInstances failed: %v", err)
 	}
@@ -107,7 +113,7 @@ func TestListInstances_Array(t *testing.T) {
 
 	mgr := newManagerWithExecutor("llima-box", mock)
 
-	instances, err := mgr.listInstances()
+	instances, err := mgr.listInstances(context.Background())
 	if err != nil {
 		t.Fatalf("listInstances failed: %v", err)
 	}
@@ -132,7 +138,7 @@ func TestListInstances_Empty(t *testing.T) {
 
 	mgr := newManagerWithExecutor("llima-box", mock)
 
-	instances, err := mgr.listInstances()
+	instances, err := mgr.listInstances(context.Background())
 	if err != nil {
 		t.Fatalf("listInstances failed: %v", err)
 	}
@@ -149,7 +155,7 @@ func TestListInstances_InvalidJSON(t *testing.T) {
 
 	mgr := newManagerWithExecutor("llima-box", mock)
 
-	_, err := mgr.listInstances()
+	_, err := mgr.listInstances(context.Background())
 	if err == nil {
 		t.Fatal("expected error for invalid JSON, got nil")
 	}
@@ -200,7 +206,7 @@ func TestExists_InstanceExists(t *testing.T) {
 
 			mgr := newManagerWithExecutor(tt.instanceName, mock)
 
-			exists, err := mgr.Exists()
+			exists, err := mgr.Exists(context.Background())
 			if err != nil {
 				t.Fatalf("Exists failed: %v", err)
 			}
@@ -247,7 +253,7 @@ func TestIsRunning(t *testing.T) {
 
 			mgr := newManagerWithExecutor("llima-box", mock)
 
-			running, err := mgr.IsRunning()
+			running, err := mgr.IsRunning(context.Background())
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("expected error=%v, got error=%v", tt.wantErr, err)
 			}
@@ -300,7 +306,7 @@ func TestGetInstance(t *testing.T) {
 
 			mgr := newManagerWithExecutor(tt.instanceName, mock)
 
-			inst, err := mgr.GetInstance()
+			inst, err := mgr.GetInstance(context.Background())
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("expected error=%v, got error=%v", tt.wantErr, err)
 			}
@@ -365,6 +371,54 @@ func TestStart(t *testing.T) {
 	}
 }
 
+// TestListInstances_Cached tests that one limactl list answers a command's
+// queries, and that starting the VM makes the next query list it again
+func TestListInstances_Cached(t *testing.T) {
+	mock := newMockExecutor()
+	list := []string{"--tty=false", "list", "--json"}
+	mock.setResponse(list, loadTestData(t, "list_stopped_instance.json"))
+	mock.setResponse([]string{"--tty=false", "start", "llima-box"}, []byte{})
+
+	mgr := newManagerWithExecutor("llima-box", mock)
+	ctx := context.Background()
+
+	if exists, err := mgr.Exists(ctx); err != nil || !exists {
+		t.Fatalf("Exists() = %v, %v", exists, err)
+	}
+	if running, err := mgr.IsRunning(ctx); err != nil || running {
+		t.Fatalf("IsRunning() = %v, %v", running, err)
+	}
+	if _, err := mgr.GetInstance(ctx); err != nil {
+		t.Fatalf("GetInstance() error = %v", err)
+	}
+	if got := countCalls(mock, list); got != 1 {
+		t.Errorf("limactl list ran %d times, want 1", got)
+	}
+
+	if err := mgr.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	mock.setResponse(list, loadTestData(t, "list_running_instance.json"))
+	if running, err := mgr.IsRunning(ctx); err != nil || !running {
+		t.Errorf("IsRunning() after Start = %v, %v, want true", running, err)
+	}
+	if got := countCalls(mock, list); got != 2 {
+		t.Errorf("limactl list ran %d times, want 2", got)
+	}
+}
+
+// countCalls returns how often the mock ran args
+func countCalls(m *mockExecutor, args []string) int {
+	key := strings.Join(args, " ")
+	n := 0
+	for _, call := range m.calls {
+		if strings.Join(call, " ") == key {
+			n++
+		}
+	}
+	return n
+}
+
 // TestStop tests stopping an instance
 func TestStop(t *testing.T) {
 	mock := newMockExecutor()
@@ -418,6 +472,90 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+// TestCreate_Interrupted tests that an interrupted create removes the
+// partial instance
+func TestCreate_Interrupted(t *testing.T) {
+	mock := newMockExecutor()
+	mock.setResponse([]string{"--tty=false", "list", "--json"}, loadTestData(t, "list_empty.json"))
+	mock.setResponse([]string{"--tty=false", "disk", "list", "--json"}, loadTestData(t, "disk_list_data_disk.json"))
+	configPath := filepath.Join(os.TempDir(), "llima-box-llima-box.yaml")
+	mock.setError([]string{"--tty=false", "create", "--name=llima-box", configPath}, context.Canceled)
+	deleteCmd := []string{"--tty=false", "delete", "llima-box", "--force"}
+	mock.setResponse(deleteCmd, []byte{})
+
+	mgr := newManagerWithExecutor("llima-box", mock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := mgr.Create(ctx); err == nil {
+		t.Fatal("expected an error")
+	}
+	mock.assertCalled(t, deleteCmd)
+}
+
+// hangingExecutor is a limactl that never finishes on its own
+type hangingExecutor struct{}
+
+func (hangingExecutor) exec(ctx context.Context, _ string, _ ...string) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// TestTimeouts tests that a hung limactl is stopped after the timeout, and
+// that cancellation by the caller isn't reported as one
+func TestTimeouts(t *testing.T) {
+	mgr := newManagerWithExecutor("llima-box", hangingExecutor{})
+	mgr.SetTimeouts(Timeouts{Query: 10 * time.Millisecond})
+
+	_, err := mgr.Exists(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Exists() error = %v, want context.DeadlineExceeded", err)
+	}
+	if !strings.Contains(err.Error(), "limactl list --json didn't finish within 10ms") {
+		t.Errorf("Exists() error = %v, want the command and timeout", err)
+	}
+
+	mgr.SetTimeouts(Timeouts{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = mgr.Exists(ctx)
+	if !errors.Is(err, context.Canceled) || strings.Contains(err.Error(), "didn't finish") {
+		t.Errorf("Exists() error = %v, want context.Canceled", err)
+	}
+}
+
+// TestConfig tests reading the configuration of an existing instance and
+// rendering it for a missing one
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "lima.yaml"), []byte("cpus: 8\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mock := newMockExecutor()
+	mock.setResponse([]string{"--tty=false", "list", "--json"},
+		[]byte(fmt.Sprintf(`{"name":"llima-box","status":"Stopped","dir":%q}`, dir)))
+
+	config, err := newManagerWithExecutor("llima-box", mock).Config(context.Background())
+	if err != nil {
+		t.Fatalf("Config failed: %v", err)
+	}
+	if config != "cpus: 8\n" {
+		t.Errorf("expected the instance's lima.yaml, got %q", config)
+	}
+
+	config, err = newManagerWithExecutor("other", mock).Config(context.Background())
+	if err != nil {
+		t.Fatalf("Config failed: %v", err)
+	}
+	want, err := RenderConfig(Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config != want {
+		t.Errorf("expected the rendered configuration for a missing instance")
+	}
+}
+
 // TestGetInstanceName tests getting the instance name
 func TestGetInstanceName(t *testing.T) {
 	tests := []struct {
@@ -462,7 +600,7 @@ func TestCommandExecutionErrors(t *testing.T) {
 				m.setError([]string{"--tty=false", "list", "--json"}, fmt.Errorf("command failed"))
 			},
 			test: func(mgr *Manager) error {
-				_, err := mgr.listInstances()
+				_, err := mgr.listInstances(context.Background())
 				return err
 			},
 			errMsg: "command failed",
@@ -528,7 +666,7 @@ func TestGetConfigPath(t *testing.T) {
 
 	mgr := newManagerWithExecutor("llima-box", mock)
 
-	configPath, err := mgr.GetConfigPath()
+	configPath, err := mgr.GetConfigPath(context.Background())
 	if err != nil {
 		t.Fatalf("GetConfigPath failed: %v", err)
 	}
@@ -538,3 +676,426 @@ func TestGetConfigPath(t *testing.T) {
 		t.Errorf("expected path to end with '%s', got: %s", expectedSuffix, configPath)
 	}
 }
+
+// TestEnsureDataDisk tests creating the data disk only when it is missing
+func TestEnsureDataDisk(t *testing.T) {
+	createCmd := []string{"--tty=false", "disk", "create", "llima-box-data", "--size=50GiB"}
+
+	tests := []struct {
+		name            string
+		dataFile        string
+		expectCreateCmd bool
+	}{
+		{
+			name:            "data disk exists",
+			dataFile:        "disk_list_data_disk.json",
+			expectCreateCmd: false,
+		},
+		{
+			name:            "only other disks exist",
+			dataFile:        "disk_list_other_disk.json",
+			expectCreateCmd: true,
+		},
+		{
+			name:            "no disks",
+			dataFile:        "disk_list_empty.json",
+			expectCreateCmd: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.setResponse([]string{"--tty=false", "disk", "list", "--json"}, loadTestData(t, tt.dataFile))
+			mock.setResponse(createCmd, []byte{})
+
+			mgr := newManagerWithExecutor("llima-box", mock)
+
+			if err := mgr.EnsureDataDisk(context.Background()); err != nil {
+				t.Fatalf("EnsureDataDisk failed: %v", err)
+			}
+
+			created := false
+			for _, call := range mock.calls {
+				if strings.Join(call, " ") == strings.Join(createCmd, " ") {
+					created = true
+				}
+			}
+			if created != tt.expectCreateCmd {
+				t.Errorf("expected disk create called=%v, got %v", tt.expectCreateCmd, created)
+			}
+		})
+	}
+}
+
+// TestGetDataDisk tests parsing disk list output
+func TestGetDataDisk(t *testing.T) {
+	mock := newMockExecutor()
+	mock.setResponse([]string{"--tty=false", "disk", "list", "--json"}, loadTestData(t, "disk_list_data_disk.json"))
+
+	mgr := newManagerWithExecutor("llima-box", mock)
+
+	disk, err := mgr.GetDataDisk(context.Background())
+	if err != nil {
+		t.Fatalf("GetDataDisk failed: %v", err)
+	}
+	if disk == nil {
+		t.Fatal("expected data disk, got nil")
+	}
+	if disk.MountPoint != DataDiskMountPoint {
+		t.Errorf("expected mount point %s, got %s", DataDiskMountPoint, disk.MountPoint)
+	}
+	if disk.Instance != "llima-box" {
+		t.Errorf("expected instance llima-box, got %s", disk.Instance)
+	}
+}
+
+// TestEnsureDataDisk_Errors tests disk command failures
+func TestEnsureDataDisk_Errors(t *testing.T) {
+	t.Run("list fails", func(t *testing.T) {
+		mock := newMockExecutor()
+		mock.setError([]string{"--tty=false", "disk", "list", "--json"}, fmt.Errorf("list failed"))
+
+		mgr := newManagerWithExecutor("llima-box", mock)
+		err := mgr.EnsureDataDisk(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "failed to list disks") {
+			t.Errorf("expected list error, got: %v", err)
+		}
+	})
+
+	t.Run("create fails", func(t *testing.T) {
+		mock := newMockExecutor()
+		mock.setResponse([]string{"--tty=false", "disk", "list", "--json"}, loadTestData(t, "disk_list_empty.json"))
+		mock.setError([]string{"--tty=false", "disk", "create", "llima-box-data", "--size=50GiB"}, fmt.Errorf("create failed"))
+
+		mgr := newManagerWithExecutor("llima-box", mock)
+		err := mgr.EnsureDataDisk(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "failed to create data disk") {
+			t.Errorf("expected create error, got: %v", err)
+		}
+	})
+}
+
+func TestBasePackagesMatchConfig(t *testing.T) {
+	config, err := GetEmbeddedConfig()
+	if err != nil {
+		t.Fatalf("GetEmbeddedConfig failed: %v", err)
+	}
+
+	line := "apt-get install -y " + strings.Join(BasePackages, " ") + "\n"
+	if !strings.Contains(config, line) {
+		t.Errorf("lima.yaml doesn't install BasePackages; expected line %q", line)
+	}
+}
+
+func TestFirewallMatchesConfig(t *testing.T) {
+	config, err := GetEmbeddedConfig()
+	if err != nil {
+		t.Fatalf("GetEmbeddedConfig failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"table inet " + FirewallTable + " {",
+		"chain " + FirewallEnvChain + " {",
+		"jump " + FirewallEnvChain + "\n",
+		`include "` + FirewallRulesDir + `/*.nft"`,
+		"mkdir -p " + FirewallRulesDir + "\n",
+	} {
+		if !strings.Contains(config, want) {
+			t.Errorf("lima.yaml firewall profile missing %q", want)
+		}
+	}
+}
+
+func TestHelperMatchesConfig(t *testing.T) {
+	config, err := GetEmbeddedConfig()
+	if err != nil {
+		t.Fatalf("GetEmbeddedConfig failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"if " + HelperPath + " version >/dev/null 2>&1; then\n",
+		"cat > " + HelperPath + " <<'EOF'\n",
+		"chmod 755 " + HelperPath + "\n",
+		"groupadd -f " + EnvGroup + "\n",
+		"group=" + EnvGroup + "\n",
+		"%" + EnvGroup + " ALL=(ALL) !ALL\n",
+		"$USER ALL=(root) NOPASSWD: " + HelperPath + "\n",
+		"/etc/sudoers.d/lima-environments",
+	} {
+		if !strings.Contains(config, want) {
+			t.Errorf("lima.yaml sudo configuration missing %q", want)
+		}
+	}
+	// Command lines can carry secrets, so sudo mustn't log them
+	if strings.Contains(config, "logfile=") {
+		t.Error("lima.yaml sudo configuration logs command lines")
+	}
+}
+
+// TestCopy tests transferring files with limactl copy
+func TestCopy(t *testing.T) {
+	hostDir := t.TempDir()
+
+	tests := []struct {
+		name        string
+		copy        func(*Manager) error
+		dataFile    string
+		expectedCmd []string
+		wantErr     string
+	}{
+		{
+			name: "copy file to VM",
+			copy: func(m *Manager) error {
+				return m.CopyToVM(context.Background(), filepath.Join(hostDir, "setup.sh"), "/tmp/setup.sh", false)
+			},
+			dataFile:    "list_running_instance.json",
+			expectedCmd: []string{"--tty=false", "copy", filepath.Join(hostDir, "setup.sh"), "llima-box:/tmp/setup.sh"},
+		},
+		{
+			name: "copy directory from VM",
+			copy: func(m *Manager) error {
+				return m.CopyFromVM(context.Background(), "/var/log/llima-box", hostDir, true)
+			},
+			dataFile:    "list_running_instance.json",
+			expectedCmd: []string{"--tty=false", "copy", "--recursive", "llima-box:/var/log/llima-box", hostDir},
+		},
+		{
+			name: "relative VM path",
+			copy: func(m *Manager) error {
+				return m.CopyToVM(context.Background(), hostDir, "tmp/setup.sh", false)
+			},
+			dataFile: "list_running_instance.json",
+			wantErr:  "must be absolute",
+		},
+		{
+			name: "host path with colon",
+			copy: func(m *Manager) error {
+				return m.CopyFromVM(context.Background(), "/etc/hosts", filepath.Join(hostDir, "a:b"), false)
+			},
+			dataFile: "list_running_instance.json",
+			wantErr:  "contains a colon",
+		},
+		{
+			name: "stopped instance",
+			copy: func(m *Manager) error {
+				return m.CopyToVM(context.Background(), hostDir, "/tmp/x", true)
+			},
+			dataFile: "list_stopped_instance.json",
+			wantErr:  "is not running",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.setResponse([]string{"--tty=false", "list", "--json"}, loadTestData(t, tt.dataFile))
+			if tt.expectedCmd != nil {
+				mock.setResponse(tt.expectedCmd, []byte{})
+			}
+
+			mgr := newManagerWithExecutor("llima-box", mock)
+
+			err := tt.copy(mgr)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("copy failed: %v", err)
+			}
+			mock.assertCalled(t, tt.expectedCmd)
+		})
+	}
+}
+
+func TestParseHostMounts(t *testing.T) {
+	mounts, err := parseHostMounts(embeddedConfig, "/Users/alice")
+	if err != nil {
+		t.Fatalf("parseHostMounts failed: %v", err)
+	}
+	if len(mounts) != 1 || mounts[0].Host != "/Users/alice" || mounts[0].VM != "" {
+		t.Errorf("expected the home directory at its own path, got %+v", mounts)
+	}
+
+	config := `mounts:
+- location: "~/src"
+  mountPoint: /src
+- location: /Volumes/External
+`
+	mounts, err = parseHostMounts(config, "/Users/alice")
+	if err != nil {
+		t.Fatalf("parseHostMounts failed: %v", err)
+	}
+	want := []pathmap.Mount{{Host: "/Users/alice/src", VM: "/src"}, {Host: "/Volumes/External"}}
+	if len(mounts) != len(want) {
+		t.Fatalf("got %+v, want %+v", mounts, want)
+	}
+	for i := range want {
+		if mounts[i] != want[i] {
+			t.Errorf("mount %d = %+v, want %+v", i, mounts[i], want[i])
+		}
+	}
+}
+
+func TestHostMounts_FromInstance(t *testing.T) {
+	limaHome := t.TempDir()
+	t.Setenv("LIMA_HOME", limaHome)
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManagerWithSettings("test-vm", Settings{Mounts: []Mount{{Location: "/srv/new", Writable: true}}})
+
+	// Not created yet: the mounts it would be created with
+	mounts, err := m.HostMounts()
+	if err != nil {
+		t.Fatalf("HostMounts failed: %v", err)
+	}
+	if !slices.ContainsFunc(mounts, func(mt pathmap.Mount) bool { return mt.Host == "/srv/new" }) {
+		t.Errorf("expected the configured mounts for a new VM, got %+v", mounts)
+	}
+
+	// Created before the mount was configured: the instance's own
+	dir := filepath.Join(limaHome, "test-vm")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "lima.yaml"), []byte("mounts:\n- location: \"~\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mounts, err = m.HostMounts()
+	if err != nil {
+		t.Fatalf("HostMounts failed: %v", err)
+	}
+	if len(mounts) != 1 || mounts[0].Host != home {
+		t.Errorf("expected the instance's mounts, got %+v", mounts)
+	}
+}
+
+func TestRenderConfig(t *testing.T) {
+	unchanged, err := RenderConfig(Settings{})
+	if err != nil {
+		t.Fatalf("RenderConfig failed: %v", err)
+	}
+
+	rendered, err := RenderConfig(Settings{
+		CPUs:      2,
+		Memory:    "4GiB",
+		MountType: "virtiofs",
+		Mounts:    []Mount{{Location: "~/src", MountPoint: "/src", Writable: true}},
+	})
+	if err != nil {
+		t.Fatalf("RenderConfig failed: %v", err)
+	}
+
+	var got, want struct {
+		CPUs      int    `yaml:"cpus"`
+		Memory    string `yaml:"memory"`
+		Disk      string `yaml:"disk"`
+		MountType string `yaml:"mountType"`
+		Mounts    []Mount
+	}
+	if err := yaml.Unmarshal([]byte(rendered), &got); err != nil {
+		t.Fatalf("rendered configuration doesn't parse: %v", err)
+	}
+	if err := yaml.Unmarshal([]byte(unchanged), &want); err != nil {
+		t.Fatalf("configuration doesn't parse: %v", err)
+	}
+
+	if got.CPUs != 2 || got.Memory != "4GiB" || got.MountType != "virtiofs" {
+		t.Errorf("settings not applied: %+v", got)
+	}
+	if got.Disk != want.Disk || got.Disk == "" {
+		t.Errorf("expected disk to keep the default %q, got %q", want.Disk, got.Disk)
+	}
+	if len(got.Mounts) != 1 || got.Mounts[0] != (Mount{Location: "~/src", MountPoint: "/src", Writable: true}) {
+		t.Errorf("expected mounts to be replaced, got %+v", got.Mounts)
+	}
+	mounts, err := parseHostMounts(rendered, "/Users/alice")
+	if err != nil {
+		t.Fatalf("parseHostMounts failed: %v", err)
+	}
+	if len(mounts) != 1 || mounts[0] != (pathmap.Mount{Host: "/Users/alice/src", VM: "/src"}) {
+		t.Errorf("expected host mounts from the settings, got %+v", mounts)
+	}
+}
+
+func TestRenderConfig_KeepsEmbeddedScripts(t *testing.T) {
+	rendered, err := RenderConfig(Settings{CPUs: 8})
+	if err != nil {
+		t.Fatalf("RenderConfig failed: %v", err)
+	}
+
+	var got, want struct {
+		Provision []struct {
+			Script string `yaml:"script"`
+		} `yaml:"provision"`
+	}
+	if err := yaml.Unmarshal([]byte(rendered), &got); err != nil {
+		t.Fatalf("rendered configuration doesn't parse: %v", err)
+	}
+	if err := yaml.Unmarshal([]byte(embeddedConfig), &want); err != nil {
+		t.Fatalf("embedded configuration doesn't parse: %v", err)
+	}
+	if len(want.Provision) == 0 || len(got.Provision) != len(want.Provision) {
+		t.Fatalf("expected %d provisioning scripts, got %d", len(want.Provision), len(got.Provision))
+	}
+	for i := range want.Provision {
+		if got.Provision[i].Script != want.Provision[i].Script {
+			t.Errorf("provisioning script %d differs from the embedded configuration", i)
+		}
+	}
+}
+
+func TestRenderConfig_OtherInstance(t *testing.T) {
+	for _, tt := range []struct {
+		instance string
+		disk     string
+		port     int
+		scripts  int
+	}{
+		{instance: DefaultInstanceName, disk: DataDiskName, port: 60022},
+		{instance: "client-a", disk: "llima-box-data-client-a", port: 0, scripts: 1},
+	} {
+		t.Run(tt.instance, func(t *testing.T) {
+			rendered, err := RenderConfig(Settings{Instance: tt.instance})
+			if err != nil {
+				t.Fatalf("RenderConfig failed: %v", err)
+			}
+
+			var got, embedded struct {
+				AdditionalDisks []struct {
+					Name string `yaml:"name"`
+				} `yaml:"additionalDisks"`
+				SSH struct {
+					LocalPort int `yaml:"localPort"`
+				} `yaml:"ssh"`
+				Provision []struct {
+					Script string `yaml:"script"`
+				} `yaml:"provision"`
+			}
+			if err := yaml.Unmarshal([]byte(rendered), &got); err != nil {
+				t.Fatalf("rendered configuration doesn't parse: %v", err)
+			}
+			if err := yaml.Unmarshal([]byte(embeddedConfig), &embedded); err != nil {
+				t.Fatalf("embedded configuration doesn't parse: %v", err)
+			}
+
+			if len(got.AdditionalDisks) != 1 || got.AdditionalDisks[0].Name != tt.disk {
+				t.Errorf("expected data disk %s, got %+v", tt.disk, got.AdditionalDisks)
+			}
+			if got.SSH.LocalPort != tt.port {
+				t.Errorf("expected SSH port %d, got %d", tt.port, got.SSH.LocalPort)
+			}
+			if len(got.Provision) != len(embedded.Provision)+tt.scripts {
+				t.Fatalf("expected %d provisioning scripts, got %d", len(embedded.Provision)+tt.scripts, len(got.Provision))
+			}
+			if tt.scripts > 0 && !strings.Contains(got.Provision[0].Script, "ln -sfn /mnt/lima-"+tt.disk+" "+DataDiskMountPoint) {
+				t.Errorf("expected the data disk to be linked first, got %q", got.Provision[0].Script)
+			}
+		})
+	}
+}
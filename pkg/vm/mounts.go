@@ -0,0 +1,74 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/middlendian/llima-box/pkg/config"
+	"github.com/middlendian/llima-box/pkg/pathmap"
+	"gopkg.in/yaml.v3"
+)
+
+// limaMounts is the part of a Lima configuration describing host mounts
+type limaMounts struct {
+	Mounts []struct {
+		Location   string `yaml:"location"`
+		MountPoint string `yaml:"mountPoint"`
+	} `yaml:"mounts"`
+}
+
+// HostMounts returns the host directories the VM mounts, with "~" expanded
+// to the user's home directory the way Lima expands it. They're read from
+// the instance's own configuration, since mounts in the host configuration
+// only apply when the VM is created; a VM that doesn't exist yet gets the
+// mounts it would be created with.
+func (m *Manager) HostMounts() ([]pathmap.Mount, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	data, err := m.instanceConfig()
+	if err != nil {
+		return nil, err
+	}
+	return parseHostMounts(data, home)
+}
+
+// instanceConfig returns the instance's Lima configuration, or the one it
+// would be created with if it doesn't exist. Unlike Config, it reads the
+// instance directory without running limactl.
+func (m *Manager) instanceConfig() (string, error) {
+	limaHome, err := m.GetLimaHome()
+	if err != nil {
+		return "", err
+	}
+	// #nosec G304 -- Path is inside the Lima instance directory
+	data, err := os.ReadFile(filepath.Join(limaHome, m.instanceName, "lima.yaml"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return RenderConfig(m.settings)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read instance configuration: %w", err)
+	}
+	return string(data), nil
+}
+
+// parseHostMounts extracts the mounts from a Lima configuration
+func parseHostMounts(data, home string) ([]pathmap.Mount, error) {
+	var cfg limaMounts
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse VM configuration: %w", err)
+	}
+
+	mounts := make([]pathmap.Mount, 0, len(cfg.Mounts))
+	for _, m := range cfg.Mounts {
+		mounts = append(mounts, pathmap.Mount{
+			Host: config.ExpandHome(m.Location, home),
+			VM:   config.ExpandHome(m.MountPoint, home),
+		})
+	}
+	return mounts, nil
+}
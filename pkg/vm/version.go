@@ -0,0 +1,79 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MinLimaVersion is the oldest Lima release llima-box supports
+const MinLimaVersion = "1.0.0"
+
+// versionPattern finds the version in `limactl --version` output, e.g.
+// "limactl version 1.0.3" or "limactl version 2.0.0-beta.1"
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+
+// LimactlPath returns where limactl is found in PATH
+func (m *Manager) LimactlPath() (string, error) {
+	path, err := exec.LookPath(m.limactl)
+	if err != nil {
+		return "", fmt.Errorf("limactl not found in PATH: %w", err)
+	}
+	return path, nil
+}
+
+// LimaVersion returns the installed Lima version, as limactl reports it
+func (m *Manager) LimaVersion(ctx context.Context) (string, error) {
+	output, err := m.execLimactl(ctx, m.timeouts.query(), "--version")
+	if err != nil {
+		return "", fmt.Errorf("failed to get Lima version: %w", err)
+	}
+	version := versionPattern.FindString(string(output))
+	if version == "" {
+		return "", fmt.Errorf("failed to parse Lima version from %q", strings.TrimSpace(string(output)))
+	}
+	return version, nil
+}
+
+// CompareVersions compares two major.minor.patch versions, returning -1, 0,
+// or 1 as a is older than, the same as, or newer than b. Pre-release
+// suffixes are ignored.
+func CompareVersions(a, b string) (int, error) {
+	pa, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range pa {
+		switch {
+		case pa[i] < pb[i]:
+			return -1, nil
+		case pa[i] > pb[i]:
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// parseVersion returns the major, minor, and patch numbers of version
+func parseVersion(version string) ([3]int, error) {
+	var parts [3]int
+	match := versionPattern.FindStringSubmatch(version)
+	if match == nil {
+		return parts, fmt.Errorf("invalid version %q", version)
+	}
+	for i := range parts {
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return parts, fmt.Errorf("invalid version %q: %w", version, err)
+		}
+		parts[i] = n
+	}
+	return parts, nil
+}
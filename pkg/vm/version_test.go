@@ -0,0 +1,68 @@
+package vm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLimaVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    string
+		wantErr string
+	}{
+		{name: "release", output: "limactl version 1.0.3\n", want: "1.0.3"},
+		{name: "pre-release", output: "limactl version 2.0.0-beta.1\n", want: "2.0.0"},
+		{name: "unparsable", output: "limactl version HEAD\n", wantErr: "failed to parse Lima version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockExecutor()
+			mock.setResponse([]string{"--tty=false", "--version"}, []byte(tt.output))
+
+			got, err := newManagerWithExecutor("llima-box", mock).LimaVersion(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LimaVersion failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("LimaVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "1.0.3", b: "1.0.0", want: 1},
+		{a: "0.23.2", b: "1.0.0", want: -1},
+		{a: "1.0.0", b: "1.0.0", want: 0},
+		{a: "1.10.0", b: "1.9.9", want: 1},
+		{a: "2.0.0-rc.1", b: "2.0.0", want: 0},
+	}
+
+	for _, tt := range tests {
+		got, err := CompareVersions(tt.a, tt.b)
+		if err != nil {
+			t.Fatalf("CompareVersions(%s, %s) failed: %v", tt.a, tt.b, err)
+		}
+		if got != tt.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	if _, err := CompareVersions("latest", "1.0.0"); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+}
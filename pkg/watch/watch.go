@@ -0,0 +1,195 @@
+// Package watch detects changes in a host directory tree.
+//
+// Changes are found by polling: each scan records the size, modification time,
+// and mode of every file, and is compared with the previous scan. Polling needs
+// no platform-specific notification APIs and works the same on every host
+// filesystem, at the cost of a short delay.
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultInterval is the polling interval used when none is given
+const DefaultInterval = 500 * time.Millisecond
+
+// DefaultIgnore lists directories that are never watched: version control
+// metadata and dependency trees that tools rewrite on their own
+var DefaultIgnore = []string{".git", ".hg", ".svn", "node_modules"}
+
+// fileState is what a scan records about a file
+type fileState struct {
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+}
+
+// Snapshot maps paths relative to the watched root to their state
+type Snapshot map[string]fileState
+
+// Watcher reports changes under a directory
+type Watcher struct {
+	root     string
+	interval time.Duration
+	ignore   []string
+	last     Snapshot
+}
+
+// New creates a watcher for root. Paths whose relative path, or any of whose
+// path components, match one of the ignore glob patterns are skipped. A zero
+// interval selects DefaultInterval.
+func New(root string, interval time.Duration, ignore []string) (*Watcher, error) {
+	for _, pattern := range ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	w := &Watcher{root: root, interval: interval, ignore: ignore}
+	if err := w.Reset(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Reset makes the current state of the tree the baseline for Next
+func (w *Watcher) Reset() error {
+	snapshot, err := Scan(w.root, w.ignore)
+	if err != nil {
+		return err
+	}
+	w.last = snapshot
+	return nil
+}
+
+// Next blocks until files change and returns the changed paths, relative to
+// the root. It waits for the tree to settle (no changes for one interval)
+// before returning, so a burst of writes from an editor or a checkout is
+// reported once.
+func (w *Watcher) Next(ctx context.Context) ([]string, error) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	var pending Snapshot
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+
+		snapshot, err := Scan(w.root, w.ignore)
+		if err != nil {
+			return nil, err
+		}
+
+		if pending != nil && len(Diff(pending, snapshot)) == 0 {
+			changed := Diff(w.last, snapshot)
+			w.last = snapshot
+			if len(changed) > 0 {
+				return changed, nil
+			}
+			pending = nil
+			continue
+		}
+		if len(Diff(w.last, snapshot)) > 0 {
+			pending = snapshot
+		}
+	}
+}
+
+// Scan records the state of every file under root
+func Scan(root string, ignore []string) (Snapshot, error) {
+	snapshot := make(Snapshot)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can disappear between listing a directory and visiting them
+			if errors.Is(err, fs.ErrNotExist) && path != root {
+				return nil
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if ignored(rel, ignore) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		snapshot[filepath.ToSlash(rel)] = fileState{size: info.Size(), modTime: info.ModTime(), mode: info.Mode()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	return snapshot, nil
+}
+
+// ModTime returns when the file at path, relative to the scanned root, was
+// last modified, and whether the scan found it
+func (s Snapshot) ModTime(path string) (time.Time, bool) {
+	state, ok := s[path]
+	return state.modTime, ok
+}
+
+// Diff returns the sorted paths added, removed, or modified between two
+// snapshots
+func Diff(old, current Snapshot) []string {
+	var changed []string
+	for path, state := range current {
+		if prev, ok := old[path]; !ok || prev != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range old {
+		if _, ok := current[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// ignored reports whether rel or any of its components matches a pattern
+func ignored(rel string, patterns []string) bool {
+	slashed := filepath.ToSlash(rel)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, slashed); ok {
+			return true
+		}
+		for _, part := range strings.Split(slashed, "/") {
+			if ok, _ := filepath.Match(pattern, part); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
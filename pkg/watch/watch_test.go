@@ -0,0 +1,116 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeFile writes content to root/rel, creating parent directories
+func writeFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	path := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", rel, err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	now := time.Now()
+	base := Snapshot{
+		"a.go": {size: 1, modTime: now},
+		"b.go": {size: 2, modTime: now},
+	}
+
+	tests := []struct {
+		name    string
+		current Snapshot
+		want    []string
+	}{
+		{
+			name:    "unchanged",
+			current: Snapshot{"a.go": {size: 1, modTime: now}, "b.go": {size: 2, modTime: now}},
+		},
+		{
+			name:    "modified",
+			current: Snapshot{"a.go": {size: 1, modTime: now.Add(time.Second)}, "b.go": {size: 2, modTime: now}},
+			want:    []string{"a.go"},
+		},
+		{
+			name:    "added and removed",
+			current: Snapshot{"b.go": {size: 2, modTime: now}, "c.go": {size: 3, modTime: now}},
+			want:    []string{"a.go", "c.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(base, tt.current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScan_Ignore(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "main.go", "package main")
+	writeFile(t, root, ".git/HEAD", "ref")
+	writeFile(t, root, "web/node_modules/x/index.js", "x")
+	writeFile(t, root, "build/out.o", "o")
+	writeFile(t, root, "notes.swp", "s")
+
+	snapshot, err := Scan(root, append(DefaultIgnore, "build", "*.swp"))
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	var got []string
+	for path := range snapshot {
+		got = append(got, path)
+	}
+	if !reflect.DeepEqual(got, []string{"main.go"}) {
+		t.Errorf("Scan() = %v, want [main.go]", got)
+	}
+}
+
+func TestNew_InvalidPattern(t *testing.T) {
+	if _, err := New(t.TempDir(), 0, []string{"["}); err == nil {
+		t.Error("expected error for invalid ignore pattern")
+	}
+}
+
+func TestWatcher_Next(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "main.go", "package main")
+
+	w, err := New(root, 10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	writeFile(t, root, "main_test.go", "package main")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	changed, err := w.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if !reflect.DeepEqual(changed, []string{"main_test.go"}) {
+		t.Errorf("Next() = %v, want [main_test.go]", changed)
+	}
+
+	// Without further changes, Next waits until the context ends
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := w.Next(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Next() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
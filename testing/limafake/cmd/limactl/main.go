@@ -0,0 +1,15 @@
+// Command limactl is the limafake fake limactl as a standalone binary, for
+// exercising llima-box from scripts. It keeps its state in
+// $LIMA_HOME/limafake.json; running instances report the SSH port recorded
+// there as sshPort.
+package main
+
+import (
+	"os"
+
+	"github.com/middlendian/llima-box/testing/limafake"
+)
+
+func main() {
+	os.Exit(limafake.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
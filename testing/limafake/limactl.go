@@ -0,0 +1,315 @@
+package limafake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+// limactlEnv marks a process started as the fake limactl. See Main.
+const limactlEnv = "LIMAFAKE_LIMACTL"
+
+// stateFile is the fake limactl's state in LIMA_HOME
+const stateFile = "limafake.json"
+
+// Rule scripts the fake limactl: an invocation whose arguments start with
+// Args (after global flags such as --tty=false) prints Stdout and Stderr and
+// exits with Exit instead of being handled. Rules are matched in order.
+type Rule struct {
+	Args   []string `json:"args"`
+	Stdout string   `json:"stdout,omitempty"`
+	Stderr string   `json:"stderr,omitempty"`
+	Exit   int      `json:"exit"`
+}
+
+// state is everything the fake limactl knows, kept in LIMA_HOME between
+// invocations
+type state struct {
+	// SSHPort is the port of the fake VM's SSH server, reported for
+	// running instances
+	SSHPort int `json:"sshPort"`
+
+	// User is the user name instances report for SSH
+	User string `json:"user"`
+
+	Instances []vm.Instance `json:"instances"`
+	Disks     []vm.Disk     `json:"disks"`
+	Rules     []Rule        `json:"rules,omitempty"`
+
+	// Calls records the arguments of every invocation
+	Calls [][]string `json:"calls"`
+}
+
+// loadState reads the state kept in limaHome
+func loadState(limaHome string) (*state, error) {
+	data, err := os.ReadFile(filepath.Join(limaHome, stateFile)) // #nosec G304 -- the path is inside LIMA_HOME
+	if errors.Is(err, os.ErrNotExist) {
+		return &state{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read limafake state: %w", err)
+	}
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse limafake state: %w", err)
+	}
+	return &s, nil
+}
+
+// save writes s to limaHome, replacing the previous state atomically
+func (s *state) save(limaHome string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode limafake state: %w", err)
+	}
+	tmp := filepath.Join(limaHome, stateFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write limafake state: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(limaHome, stateFile)); err != nil {
+		return fmt.Errorf("failed to write limafake state: %w", err)
+	}
+	return nil
+}
+
+// instance returns the named instance, or nil
+func (s *state) instance(name string) *vm.Instance {
+	for i := range s.Instances {
+		if s.Instances[i].Name == name {
+			return &s.Instances[i]
+		}
+	}
+	return nil
+}
+
+// Main runs the fake limactl and exits if the process was started as one by
+// a Harness, and returns otherwise. Call it first thing in TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		limafake.Main()
+//		os.Exit(m.Run())
+//	}
+func Main() {
+	if os.Getenv(limactlEnv) == "" {
+		return
+	}
+	os.Exit(Run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Run handles one limactl invocation with state kept in $LIMA_HOME and
+// returns its exit status. It supports the subcommands llima-box uses:
+// list, create, start, stop, delete, and disk list/create/delete, and
+// --version.
+func Run(args []string, stdout, stderr io.Writer) int {
+	limaHome := os.Getenv("LIMA_HOME")
+	if limaHome == "" {
+		_, _ = fmt.Fprintln(stderr, "limafake: LIMA_HOME is not set")
+		return 1
+	}
+
+	s, err := loadState(limaHome)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	// Global flags come before the subcommand
+	version := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		version = version || args[0] == "--version"
+		args = args[1:]
+	}
+	s.Calls = append(s.Calls, args)
+
+	status := 0
+	if rule := s.match(args); rule != nil {
+		_, _ = io.WriteString(stdout, rule.Stdout)
+		_, _ = io.WriteString(stderr, rule.Stderr)
+		status = rule.Exit
+	} else if version && len(args) == 0 {
+		_, _ = fmt.Fprintf(stdout, "limactl version %s\n", Version)
+	} else if err := s.handle(limaHome, args, stdout); err != nil {
+		_, _ = fmt.Fprintf(stderr, "limafake: %v\n", err)
+		status = 1
+	}
+
+	if err := s.save(limaHome); err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return status
+}
+
+// match returns the first rule matching args, or nil
+func (s *state) match(args []string) *Rule {
+	for i, rule := range s.Rules {
+		if len(rule.Args) > len(args) {
+			continue
+		}
+		matched := true
+		for j, arg := range rule.Args {
+			if args[j] != arg {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return &s.Rules[i]
+		}
+	}
+	return nil
+}
+
+// handle carries out a limactl subcommand
+func (s *state) handle(limaHome string, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no subcommand")
+	}
+	flags, positional := splitFlags(args[1:])
+
+	switch args[0] {
+	case "list":
+		return writeJSONLines(stdout, s.Instances)
+
+	case "create":
+		name := flags["name"]
+		if name == "" || len(positional) != 1 {
+			return fmt.Errorf("usage: create --name=NAME CONFIG")
+		}
+		if s.instance(name) != nil {
+			return fmt.Errorf("instance %q already exists", name)
+		}
+		dir := filepath.Join(limaHome, name)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		config, err := os.ReadFile(positional[0])
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "lima.yaml"), config, 0600); err != nil {
+			return err
+		}
+		s.Instances = append(s.Instances, instanceFor(name, dir, s.User))
+		return nil
+
+	case "start", "stop", "delete":
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: %s NAME", args[0])
+		}
+		inst := s.instance(positional[0])
+		if inst == nil {
+			return fmt.Errorf("instance %q does not exist", positional[0])
+		}
+		switch args[0] {
+		case "start":
+			inst.Status, inst.SSHLocalPort = "Running", s.SSHPort
+		case "stop":
+			inst.Status, inst.SSHLocalPort = "Stopped", 0
+		case "delete":
+			if inst.Status == "Running" && flags["force"] == "" {
+				return fmt.Errorf("instance %q is running (use --force)", inst.Name)
+			}
+			if err := os.RemoveAll(inst.Dir); err != nil {
+				return err
+			}
+			var kept []vm.Instance
+			for _, i := range s.Instances {
+				if i.Name != positional[0] {
+					kept = append(kept, i)
+				}
+			}
+			s.Instances = kept
+		}
+		return nil
+
+	case "disk":
+		return s.handleDisk(limaHome, args[1:], stdout)
+	}
+
+	return fmt.Errorf("unsupported subcommand %q (script it with a Rule)", args[0])
+}
+
+// instanceFor returns a new, stopped instance
+func instanceFor(name, dir, user string) vm.Instance {
+	return vm.Instance{
+		Name:   name,
+		Status: "Stopped",
+		Dir:    dir,
+		Arch:   "aarch64",
+		CPUs:   4,
+		Memory: 4 << 30,
+		Disk:   100 << 30,
+		Config: &vm.InstanceConfig{User: &vm.UserConfig{Name: &user}},
+	}
+}
+
+// handleDisk carries out a limactl disk subcommand
+func (s *state) handleDisk(limaHome string, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no disk subcommand")
+	}
+	_, positional := splitFlags(args[1:])
+
+	switch args[0] {
+	case "list":
+		return writeJSONLines(stdout, s.Disks)
+	case "create":
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: disk create NAME --size=SIZE")
+		}
+		for _, d := range s.Disks {
+			if d.Name == positional[0] {
+				return fmt.Errorf("disk %q already exists", d.Name)
+			}
+		}
+		s.Disks = append(s.Disks, vm.Disk{Name: positional[0], Size: 100 << 30, Dir: filepath.Join(limaHome, "_disks", positional[0])})
+		return nil
+	case "delete":
+		var kept []vm.Disk
+		for _, d := range s.Disks {
+			if len(positional) == 0 || d.Name != positional[0] {
+				kept = append(kept, d)
+			}
+		}
+		s.Disks = kept
+		return nil
+	}
+	return fmt.Errorf("unsupported disk subcommand %q (script it with a Rule)", args[0])
+}
+
+// splitFlags separates --flag and --flag=value arguments from positional
+// ones. Flags without a value are recorded as "true".
+func splitFlags(args []string) (map[string]string, []string) {
+	flags := make(map[string]string)
+	var positional []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			positional = append(positional, arg)
+			continue
+		}
+		name, value, found := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !found {
+			value = "true"
+		}
+		flags[name] = value
+	}
+	return flags, positional
+}
+
+// writeJSONLines writes one JSON object per line, like limactl's --json
+func writeJSONLines[T any](w io.Writer, items []T) error {
+	enc := json.NewEncoder(w)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
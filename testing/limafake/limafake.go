@@ -0,0 +1,200 @@
+// Package limafake runs llima-box against a fake Lima VM, so the CLI can be
+// tested end to end in CI, where there's no nested virtualization to run a
+// real one.
+//
+// A Harness puts a scripted limactl replacement first on PATH and starts an
+// in-process SSH server standing in for the VM. The fake limactl keeps its
+// instances and disks in a state file under LIMA_HOME and reports the SSH
+// server's port for running instances, so llima-box connects to the server
+// with the key Lima would have generated. Commands sent over SSH are
+// answered by handlers the test registers on the Server.
+//
+// The fake limactl is the test binary itself, started again with a marker
+// in its environment, so tests need a TestMain calling Main:
+//
+//	func TestMain(m *testing.M) {
+//		limafake.Main()
+//		os.Exit(m.Run())
+//	}
+//
+//	func TestList(t *testing.T) {
+//		h := limafake.New(t)
+//		h.CreateInstance("llima-box", true)
+//		h.Server.Respond(`^id `, "", 1)
+//		...
+//	}
+//
+// For scripts and other languages, cmd/limactl builds the fake limactl as a
+// standalone binary; set LIMA_HOME and write limafake.json there.
+package limafake
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultUser is the user the fake VM's instances report for SSH
+const DefaultUser = "lima"
+
+// Version is the Lima version the fake limactl reports
+const Version = "1.0.3"
+
+// Harness is a fake Lima installation for one test
+type Harness struct {
+	// LimaHome is the fake LIMA_HOME, holding the limactl state, instance
+	// directories, and the SSH key
+	LimaHome string
+
+	// Server stands in for the VM's SSH server
+	Server *Server
+
+	t testing.TB
+}
+
+// New sets up a fake Lima installation for t and points the process at it:
+// PATH, LIMA_HOME, HOME, and the XDG configuration and state directories are
+// set for the test's duration, so llima-box neither finds a real VM nor
+// touches the user's files. Tests using it can't run in parallel.
+func New(t testing.TB) *Harness {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("limafake needs a POSIX shell for the fake limactl")
+	}
+
+	root := t.TempDir()
+	h := &Harness{LimaHome: filepath.Join(root, "lima"), t: t}
+	bin := filepath.Join(root, "bin")
+	for _, dir := range []string{h.LimaHome, bin, filepath.Join(h.LimaHome, "_config")} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clientKey, err := writeUserKey(filepath.Join(h.LimaHome, "_config", "user"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Server, err = newServer(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Server.Close() })
+
+	if err := writeLimactl(filepath.Join(bin, "limactl")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("LIMA_HOME", h.LimaHome)
+	t.Setenv("HOME", filepath.Join(root, "home"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "config"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(root, "state"))
+
+	h.update(func(s *state) {
+		s.SSHPort = h.Server.Port()
+		s.User = DefaultUser
+	})
+	return h
+}
+
+// writeUserKey writes a new private key where Lima keeps the key it uses
+// for all instances and returns its public half
+func writeUserKey(path string) (ssh.PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SSH key: %w", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "limafake")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SSH key: %w", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write SSH key: %w", err)
+	}
+	return ssh.NewPublicKey(pub)
+}
+
+// writeLimactl writes a limactl that runs the test binary as the fake
+// limactl
+func writeLimactl(path string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the test binary: %w", err)
+	}
+	script := fmt.Sprintf("#!/bin/sh\n%s=1 exec '%s' \"$@\"\n", limactlEnv, strings.ReplaceAll(self, "'", `'\''`))
+	if err := os.WriteFile(path, []byte(script), 0700); err != nil { // #nosec G306 -- the fake limactl must be executable
+		return fmt.Errorf("failed to write fake limactl: %w", err)
+	}
+	return nil
+}
+
+// update changes the fake limactl's state
+func (h *Harness) update(change func(s *state)) {
+	h.t.Helper()
+	s, err := loadState(h.LimaHome)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	change(s)
+	if err := s.save(h.LimaHome); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// CreateInstance adds an instance, as if `limactl create` had run, and
+// starts it if running is set
+func (h *Harness) CreateInstance(name string, running bool) {
+	h.t.Helper()
+	dir := filepath.Join(h.LimaHome, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		h.t.Fatal(err)
+	}
+	h.update(func(s *state) {
+		inst := instanceFor(name, dir, s.User)
+		if running {
+			inst.Status, inst.SSHLocalPort = "Running", s.SSHPort
+		}
+		s.Instances = append(s.Instances, inst)
+	})
+}
+
+// Script makes limactl invocations whose arguments start with rule.Args
+// print rule.Stdout and rule.Stderr and exit with rule.Exit. Rules added
+// later take precedence.
+func (h *Harness) Script(rule Rule) {
+	h.t.Helper()
+	h.update(func(s *state) { s.Rules = append([]Rule{rule}, s.Rules...) })
+}
+
+// Calls returns the arguments of every limactl invocation so far, without
+// global flags
+func (h *Harness) Calls() [][]string {
+	h.t.Helper()
+	s, err := loadState(h.LimaHome)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return s.Calls
+}
+
+// Status returns the named instance's status, or "" if it doesn't exist
+func (h *Harness) Status(name string) string {
+	h.t.Helper()
+	s, err := loadState(h.LimaHome)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	if inst := s.instance(name); inst != nil {
+		return inst.Status
+	}
+	return ""
+}
@@ -0,0 +1,175 @@
+package limafake
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/middlendian/llima-box/pkg/ssh"
+	"github.com/middlendian/llima-box/pkg/vm"
+)
+
+func TestMain(m *testing.M) {
+	Main()
+	os.Exit(m.Run())
+}
+
+func TestHarness_VMLifecycle(t *testing.T) {
+	h := New(t)
+	m := vm.NewManager("llima-box")
+	ctx := t.Context()
+
+	if err := m.EnsureRunning(ctx); err != nil {
+		t.Fatalf("EnsureRunning: %v", err)
+	}
+	if got := h.Status("llima-box"); got != "Running" {
+		t.Fatalf("expected the instance to be running, got %q", got)
+	}
+	configPath, err := m.GetConfigPath(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		t.Errorf("expected create to keep the configuration: %v", err)
+	}
+
+	if err := m.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := m.Delete(ctx, false); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if exists, err := m.Exists(ctx); err != nil || exists {
+		t.Errorf("expected the instance to be gone, got exists=%v err=%v", exists, err)
+	}
+
+	var sawCreate bool
+	for _, call := range h.Calls() {
+		if call[0] == "create" {
+			sawCreate = true
+		}
+	}
+	if !sawCreate {
+		t.Errorf("expected a create call, got %v", h.Calls())
+	}
+}
+
+func TestHarness_Script(t *testing.T) {
+	h := New(t)
+	h.CreateInstance("llima-box", false)
+	h.Script(Rule{Args: []string{"start"}, Stderr: "boom\n", Exit: 1})
+
+	err := vm.NewManager("llima-box").Start(t.Context())
+	if err == nil {
+		t.Fatal("expected the scripted start to fail")
+	}
+	if got := h.Status("llima-box"); got != "Stopped" {
+		t.Errorf("expected a scripted call not to change the state, got %q", got)
+	}
+}
+
+func TestHarness_SSH(t *testing.T) {
+	h := New(t)
+	h.CreateInstance("llima-box", true)
+	h.Server.Respond(`^echo `, "hello\n", 0)
+	h.Server.Respond(`^false$`, "", 3)
+
+	client, err := ssh.NewClient("llima-box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	out, err := client.Exec("echo hello")
+	if err != nil || out != "hello\n" {
+		t.Errorf("expected hello, got %q (err: %v)", out, err)
+	}
+	_, err = client.Exec("false")
+	if got := ssh.ExitStatus(err); got != 3 {
+		t.Errorf("expected exit status 3, got %d (err: %v)", got, err)
+	}
+	if got := h.Server.Commands(); len(got) != 2 || got[1] != "false" {
+		t.Errorf("expected the commands to be recorded, got %v", got)
+	}
+}
+
+func TestServer_Strict(t *testing.T) {
+	h := New(t)
+	h.CreateInstance("llima-box", true)
+	h.Server.SetStrict(true)
+
+	client, err := ssh.NewClient("llima-box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	out, err := client.Exec("rm -rf /")
+	if got := ssh.ExitStatus(err); got != 127 {
+		t.Errorf("expected exit status 127, got %d", got)
+	}
+	if !strings.Contains(out, "unexpected command") {
+		t.Errorf("expected the unexpected command to be reported, got %q", out)
+	}
+}
+
+func TestServer_SFTP(t *testing.T) {
+	h := New(t)
+	h.CreateInstance("llima-box", true)
+	h.Server.Handle(`sftp-server`, ServeSFTP)
+
+	src := filepath.Join(t.TempDir(), "src.txt")
+	if err := os.WriteFile(src, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := ssh.NewClient("llima-box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	for _, server := range []string{"", "sudo /usr/lib/openssh/sftp-server"} {
+		dst := filepath.Join(t.TempDir(), "dst.txt")
+		if err := client.Upload(t.Context(), src, dst, ssh.TransferOptions{Server: server}); err != nil {
+			t.Fatalf("Upload with server %q: %v", server, err)
+		}
+		f, err := os.Open(dst) // #nosec G304 -- test file
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(f)
+		_ = f.Close()
+		if string(data) != "data" {
+			t.Errorf("server %q: expected the file to be copied, got %q", server, data)
+		}
+	}
+}
+
+func TestServer_Batch(t *testing.T) {
+	h := New(t)
+	h.CreateInstance("llima-box", true)
+	h.Server.Respond(`^echo one$`, "one\n", 0)
+	h.Server.Respond(`^false$`, "", 1)
+
+	client, err := ssh.NewClient("llima-box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	results, err := client.ExecBatch(t.Context(), []string{"echo one", "true", "false", "never"})
+	if err != nil {
+		t.Fatalf("ExecBatch failed: %v", err)
+	}
+	want := []ssh.BatchResult{{Output: "one\n"}, {}, {Status: 1}}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("got %+v, want %+v", results, want)
+	}
+	if got := h.Server.Commands(); !reflect.DeepEqual(got, []string{"echo one", "true", "false"}) {
+		t.Errorf("expected each batched command to be recorded, got %v", got)
+	}
+}
@@ -0,0 +1,361 @@
+package limafake
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Command is a command run in the fake VM over SSH
+type Command struct {
+	// Line is the command line as sent by the client
+	Line string
+
+	// PTY is whether the client requested a terminal
+	PTY bool
+
+	// Env holds the variables the client set with env requests
+	Env map[string]string
+
+	// Signal, if a handler sets it, reports that the command was killed by
+	// the signal, such as "KILL", instead of its exit status
+	Signal string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Handler runs a command in the fake VM and returns its exit status
+type Handler func(cmd *Command) int
+
+// route sends commands matching pattern to handler
+type route struct {
+	pattern *regexp.Regexp
+	handler Handler
+}
+
+// Server is an SSH server standing in for the VM. Commands are answered by
+// handlers registered with Handle and Respond; commands no handler matches
+// succeed without output, or fail with status 127 when the server is
+// strict. Scripts sent by ssh.Client.ExecBatch are split into their
+// commands, which are matched one by one. The sftp subsystem serves the host
+// filesystem.
+type Server struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	mu       sync.Mutex
+	routes   []route
+	commands []string
+	strict   bool
+	conns    map[net.Conn]bool
+	wg       sync.WaitGroup
+}
+
+// newServer starts a server on a local port accepting clientKey
+func newServer(clientKey ssh.PublicKey) (*Server, error) {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate host key: %w", err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate host key: %w", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, fmt.Errorf("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	s := &Server{listener: listener, config: config, conns: make(map[net.Conn]bool)}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Port returns the port the server listens on
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Close stops the server, closing its connections
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// Handle runs handler for commands matching the regular expression pattern.
+// Handlers registered later take precedence.
+func (s *Server) Handle(pattern string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = append([]route{{pattern: regexp.MustCompile(pattern), handler: handler}}, s.routes...)
+}
+
+// Respond answers commands matching the regular expression pattern with
+// stdout and status
+func (s *Server) Respond(pattern, stdout string, status int) {
+	s.Handle(pattern, func(cmd *Command) int {
+		_, _ = io.WriteString(cmd.Stdout, stdout)
+		return status
+	})
+}
+
+// SetStrict makes commands no handler matches fail with status 127, so
+// tests notice commands they didn't expect
+func (s *Server) SetStrict(strict bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strict = strict
+}
+
+// Commands returns the command lines run so far, in order
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// handler returns the handler for line and records it
+func (s *Server) handler(line string) Handler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, line)
+	for _, r := range s.routes {
+		if r.pattern.MatchString(line) {
+			return r.handler
+		}
+	}
+	if s.strict {
+		return func(cmd *Command) int {
+			_, _ = fmt.Fprintf(cmd.Stderr, "limafake: unexpected command: %s\n", cmd.Line)
+			return 127
+		}
+	}
+	return func(*Command) int { return 0 }
+}
+
+// run runs cmd with the handler matching it. Scripts sent by
+// ssh.Client.ExecBatch are taken apart, and each of their commands is run as
+// a command of its own.
+func (s *Server) run(cmd *Command) int {
+	marker, lines, ok := splitBatch(cmd.Line)
+	if !ok {
+		return s.handler(cmd.Line)(cmd)
+	}
+
+	// Batches merge stderr into stdout
+	for _, line := range lines {
+		part := *cmd
+		part.Line, part.Stderr = line, cmd.Stdout
+		status := s.handler(line)(&part)
+		_, _ = fmt.Fprintf(cmd.Stdout, "\n%s %d\n", marker, status)
+		if status != 0 {
+			_, _ = fmt.Fprintf(cmd.Stdout, "%s end\n", marker)
+			return status
+		}
+	}
+	_, _ = fmt.Fprintf(cmd.Stdout, "%s end\n", marker)
+	return 0
+}
+
+// batchEnd is the last line of an ExecBatch script
+var batchEnd = regexp.MustCompile(`\necho (llima-box-batch-[0-9a-f]+) end\n$`)
+
+// splitBatch returns the marker and commands of a script sent by
+// ssh.Client.ExecBatch, or false if script isn't one
+func splitBatch(script string) (marker string, cmds []string, ok bool) {
+	body, found := strings.CutPrefix(script, "exec 2>&1\n")
+	end := batchEnd.FindStringSubmatch(body)
+	if !found || end == nil {
+		return "", nil, false
+	}
+	marker = end[1]
+	body = body[:len(body)-len(end[0])+1]
+
+	sep := fmt.Sprintf("\n)\ns=$?; printf '\\n%s %%d\\n' $s; [ $s -eq 0 ] || { echo %s end; exit $s; }\n", marker, marker)
+	for body != "" {
+		part, rest, found := strings.Cut(body, sep)
+		part, isCommand := strings.CutPrefix(part, "(\n")
+		if !found || !isCommand {
+			return "", nil, false
+		}
+		cmds = append(cmds, part)
+		body = rest
+	}
+	return marker, cmds, true
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	defer func() { _ = sshConn.Close() }()
+	go ssh.DiscardRequests(requests)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, chanRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveSession(channel, chanRequests)
+		}()
+	}
+}
+
+// serveSession handles one session: environment and terminal requests,
+// then the command, shell, or subsystem that ends it
+func (s *Server) serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer func() { _ = channel.Close() }()
+
+	cmd := &Command{Env: make(map[string]string), Stdin: channel, Stdout: channel, Stderr: channel.Stderr()}
+	for req := range requests {
+		switch req.Type {
+		case "env":
+			var kv struct{ Name, Value string }
+			if ssh.Unmarshal(req.Payload, &kv) == nil {
+				cmd.Env[kv.Name] = kv.Value
+			}
+			_ = req.Reply(true, nil)
+
+		case "pty-req":
+			cmd.PTY = true
+			_ = req.Reply(true, nil)
+
+		case "window-change", "signal", "auth-agent-req@openssh.com":
+			_ = req.Reply(req.WantReply, nil)
+
+		case "exec", "shell":
+			var payload struct{ Command string }
+			if req.Type == "exec" && ssh.Unmarshal(req.Payload, &payload) != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+			cmd.Line = payload.Command
+
+			// Window changes and signals may still arrive
+			go func() {
+				for req := range requests {
+					_ = req.Reply(req.WantReply, nil)
+				}
+			}()
+			status := s.run(cmd)
+			_ = channel.CloseWrite()
+			if cmd.Signal != "" {
+				_, _ = channel.SendRequest("exit-signal", false, ssh.Marshal(struct {
+					Signal     string
+					CoreDumped bool
+					Error      string
+					Lang       string
+				}{Signal: cmd.Signal}))
+				return
+			}
+			_, _ = channel.SendRequest("exit-status", false, binary.BigEndian.AppendUint32(nil, uint32(status))) // #nosec G115 -- exit statuses are small
+			return
+
+		case "subsystem":
+			var payload struct{ Name string }
+			if ssh.Unmarshal(req.Payload, &payload) != nil || payload.Name != "sftp" {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			_ = server.Serve()
+			_ = server.Close()
+			return
+
+		default:
+			_ = req.Reply(false, nil)
+		}
+	}
+}
+
+// ServeSFTP is a Handler serving SFTP on the command's input and output, for
+// commands that start an SFTP server, such as the one llima-box runs inside
+// an environment. Like the sftp subsystem, it serves the host filesystem.
+func ServeSFTP(cmd *Command) int {
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.Writer
+		io.Closer
+	}{cmd.Stdin, cmd.Stdout, io.NopCloser(nil)})
+	if err != nil {
+		_, _ = fmt.Fprintf(cmd.Stderr, "limafake: %v\n", err)
+		return 1
+	}
+	if err := server.Serve(); err != nil && err != io.EOF {
+		_, _ = fmt.Fprintf(cmd.Stderr, "limafake: %v\n", err)
+		return 1
+	}
+	return 0
+}